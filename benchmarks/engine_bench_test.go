@@ -5,6 +5,7 @@ import (
 	"net"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/bypepe77/ZenithDB/pkg/zenithdb"
@@ -22,7 +23,7 @@ func BenchmarkGenericEngineFindUniqueByPrimaryKey(b *testing.B) {
 	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, ok, err := db.FindUnique(ctx, "User", where, nil)
+		_, ok, err := db.FindUnique(ctx, "User", where, nil, nil)
 		if err != nil {
 			b.Fatalf("find unique: %v", err)
 		}
@@ -41,7 +42,7 @@ func BenchmarkGenericEngineFindUniqueByPrimaryKeyParallel(b *testing.B) {
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			_, ok, err := db.FindUnique(ctx, "User", where, nil)
+			_, ok, err := db.FindUnique(ctx, "User", where, nil, nil)
 			if err != nil {
 				b.Fatalf("find unique: %v", err)
 			}
@@ -79,7 +80,7 @@ func BenchmarkWireFindUniqueByPrimaryKey(b *testing.B) {
 	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, ok, err := client.FindUnique(ctx, "User", where, nil)
+		_, ok, err := client.FindUnique(ctx, "User", where, nil, nil)
 		if err != nil {
 			b.Fatalf("find unique: %v", err)
 		}
@@ -167,6 +168,68 @@ func BenchmarkGeneratedPrismaLikeFindUnique(b *testing.B) {
 	}
 }
 
+// Atomic writes fork only the tables and index paths they touch, so their
+// cost should stay flat between a small table and one with a million rows.
+var writeBenchmarkSizes = []int{10_000, 1_000_000}
+
+func BenchmarkBatchUpdateOneRecord(b *testing.B) {
+	benchmarkWriteSizes(b, func(b *testing.B, db *zenithdb.DB) {
+		ctx := context.Background()
+		operations := []zenithdb.BatchOperation{{
+			Type:   zenithdb.BatchUpdate,
+			Model:  "User",
+			Where:  map[string]any{"id": "u4242"},
+			Record: zenithdb.Record{"name": "Updated"},
+		}}
+		for i := 0; i < b.N; i++ {
+			if _, err := db.Batch(ctx, operations); err != nil {
+				b.Fatalf("batch: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkUpsertOneRecord(b *testing.B) {
+	benchmarkWriteSizes(b, func(b *testing.B, db *zenithdb.DB) {
+		ctx := context.Background()
+		where := map[string]any{"email": "u4242@example.com"}
+		for i := 0; i < b.N; i++ {
+			if _, _, err := db.Upsert(ctx, "User", where, nil, zenithdb.Record{"name": "Upserted"}); err != nil {
+				b.Fatalf("upsert: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkUpdateManyOneRecord(b *testing.B) {
+	benchmarkWriteSizes(b, func(b *testing.B, db *zenithdb.DB) {
+		ctx := context.Background()
+		query := zenithdb.Query{Where: map[string]any{"id": "u4242"}}
+		for i := 0; i < b.N; i++ {
+			if _, err := db.UpdateMany(ctx, "User", query, zenithdb.Record{"name": "Updated"}); err != nil {
+				b.Fatalf("update many: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkCreateMany100(b *testing.B) {
+	benchmarkWriteSizes(b, func(b *testing.B, db *zenithdb.DB) {
+		ctx := context.Background()
+		for i := 0; i < b.N; i++ {
+			records := make([]zenithdb.Record, 100)
+			for j := range records {
+				createdUsers++
+				id := "created" + strconv.Itoa(createdUsers)
+				records[j] = zenithdb.Record{"id": id, "email": id + "@example.com", "name": "Created"}
+			}
+			if _, err := db.CreateMany(ctx, "User", records); err != nil {
+				b.Fatalf("create many: %v", err)
+			}
+		}
+	})
+}
+
 func BenchmarkDataDirRecoveryFromWAL(b *testing.B) {
 	ctx := context.Background()
 	dataDir := seedPersistentUsers(b, 10_000, false)
@@ -226,6 +289,58 @@ func seedUsers(b *testing.B, count int) *zenithdb.DB {
 	return db
 }
 
+// benchmarkWriteSizes runs bench against in-memory databases seeded with
+// each of writeBenchmarkSizes users. Seeded databases are shared between runs
+// because seeding a million rows dominates the benchmark otherwise.
+func benchmarkWriteSizes(b *testing.B, bench func(*testing.B, *zenithdb.DB)) {
+	for _, size := range writeBenchmarkSizes {
+		b.Run("rows="+strconv.Itoa(size), func(b *testing.B) {
+			db := seededWriteDB(b, size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			bench(b, db)
+		})
+	}
+}
+
+var (
+	writeDBsMu   sync.Mutex
+	writeDBs     = map[int]*zenithdb.DB{}
+	createdUsers int
+)
+
+func seededWriteDB(b *testing.B, count int) *zenithdb.DB {
+	b.Helper()
+	writeDBsMu.Lock()
+	defer writeDBsMu.Unlock()
+	if db, ok := writeDBs[count]; ok {
+		return db
+	}
+
+	ctx := context.Background()
+	db, err := zenithdb.Open(ctx, benchmarkSchema(), zenithdb.Options{})
+	if err != nil {
+		b.Fatalf("open db: %v", err)
+	}
+	const chunk = 10_000
+	for start := 0; start < count; start += chunk {
+		records := make([]zenithdb.Record, 0, chunk)
+		for i := start; i < start+chunk && i < count; i++ {
+			id := "u" + strconv.Itoa(i)
+			records = append(records, zenithdb.Record{
+				"id":    id,
+				"email": id + "@example.com",
+				"name":  "User " + strconv.Itoa(i),
+			})
+		}
+		if _, err := db.CreateMany(ctx, "User", records); err != nil {
+			b.Fatalf("create users: %v", err)
+		}
+	}
+	writeDBs[count] = db
+	return db
+}
+
 func seedPosts(b *testing.B, count int) *zenithdb.DB {
 	b.Helper()
 	ctx := context.Background()
@@ -386,7 +501,7 @@ func benchmarkSchema() zenithdb.Schema {
 					{Name: "post_author", Fields: []string{"authorId"}},
 				},
 				Relations: []zenithdb.Relation{
-					{Name: "author", Model: "User", Fields: []string{"authorId"}, References: []string{"id"}},
+					{Name: "author", Model: "User", Fields: []string{"authorId"}, References: []string{"id"}, ForeignKey: true},
 				},
 			},
 		},
@@ -26,9 +26,12 @@ const defaultSchemaPath = "zenith.schema"
 
 type replEngine interface {
 	Create(context.Context, string, zenithdb.Record) (zenithdb.MutationResult, error)
-	FindUnique(context.Context, string, map[string]any, map[string]zenithdb.Include) (zenithdb.Record, bool, error)
+	FindUnique(context.Context, string, map[string]any, map[string]zenithdb.Include, []string) (zenithdb.Record, bool, error)
 	FindMany(context.Context, string, zenithdb.Query) ([]zenithdb.Record, error)
 	Count(context.Context, string, zenithdb.Query) (int, error)
+	Explain(context.Context, string, zenithdb.Query) (zenithdb.Plan, error)
+	Aggregate(context.Context, string, zenithdb.AggregateQuery) (zenithdb.AggregateResult, error)
+	GroupBy(context.Context, string, zenithdb.GroupByQuery) ([]zenithdb.Group, error)
 	Close() error
 }
 
@@ -160,9 +163,6 @@ func runBench(args []string) error {
 	if !ok {
 		return fmt.Errorf("model %q not found in schema", *model)
 	}
-	if len(modelDef.PrimaryKey) != 1 {
-		return fmt.Errorf("bench currently requires a single-field primary key")
-	}
 
 	ctx := context.Background()
 	db, err := zenithdb.Open(ctx, schema, zenithdb.Options{})
@@ -171,27 +171,20 @@ func runBench(args []string) error {
 	}
 	defer db.Close()
 
-	primaryField := modelDef.PrimaryKey[0]
-	seededKey := ""
 	for i := 0; i < *records; i++ {
-		record := syntheticRecord(modelDef, i)
-		result, err := db.Create(ctx, modelDef.Name, record)
-		if err != nil {
+		if _, err := db.Create(ctx, modelDef.Name, syntheticRecord(modelDef, i)); err != nil {
 			return fmt.Errorf("seed record %d: %w", i, err)
 		}
-		if i == *records/2 {
-			seededKey = fmt.Sprint(record[primaryField])
-			_ = result
-		}
-	}
-	if seededKey == "" {
-		seededKey = fmt.Sprint(syntheticRecord(modelDef, 0)[primaryField])
 	}
 
-	where := map[string]any{primaryField: seededKey}
+	seeded := syntheticRecord(modelDef, *records/2)
+	where := make(map[string]any, len(modelDef.PrimaryKey))
+	for _, field := range modelDef.PrimaryKey {
+		where[field] = seeded[field]
+	}
 	start := time.Now()
 	for i := 0; i < *queries; i++ {
-		_, ok, err := db.FindUnique(ctx, modelDef.Name, where, nil)
+		_, ok, err := db.FindUnique(ctx, modelDef.Name, where, nil, nil)
 		if err != nil {
 			return err
 		}
@@ -228,7 +221,7 @@ func runREPL(args []string) error {
 	defer db.Close()
 
 	fmt.Println("ZenithDB REPL")
-	fmt.Println("commands: create <Model> field=value..., find <Model> field=value, list <Model> [field=value], exit")
+	fmt.Println("commands: create <Model> field=value..., find <Model> field=value, list <Model> [field=value], explain <Model> [field=value], aggregate <Model> _count=_all|field _sum=field... [field=value], groupby <Model> _by=field _count=_all... [field=value], exit")
 	scanner := bufio.NewScanner(os.Stdin)
 	for {
 		fmt.Print("zenith> ")
@@ -400,7 +393,7 @@ func runREPLCommand(ctx context.Context, db replEngine, line string) error {
 		}
 		fmt.Printf("created %s %s\n", result.Model, result.Key)
 	case "find":
-		record, ok, err := db.FindUnique(ctx, model, values, nil)
+		record, ok, err := db.FindUnique(ctx, model, values, nil, nil)
 		if err != nil {
 			return err
 		}
@@ -418,6 +411,38 @@ func runREPLCommand(ctx context.Context, db replEngine, line string) error {
 			printRecord(record)
 		}
 		fmt.Printf("%d record(s)\n", len(records))
+	case "explain":
+		plan, err := db.Explain(ctx, model, zenithdb.Query{Where: values, Limit: 50})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("access=%s indexes=%v estimatedRows=%d ordered=%t\n", plan.Access, plan.Indexes, plan.EstimatedRows, plan.Ordered)
+	case "aggregate":
+		query, _, err := parseAggregateOptions(values)
+		if err != nil {
+			return err
+		}
+		result, err := db.Aggregate(ctx, model, query)
+		if err != nil {
+			return err
+		}
+		printRecord(aggregateRecord(nil, result))
+	case "groupby":
+		query, by, err := parseAggregateOptions(values)
+		if err != nil {
+			return err
+		}
+		if len(by) == 0 {
+			return fmt.Errorf("groupby needs _by=field")
+		}
+		groups, err := db.GroupBy(ctx, model, zenithdb.GroupByQuery{AggregateQuery: query, By: by, Limit: 50})
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			printRecord(aggregateRecord(group.Key, group.AggregateResult))
+		}
+		fmt.Printf("%d group(s)\n", len(groups))
 	default:
 		return fmt.Errorf("unknown REPL command %q", command)
 	}
@@ -452,6 +477,9 @@ func printSchemaSummary(schema zenithdb.Schema) {
 	for _, model := range schema.Models {
 		fmt.Printf("- %s fields=%d indexes=%d relations=%d primaryKey=%v\n", model.Name, len(model.Fields), len(model.Indexes), len(model.Relations), model.PrimaryKey)
 	}
+	for _, enum := range schema.Enums {
+		fmt.Printf("- enum %s values=%v\n", enum.Name, enum.Values)
+	}
 }
 
 func parseAssignments(parts []string) (map[string]any, error) {
@@ -466,6 +494,63 @@ func parseAssignments(parts []string) (map[string]any, error) {
 	return values, nil
 }
 
+// parseAggregateOptions moves the _count, _sum, _avg, _min, _max, and _by
+// options out of values, which keeps the field filters. Each option takes a
+// comma-separated field list, and _count=_all counts every record.
+func parseAggregateOptions(values map[string]any) (zenithdb.AggregateQuery, []string, error) {
+	var query zenithdb.AggregateQuery
+	var by []string
+	for key, value := range values {
+		if !strings.HasPrefix(key, "_") {
+			continue
+		}
+		delete(values, key)
+		fields := strings.Split(fmt.Sprint(value), ",")
+		switch key {
+		case "_count":
+			for _, field := range fields {
+				if field == "_all" {
+					query.CountAll = true
+				} else {
+					query.Count = append(query.Count, field)
+				}
+			}
+		case "_sum":
+			query.Sum = append(query.Sum, fields...)
+		case "_avg":
+			query.Avg = append(query.Avg, fields...)
+		case "_min":
+			query.Min = append(query.Min, fields...)
+		case "_max":
+			query.Max = append(query.Max, fields...)
+		case "_by":
+			by = append(by, fields...)
+		default:
+			return zenithdb.AggregateQuery{}, nil, fmt.Errorf("unknown aggregate option %q", key)
+		}
+	}
+	query.Query = zenithdb.Query{Where: values}
+	return query, by, nil
+}
+
+// aggregateRecord flattens a result into key fields plus _count and
+// _func.field entries for printing.
+func aggregateRecord(key zenithdb.Record, result zenithdb.AggregateResult) zenithdb.Record {
+	record := zenithdb.Record{"_count": result.CountAll}
+	for field, value := range key {
+		record[field] = value
+	}
+	for field, count := range result.Count {
+		record["_count."+field] = count
+	}
+	for name, values := range map[string]map[string]any{"_sum": result.Sum, "_avg": result.Avg, "_min": result.Min, "_max": result.Max} {
+		for field, value := range values {
+			record[name+"."+field] = value
+		}
+	}
+	return record
+}
+
 func parseScalar(value string) any {
 	if parsed, err := strconv.ParseBool(value); err == nil {
 		return parsed
@@ -512,22 +597,52 @@ func syntheticRecord(model zenithdb.Model, index int) zenithdb.Record {
 }
 
 func syntheticValue(field zenithdb.Field, index int) any {
+	if field.List {
+		field.List = false
+		return []any{syntheticValue(field, index)}
+	}
 	switch field.Kind {
 	case zenithdb.FieldString:
-		return strings.ToLower(field.Name) + "_" + strconv.Itoa(index)
+		value := strings.ToLower(field.Name) + "_" + strconv.Itoa(index)
+		for _, validation := range field.Validations {
+			if validation.Rule == zenithdb.RuleEmail {
+				value += "@example.com"
+			}
+		}
+		return value
 	case zenithdb.FieldInt64:
-		return int64(index)
+		return int64(syntheticNumber(field, index))
 	case zenithdb.FieldBool:
 		return index%2 == 0
 	case zenithdb.FieldFloat:
-		return float64(index)
+		return syntheticNumber(field, index)
 	case zenithdb.FieldTime:
 		return time.Unix(int64(index), 0).UTC()
+	case zenithdb.FieldEnum:
+		return field.Values[index%len(field.Values)]
+	case zenithdb.FieldJSON:
+		return map[string]any{"index": int64(index)}
+	case zenithdb.FieldBytes:
+		return []byte(strconv.Itoa(index))
 	default:
 		return strconv.Itoa(index)
 	}
 }
 
+// syntheticNumber returns index within the @min and @max bounds of field.
+func syntheticNumber(field zenithdb.Field, index int) float64 {
+	value := float64(index)
+	for _, validation := range field.Validations {
+		switch validation.Rule {
+		case zenithdb.RuleMin:
+			value = max(value, validation.Limit)
+		case zenithdb.RuleMax:
+			value = min(value, validation.Limit)
+		}
+	}
+	return value
+}
+
 func cleanPath(path string) string {
 	if dir := filepath.Dir(path); dir != "." {
 		return path
@@ -56,6 +56,35 @@ func TestGenerateCommand(t *testing.T) {
 	}
 }
 
+// TestGeneratedFixturesAreCurrent keeps the committed clients, which go build
+// ./... compiles, in step with the generator.
+func TestGeneratedFixturesAreCurrent(t *testing.T) {
+	for _, fixture := range []struct {
+		schema      string
+		out         string
+		packageName string
+	}{
+		{schema: "../../zenith.schema", out: "../../zenith/generated.go", packageName: "zenith"},
+		{schema: "../../zenith/composite/composite.schema", out: "../../zenith/composite/generated.go", packageName: "composite"},
+	} {
+		outputPath := filepath.Join(t.TempDir(), "generated.go")
+		if err := run([]string{"generate", "-schema", fixture.schema, "-out", outputPath, "-package", fixture.packageName}); err != nil {
+			t.Fatalf("generate %s: %v", fixture.schema, err)
+		}
+		generated, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatalf("read generated code: %v", err)
+		}
+		committed, err := os.ReadFile(fixture.out)
+		if err != nil {
+			t.Fatalf("read %s: %v", fixture.out, err)
+		}
+		if string(generated) != string(committed) {
+			t.Fatalf("%s is stale; regenerate it from %s", fixture.out, fixture.schema)
+		}
+	}
+}
+
 func TestGenerateFromRemoteWireSchema(t *testing.T) {
 	dir := t.TempDir()
 	schemaPath := filepath.Join(dir, "pulled.schema")
@@ -109,6 +138,18 @@ func TestREPLCommandCreateFindAndList(t *testing.T) {
 	if err := runREPLCommand(context.Background(), db, "list User"); err != nil {
 		t.Fatalf("list command: %v", err)
 	}
+	if err := runREPLCommand(context.Background(), db, "explain Post authorId=u1"); err != nil {
+		t.Fatalf("explain command: %v", err)
+	}
+	if err := runREPLCommand(context.Background(), db, "aggregate Post _count=_all,title authorId=u1"); err != nil {
+		t.Fatalf("aggregate command: %v", err)
+	}
+	if err := runREPLCommand(context.Background(), db, "groupby Post _by=authorId _count=_all"); err != nil {
+		t.Fatalf("groupby command: %v", err)
+	}
+	if err := runREPLCommand(context.Background(), db, "groupby Post _count=_all"); err == nil {
+		t.Fatal("expected groupby without _by to fail")
+	}
 }
 
 func startWireServer(t *testing.T, db *zenithdb.DB, options wire.Options) net.Listener {
@@ -1,3 +1,3 @@
 module github.com/bypepe77/ZenithDB
 
-go 1.22
+go 1.23
@@ -0,0 +1,476 @@
+package zenithdb
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// AggregateFunc names an aggregate function.
+type AggregateFunc string
+
+const (
+	AggregateCount AggregateFunc = "count"
+	AggregateSum   AggregateFunc = "sum"
+	AggregateAvg   AggregateFunc = "avg"
+	AggregateMin   AggregateFunc = "min"
+	AggregateMax   AggregateFunc = "max"
+)
+
+// AggregateQuery computes aggregates over the records Query selects, after
+// its Cursor, Skip, and Limit apply. CountAll counts those records, and the
+// other lists name the fields each function applies to: Count counts the
+// records that set a field, Sum and Avg take Int64 and Float fields, and Min
+// and Max also take Time fields.
+type AggregateQuery struct {
+	Query    Query
+	CountAll bool
+	Count    []string
+	Sum      []string
+	Avg      []string
+	Min      []string
+	Max      []string
+}
+
+// AggregateResult holds the aggregates an AggregateQuery asked for, by field.
+// Sum has the type of its field and Avg is a float64. Sum, Avg, Min, and Max
+// are nil for a field none of the records sets.
+type AggregateResult struct {
+	CountAll int
+	Count    map[string]int
+	Sum      map[string]any
+	Avg      map[string]any
+	Min      map[string]any
+	Max      map[string]any
+}
+
+// GroupByQuery groups the records an AggregateQuery selects by the By fields
+// and aggregates each group. Having keeps the groups whose aggregates match,
+// OrderBy orders them, by By fields ascending when empty, and Skip and Limit
+// page them.
+type GroupByQuery struct {
+	AggregateQuery
+	By      []string
+	Having  []Having
+	OrderBy []GroupOrderBy
+	Skip    int
+	Limit   int
+}
+
+// Having filters groups by one aggregate of Field. AggregateCount with an
+// empty Field filters by the number of records in the group.
+type Having struct {
+	Aggregate AggregateFunc
+	Field     string
+	Filter    Filter
+}
+
+// GroupOrderBy orders groups by a By field, or by an aggregate of Field when
+// Aggregate is set. Nulls places null values as it does in OrderBy.
+type GroupOrderBy struct {
+	Aggregate AggregateFunc
+	Field     string
+	Direction SortDirection
+	Nulls     NullsOrder
+}
+
+// Group is one GroupBy result: the By field values its records share and the
+// aggregates over them.
+type Group struct {
+	Key Record
+	AggregateResult
+}
+
+// fieldAggregate accumulates the values one field takes over a set of
+// records. Sums keep integers exact until Avg divides them.
+type fieldAggregate struct {
+	kind     FieldKind
+	count    int
+	sumInt   int64
+	sumFloat float64
+	min      any
+	max      any
+}
+
+func (agg *fieldAggregate) add(value any) {
+	if value == nil {
+		return
+	}
+	agg.count++
+	switch typed := value.(type) {
+	case int64:
+		agg.sumInt += typed
+	case float64:
+		agg.sumFloat += typed
+	}
+	if agg.min == nil || compareValues(value, agg.min) < 0 {
+		agg.min = value
+	}
+	if agg.max == nil || compareValues(value, agg.max) > 0 {
+		agg.max = value
+	}
+}
+
+// aggregateState accumulates every aggregate a query reads over one set of
+// records: the whole selection, or one group.
+type aggregateState struct {
+	count  int
+	fields map[string]*fieldAggregate
+}
+
+func newAggregateState(kinds map[string]FieldKind) *aggregateState {
+	state := &aggregateState{fields: make(map[string]*fieldAggregate, len(kinds))}
+	for field, kind := range kinds {
+		state.fields[field] = &fieldAggregate{kind: kind}
+	}
+	return state
+}
+
+func (state *aggregateState) add(record Record) {
+	state.count++
+	for field, agg := range state.fields {
+		agg.add(record[field])
+	}
+}
+
+// value returns one aggregate: an int64 count, a sum typed like its field, a
+// float64 average, or a minimum or maximum, nil when no record set Field.
+func (state *aggregateState) value(fn AggregateFunc, field string) any {
+	if fn == AggregateCount && field == "" {
+		return int64(state.count)
+	}
+	agg := state.fields[field]
+	if fn == AggregateCount {
+		return int64(agg.count)
+	}
+	if agg.count == 0 {
+		return nil
+	}
+	switch fn {
+	case AggregateSum:
+		if agg.kind == FieldInt64 {
+			return agg.sumInt
+		}
+		return agg.sumFloat
+	case AggregateAvg:
+		return (float64(agg.sumInt) + agg.sumFloat) / float64(agg.count)
+	case AggregateMin:
+		return agg.min
+	default:
+		return agg.max
+	}
+}
+
+func (state *aggregateState) result(query AggregateQuery) AggregateResult {
+	result := AggregateResult{}
+	if query.CountAll {
+		result.CountAll = state.count
+	}
+	if len(query.Count) > 0 {
+		result.Count = make(map[string]int, len(query.Count))
+		for _, field := range query.Count {
+			result.Count[field] = state.fields[field].count
+		}
+	}
+	collect := func(fn AggregateFunc, fields []string) map[string]any {
+		if len(fields) == 0 {
+			return nil
+		}
+		values := make(map[string]any, len(fields))
+		for _, field := range fields {
+			values[field] = state.value(fn, field)
+		}
+		return values
+	}
+	result.Sum = collect(AggregateSum, query.Sum)
+	result.Avg = collect(AggregateAvg, query.Avg)
+	result.Min = collect(AggregateMin, query.Min)
+	result.Max = collect(AggregateMax, query.Max)
+	return result
+}
+
+func (t *table) aggregate(query AggregateQuery) (AggregateResult, error) {
+	kinds, err := aggregateKinds(t.model, query, nil, nil)
+	if err != nil {
+		return AggregateResult{}, err
+	}
+	state := newAggregateState(kinds)
+	if err := t.each(query.Query, state.add); err != nil {
+		return AggregateResult{}, err
+	}
+	return state.result(query), nil
+}
+
+// groupState is one group of a GroupBy: the By values and their aggregates.
+type groupState struct {
+	key Record
+	*aggregateState
+}
+
+func (t *table) groupBy(query GroupByQuery) ([]Group, error) {
+	if len(query.By) == 0 {
+		return nil, fmt.Errorf("model %q group by requires at least one field", t.model.Name)
+	}
+	for _, name := range query.By {
+		if _, ok := findField(t.model, name); !ok {
+			return nil, fmt.Errorf("model %q does not define field %q", t.model.Name, name)
+		}
+	}
+	kinds, err := aggregateKinds(t.model, query.AggregateQuery, query.Having, query.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	having := make([]Having, 0, len(query.Having))
+	for _, filter := range query.Having {
+		kind := FieldInt64
+		switch {
+		case filter.Aggregate == AggregateAvg:
+			kind = FieldFloat
+		case filter.Aggregate != AggregateCount:
+			kind = kinds[filter.Field]
+		}
+		normalized, err := normalizeFilter(Field{Name: filter.Field, Kind: kind}, filter.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("model %q having %s %q: %w", t.model.Name, filter.Aggregate, filter.Field, err)
+		}
+		filter.Filter = normalized
+		having = append(having, filter)
+	}
+	for _, order := range query.OrderBy {
+		if order.Aggregate == "" && !slices.Contains(query.By, order.Field) {
+			return nil, fmt.Errorf("model %q can only order groups by a grouped field or an aggregate, not %q", t.model.Name, order.Field)
+		}
+		if err := validateSortOrder(order.Direction, order.Nulls); err != nil {
+			return nil, err
+		}
+	}
+
+	groups, err := t.groups(query, kinds)
+	if err != nil {
+		return nil, err
+	}
+	kept := groups[:0]
+	for _, group := range groups {
+		if group.matches(having) {
+			kept = append(kept, group)
+		}
+	}
+	groups = kept
+	orderBy := query.OrderBy
+	if len(orderBy) == 0 {
+		for _, field := range query.By {
+			orderBy = append(orderBy, GroupOrderBy{Field: field})
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		for _, order := range orderBy {
+			if comparison := compareOrder(groups[i].orderValue(order), groups[j].orderValue(order), order.Direction, order.Nulls); comparison != 0 {
+				return comparison < 0
+			}
+		}
+		return false
+	})
+
+	skip := min(max(query.Skip, 0), len(groups))
+	groups = groups[skip:]
+	if query.Limit > 0 && len(groups) > query.Limit {
+		groups = groups[:query.Limit]
+	}
+	result := make([]Group, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, Group{Key: group.key, AggregateResult: group.result(query.AggregateQuery)})
+	}
+	return result, nil
+}
+
+// groups collects the groups of the records query selects. When the
+// selection reads every record anyway and a hash index covers exactly the By
+// fields, the index buckets already are the groups, so no record needs to be
+// hashed and a bare record count needs no record reads beyond the first.
+func (t *table) groups(query GroupByQuery, kinds map[string]FieldKind) ([]*groupState, error) {
+	selection := query.Query
+	if index, ok := t.groupIndex(query.By); ok && selection.Limit == 0 && selection.Skip == 0 && len(selection.Cursor) == 0 {
+		selection.OrderBy = nil
+		selection, err := t.normalizeQuery(selection)
+		if err != nil {
+			return nil, err
+		}
+		plan, err := t.plan(selection)
+		if err != nil {
+			return nil, err
+		}
+		if len(plan.paths) == 0 && len(plan.union) == 0 {
+			return t.indexGroups(index, query.By, selection, kinds), nil
+		}
+	}
+
+	var groups []*groupState
+	byKey := make(map[string]*groupState)
+	values := make([]any, len(query.By))
+	err := t.each(query.Query, func(record Record) {
+		for i, field := range query.By {
+			values[i] = record[field]
+		}
+		key := encodeKey(values)
+		group, ok := byKey[key]
+		if !ok {
+			group = &groupState{key: groupKey(record, query.By), aggregateState: newAggregateState(kinds)}
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+		group.add(record)
+	})
+	return groups, err
+}
+
+// groupIndex returns a hash index over exactly the By fields. Every By field
+// has to be required: records missing an indexed field are not in the index.
+func (t *table) groupIndex(by []string) (*secondaryIndex, bool) {
+	for _, name := range by {
+		field, ok := findField(t.model, name)
+		if !ok || !field.Required {
+			return nil, false
+		}
+	}
+	for _, definition := range t.model.Indexes {
+		if definition.Type == IndexOrdered || definition.Unique || len(definition.Fields) != len(by) {
+			continue
+		}
+		covered := true
+		for _, field := range definition.Fields {
+			covered = covered && slices.Contains(by, field)
+		}
+		if covered {
+			return t.indexes[definition.Name], true
+		}
+	}
+	return nil, false
+}
+
+func (t *table) indexGroups(index *secondaryIndex, by []string, selection Query, kinds map[string]FieldKind) []*groupState {
+	countOnly := len(kinds) == 0 && len(selection.Where) == 0 && len(selection.Filters) == 0 && selection.FilterExpr == nil
+	var groups []*groupState
+	index.multi.each(func(_ string, bucket hamt[struct{}]) bool {
+		group := &groupState{aggregateState: newAggregateState(kinds)}
+		bucket.each(func(primaryKey string, _ struct{}) bool {
+			current, ok := t.rows.get(primaryKey)
+			if !ok || !matchesQuery(current.record, selection) {
+				return true
+			}
+			if group.key == nil {
+				group.key = groupKey(current.record, by)
+			}
+			if countOnly {
+				group.count = bucket.len()
+				return false
+			}
+			group.add(current.record)
+			return true
+		})
+		if group.key != nil {
+			groups = append(groups, group)
+		}
+		return true
+	})
+	return groups
+}
+
+func groupKey(record Record, by []string) Record {
+	key := make(Record, len(by))
+	for _, field := range by {
+		key[field] = record[field]
+	}
+	return key
+}
+
+func (group *groupState) matches(having []Having) bool {
+	for _, filter := range having {
+		value := group.value(filter.Aggregate, filter.Field)
+		if value == nil || !matchesFilter(value, filter.Filter) {
+			return false
+		}
+	}
+	return true
+}
+
+func (group *groupState) orderValue(order GroupOrderBy) any {
+	if order.Aggregate == "" {
+		return group.key[order.Field]
+	}
+	return group.value(order.Aggregate, order.Field)
+}
+
+// aggregateKinds validates the aggregates query, having, and orderBy read and
+// returns the kinds of the fields they read.
+func aggregateKinds(model Model, query AggregateQuery, having []Having, orderBy []GroupOrderBy) (map[string]FieldKind, error) {
+	kinds := make(map[string]FieldKind)
+	check := func(fn AggregateFunc, name string) error {
+		if fn == AggregateCount && name == "" {
+			return nil
+		}
+		field, ok := findField(model, name)
+		if !ok {
+			return fmt.Errorf("model %q does not define field %q", model.Name, name)
+		}
+		if !canAggregate(fn, field.Kind) || field.List && fn != AggregateCount {
+			return fmt.Errorf("model %q field %q of kind %s does not support %s", model.Name, name, field.Kind, fn)
+		}
+		kinds[name] = field.Kind
+		return nil
+	}
+	for _, list := range []struct {
+		fn     AggregateFunc
+		fields []string
+	}{
+		{AggregateCount, query.Count},
+		{AggregateSum, query.Sum},
+		{AggregateAvg, query.Avg},
+		{AggregateMin, query.Min},
+		{AggregateMax, query.Max},
+	} {
+		for _, name := range list.fields {
+			if name == "" {
+				return nil, fmt.Errorf("model %q %s requires a field", model.Name, list.fn)
+			}
+			if err := check(list.fn, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, filter := range having {
+		if err := check(filter.Aggregate, filter.Field); err != nil {
+			return nil, err
+		}
+	}
+	for _, order := range orderBy {
+		if order.Aggregate == "" {
+			continue
+		}
+		if err := check(order.Aggregate, order.Field); err != nil {
+			return nil, err
+		}
+	}
+	return kinds, nil
+}
+
+func canAggregate(fn AggregateFunc, kind FieldKind) bool {
+	switch fn {
+	case AggregateCount:
+		return true
+	case AggregateSum, AggregateAvg:
+		return kind == FieldInt64 || kind == FieldFloat
+	case AggregateMin, AggregateMax:
+		return kind == FieldInt64 || kind == FieldFloat || kind == FieldTime
+	default:
+		return false
+	}
+}
+
+func findField(model Model, name string) (Field, bool) {
+	for _, field := range model.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"go/format"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/bypepe77/ZenithDB/pkg/zenithdb"
@@ -27,17 +29,34 @@ func GenerateGoSchema(packageName, variableName string, schema zenithdb.Schema)
 func GenerateGoClient(packageName string, schema zenithdb.Schema) ([]byte, error) {
 	var buffer bytes.Buffer
 	fmt.Fprintf(&buffer, "package %s\n\n", packageName)
-	if schemaUsesTime(schema) {
-		fmt.Fprintf(&buffer, "import (\n%q\n%q\nzenithdb %q\nremote %q\n)\n\n", "context", "time", "github.com/bypepe77/ZenithDB/pkg/zenithdb", "github.com/bypepe77/ZenithDB/pkg/zenithdb/remote")
-	} else {
-		fmt.Fprintf(&buffer, "import (\n%q\nzenithdb %q\nremote %q\n)\n\n", "context", "github.com/bypepe77/ZenithDB/pkg/zenithdb", "github.com/bypepe77/ZenithDB/pkg/zenithdb/remote")
+	imports := []string{"context"}
+	if schemaUsesKind(schema, zenithdb.FieldJSON) {
+		imports = append(imports, "encoding/json")
+	}
+	imports = append(imports, "errors", "iter")
+	if schemaUsesKind(schema, zenithdb.FieldTime) {
+		imports = append(imports, "time")
 	}
+	fmt.Fprintf(&buffer, "import (\n")
+	for _, path := range imports {
+		fmt.Fprintf(&buffer, "%q\n", path)
+	}
+	fmt.Fprintf(&buffer, "zenithdb %q\nremote %q\n)\n\n", "github.com/bypepe77/ZenithDB/pkg/zenithdb", "github.com/bypepe77/ZenithDB/pkg/zenithdb/remote")
 	writeSchemaVariable(&buffer, "Schema", schema)
 	writeClient(&buffer, schema)
+	writeTransaction(&buffer, schema)
+	for _, enum := range schema.Enums {
+		writeEnumType(&buffer, enum)
+	}
 	for _, model := range schema.Models {
+		if hiddenModel(model) {
+			writeJoinLinks(&buffer, model)
+			continue
+		}
 		writeModelTypes(&buffer, schema, model)
 		writeModelStore(&buffer, model)
-		writeModelClient(&buffer, model)
+		writeModelClient(&buffer, schema, model)
+		writeModelTxClient(&buffer, schema, model)
 	}
 
 	formatted, err := format.Source(buffer.Bytes())
@@ -58,15 +77,27 @@ func writeSchemaVariable(buffer *bytes.Buffer, variableName string, schema zenit
 		writeRelations(buffer, model.Relations)
 		fmt.Fprintf(buffer, "},\n")
 	}
+	fmt.Fprintf(buffer, "},\n")
 
-	fmt.Fprintf(buffer, "},\n}\n\n")
+	if len(schema.Enums) > 0 {
+		fmt.Fprintf(buffer, "Enums: []zenithdb.Enum{\n")
+		for _, enum := range schema.Enums {
+			fmt.Fprintf(buffer, "{Name: %q, Values: []string{%s}},\n", enum.Name, quotedStrings(enum.Values))
+		}
+		fmt.Fprintf(buffer, "},\n")
+	}
+	fmt.Fprintf(buffer, "}\n\n")
 }
 
 func writeClient(buffer *bytes.Buffer, schema zenithdb.Schema) {
-	fmt.Fprintf(buffer, "type engine interface {\nCreate(context.Context, string, zenithdb.Record) (zenithdb.MutationResult, error)\nCreateMany(context.Context, string, []zenithdb.Record) ([]zenithdb.MutationResult, error)\nUpdate(context.Context, string, map[string]any, zenithdb.Record) (zenithdb.Record, error)\nUpdateMany(context.Context, string, zenithdb.Query, zenithdb.Record) (zenithdb.ManyResult, error)\nDelete(context.Context, string, map[string]any) (zenithdb.Record, error)\nDeleteMany(context.Context, string, zenithdb.Query) (zenithdb.ManyResult, error)\nUpsert(context.Context, string, map[string]any, zenithdb.Record, zenithdb.Record) (zenithdb.Record, bool, error)\nBatch(context.Context, []zenithdb.BatchOperation) ([]zenithdb.BatchResult, error)\nFindUnique(context.Context, string, map[string]any, map[string]zenithdb.Include) (zenithdb.Record, bool, error)\nFindMany(context.Context, string, zenithdb.Query) ([]zenithdb.Record, error)\nCount(context.Context, string, zenithdb.Query) (int, error)\nClose() error\n}\n\n")
+	fmt.Fprintf(buffer, "type engine interface {\nCreate(context.Context, string, zenithdb.Record) (zenithdb.MutationResult, error)\nCreateMany(context.Context, string, []zenithdb.Record) ([]zenithdb.MutationResult, error)\nUpdate(context.Context, string, map[string]any, zenithdb.Record) (zenithdb.Record, error)\nUpdateMany(context.Context, string, zenithdb.Query, zenithdb.Record) (zenithdb.ManyResult, error)\nDelete(context.Context, string, map[string]any) (zenithdb.Record, error)\nDeleteMany(context.Context, string, zenithdb.Query) (zenithdb.ManyResult, error)\nUpsert(context.Context, string, map[string]any, zenithdb.Record, zenithdb.Record) (zenithdb.Record, bool, error)\nBatch(context.Context, []zenithdb.BatchOperation) ([]zenithdb.BatchResult, error)\nFindUnique(context.Context, string, map[string]any, map[string]zenithdb.Include, []string) (zenithdb.Record, bool, error)\nFindMany(context.Context, string, zenithdb.Query) ([]zenithdb.Record, error)\nIterate(context.Context, string, zenithdb.Query) iter.Seq2[zenithdb.Record, error]\nCount(context.Context, string, zenithdb.Query) (int, error)\nAggregate(context.Context, string, zenithdb.AggregateQuery) (zenithdb.AggregateResult, error)\nGroupBy(context.Context, string, zenithdb.GroupByQuery) ([]zenithdb.Group, error)\nClose() error\n}\n\n")
 	fmt.Fprintf(buffer, "type Client struct {\ndb engine\nremote bool\n")
 	for _, model := range schema.Models {
-		fmt.Fprintf(buffer, "%s *%sStore\n", lowerIdentifier(model.Name), lowerIdentifier(model.Name))
+		if hiddenModel(model) {
+			fmt.Fprintf(buffer, "%[1]s *%[1]s\n", linksField(model.Name))
+			continue
+		}
+		fmt.Fprintf(buffer, "%s *%sStore\n", storeField(model.Name), lowerIdentifier(model.Name))
 		fmt.Fprintf(buffer, "%s %sClient\n", model.Name, model.Name)
 	}
 	fmt.Fprintf(buffer, "}\n\n")
@@ -77,31 +108,132 @@ func writeClient(buffer *bytes.Buffer, schema zenithdb.Schema) {
 	fmt.Fprintf(buffer, "func OpenURL(ctx context.Context, connectionURL string) (*Client, error) {\noptions, err := zenithdb.ParseConnectionURL(connectionURL)\nif err != nil {\nreturn nil, err\n}\nif options.WireURL != \"\" {\nschemaHash, err := Schema.Hash()\nif err != nil {\nreturn nil, err\n}\ndb, err := remote.OpenWithOptions(ctx, remote.OpenOptions{ConnectionURL: connectionURL, SchemaHash: schemaHash})\nif err != nil {\nreturn nil, err\n}\nreturn newClientFromEngine(ctx, db, false, true)\n}\nreturn Open(ctx, zenithdb.Options{ConnectionURL: connectionURL})\n}\n\n")
 	fmt.Fprintf(buffer, "func (c *Client) Close() error {\nreturn c.db.Close()\n}\n\n")
 	fmt.Fprintf(buffer, "func (c *Client) Batch(ctx context.Context, operations []zenithdb.BatchOperation) ([]zenithdb.BatchResult, error) {\nreturn c.db.Batch(ctx, operations)\n}\n\n")
+	fmt.Fprintf(buffer, "// recordValue returns the value of field, or the zero value when the record\n// does not hold it, as when a select left it out.\nfunc recordValue[T any](record zenithdb.Record, field string) T {\nvalue, _ := record[field].(T)\nreturn value\n}\n\n")
+	if slices.ContainsFunc(schema.Models, hiddenModel) {
+		fmt.Fprintf(buffer, "// unlink removes one link from key to value.\nfunc unlink[K, V comparable](links map[K][]V, key K, value V) {\nvalues := links[key]\nfor i, linked := range values {\nif linked == value {\nvalues = append(values[:i], values[i+1:]...)\nbreak\n}\n}\nif len(values) == 0 {\ndelete(links, key)\n} else {\nlinks[key] = values\n}\n}\n\n")
+	}
+	if schemaUsesKind(schema, zenithdb.FieldJSON) {
+		fmt.Fprintf(buffer, "// recordJSON returns the JSON value of field encoded, or nil when the record\n// does not hold it.\nfunc recordJSON(record zenithdb.Record, field string) json.RawMessage {\nvalue, ok := record[field]\nif !ok || value == nil {\nreturn nil\n}\nraw, _ := json.Marshal(value)\nreturn raw\n}\n\n")
+	}
+	if schemaHasField(schema, func(field zenithdb.Field) bool { return field.List }) {
+		writeListHelpers(buffer)
+	}
+	if schemaHasField(schema, nullable) {
+		writeNullableHelpers(buffer, schemaHasField(schema, func(field zenithdb.Field) bool {
+			return nullable(field) && field.Kind == zenithdb.FieldEnum
+		}))
+	}
 	fmt.Fprintf(buffer, "func newClientFromEngine(ctx context.Context, db engine, preload bool, remote bool) (*Client, error) {\nclient := &Client{db: db, remote: remote}\n")
 	for _, model := range schema.Models {
-		fmt.Fprintf(buffer, "client.%s = new%sStore()\n", lowerIdentifier(model.Name), model.Name)
+		if hiddenModel(model) {
+			fmt.Fprintf(buffer, "client.%s = new%s()\n", linksField(model.Name), exportedIdentifier(linksField(model.Name)))
+			continue
+		}
+		fmt.Fprintf(buffer, "client.%s = new%sStore()\n", storeField(model.Name), model.Name)
 	}
 	fmt.Fprintf(buffer, "if preload {\n")
 	for _, model := range schema.Models {
-		fmt.Fprintf(buffer, "if err := client.load%s(ctx); err != nil {\n_ = db.Close()\nreturn nil, err\n}\n", model.Name)
+		fmt.Fprintf(buffer, "if err := client.load%s(ctx); err != nil {\n_ = db.Close()\nreturn nil, err\n}\n", loadName(model))
 	}
-	fmt.Fprintf(buffer, "}\n")
+	fmt.Fprintf(buffer, "if local, ok := db.(*zenithdb.DB); ok {\nlocal.OnChange(client.apply)\n}\n}\n")
 	for _, model := range schema.Models {
+		if hiddenModel(model) {
+			continue
+		}
 		fmt.Fprintf(buffer, "client.%s = %sClient{client: client}\n", model.Name, model.Name)
 	}
 	fmt.Fprintf(buffer, "return client, nil\n}\n\n")
 	for _, model := range schema.Models {
-		fmt.Fprintf(buffer, "func (c *Client) load%s(ctx context.Context) error {\nrecords, err := c.db.FindMany(ctx, %q, zenithdb.Query{})\nif err != nil {\nreturn err\n}\nfor _, record := range records {\nc.%s.put(recordTo%s(record))\n}\nreturn nil\n}\n\n", model.Name, model.Name, lowerIdentifier(model.Name), model.Name)
+		if hiddenModel(model) {
+			fmt.Fprintf(buffer, "func (c *Client) load%s(ctx context.Context) error {\nrecords, err := c.db.FindMany(ctx, %q, zenithdb.Query{})\nif err != nil {\nreturn err\n}\nfor _, record := range records {\nc.%s.put(record)\n}\nreturn nil\n}\n\n", loadName(model), model.Name, linksField(model.Name))
+			continue
+		}
+		fmt.Fprintf(buffer, "func (c *Client) load%s(ctx context.Context) error {\nrecords, err := c.db.FindMany(ctx, %q, zenithdb.Query{})\nif err != nil {\nreturn err\n}\nfor _, record := range records {\nc.%s.put(recordTo%s(record))\n}\nreturn nil\n}\n\n", model.Name, model.Name, storeField(model.Name), model.Name)
+	}
+	fmt.Fprintf(buffer, "// apply updates the stores with the changes of one committed write, which\n// include the records its nested writes and referential actions changed. It\n// removes every replaced record before storing the new versions, so a unique\n// value that moves between records stays indexed.\nfunc (c *Client) apply(changes []zenithdb.Change) {\n")
+	for _, side := range []struct{ field, method string }{{"Before", "remove"}, {"After", "put"}} {
+		fmt.Fprintf(buffer, "for _, change := range changes {\nif change.%s == nil {\ncontinue\n}\nswitch change.Model {\n", side.field)
+		for _, model := range schema.Models {
+			if hiddenModel(model) {
+				fmt.Fprintf(buffer, "case %q:\nc.%s.%s(change.%s)\n", model.Name, linksField(model.Name), side.method, side.field)
+				continue
+			}
+			fmt.Fprintf(buffer, "case %q:\nc.%s.%s(recordTo%s(change.%s))\n", model.Name, storeField(model.Name), side.method, model.Name, side.field)
+		}
+		fmt.Fprintf(buffer, "}\n}\n")
 	}
+	fmt.Fprintf(buffer, "}\n\n")
 	for _, model := range schema.Models {
-		writeIncludeExpander(buffer, schema, model)
+		if !hiddenModel(model) {
+			writeIncludeExpander(buffer, schema, model)
+		}
+	}
+}
+
+// writeListHelpers emits ListUpdate, the update of a list field, and the
+// conversions between Go slices and the []any lists the engine stores.
+func writeListHelpers(buffer *bytes.Buffer) {
+	fmt.Fprintf(buffer, "// ListUpdate updates a list field: Set replaces the list unless it is nil,\n// and Push then appends its values.\ntype ListUpdate[T any] struct {\nSet []T\nPush []T\n}\n\n")
+	fmt.Fprintf(buffer, "func anyList[T any](values []T) []any {\nif values == nil {\nreturn nil\n}\nlist := make([]any, len(values))\nfor i, value := range values {\nlist[i] = value\n}\nreturn list\n}\n\n")
+	fmt.Fprintf(buffer, "// recordList returns the list field holds, or nil when the record does not\n// hold it.\nfunc recordList[T any](record zenithdb.Record, field string) []T {\nvalues, _ := record[field].([]any)\nif values == nil {\nreturn nil\n}\nlist := make([]T, 0, len(values))\nfor _, value := range values {\nif typed, ok := value.(T); ok {\nlist = append(list, typed)\n}\n}\nreturn list\n}\n\n")
+}
+
+// writeNullableHelpers emits Nullable, the update of a nullable field, and
+// the reads of nullable fields from records, with one for enums when enums
+// is set.
+func writeNullableHelpers(buffer *bytes.Buffer, enums bool) {
+	fmt.Fprintf(buffer, "// Nullable updates a nullable field: a nil Value sets it to null.\ntype Nullable[T any] struct {\nValue *T\n}\n\n")
+	fmt.Fprintf(buffer, "// recordPointer returns the value of field, or nil when the record holds\n// null or does not hold it.\nfunc recordPointer[T any](record zenithdb.Record, field string) *T {\nvalue, ok := record[field].(T)\nif !ok {\nreturn nil\n}\nreturn &value\n}\n\n")
+	if enums {
+		fmt.Fprintf(buffer, "// recordEnumPointer is recordPointer for an enum field, which the record\n// holds as a string.\nfunc recordEnumPointer[T ~string](record zenithdb.Record, field string) *T {\nvalue, ok := record[field].(string)\nif !ok {\nreturn nil\n}\ntyped := T(value)\nreturn &typed\n}\n\n")
+	}
+}
+
+// writeValidateMethods emits the Validate methods of the create and update
+// inputs of model, which check the fields an input sets against the
+// validation rules of Schema before a write does.
+func writeValidateMethods(buffer *bytes.Buffer, model zenithdb.Model) {
+	for _, input := range []string{"Create", "Update"} {
+		fmt.Fprintf(buffer, "// Validate checks the fields the input sets against their validation rules.\nfunc (input %s%sInput) Validate() error {\n", model.Name, input)
+		for _, field := range model.Fields {
+			if len(field.Validations) == 0 || input == "Update" && isPrimaryField(model, field.Name) {
+				continue
+			}
+			name := exportedIdentifier(field.Name)
+			check := func(expr string) string {
+				return fmt.Sprintf("if err := Schema.ValidateValue(%q, %q, %s); err != nil {\nreturn err\n}\n", model.Name, field.Name, expr)
+			}
+			switch {
+			case input == "Update" && nullable(field):
+				fmt.Fprintf(buffer, "if input.%[1]s != nil && input.%[1]s.Value != nil {\n%[2]s}\n", name, check("*input."+name+".Value"))
+			case input == "Update" || filledOnCreate(field) || nullable(field):
+				fmt.Fprintf(buffer, "if input.%s != nil {\n%s}\n", name, check("*input."+name))
+			default:
+				fmt.Fprint(buffer, check("input."+name))
+			}
+		}
+		fmt.Fprintf(buffer, "return nil\n}\n\n")
 	}
 }
 
+// writeEnumType emits enum as a string type with a constant for each value,
+// as in RoleAdmin for ADMIN, and a Valid method.
+func writeEnumType(buffer *bytes.Buffer, enum zenithdb.Enum) {
+	fmt.Fprintf(buffer, "type %s string\n\nconst (\n", enum.Name)
+	constants := make([]string, 0, len(enum.Values))
+	for _, value := range enum.Values {
+		constant := enumConstant(enum.Name, value)
+		constants = append(constants, constant)
+		fmt.Fprintf(buffer, "%s %s = %q\n", constant, enum.Name, value)
+	}
+	fmt.Fprintf(buffer, ")\n\n")
+	fmt.Fprintf(buffer, "// Valid reports whether value is one of the values of %s.\nfunc (value %s) Valid() bool {\nswitch value {\ncase %s:\nreturn true\ndefault:\nreturn false\n}\n}\n\n", enum.Name, enum.Name, strings.Join(constants, ", "))
+}
+
 func writeModelTypes(buffer *bytes.Buffer, schema zenithdb.Schema, model zenithdb.Model) {
 	fmt.Fprintf(buffer, "type %s struct {\n", model.Name)
 	for _, field := range model.Fields {
-		fmt.Fprintf(buffer, "%s %s `json:%q`\n", exportedIdentifier(field.Name), goType(field.Kind), field.Name)
+		fmt.Fprintf(buffer, "%s %s `json:%q`\n", exportedIdentifier(field.Name), modelFieldType(field), field.Name)
 	}
 	for _, relation := range model.Relations {
 		if relation.Many {
@@ -110,11 +242,54 @@ func writeModelTypes(buffer *bytes.Buffer, schema zenithdb.Schema, model zenithd
 			fmt.Fprintf(buffer, "%s *%s `json:%q`\n", exportedIdentifier(relation.Name), relation.Model, relation.Name)
 		}
 	}
+	counted := countedRelations(model)
+	if len(counted) > 0 {
+		fmt.Fprintf(buffer, "RelationCount *%sRelationCount `json:%q`\n", model.Name, zenithdb.CountField)
+	}
 	fmt.Fprintf(buffer, "}\n\n")
 
+	if key, ok := primaryKey(model); ok && key.compound() {
+		writeKeyType(buffer, key)
+	}
+	for _, index := range storeIndexes(model) {
+		if index.key.compound() {
+			writeKeyType(buffer, index.key)
+		}
+	}
+
+	if len(counted) > 0 {
+		fmt.Fprintf(buffer, "type %sRelationCount struct {\n", model.Name)
+		for _, relation := range counted {
+			fmt.Fprintf(buffer, "%s int64 `json:%q`\n", exportedIdentifier(relation.Name), relation.Name)
+		}
+		fmt.Fprintf(buffer, "}\n\n")
+
+		fmt.Fprintf(buffer, "type %sRelationCountSelect struct {\n", model.Name)
+		for _, relation := range counted {
+			fmt.Fprintf(buffer, "%s bool\n", exportedIdentifier(relation.Name))
+		}
+		fmt.Fprintf(buffer, "}\n\n")
+
+		fmt.Fprintf(buffer, "func (input *%sRelationCountSelect) fields() []string {\nvar fields []string\n", model.Name)
+		for _, relation := range counted {
+			fmt.Fprintf(buffer, "if input.%s {\nfields = append(fields, %q)\n}\n", exportedIdentifier(relation.Name), relation.Name)
+		}
+		fmt.Fprintf(buffer, "return fields\n}\n\n")
+	}
+
+	nested := nestedRelations(schema, model)
+	// A field the engine fills is optional: a nil pointer leaves it to the
+	// engine. A nil nullable field is left null.
 	fmt.Fprintf(buffer, "type %sCreateInput struct {\n", model.Name)
 	for _, field := range model.Fields {
-		fmt.Fprintf(buffer, "%s %s\n", exportedIdentifier(field.Name), goType(field.Kind))
+		if filledOnCreate(field) {
+			fmt.Fprintf(buffer, "%s *%s\n", exportedIdentifier(field.Name), fieldType(field))
+			continue
+		}
+		fmt.Fprintf(buffer, "%s %s\n", exportedIdentifier(field.Name), modelFieldType(field))
+	}
+	for _, relation := range nested {
+		fmt.Fprintf(buffer, "%s *%s\n", exportedIdentifier(relation.Name), nestedInputType(relation, "Create"))
 	}
 	fmt.Fprintf(buffer, "}\n\n")
 
@@ -123,31 +298,86 @@ func writeModelTypes(buffer *bytes.Buffer, schema zenithdb.Schema, model zenithd
 		if isPrimaryField(model, field.Name) {
 			continue
 		}
-		fmt.Fprintf(buffer, "%s *%s\n", exportedIdentifier(field.Name), goType(field.Kind))
+		switch {
+		case field.List:
+			fmt.Fprintf(buffer, "%s *ListUpdate[%s]\n", exportedIdentifier(field.Name), goType(field.Kind))
+		case nullable(field):
+			fmt.Fprintf(buffer, "%s *Nullable[%s]\n", exportedIdentifier(field.Name), fieldType(field))
+		default:
+			fmt.Fprintf(buffer, "%s *%s\n", exportedIdentifier(field.Name), fieldType(field))
+		}
+	}
+	for _, relation := range nested {
+		fmt.Fprintf(buffer, "%s *%s\n", exportedIdentifier(relation.Name), nestedInputType(relation, "Update"))
 	}
 	fmt.Fprintf(buffer, "}\n\n")
 
-	fmt.Fprintf(buffer, "func (input %sCreateInput) record() zenithdb.Record {\nreturn zenithdb.Record{\n", model.Name)
+	// A field the engine fills or a nullable field left nil is not written.
+	var fields, filled []zenithdb.Field
 	for _, field := range model.Fields {
-		fmt.Fprintf(buffer, "%q: input.%s,\n", field.Name, exportedIdentifier(field.Name))
+		if filledOnCreate(field) || nullable(field) {
+			filled = append(filled, field)
+		} else {
+			fields = append(fields, field)
+		}
+	}
+	if len(nested) == 0 && len(filled) == 0 {
+		fmt.Fprintf(buffer, "func (input %sCreateInput) record() zenithdb.Record {\nreturn zenithdb.Record{\n", model.Name)
+		for _, field := range fields {
+			fmt.Fprintf(buffer, "%q: %s,\n", field.Name, fieldValue(field, "input."+exportedIdentifier(field.Name)))
+		}
+		fmt.Fprintf(buffer, "}\n}\n\n")
+	} else {
+		fmt.Fprintf(buffer, "func (input %sCreateInput) record() zenithdb.Record {\nrecord := zenithdb.Record{\n", model.Name)
+		for _, field := range fields {
+			fmt.Fprintf(buffer, "%q: %s,\n", field.Name, fieldValue(field, "input."+exportedIdentifier(field.Name)))
+		}
+		fmt.Fprintf(buffer, "}\n")
+		for _, field := range filled {
+			fmt.Fprintf(buffer, "if input.%s != nil {\nrecord[%q] = %s\n}\n", exportedIdentifier(field.Name), field.Name, fieldValue(field, "*input."+exportedIdentifier(field.Name)))
+		}
+		writeNestedRecordValues(buffer, nested)
+		fmt.Fprintf(buffer, "return record\n}\n\n")
+	}
+	if len(nested) > 0 {
+		for _, input := range []string{"CreateInput", "UpdateInput"} {
+			fmt.Fprintf(buffer, "// nested reports whether the input writes related records.\nfunc (input %s%s) nested() bool {\nreturn ", model.Name, input)
+			for i, relation := range nested {
+				if i > 0 {
+					fmt.Fprintf(buffer, " || ")
+				}
+				fmt.Fprintf(buffer, "input.%s != nil", exportedIdentifier(relation.Name))
+			}
+			fmt.Fprintf(buffer, "\n}\n\n")
+		}
 	}
-	fmt.Fprintf(buffer, "}\n}\n\n")
 
 	fmt.Fprintf(buffer, "func (input %sUpdateInput) record() zenithdb.Record {\nrecord := zenithdb.Record{}\n", model.Name)
 	for _, field := range model.Fields {
 		if isPrimaryField(model, field.Name) {
 			continue
 		}
-		fmt.Fprintf(buffer, "if input.%s != nil {\nrecord[%q] = *input.%s\n}\n", exportedIdentifier(field.Name), field.Name, exportedIdentifier(field.Name))
+		name := exportedIdentifier(field.Name)
+		switch {
+		case field.List:
+			fmt.Fprintf(buffer, "if input.%s != nil {\nrecord[%q] = zenithdb.ListUpdate{Set: %s, Push: %s}\n}\n", name, field.Name, fieldValue(field, "input."+name+".Set"), fieldValue(field, "input."+name+".Push"))
+		case nullable(field):
+			fmt.Fprintf(buffer, "if input.%[1]s != nil {\nrecord[%[2]q] = nil\nif input.%[1]s.Value != nil {\nrecord[%[2]q] = %[3]s\n}\n}\n", name, field.Name, fieldValue(field, "*input."+name+".Value"))
+		default:
+			fmt.Fprintf(buffer, "if input.%s != nil {\nrecord[%q] = %s\n}\n", name, field.Name, fieldValue(field, "*input."+name))
+		}
 	}
+	writeNestedRecordValues(buffer, nested)
 	fmt.Fprintf(buffer, "return record\n}\n\n")
+	writeValidateMethods(buffer, model)
 
-	writeWhereTypes(buffer, model)
-	writeIncludeType(buffer, model)
+	writeWhereTypes(buffer, schema, model)
+	writeIncludeType(buffer, schema, model)
+	writeNestedInputTypes(buffer, schema, model)
 
 	fmt.Fprintf(buffer, "func recordTo%s(record zenithdb.Record) %s {\nresult := %s{\n", model.Name, model.Name, model.Name)
 	for _, field := range model.Fields {
-		fmt.Fprintf(buffer, "%s: record[%q].(%s),\n", exportedIdentifier(field.Name), field.Name, goType(field.Kind))
+		fmt.Fprintf(buffer, "%s: %s,\n", exportedIdentifier(field.Name), recordField(field, "record"))
 	}
 	fmt.Fprintf(buffer, "}\n")
 	for _, relation := range model.Relations {
@@ -160,21 +390,39 @@ func writeModelTypes(buffer *bytes.Buffer, schema zenithdb.Schema, model zenithd
 			fmt.Fprintf(buffer, "if raw, ok := record[%q].(zenithdb.Record); ok {\nconverted := recordTo%s(raw)\nresult.%s = &converted\n}\n", relation.Name, relation.Model, exportedIdentifier(relation.Name))
 		}
 	}
+	if counted := countedRelations(model); len(counted) > 0 {
+		fmt.Fprintf(buffer, "if raw, ok := record[zenithdb.CountField].(zenithdb.Record); ok {\nresult.RelationCount = &%sRelationCount{\n", model.Name)
+		for _, relation := range counted {
+			fmt.Fprintf(buffer, "%s: recordValue[int64](raw, %q),\n", exportedIdentifier(relation.Name), relation.Name)
+		}
+		fmt.Fprintf(buffer, "}\n}\n")
+	}
 	fmt.Fprintf(buffer, "return result\n}\n\n")
 }
 
-func writeModelClient(buffer *bytes.Buffer, model zenithdb.Model) {
+func writeModelClient(buffer *bytes.Buffer, schema zenithdb.Schema, model zenithdb.Model) {
 	fmt.Fprintf(buffer, "type %sClient struct {\nclient *Client\n}\n\n", model.Name)
 	fmt.Fprintf(buffer, "func (c %sClient) Create(ctx context.Context, input %sCreateInput) (%s, error) {\n", model.Name, model.Name, model.Name)
-	fmt.Fprintf(buffer, "_, err := c.client.db.Create(ctx, %q, input.record())\nif err != nil {\nreturn %s{}, err\n}\nrecord := recordTo%s(input.record())\nc.client.%s.put(record)\nreturn record, nil\n}\n\n", model.Name, model.Name, model.Name, lowerIdentifier(model.Name))
-	fmt.Fprintf(buffer, "func (c %sClient) CreateMany(ctx context.Context, inputs []%sCreateInput) ([]%s, error) {\nrecords := make([]zenithdb.Record, 0, len(inputs))\nfor _, input := range inputs {\nrecords = append(records, input.record())\n}\n_, err := c.client.db.CreateMany(ctx, %q, records)\nif err != nil {\nreturn nil, err\n}\nresult := make([]%s, 0, len(inputs))\nfor _, input := range inputs {\nrecord := recordTo%s(input.record())\nif !c.client.remote {\nc.client.%s.put(record)\n}\nresult = append(result, record)\n}\nreturn result, nil\n}\n\n", model.Name, model.Name, model.Name, model.Name, model.Name, model.Name, lowerIdentifier(model.Name))
-	writePrismaLikeMethods(buffer, model)
+	fmt.Fprintf(buffer, "created, err := c.client.db.Create(ctx, %q, input.record())\nif err != nil {\nreturn %s{}, err\n}\nrecord := recordTo%s(created.Record)\n", model.Name, model.Name, model.Name)
+	nested := nestedRelations(schema, model)
+	if len(nested) > 0 {
+		fmt.Fprintf(buffer, "if input.nested() {\nstored, _, err := c.client.db.FindUnique(ctx, %q, %s, nil, nil)\nif err != nil {\nreturn %s{}, err\n}\nreturn recordTo%s(stored), nil\n}\n", model.Name, primaryWhereLiteral(model, "record"), model.Name, model.Name)
+	}
+	fmt.Fprintf(buffer, "return record, nil\n}\n\n")
+	fmt.Fprintf(buffer, "func (c %sClient) CreateMany(ctx context.Context, inputs []%sCreateInput) ([]%s, error) {\nrecords := make([]zenithdb.Record, 0, len(inputs))\nfor _, input := range inputs {\nrecords = append(records, input.record())\n}\ncreated, err := c.client.db.CreateMany(ctx, %q, records)\nif err != nil {\nreturn nil, err\n}\nresult := make([]%s, 0, len(inputs))\n", model.Name, model.Name, model.Name, model.Name, model.Name)
+	if len(nested) > 0 {
+		fmt.Fprintf(buffer, "for i, input := range inputs {\nrecord := recordTo%s(created[i].Record)\nif input.nested() {\nstored, _, err := c.client.db.FindUnique(ctx, %q, %s, nil, nil)\nif err != nil {\nreturn nil, err\n}\nrecord = recordTo%s(stored)\n}\nresult = append(result, record)\n}\nreturn result, nil\n}\n\n", model.Name, model.Name, primaryWhereLiteral(model, "record"), model.Name)
+	} else {
+		fmt.Fprintf(buffer, "for _, mutation := range created {\nresult = append(result, recordTo%s(mutation.Record))\n}\nreturn result, nil\n}\n\n", model.Name)
+	}
+	writePrismaLikeMethods(buffer, schema, model)
 
-	written := make(map[string]struct{})
-	writeUniqueMethods(buffer, model, model.PrimaryKey, written)
-	for _, index := range model.Indexes {
-		if index.Unique {
-			writeUniqueMethods(buffer, model, index.Fields, written)
+	if key, ok := primaryKey(model); ok {
+		writeUniqueMethod(buffer, model, key)
+	}
+	for _, index := range storeIndexes(model) {
+		if index.unique {
+			writeUniqueMethod(buffer, model, index.key)
 		} else {
 			writeFindManyMethod(buffer, model, index)
 		}
@@ -182,94 +430,85 @@ func writeModelClient(buffer *bytes.Buffer, model zenithdb.Model) {
 }
 
 func writeModelStore(buffer *bytes.Buffer, model zenithdb.Model) {
-	pk, ok := primaryField(model)
+	pk, ok := primaryKey(model)
 	if !ok {
 		return
 	}
 	store := lowerIdentifier(model.Name) + "Store"
-	fmt.Fprintf(buffer, "type %s struct {\nby%s map[%s]%s\n", store, exportedIdentifier(pk.Name), goType(pk.Kind), model.Name)
-	for _, index := range model.Indexes {
-		if len(index.Fields) != 1 {
-			continue
-		}
-		field, ok := findField(model, index.Fields[0])
-		if !ok {
-			continue
-		}
-		if index.Unique {
-			fmt.Fprintf(buffer, "by%s map[%s]%s\n", exportedIdentifier(field.Name), goType(field.Kind), goType(pk.Kind))
+	indexes := storeIndexes(model)
+	fmt.Fprintf(buffer, "type %s struct {\nby%s map[%s]%s\n", store, pk.name(), pk.goType(), model.Name)
+	for _, index := range indexes {
+		if index.unique {
+			fmt.Fprintf(buffer, "by%s map[%s]%s\n", index.key.name(), index.key.goType(), pk.goType())
 		} else {
-			fmt.Fprintf(buffer, "by%s map[%s][]%s\n", exportedIdentifier(field.Name), goType(field.Kind), goType(pk.Kind))
+			fmt.Fprintf(buffer, "by%s map[%s][]%s\n", index.key.name(), index.key.goType(), pk.goType())
 		}
 	}
 	fmt.Fprintf(buffer, "}\n\n")
 
-	fmt.Fprintf(buffer, "func new%sStore() *%s {\nreturn &%s{\nby%s: make(map[%s]%s),\n", model.Name, store, store, exportedIdentifier(pk.Name), goType(pk.Kind), model.Name)
-	for _, index := range model.Indexes {
-		if len(index.Fields) != 1 {
-			continue
-		}
-		field, ok := findField(model, index.Fields[0])
-		if !ok {
-			continue
-		}
-		if index.Unique {
-			fmt.Fprintf(buffer, "by%s: make(map[%s]%s),\n", exportedIdentifier(field.Name), goType(field.Kind), goType(pk.Kind))
+	fmt.Fprintf(buffer, "func new%sStore() *%s {\nreturn &%s{\nby%s: make(map[%s]%s),\n", model.Name, store, store, pk.name(), pk.goType(), model.Name)
+	for _, index := range indexes {
+		if index.unique {
+			fmt.Fprintf(buffer, "by%s: make(map[%s]%s),\n", index.key.name(), index.key.goType(), pk.goType())
 		} else {
-			fmt.Fprintf(buffer, "by%s: make(map[%s][]%s),\n", exportedIdentifier(field.Name), goType(field.Kind), goType(pk.Kind))
+			fmt.Fprintf(buffer, "by%s: make(map[%s][]%s),\n", index.key.name(), index.key.goType(), pk.goType())
 		}
 	}
 	fmt.Fprintf(buffer, "}\n}\n\n")
 
-	fmt.Fprintf(buffer, "func (s *%s) put(record %s) {\ns.by%s[record.%s] = record\n", store, model.Name, exportedIdentifier(pk.Name), exportedIdentifier(pk.Name))
-	for _, index := range model.Indexes {
-		if len(index.Fields) != 1 {
-			continue
-		}
-		field, ok := findField(model, index.Fields[0])
-		if !ok {
-			continue
+	fmt.Fprintf(buffer, "func (s *%s) put(record %s) {\ns.by%s[%s] = record\n", store, model.Name, pk.name(), pk.value("record", nil))
+	for _, index := range indexes {
+		// A record whose key holds null is left out of the index map.
+		guard := present("record", index.key.fields)
+		if guard != "" {
+			fmt.Fprintf(buffer, "if %s {\n", guard)
 		}
-		if index.Unique {
-			fmt.Fprintf(buffer, "s.by%s[record.%s] = record.%s\n", exportedIdentifier(field.Name), exportedIdentifier(field.Name), exportedIdentifier(pk.Name))
+		if index.unique {
+			fmt.Fprintf(buffer, "s.by%s[%s] = %s\n", index.key.name(), index.key.value("record", nil), pk.value("record", nil))
 		} else {
-			fmt.Fprintf(buffer, "s.by%s[record.%s] = append(s.by%s[record.%s], record.%s)\n", exportedIdentifier(field.Name), exportedIdentifier(field.Name), exportedIdentifier(field.Name), exportedIdentifier(field.Name), exportedIdentifier(pk.Name))
+			fmt.Fprintf(buffer, "s.by%[1]s[%[2]s] = append(s.by%[1]s[%[2]s], %[3]s)\n", index.key.name(), index.key.value("record", nil), pk.value("record", nil))
+		}
+		if guard != "" {
+			fmt.Fprintf(buffer, "}\n")
 		}
 	}
 	fmt.Fprintf(buffer, "}\n\n")
 
-	fmt.Fprintf(buffer, "func (s *%s) remove(record %s) {\ndelete(s.by%s, record.%s)\n", store, model.Name, exportedIdentifier(pk.Name), exportedIdentifier(pk.Name))
-	for _, index := range model.Indexes {
-		if len(index.Fields) != 1 {
-			continue
-		}
-		field, ok := findField(model, index.Fields[0])
-		if !ok {
-			continue
+	fmt.Fprintf(buffer, "func (s *%s) remove(record %s) {\ndelete(s.by%s, %s)\n", store, model.Name, pk.name(), pk.value("record", nil))
+	// A composite literal needs parentheses to be compared in an if.
+	id := pk.value("record", nil)
+	if pk.compound() {
+		id = "(" + id + ")"
+	}
+	declare := ":="
+	for _, index := range indexes {
+		guard := present("record", index.key.fields)
+		if guard != "" {
+			fmt.Fprintf(buffer, "if %s {\n", guard)
 		}
-		if index.Unique {
-			fmt.Fprintf(buffer, "delete(s.by%s, record.%s)\n", exportedIdentifier(field.Name), exportedIdentifier(field.Name))
+		if index.unique {
+			fmt.Fprintf(buffer, "delete(s.by%s, %s)\n", index.key.name(), index.key.value("record", nil))
+		} else if guard != "" {
+			// Inside the guard, ids is declared anew.
+			fmt.Fprintf(buffer, "ids := s.by%[1]s[%[2]s]\nfor i, id := range ids {\nif id == %[3]s {\nids = append(ids[:i], ids[i+1:]...)\nbreak\n}\n}\nif len(ids) == 0 {\ndelete(s.by%[1]s, %[2]s)\n} else {\ns.by%[1]s[%[2]s] = ids\n}\n", index.key.name(), index.key.value("record", nil), id)
 		} else {
-			fmt.Fprintf(buffer, "ids := s.by%s[record.%s]\nfor i, id := range ids {\nif id == record.%s {\nids = append(ids[:i], ids[i+1:]...)\nbreak\n}\n}\nif len(ids) == 0 {\ndelete(s.by%s, record.%s)\n} else {\ns.by%s[record.%s] = ids\n}\n", exportedIdentifier(field.Name), exportedIdentifier(field.Name), exportedIdentifier(pk.Name), exportedIdentifier(field.Name), exportedIdentifier(field.Name), exportedIdentifier(field.Name), exportedIdentifier(field.Name))
+			fmt.Fprintf(buffer, "ids %[1]s s.by%[2]s[%[3]s]\nfor i, id := range ids {\nif id == %[4]s {\nids = append(ids[:i], ids[i+1:]...)\nbreak\n}\n}\nif len(ids) == 0 {\ndelete(s.by%[2]s, %[3]s)\n} else {\ns.by%[2]s[%[3]s] = ids\n}\n", declare, index.key.name(), index.key.value("record", nil), id)
+			declare = "="
+		}
+		if guard != "" {
+			fmt.Fprintf(buffer, "}\n")
 		}
 	}
 	fmt.Fprintf(buffer, "}\n\n")
 
 	fmt.Fprintf(buffer, "func (s *%s) replace(previous %s, next %s) {\ns.remove(previous)\ns.put(next)\n}\n\n", store, model.Name, model.Name)
 
-	writeStoreFindByField(buffer, model, pk, true)
-	for _, index := range model.Indexes {
-		if len(index.Fields) != 1 {
-			continue
-		}
-		field, ok := findField(model, index.Fields[0])
-		if !ok {
-			continue
-		}
-		if index.Unique {
-			writeStoreFindByField(buffer, model, field, true)
+	fmt.Fprintf(buffer, "func (s *%s) findBy%s(value %s) (%s, bool) {\nrecord, ok := s.by%s[value]\nreturn record, ok\n}\n\n", store, pk.name(), pk.goType(), model.Name, pk.name())
+	for _, index := range indexes {
+		if index.unique {
+			fmt.Fprintf(buffer, "func (s *%s) findBy%s(value %s) (%s, bool) {\nprimaryKey, ok := s.by%s[value]\nif !ok {\nreturn %s{}, false\n}\nreturn s.findBy%s(primaryKey)\n}\n\n", store, index.key.name(), index.key.goType(), model.Name, index.key.name(), model.Name, pk.name())
 		} else {
-			writeStoreFindManyByField(buffer, model, field)
+			fmt.Fprintf(buffer, "func (s *%s) findManyBy%s(value %s, limit int) []%s {\nids := s.by%s[value]\nif limit > 0 && len(ids) > limit {\nids = ids[:limit]\n}\nresult := make([]%s, 0, len(ids))\nfor _, id := range ids {\nif record, ok := s.findBy%s(id); ok {\nresult = append(result, record)\n}\n}\nreturn result\n}\n\n", store, index.key.name(), index.key.goType(), model.Name, index.key.name(), model.Name, pk.name())
 		}
 	}
 }
@@ -277,112 +516,361 @@ func writeModelStore(buffer *bytes.Buffer, model zenithdb.Model) {
 func writeIncludeExpander(buffer *bytes.Buffer, schema zenithdb.Schema, model zenithdb.Model) {
 	fmt.Fprintf(buffer, "func (c *Client) include%s(record *%s, include *%sInclude) {\nif include == nil {\nreturn\n}\n", model.Name, model.Name, model.Name)
 	for _, relation := range model.Relations {
-		if len(relation.Fields) != 1 || len(relation.References) != 1 {
-			continue
+		if code, ok := storeInclude(schema, model, relation); ok {
+			fmt.Fprint(buffer, code)
 		}
-		localField, ok := findField(model, relation.Fields[0])
-		if !ok {
-			continue
-		}
-		target, ok := findModel(schema, relation.Model)
-		if !ok {
-			continue
-		}
-		referenceField, ok := findField(target, relation.References[0])
+	}
+	fmt.Fprintf(buffer, "}\n\n")
+}
+
+// storeInclude returns the code that expands relation from the stores, and
+// false when they cannot: no store key of the related model is over the
+// relation's references.
+func storeInclude(schema zenithdb.Schema, model zenithdb.Model, relation zenithdb.Relation) (string, bool) {
+	if relation.Through != "" {
+		return throughInclude(schema, model, relation)
+	}
+	target, ok := findModel(schema, relation.Model)
+	if !ok || len(relation.Fields) != len(relation.References) {
+		return "", false
+	}
+	fields := make([]zenithdb.Field, 0, len(relation.Fields))
+	for _, name := range relation.Fields {
+		field, ok := findField(model, name)
 		if !ok {
-			continue
+			return "", false
 		}
-		if relation.Many {
-			if !hasNonUniqueSingleFieldIndex(target, referenceField.Name) {
-				continue
+		fields = append(fields, field)
+	}
+	name := exportedIdentifier(relation.Name)
+	// A relation whose foreign key holds null relates no record.
+	condition := "include." + name
+	if guard := present("record", fields); guard != "" {
+		condition += " && " + guard
+	}
+	if relation.Many {
+		for _, index := range storeIndexes(target) {
+			if !index.unique && index.key.matches(relation.References) {
+				return fmt.Sprintf("if %s {\nrecord.%s = c.%s.findManyBy%s(%s, 0)\n}\n", condition, name, storeField(target.Name), index.key.name(), index.key.value("record", fields)), true
 			}
-			fmt.Fprintf(buffer, "if include.%s {\nrecord.%s = c.%s.findManyBy%s(record.%s, 0)\n}\n", exportedIdentifier(relation.Name), exportedIdentifier(relation.Name), lowerIdentifier(target.Name), exportedIdentifier(referenceField.Name), exportedIdentifier(localField.Name))
-			continue
 		}
-		if !isUniqueLookupField(target, referenceField.Name) {
-			continue
+		return "", false
+	}
+	for _, key := range uniqueLookupKeys(target) {
+		if key.matches(relation.References) {
+			return fmt.Sprintf("if %s {\nrelated, ok := c.%s.findBy%s(%s)\nif ok {\nrecord.%s = &related\n}\n}\n", condition, storeField(target.Name), key.name(), key.value("record", fields), name), true
 		}
-		fmt.Fprintf(buffer, "if include.%s {\nrelated, ok := c.%s.findBy%s(record.%s)\nif ok {\nrecord.%s = &related\n}\n}\n", exportedIdentifier(relation.Name), lowerIdentifier(target.Name), exportedIdentifier(referenceField.Name), exportedIdentifier(localField.Name), exportedIdentifier(relation.Name))
 	}
-	fmt.Fprintf(buffer, "}\n\n")
+	return "", false
 }
 
-func writeStoreFindByField(buffer *bytes.Buffer, model zenithdb.Model, field zenithdb.Field, unique bool) {
-	pk, ok := primaryField(model)
-	if !ok {
-		return
+// throughInclude expands a many-to-many relation from the stores: the links
+// of a hidden join model, or the store of an explicit one indexed by the
+// field that holds the record's key.
+func throughInclude(schema zenithdb.Schema, model zenithdb.Model, relation zenithdb.Relation) (string, bool) {
+	if len(relation.Fields) != 1 || len(relation.References) != 1 {
+		return "", false
 	}
-	store := lowerIdentifier(model.Name) + "Store"
-	method := "findBy" + exportedIdentifier(field.Name)
-	if field.Name == pk.Name {
-		fmt.Fprintf(buffer, "func (s *%s) %s(value %s) (%s, bool) {\nrecord, ok := s.by%s[value]\nreturn record, ok\n}\n\n", store, method, goType(field.Kind), model.Name, exportedIdentifier(pk.Name))
-		return
+	localField, ok := findField(model, relation.Fields[0])
+	if !ok || nullable(localField) {
+		return "", false
+	}
+	target, ok := findModel(schema, relation.Model)
+	if !ok || !isUniqueLookupField(target, relation.References[0]) {
+		return "", false
 	}
-	fmt.Fprintf(buffer, "func (s *%s) %s(value %s) (%s, bool) {\nprimaryKey, ok := s.by%s[value]\nif !ok {\nreturn %s{}, false\n}\nreturn s.findBy%s(primaryKey)\n}\n\n", store, method, goType(field.Kind), model.Name, exportedIdentifier(field.Name), model.Name, exportedIdentifier(pk.Name))
+	join, ok := findModel(schema, relation.Through)
+	if !ok || len(relation.ThroughFields) != 1 || len(relation.ThroughReferences) != 1 {
+		return "", false
+	}
+	name := exportedIdentifier(relation.Name)
+	lookup := fmt.Sprintf("c.%s.findBy%s", storeField(target.Name), exportedIdentifier(relation.References[0]))
+	if hiddenModel(join) {
+		return fmt.Sprintf("if include.%s {\nkeys := c.%s.by%s[record.%s]\nrecord.%s = make([]%s, 0, len(keys))\nfor _, key := range keys {\nif related, ok := %s(key); ok {\nrecord.%s = append(record.%s, related)\n}\n}\n}\n", name, linksField(join.Name), exportedIdentifier(relation.ThroughFields[0]), exportedIdentifier(localField.Name), name, target.Name, lookup, name, name), true
+	}
+	if _, ok := primaryKey(join); !ok || !hasNonUniqueSingleFieldIndex(join, relation.ThroughFields[0]) {
+		return "", false
+	}
+	return fmt.Sprintf("if include.%s {\nlinks := c.%s.findManyBy%s(record.%s, 0)\nrecord.%s = make([]%s, 0, len(links))\nfor _, link := range links {\nif related, ok := %s(link.%s); ok {\nrecord.%s = append(record.%s, related)\n}\n}\n}\n", name, storeField(join.Name), exportedIdentifier(relation.ThroughFields[0]), exportedIdentifier(localField.Name), name, target.Name, lookup, exportedIdentifier(relation.ThroughReferences[0]), name, name), true
 }
 
-func writeStoreFindManyByField(buffer *bytes.Buffer, model zenithdb.Model, field zenithdb.Field) {
-	pk, ok := primaryField(model)
-	if !ok {
+// writeJoinLinks emits the in-memory links of a hidden join model, which has
+// no client of its own: for each of its two fields, the values of the other
+// field joined to each of its values.
+func writeJoinLinks(buffer *bytes.Buffer, model zenithdb.Model) {
+	if len(model.Fields) != 2 {
 		return
 	}
-	store := lowerIdentifier(model.Name) + "Store"
-	fmt.Fprintf(buffer, "func (s *%s) findManyBy%s(value %s, limit int) []%s {\nids := s.by%s[value]\nif limit > 0 && len(ids) > limit {\nids = ids[:limit]\n}\nresult := make([]%s, 0, len(ids))\nfor _, id := range ids {\nif record, ok := s.findBy%s(id); ok {\nresult = append(result, record)\n}\n}\nreturn result\n}\n\n", store, exportedIdentifier(field.Name), goType(field.Kind), model.Name, exportedIdentifier(field.Name), model.Name, exportedIdentifier(pk.Name))
+	links := linksField(model.Name)
+	first, second := model.Fields[0], model.Fields[1]
+	fmt.Fprintf(buffer, "type %s struct {\nby%s map[%s][]%s\nby%s map[%s][]%s\n}\n\n", links, exportedIdentifier(first.Name), fieldType(first), fieldType(second), exportedIdentifier(second.Name), fieldType(second), fieldType(first))
+	fmt.Fprintf(buffer, "func new%s() *%s {\nreturn &%s{\nby%s: make(map[%s][]%s),\nby%s: make(map[%s][]%s),\n}\n}\n\n", exportedIdentifier(links), links, links, exportedIdentifier(first.Name), fieldType(first), fieldType(second), exportedIdentifier(second.Name), fieldType(second), fieldType(first))
+	fmt.Fprintf(buffer, "func (l *%s) put(record zenithdb.Record) {\nfirst, second := %s, %s\nl.by%s[first] = append(l.by%s[first], second)\nl.by%s[second] = append(l.by%s[second], first)\n}\n\n", links, recordField(first, "record"), recordField(second, "record"), exportedIdentifier(first.Name), exportedIdentifier(first.Name), exportedIdentifier(second.Name), exportedIdentifier(second.Name))
+	fmt.Fprintf(buffer, "func (l *%s) remove(record zenithdb.Record) {\nfirst, second := %s, %s\nunlink(l.by%s, first, second)\nunlink(l.by%s, second, first)\n}\n\n", links, recordField(first, "record"), recordField(second, "record"), exportedIdentifier(first.Name), exportedIdentifier(second.Name))
 }
 
-func writeWhereTypes(buffer *bytes.Buffer, model zenithdb.Model) {
+func writeWhereTypes(buffer *bytes.Buffer, schema zenithdb.Schema, model zenithdb.Model) {
 	fmt.Fprintf(buffer, "type %sWhereUniqueInput struct {\n", model.Name)
-	uniqueFields := uniqueLookupFields(model)
-	for _, field := range uniqueFields {
-		fmt.Fprintf(buffer, "%s %s\n", exportedIdentifier(field.Name), goType(field.Kind))
+	uniqueKeys := uniqueLookupKeys(model)
+	for _, key := range uniqueKeys {
+		fmt.Fprintf(buffer, "%s %s\n", key.name(), key.goType())
 	}
 	fmt.Fprintf(buffer, "}\n\n")
 
 	fmt.Fprintf(buffer, "func (input %sWhereUniqueInput) where() map[string]any {\n", model.Name)
-	for _, field := range uniqueFields {
-		fmt.Fprintf(buffer, "if input.%s != %s {\nreturn map[string]any{%q: input.%s}\n}\n", exportedIdentifier(field.Name), zeroValue(field.Kind), field.Name, exportedIdentifier(field.Name))
+	for _, key := range uniqueKeys {
+		fmt.Fprintf(buffer, "if input.%s != %s {\nreturn %s\n}\n", key.name(), key.zero(), key.where("input."+key.name()))
 	}
 	fmt.Fprintf(buffer, "return nil\n}\n\n")
 
 	fmt.Fprintf(buffer, "type %sWhereInput struct {\n", model.Name)
 	for _, field := range model.Fields {
-		fmt.Fprintf(buffer, "%s *%s\n", exportedIdentifier(field.Name), goType(field.Kind))
+		fmt.Fprintf(buffer, "%s *%s\n", exportedIdentifier(field.Name), fieldType(field))
 	}
-	fmt.Fprintf(buffer, "}\n\n")
+	for _, relation := range model.Relations {
+		fmt.Fprintf(buffer, "%s *%s\n", exportedIdentifier(relation.Name), relationFilterType(relation))
+	}
+	fmt.Fprintf(buffer, "AND []%[1]sWhereInput\nOR []%[1]sWhereInput\nNOT *%[1]sWhereInput\n}\n\n", model.Name)
 
 	fmt.Fprintf(buffer, "func (input %sWhereInput) where() map[string]any {\nwhere := make(map[string]any)\n", model.Name)
 	for _, field := range model.Fields {
-		fmt.Fprintf(buffer, "if input.%s != nil {\nwhere[%q] = *input.%s\n}\n", exportedIdentifier(field.Name), field.Name, exportedIdentifier(field.Name))
+		fmt.Fprintf(buffer, "if input.%s != nil {\nwhere[%q] = %s\n}\n", exportedIdentifier(field.Name), field.Name, fieldValue(field, "*input."+exportedIdentifier(field.Name)))
 	}
 	fmt.Fprintf(buffer, "return where\n}\n\n")
 
+	empty := "len(input.AND) == 0 && len(input.OR) == 0 && input.NOT == nil"
+	for _, relation := range model.Relations {
+		empty += fmt.Sprintf(" && input.%s == nil", exportedIdentifier(relation.Name))
+	}
+	fmt.Fprintf(buffer, "func (input %sWhereInput) filterExpr() *zenithdb.FilterExpr {\nif %s {\nreturn nil\n}\nexpr := &zenithdb.FilterExpr{}\n", model.Name, empty)
+	for _, relation := range model.Relations {
+		fmt.Fprintf(buffer, "if input.%s != nil {\nexpr.And = append(expr.And, zenithdb.FilterExpr{Relation: %q, RelationFilter: input.%s.filter()})\n}\n", exportedIdentifier(relation.Name), relation.Name, exportedIdentifier(relation.Name))
+	}
+	fmt.Fprintf(buffer, "for _, child := range input.AND {\nexpr.And = append(expr.And, child.expr())\n}\nfor _, child := range input.OR {\nexpr.Or = append(expr.Or, child.expr())\n}\nif input.NOT != nil {\nnot := input.NOT.expr()\nexpr.Not = &not\n}\nreturn expr\n}\n\n")
+	fmt.Fprintf(buffer, "func (input %sWhereInput) expr() zenithdb.FilterExpr {\nexpr := zenithdb.FilterExpr{}\n", model.Name)
+	for _, field := range model.Fields {
+		fmt.Fprintf(buffer, "if input.%s != nil {\nexpr.And = append(expr.And, zenithdb.FilterExpr{Field: %q, Filter: zenithdb.Filter{Equals: %s}})\n}\n", exportedIdentifier(field.Name), field.Name, fieldValue(field, "*input."+exportedIdentifier(field.Name)))
+	}
+	fmt.Fprintf(buffer, "if nested := input.filterExpr(); nested != nil {\nexpr.And = append(expr.And, *nested)\n}\nreturn expr\n}\n\n")
+	writeRelationFilterTypes(buffer, schema, model)
+
 	fmt.Fprintf(buffer, "func (input %sWhereInput) index() string {\n", model.Name)
-	for _, index := range model.Indexes {
-		if len(index.Fields) == 1 {
-			field, ok := findField(model, index.Fields[0])
-			if ok {
-				fmt.Fprintf(buffer, "if input.%s != nil {\nreturn %q\n}\n", exportedIdentifier(field.Name), index.Name)
-			}
+	// Compound indexes come first, so the one covering the most set fields wins.
+	indexes := slices.Clone(model.Indexes)
+	slices.SortStableFunc(indexes, func(a, b zenithdb.Index) int {
+		return len(b.Fields) - len(a.Fields)
+	})
+	for _, index := range indexes {
+		if key, ok := newLookupKey(model, index.Fields); ok {
+			set, _ := key.pointers("input")
+			fmt.Fprintf(buffer, "if %s {\nreturn %q\n}\n", set, index.Name)
 		}
 	}
 	fmt.Fprintf(buffer, "return \"\"\n}\n\n")
 }
 
-func writeIncludeType(buffer *bytes.Buffer, model zenithdb.Model) {
+// writeRelationFilterTypes emits the filters other models' WhereInput use to
+// filter through a relation to model: Some, Every, and None for Many
+// relations and Is and IsNot for to-one relations.
+func writeRelationFilterTypes(buffer *bytes.Buffer, schema zenithdb.Schema, model zenithdb.Model) {
+	var many, single bool
+	for _, source := range schema.Models {
+		if hiddenModel(source) {
+			continue
+		}
+		for _, relation := range source.Relations {
+			if relation.Model == model.Name {
+				many = many || relation.Many
+				single = single || !relation.Many
+			}
+		}
+	}
+	if !many && !single {
+		return
+	}
+	fmt.Fprintf(buffer, "func (input *%sWhereInput) relationExpr() *zenithdb.FilterExpr {\nif input == nil {\nreturn nil\n}\nexpr := input.expr()\nreturn &expr\n}\n\n", model.Name)
+	if many {
+		fmt.Fprintf(buffer, "type %[1]sListRelationFilter struct {\nSome *%[1]sWhereInput\nEvery *%[1]sWhereInput\nNone *%[1]sWhereInput\n}\n\n", model.Name)
+		fmt.Fprintf(buffer, "func (input %sListRelationFilter) filter() zenithdb.RelationFilter {\nreturn zenithdb.RelationFilter{Some: input.Some.relationExpr(), Every: input.Every.relationExpr(), None: input.None.relationExpr()}\n}\n\n", model.Name)
+	}
+	if single {
+		fmt.Fprintf(buffer, "type %[1]sRelationFilter struct {\nIs *%[1]sWhereInput\nIsNot *%[1]sWhereInput\n}\n\n", model.Name)
+		fmt.Fprintf(buffer, "func (input %sRelationFilter) filter() zenithdb.RelationFilter {\nreturn zenithdb.RelationFilter{Is: input.Is.relationExpr(), IsNot: input.IsNot.relationExpr()}\n}\n\n", model.Name)
+	}
+}
+
+// writeNestedInputTypes emits the inputs other models' CreateInput and
+// UpdateInput use to write model's records through a relation: lists for Many
+// relations and single records for to-one relations.
+func writeNestedInputTypes(buffer *bytes.Buffer, schema zenithdb.Schema, model zenithdb.Model) {
+	var many, single bool
+	for _, source := range schema.Models {
+		if hiddenModel(source) {
+			continue
+		}
+		for _, relation := range nestedRelations(schema, source) {
+			if relation.Model == model.Name {
+				many = many || relation.Many
+				single = single || !relation.Many
+			}
+		}
+	}
+	if !many && !single {
+		return
+	}
+	fmt.Fprintf(buffer, "type %[1]sCreateOrConnectInput struct {\nWhere %[1]sWhereUniqueInput\nCreate %[1]sCreateInput\n}\n\n", model.Name)
+	fmt.Fprintf(buffer, "func (input %sCreateOrConnectInput) write() zenithdb.ConnectOrCreate {\nreturn zenithdb.ConnectOrCreate{Where: input.Where.where(), Create: input.Create.record()}\n}\n\n", model.Name)
+	if many {
+		fmt.Fprintf(buffer, "type %[1]sUpdateWithWhereUniqueInput struct {\nWhere %[1]sWhereUniqueInput\nData %[1]sUpdateInput\n}\n\n", model.Name)
+		fmt.Fprintf(buffer, "type %[1]sCreateNestedManyInput struct {\nCreate []%[1]sCreateInput\nConnect []%[1]sWhereUniqueInput\nConnectOrCreate []%[1]sCreateOrConnectInput\n}\n\n", model.Name)
+		fmt.Fprintf(buffer, "func (input *%sCreateNestedManyInput) write() zenithdb.NestedWrite {\nvar write zenithdb.NestedWrite\n", model.Name)
+		fmt.Fprintf(buffer, "for _, create := range input.Create {\nwrite.Create = append(write.Create, create.record())\n}\nfor _, where := range input.Connect {\nwrite.Connect = append(write.Connect, where.where())\n}\nfor _, connectOrCreate := range input.ConnectOrCreate {\nwrite.ConnectOrCreate = append(write.ConnectOrCreate, connectOrCreate.write())\n}\nreturn write\n}\n\n")
+		fmt.Fprintf(buffer, "// %[1]sUpdateNestedManyInput writes the %[1]s records a relation connects to.\n// A non-nil Set, even an empty one, connects exactly the records it lists.\ntype %[1]sUpdateNestedManyInput struct {\nCreate []%[1]sCreateInput\nConnect []%[1]sWhereUniqueInput\nConnectOrCreate []%[1]sCreateOrConnectInput\nDisconnect []%[1]sWhereUniqueInput\nSet []%[1]sWhereUniqueInput\nUpdate []%[1]sUpdateWithWhereUniqueInput\nDelete []%[1]sWhereUniqueInput\n}\n\n", model.Name)
+		fmt.Fprintf(buffer, "func (input *%sUpdateNestedManyInput) write() zenithdb.NestedWrite {\nwrite := (&%sCreateNestedManyInput{Create: input.Create, Connect: input.Connect, ConnectOrCreate: input.ConnectOrCreate}).write()\n", model.Name, model.Name)
+		fmt.Fprintf(buffer, "for _, where := range input.Disconnect {\nwrite.Disconnect = append(write.Disconnect, where.where())\n}\nif input.Set != nil {\nwrite.Set = make([]map[string]any, 0, len(input.Set))\n}\nfor _, where := range input.Set {\nwrite.Set = append(write.Set, where.where())\n}\nfor _, update := range input.Update {\nwrite.Update = append(write.Update, zenithdb.NestedUpdate{Where: update.Where.where(), Data: update.Data.record()})\n}\nfor _, where := range input.Delete {\nwrite.Delete = append(write.Delete, where.where())\n}\nreturn write\n}\n\n")
+	}
+	if single {
+		fmt.Fprintf(buffer, "type %[1]sCreateNestedOneInput struct {\nCreate *%[1]sCreateInput\nConnect *%[1]sWhereUniqueInput\nConnectOrCreate *%[1]sCreateOrConnectInput\n}\n\n", model.Name)
+		fmt.Fprintf(buffer, "func (input *%sCreateNestedOneInput) write() zenithdb.NestedWrite {\nvar write zenithdb.NestedWrite\n", model.Name)
+		fmt.Fprintf(buffer, "if input.Create != nil {\nwrite.Create = []zenithdb.Record{input.Create.record()}\n}\nif input.Connect != nil {\nwrite.Connect = []map[string]any{input.Connect.where()}\n}\nif input.ConnectOrCreate != nil {\nwrite.ConnectOrCreate = []zenithdb.ConnectOrCreate{input.ConnectOrCreate.write()}\n}\nreturn write\n}\n\n")
+		fmt.Fprintf(buffer, "type %[1]sUpdateNestedOneInput struct {\nCreate *%[1]sCreateInput\nConnect *%[1]sWhereUniqueInput\nConnectOrCreate *%[1]sCreateOrConnectInput\nDisconnect bool\nUpdate *%[1]sUpdateInput\nDelete bool\n}\n\n", model.Name)
+		fmt.Fprintf(buffer, "func (input *%sUpdateNestedOneInput) write() zenithdb.NestedWrite {\nwrite := (&%sCreateNestedOneInput{Create: input.Create, Connect: input.Connect, ConnectOrCreate: input.ConnectOrCreate}).write()\n", model.Name, model.Name)
+		fmt.Fprintf(buffer, "if input.Disconnect {\nwrite.Disconnect = []map[string]any{nil}\n}\nif input.Update != nil {\nwrite.Update = []zenithdb.NestedUpdate{{Data: input.Update.record()}}\n}\nif input.Delete {\nwrite.Delete = []map[string]any{nil}\n}\nreturn write\n}\n\n")
+	}
+}
+
+// writeNestedRecordValues emits the statements that add the nested writes of
+// an input to its record.
+func writeNestedRecordValues(buffer *bytes.Buffer, relations []zenithdb.Relation) {
+	for _, relation := range relations {
+		fmt.Fprintf(buffer, "if input.%s != nil {\nrecord[%q] = input.%s.write()\n}\n", exportedIdentifier(relation.Name), relation.Name, exportedIdentifier(relation.Name))
+	}
+}
+
+// nestedRelations returns the relations of model that take nested writes: the
+// ones holding a foreign key, the ones mirroring a foreign key the related
+// model holds, and the many-to-many ones.
+func nestedRelations(schema zenithdb.Schema, model zenithdb.Model) []zenithdb.Relation {
+	var relations []zenithdb.Relation
+	for _, relation := range model.Relations {
+		target, ok := findModel(schema, relation.Model)
+		if !ok {
+			continue
+		}
+		mirrored := relation.ForeignKey || relation.Through != ""
+		for _, back := range target.Relations {
+			if back.ForeignKey && back.Model == model.Name && slices.Equal(back.Fields, relation.References) && slices.Equal(back.References, relation.Fields) {
+				mirrored = true
+			}
+		}
+		if mirrored {
+			relations = append(relations, relation)
+		}
+	}
+	return relations
+}
+
+func nestedInputType(relation zenithdb.Relation, write string) string {
+	if relation.Many {
+		return relation.Model + write + "NestedManyInput"
+	}
+	return relation.Model + write + "NestedOneInput"
+}
+
+// primaryWhereLiteral emits the primary key lookup of the record input holds.
+func primaryWhereLiteral(model zenithdb.Model, input string) string {
+	values := make([]string, 0, len(model.PrimaryKey))
+	for _, name := range model.PrimaryKey {
+		field, _ := findField(model, name)
+		values = append(values, fmt.Sprintf("%q: %s", name, fieldValue(field, input+"."+exportedIdentifier(name))))
+	}
+	return "map[string]any{" + strings.Join(values, ", ") + "}"
+}
+
+// narrowedRead returns the code that re-reads a written record through the
+// engine when its include narrows a relation, returning result as the second
+// value.
+func narrowedRead(model zenithdb.Model, record, result string) string {
+	return fmt.Sprintf("if args.Include.narrowed() {\nrecord, ok, err := c.client.db.FindUnique(ctx, %q, %s, args.Include.include(), nil)\nif err != nil || !ok {\nreturn %s{}, false, err\n}\nreturn recordTo%s(record), %s, nil\n}\n", model.Name, primaryWhereLiteral(model, record), model.Name, model.Name, result)
+}
+
+// countedRelations returns the Many relations of model, whose records a read
+// can count under zenithdb.CountField.
+func countedRelations(model zenithdb.Model) []zenithdb.Relation {
+	var counted []zenithdb.Relation
+	for _, relation := range model.Relations {
+		if relation.Many {
+			counted = append(counted, relation)
+		}
+	}
+	return counted
+}
+
+// includeArgsType names the input that narrows an included relation: the
+// FindMany arguments of the related model for a Many relation, and its
+// Select and Include for a to-one relation.
+func includeArgsType(relation zenithdb.Relation) string {
+	if relation.Many {
+		return relation.Model + "FindManyArgs"
+	}
+	return relation.Model + "IncludeArgs"
+}
+
+func relationFilterType(relation zenithdb.Relation) string {
+	if relation.Many {
+		return relation.Model + "ListRelationFilter"
+	}
+	return relation.Model + "RelationFilter"
+}
+
+func writeIncludeType(buffer *bytes.Buffer, schema zenithdb.Schema, model zenithdb.Model) {
 	fmt.Fprintf(buffer, "type %sInclude struct {\n", model.Name)
 	for _, relation := range model.Relations {
 		fmt.Fprintf(buffer, "%s bool\n", exportedIdentifier(relation.Name))
+		fmt.Fprintf(buffer, "%sArgs *%s\n", exportedIdentifier(relation.Name), includeArgsType(relation))
+	}
+	counted := countedRelations(model)
+	if len(counted) > 0 {
+		fmt.Fprintf(buffer, "RelationCount bool\nRelationCountArgs *%sRelationCountSelect\n", model.Name)
 	}
 	fmt.Fprintf(buffer, "}\n\n")
 
 	fmt.Fprintf(buffer, "func (input *%sInclude) include() map[string]zenithdb.Include {\nif input == nil {\nreturn nil\n}\ninclude := make(map[string]zenithdb.Include)\n", model.Name)
 	for _, relation := range model.Relations {
-		fmt.Fprintf(buffer, "if input.%s {\ninclude[%q] = zenithdb.Include{}\n}\n", exportedIdentifier(relation.Name), relation.Name)
+		fmt.Fprintf(buffer, "if input.%s != nil {\ninclude[%q] = zenithdb.Include{Query: input.%s.query()}\n} else if input.%s {\ninclude[%q] = zenithdb.Include{}\n}\n", exportedIdentifier(relation.Name)+"Args", relation.Name, exportedIdentifier(relation.Name)+"Args", exportedIdentifier(relation.Name), relation.Name)
+	}
+	if len(counted) > 0 {
+		fmt.Fprintf(buffer, "if input.RelationCountArgs != nil {\ninclude[zenithdb.CountField] = zenithdb.Include{Query: zenithdb.Query{Select: input.RelationCountArgs.fields()}}\n} else if input.RelationCount {\ninclude[zenithdb.CountField] = zenithdb.Include{}\n}\n")
 	}
 	fmt.Fprintf(buffer, "return include\n}\n\n")
 
-	fmt.Fprintf(buffer, "type %sFindUniqueArgs struct {\nWhere %sWhereUniqueInput\nInclude *%sInclude\n}\n\n", model.Name, model.Name, model.Name)
-	fmt.Fprintf(buffer, "type %sFindManyArgs struct {\nWhere %sWhereInput\nFilters map[string]zenithdb.Filter\nOrderBy []zenithdb.OrderBy\nCursor %sWhereUniqueInput\nInclude *%sInclude\nSkip int\nTake int\n}\n\n", model.Name, model.Name, model.Name, model.Name)
+	// Stores expand only whole relations keyed by a store key and count none,
+	// so any other include is read through the engine.
+	narrowed := make([]string, 0, 2*len(model.Relations)+2)
+	for _, relation := range model.Relations {
+		if _, ok := storeInclude(schema, model, relation); !ok {
+			narrowed = append(narrowed, "input."+exportedIdentifier(relation.Name))
+		}
+		narrowed = append(narrowed, "input."+exportedIdentifier(relation.Name)+"Args != nil")
+	}
+	if len(counted) > 0 {
+		narrowed = append(narrowed, "input.RelationCount", "input.RelationCountArgs != nil")
+	}
+	if len(narrowed) == 0 {
+		narrowed = append(narrowed, "false")
+	}
+	fmt.Fprintf(buffer, "func (input *%sInclude) narrowed() bool {\nif input == nil {\nreturn false\n}\nreturn %s\n}\n\n", model.Name, strings.Join(narrowed, " || "))
+
+	fmt.Fprintf(buffer, "type %sIncludeArgs struct {\nSelect *%sSelect\nInclude *%sInclude\n}\n\n", model.Name, model.Name, model.Name)
+	fmt.Fprintf(buffer, "func (input *%sIncludeArgs) query() zenithdb.Query {\nreturn zenithdb.Query{Include: input.Include.include(), Select: input.Select.fields()}\n}\n\n", model.Name)
+
+	writeSelectType(buffer, model)
+
+	fmt.Fprintf(buffer, "type %sFindUniqueArgs struct {\nWhere %sWhereUniqueInput\nInclude *%sInclude\nSelect *%sSelect\n}\n\n", model.Name, model.Name, model.Name, model.Name)
+	fmt.Fprintf(buffer, "type %sFindManyArgs struct {\nWhere %sWhereInput\nFilters map[string]zenithdb.Filter\nOrderBy []zenithdb.OrderBy\nCursor %sWhereUniqueInput\nInclude *%sInclude\nSelect *%sSelect\nSkip int\nTake int\n}\n\n", model.Name, model.Name, model.Name, model.Name, model.Name)
+	fmt.Fprintf(buffer, "func (args %sFindManyArgs) query() zenithdb.Query {\nreturn zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Include: args.Include.include(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy, Select: args.Select.fields()}\n}\n\n", model.Name)
+	fmt.Fprintf(buffer, "type %sAggregateArgs struct {\nWhere %sWhereInput\nFilters map[string]zenithdb.Filter\nOrderBy []zenithdb.OrderBy\nCursor %sWhereUniqueInput\nSkip int\nTake int\nCountAll bool\nCount []string\nSum []string\nAvg []string\nMin []string\nMax []string\n}\n\n", model.Name, model.Name, model.Name)
+	fmt.Fprintf(buffer, "type %sGroupByArgs struct {\nBy []string\nWhere %sWhereInput\nFilters map[string]zenithdb.Filter\nCountAll bool\nCount []string\nSum []string\nAvg []string\nMin []string\nMax []string\nHaving []zenithdb.Having\nOrderBy []zenithdb.GroupOrderBy\nSkip int\nTake int\n}\n\n", model.Name, model.Name)
 	fmt.Fprintf(buffer, "type %sUpdateManyArgs struct {\nWhere %sWhereInput\nFilters map[string]zenithdb.Filter\nData %sUpdateInput\nTake int\n}\n\n", model.Name, model.Name, model.Name)
 	fmt.Fprintf(buffer, "type %sDeleteManyArgs struct {\nWhere %sWhereInput\nFilters map[string]zenithdb.Filter\nTake int\n}\n\n", model.Name, model.Name)
 	fmt.Fprintf(buffer, "type %sUpdateArgs struct {\nWhere %sWhereUniqueInput\nData %sUpdateInput\nInclude *%sInclude\n}\n\n", model.Name, model.Name, model.Name, model.Name)
@@ -390,96 +878,155 @@ func writeIncludeType(buffer *bytes.Buffer, model zenithdb.Model) {
 	fmt.Fprintf(buffer, "type %sDeleteArgs struct {\nWhere %sWhereUniqueInput\nInclude *%sInclude\n}\n\n", model.Name, model.Name, model.Name)
 }
 
-func writePrismaLikeMethods(buffer *bytes.Buffer, model zenithdb.Model) {
+// writeSelectType writes the Select input of a model: one flag per field and
+// relation, listing the names a read returns.
+func writeSelectType(buffer *bytes.Buffer, model zenithdb.Model) {
+	fmt.Fprintf(buffer, "type %sSelect struct {\n", model.Name)
+	for _, field := range model.Fields {
+		fmt.Fprintf(buffer, "%s bool\n", exportedIdentifier(field.Name))
+	}
+	for _, relation := range model.Relations {
+		fmt.Fprintf(buffer, "%s bool\n", exportedIdentifier(relation.Name))
+	}
+	fmt.Fprintf(buffer, "}\n\n")
+
+	fmt.Fprintf(buffer, "func (input *%sSelect) fields() []string {\nif input == nil {\nreturn nil\n}\nvar fields []string\n", model.Name)
+	for _, field := range model.Fields {
+		fmt.Fprintf(buffer, "if input.%s {\nfields = append(fields, %q)\n}\n", exportedIdentifier(field.Name), field.Name)
+	}
+	for _, relation := range model.Relations {
+		fmt.Fprintf(buffer, "if input.%s {\nfields = append(fields, %q)\n}\n", exportedIdentifier(relation.Name), relation.Name)
+	}
+	fmt.Fprintf(buffer, "return fields\n}\n\n")
+}
+
+func writePrismaLikeMethods(buffer *bytes.Buffer, schema zenithdb.Schema, model zenithdb.Model) {
 	fmt.Fprintf(buffer, "func (c %sClient) FindUnique(ctx context.Context, args %sFindUniqueArgs) (%s, bool, error) {\n", model.Name, model.Name, model.Name)
-	fmt.Fprintf(buffer, "if c.client.remote {\nwhere := args.Where.where()\nif where == nil {\nreturn %s{}, false, nil\n}\nrecord, ok, err := c.client.db.FindUnique(ctx, %q, where, args.Include.include())\nif err != nil || !ok {\nreturn %s{}, ok, err\n}\nreturn recordTo%s(record), true, nil\n}\n", model.Name, model.Name, model.Name, model.Name)
-	for _, field := range uniqueLookupFields(model) {
-		fmt.Fprintf(buffer, "if args.Where.%s != %s {\nrecord, ok := c.client.%s.findBy%s(args.Where.%s)\nif !ok {\nreturn %s{}, false, nil\n}\nc.client.include%s(&record, args.Include)\nreturn record, true, nil\n}\n", exportedIdentifier(field.Name), zeroValue(field.Kind), lowerIdentifier(model.Name), exportedIdentifier(field.Name), exportedIdentifier(field.Name), model.Name, model.Name)
+	fmt.Fprintf(buffer, "if c.client.remote || args.Select != nil || args.Include.narrowed() {\nwhere := args.Where.where()\nif where == nil {\nreturn %s{}, false, nil\n}\nrecord, ok, err := c.client.db.FindUnique(ctx, %q, where, args.Include.include(), args.Select.fields())\nif err != nil || !ok {\nreturn %s{}, ok, err\n}\nreturn recordTo%s(record), true, nil\n}\n", model.Name, model.Name, model.Name, model.Name)
+	for _, key := range uniqueLookupKeys(model) {
+		fmt.Fprintf(buffer, "if args.Where.%[1]s != %[2]s {\nrecord, ok := c.client.%[3]s.findBy%[1]s(args.Where.%[1]s)\nif !ok {\nreturn %[4]s{}, false, nil\n}\nc.client.include%[4]s(&record, args.Include)\nreturn record, true, nil\n}\n", key.name(), key.zero(), storeField(model.Name), model.Name)
 	}
 	fmt.Fprintf(buffer, "return %s{}, false, nil\n}\n\n", model.Name)
 
 	fmt.Fprintf(buffer, "func (c %sClient) FindMany(ctx context.Context, args %sFindManyArgs) ([]%s, error) {\n", model.Name, model.Name, model.Name)
-	fmt.Fprintf(buffer, "if c.client.remote || len(args.Filters) > 0 || len(args.OrderBy) > 0 || args.Skip > 0 || args.Cursor.where() != nil {\nrecords, err := c.client.db.FindMany(ctx, %q, zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, Index: args.Where.index(), Include: args.Include.include(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy})\nif err != nil {\nreturn nil, err\n}\nresult := make([]%s, 0, len(records))\nfor _, record := range records {\nresult = append(result, recordTo%s(record))\n}\nreturn result, nil\n}\n", model.Name, model.Name, model.Name)
-	pk, hasPK := primaryField(model)
-	if hasPK {
-		fmt.Fprintf(buffer, "if args.Where.%s != nil {\nrecord, ok := c.client.%s.findBy%s(*args.Where.%s)\nif !ok {\nreturn nil, nil\n}\nc.client.include%s(&record, args.Include)\nreturn []%s{record}, nil\n}\n", exportedIdentifier(pk.Name), lowerIdentifier(model.Name), exportedIdentifier(pk.Name), exportedIdentifier(pk.Name), model.Name, model.Name)
-	}
-	for _, index := range model.Indexes {
-		if len(index.Fields) != 1 {
-			continue
-		}
-		field, ok := findField(model, index.Fields[0])
-		if !ok {
-			continue
-		}
-		if index.Unique {
-			fmt.Fprintf(buffer, "if args.Where.%s != nil {\nrecord, ok := c.client.%s.findBy%s(*args.Where.%s)\nif !ok {\nreturn nil, nil\n}\nc.client.include%s(&record, args.Include)\nreturn []%s{record}, nil\n}\n", exportedIdentifier(field.Name), lowerIdentifier(model.Name), exportedIdentifier(field.Name), exportedIdentifier(field.Name), model.Name, model.Name)
+	fmt.Fprintf(buffer, "if c.client.remote || args.Select != nil || args.Include.narrowed() || len(args.Filters) > 0 || args.Where.filterExpr() != nil || len(args.OrderBy) > 0 || args.Skip > 0 || args.Cursor.where() != nil {\nrecords, err := c.client.db.FindMany(ctx, %q, args.query())\nif err != nil {\nreturn nil, err\n}\nresult := make([]%s, 0, len(records))\nfor _, record := range records {\nresult = append(result, recordTo%s(record))\n}\nreturn result, nil\n}\n", model.Name, model.Name, model.Name)
+	if pk, ok := primaryKey(model); ok {
+		set, value := pk.pointers("args.Where")
+		fmt.Fprintf(buffer, "if %s {\nrecord, ok := c.client.%s.findBy%s(%s)\nif !ok {\nreturn nil, nil\n}\nc.client.include%s(&record, args.Include)\nreturn []%s{record}, nil\n}\n", set, storeField(model.Name), pk.name(), value, model.Name, model.Name)
+	}
+	for _, index := range storeIndexes(model) {
+		set, value := index.key.pointers("args.Where")
+		if index.unique {
+			fmt.Fprintf(buffer, "if %s {\nrecord, ok := c.client.%s.findBy%s(%s)\nif !ok {\nreturn nil, nil\n}\nc.client.include%s(&record, args.Include)\nreturn []%s{record}, nil\n}\n", set, storeField(model.Name), index.key.name(), value, model.Name, model.Name)
 		} else {
-			fmt.Fprintf(buffer, "if args.Where.%s != nil {\nresult := c.client.%s.findManyBy%s(*args.Where.%s, args.Take)\nfor i := range result {\nc.client.include%s(&result[i], args.Include)\n}\nreturn result, nil\n}\n", exportedIdentifier(field.Name), lowerIdentifier(model.Name), exportedIdentifier(field.Name), exportedIdentifier(field.Name), model.Name)
+			fmt.Fprintf(buffer, "if %s {\nresult := c.client.%s.findManyBy%s(%s, args.Take)\nfor i := range result {\nc.client.include%s(&result[i], args.Include)\n}\nreturn result, nil\n}\n", set, storeField(model.Name), index.key.name(), value, model.Name)
 		}
 	}
-	fmt.Fprintf(buffer, "records, err := c.client.db.FindMany(ctx, %q, zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, Index: args.Where.index(), Include: args.Include.include(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy})\n", model.Name)
+	fmt.Fprintf(buffer, "records, err := c.client.db.FindMany(ctx, %q, args.query())\n", model.Name)
 	fmt.Fprintf(buffer, "if err != nil {\nreturn nil, err\n}\nresult := make([]%s, 0, len(records))\nfor _, record := range records {\nconverted := recordTo%s(record)\nc.client.include%s(&converted, args.Include)\nresult = append(result, converted)\n}\nreturn result, nil\n}\n\n", model.Name, model.Name, model.Name)
 
+	fmt.Fprintf(buffer, "func (c %sClient) Iterate(ctx context.Context, args %sFindManyArgs) iter.Seq2[%s, error] {\n", model.Name, model.Name, model.Name)
+	fmt.Fprintf(buffer, "return func(yield func(%s, error) bool) {\nfor record, err := range c.client.db.Iterate(ctx, %q, args.query()) {\nif err != nil {\nyield(%s{}, err)\nreturn\n}\nif !yield(recordTo%s(record), nil) {\nreturn\n}\n}\n}\n}\n\n", model.Name, model.Name, model.Name, model.Name)
+
 	fmt.Fprintf(buffer, "func (c %sClient) Count(ctx context.Context, args %sFindManyArgs) (int, error) {\n", model.Name, model.Name)
-	fmt.Fprintf(buffer, "return c.client.db.Count(ctx, %q, zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, Index: args.Where.index()})\n}\n\n", model.Name)
+	fmt.Fprintf(buffer, "return c.client.db.Count(ctx, %q, zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index()})\n}\n\n", model.Name)
+
+	fmt.Fprintf(buffer, "func (c %sClient) Aggregate(ctx context.Context, args %sAggregateArgs) (zenithdb.AggregateResult, error) {\n", model.Name, model.Name)
+	fmt.Fprintf(buffer, "return c.client.db.Aggregate(ctx, %q, zenithdb.AggregateQuery{\nQuery: zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy},\nCountAll: args.CountAll,\nCount: args.Count,\nSum: args.Sum,\nAvg: args.Avg,\nMin: args.Min,\nMax: args.Max,\n})\n}\n\n", model.Name)
+
+	fmt.Fprintf(buffer, "func (c %sClient) GroupBy(ctx context.Context, args %sGroupByArgs) ([]zenithdb.Group, error) {\n", model.Name, model.Name)
+	fmt.Fprintf(buffer, "return c.client.db.GroupBy(ctx, %q, zenithdb.GroupByQuery{\nAggregateQuery: zenithdb.AggregateQuery{\nQuery: zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index()},\nCountAll: args.CountAll,\nCount: args.Count,\nSum: args.Sum,\nAvg: args.Avg,\nMin: args.Min,\nMax: args.Max,\n},\nBy: args.By,\nHaving: args.Having,\nOrderBy: args.OrderBy,\nSkip: args.Skip,\nLimit: args.Take,\n})\n}\n\n", model.Name)
 
 	fmt.Fprintf(buffer, "func (c %sClient) UpdateMany(ctx context.Context, args %sUpdateManyArgs) (zenithdb.ManyResult, error) {\n", model.Name, model.Name)
-	fmt.Fprintf(buffer, "result, err := c.client.db.UpdateMany(ctx, %q, zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, Index: args.Where.index(), Limit: args.Take}, args.Data.record())\nif err != nil {\nreturn zenithdb.ManyResult{}, err\n}\nif !c.client.remote {\nc.client.%s = new%sStore()\nif err := c.client.load%s(ctx); err != nil {\nreturn result, err\n}\n}\nreturn result, nil\n}\n\n", model.Name, lowerIdentifier(model.Name), model.Name, model.Name)
+	fmt.Fprintf(buffer, "return c.client.db.UpdateMany(ctx, %q, zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take}, args.Data.record())\n}\n\n", model.Name)
 
 	fmt.Fprintf(buffer, "func (c %sClient) DeleteMany(ctx context.Context, args %sDeleteManyArgs) (zenithdb.ManyResult, error) {\n", model.Name, model.Name)
-	fmt.Fprintf(buffer, "result, err := c.client.db.DeleteMany(ctx, %q, zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, Index: args.Where.index(), Limit: args.Take})\nif err != nil {\nreturn zenithdb.ManyResult{}, err\n}\nif !c.client.remote {\nc.client.%s = new%sStore()\nif err := c.client.load%s(ctx); err != nil {\nreturn result, err\n}\n}\nreturn result, nil\n}\n\n", model.Name, lowerIdentifier(model.Name), model.Name, model.Name)
+	fmt.Fprintf(buffer, "return c.client.db.DeleteMany(ctx, %q, zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take})\n}\n\n", model.Name)
 
 	fmt.Fprintf(buffer, "func (c %sClient) Update(ctx context.Context, args %sUpdateArgs) (%s, bool, error) {\n", model.Name, model.Name, model.Name)
-	fmt.Fprintf(buffer, "if c.client.remote {\nupdatedRecord, err := c.client.db.Update(ctx, %q, args.Where.where(), args.Data.record())\nif err != nil {\nreturn %s{}, false, err\n}\nif args.Include != nil {\nrecord, ok, err := c.client.db.FindUnique(ctx, %q, args.Where.where(), args.Include.include())\nif err != nil || !ok {\nreturn %s{}, ok, err\n}\nreturn recordTo%s(record), true, nil\n}\nreturn recordTo%s(updatedRecord), true, nil\n}\n", model.Name, model.Name, model.Name, model.Name, model.Name, model.Name)
-	fmt.Fprintf(buffer, "previous, ok, err := c.FindUnique(ctx, %sFindUniqueArgs{Where: args.Where})\nif err != nil || !ok {\nreturn %s{}, ok, err\n}\nupdatedRecord, err := c.client.db.Update(ctx, %q, args.Where.where(), args.Data.record())\nif err != nil {\nreturn %s{}, false, err\n}\nupdated := recordTo%s(updatedRecord)\nc.client.%s.replace(previous, updated)\nc.client.include%s(&updated, args.Include)\nreturn updated, true, nil\n}\n\n", model.Name, model.Name, model.Name, model.Name, model.Name, lowerIdentifier(model.Name), model.Name)
+	fmt.Fprintf(buffer, "if c.client.remote {\nupdatedRecord, err := c.client.db.Update(ctx, %q, args.Where.where(), args.Data.record())\nif err != nil {\nreturn %s{}, false, err\n}\nif args.Include != nil {\nrecord, ok, err := c.client.db.FindUnique(ctx, %q, args.Where.where(), args.Include.include(), nil)\nif err != nil || !ok {\nreturn %s{}, ok, err\n}\nreturn recordTo%s(record), true, nil\n}\nreturn recordTo%s(updatedRecord), true, nil\n}\n", model.Name, model.Name, model.Name, model.Name, model.Name, model.Name)
+	fmt.Fprintf(buffer, "if _, ok, err := c.FindUnique(ctx, %sFindUniqueArgs{Where: args.Where}); err != nil || !ok {\nreturn %s{}, ok, err\n}\nupdatedRecord, err := c.client.db.Update(ctx, %q, args.Where.where(), args.Data.record())\nif err != nil {\nreturn %s{}, false, err\n}\nupdated := recordTo%s(updatedRecord)\n%sc.client.include%s(&updated, args.Include)\nreturn updated, true, nil\n}\n\n", model.Name, model.Name, model.Name, model.Name, model.Name, narrowedRead(model, "updated", "true"), model.Name)
 
 	fmt.Fprintf(buffer, "func (c %sClient) Upsert(ctx context.Context, args %sUpsertArgs) (%s, bool, error) {\n", model.Name, model.Name, model.Name)
-	fmt.Fprintf(buffer, "if c.client.remote {\nrecord, created, err := c.client.db.Upsert(ctx, %q, args.Where.where(), args.Create.record(), args.Update.record())\nif err != nil {\nreturn %s{}, false, err\n}\nif args.Include != nil {\nrecordWithInclude, ok, err := c.client.db.FindUnique(ctx, %q, args.Where.where(), args.Include.include())\nif err == nil && ok {\nrecord = recordWithInclude\n}\n}\nreturn recordTo%s(record), created, nil\n}\nprevious, hadPrevious, err := c.FindUnique(ctx, %sFindUniqueArgs{Where: args.Where})\nif err != nil {\nreturn %s{}, false, err\n}\nrecord, created, err := c.client.db.Upsert(ctx, %q, args.Where.where(), args.Create.record(), args.Update.record())\nif err != nil {\nreturn %s{}, false, err\n}\nconverted := recordTo%s(record)\nif created || !hadPrevious {\nc.client.%s.put(converted)\n} else {\nc.client.%s.replace(previous, converted)\n}\nc.client.include%s(&converted, args.Include)\nreturn converted, created, nil\n}\n\n", model.Name, model.Name, model.Name, model.Name, model.Name, model.Name, model.Name, model.Name, model.Name, lowerIdentifier(model.Name), lowerIdentifier(model.Name), model.Name)
+	fmt.Fprintf(buffer, "if c.client.remote {\nrecord, created, err := c.client.db.Upsert(ctx, %q, args.Where.where(), args.Create.record(), args.Update.record())\nif err != nil {\nreturn %s{}, false, err\n}\nif args.Include != nil {\nrecordWithInclude, ok, err := c.client.db.FindUnique(ctx, %q, args.Where.where(), args.Include.include(), nil)\nif err == nil && ok {\nrecord = recordWithInclude\n}\n}\nreturn recordTo%s(record), created, nil\n}\nrecord, created, err := c.client.db.Upsert(ctx, %q, args.Where.where(), args.Create.record(), args.Update.record())\nif err != nil {\nreturn %s{}, false, err\n}\nconverted := recordTo%s(record)\n%sc.client.include%s(&converted, args.Include)\nreturn converted, created, nil\n}\n\n", model.Name, model.Name, model.Name, model.Name, model.Name, model.Name, model.Name, narrowedRead(model, "converted", "created"), model.Name)
 
 	fmt.Fprintf(buffer, "func (c %sClient) Delete(ctx context.Context, args %sDeleteArgs) (%s, bool, error) {\n", model.Name, model.Name, model.Name)
 	fmt.Fprintf(buffer, "if c.client.remote {\nprevious, ok, err := c.FindUnique(ctx, %sFindUniqueArgs{Where: args.Where, Include: args.Include})\nif err != nil || !ok {\nreturn %s{}, ok, err\n}\n_, err = c.client.db.Delete(ctx, %q, args.Where.where())\nif err != nil {\nreturn %s{}, false, err\n}\nreturn previous, true, nil\n}\n", model.Name, model.Name, model.Name, model.Name)
-	fmt.Fprintf(buffer, "previous, ok, err := c.FindUnique(ctx, %sFindUniqueArgs{Where: args.Where})\nif err != nil || !ok {\nreturn %s{}, ok, err\n}\n_, err = c.client.db.Delete(ctx, %q, args.Where.where())\nif err != nil {\nreturn %s{}, false, err\n}\nc.client.%s.remove(previous)\nc.client.include%s(&previous, args.Include)\nreturn previous, true, nil\n}\n\n", model.Name, model.Name, model.Name, model.Name, lowerIdentifier(model.Name), model.Name)
+	fmt.Fprintf(buffer, "lookup := %sFindUniqueArgs{Where: args.Where}\nif args.Include.narrowed() {\nlookup.Include = args.Include\n}\nprevious, ok, err := c.FindUnique(ctx, lookup)\nif err != nil || !ok {\nreturn %s{}, ok, err\n}\n_, err = c.client.db.Delete(ctx, %q, args.Where.where())\nif err != nil {\nreturn %s{}, false, err\n}\nif lookup.Include == nil {\nc.client.include%s(&previous, args.Include)\n}\nreturn previous, true, nil\n}\n\n", model.Name, model.Name, model.Name, model.Name, model.Name)
 }
 
-func writeUniqueMethods(buffer *bytes.Buffer, model zenithdb.Model, fields []string, written map[string]struct{}) {
-	if len(fields) != 1 {
-		return
-	}
-	field, ok := findField(model, fields[0])
-	if !ok {
-		return
+func writeTransaction(buffer *bytes.Buffer, schema zenithdb.Schema) {
+	fmt.Fprintf(buffer, "type engineTx interface {\nCreate(context.Context, string, zenithdb.Record) (zenithdb.MutationResult, error)\nUpdate(context.Context, string, map[string]any, zenithdb.Record) (zenithdb.Record, error)\nDelete(context.Context, string, map[string]any) (zenithdb.Record, error)\nUpsert(context.Context, string, map[string]any, zenithdb.Record, zenithdb.Record) (zenithdb.Record, bool, error)\nFindUnique(context.Context, string, map[string]any, map[string]zenithdb.Include, []string) (zenithdb.Record, bool, error)\nFindMany(context.Context, string, zenithdb.Query) ([]zenithdb.Record, error)\nCommit(context.Context) error\nRollback(context.Context) error\n}\n\n")
+	fmt.Fprintf(buffer, "// Tx exposes the model clients inside an interactive transaction.\ntype Tx struct {\ntx engineTx\n")
+	for _, model := range schema.Models {
+		if !hiddenModel(model) {
+			fmt.Fprintf(buffer, "%[1]s %[1]sTxClient\n", model.Name)
+		}
 	}
-	method := "FindUniqueBy" + exportedIdentifier(field.Name)
-	if _, ok := written[method]; ok {
-		return
+	fmt.Fprintf(buffer, "}\n\n")
+	fmt.Fprintf(buffer, "func (c *Client) begin(ctx context.Context) (engineTx, error) {\nswitch db := c.db.(type) {\ncase *zenithdb.DB:\nreturn db.Begin(ctx)\ncase *remote.Client:\nreturn db.Begin(ctx)\ndefault:\nreturn nil, errors.New(\"engine does not support transactions\")\n}\n}\n\n")
+	fmt.Fprintf(buffer, "// Transaction runs fn in an interactive transaction. The transaction commits\n// when fn returns nil and rolls back otherwise.\nfunc (c *Client) Transaction(ctx context.Context, fn func(tx *Tx) error) error {\nengineTx, err := c.begin(ctx)\nif err != nil {\nreturn err\n}\ntx := &Tx{tx: engineTx}\n")
+	for _, model := range schema.Models {
+		if !hiddenModel(model) {
+			fmt.Fprintf(buffer, "tx.%[1]s = %[1]sTxClient{tx: tx}\n", model.Name)
+		}
 	}
-	written[method] = struct{}{}
+	fmt.Fprintf(buffer, "if err := fn(tx); err != nil {\n_ = engineTx.Rollback(ctx)\nreturn err\n}\nreturn engineTx.Commit(ctx)\n}\n\n")
+}
 
-	fmt.Fprintf(buffer, "func (c %sClient) %s(ctx context.Context, value %s) (%s, bool, error) {\n", model.Name, method, goType(field.Kind), model.Name)
-	fmt.Fprintf(buffer, "if c.client.remote {\nrecord, ok, err := c.client.db.FindUnique(ctx, %q, map[string]any{%q: value}, nil)\nif err != nil || !ok {\nreturn %s{}, ok, err\n}\nreturn recordTo%s(record), true, nil\n}\n", model.Name, field.Name, model.Name, model.Name)
-	fmt.Fprintf(buffer, "record, ok := c.client.%s.findBy%s(value)\nreturn record, ok, nil\n}\n\n", lowerIdentifier(model.Name), exportedIdentifier(field.Name))
+func writeModelTxClient(buffer *bytes.Buffer, schema zenithdb.Schema, model zenithdb.Model) {
+	name := model.Name
+	var nestedCreate string
+	if len(nestedRelations(schema, model)) > 0 {
+		nestedCreate = fmt.Sprintf("if input.nested() {\nstored, _, err := c.tx.tx.FindUnique(ctx, %q, %s, nil, nil)\nif err != nil {\nreturn %s{}, err\n}\nreturn recordTo%s(stored), nil\n}\n", name, primaryWhereLiteral(model, "record"), name, name)
+	}
+	fmt.Fprintf(buffer, "type %[1]sTxClient struct {\ntx *Tx\n}\n\n", name)
+	fmt.Fprintf(buffer, "func (c %[1]sTxClient) Create(ctx context.Context, input %[1]sCreateInput) (%[1]s, error) {\ncreated, err := c.tx.tx.Create(ctx, %[1]q, input.record())\nif err != nil {\nreturn %[1]s{}, err\n}\nrecord := recordTo%[1]s(created.Record)\n%[2]sreturn record, nil\n}\n\n", name, nestedCreate)
+	fmt.Fprintf(buffer, "func (c %[1]sTxClient) FindUnique(ctx context.Context, args %[1]sFindUniqueArgs) (%[1]s, bool, error) {\nwhere := args.Where.where()\nif where == nil {\nreturn %[1]s{}, false, nil\n}\nrecord, ok, err := c.tx.tx.FindUnique(ctx, %[1]q, where, args.Include.include(), args.Select.fields())\nif err != nil || !ok {\nreturn %[1]s{}, ok, err\n}\nreturn recordTo%[1]s(record), true, nil\n}\n\n", name)
+	fmt.Fprintf(buffer, "func (c %[1]sTxClient) FindMany(ctx context.Context, args %[1]sFindManyArgs) ([]%[1]s, error) {\nrecords, err := c.tx.tx.FindMany(ctx, %[1]q, args.query())\nif err != nil {\nreturn nil, err\n}\nresult := make([]%[1]s, 0, len(records))\nfor _, record := range records {\nresult = append(result, recordTo%[1]s(record))\n}\nreturn result, nil\n}\n\n", name)
+	fmt.Fprintf(buffer, "func (c %[1]sTxClient) Update(ctx context.Context, args %[1]sUpdateArgs) (%[1]s, bool, error) {\nif _, ok, err := c.FindUnique(ctx, %[1]sFindUniqueArgs{Where: args.Where}); err != nil || !ok {\nreturn %[1]s{}, ok, err\n}\nupdatedRecord, err := c.tx.tx.Update(ctx, %[1]q, args.Where.where(), args.Data.record())\nif err != nil {\nreturn %[1]s{}, false, err\n}\nif args.Include != nil {\nreturn c.FindUnique(ctx, %[1]sFindUniqueArgs{Where: args.Where, Include: args.Include})\n}\nreturn recordTo%[1]s(updatedRecord), true, nil\n}\n\n", name)
+	fmt.Fprintf(buffer, "func (c %[1]sTxClient) Upsert(ctx context.Context, args %[1]sUpsertArgs) (%[1]s, bool, error) {\nrecord, created, err := c.tx.tx.Upsert(ctx, %[1]q, args.Where.where(), args.Create.record(), args.Update.record())\nif err != nil {\nreturn %[1]s{}, false, err\n}\nconverted := recordTo%[1]s(record)\nif args.Include != nil {\nrecordWithInclude, ok, err := c.FindUnique(ctx, %[1]sFindUniqueArgs{Where: args.Where, Include: args.Include})\nif err == nil && ok {\nconverted = recordWithInclude\n}\n}\nreturn converted, created, nil\n}\n\n", name)
+	fmt.Fprintf(buffer, "func (c %[1]sTxClient) Delete(ctx context.Context, args %[1]sDeleteArgs) (%[1]s, bool, error) {\nprevious, ok, err := c.FindUnique(ctx, %[1]sFindUniqueArgs{Where: args.Where, Include: args.Include})\nif err != nil || !ok {\nreturn %[1]s{}, ok, err\n}\n_, err = c.tx.tx.Delete(ctx, %[1]q, args.Where.where())\nif err != nil {\nreturn %[1]s{}, false, err\n}\nreturn previous, true, nil\n}\n\n", name)
 }
 
-func writeFindManyMethod(buffer *bytes.Buffer, model zenithdb.Model, index zenithdb.Index) {
-	if len(index.Fields) != 1 {
-		return
-	}
-	field, ok := findField(model, index.Fields[0])
-	if !ok {
-		return
-	}
-	method := "FindManyBy" + exportedIdentifier(field.Name)
+func writeUniqueMethod(buffer *bytes.Buffer, model zenithdb.Model, key lookupKey) {
+	method := "FindUniqueBy" + key.name()
+	params, where, value := key.params()
+	fmt.Fprintf(buffer, "func (c %sClient) %s(ctx context.Context, %s) (%s, bool, error) {\n", model.Name, method, params, model.Name)
+	fmt.Fprintf(buffer, "if c.client.remote {\nrecord, ok, err := c.client.db.FindUnique(ctx, %q, %s, nil, nil)\nif err != nil || !ok {\nreturn %s{}, ok, err\n}\nreturn recordTo%s(record), true, nil\n}\n", model.Name, where, model.Name, model.Name)
+	fmt.Fprintf(buffer, "record, ok := c.client.%s.findBy%s(%s)\nreturn record, ok, nil\n}\n\n", storeField(model.Name), key.name(), value)
+}
 
-	fmt.Fprintf(buffer, "func (c %sClient) %s(ctx context.Context, value %s, limit int) ([]%s, error) {\n", model.Name, method, goType(field.Kind), model.Name)
-	fmt.Fprintf(buffer, "if c.client.remote {\nrecords, err := c.client.db.FindMany(ctx, %q, zenithdb.Query{Where: map[string]any{%q: value}, Index: %q, Limit: limit})\nif err != nil {\nreturn nil, err\n}\nresult := make([]%s, 0, len(records))\nfor _, record := range records {\nresult = append(result, recordTo%s(record))\n}\nreturn result, nil\n}\n", model.Name, field.Name, index.Name, model.Name, model.Name)
-	fmt.Fprintf(buffer, "return c.client.%s.findManyBy%s(value, limit), nil\n}\n\n", lowerIdentifier(model.Name), exportedIdentifier(field.Name))
+func writeFindManyMethod(buffer *bytes.Buffer, model zenithdb.Model, index storeIndex) {
+	key := index.key
+	method := "FindManyBy" + key.name()
+
+	params, where, value := key.params()
+	fmt.Fprintf(buffer, "func (c %sClient) %s(ctx context.Context, %s, limit int) ([]%s, error) {\n", model.Name, method, params, model.Name)
+	fmt.Fprintf(buffer, "if c.client.remote {\nrecords, err := c.client.db.FindMany(ctx, %q, zenithdb.Query{Where: %s, Index: %q, Limit: limit})\nif err != nil {\nreturn nil, err\n}\nresult := make([]%s, 0, len(records))\nfor _, record := range records {\nresult = append(result, recordTo%s(record))\n}\nreturn result, nil\n}\n", model.Name, where, index.name, model.Name, model.Name)
+	fmt.Fprintf(buffer, "return c.client.%s.findManyBy%s(%s, limit), nil\n}\n\n", storeField(model.Name), key.name(), value)
 }
 
 func writeFields(buffer *bytes.Buffer, fields []zenithdb.Field) {
 	fmt.Fprintf(buffer, "Fields: []zenithdb.Field{\n")
 	for _, field := range fields {
-		fmt.Fprintf(buffer, "{Name: %q, Kind: zenithdb.%s, Required: %t},\n", field.Name, exportedKind(field.Kind), field.Required)
+		var attributes string
+		if field.Kind == zenithdb.FieldEnum {
+			attributes += fmt.Sprintf(", Enum: %q, Values: []string{%s}", field.Enum, quotedStrings(field.Values))
+		}
+		if field.Default != nil {
+			attributes += ", Default: " + defaultLiteral(*field.Default)
+		}
+		if field.UpdatedAt {
+			attributes += ", UpdatedAt: true"
+		}
+		if field.List {
+			attributes += ", List: true"
+		}
+		if len(field.Validations) > 0 {
+			attributes += ", Validations: " + validationsLiteral(field.Validations)
+		}
+		fmt.Fprintf(buffer, "{Name: %q, Kind: zenithdb.%s, Required: %t%s},\n", field.Name, exportedKind(field.Kind), field.Required, attributes)
 	}
 	fmt.Fprintf(buffer, "},\n")
 }
@@ -491,6 +1038,10 @@ func writeStringSlice(buffer *bytes.Buffer, name string, values []string) {
 func writeIndexes(buffer *bytes.Buffer, indexes []zenithdb.Index) {
 	fmt.Fprintf(buffer, "Indexes: []zenithdb.Index{\n")
 	for _, index := range indexes {
+		if index.Type == zenithdb.IndexOrdered {
+			fmt.Fprintf(buffer, "{Name: %q, Fields: []string{%s}, Unique: %t, Type: zenithdb.IndexOrdered},\n", index.Name, quotedStrings(index.Fields), index.Unique)
+			continue
+		}
 		fmt.Fprintf(buffer, "{Name: %q, Fields: []string{%s}, Unique: %t},\n", index.Name, quotedStrings(index.Fields), index.Unique)
 	}
 	fmt.Fprintf(buffer, "},\n")
@@ -499,14 +1050,26 @@ func writeIndexes(buffer *bytes.Buffer, indexes []zenithdb.Index) {
 func writeRelations(buffer *bytes.Buffer, relations []zenithdb.Relation) {
 	fmt.Fprintf(buffer, "Relations: []zenithdb.Relation{\n")
 	for _, relation := range relations {
+		actions := ""
+		if relation.OnDelete != "" {
+			actions += fmt.Sprintf(", OnDelete: zenithdb.Action%s", relation.OnDelete)
+		}
+		if relation.OnUpdate != "" {
+			actions += fmt.Sprintf(", OnUpdate: zenithdb.Action%s", relation.OnUpdate)
+		}
+		if relation.Through != "" {
+			actions += fmt.Sprintf(", Through: %q, ThroughFields: []string{%s}, ThroughReferences: []string{%s}", relation.Through, quotedStrings(relation.ThroughFields), quotedStrings(relation.ThroughReferences))
+		}
 		fmt.Fprintf(
 			buffer,
-			"{Name: %q, Model: %q, Fields: []string{%s}, References: []string{%s}, Many: %t},\n",
+			"{Name: %q, Model: %q, Fields: []string{%s}, References: []string{%s}, Many: %t, ForeignKey: %t%s},\n",
 			relation.Name,
 			relation.Model,
 			quotedStrings(relation.Fields),
 			quotedStrings(relation.References),
 			relation.Many,
+			relation.ForeignKey,
+			actions,
 		)
 	}
 	fmt.Fprintf(buffer, "},\n")
@@ -538,11 +1101,215 @@ func findModel(schema zenithdb.Schema, name string) (zenithdb.Model, bool) {
 	return zenithdb.Model{}, false
 }
 
-func primaryField(model zenithdb.Model) (zenithdb.Field, bool) {
-	if len(model.PrimaryKey) != 1 {
-		return zenithdb.Field{}, false
+// lookupKey is the fields a store map, a unique input, or a lookup method is
+// keyed by. A single field keys by its value, and several by a struct of
+// their values named after the model and the fields, as in
+// MembershipTenantIDIDKey.
+type lookupKey struct {
+	model  string
+	fields []zenithdb.Field
+}
+
+func newLookupKey(model zenithdb.Model, names []string) (lookupKey, bool) {
+	key := lookupKey{model: model.Name}
+	for _, name := range names {
+		field, ok := findField(model, name)
+		// The Go types of json, bytes, and list fields cannot key a map.
+		if !ok || field.Kind == zenithdb.FieldJSON || field.Kind == zenithdb.FieldBytes || field.List {
+			return lookupKey{}, false
+		}
+		key.fields = append(key.fields, field)
+	}
+	return key, len(key.fields) > 0
+}
+
+// primaryKey returns the lookupKey of the primary key of model.
+func primaryKey(model zenithdb.Model) (lookupKey, bool) {
+	return newLookupKey(model, model.PrimaryKey)
+}
+
+func (key lookupKey) compound() bool {
+	return len(key.fields) > 1
+}
+
+// name joins the exported names of the fields, as in TenantIDID.
+func (key lookupKey) name() string {
+	var name strings.Builder
+	for _, field := range key.fields {
+		name.WriteString(exportedIdentifier(field.Name))
+	}
+	return name.String()
+}
+
+func (key lookupKey) goType() string {
+	if !key.compound() {
+		return fieldType(key.fields[0])
+	}
+	return key.model + key.name() + "Key"
+}
+
+func (key lookupKey) zero() string {
+	if !key.compound() {
+		return zeroValue(key.fields[0].Kind)
+	}
+	return "(" + key.goType() + "{})"
+}
+
+// value emits the key of the record expr holds, read from its fields of the
+// same names or, when fields is set, from those fields in order. A nullable
+// field is dereferenced, so the key holds only where present holds.
+func (key lookupKey) value(expr string, fields []zenithdb.Field) string {
+	if fields == nil {
+		fields = key.fields
+	}
+	values := make([]string, 0, len(key.fields))
+	for _, field := range fields {
+		value := expr + "." + exportedIdentifier(field.Name)
+		if nullable(field) {
+			value = "*" + value
+		}
+		values = append(values, value)
+	}
+	if !key.compound() {
+		return values[0]
+	}
+	for i, field := range key.fields {
+		values[i] = exportedIdentifier(field.Name) + ": " + values[i]
+	}
+	return key.goType() + "{" + strings.Join(values, ", ") + "}"
+}
+
+// present emits the condition that none of the nullable fields of the record
+// expr holds is null, as a key read from them needs. It is empty when none of
+// fields is nullable.
+func present(expr string, fields []zenithdb.Field) string {
+	var conditions []string
+	for _, field := range fields {
+		if nullable(field) {
+			conditions = append(conditions, expr+"."+exportedIdentifier(field.Name)+" != nil")
+		}
 	}
-	return findField(model, model.PrimaryKey[0])
+	return strings.Join(conditions, " && ")
+}
+
+// where emits the engine lookup of the key value expr holds.
+func (key lookupKey) where(expr string) string {
+	if !key.compound() {
+		return fmt.Sprintf("map[string]any{%q: %s}", key.fields[0].Name, fieldValue(key.fields[0], expr))
+	}
+	values := make([]string, 0, len(key.fields))
+	for _, field := range key.fields {
+		values = append(values, fmt.Sprintf("%q: %s", field.Name, fieldValue(field, expr+"."+exportedIdentifier(field.Name))))
+	}
+	return "map[string]any{" + strings.Join(values, ", ") + "}"
+}
+
+// pointers returns the condition that the optional fields of the WhereInput
+// expr holds are set for every field of the key, and the key they hold.
+func (key lookupKey) pointers(expr string) (set string, value string) {
+	sets := make([]string, 0, len(key.fields))
+	values := make([]string, 0, len(key.fields))
+	for _, field := range key.fields {
+		name := exportedIdentifier(field.Name)
+		sets = append(sets, expr+"."+name+" != nil")
+		values = append(values, "*"+expr+"."+name)
+	}
+	if !key.compound() {
+		return sets[0], values[0]
+	}
+	for i, field := range key.fields {
+		values[i] = exportedIdentifier(field.Name) + ": " + values[i]
+	}
+	return strings.Join(sets, " && "), key.goType() + "{" + strings.Join(values, ", ") + "}"
+}
+
+// params returns the parameters a lookup method takes the key as, one per
+// field of a compound key, with the engine lookup and the store key they
+// build.
+func (key lookupKey) params() (params string, where string, value string) {
+	if !key.compound() {
+		return "value " + key.goType(), key.where("value"), "value"
+	}
+	names := make([]string, 0, len(key.fields))
+	wheres := make([]string, 0, len(key.fields))
+	values := make([]string, 0, len(key.fields))
+	for _, field := range key.fields {
+		param := lowerIdentifier(field.Name)
+		names = append(names, param+" "+fieldType(field))
+		wheres = append(wheres, fmt.Sprintf("%q: %s", field.Name, fieldValue(field, param)))
+		values = append(values, exportedIdentifier(field.Name)+": "+param)
+	}
+	return strings.Join(names, ", "), "map[string]any{" + strings.Join(wheres, ", ") + "}", key.goType() + "{" + strings.Join(values, ", ") + "}"
+}
+
+func (key lookupKey) matches(fields []string) bool {
+	if len(fields) != len(key.fields) {
+		return false
+	}
+	for i, field := range key.fields {
+		if field.Name != fields[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeKeyType emits the struct a compound key is held in.
+func writeKeyType(buffer *bytes.Buffer, key lookupKey) {
+	fmt.Fprintf(buffer, "type %s struct {\n", key.goType())
+	for _, field := range key.fields {
+		fmt.Fprintf(buffer, "%s %s\n", exportedIdentifier(field.Name), fieldType(field))
+	}
+	fmt.Fprintf(buffer, "}\n\n")
+}
+
+// storeIndex is an index the generated store of a model keeps a map for.
+type storeIndex struct {
+	name   string
+	key    lookupKey
+	unique bool
+}
+
+// storeIndexes returns the indexes of model the store keeps a map for, the
+// compound ones first so lookups prefer the index that covers the most
+// fields. An index over the fields of the primary key or of an earlier index
+// shares its map.
+func storeIndexes(model zenithdb.Model) []storeIndex {
+	seen := make(map[string]struct{})
+	if pk, ok := primaryKey(model); ok {
+		seen[pk.name()] = struct{}{}
+	}
+	var indexes []storeIndex
+	for _, index := range model.Indexes {
+		key, ok := newLookupKey(model, index.Fields)
+		if !ok {
+			continue
+		}
+		if _, ok := seen[key.name()]; ok {
+			continue
+		}
+		seen[key.name()] = struct{}{}
+		indexes = append(indexes, storeIndex{name: index.Name, key: key, unique: index.Unique})
+	}
+	slices.SortStableFunc(indexes, func(a, b storeIndex) int {
+		return len(b.key.fields) - len(a.key.fields)
+	})
+	return indexes
+}
+
+// uniqueLookupKeys returns the keys a record of model is found by: its
+// primary key, then the unique indexes the store keeps.
+func uniqueLookupKeys(model zenithdb.Model) []lookupKey {
+	var keys []lookupKey
+	if key, ok := primaryKey(model); ok {
+		keys = append(keys, key)
+	}
+	for _, index := range storeIndexes(model) {
+		if index.unique {
+			keys = append(keys, index.key)
+		}
+	}
+	return keys
 }
 
 func isUniqueLookupField(model zenithdb.Model, fieldName string) bool {
@@ -575,34 +1342,6 @@ func hasNonUniqueSingleFieldIndex(model zenithdb.Model, fieldName string) bool {
 	return false
 }
 
-func uniqueLookupFields(model zenithdb.Model) []zenithdb.Field {
-	seen := make(map[string]struct{})
-	var result []zenithdb.Field
-	for _, name := range model.PrimaryKey {
-		field, ok := findField(model, name)
-		if !ok {
-			continue
-		}
-		seen[field.Name] = struct{}{}
-		result = append(result, field)
-	}
-	for _, index := range model.Indexes {
-		if !index.Unique || len(index.Fields) != 1 {
-			continue
-		}
-		field, ok := findField(model, index.Fields[0])
-		if !ok {
-			continue
-		}
-		if _, ok := seen[field.Name]; ok {
-			continue
-		}
-		seen[field.Name] = struct{}{}
-		result = append(result, field)
-	}
-	return result
-}
-
 func modelExists(schema zenithdb.Schema, name string) bool {
 	for _, model := range schema.Models {
 		if model.Name == name {
@@ -624,11 +1363,75 @@ func goType(kind zenithdb.FieldKind) string {
 		return "float64"
 	case zenithdb.FieldTime:
 		return "time.Time"
+	case zenithdb.FieldJSON:
+		return "json.RawMessage"
+	case zenithdb.FieldBytes:
+		return "[]byte"
 	default:
 		return "string"
 	}
 }
 
+// fieldType returns the Go type of field: the type generated for its enum, or
+// the type of its kind, in a slice for a list.
+func fieldType(field zenithdb.Field) string {
+	if field.List {
+		return "[]" + goType(field.Kind)
+	}
+	if field.Kind == zenithdb.FieldEnum {
+		return field.Enum
+	}
+	return goType(field.Kind)
+}
+
+// modelFieldType returns the Go type a model or create input holds field as:
+// its fieldType, behind a pointer when it is nullable.
+func modelFieldType(field zenithdb.Field) string {
+	if nullable(field) {
+		return "*" + fieldType(field)
+	}
+	return fieldType(field)
+}
+
+// nullable reports whether field is optional and its Go type has no nil of
+// its own, so the generated types hold it through a pointer that is nil when
+// it is null.
+func nullable(field zenithdb.Field) bool {
+	return !field.Required && !field.List && field.Kind != zenithdb.FieldJSON && field.Kind != zenithdb.FieldBytes
+}
+
+// fieldValue emits the engine value of field that the Go expression expr
+// holds, converting an enum to its string and a list to a []any.
+func fieldValue(field zenithdb.Field, expr string) string {
+	if field.List {
+		return "anyList(" + expr + ")"
+	}
+	if field.Kind == zenithdb.FieldEnum {
+		return "string(" + expr + ")"
+	}
+	return expr
+}
+
+// recordField emits the Go value of field read from the record expr holds.
+func recordField(field zenithdb.Field, expr string) string {
+	if field.List {
+		return fmt.Sprintf("recordList[%s](%s, %q)", goType(field.Kind), expr, field.Name)
+	}
+	if nullable(field) && field.Kind == zenithdb.FieldEnum {
+		return fmt.Sprintf("recordEnumPointer[%s](%s, %q)", field.Enum, expr, field.Name)
+	}
+	if nullable(field) {
+		return fmt.Sprintf("recordPointer[%s](%s, %q)", goType(field.Kind), expr, field.Name)
+	}
+	switch field.Kind {
+	case zenithdb.FieldEnum:
+		return fmt.Sprintf("%s(recordValue[string](%s, %q))", field.Enum, expr, field.Name)
+	case zenithdb.FieldJSON:
+		return fmt.Sprintf("recordJSON(%s, %q)", expr, field.Name)
+	}
+	return fmt.Sprintf("recordValue[%s](%s, %q)", goType(field.Kind), expr, field.Name)
+}
+
 func zeroValue(kind zenithdb.FieldKind) string {
 	switch kind {
 	case zenithdb.FieldString:
@@ -641,11 +1444,30 @@ func zeroValue(kind zenithdb.FieldKind) string {
 		return "0"
 	case zenithdb.FieldTime:
 		return "time.Time{}"
+	case zenithdb.FieldJSON, zenithdb.FieldBytes:
+		return "nil"
 	default:
 		return `""`
 	}
 }
 
+// enumConstant names the constant of value in enum, as in RoleSuperUser for
+// SUPER_USER.
+func enumConstant(enum, value string) string {
+	var name strings.Builder
+	name.WriteString(enum)
+	for _, part := range strings.Split(value, "_") {
+		if part == "" {
+			continue
+		}
+		if strings.ToUpper(part) == part {
+			part = strings.ToLower(part)
+		}
+		name.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return name.String()
+}
+
 func exportedIdentifier(name string) string {
 	if strings.EqualFold(name, "id") {
 		return "ID"
@@ -661,6 +1483,31 @@ func exportedIdentifier(name string) string {
 	return strings.Join(parts, "")
 }
 
+// storeField names the Client field holding a model's in-memory store.
+func storeField(model string) string {
+	return lowerIdentifier(model) + "Store"
+}
+
+// linksField names the Client field holding the links of a hidden join model.
+func linksField(model string) string {
+	return lowerIdentifier(strings.TrimPrefix(model, "_")) + "Links"
+}
+
+// loadName names the Client method that loads a model's store or links.
+func loadName(model zenithdb.Model) string {
+	if hiddenModel(model) {
+		return exportedIdentifier(strings.TrimPrefix(model.Name, "_"))
+	}
+	return model.Name
+}
+
+// hiddenModel reports whether model is a join model the parser generated for
+// an implicit many-to-many relation. Generated clients keep its rows in
+// memory to expand the relation but expose no client for it.
+func hiddenModel(model zenithdb.Model) bool {
+	return strings.HasPrefix(model.Name, "_")
+}
+
 func lowerIdentifier(name string) string {
 	exported := exportedIdentifier(name)
 	if exported == "" {
@@ -685,10 +1532,16 @@ func splitIdentifier(name string) []string {
 	return parts
 }
 
-func schemaUsesTime(schema zenithdb.Schema) bool {
+func schemaUsesKind(schema zenithdb.Schema, kind zenithdb.FieldKind) bool {
+	return schemaHasField(schema, func(field zenithdb.Field) bool {
+		return field.Kind == kind
+	})
+}
+
+func schemaHasField(schema zenithdb.Schema, match func(zenithdb.Field) bool) bool {
 	for _, model := range schema.Models {
 		for _, field := range model.Fields {
-			if field.Kind == zenithdb.FieldTime {
+			if match(field) {
 				return true
 			}
 		}
@@ -696,6 +1549,47 @@ func schemaUsesTime(schema zenithdb.Schema) bool {
 	return false
 }
 
+// filledOnCreate reports whether the engine fills field when a create leaves
+// it out.
+func filledOnCreate(field zenithdb.Field) bool {
+	return field.Default != nil || field.UpdatedAt
+}
+
+// defaultLiteral emits value as a *zenithdb.Default.
+// validationsLiteral emits validations as a []zenithdb.Validation literal.
+func validationsLiteral(validations []zenithdb.Validation) string {
+	rules := make([]string, 0, len(validations))
+	for _, validation := range validations {
+		rule := "{Rule: zenithdb.Rule" + exportedIdentifier(string(validation.Rule))
+		switch validation.Rule {
+		case zenithdb.RulePattern:
+			rule += fmt.Sprintf(", Pattern: %q", validation.Pattern)
+		case zenithdb.RuleEmail:
+		default:
+			rule += ", Limit: " + strconv.FormatFloat(validation.Limit, 'g', -1, 64)
+		}
+		rules = append(rules, rule+"}")
+	}
+	return "[]zenithdb.Validation{" + strings.Join(rules, ", ") + "}"
+}
+
+func defaultLiteral(value zenithdb.Default) string {
+	switch value.Func {
+	case "":
+		return fmt.Sprintf("&zenithdb.Default{Value: %q}", value.Value)
+	case zenithdb.DefaultNow:
+		return "&zenithdb.Default{Func: zenithdb.DefaultNow}"
+	case zenithdb.DefaultUUID:
+		return "&zenithdb.Default{Func: zenithdb.DefaultUUID}"
+	case zenithdb.DefaultCUID:
+		return "&zenithdb.Default{Func: zenithdb.DefaultCUID}"
+	case zenithdb.DefaultAutoincrement:
+		return "&zenithdb.Default{Func: zenithdb.DefaultAutoincrement}"
+	default:
+		return fmt.Sprintf("&zenithdb.Default{Func: %q}", value.Func)
+	}
+}
+
 func exportedKind(kind zenithdb.FieldKind) string {
 	switch kind {
 	case zenithdb.FieldString:
@@ -708,6 +1602,12 @@ func exportedKind(kind zenithdb.FieldKind) string {
 		return "FieldFloat"
 	case zenithdb.FieldTime:
 		return "FieldTime"
+	case zenithdb.FieldEnum:
+		return "FieldEnum"
+	case zenithdb.FieldJSON:
+		return "FieldJSON"
+	case zenithdb.FieldBytes:
+		return "FieldBytes"
 	default:
 		return "FieldString"
 	}
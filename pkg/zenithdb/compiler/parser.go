@@ -3,32 +3,66 @@ package compiler
 import (
 	"fmt"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/bypepe77/ZenithDB/pkg/zenithdb"
 )
 
-var relationRE = regexp.MustCompile(`@relation\s*\(\s*fields\s*:\s*\[([^\]]*)\]\s*,\s*references\s*:\s*\[([^\]]*)\]\s*\)`)
+var (
+	relationRE         = regexp.MustCompile(`@relation\s*\(([^)]*)\)`)
+	relationArgumentRE = regexp.MustCompile(`(\w+)\s*:\s*(\[[^\]]*\]|\w+)`)
+	defaultRE          = regexp.MustCompile(`@default\s*\(\s*(\w+\s*\(\s*\)|"(?:[^"\\]|\\.)*"|[^()\s]+)\s*\)`)
+	lengthRE           = regexp.MustCompile(`@length\s*\(([^)]*)\)`)
+	lengthArgumentRE   = regexp.MustCompile(`^(min|max)\s*:\s*(\d+)$`)
+	boundRE            = regexp.MustCompile(`@(min|max)\s*\(\s*([^()\s]+)\s*\)`)
+	patternRE          = regexp.MustCompile(`@pattern\s*\(\s*("(?:[^"\\]|\\.)*")\s*\)`)
+	emailRE            = regexp.MustCompile(`@email\b`)
+)
 
 // ParseSchema parses a focused Prisma-like schema subset into ZenithDB metadata.
 func ParseSchema(source string) (zenithdb.Schema, error) {
 	source = stripComments(source)
-	blocks, err := parseModelBlocks(source)
+	enumBlocks, err := parseBlocks(source, "enum")
+	if err != nil {
+		return zenithdb.Schema{}, err
+	}
+	enums := make([]zenithdb.Enum, 0, len(enumBlocks))
+	for _, block := range enumBlocks {
+		enum, err := parseEnum(block)
+		if err != nil {
+			return zenithdb.Schema{}, err
+		}
+		enums = append(enums, enum)
+	}
+
+	blocks, err := parseBlocks(source, "model")
 	if err != nil {
 		return zenithdb.Schema{}, err
 	}
+	if len(blocks) == 0 {
+		return zenithdb.Schema{}, fmt.Errorf("schema does not define any models")
+	}
 
 	models := make([]zenithdb.Model, 0, len(blocks))
 	for _, block := range blocks {
-		model, err := parseModel(block)
+		model, err := parseModel(block, enums)
 		if err != nil {
 			return zenithdb.Schema{}, err
 		}
 		models = append(models, model)
 	}
 	resolveImplicitRelations(models)
+	models, err = resolveManyToManyRelations(models)
+	if err != nil {
+		return zenithdb.Schema{}, err
+	}
 
 	schema := zenithdb.Schema{Models: models}
+	if len(enums) > 0 {
+		schema.Enums = enums
+	}
 	if err := schema.Validate(); err != nil {
 		return zenithdb.Schema{}, err
 	}
@@ -40,26 +74,32 @@ type modelBlock struct {
 	body string
 }
 
-func parseModelBlocks(source string) ([]modelBlock, error) {
+// parseBlocks returns the blocks source declares with keyword, as in
+// model User { ... } or enum Role { ... }.
+func parseBlocks(source, keyword string) ([]modelBlock, error) {
 	var blocks []modelBlock
 	offset := 0
 	for {
-		idx := strings.Index(source[offset:], "model ")
+		idx := strings.Index(source[offset:], keyword+" ")
 		if idx < 0 {
 			break
 		}
-		start := offset + idx + len("model ")
+		if at := offset + idx; at > 0 && isIdentRune(rune(source[at-1])) {
+			offset = at + len(keyword)
+			continue
+		}
+		start := offset + idx + len(keyword+" ")
 		nameEnd := start
 		for nameEnd < len(source) && isIdentRune(rune(source[nameEnd])) {
 			nameEnd++
 		}
 		if nameEnd == start {
-			return nil, fmt.Errorf("model name is required near byte %d", start)
+			return nil, fmt.Errorf("%s name is required near byte %d", keyword, start)
 		}
 
 		open := strings.IndexByte(source[nameEnd:], '{')
 		if open < 0 {
-			return nil, fmt.Errorf("model %q is missing an opening brace", source[start:nameEnd])
+			return nil, fmt.Errorf("%s %q is missing an opening brace", keyword, source[start:nameEnd])
 		}
 		open += nameEnd
 		close, err := matchingBrace(source, open)
@@ -73,15 +113,26 @@ func parseModelBlocks(source string) ([]modelBlock, error) {
 		})
 		offset = close + 1
 	}
+	return blocks, nil
+}
 
-	if len(blocks) == 0 {
-		return nil, fmt.Errorf("schema does not define any models")
+// parseEnum reads the values of an enum block, one identifier per line.
+func parseEnum(block modelBlock) (zenithdb.Enum, error) {
+	enum := zenithdb.Enum{Name: block.name}
+	// Values are separated by whitespace, so one line may hold several.
+	for _, value := range strings.Fields(block.body) {
+		if strings.IndexFunc(value, func(r rune) bool { return !isIdentRune(r) }) >= 0 {
+			return zenithdb.Enum{}, fmt.Errorf("enum %q has invalid value %q", enum.Name, value)
+		}
+		enum.Values = append(enum.Values, value)
 	}
-	return blocks, nil
+	return enum, nil
 }
 
-func parseModel(block modelBlock) (zenithdb.Model, error) {
+func parseModel(block modelBlock, enums []zenithdb.Enum) (zenithdb.Model, error) {
 	model := zenithdb.Model{Name: block.name}
+	// compound holds the fields of an @@id block attribute.
+	var compound []string
 	lines := strings.Split(block.body, "\n")
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -94,13 +145,30 @@ func parseModel(block modelBlock) (zenithdb.Model, error) {
 			if err != nil {
 				return zenithdb.Model{}, err
 			}
+			indexType, err := parseIndexType(line)
+			if err != nil {
+				return zenithdb.Model{}, err
+			}
 			model.Indexes = append(model.Indexes, zenithdb.Index{
 				Name:   defaultIndexName(model.Name, fields, false),
 				Fields: fields,
+				Type:   indexType,
 			})
 			continue
 		}
 
+		if strings.HasPrefix(line, "@@id") {
+			fields, err := parseBlockAttributeFields(line)
+			if err != nil {
+				return zenithdb.Model{}, err
+			}
+			if compound != nil {
+				return zenithdb.Model{}, fmt.Errorf("model %q defines @@id more than once", model.Name)
+			}
+			compound = fields
+			continue
+		}
+
 		if strings.HasPrefix(line, "@@unique") {
 			fields, err := parseBlockAttributeFields(line)
 			if err != nil {
@@ -114,7 +182,7 @@ func parseModel(block modelBlock) (zenithdb.Model, error) {
 			continue
 		}
 
-		field, relation, err := parseFieldLine(line)
+		field, relation, err := parseFieldLine(line, enums)
 		if err != nil {
 			return zenithdb.Model{}, err
 		}
@@ -136,9 +204,20 @@ func parseModel(block modelBlock) (zenithdb.Model, error) {
 		}
 	}
 
+	if compound != nil {
+		if len(model.PrimaryKey) > 0 {
+			return zenithdb.Model{}, fmt.Errorf("model %q defines both @id and @@id", model.Name)
+		}
+		model.PrimaryKey = compound
+	}
 	if len(model.PrimaryKey) == 0 {
 		model.PrimaryKey = []string{"id"}
 	}
+	for _, name := range model.PrimaryKey {
+		if field, ok := findField(model, name); ok && !field.Required && !field.List {
+			return zenithdb.Model{}, fmt.Errorf("model %q primary key field %q cannot be optional", model.Name, name)
+		}
+	}
 	return model, nil
 }
 
@@ -171,7 +250,144 @@ func resolveImplicitRelations(models []zenithdb.Model) {
 	}
 }
 
-func parseFieldLine(line string) (zenithdb.Field, *zenithdb.Relation, error) {
+// resolveManyToManyRelations resolves the list relations no foreign key backs.
+// One that names its join model with through: maps onto the foreign keys that
+// model holds to both sides. Two lists that point at each other get a hidden
+// join model, named like _PostToTag, whose fields A and B hold the primary
+// keys of the two models in name order; deleting or rekeying either record
+// cascades to the rows that join it.
+func resolveManyToManyRelations(models []zenithdb.Model) ([]zenithdb.Model, error) {
+	modelByName := make(map[string]int, len(models))
+	for i := range models {
+		modelByName[models[i].Name] = i
+	}
+
+	var joins []zenithdb.Model
+	for i := range models {
+		for j := range models[i].Relations {
+			relation := &models[i].Relations[j]
+			if !relation.Many || len(relation.Fields) > 0 || len(relation.References) > 0 {
+				continue
+			}
+			if relation.Through != "" {
+				if err := resolveExplicitJoin(models, modelByName, models[i].Name, relation); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			k, ok := modelByName[relation.Model]
+			if !ok || k == i {
+				continue
+			}
+			for l := range models[k].Relations {
+				back := &models[k].Relations[l]
+				if back.Model != models[i].Name || !back.Many || back.Through != "" || len(back.Fields) > 0 || len(back.References) > 0 {
+					continue
+				}
+				join, err := implicitJoinModel(models[i], models[k])
+				if err != nil {
+					return nil, err
+				}
+				linkThrough(relation, models[i], models[k], join)
+				linkThrough(back, models[k], models[i], join)
+				joins = append(joins, join)
+				break
+			}
+		}
+	}
+	return append(models, joins...), nil
+}
+
+// resolveExplicitJoin maps relation, a list of model, onto the foreign keys
+// its through model holds to model and to the related model.
+func resolveExplicitJoin(models []zenithdb.Model, modelByName map[string]int, model string, relation *zenithdb.Relation) error {
+	i, ok := modelByName[relation.Through]
+	if !ok {
+		return fmt.Errorf("model %q relation %q joins through unknown model %q", model, relation.Name, relation.Through)
+	}
+	join := &models[i]
+	for j, local := range join.Relations {
+		if !local.ForeignKey || local.Model != model {
+			continue
+		}
+		for k, remote := range join.Relations {
+			if k == j || !remote.ForeignKey || remote.Model != relation.Model {
+				continue
+			}
+			relation.Fields = append([]string(nil), local.References...)
+			relation.ThroughFields = append([]string(nil), local.Fields...)
+			relation.References = append([]string(nil), remote.References...)
+			relation.ThroughReferences = append([]string(nil), remote.Fields...)
+			indexJoinFields(join, local.Fields)
+			indexJoinFields(join, remote.Fields)
+			return nil
+		}
+	}
+	return fmt.Errorf("model %q relation %q needs model %q to hold foreign keys to %s and %s", model, relation.Name, join.Name, model, relation.Model)
+}
+
+// indexJoinFields indexes fields, a foreign key of join, unless its primary
+// key or a hash index already covers exactly them, so includes and relation
+// filters read the join records through an index.
+func indexJoinFields(join *zenithdb.Model, fields []string) {
+	if slices.Equal(join.PrimaryKey, fields) {
+		return
+	}
+	for _, index := range join.Indexes {
+		if index.Type != zenithdb.IndexOrdered && slices.Equal(index.Fields, fields) {
+			return
+		}
+	}
+	join.Indexes = append(join.Indexes, zenithdb.Index{Name: defaultIndexName(join.Name, fields, false), Fields: append([]string(nil), fields...)})
+}
+
+// implicitJoinModel returns the hidden join model of a many-to-many relation
+// between left and right.
+func implicitJoinModel(left, right zenithdb.Model) (zenithdb.Model, error) {
+	if right.Name < left.Name {
+		left, right = right, left
+	}
+	name := "_" + left.Name + "To" + right.Name
+	join := zenithdb.Model{Name: name, PrimaryKey: []string{"A", "B"}}
+	for i, side := range []zenithdb.Model{left, right} {
+		field := join.PrimaryKey[i]
+		if len(side.PrimaryKey) != 1 {
+			return zenithdb.Model{}, fmt.Errorf("model %q needs a single-field primary key to join %s and %s", side.Name, left.Name, right.Name)
+		}
+		key, ok := findField(side, side.PrimaryKey[0])
+		if !ok {
+			return zenithdb.Model{}, fmt.Errorf("model %q primary key references unknown field %q", side.Name, side.PrimaryKey[0])
+		}
+		join.Fields = append(join.Fields, zenithdb.Field{Name: field, Kind: key.Kind, Required: true, Enum: key.Enum, Values: key.Values})
+		join.Indexes = append(join.Indexes, zenithdb.Index{Name: defaultIndexName(name, []string{field}, false), Fields: []string{field}})
+		join.Relations = append(join.Relations, zenithdb.Relation{
+			Name:       lowerIdentifier(side.Name),
+			Model:      side.Name,
+			Fields:     []string{field},
+			References: []string{key.Name},
+			ForeignKey: true,
+			OnDelete:   zenithdb.ActionCascade,
+			OnUpdate:   zenithdb.ActionCascade,
+		})
+	}
+	return join, nil
+}
+
+// linkThrough points relation, a list of model that lists the records of
+// related, at the fields of join that hold their primary keys.
+func linkThrough(relation *zenithdb.Relation, model, related, join zenithdb.Model) {
+	local, remote := "A", "B"
+	if join.Relations[0].Model != model.Name {
+		local, remote = "B", "A"
+	}
+	relation.Fields = append([]string(nil), model.PrimaryKey...)
+	relation.References = append([]string(nil), related.PrimaryKey...)
+	relation.Through = join.Name
+	relation.ThroughFields = []string{local}
+	relation.ThroughReferences = []string{remote}
+}
+
+func parseFieldLine(line string, enums []zenithdb.Enum) (zenithdb.Field, *zenithdb.Relation, error) {
 	parts := strings.Fields(line)
 	if len(parts) < 2 {
 		return zenithdb.Field{}, nil, fmt.Errorf("invalid field line %q", line)
@@ -179,20 +395,116 @@ func parseFieldLine(line string) (zenithdb.Field, *zenithdb.Relation, error) {
 
 	name := parts[0]
 	rawType := parts[1]
-	if relation := parseRelation(name, rawType, line); relation != nil {
-		return zenithdb.Field{}, relation, nil
+	// A scalar list such as String[] may be left out of a create, like an
+	// optional field.
+	field := zenithdb.Field{
+		Name:     name,
+		Required: !strings.HasSuffix(rawType, "?") && !strings.HasSuffix(rawType, "[]"),
+	}
+	for _, enum := range enums {
+		switch rawType {
+		case enum.Name, enum.Name + "?":
+			field.Kind = zenithdb.FieldEnum
+			field.Enum = enum.Name
+			field.Values = enum.Values
+		case enum.Name + "[]":
+			return zenithdb.Field{}, nil, fmt.Errorf("unsupported scalar type %q for field %q", rawType, name)
+		}
+	}
+	if field.Kind == "" {
+		if relation := parseRelation(name, rawType, line); relation != nil {
+			return zenithdb.Field{}, relation, nil
+		}
+		field.List = strings.HasSuffix(rawType, "[]")
+		kind, ok := mapFieldKind(strings.TrimSuffix(rawType, "[]"))
+		if !ok {
+			return zenithdb.Field{}, nil, fmt.Errorf("unsupported scalar type %q for field %q", rawType, name)
+		}
+		field.Kind = kind
 	}
 
-	kind, ok := mapFieldKind(rawType)
-	if !ok {
-		return zenithdb.Field{}, nil, fmt.Errorf("unsupported scalar type %q for field %q", rawType, name)
+	if strings.Contains(line, "@default") {
+		matches := defaultRE.FindStringSubmatch(line)
+		if matches == nil {
+			return zenithdb.Field{}, nil, fmt.Errorf("field %q has an invalid @default", name)
+		}
+		value, err := parseDefault(matches[1])
+		if err != nil {
+			return zenithdb.Field{}, nil, fmt.Errorf("field %q has an invalid @default: %w", name, err)
+		}
+		field.Default = value
 	}
+	field.UpdatedAt = strings.Contains(line, "@updatedAt")
+	validations, err := parseValidation(line)
+	if err != nil {
+		return zenithdb.Field{}, nil, fmt.Errorf("field %q %w", name, err)
+	}
+	field.Validations = validations
+	return field, nil, nil
+}
 
-	return zenithdb.Field{
-		Name:     name,
-		Kind:     kind,
-		Required: !strings.HasSuffix(rawType, "?"),
-	}, nil, nil
+// parseValidation parses the validation attributes of a field line into
+// rules: @length(min: 3, max: 20), @min(0), @max(100), @pattern("^[a-z]+$"),
+// and @email.
+func parseValidation(line string) ([]zenithdb.Validation, error) {
+	var validations []zenithdb.Validation
+	if strings.Contains(line, "@length") {
+		matches := lengthRE.FindStringSubmatch(line)
+		if matches == nil {
+			return nil, fmt.Errorf("has an invalid @length")
+		}
+		for _, argument := range strings.Split(matches[1], ",") {
+			parts := lengthArgumentRE.FindStringSubmatch(strings.TrimSpace(argument))
+			if parts == nil {
+				return nil, fmt.Errorf("has an invalid @length argument %q", strings.TrimSpace(argument))
+			}
+			limit, _ := strconv.ParseFloat(parts[2], 64)
+			rule := zenithdb.RuleMinLength
+			if parts[1] == "max" {
+				rule = zenithdb.RuleMaxLength
+			}
+			validations = append(validations, zenithdb.Validation{Rule: rule, Limit: limit})
+		}
+	}
+	for _, matches := range boundRE.FindAllStringSubmatch(line, -1) {
+		limit, err := strconv.ParseFloat(matches[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("has an invalid @%s %q", matches[1], matches[2])
+		}
+		validations = append(validations, zenithdb.Validation{Rule: zenithdb.ValidationRule(matches[1]), Limit: limit})
+	}
+	if strings.Contains(line, "@pattern") {
+		matches := patternRE.FindStringSubmatch(line)
+		if matches == nil {
+			return nil, fmt.Errorf("has an invalid @pattern")
+		}
+		pattern, err := strconv.Unquote(matches[1])
+		if err != nil {
+			return nil, fmt.Errorf("has an invalid @pattern: %w", err)
+		}
+		validations = append(validations, zenithdb.Validation{Rule: zenithdb.RulePattern, Pattern: pattern})
+	}
+	if emailRE.MatchString(line) {
+		validations = append(validations, zenithdb.Validation{Rule: zenithdb.RuleEmail})
+	}
+	return validations, nil
+}
+
+// parseDefault parses the argument of @default: a function call such as
+// now(), a quoted string, or a bare number, boolean, or enum value.
+func parseDefault(argument string) (*zenithdb.Default, error) {
+	if strings.HasSuffix(argument, ")") {
+		function, _, _ := strings.Cut(argument, "(")
+		return &zenithdb.Default{Func: zenithdb.DefaultFunc(strings.TrimSpace(function))}, nil
+	}
+	if strings.HasPrefix(argument, `"`) {
+		value, err := strconv.Unquote(argument)
+		if err != nil {
+			return nil, err
+		}
+		return &zenithdb.Default{Value: value}, nil
+	}
+	return &zenithdb.Default{Value: argument}, nil
 }
 
 func parseRelation(name, rawType, line string) *zenithdb.Relation {
@@ -208,10 +520,23 @@ func parseRelation(name, rawType, line string) *zenithdb.Relation {
 		Many:  strings.HasSuffix(rawType, "[]"),
 	}
 	matches := relationRE.FindStringSubmatch(line)
-	if len(matches) == 3 {
-		relation.Fields = parseList(matches[1])
-		relation.References = parseList(matches[2])
+	if len(matches) != 2 {
+		return relation
 	}
+	arguments := make(map[string]string)
+	for _, argument := range relationArgumentRE.FindAllStringSubmatch(matches[1], -1) {
+		arguments[argument[1]] = argument[2]
+	}
+	fields, hasFields := arguments["fields"]
+	references, hasReferences := arguments["references"]
+	if hasFields && hasReferences {
+		relation.Fields = parseList(strings.Trim(fields, "[]"))
+		relation.References = parseList(strings.Trim(references, "[]"))
+		relation.ForeignKey = true
+	}
+	relation.Through = arguments["through"]
+	relation.OnDelete = zenithdb.ReferentialAction(arguments["onDelete"])
+	relation.OnUpdate = zenithdb.ReferentialAction(arguments["onUpdate"])
 	return relation
 }
 
@@ -224,6 +549,28 @@ func parseBlockAttributeFields(line string) ([]string, error) {
 	return parseList(line[open+1 : close]), nil
 }
 
+// parseIndexType reads the optional type argument that follows the field list,
+// as in @@index([createdAt], type: Ordered).
+func parseIndexType(line string) (zenithdb.IndexType, error) {
+	close := strings.IndexByte(line, ']')
+	arguments := strings.TrimSuffix(strings.TrimSpace(line[close+1:]), ")")
+	for _, argument := range parseList(arguments) {
+		name, value, ok := strings.Cut(argument, ":")
+		if !ok || strings.TrimSpace(name) != "type" {
+			return "", fmt.Errorf("invalid block attribute %q", line)
+		}
+		switch value = strings.TrimSpace(value); value {
+		case string(zenithdb.IndexHash):
+			return "", nil
+		case string(zenithdb.IndexOrdered):
+			return zenithdb.IndexOrdered, nil
+		default:
+			return "", fmt.Errorf("unsupported index type %q in %q", value, line)
+		}
+	}
+	return "", nil
+}
+
 func parseList(value string) []string {
 	parts := strings.Split(value, ",")
 	result := make([]string, 0, len(parts))
@@ -249,6 +596,10 @@ func mapFieldKind(raw string) (zenithdb.FieldKind, bool) {
 		return zenithdb.FieldFloat, true
 	case "DateTime":
 		return zenithdb.FieldTime, true
+	case "Json":
+		return zenithdb.FieldJSON, true
+	case "Bytes":
+		return zenithdb.FieldBytes, true
 	default:
 		return "", false
 	}
@@ -262,16 +613,37 @@ func defaultIndexName(model string, fields []string, unique bool) string {
 	return strings.ToLower(model + "_" + strings.Join(fields, "_") + "_" + kind)
 }
 
+// stripComments cuts every line of source at the // that starts a comment.
+// A // inside a quoted string, such as a URL in @pattern or @default, is
+// kept.
 func stripComments(source string) string {
 	lines := strings.Split(source, "\n")
 	for i, line := range lines {
-		if idx := strings.Index(line, "//"); idx >= 0 {
+		if idx := commentStart(line); idx >= 0 {
 			lines[i] = line[:idx]
 		}
 	}
 	return strings.Join(lines, "\n")
 }
 
+// commentStart returns the index of the // that starts a comment in line,
+// skipping quoted strings and the escapes inside them, or -1 when there is
+// none.
+func commentStart(line string) int {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case quoted && line[i] == '\\':
+			i++
+		case line[i] == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(line[i:], "//"):
+			return i
+		}
+	}
+	return -1
+}
+
 func matchingBrace(source string, open int) (int, error) {
 	depth := 0
 	for i := open; i < len(source); i++ {
@@ -1,8 +1,11 @@
 package compiler
 
 import (
+	"slices"
 	"strings"
 	"testing"
+
+	"github.com/bypepe77/ZenithDB/pkg/zenithdb"
 )
 
 func TestParseSchemaSupportsModelsIndexesAndRelations(t *testing.T) {
@@ -51,11 +54,736 @@ model Post {
 	if len(post.Indexes) != 1 || post.Indexes[0].Fields[0] != "authorId" {
 		t.Fatalf("expected post author index: %+v", post.Indexes)
 	}
-	if len(post.Relations) != 1 || post.Relations[0].Fields[0] != "authorId" {
+	if user.Relations[0].ForeignKey {
+		t.Fatalf("expected the inferred posts relation not to hold a foreign key, got %+v", user.Relations[0])
+	}
+	if len(post.Relations) != 1 || post.Relations[0].Fields[0] != "authorId" || !post.Relations[0].ForeignKey {
 		t.Fatalf("unexpected post relation: %+v", post.Relations)
 	}
 }
 
+func TestParseSchemaSupportsOrderedIndexes(t *testing.T) {
+	schema, err := ParseSchema(`
+model Event {
+  id        String @id
+  kind      String
+  createdAt DateTime
+
+  @@index([kind])
+  @@index([kind, createdAt], type: Ordered)
+}
+`)
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	indexes := schema.Models[0].Indexes
+	if len(indexes) != 2 || indexes[0].Type != "" || indexes[1].Type != zenithdb.IndexOrdered {
+		t.Fatalf("expected hash and ordered indexes: %+v", indexes)
+	}
+
+	code, err := GenerateGoSchema("generated", "AppSchema", schema)
+	if err != nil {
+		t.Fatalf("generate schema: %v", err)
+	}
+	if !strings.Contains(string(code), "Type: zenithdb.IndexOrdered") {
+		t.Fatalf("generated schema does not keep the index type:\n%s", code)
+	}
+
+	if _, err := ParseSchema(`
+model Event {
+  id String @id
+  @@index([id], type: Sorted)
+}
+`); err == nil {
+		t.Fatal("expected unsupported index type to fail")
+	}
+}
+
+func TestParseSchemaSupportsReferentialActions(t *testing.T) {
+	schema, err := ParseSchema(`
+model User {
+  id      String @id
+  email   String @unique
+  posts   Post[]
+  profile Profile?
+}
+
+model Post {
+  id       String @id
+  authorId String
+  author   User @relation(fields: [authorId], references: [id], onDelete: Cascade)
+}
+
+model Profile {
+  id        String @id
+  userEmail String?
+  user      User? @relation(fields: [userEmail], references: [email], onDelete: SetNull, onUpdate: Cascade)
+}
+`)
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	author := schema.Models[1].Relations[0]
+	if author.OnDelete != zenithdb.ActionCascade || author.OnUpdate != "" || !author.ForeignKey {
+		t.Fatalf("unexpected author relation: %+v", author)
+	}
+	user := schema.Models[2].Relations[0]
+	if user.OnDelete != zenithdb.ActionSetNull || user.OnUpdate != zenithdb.ActionCascade || user.References[0] != "email" {
+		t.Fatalf("unexpected profile user relation: %+v", user)
+	}
+
+	code, err := GenerateGoSchema("generated", "AppSchema", schema)
+	if err != nil {
+		t.Fatalf("generate schema: %v", err)
+	}
+	if !strings.Contains(string(code), "OnDelete: zenithdb.ActionSetNull, OnUpdate: zenithdb.ActionCascade") {
+		t.Fatalf("generated schema does not keep the referential actions:\n%s", code)
+	}
+
+	code, err = GenerateGoClient("generated", schema)
+	if err != nil {
+		t.Fatalf("generate client: %v", err)
+	}
+	generated := strings.Join(strings.Fields(string(code)), " ")
+	for _, expected := range []string{
+		"local.OnChange(client.apply)",
+		`case "Post": c.postStore.remove(recordToPost(change.Before))`,
+		`case "Profile": c.profileStore.put(recordToProfile(change.After))`,
+	} {
+		if !strings.Contains(generated, expected) {
+			t.Fatalf("generated client does not apply the changes of referential actions to its stores, missing %q:\n%s", expected, code)
+		}
+	}
+	if strings.Contains(generated, "reload(") {
+		t.Fatalf("generated client reloads whole stores:\n%s", code)
+	}
+
+	for _, relation := range []string{
+		"author User @relation(fields: [authorId], references: [id], onDelete: SetDefault)",
+		"author User @relation(fields: [authorId], references: [id], onDelete: SetNull)",
+	} {
+		if _, err := ParseSchema(`
+model User {
+  id String @id
+}
+
+model Post {
+  id       String @id
+  authorId String
+  ` + relation + `
+}
+`); err == nil {
+			t.Fatalf("expected %q to fail", relation)
+		}
+	}
+}
+
+func TestParseSchemaSupportsManyToManyRelations(t *testing.T) {
+	schema, err := ParseSchema(`
+model Post {
+  id      String @id
+  tags    Tag[]
+  editors User[] @relation(through: Editor)
+}
+
+model Tag {
+  id    Int    @id
+  posts Post[]
+}
+
+model User {
+  id    String @id
+  posts Post[] @relation(through: Editor)
+}
+
+model Editor {
+  id     String @id
+  postId String
+  userId String
+  post   Post @relation(fields: [postId], references: [id])
+  user   User @relation(fields: [userId], references: [id])
+
+  @@index([postId])
+}
+`)
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	if len(schema.Models) != 5 {
+		t.Fatalf("expected a hidden join model after the four declared ones, got %d models", len(schema.Models))
+	}
+	join := schema.Models[4]
+	if join.Name != "_PostToTag" || len(join.PrimaryKey) != 2 || len(join.Indexes) != 2 || len(join.Relations) != 2 {
+		t.Fatalf("unexpected join model: %+v", join)
+	}
+	if join.Fields[0].Kind != zenithdb.FieldString || join.Fields[1].Kind != zenithdb.FieldInt64 {
+		t.Fatalf("expected join fields to take the primary key kinds of Post and Tag: %+v", join.Fields)
+	}
+	for _, relation := range join.Relations {
+		if !relation.ForeignKey || relation.OnDelete != zenithdb.ActionCascade {
+			t.Fatalf("expected join relations to cascade deletes: %+v", relation)
+		}
+	}
+	tags, posts := schema.Models[0].Relations[0], schema.Models[1].Relations[0]
+	if tags.Through != "_PostToTag" || tags.ThroughFields[0] != "A" || tags.ThroughReferences[0] != "B" {
+		t.Fatalf("unexpected tags relation: %+v", tags)
+	}
+	if posts.Through != "_PostToTag" || posts.ThroughFields[0] != "B" || posts.ThroughReferences[0] != "A" {
+		t.Fatalf("unexpected posts relation: %+v", posts)
+	}
+	editors := schema.Models[0].Relations[1]
+	if editors.Through != "Editor" || editors.ThroughFields[0] != "postId" || editors.ThroughReferences[0] != "userId" || editors.References[0] != "id" {
+		t.Fatalf("unexpected explicit editors relation: %+v", editors)
+	}
+	if indexes := schema.Models[3].Indexes; len(indexes) != 2 || indexes[0].Name != "editor_postid_idx" || indexes[1].Name != "editor_userid_idx" {
+		t.Fatalf("expected the explicit join model to index both foreign keys once: %+v", indexes)
+	}
+
+	code, err := GenerateGoClient("generated", schema)
+	if err != nil {
+		t.Fatalf("generate client: %v", err)
+	}
+	generated := strings.Join(strings.Fields(string(code)), " ")
+	for _, expected := range []string{
+		"Tags []Tag",
+		"Posts []Post",
+		"Tags *TagCreateNestedManyInput",
+		"Posts *PostUpdateNestedManyInput",
+		"Tags *TagListRelationFilter",
+		"postToTagLinks *postToTagLinks",
+		`Through: "_PostToTag", ThroughFields: []string{"A"}, ThroughReferences: []string{"B"}`,
+		"keys := c.postToTagLinks.byA[record.ID]",
+		"links := c.editorStore.findManyByPostID(record.ID, 0)",
+		`case "_PostToTag": c.postToTagLinks.remove(change.Before)`,
+		"unlink(l.byA, first, second)",
+	} {
+		if !strings.Contains(generated, expected) {
+			t.Fatalf("generated client missing %q:\n%s", expected, generated)
+		}
+	}
+	if strings.Contains(generated, "_PostToTagClient") {
+		t.Fatalf("generated client exposes the hidden join model:\n%s", generated)
+	}
+
+	if _, err := ParseSchema(`
+model Post {
+  id   String @id
+  tags Tag[] @relation(through: PostTag)
+}
+
+model Tag {
+  id String @id
+}
+`); err == nil {
+		t.Fatal("expected a relation through an unknown model to fail")
+	}
+}
+
+func TestParseSchemaSupportsCompositePrimaryKeys(t *testing.T) {
+	schema, err := ParseSchema(`
+model Tenant {
+  id          String @id
+  memberships Membership[]
+}
+
+model Membership {
+  tenantId String
+  userId   String
+  role     String
+  tenant   Tenant  @relation(fields: [tenantId], references: [id])
+  grants   Grant[]
+
+  @@id([tenantId, userId])
+  @@index([tenantId])
+}
+
+model Grant {
+  id         String @id
+  tenantId   String
+  userId     String
+  membership Membership @relation(fields: [tenantId, userId], references: [tenantId, userId])
+}
+`)
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	membership := schema.Models[1]
+	if len(membership.PrimaryKey) != 2 || membership.PrimaryKey[0] != "tenantId" || membership.PrimaryKey[1] != "userId" {
+		t.Fatalf("unexpected membership primary key: %+v", membership.PrimaryKey)
+	}
+
+	code, err := GenerateGoClient("generated", schema)
+	if err != nil {
+		t.Fatalf("generate client: %v", err)
+	}
+	generated := strings.Join(strings.Fields(string(code)), " ")
+	for _, expected := range []string{
+		"type MembershipTenantIDUserIDKey struct { TenantID string UserID string }",
+		"type MembershipWhereUniqueInput struct { TenantIDUserID MembershipTenantIDUserIDKey }",
+		"func (c MembershipClient) FindUniqueByTenantIDUserID(ctx context.Context, tenantID string, userID string) (Membership, bool, error)",
+		"func (c MembershipClient) FindManyByTenantID(ctx context.Context, value string, limit int) ([]Membership, error)",
+	} {
+		if !strings.Contains(generated, expected) {
+			t.Fatalf("generated client missing %q:\n%s", expected, generated)
+		}
+	}
+
+	for _, model := range []string{
+		"model Membership {\n  tenantId String @id\n  userId String\n\n  @@id([tenantId, userId])\n}",
+		"model Membership {\n  tenantId String\n  userId String\n\n  @@id([tenantId])\n  @@id([userId])\n}",
+		"model Membership {\n  tenantId String\n\n  @@id([tenantId, userId])\n}",
+	} {
+		if _, err := ParseSchema(model); err == nil {
+			t.Fatalf("expected %q to fail", model)
+		}
+	}
+}
+
+func TestGenerateGoClientSupportsCompoundIndexes(t *testing.T) {
+	schema, err := ParseSchema(`
+model Project {
+  id     String @id
+  orgId  String
+  slug   String
+  status String
+
+  @@index([orgId])
+  @@unique([orgId, slug])
+  @@index([orgId, status])
+}
+
+model Membership {
+  tenantId String
+  userId   String
+  grants   Grant[]
+
+  @@id([tenantId, userId])
+}
+
+model Grant {
+  id         String @id
+  tenantId   String
+  userId     String
+  membership Membership @relation(fields: [tenantId, userId], references: [tenantId, userId])
+
+  @@index([tenantId, userId])
+}
+`)
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+
+	code, err := GenerateGoClient("generated", schema)
+	if err != nil {
+		t.Fatalf("generate client: %v", err)
+	}
+	generated := strings.Join(strings.Fields(string(code)), " ")
+	for _, expected := range []string{
+		"type ProjectWhereUniqueInput struct { ID string OrgIDSlug ProjectOrgIDSlugKey }",
+		"byOrgIDSlug map[ProjectOrgIDSlugKey]string",
+		"byOrgIDStatus map[ProjectOrgIDStatusKey][]string",
+		"func (c ProjectClient) FindUniqueByOrgIDSlug(ctx context.Context, orgID string, slug string) (Project, bool, error)",
+		"func (c ProjectClient) FindManyByOrgIDStatus(ctx context.Context, orgID string, status string, limit int) ([]Project, error)",
+		`if input.OrgID != nil && input.Slug != nil { return "project_orgid_slug_uniq" } if input.OrgID != nil && input.Status != nil { return "project_orgid_status_idx" } if input.OrgID != nil { return "project_orgid_idx" }`,
+		"c.grantStore.findManyByTenantIDUserID(GrantTenantIDUserIDKey{TenantID: record.TenantID, UserID: record.UserID}, 0)",
+	} {
+		if !strings.Contains(generated, expected) {
+			t.Fatalf("generated client missing %q:\n%s", expected, generated)
+		}
+	}
+}
+
+func TestParseSchemaSupportsEnums(t *testing.T) {
+	schema, err := ParseSchema(`
+enum Role {
+  ADMIN
+  SUPER_USER
+}
+
+model User {
+  id    String @id
+  role  Role
+  level Role?
+
+  @@index([role])
+}
+`)
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	if len(schema.Enums) != 1 || schema.Enums[0].Name != "Role" || len(schema.Enums[0].Values) != 2 {
+		t.Fatalf("unexpected enums: %+v", schema.Enums)
+	}
+	role, level := schema.Models[0].Fields[1], schema.Models[0].Fields[2]
+	if role.Kind != zenithdb.FieldEnum || role.Enum != "Role" || !role.Required || role.Values[1] != "SUPER_USER" {
+		t.Fatalf("unexpected role field: %+v", role)
+	}
+	if level.Kind != zenithdb.FieldEnum || level.Required {
+		t.Fatalf("unexpected level field: %+v", level)
+	}
+
+	code, err := GenerateGoClient("generated", schema)
+	if err != nil {
+		t.Fatalf("generate client: %v", err)
+	}
+	generated := strings.Join(strings.Fields(string(code)), " ")
+	for _, expected := range []string{
+		`{Name: "role", Kind: zenithdb.FieldEnum, Required: true, Enum: "Role", Values: []string{"ADMIN", "SUPER_USER"}}`,
+		`Enums: []zenithdb.Enum{ {Name: "Role", Values: []string{"ADMIN", "SUPER_USER"}}, }`,
+		"type Role string",
+		`RoleAdmin Role = "ADMIN" RoleSuperUser Role = "SUPER_USER"`,
+		"func (value Role) Valid() bool { switch value { case RoleAdmin, RoleSuperUser: return true",
+		"Role Role `json:\"role\"`",
+		`"role": string(input.Role),`,
+		`if input.Level != nil { record["level"] = string(*input.Level) }`,
+		`Role: Role(recordValue[string](record, "role")),`,
+		"func (c UserClient) FindManyByRole(ctx context.Context, value Role, limit int) ([]User, error)",
+		`zenithdb.Query{Where: map[string]any{"role": string(value)}`,
+	} {
+		if !strings.Contains(generated, expected) {
+			t.Fatalf("generated client missing %q:\n%s", expected, generated)
+		}
+	}
+
+	for _, source := range []string{
+		"enum Role {\n  ADMIN-USER\n}\n\nmodel User {\n  id String @id\n}",
+		"enum Role {\n  ADMIN\n}\n\nmodel User {\n  id String @id\n  roles Role[]\n}",
+		"enum User {\n  ADMIN\n}\n\nmodel User {\n  id String @id\n}",
+	} {
+		if _, err := ParseSchema(source); err == nil {
+			t.Fatalf("expected %q to fail", source)
+		}
+	}
+
+	inline, err := ParseSchema("enum Role { ADMIN USER }\n\nmodel User {\n  id String @id\n  role Role\n}")
+	if err != nil {
+		t.Fatalf("parse single-line enum: %v", err)
+	}
+	if values := inline.Enums[0].Values; !slices.Equal(values, []string{"ADMIN", "USER"}) {
+		t.Fatalf("unexpected single-line enum values: %v", values)
+	}
+}
+
+func TestParseSchemaSupportsDefaults(t *testing.T) {
+	schema, err := ParseSchema(`
+enum Role {
+  ADMIN
+  USER
+}
+
+model User {
+  id        String   @id @default(uuid())
+  number    Int      @default(autoincrement())
+  handle    String   @unique @default(cuid())
+  bio       String   @default("(none) \"quoted\"")
+  score     Float    @default(1.5)
+  active    Boolean  @default(true)
+  role      Role     @default(USER)
+  createdAt DateTime @default(now())
+  name      String
+}
+`)
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	expected := map[string]zenithdb.Default{
+		"id":        {Func: zenithdb.DefaultUUID},
+		"number":    {Func: zenithdb.DefaultAutoincrement},
+		"handle":    {Func: zenithdb.DefaultCUID},
+		"bio":       {Value: `(none) "quoted"`},
+		"score":     {Value: "1.5"},
+		"active":    {Value: "true"},
+		"role":      {Value: "USER"},
+		"createdAt": {Func: zenithdb.DefaultNow},
+	}
+	for _, field := range schema.Models[0].Fields {
+		want, ok := expected[field.Name]
+		if !ok {
+			if field.Default != nil {
+				t.Fatalf("field %q should have no default, got %+v", field.Name, field.Default)
+			}
+			continue
+		}
+		if field.Default == nil || *field.Default != want {
+			t.Fatalf("field %q: expected default %+v, got %+v", field.Name, want, field.Default)
+		}
+	}
+	if len(schema.Models[0].Indexes) != 1 || schema.Models[0].PrimaryKey[0] != "id" {
+		t.Fatalf("expected @default to keep @id and @unique, got %+v", schema.Models[0])
+	}
+
+	code, err := GenerateGoClient("generated", schema)
+	if err != nil {
+		t.Fatalf("generate client: %v", err)
+	}
+	generated := strings.Join(strings.Fields(string(code)), " ")
+	for _, expected := range []string{
+		`{Name: "id", Kind: zenithdb.FieldString, Required: true, Default: &zenithdb.Default{Func: zenithdb.DefaultUUID}}`,
+		`{Name: "role", Kind: zenithdb.FieldEnum, Required: true, Enum: "Role", Values: []string{"ADMIN", "USER"}, Default: &zenithdb.Default{Value: "USER"}}`,
+		`{Name: "bio", Kind: zenithdb.FieldString, Required: true, Default: &zenithdb.Default{Value: "(none) \"quoted\""}}`,
+		"type UserCreateInput struct { ID *string Number *int64 Handle *string Bio *string Score *float64 Active *bool Role *Role CreatedAt *time.Time Name string }",
+		`record := zenithdb.Record{ "name": input.Name, } if input.ID != nil { record["id"] = *input.ID }`,
+		`if input.Role != nil { record["role"] = string(*input.Role) }`,
+		`created, err := c.client.db.Create(ctx, "User", input.record())`,
+		`record := recordToUser(created.Record)`,
+	} {
+		if !strings.Contains(generated, expected) {
+			t.Fatalf("generated client missing %q:\n%s", expected, generated)
+		}
+	}
+
+	for _, source := range []string{
+		"model User {\n  id String @id @default(autoincrement())\n}",
+		"model User {\n  id String @id\n  count Int @default(many)\n}",
+		"model User {\n  id String @id @default()\n}",
+		"enum Role {\n  ADMIN\n}\n\nmodel User {\n  id String @id\n  role Role @default(OWNER)\n}",
+	} {
+		if _, err := ParseSchema(source); err == nil {
+			t.Fatalf("expected %q to fail", source)
+		}
+	}
+}
+
+func TestParseSchemaSupportsUpdatedAt(t *testing.T) {
+	schema, err := ParseSchema(`
+model Note {
+  id        String   @id
+  createdAt DateTime @default(now())
+  updatedAt DateTime @updatedAt
+}
+`)
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	createdAt, updatedAt := schema.Models[0].Fields[1], schema.Models[0].Fields[2]
+	if createdAt.UpdatedAt || !updatedAt.UpdatedAt || updatedAt.Default != nil {
+		t.Fatalf("unexpected timestamp fields: %+v %+v", createdAt, updatedAt)
+	}
+
+	code, err := GenerateGoClient("generated", schema)
+	if err != nil {
+		t.Fatalf("generate client: %v", err)
+	}
+	generated := strings.Join(strings.Fields(string(code)), " ")
+	for _, expected := range []string{
+		`{Name: "updatedAt", Kind: zenithdb.FieldTime, Required: true, UpdatedAt: true}`,
+		"type NoteCreateInput struct { ID string CreatedAt *time.Time UpdatedAt *time.Time }",
+		`if input.UpdatedAt != nil { record["updatedAt"] = *input.UpdatedAt }`,
+	} {
+		if !strings.Contains(generated, expected) {
+			t.Fatalf("generated client missing %q:\n%s", expected, generated)
+		}
+	}
+
+	if _, err := ParseSchema("model Note {\n  id String @id\n  version Int @updatedAt\n}"); err == nil {
+		t.Fatal("expected @updatedAt on an Int field to fail")
+	}
+}
+
+func TestParseSchemaSupportsJSONAndBytes(t *testing.T) {
+	schema, err := ParseSchema(`
+model Asset {
+  id     String @id
+  meta   Json?
+  digest Bytes  @unique
+  tags   Json   @default("[]")
+}
+`)
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	fields := schema.Models[0].Fields
+	if fields[1].Kind != zenithdb.FieldJSON || fields[1].Required || fields[2].Kind != zenithdb.FieldBytes || fields[3].Default == nil || fields[3].Default.Value != "[]" {
+		t.Fatalf("unexpected json and bytes fields: %+v", fields)
+	}
+
+	code, err := GenerateGoClient("generated", schema)
+	if err != nil {
+		t.Fatalf("generate client: %v", err)
+	}
+	generated := strings.Join(strings.Fields(string(code)), " ")
+	for _, expected := range []string{
+		`"encoding/json"`,
+		`{Name: "meta", Kind: zenithdb.FieldJSON, Required: false}`,
+		`{Name: "digest", Kind: zenithdb.FieldBytes, Required: true}`,
+		"type AssetCreateInput struct { ID string Meta json.RawMessage Digest []byte Tags *json.RawMessage }",
+		`Meta: recordJSON(record, "meta"),`,
+		`Digest: recordValue[[]byte](record, "digest"),`,
+	} {
+		if !strings.Contains(generated, expected) {
+			t.Fatalf("generated client missing %q:\n%s", expected, generated)
+		}
+	}
+	// The store cannot key a map by bytes, so the unique digest gets no
+	// lookup of its own.
+	if strings.Contains(generated, "byDigest") {
+		t.Fatalf("expected no store index over bytes:\n%s", generated)
+	}
+}
+
+func TestParseSchemaSupportsScalarLists(t *testing.T) {
+	schema, err := ParseSchema(`
+model Article {
+  id     String   @id
+  tags   String[]
+  scores Int[]
+
+  @@index([tags])
+}
+`)
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	fields := schema.Models[0].Fields
+	if !fields[1].List || fields[1].Kind != zenithdb.FieldString || fields[1].Required || !fields[2].List || fields[2].Kind != zenithdb.FieldInt64 {
+		t.Fatalf("unexpected list fields: %+v", fields)
+	}
+
+	code, err := GenerateGoClient("generated", schema)
+	if err != nil {
+		t.Fatalf("generate client: %v", err)
+	}
+	generated := strings.Join(strings.Fields(string(code)), " ")
+	for _, expected := range []string{
+		`{Name: "tags", Kind: zenithdb.FieldString, Required: false, List: true}`,
+		"type ArticleCreateInput struct { ID string Tags []string Scores []int64 }",
+		"type ArticleUpdateInput struct { Tags *ListUpdate[string] Scores *ListUpdate[int64] }",
+		`record["tags"] = zenithdb.ListUpdate{Set: anyList(input.Tags.Set), Push: anyList(input.Tags.Push)}`,
+		`"scores": anyList(input.Scores),`,
+		`Scores: recordList[int64](record, "scores"),`,
+	} {
+		if !strings.Contains(generated, expected) {
+			t.Fatalf("generated client missing %q:\n%s", expected, generated)
+		}
+	}
+	if strings.Contains(generated, "byTags") {
+		t.Fatalf("expected no store index over a list:\n%s", generated)
+	}
+
+	if _, err := ParseSchema("model Doc {\n  id String[] @id\n}\n"); err == nil || !strings.Contains(err.Error(), "cannot be a list") {
+		t.Fatalf("expected a list primary key to fail, got %v", err)
+	}
+}
+
+func TestGenerateGoClientUsesPointersForOptionalFields(t *testing.T) {
+	schema, err := ParseSchema(`
+model User {
+  id       String    @id
+  email    String    @unique
+  profiles Profile[]
+}
+
+model Profile {
+  id        String  @id
+  userEmail String?
+  bio       String?
+  user      User?   @relation(fields: [userEmail], references: [email])
+
+  @@index([userEmail])
+}
+`)
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+
+	code, err := GenerateGoClient("generated", schema)
+	if err != nil {
+		t.Fatalf("generate client: %v", err)
+	}
+	generated := strings.Join(strings.Fields(string(code)), " ")
+	for _, expected := range []string{
+		"type Profile struct { ID string `json:\"id\"` UserEmail *string `json:\"userEmail\"` Bio *string `json:\"bio\"`",
+		"type ProfileUpdateInput struct { UserEmail *Nullable[string] Bio *Nullable[string]",
+		`if input.Bio != nil { record["bio"] = *input.Bio }`,
+		`if input.Bio != nil { record["bio"] = nil if input.Bio.Value != nil { record["bio"] = *input.Bio.Value } }`,
+		`Bio: recordPointer[string](record, "bio"),`,
+		"if record.UserEmail != nil { s.byUserEmail[*record.UserEmail] = append(s.byUserEmail[*record.UserEmail], record.ID) }",
+		"if include.User && record.UserEmail != nil { related, ok := c.userStore.findByEmail(*record.UserEmail)",
+	} {
+		if !strings.Contains(generated, expected) {
+			t.Fatalf("generated client missing %q:\n%s", expected, generated)
+		}
+	}
+
+	if _, err := ParseSchema("model Doc {\n  id String? @id\n}\n"); err == nil || !strings.Contains(err.Error(), "cannot be optional") {
+		t.Fatalf("expected an optional primary key to fail, got %v", err)
+	}
+}
+
+func TestParseSchemaSupportsValidationAttributes(t *testing.T) {
+	schema, err := ParseSchema(`
+model User {
+  id     String  @id
+  email  String  @unique @email
+  handle String? @length(min: 3, max: 12) @pattern("^[a-z0-9_]+$")
+  age    Int?    @min(13) @max(130)
+}
+`)
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	fields := schema.Models[0].Fields
+	if len(fields[1].Validations) != 1 || fields[1].Validations[0].Rule != zenithdb.RuleEmail {
+		t.Fatalf("unexpected email validations: %+v", fields[1].Validations)
+	}
+	handle := []zenithdb.Validation{{Rule: zenithdb.RuleMinLength, Limit: 3}, {Rule: zenithdb.RuleMaxLength, Limit: 12}, {Rule: zenithdb.RulePattern, Pattern: "^[a-z0-9_]+$"}}
+	if !slices.Equal(fields[2].Validations, handle) {
+		t.Fatalf("unexpected handle validations: %+v", fields[2].Validations)
+	}
+	if len(fields[3].Validations) != 2 || fields[3].Validations[0] != (zenithdb.Validation{Rule: zenithdb.RuleMin, Limit: 13}) {
+		t.Fatalf("unexpected age validations: %+v", fields[3].Validations)
+	}
+
+	code, err := GenerateGoClient("generated", schema)
+	if err != nil {
+		t.Fatalf("generate client: %v", err)
+	}
+	generated := strings.Join(strings.Fields(string(code)), " ")
+	for _, expected := range []string{
+		`{Name: "age", Kind: zenithdb.FieldInt64, Required: false, Validations: []zenithdb.Validation{{Rule: zenithdb.RuleMin, Limit: 13}, {Rule: zenithdb.RuleMax, Limit: 130}}}`,
+		`{Rule: zenithdb.RulePattern, Pattern: "^[a-z0-9_]+$"}`,
+		`func (input UserCreateInput) Validate() error { if err := Schema.ValidateValue("User", "email", input.Email); err != nil { return err }`,
+		`if input.Handle != nil && input.Handle.Value != nil { if err := Schema.ValidateValue("User", "handle", *input.Handle.Value); err != nil { return err } }`,
+	} {
+		if !strings.Contains(generated, expected) {
+			t.Fatalf("generated client missing %q:\n%s", expected, generated)
+		}
+	}
+
+	for source, expected := range map[string]string{
+		"model Doc {\n  id String @id\n  size Int @length(min: 1)\n}\n":      "cannot have the minLength rule",
+		"model Doc {\n  id String @id\n  name String @length(least: 1)\n}\n": "invalid @length argument",
+		"model Doc {\n  id String @id\n  name String @pattern(\"[\")\n}\n":   "invalid pattern",
+	} {
+		if _, err := ParseSchema(source); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %q for %q, got %v", expected, source, err)
+		}
+	}
+}
+
+func TestParseSchemaKeepsSlashesInsideStrings(t *testing.T) {
+	schema, err := ParseSchema(`
+model Link {
+  id   String @id // the slug
+  url  String @pattern("^https?://") // absolute URLs only
+  home String @default("http://x") @pattern("\"//")
+}
+`)
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	fields := schema.Models[0].Fields
+	if len(fields[1].Validations) != 1 || fields[1].Validations[0].Pattern != "^https?://" {
+		t.Fatalf("unexpected url validations: %+v", fields[1].Validations)
+	}
+	if fields[2].Default == nil || fields[2].Default.Value != "http://x" {
+		t.Fatalf("unexpected home default: %+v", fields[2].Default)
+	}
+	if len(fields[2].Validations) != 1 || fields[2].Validations[0].Pattern != `"//` {
+		t.Fatalf("unexpected home validations: %+v", fields[2].Validations)
+	}
+}
+
 func TestGenerateGoSchema(t *testing.T) {
 	schema, err := ParseSchema(`
 model User {
@@ -101,7 +829,8 @@ model Post {
 	if err != nil {
 		t.Fatalf("generate client: %v", err)
 	}
-	generated := string(code)
+	// gofmt aligns struct fields, so compare against whitespace-collapsed source.
+	generated := strings.Join(strings.Fields(string(code)), " ")
 	for _, expected := range []string{
 		"type Client struct",
 		"remote bool",
@@ -126,18 +855,56 @@ model Post {
 		"func (c UserClient) Delete",
 		"func (c UserClient) DeleteMany",
 		"Filters map[string]zenithdb.Filter",
+		"AND []PostWhereInput",
+		"NOT *PostWhereInput",
+		"func (input PostWhereInput) filterExpr() *zenithdb.FilterExpr",
+		"FilterExpr: args.Where.filterExpr()",
+		"Posts *PostListRelationFilter",
+		"Author *UserRelationFilter",
+		"type PostListRelationFilter struct { Some *PostWhereInput Every *PostWhereInput None *PostWhereInput }",
+		"type UserRelationFilter struct { Is *UserWhereInput IsNot *UserWhereInput }",
+		`zenithdb.FilterExpr{Relation: "author", RelationFilter: input.Author.filter()}`,
 		"OrderBy []zenithdb.OrderBy",
 		"Cursor PostWhereUniqueInput",
 		"Skip int",
 		"func (c PostClient) Count",
+		"type UserSelect struct { ID bool Email bool Name bool Posts bool }",
+		"Select *UserSelect",
+		"func (input *UserSelect) fields() []string",
+		"Select: args.Select.fields()",
+		`recordValue[string](record, "email")`,
+		"type PostAggregateArgs struct",
+		"type PostGroupByArgs struct",
+		"func (c PostClient) Aggregate(ctx context.Context, args PostAggregateArgs) (zenithdb.AggregateResult, error)",
+		"func (c PostClient) GroupBy(ctx context.Context, args PostGroupByArgs) ([]zenithdb.Group, error)",
+		"func (c PostClient) Iterate(ctx context.Context, args PostFindManyArgs) iter.Seq2[Post, error]",
 		"func (c *Client) Batch",
+		"func (c *Client) Transaction(ctx context.Context, fn func(tx *Tx) error) error",
+		"type UserTxClient struct",
+		"func (c PostTxClient) FindMany",
 		"type userStore struct",
 		"func newUserStore() *userStore",
 		"func (s *userStore) remove",
 		"func (s *userStore) replace",
 		"func (s *postStore) findManyByAuthorID",
+		"Posts *PostCreateNestedManyInput",
+		"Posts *PostUpdateNestedManyInput",
+		"Author *UserUpdateNestedOneInput",
+		"type PostUpdateNestedManyInput struct",
+		`record["posts"] = input.Posts.write()`,
+		"func (input UserCreateInput) nested() bool",
 		"func (c *Client) includeUser",
 		"record.Posts = c.postStore.findManyByAuthorID(record.ID, 0)",
+		"PostsArgs *PostFindManyArgs",
+		"AuthorArgs *UserIncludeArgs",
+		"type UserIncludeArgs struct",
+		`include["posts"] = zenithdb.Include{Query: input.PostsArgs.query()}`,
+		"func (input *UserInclude) narrowed() bool",
+		"func (args PostFindManyArgs) query() zenithdb.Query",
+		"RelationCount *UserRelationCount `json:\"_count\"`",
+		"RelationCountArgs *UserRelationCountSelect",
+		"include[zenithdb.CountField] = zenithdb.Include{Query: zenithdb.Query{Select: input.RelationCountArgs.fields()}}",
+		`Posts: recordValue[int64](raw, "posts"),`,
 	} {
 		if !strings.Contains(generated, expected) {
 			t.Fatalf("generated client missing %q:\n%s", expected, generated)
@@ -0,0 +1,144 @@
+package zenithdb
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// withDefaults returns record holding the default of every field it leaves
+// out, and the time of the write in the @updatedAt fields it leaves out.
+// record is returned as is when it leaves out none.
+func (t *table) withDefaults(record Record) (Record, error) {
+	filled := record
+	copied := false
+	for _, field := range t.model.Fields {
+		if field.Default == nil {
+			continue
+		}
+		if _, ok := record[field.Name]; ok {
+			continue
+		}
+		value, err := t.defaultValue(field)
+		if err != nil {
+			return nil, fmt.Errorf("model %q field %q default: %w", t.model.Name, field.Name, err)
+		}
+		if !copied {
+			filled = cloneRecord(record)
+			copied = true
+		}
+		filled[field.Name] = value
+	}
+	return t.withUpdatedAt(filled), nil
+}
+
+// withUpdatedAt returns patch holding the time of the write in the
+// @updatedAt fields it leaves out.
+func (t *table) withUpdatedAt(patch Record) Record {
+	stamped := patch
+	copied := false
+	for _, field := range t.model.Fields {
+		if !field.UpdatedAt {
+			continue
+		}
+		if _, ok := patch[field.Name]; ok {
+			continue
+		}
+		if !copied {
+			stamped = cloneRecord(patch)
+			copied = true
+		}
+		stamped[field.Name] = t.clock()
+	}
+	return stamped
+}
+
+// defaultValue returns the value the default of field gives a new record.
+// An autoincrement value only advances the sequence once the record is
+// inserted.
+func (t *table) defaultValue(field Field) (any, error) {
+	switch field.Default.Func {
+	case DefaultNow:
+		return t.clock(), nil
+	case DefaultUUID:
+		return newUUID(), nil
+	case DefaultCUID:
+		return newCUID(t.clock()), nil
+	case DefaultAutoincrement:
+		return t.autoincrement + 1, nil
+	default:
+		return literalValue(field, field.Default.Value)
+	}
+}
+
+// literalValue parses literal, a default value written as in a schema file,
+// as a value of field.
+func literalValue(field Field, literal string) (any, error) {
+	var value any = literal
+	var err error
+	switch field.Kind {
+	case FieldInt64:
+		value, err = strconv.ParseInt(literal, 10, 64)
+	case FieldFloat:
+		value, err = strconv.ParseFloat(literal, 64)
+	case FieldBool:
+		value, err = strconv.ParseBool(literal)
+	case FieldJSON:
+		value = json.RawMessage(literal)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s literal %q", field.Kind, literal)
+	}
+	return normalizeValue(field, value)
+}
+
+func isAutoincrement(field Field) bool {
+	return field.Default != nil && field.Default.Func == DefaultAutoincrement
+}
+
+// autoincrementField returns the field of model that defaults to
+// autoincrement(). A model has at most one.
+func autoincrementField(model Model) (string, bool) {
+	for _, field := range model.Fields {
+		if isAutoincrement(field) {
+			return field.Name, true
+		}
+	}
+	return "", false
+}
+
+func newUUID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+var cuidCounter atomic.Uint64
+
+// newCUID returns a 25 character ID: the letter c, then now in
+// milliseconds, a process-wide counter, and random digits, all in base 36.
+func newCUID(now time.Time) string {
+	var random [8]byte
+	_, _ = rand.Read(random[:])
+	return "c" +
+		base36(uint64(now.UnixMilli()), 8) +
+		base36(cuidCounter.Add(1), 4) +
+		base36(binary.BigEndian.Uint64(random[:]), 12)
+}
+
+// base36 formats value in base 36 as exactly width digits, keeping the
+// least significant ones.
+func base36(value uint64, width int) string {
+	digits := strconv.FormatUint(value, 36)
+	if len(digits) >= width {
+		return digits[len(digits)-width:]
+	}
+	return strings.Repeat("0", width-len(digits)) + digits
+}
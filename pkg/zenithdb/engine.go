@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"iter"
 	"os"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // ErrNotFound is returned when a mutation targets a missing record.
@@ -20,16 +24,33 @@ type Options struct {
 	WALPath       string
 	SyncPolicy    SyncPolicy
 	WALFormat     WALFormat
+	// Clock returns the time that now() defaults and @updatedAt fields
+	// record. It defaults to time.Now.
+	Clock func() time.Time
 }
 
-// DB is the ZenithDB in-process engine.
+// DB is the ZenithDB in-process engine. Writers are serialized by mu and
+// publish a new immutable snapshot after each commit; readers load the current
+// snapshot and never wait for writers.
 type DB struct {
-	mu     sync.RWMutex
-	schema Schema
-	tables map[string]*table
-	wal    *WAL
-	storage *storageManager
+	mu       sync.Mutex
+	schema   Schema
+	clock    func() time.Time
+	current  atomic.Pointer[snapshot]
+	wal      *WAL
+	storage  *storageManager
 	sequence uint64
+	// watchers receive the changes of every write published after they
+	// registered.
+	watchers []func([]Change)
+}
+
+// snapshot is one published state of every table, as of the WAL sequence
+// that produced it. It is never modified; writers publish a replacement, and
+// the old state is garbage-collected once no reader references it.
+type snapshot struct {
+	sequence uint64
+	tables   tableSet
 }
 
 // Open creates an in-memory database and optionally replays its WAL.
@@ -46,13 +67,11 @@ func Open(ctx context.Context, schema Schema, options Options) (*DB, error) {
 		return nil, fmt.Errorf("remote connection URL requires a remote client")
 	}
 
-	db := &DB{
-		schema: schema,
-		tables: make(map[string]*table, len(schema.Models)),
-	}
-	for _, model := range schema.Models {
-		db.tables[model.Name] = newTable(model)
+	if options.Clock == nil {
+		options.Clock = time.Now
 	}
+	db := &DB{schema: schema, clock: options.Clock}
+	db.current.Store(&snapshot{tables: newTables(schema, db.clock)})
 
 	if options.SyncPolicy == 0 {
 		options.SyncPolicy = SyncAlways
@@ -92,7 +111,7 @@ func Open(ctx context.Context, schema Schema, options Options) (*DB, error) {
 			return nil, err
 		}
 		if db.sequence < storage.manifest.LastSequence {
-			db.sequence = storage.manifest.LastSequence
+			db.publishLocked(storage.manifest.LastSequence, nil)
 		}
 		return db, nil
 	}
@@ -140,20 +159,32 @@ func (db *DB) Close() error {
 	return errors.Join(walErr, storageErr)
 }
 
+// OnChange registers fn to receive the changes of every write published from
+// now on, in commit order: single writes, batches, and committed
+// transactions, along with the records their nested writes and referential
+// actions changed. fn runs before the write returns, while it still holds the
+// writer lock, so it must not write to db. LoadSnapshot replaces every table
+// without reporting changes.
+func (db *DB) OnChange(fn func(changes []Change)) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.watchers = append(db.watchers, fn)
+}
+
 // Checkpoint writes an atomic snapshot for faster future recovery.
 func (db *DB) Checkpoint(ctx context.Context) error {
 	if db.storage == nil {
 		return fmt.Errorf("checkpoint requires Options.DataDir")
 	}
 
-	db.mu.RLock()
-	sequence := db.sequence
-	db.mu.RUnlock()
-
-	if err := db.Snapshot(ctx, db.storage.checkpointPath()); err != nil {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	current := db.current.Load()
+	if err := writeSnapshot(current, db.storage.checkpointPath()); err != nil {
 		return err
 	}
-	return db.storage.saveCheckpointManifest(ctx, sequence)
+	return db.storage.saveCheckpointManifest(ctx, current.sequence)
 }
 
 // Create inserts one record.
@@ -164,29 +195,15 @@ func (db *DB) Create(ctx context.Context, model string, record Record) (Mutation
 
 	db.mu.Lock()
 	defer db.mu.Unlock()
-
-	table, err := db.table(model)
+	results, err := db.batchLocked(ctx, []BatchOperation{{Type: BatchCreate, Model: model, Record: record}})
 	if err != nil {
 		return MutationResult{}, err
 	}
-
-	normalized, key, err := table.prepareInsert(record)
-	if err != nil {
-		return MutationResult{}, err
-	}
-	sequence := db.nextSequenceLocked()
-	if db.wal != nil {
-		if err := db.wal.Append(ctx, operation{Sequence: sequence, Type: opCreate, Model: model, Record: normalized}); err != nil {
-			db.sequence--
-			return MutationResult{}, err
-		}
-	}
-
-	table.insertPrepared(normalized, key)
-	return MutationResult{Model: model, Key: key}, nil
+	return MutationResult{Model: model, Key: results[0].Key, Record: results[0].Record}, nil
 }
 
-// Update patches one record addressed by its primary key.
+// Update patches one record addressed by its primary key, and applies the
+// OnUpdate actions of the relations that reference the fields it changes.
 func (db *DB) Update(ctx context.Context, model string, where map[string]any, patch Record) (Record, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -194,29 +211,15 @@ func (db *DB) Update(ctx context.Context, model string, where map[string]any, pa
 
 	db.mu.Lock()
 	defer db.mu.Unlock()
-
-	table, err := db.table(model)
-	if err != nil {
-		return nil, err
-	}
-
-	primaryKey, next, err := table.prepareUpdate(where, patch)
+	results, err := db.batchLocked(ctx, []BatchOperation{{Type: BatchUpdate, Model: model, Where: where, Record: patch}})
 	if err != nil {
 		return nil, err
 	}
-	sequence := db.nextSequenceLocked()
-	if db.wal != nil {
-		if err := db.wal.Append(ctx, operation{Sequence: sequence, Type: opUpdate, Model: model, Where: where, Record: cloneRecord(patch)}); err != nil {
-			db.sequence--
-			return nil, err
-		}
-	}
-
-	table.updatePrepared(primaryKey, next)
-	return cloneRecord(next), nil
+	return results[0].Record, nil
 }
 
-// Delete removes one record addressed by its primary key.
+// Delete removes one record addressed by its primary key, and applies the
+// OnDelete actions of the relations that reference it.
 func (db *DB) Delete(ctx context.Context, model string, where map[string]any) (Record, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -224,26 +227,11 @@ func (db *DB) Delete(ctx context.Context, model string, where map[string]any) (R
 
 	db.mu.Lock()
 	defer db.mu.Unlock()
-
-	table, err := db.table(model)
+	results, err := db.batchLocked(ctx, []BatchOperation{{Type: BatchDelete, Model: model, Where: where}})
 	if err != nil {
 		return nil, err
 	}
-
-	primaryKey, record, err := table.prepareDelete(where)
-	if err != nil {
-		return nil, err
-	}
-	sequence := db.nextSequenceLocked()
-	if db.wal != nil {
-		if err := db.wal.Append(ctx, operation{Sequence: sequence, Type: opDelete, Model: model, Where: where}); err != nil {
-			db.sequence--
-			return nil, err
-		}
-	}
-
-	table.deletePrepared(primaryKey)
-	return cloneRecord(record), nil
+	return results[0].Record, nil
 }
 
 // Upsert updates a record selected by a unique lookup or inserts createRecord.
@@ -255,24 +243,16 @@ func (db *DB) Upsert(ctx context.Context, model string, where map[string]any, cr
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	nextTables := db.cloneTablesLocked()
-	table, ok := nextTables[model]
-	if !ok {
-		return nil, false, fmt.Errorf("unknown model %q", model)
-	}
-
-	next, created, err := db.prepareUpsertLocked(table, where, createRecord, updatePatch)
+	forks := newTableForks(db.current.Load().tables)
+	sequence := db.sequence + 1
+	applied, next, created, err := prepareUpsert(forks, model, where, createRecord, updatePatch, sequence)
 	if err != nil {
 		return nil, false, err
 	}
-	sequence := db.nextSequenceLocked()
-	if db.wal != nil {
-		if err := db.wal.Append(ctx, operation{Sequence: sequence, Type: opUpsert, Model: model, Where: cloneMap(where), Record: cloneRecord(createRecord), Patch: cloneRecord(updatePatch)}); err != nil {
-			db.sequence--
-			return nil, false, err
-		}
+	if err := db.appendLocked(ctx, sequence, applied); err != nil {
+		return nil, false, err
 	}
-	db.tables = nextTables
+	db.publishLocked(sequence, forks.forked)
 	return next, created, nil
 }
 
@@ -302,7 +282,7 @@ func (db *DB) CreateMany(ctx context.Context, model string, records []Record) ([
 	}
 	mutations := make([]MutationResult, 0, len(results))
 	for _, result := range results {
-		mutations = append(mutations, MutationResult{Model: result.Model, Key: result.Key})
+		mutations = append(mutations, MutationResult{Model: result.Model, Key: result.Key, Record: result.Record})
 	}
 	return mutations, nil
 }
@@ -314,7 +294,7 @@ func (db *DB) UpdateMany(ctx context.Context, model string, query Query, patch R
 
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	table, err := db.table(model)
+	table, query, err := db.current.Load().tables.prepareQuery(model, query)
 	if err != nil {
 		return ManyResult{}, err
 	}
@@ -343,7 +323,7 @@ func (db *DB) DeleteMany(ctx context.Context, model string, query Query) (ManyRe
 
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	table, err := db.table(model)
+	table, query, err := db.current.Load().tables.prepareQuery(model, query)
 	if err != nil {
 		return ManyResult{}, err
 	}
@@ -369,53 +349,102 @@ func (db *DB) batchLocked(ctx context.Context, operations []BatchOperation) ([]B
 	if len(operations) == 0 {
 		return nil, nil
 	}
-	nextTables := db.cloneTablesLocked()
+	sequence := db.sequence + 1
+	forks := newTableForks(db.current.Load().tables)
 	walOperations := make([]operation, 0, len(operations))
 	results := make([]BatchResult, 0, len(operations))
 	for _, batchOperation := range operations {
-		walOperation, result, err := applyBatchOperation(nextTables, batchOperation)
+		applied, result, err := applyBatchOperation(forks, batchOperation, sequence)
 		if err != nil {
 			return nil, err
 		}
-		walOperations = append(walOperations, walOperation)
+		walOperations = append(walOperations, applied...)
 		results = append(results, result)
 	}
 
-	sequence := db.nextSequenceLocked()
-	if db.wal != nil {
-		if err := db.wal.Append(ctx, operation{Sequence: sequence, Type: opBatch, Operations: walOperations}); err != nil {
-			db.sequence--
-			return nil, err
+	if err := db.appendLocked(ctx, sequence, walOperations); err != nil {
+		return nil, err
+	}
+	db.publishLocked(sequence, forks.forked)
+	return results, nil
+}
+
+// commitLocked applies operations, the WAL operations of writes already
+// resolved elsewhere, and logs and publishes them as one write.
+func (db *DB) commitLocked(ctx context.Context, operations []operation) error {
+	sequence := db.sequence + 1
+	forks := newTableForks(db.current.Load().tables)
+	if err := replayOperations(forks, operations, sequence); err != nil {
+		return err
+	}
+	if err := db.appendLocked(ctx, sequence, operations); err != nil {
+		return err
+	}
+	db.publishLocked(sequence, forks.forked)
+	return nil
+}
+
+// replayOperations applies WAL operations to forks in order. Each one holds
+// the values its write generated, and the writes its nested writes and
+// referential actions made follow as operations of their own, so a replay
+// stores what the first application stored.
+func replayOperations(forks *tableForks, operations []operation, sequence uint64) error {
+	for _, child := range operations {
+		if _, _, err := applyBatchOperation(forks, BatchOperation{
+			Type:   BatchOperationType(child.Type),
+			Model:  child.Model,
+			Where:  child.Where,
+			Record: child.Record,
+		}, sequence); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	db.tables = nextTables
-	return results, nil
+// appendLocked logs the operations of one write as a single WAL entry: the
+// operation itself when there is only one, and a batch otherwise.
+func (db *DB) appendLocked(ctx context.Context, sequence uint64, operations []operation) error {
+	if db.wal == nil {
+		return nil
+	}
+	entry := operation{Sequence: sequence, Type: opBatch, Operations: operations}
+	if len(operations) == 1 {
+		entry = operations[0]
+		entry.Sequence = sequence
+	}
+	return db.wal.Append(ctx, entry)
 }
 
-// FindUnique returns one record by primary key or unique index.
-func (db *DB) FindUnique(ctx context.Context, model string, where map[string]any, include map[string]Include) (Record, bool, error) {
+// FindUnique returns one record by primary key or unique index. A non-empty
+// selected names the fields and relations the record holds, as Query.Select
+// does.
+func (db *DB) FindUnique(ctx context.Context, model string, where map[string]any, include map[string]Include, selected []string) (Record, bool, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, false, err
 	}
 
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-
-	table, err := db.table(model)
+	current := db.current.Load()
+	table, err := current.tables.table(model)
+	if err != nil {
+		return nil, false, err
+	}
+	fields, err := projection(table.model, Query{Include: include, Select: selected})
 	if err != nil {
 		return nil, false, err
 	}
 
-	record, ok, err := db.findUniqueLocked(table, where)
+	record, ok, err := table.findUnique(where, fields)
 	if err != nil || !ok {
 		return record, ok, err
 	}
+	include = selectIncludes(table.model, selected, include)
 	if len(include) > 0 {
-		if err := db.expandIncludesLocked(model, record, include); err != nil {
+		if err := current.tables.expandIncludes(model, record, include); err != nil {
 			return nil, false, err
 		}
 	}
+	trimRecord(record, selected, include)
 	return record, true, nil
 }
 
@@ -425,10 +454,8 @@ func (db *DB) FindMany(ctx context.Context, model string, query Query) ([]Record
 		return nil, err
 	}
 
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-
-	table, err := db.table(model)
+	current := db.current.Load()
+	table, query, err := current.tables.prepareQuery(model, query)
 	if err != nil {
 		return nil, err
 	}
@@ -437,105 +464,350 @@ func (db *DB) FindMany(ctx context.Context, model string, query Query) ([]Record
 	if err != nil {
 		return nil, err
 	}
-	if len(query.Include) > 0 {
-		for i := range records {
-			if err := db.expandIncludesLocked(model, records[i], query.Include); err != nil {
+	include := selectIncludes(table.model, query.Select, query.Include)
+	for _, record := range records {
+		if len(include) > 0 {
+			if err := current.tables.expandIncludes(model, record, include); err != nil {
 				return nil, err
 			}
 		}
+		trimRecord(record, query.Select, include)
 	}
 	return records, nil
 }
 
-// Count returns the number of records matching Where and Filters.
+// Iterate returns the records query selects as a sequence that reads them
+// one at a time from the snapshot current when iteration starts, so a result
+// never has to fit in memory. An OrderBy that no ordered index serves still
+// sorts the matching records before the first one is yielded. When the query
+// fails or ctx ends, the sequence yields the error and stops.
+func (db *DB) Iterate(ctx context.Context, model string, query Query) iter.Seq2[Record, error] {
+	return func(yield func(Record, error) bool) {
+		if err := ctx.Err(); err != nil {
+			yield(nil, err)
+			return
+		}
+
+		current := db.current.Load()
+		table, query, err := current.tables.prepareQuery(model, query)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		include := selectIncludes(table.model, query.Select, query.Include)
+		var failed error
+		stopped := false
+		err = table.iterate(query, func(record Record) bool {
+			if failed = ctx.Err(); failed != nil {
+				return false
+			}
+			if len(include) > 0 {
+				if failed = current.tables.expandIncludes(model, record, include); failed != nil {
+					return false
+				}
+			}
+			trimRecord(record, query.Select, include)
+			stopped = !yield(record, nil)
+			return !stopped
+		})
+		if err == nil {
+			err = failed
+		}
+		if err != nil && !stopped {
+			yield(nil, err)
+		}
+	}
+}
+
+// Count returns the number of records matching query.
 func (db *DB) Count(ctx context.Context, model string, query Query) (int, error) {
 	if err := ctx.Err(); err != nil {
 		return 0, err
 	}
 
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-
-	table, err := db.table(model)
+	table, query, err := db.current.Load().tables.prepareQuery(model, query)
 	if err != nil {
 		return 0, err
 	}
 	return table.count(query)
 }
 
+// Explain returns the plan FindMany would use for query, with its estimated
+// row count, without reading any records.
+func (db *DB) Explain(ctx context.Context, model string, query Query) (Plan, error) {
+	if err := ctx.Err(); err != nil {
+		return Plan{}, err
+	}
+
+	table, query, err := db.current.Load().tables.prepareQuery(model, query)
+	if err != nil {
+		return Plan{}, err
+	}
+	return table.explain(query)
+}
+
+// Aggregate computes counts, sums, averages, minimums, and maximums over the
+// records query selects.
+func (db *DB) Aggregate(ctx context.Context, model string, query AggregateQuery) (AggregateResult, error) {
+	if err := ctx.Err(); err != nil {
+		return AggregateResult{}, err
+	}
+
+	table, selection, err := db.current.Load().tables.prepareQuery(model, query.Query)
+	if err != nil {
+		return AggregateResult{}, err
+	}
+	query.Query = selection
+	return table.aggregate(query)
+}
+
+// GroupBy groups the records query selects by its By fields and returns the
+// aggregates of every group that passes Having.
+func (db *DB) GroupBy(ctx context.Context, model string, query GroupByQuery) ([]Group, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	table, selection, err := db.current.Load().tables.prepareQuery(model, query.Query)
+	if err != nil {
+		return nil, err
+	}
+	query.Query = selection
+	return table.groupBy(query)
+}
+
 func (db *DB) table(model string) (*table, error) {
-	table, ok := db.tables[model]
+	return db.current.Load().tables.table(model)
+}
+
+// publishLocked makes changed, merged over the current tables, the state new
+// readers observe, as of sequence.
+func (db *DB) publishLocked(sequence uint64, changed tableSet) {
+	current := db.current.Load()
+	var changes []Change
+	if len(db.watchers) > 0 {
+		changes = changesBetween(db.schema, current.tables, changed)
+	}
+	tables := make(tableSet, len(current.tables))
+	for name, table := range current.tables {
+		tables[name] = table
+	}
+	for name, table := range changed {
+		table.written = nil
+		tables[name] = table
+	}
+	db.sequence = sequence
+	db.current.Store(&snapshot{sequence: sequence, tables: tables})
+	if len(changes) > 0 {
+		for _, watch := range db.watchers {
+			watch(changes)
+		}
+	}
+}
+
+// changesBetween returns the records the forks in changed wrote, as they are
+// in before and in the forks, by model in schema order and by primary key. A
+// record created and deleted by the same write is left out.
+func changesBetween(schema Schema, before tableSet, changed tableSet) []Change {
+	var changes []Change
+	for _, model := range schema.Models {
+		table, ok := changed[model.Name]
+		if !ok || len(table.written) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(table.written))
+		for key := range table.written {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			change := Change{Model: model.Name, Key: key}
+			if previous, ok := before[model.Name].rows.get(key); ok {
+				change.Before = cloneRecord(previous.record)
+			}
+			if next, ok := table.rows.get(key); ok {
+				change.After = cloneRecord(next.record)
+			}
+			if change.Before != nil || change.After != nil {
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes
+}
+
+// tableSet maps model names to their tables. Relation traversal resolves
+// related models through the same set, so reads stay within one view.
+type tableSet map[string]*table
+
+func (tables tableSet) table(model string) (*table, error) {
+	table, ok := tables[model]
 	if !ok {
 		return nil, fmt.Errorf("unknown model %q", model)
 	}
 	return table, nil
 }
 
-func (db *DB) cloneTablesLocked() map[string]*table {
-	cloned := make(map[string]*table, len(db.tables))
-	for name, table := range db.tables {
-		cloned[name] = table.clone()
+// tableForks forks tables the first time a multi-operation write touches
+// them, so the cost of publishing the write depends on the records it
+// changes, not on the size of the database. All forks share one edit token:
+// paths already copied by an earlier operation are updated in place.
+type tableForks struct {
+	base   tableSet
+	forked tableSet
+	edit   *editToken
+}
+
+func newTableForks(base tableSet) *tableForks {
+	return &tableForks{base: base, forked: make(tableSet), edit: new(editToken)}
+}
+
+func (forks *tableForks) table(model string) (*table, error) {
+	if table, ok := forks.forked[model]; ok {
+		return table, nil
 	}
-	return cloned
+	table, err := forks.base.table(model)
+	if err != nil {
+		return nil, err
+	}
+	forked := table.fork(forks.edit)
+	forks.forked[model] = forked
+	return forked, nil
 }
 
-func applyBatchOperation(tables map[string]*table, batchOperation BatchOperation) (operation, BatchResult, error) {
-	table, ok := tables[batchOperation.Model]
-	if !ok {
-		return operation{}, BatchResult{}, fmt.Errorf("unknown model %q", batchOperation.Model)
+// lookup returns model's table as the write has left it so far, without
+// forking a table the write only reads.
+func (forks *tableForks) lookup(model string) (*table, error) {
+	if table, ok := forks.forked[model]; ok {
+		return table, nil
 	}
+	return forks.base.table(model)
+}
 
+// applyBatchOperation applies one operation to forks along with the
+// referential actions it triggers. It returns the WAL operations that replay
+// them: a delete comes after the deletes and updates it cascaded to, which
+// leave nothing for it to cascade to again, and an update comes before the
+// updates it cascaded to, which it repeats unchanged.
+func applyBatchOperation(forks *tableForks, batchOperation BatchOperation, sequence uint64) ([]operation, BatchResult, error) {
+	table, err := forks.table(batchOperation.Model)
+	if err != nil {
+		return nil, BatchResult{}, err
+	}
 	switch batchOperation.Type {
 	case BatchCreate:
-		normalized, key, err := table.prepareInsert(batchOperation.Record)
+		fields, nested, err := splitNestedWrites(forks, table.model, batchOperation.Record, true)
+		if err != nil {
+			return nil, BatchResult{}, err
+		}
+		applied, err := applyOwnedWrites(forks, nested, fields, nil, sequence)
+		if err != nil {
+			return nil, BatchResult{}, err
+		}
+		normalized, key, err := table.prepareInsert(fields)
+		if err != nil {
+			return nil, BatchResult{}, err
+		}
+		if err := checkReferences(forks, table, key, normalized); err != nil {
+			return nil, BatchResult{}, err
+		}
+		table.insertPrepared(normalized, key, sequence)
+		applied = append(applied, operation{Type: opCreate, Model: batchOperation.Model, Record: normalized})
+		related, err := applyRelatedWrites(forks, nested, normalized, nil, sequence)
 		if err != nil {
-			return operation{}, BatchResult{}, err
+			return nil, BatchResult{}, err
 		}
-		table.insertPrepared(normalized, key)
-		return operation{Type: opCreate, Model: batchOperation.Model, Record: normalized}, BatchResult{Type: batchOperation.Type, Model: batchOperation.Model, Key: key, Record: cloneRecord(normalized)}, nil
+		applied = append(applied, related...)
+		return applied, BatchResult{Type: batchOperation.Type, Model: batchOperation.Model, Key: key, Record: cloneRecord(normalized)}, nil
 	case BatchUpdate:
-		primaryKey, next, err := table.prepareUpdate(batchOperation.Where, batchOperation.Record)
+		patch, nested, err := splitNestedWrites(forks, table.model, batchOperation.Record, false)
 		if err != nil {
-			return operation{}, BatchResult{}, err
+			return nil, BatchResult{}, err
+		}
+		var applied []operation
+		var stored Record
+		if len(nested) > 0 {
+			found, ok, err := table.findByPrimaryKey(batchOperation.Where, nil)
+			if err != nil {
+				return nil, BatchResult{}, err
+			}
+			if !ok {
+				return nil, BatchResult{}, ErrNotFound
+			}
+			stored = found
+			if applied, err = applyOwnedWrites(forks, nested, patch, stored, sequence); err != nil {
+				return nil, BatchResult{}, err
+			}
 		}
-		table.updatePrepared(primaryKey, next)
-		return operation{Type: opUpdate, Model: batchOperation.Model, Where: cloneMap(batchOperation.Where), Record: cloneRecord(batchOperation.Record)}, BatchResult{Type: batchOperation.Type, Model: batchOperation.Model, Key: primaryKey, Record: cloneRecord(next)}, nil
+		primaryKey, patch, next, err := table.prepareUpdate(batchOperation.Where, patch)
+		if err != nil {
+			return nil, BatchResult{}, err
+		}
+		if err := checkReferences(forks, table, primaryKey, next); err != nil {
+			return nil, BatchResult{}, err
+		}
+		current, _ := table.rows.get(primaryKey)
+		table.updatePrepared(primaryKey, next, sequence)
+		cascaded, err := applyReferentialActions(forks, table, current.record, next, sequence)
+		if err != nil {
+			return nil, BatchResult{}, err
+		}
+		applied = append(applied, operation{Type: opUpdate, Model: batchOperation.Model, Where: cloneMap(batchOperation.Where), Record: cloneRecord(patch)})
+		applied = append(applied, cascaded...)
+		related, err := applyRelatedWrites(forks, nested, next, stored, sequence)
+		if err != nil {
+			return nil, BatchResult{}, err
+		}
+		applied = append(applied, related...)
+		return applied, BatchResult{Type: batchOperation.Type, Model: batchOperation.Model, Key: primaryKey, Record: cloneRecord(next)}, nil
 	case BatchDelete:
 		primaryKey, record, err := table.prepareDelete(batchOperation.Where)
 		if err != nil {
-			return operation{}, BatchResult{}, err
+			return nil, BatchResult{}, err
+		}
+		if err := checkReferences(forks, table, primaryKey, nil); err != nil {
+			return nil, BatchResult{}, err
+		}
+		table.deletePrepared(primaryKey, sequence)
+		cascaded, err := applyReferentialActions(forks, table, record, nil, sequence)
+		if err != nil {
+			return nil, BatchResult{}, err
 		}
-		table.deletePrepared(primaryKey)
-		return operation{Type: opDelete, Model: batchOperation.Model, Where: cloneMap(batchOperation.Where)}, BatchResult{Type: batchOperation.Type, Model: batchOperation.Model, Key: primaryKey, Record: cloneRecord(record)}, nil
+		applied := append(cascaded, operation{Type: opDelete, Model: batchOperation.Model, Where: cloneMap(batchOperation.Where)})
+		return applied, BatchResult{Type: batchOperation.Type, Model: batchOperation.Model, Key: primaryKey, Record: cloneRecord(record)}, nil
 	default:
-		return operation{}, BatchResult{}, fmt.Errorf("unsupported batch operation %q", batchOperation.Type)
+		return nil, BatchResult{}, fmt.Errorf("unsupported batch operation %q", batchOperation.Type)
 	}
 }
 
-func (db *DB) prepareUpsertLocked(table *table, where map[string]any, createRecord Record, updatePatch Record) (Record, bool, error) {
-	found, ok, err := db.findUniqueLocked(table, where)
+// prepareUpsert applies an upsert to forks, returning the WAL operations of
+// the create or update it turned into along with the record it wrote.
+func prepareUpsert(forks *tableForks, model string, where map[string]any, createRecord Record, updatePatch Record, sequence uint64) ([]operation, Record, bool, error) {
+	table, err := forks.table(model)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, err
+	}
+	found, ok, err := table.findUnique(where, nil)
+	if err != nil {
+		return nil, nil, false, err
 	}
 	if !ok {
-		normalized, key, err := table.prepareInsert(createRecord)
+		applied, result, err := applyBatchOperation(forks, BatchOperation{Type: BatchCreate, Model: model, Record: createRecord}, sequence)
 		if err != nil {
-			return nil, false, err
+			return nil, nil, false, err
 		}
-		table.insertPrepared(normalized, key)
-		return cloneRecord(normalized), true, nil
+		return applied, result.Record, true, nil
 	}
 
 	primaryWhere, err := primaryWhereFromRecord(table.model, found)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, err
 	}
-	primaryKey, next, err := table.prepareUpdate(primaryWhere, updatePatch)
+	applied, result, err := applyBatchOperation(forks, BatchOperation{Type: BatchUpdate, Model: model, Where: primaryWhere, Record: updatePatch}, sequence)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, err
 	}
-	table.updatePrepared(primaryKey, next)
-	return cloneRecord(next), false, nil
+	return applied, result.Record, false, nil
 }
 
 func primaryWhereFromRecord(model Model, record Record) (map[string]any, error) {
@@ -561,35 +833,27 @@ func cloneMap(values map[string]any) map[string]any {
 	return cloned
 }
 
-func (db *DB) findUniqueLocked(table *table, where map[string]any) (Record, bool, error) {
-	normalizedWhere, err := normalizePartial(table.model, where)
-	if err != nil {
-		return nil, false, err
+// decodeOperationBytes decodes the Bytes values of a WAL operation, and of
+// the operations it batches, as decodeBytes does.
+func decodeOperationBytes(tables tableSet, operation operation) error {
+	if operation.Type == opBatch {
+		for _, child := range operation.Operations {
+			if err := decodeOperationBytes(tables, child); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-
-	if containsAll(normalizedWhere, table.model.PrimaryKey) {
-		return table.findByPrimaryKey(normalizedWhere)
+	table, err := tables.table(operation.Model)
+	if err != nil {
+		return err
 	}
-
-	for _, index := range table.indexes {
-		if !index.definition.Unique || !containsAll(normalizedWhere, index.definition.Fields) {
-			continue
-		}
-		ids, err := index.lookup(normalizedWhere, 1)
-		if err != nil {
-			return nil, false, err
-		}
-		if len(ids) == 0 {
-			return nil, false, nil
-		}
-		record, ok := table.rows[ids[0]]
-		if !ok {
-			return nil, false, nil
+	for _, values := range []map[string]any{operation.Where, operation.Record, operation.Patch} {
+		if err := decodeBytes(table.model, values); err != nil {
+			return err
 		}
-		return cloneRecord(record), true, nil
 	}
-
-	return nil, false, fmt.Errorf("model %q has no unique lookup for fields %v", table.model.Name, where)
+	return nil
 }
 
 func (db *DB) applyOperation(operation operation) error {
@@ -599,62 +863,40 @@ func (db *DB) applyOperation(operation operation) error {
 }
 
 func (db *DB) applyOperationLocked(operation operation) error {
-	if operation.Sequence > db.sequence {
-		db.sequence = operation.Sequence
+	sequence := db.sequence
+	if operation.Sequence > sequence {
+		sequence = operation.Sequence
 	}
 
+	if err := decodeOperationBytes(db.current.Load().tables, operation); err != nil {
+		return err
+	}
+	forks := newTableForks(db.current.Load().tables)
 	switch operation.Type {
-	case opCreate:
-		table, err := db.table(operation.Model)
-		if err != nil {
-			return err
+	case opCreate, opUpdate, opDelete:
+		_, _, err := applyBatchOperation(forks, BatchOperation{
+			Type:   BatchOperationType(operation.Type),
+			Model:  operation.Model,
+			Where:  operation.Where,
+			Record: operation.Record,
+		}, sequence)
+		if operation.Type == opDelete && errors.Is(err, ErrNotFound) {
+			err = nil
 		}
-		_, err = table.insert(operation.Record)
-		return err
-	case opUpdate:
-		table, err := db.table(operation.Model)
 		if err != nil {
 			return err
 		}
-		_, _, err = table.update(operation.Where, operation.Record)
-		return err
-	case opDelete:
-		table, err := db.table(operation.Model)
-		if err != nil {
-			return err
-		}
-		_, _, err = table.delete(operation.Where)
-		if errors.Is(err, ErrNotFound) {
-			return nil
-		}
-		return err
 	case opUpsert:
-		table, err := db.table(operation.Model)
-		if err != nil {
+		if _, _, _, err := prepareUpsert(forks, operation.Model, operation.Where, operation.Record, operation.Patch, sequence); err != nil {
 			return err
 		}
-		_, _, err = db.prepareUpsertLocked(table, operation.Where, operation.Record, operation.Patch)
-		return err
 	case opBatch:
-		nextTables := db.cloneTablesLocked()
-		for _, child := range operation.Operations {
-			if _, _, err := applyBatchOperation(nextTables, BatchOperation{
-				Type:   BatchOperationType(child.Type),
-				Model:  child.Model,
-				Where:  child.Where,
-				Record: child.Record,
-			}); err != nil {
-				return err
-			}
+		if err := replayOperations(forks, operation.Operations, sequence); err != nil {
+			return err
 		}
-		db.tables = nextTables
-		return nil
 	default:
 		return fmt.Errorf("unknown wal operation %q", operation.Type)
 	}
-}
-
-func (db *DB) nextSequenceLocked() uint64 {
-	db.sequence++
-	return db.sequence
+	db.publishLocked(sequence, forks.forked)
+	return nil
 }
@@ -1,9 +1,18 @@
 package zenithdb
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateFindUniqueAndFindManyByIndex(t *testing.T) {
@@ -19,7 +28,7 @@ func TestCreateFindUniqueAndFindManyByIndex(t *testing.T) {
 		t.Fatalf("create user: %v", err)
 	}
 
-	user, ok, err := db.FindUnique(ctx, "User", map[string]any{"email": "ada@example.com"}, nil)
+	user, ok, err := db.FindUnique(ctx, "User", map[string]any{"email": "ada@example.com"}, nil, nil)
 	if err != nil {
 		t.Fatalf("find unique: %v", err)
 	}
@@ -61,91 +70,2641 @@ func TestIncludeManyRelationUsesForeignKeyIndex(t *testing.T) {
 
 	user, ok, err := db.FindUnique(ctx, "User", map[string]any{"id": "u1"}, map[string]Include{
 		"posts": {},
+	}, nil)
+	if err != nil {
+		t.Fatalf("find with include: %v", err)
+	}
+	if !ok {
+		t.Fatal("expected user")
+	}
+
+	posts, ok := user["posts"].([]Record)
+	if !ok {
+		t.Fatalf("expected posts relation, got %T", user["posts"])
+	}
+	if len(posts) != 2 {
+		t.Fatalf("expected two posts, got %d", len(posts))
+	}
+}
+
+func TestIncludeQueriesNarrowAndNestRelations(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	for _, record := range []Record{
+		{"id": "u1", "email": "ada@example.com", "name": "Ada"},
+		{"id": "u2", "email": "grace@example.com", "name": "Grace"},
+	} {
+		if _, err := db.Create(ctx, "User", record); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	for _, record := range []Record{
+		{"id": "p1", "authorId": "u1", "title": "First"},
+		{"id": "p2", "authorId": "u1", "title": "Second"},
+		{"id": "p3", "authorId": "u1", "title": "Third"},
+		{"id": "p4", "authorId": "u2", "title": "Fourth"},
+	} {
+		if _, err := db.Create(ctx, "Post", record); err != nil {
+			t.Fatalf("create post: %v", err)
+		}
+	}
+
+	user, _, err := db.FindUnique(ctx, "User", map[string]any{"id": "u1"}, map[string]Include{"posts": {Query: Query{
+		Filters: map[string]Filter{"title": {Contains: "i"}},
+		OrderBy: []OrderBy{{Field: "title", Direction: SortDesc}},
+		Limit:   1,
+		Select:  []string{"title"},
+		Include: map[string]Include{"author": {Query: Query{Select: []string{"email"}, Include: map[string]Include{"posts": {Limit: 1}}}}},
+	}}}, nil)
+	if err != nil {
+		t.Fatalf("find with include query: %v", err)
+	}
+	posts := user["posts"].([]Record)
+	if len(posts) != 1 || posts[0]["title"] != "Third" || len(posts[0]) != 2 {
+		t.Fatalf("expected only the title of Third, got %+v", posts)
+	}
+	author := posts[0]["author"].(Record)
+	if len(author) != 2 || author["email"] != "ada@example.com" || len(author["posts"].([]Record)) != 1 {
+		t.Fatalf("expected the nested author with one post, got %+v", author)
+	}
+
+	// The relation's own key still applies when the where names another.
+	user, _, err = db.FindUnique(ctx, "User", map[string]any{"id": "u1"}, map[string]Include{"posts": {Query: Query{Where: map[string]any{"authorId": "u2"}}}}, nil)
+	if err != nil || len(user["posts"].([]Record)) != 0 {
+		t.Fatalf("expected a where on another author to include no posts, got %+v err=%v", user, err)
+	}
+	if _, err := db.FindMany(ctx, "Post", Query{Include: map[string]Include{"author": {Limit: 1}}}); err == nil {
+		t.Fatal("expected a to-one include with a limit to fail")
+	}
+	if _, err := db.FindMany(ctx, "Post", Query{Include: map[string]Include{"author": {Query: Query{Include: map[string]Include{"missing": {}}}}}}); err == nil {
+		t.Fatal("expected a nested include of an unknown relation to fail")
+	}
+}
+
+func TestRelationCountsSelectAndOrderRecords(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	for _, record := range []Record{
+		{"id": "u1", "email": "ada@example.com", "name": "Ada"},
+		{"id": "u2", "email": "grace@example.com", "name": "Grace"},
+		{"id": "u3", "email": "hopper@example.com", "name": "Hopper"},
+	} {
+		if _, err := db.Create(ctx, "User", record); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	for _, record := range []Record{
+		{"id": "p1", "authorId": "u2", "title": "First"},
+		{"id": "p2", "authorId": "u2", "title": "Second"},
+		{"id": "p3", "authorId": "u3", "title": "Third"},
+	} {
+		if _, err := db.Create(ctx, "Post", record); err != nil {
+			t.Fatalf("create post: %v", err)
+		}
+	}
+
+	users, err := db.FindMany(ctx, "User", Query{
+		OrderBy: []OrderBy{{Count: "posts", Direction: SortDesc}},
+		Select:  []string{"name", CountField},
+	})
+	if err != nil {
+		t.Fatalf("find users by post count: %v", err)
+	}
+	var names []string
+	for _, user := range users {
+		names = append(names, user["name"].(string)+"="+fmt.Sprint(user[CountField].(Record)["posts"]))
+		if len(user) != 2 {
+			t.Fatalf("expected only the name and counts, got %+v", user)
+		}
+	}
+	if got := strings.Join(names, ","); got != "Grace=2,Hopper=1,Ada=0" {
+		t.Fatalf("unexpected users by post count: %s", got)
+	}
+
+	user, _, err := db.FindUnique(ctx, "User", map[string]any{"id": "u2"}, map[string]Include{CountField: {Query: Query{Select: []string{"posts"}}}}, nil)
+	if err != nil || user[CountField].(Record)["posts"] != int64(2) {
+		t.Fatalf("expected two posts counted, got %+v err=%v", user, err)
+	}
+	if _, err := db.FindMany(ctx, "Post", Query{Include: map[string]Include{CountField: {Query: Query{Select: []string{"author"}}}}}); err == nil {
+		t.Fatal("expected counting a to-one relation to fail")
+	}
+	if _, err := db.FindMany(ctx, "User", Query{OrderBy: []OrderBy{{Field: "name", Count: "posts"}}}); err == nil {
+		t.Fatal("expected an order by both a field and a count to fail")
+	}
+}
+
+func TestFindManySupportsFiltersOrderAndPagination(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	_, err := db.Create(ctx, "User", Record{"id": "u1", "email": "ada@example.com", "name": "Ada"})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	for _, post := range []Record{
+		{"id": "p1", "authorId": "u1", "title": "Alpha"},
+		{"id": "p2", "authorId": "u1", "title": "Beta"},
+		{"id": "p3", "authorId": "u1", "title": "Gamma"},
+	} {
+		if _, err := db.Create(ctx, "Post", post); err != nil {
+			t.Fatalf("create post: %v", err)
+		}
+	}
+
+	posts, err := db.FindMany(ctx, "Post", Query{
+		Where: map[string]any{"authorId": "u1"},
+		Filters: map[string]Filter{
+			"title": {In: []any{"Alpha", "Gamma"}},
+		},
+		OrderBy: []OrderBy{{Field: "title", Direction: SortDesc}},
+		Skip:    1,
+		Limit:   1,
+	})
+	if err != nil {
+		t.Fatalf("find many: %v", err)
+	}
+	if len(posts) != 1 || posts[0]["title"] != "Alpha" {
+		t.Fatalf("unexpected ordered page: %+v", posts)
+	}
+	nextPosts, err := db.FindMany(ctx, "Post", Query{
+		Where:   map[string]any{"authorId": "u1"},
+		OrderBy: []OrderBy{{Field: "title", Direction: SortAsc}},
+		Cursor:  map[string]any{"id": "p1"},
+		Limit:   1,
+	})
+	if err != nil {
+		t.Fatalf("find many cursor: %v", err)
+	}
+	if len(nextPosts) != 1 || nextPosts[0]["title"] != "Beta" {
+		t.Fatalf("unexpected cursor page: %+v", nextPosts)
+	}
+	count, err := db.Count(ctx, "Post", Query{
+		Where: map[string]any{"authorId": "u1"},
+		Filters: map[string]Filter{
+			"title": {Contains: "a"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("expected count 3, got %d", count)
+	}
+
+	contains, err := db.FindMany(ctx, "Post", Query{
+		Filters: map[string]Filter{
+			"title": {Contains: "amm"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("find many contains: %v", err)
+	}
+	if len(contains) != 1 || contains[0]["title"] != "Gamma" {
+		t.Fatalf("unexpected contains result: %+v", contains)
+	}
+}
+
+func TestOrderedIndexServesRangesOrderAndLimit(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{{
+		Name: "Event",
+		Fields: []Field{
+			{Name: "id", Kind: FieldString, Required: true},
+			{Name: "kind", Kind: FieldString, Required: true},
+			{Name: "at", Kind: FieldTime, Required: true},
+			{Name: "score", Kind: FieldFloat},
+		},
+		PrimaryKey: []string{"id"},
+		Indexes: []Index{
+			{Name: "event_kind_at", Fields: []string{"kind", "at"}, Type: IndexOrdered},
+			{Name: "event_score", Fields: []string{"score"}, Type: IndexOrdered},
+		},
+	}}}
+	db, err := Open(ctx, schema, Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	scores := []float64{-2.5, 10, -100, 0, 3.25, 7}
+	for i, score := range scores {
+		kind := "click"
+		if i%2 == 1 {
+			kind = "view"
+		}
+		record := Record{"id": fmt.Sprintf("e%d", i), "kind": kind, "at": base.Add(time.Duration(i) * time.Hour), "score": score}
+		if _, err := db.Create(ctx, "Event", record); err != nil {
+			t.Fatalf("create event: %v", err)
+		}
+	}
+	if _, err := db.Create(ctx, "Event", Record{"id": "e-null", "kind": "click", "at": base.Add(-time.Hour)}); err != nil {
+		t.Fatalf("create event without score: %v", err)
+	}
+	if _, err := db.Update(ctx, "Event", map[string]any{"id": "e1"}, Record{"score": 1.5}); err != nil {
+		t.Fatalf("update event: %v", err)
+	}
+
+	ids := func(records []Record) []string {
+		result := make([]string, 0, len(records))
+		for _, record := range records {
+			result = append(result, record["id"].(string))
+		}
+		return result
+	}
+
+	ranged, err := db.FindMany(ctx, "Event", Query{
+		Filters: map[string]Filter{"score": {GT: -3.0, LTE: 7.0}},
+		OrderBy: []OrderBy{{Field: "score"}},
+	})
+	if err != nil {
+		t.Fatalf("find range: %v", err)
+	}
+	if got := fmt.Sprint(ids(ranged)); got != "[e0 e3 e1 e4 e5]" {
+		t.Fatalf("unexpected range order: %s", got)
+	}
+
+	latestClicks, err := db.FindMany(ctx, "Event", Query{
+		Where:   map[string]any{"kind": "click"},
+		OrderBy: []OrderBy{{Field: "at", Direction: SortDesc}},
+		Skip:    1,
+		Limit:   2,
+	})
+	if err != nil {
+		t.Fatalf("find ordered page: %v", err)
+	}
+	if got := fmt.Sprint(ids(latestClicks)); got != "[e2 e0]" {
+		t.Fatalf("unexpected ordered page: %s", got)
+	}
+
+	afterCursor, err := db.FindMany(ctx, "Event", Query{
+		Where:   map[string]any{"kind": "click"},
+		Filters: map[string]Filter{"at": {GTE: base}},
+		OrderBy: []OrderBy{{Field: "at"}},
+		Cursor:  map[string]any{"id": "e0"},
+		Limit:   1,
+	})
+	if err != nil {
+		t.Fatalf("find cursor page: %v", err)
+	}
+	if got := fmt.Sprint(ids(afterCursor)); got != "[e2]" {
+		t.Fatalf("unexpected cursor page: %s", got)
+	}
+
+	count, err := db.Count(ctx, "Event", Query{Filters: map[string]Filter{"score": {LT: 0.0}}})
+	if err != nil || count != 2 {
+		t.Fatalf("expected 2 negative scores, got %d err=%v", count, err)
+	}
+	if _, err := db.Delete(ctx, "Event", map[string]any{"id": "e2"}); err != nil {
+		t.Fatalf("delete event: %v", err)
+	}
+	count, err = db.Count(ctx, "Event", Query{Filters: map[string]Filter{"score": {LT: 0.0}}})
+	if err != nil || count != 1 {
+		t.Fatalf("expected 1 negative score after delete, got %d err=%v", count, err)
+	}
+
+	all, err := db.FindMany(ctx, "Event", Query{OrderBy: []OrderBy{{Field: "score", Direction: SortDesc}}})
+	if err != nil {
+		t.Fatalf("find all ordered: %v", err)
+	}
+	if len(all) != 6 || all[len(all)-1]["id"] != "e-null" {
+		t.Fatalf("ordered read should include records without a value, sorted last in desc: %v", ids(all))
+	}
+}
+
+func TestPlannerChoosesCheapestAccessPathAndExplains(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{{
+		Name: "Ticket",
+		Fields: []Field{
+			{Name: "id", Kind: FieldString, Required: true},
+			{Name: "team", Kind: FieldInt64, Required: true},
+			{Name: "region", Kind: FieldInt64, Required: true},
+			{Name: "priority", Kind: FieldInt64, Required: true},
+		},
+		PrimaryKey: []string{"id"},
+		Indexes: []Index{
+			{Name: "ticket_region", Fields: []string{"region"}},
+			{Name: "ticket_team", Fields: []string{"team"}},
+			{Name: "ticket_priority", Fields: []string{"priority"}, Type: IndexOrdered},
+		},
+	}}}
+	db, err := Open(ctx, schema, Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	records := make([]Record, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		records = append(records, Record{"id": fmt.Sprintf("t%03d", i), "team": i % 50, "region": i % 40, "priority": i})
+	}
+	if _, err := db.CreateMany(ctx, "Ticket", records); err != nil {
+		t.Fatalf("create tickets: %v", err)
+	}
+
+	cases := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{"full scan", Query{}, "{Ticket FullScan [] 1000 false}"},
+		{"primary key", Query{Where: map[string]any{"id": "t001", "team": 1}}, "{Ticket PrimaryKey [] 1 false}"},
+		{"hash index", Query{Where: map[string]any{"team": 1}}, "{Ticket Index [ticket_team] 20 false}"},
+		{"equals filter", Query{Filters: map[string]Filter{"region": {Equals: 1}}}, "{Ticket Index [ticket_region] 25 false}"},
+		{"intersection", Query{Where: map[string]any{"region": 1, "team": 1}}, "{Ticket IndexIntersection [ticket_team ticket_region] 1 false}"},
+		{"range", Query{Filters: map[string]Filter{"priority": {GTE: 990}}}, "{Ticket OrderedIndex [ticket_priority] 10 false}"},
+		{"ordered limit", Query{OrderBy: []OrderBy{{Field: "priority", Direction: SortDesc}}, Limit: 5}, "{Ticket OrderedIndex [ticket_priority] 1000 true}"},
+	}
+	for _, tc := range cases {
+		for i := 0; i < 10; i++ {
+			plan, err := db.Explain(ctx, "Ticket", tc.query)
+			if err != nil {
+				t.Fatalf("explain %s: %v", tc.name, err)
+			}
+			if got := fmt.Sprint(plan); got != tc.want {
+				t.Fatalf("explain %s: expected %s, got %s", tc.name, tc.want, got)
+			}
+		}
+	}
+
+	intersected, err := db.FindMany(ctx, "Ticket", Query{Where: map[string]any{"region": 1, "team": 1}})
+	if err != nil {
+		t.Fatalf("find intersection: %v", err)
+	}
+	if len(intersected) != 5 || intersected[0]["id"] != "t001" || intersected[4]["id"] != "t801" {
+		t.Fatalf("unexpected intersection result: %v", intersected)
+	}
+	count, err := db.Count(ctx, "Ticket", Query{Where: map[string]any{"team": 1}, Filters: map[string]Filter{"priority": {LT: 500}}})
+	if err != nil || count != 10 {
+		t.Fatalf("expected 10 tickets, got %d err=%v", count, err)
+	}
+	if _, err := db.Explain(ctx, "Ticket", Query{Index: "ticket_missing"}); err == nil {
+		t.Fatal("expected explain with an unknown index to fail")
+	}
+}
+
+func TestFilterExprComposesAndOrNot(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{{
+		Name: "Task",
+		Fields: []Field{
+			{Name: "id", Kind: FieldString, Required: true},
+			{Name: "status", Kind: FieldString, Required: true},
+			{Name: "deleted", Kind: FieldBool, Required: true},
+			{Name: "points", Kind: FieldInt64, Required: true},
+		},
+		PrimaryKey: []string{"id"},
+		Indexes: []Index{
+			{Name: "task_status", Fields: []string{"status"}},
+		},
+	}}}
+	db, err := Open(ctx, schema, Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	statuses := []string{"open", "review", "done", "blocked"}
+	for i := 0; i < 40; i++ {
+		record := Record{"id": fmt.Sprintf("k%02d", i), "status": statuses[i%4], "deleted": i%5 == 0, "points": i}
+		if _, err := db.Create(ctx, "Task", record); err != nil {
+			t.Fatalf("create task: %v", err)
+		}
+	}
+
+	// status = 'open' OR status = 'review', AND NOT deleted, AND 10 <= points < 30
+	// written as two conditions on the same field.
+	expr := &FilterExpr{
+		Or: []FilterExpr{
+			{Field: "status", Filter: Filter{Equals: "open"}},
+			{Field: "status", Filter: Filter{Equals: "review"}},
+		},
+		Not: &FilterExpr{Field: "deleted", Filter: Filter{Equals: true}},
+		And: []FilterExpr{
+			{Field: "points", Filter: Filter{GTE: 10}},
+			{Field: "points", Filter: Filter{LT: 30}},
+		},
+	}
+	records, err := db.FindMany(ctx, "Task", Query{FilterExpr: expr, OrderBy: []OrderBy{{Field: "points"}}})
+	if err != nil {
+		t.Fatalf("find with filter expression: %v", err)
+	}
+	var ids []string
+	for _, record := range records {
+		ids = append(ids, record["id"].(string))
+	}
+	if got := fmt.Sprint(ids); got != "[k12 k13 k16 k17 k21 k24 k28 k29]" {
+		t.Fatalf("unexpected filter expression result: %s", got)
+	}
+	count, err := db.Count(ctx, "Task", Query{FilterExpr: expr})
+	if err != nil || count != len(ids) {
+		t.Fatalf("expected count %d, got %d err=%v", len(ids), count, err)
+	}
+
+	plan, err := db.Explain(ctx, "Task", Query{FilterExpr: expr})
+	if err != nil {
+		t.Fatalf("explain filter expression: %v", err)
+	}
+	if plan.Access != PlanIndexUnion || fmt.Sprint(plan.Indexes) != "[task_status task_status]" || plan.EstimatedRows != 20 {
+		t.Fatalf("expected a union of status lookups, got %+v", plan)
+	}
+
+	// A limited index lookup must not stop before the expression matches.
+	limited, err := db.FindMany(ctx, "Task", Query{
+		Where:      map[string]any{"status": "open"},
+		FilterExpr: &FilterExpr{Field: "points", Filter: Filter{GTE: 36}},
+		Limit:      1,
+	})
+	if err != nil || len(limited) != 1 || limited[0]["id"] != "k36" {
+		t.Fatalf("expected k36 from a limited lookup, got %+v err=%v", limited, err)
+	}
+
+	if _, err := db.FindMany(ctx, "Task", Query{FilterExpr: &FilterExpr{Or: []FilterExpr{{Field: "missing", Filter: Filter{Equals: 1}}}}}); err == nil {
+		t.Fatal("expected a filter expression on an unknown field to fail")
+	}
+}
+
+func TestRelationFiltersTraverseForeignKeys(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	for _, user := range []Record{
+		{"id": "u1", "email": "ada@corp.com", "name": "Ada"},
+		{"id": "u2", "email": "grace@example.com", "name": "Grace"},
+		{"id": "u3", "email": "linus@corp.com", "name": "Linus"},
+	} {
+		if _, err := db.Create(ctx, "User", user); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	for _, post := range []Record{
+		{"id": "p1", "authorId": "u1", "title": "Launch"},
+		{"id": "p2", "authorId": "u1", "title": "Draft"},
+		{"id": "p3", "authorId": "u2", "title": "Launch"},
+		{"id": "p4", "authorId": "u2", "title": "Launch notes"},
+	} {
+		if _, err := db.Create(ctx, "Post", post); err != nil {
+			t.Fatalf("create post: %v", err)
+		}
+	}
+
+	title := func(contains string) *FilterExpr {
+		return &FilterExpr{Field: "title", Filter: Filter{Contains: contains}}
+	}
+	corp := &FilterExpr{Field: "email", Filter: Filter{Contains: "@corp.com"}}
+	ids := func(model string, expr *FilterExpr) string {
+		t.Helper()
+		records, err := db.FindMany(ctx, model, Query{FilterExpr: expr, OrderBy: []OrderBy{{Field: "id"}}})
+		if err != nil {
+			t.Fatalf("find %s with relation filter: %v", model, err)
+		}
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, record["id"].(string))
+		}
+		return fmt.Sprint(ids)
+	}
+	for _, test := range []struct {
+		model string
+		expr  *FilterExpr
+		want  string
+	}{
+		{"User", &FilterExpr{Relation: "posts", RelationFilter: RelationFilter{Some: title("Draft")}}, "[u1]"},
+		{"User", &FilterExpr{Relation: "posts", RelationFilter: RelationFilter{Every: title("Launch")}}, "[u2 u3]"},
+		{"User", &FilterExpr{Relation: "posts", RelationFilter: RelationFilter{None: title("notes")}}, "[u1 u3]"},
+		{"Post", &FilterExpr{Relation: "author", RelationFilter: RelationFilter{Is: corp}}, "[p1 p2]"},
+		{"Post", &FilterExpr{Relation: "author", RelationFilter: RelationFilter{IsNot: corp}}, "[p3 p4]"},
+		{"User", &FilterExpr{Relation: "posts", RelationFilter: RelationFilter{
+			Some: &FilterExpr{Relation: "author", RelationFilter: RelationFilter{Is: corp}},
+		}}, "[u1]"},
+		{"User", &FilterExpr{Or: []FilterExpr{
+			{Relation: "posts", RelationFilter: RelationFilter{None: &FilterExpr{}}},
+			{Field: "name", Filter: Filter{Equals: "Grace"}},
+		}}, "[u2 u3]"},
+	} {
+		if got := ids(test.model, test.expr); got != test.want {
+			t.Fatalf("expected %s %s, got %s", test.model, test.want, got)
+		}
+	}
+
+	isCorp := &FilterExpr{Relation: "author", RelationFilter: RelationFilter{Is: corp}}
+	count, err := db.Count(ctx, "Post", Query{FilterExpr: isCorp})
+	if err != nil || count != 2 {
+		t.Fatalf("expected 2 posts by corp authors, got %d err=%v", count, err)
+	}
+	plan, err := db.Explain(ctx, "Post", Query{FilterExpr: isCorp})
+	if err != nil {
+		t.Fatalf("explain relation filter: %v", err)
+	}
+	if got := fmt.Sprint(plan); got != "{Post Index [post_author] 4 false}" {
+		t.Fatalf("expected posts read through post_author, got %s", got)
+	}
+	plan, err = db.Explain(ctx, "User", Query{FilterExpr: &FilterExpr{Relation: "posts", RelationFilter: RelationFilter{Some: title("Draft")}}})
+	if err != nil {
+		t.Fatalf("explain relation filter: %v", err)
+	}
+	if got := fmt.Sprint(plan); got != "{User PrimaryKey [] 1 false}" {
+		t.Fatalf("expected users read by primary key, got %s", got)
+	}
+
+	if _, err := db.FindMany(ctx, "User", Query{FilterExpr: &FilterExpr{Relation: "posts", RelationFilter: RelationFilter{Is: title("Draft")}}}); err == nil {
+		t.Fatal("expected Is on a Many relation to fail")
+	}
+	if _, err := db.FindMany(ctx, "User", Query{FilterExpr: &FilterExpr{Relation: "missing", RelationFilter: RelationFilter{Some: &FilterExpr{}}}}); err == nil {
+		t.Fatal("expected an unknown relation to fail")
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := tx.FindMany(ctx, "User", Query{FilterExpr: &FilterExpr{Relation: "posts", RelationFilter: RelationFilter{Some: title("Draft")}}}); err != nil {
+		t.Fatalf("tx find with relation filter: %v", err)
+	}
+	if _, err := tx.Update(ctx, "User", map[string]any{"id": "u1"}, Record{"name": "Ada Lovelace"}); err != nil {
+		t.Fatalf("tx update: %v", err)
+	}
+	if _, err := db.Create(ctx, "Post", Record{"id": "p5", "authorId": "u3", "title": "Draft"}); err != nil {
+		t.Fatalf("concurrent create post: %v", err)
+	}
+	if err := tx.Commit(ctx); !errors.Is(err, ErrTxConflict) {
+		t.Fatalf("expected a write to the filtered relation to conflict, got %v", err)
+	}
+}
+
+func TestSelectProjectsRecordsAndCoversIndexReads(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	for _, user := range []Record{
+		{"id": "u1", "email": "ada@example.com", "name": "Ada"},
+		{"id": "u2", "email": "grace@example.com", "name": "Grace"},
+	} {
+		if _, err := db.Create(ctx, "User", user); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	for _, post := range []Record{
+		{"id": "p1", "authorId": "u1", "title": "First"},
+		{"id": "p2", "authorId": "u1", "title": "Second"},
+		{"id": "p3", "authorId": "u2", "title": "Third"},
+	} {
+		if _, err := db.Create(ctx, "Post", post); err != nil {
+			t.Fatalf("create post: %v", err)
+		}
+	}
+
+	user, ok, err := db.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, []string{"email", "posts"})
+	if err != nil || !ok {
+		t.Fatalf("find selected user: ok=%v err=%v", ok, err)
+	}
+	if len(user) != 2 || user["email"] != "ada@example.com" || len(user["posts"].([]Record)) != 2 {
+		t.Fatalf("expected only email and posts, got %+v", user)
+	}
+	user, ok, err = db.FindUnique(ctx, "User", map[string]any{"email": "grace@example.com"}, nil, []string{"id"})
+	if err != nil || !ok || len(user) != 1 || user["id"] != "u2" {
+		t.Fatalf("expected covered id u2, got %+v ok=%v err=%v", user, ok, err)
+	}
+
+	posts, err := db.FindMany(ctx, "Post", Query{
+		Where:   map[string]any{"authorId": "u1"},
+		OrderBy: []OrderBy{{Field: "id", Direction: SortDesc}},
+		Select:  []string{"title", "author"},
+	})
+	if err != nil {
+		t.Fatalf("find selected posts: %v", err)
+	}
+	if len(posts) != 2 || len(posts[0]) != 2 || posts[0]["title"] != "Second" || posts[0]["author"].(Record)["name"] != "Ada" {
+		t.Fatalf("expected titles and authors in id order, got %+v", posts)
+	}
+	if _, err := db.FindMany(ctx, "Post", Query{Select: []string{"body"}}); err == nil {
+		t.Fatal("expected selecting an unknown field to fail")
+	}
+
+	// A covered read answers from the index alone, so it still works against
+	// a table whose stored records are blanked out.
+	table := *db.current.Load().tables["Post"]
+	table.rows.edit = nil
+	table.rows.each(func(primaryKey string, current recordVersion) bool {
+		table.rows = table.rows.set(primaryKey, recordVersion{sequence: current.sequence, record: Record{}})
+		return true
+	})
+	covered, err := table.findMany(Query{Where: map[string]any{"authorId": "u1"}, OrderBy: []OrderBy{{Field: "id"}}, Select: []string{"id", "authorId"}})
+	if err != nil {
+		t.Fatalf("covered find many: %v", err)
+	}
+	if fmt.Sprint(covered) != "[map[authorId:u1 id:p1] map[authorId:u1 id:p2]]" {
+		t.Fatalf("unexpected covered records: %v", covered)
+	}
+	uncovered, err := table.findMany(Query{Where: map[string]any{"authorId": "u1"}, Select: []string{"title"}})
+	if err != nil || len(uncovered) != 0 {
+		t.Fatalf("expected a title read to need the rows, got %v err=%v", uncovered, err)
+	}
+}
+
+func TestIterateStreamsQueryResults(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	if _, err := db.Create(ctx, "User", Record{"id": "u1", "email": "ada@example.com", "name": "Ada"}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		post := Record{"id": fmt.Sprintf("p%d", i), "authorId": "u1", "title": fmt.Sprintf("Post %d", i)}
+		if _, err := db.Create(ctx, "Post", post); err != nil {
+			t.Fatalf("create post: %v", err)
+		}
+	}
+
+	collect := func(query Query) ([]Record, error) {
+		var records []Record
+		for record, err := range db.Iterate(ctx, "Post", query) {
+			if err != nil {
+				return records, err
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	}
+	for _, query := range []Query{
+		{OrderBy: []OrderBy{{Field: "title", Direction: SortDesc}}, Skip: 1, Limit: 3},
+		{Where: map[string]any{"authorId": "u1"}, Cursor: map[string]any{"id": "p2"}, Limit: 2},
+		{Filters: map[string]Filter{"title": {Contains: "4"}}, Select: []string{"title", "author"}},
+	} {
+		streamed, err := collect(query)
+		if err != nil {
+			t.Fatalf("iterate %+v: %v", query, err)
+		}
+		found, err := db.FindMany(ctx, "Post", query)
+		if err != nil {
+			t.Fatalf("find many %+v: %v", query, err)
+		}
+		if fmt.Sprint(streamed) != fmt.Sprint(found) {
+			t.Fatalf("expected iterate to match find many for %+v, got %v want %v", query, streamed, found)
+		}
+	}
+
+	seen := 0
+	for _, err := range db.Iterate(ctx, "Post", Query{}) {
+		if err != nil {
+			t.Fatalf("iterate: %v", err)
+		}
+		seen++
+		break
+	}
+	if seen != 1 {
+		t.Fatalf("expected to stop after one record, saw %d", seen)
+	}
+	if _, err := collect(Query{Select: []string{"body"}}); err == nil {
+		t.Fatal("expected selecting an unknown field to fail")
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	var canceledErr error
+	for _, err := range db.Iterate(canceled, "Post", Query{}) {
+		canceledErr = err
+	}
+	if !errors.Is(canceledErr, context.Canceled) {
+		t.Fatalf("expected canceled iterate, got %v", canceledErr)
+	}
+}
+
+func TestAggregateAndGroupBy(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{{
+		Name: "Order",
+		Fields: []Field{
+			{Name: "id", Kind: FieldString, Required: true},
+			{Name: "customer", Kind: FieldString, Required: true},
+			{Name: "amount", Kind: FieldInt64},
+			{Name: "price", Kind: FieldFloat},
+			{Name: "at", Kind: FieldTime, Required: true},
+		},
+		PrimaryKey: []string{"id"},
+		Indexes: []Index{
+			{Name: "order_customer", Fields: []string{"customer"}},
+		},
+	}}}
+	db, err := Open(ctx, schema, Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, order := range []Record{
+		{"id": "o1", "customer": "c1", "amount": 10, "price": 1.5},
+		{"id": "o2", "customer": "c1", "amount": 20, "price": 2.5},
+		{"id": "o3", "customer": "c2", "amount": 5},
+		{"id": "o4", "customer": "c3", "price": 4.0},
+		{"id": "o5", "customer": "c2", "amount": 7, "price": 1.0},
+	} {
+		order["at"] = base.Add(time.Duration(i) * time.Hour)
+		if _, err := db.Create(ctx, "Order", order); err != nil {
+			t.Fatalf("create order: %v", err)
+		}
+	}
+
+	result, err := db.Aggregate(ctx, "Order", AggregateQuery{
+		CountAll: true,
+		Count:    []string{"amount"},
+		Sum:      []string{"amount", "price"},
+		Avg:      []string{"amount"},
+		Min:      []string{"at"},
+		Max:      []string{"amount"},
+	})
+	if err != nil {
+		t.Fatalf("aggregate: %v", err)
+	}
+	if result.CountAll != 5 || result.Count["amount"] != 4 || result.Sum["amount"] != int64(42) || result.Sum["price"] != 9.0 ||
+		result.Avg["amount"] != 10.5 || result.Min["at"] != base || result.Max["amount"] != int64(20) {
+		t.Fatalf("unexpected aggregate: %+v", result)
+	}
+	page, err := db.Aggregate(ctx, "Order", AggregateQuery{
+		Query: Query{OrderBy: []OrderBy{{Field: "id"}}, Limit: 2},
+		Sum:   []string{"amount"},
+	})
+	if err != nil || page.Sum["amount"] != int64(30) {
+		t.Fatalf("expected the first two orders to sum to 30, got %+v err=%v", page, err)
+	}
+	if _, err := db.Aggregate(ctx, "Order", AggregateQuery{Sum: []string{"customer"}}); err == nil {
+		t.Fatal("expected sum over a string field to fail")
+	}
+
+	groups := func(query GroupByQuery) string {
+		t.Helper()
+		result, err := db.GroupBy(ctx, "Order", query)
+		if err != nil {
+			t.Fatalf("group by: %v", err)
+		}
+		var parts []string
+		for _, group := range result {
+			parts = append(parts, fmt.Sprintf("%v:%d:%v", group.Key[query.By[0]], group.CountAll, group.Sum["amount"]))
+		}
+		return fmt.Sprint(parts)
+	}
+	byCustomer := GroupByQuery{AggregateQuery: AggregateQuery{CountAll: true, Sum: []string{"amount"}}, By: []string{"customer"}}
+	for _, test := range []struct {
+		query GroupByQuery
+		want  string
+	}{
+		{byCustomer, "[c1:2:30 c2:2:12 c3:1:<nil>]"},
+		{GroupByQuery{AggregateQuery: byCustomer.AggregateQuery, By: byCustomer.By,
+			Having:  []Having{{Aggregate: AggregateSum, Field: "amount", Filter: Filter{GT: 10}}},
+			OrderBy: []GroupOrderBy{{Aggregate: AggregateSum, Field: "amount"}},
+		}, "[c2:2:12 c1:2:30]"},
+		{GroupByQuery{AggregateQuery: byCustomer.AggregateQuery, By: byCustomer.By,
+			Having:  []Having{{Aggregate: AggregateCount, Filter: Filter{GTE: 2}}},
+			OrderBy: []GroupOrderBy{{Field: "customer", Direction: SortDesc}},
+			Skip:    1,
+			Limit:   1,
+		}, "[c1:2:30]"},
+		{GroupByQuery{AggregateQuery: AggregateQuery{CountAll: true}, By: []string{"customer"}}, "[c1:2:<nil> c2:2:<nil> c3:1:<nil>]"},
+		{GroupByQuery{AggregateQuery: AggregateQuery{
+			Query:    Query{Filters: map[string]Filter{"at": {GTE: base.Add(2 * time.Hour)}}},
+			CountAll: true,
+		}, By: []string{"customer"}}, "[c2:2:<nil> c3:1:<nil>]"},
+		{GroupByQuery{AggregateQuery: AggregateQuery{CountAll: true, Sum: []string{"amount"}}, By: []string{"amount"}}, "[<nil>:1:<nil> 5:1:5 7:1:7 10:1:10 20:1:20]"},
+	} {
+		if got := groups(test.query); got != test.want {
+			t.Fatalf("expected groups %s, got %s", test.want, got)
+		}
+	}
+	if _, err := db.GroupBy(ctx, "Order", GroupByQuery{By: []string{"customer"}, OrderBy: []GroupOrderBy{{Field: "amount"}}}); err == nil {
+		t.Fatal("expected ordering groups by an ungrouped field to fail")
+	}
+}
+
+func TestForeignKeysAreEnforced(t *testing.T) {
+	ctx := context.Background()
+	walPath := filepath.Join(t.TempDir(), "zenith.wal")
+	db, err := Open(ctx, testSchema(), Options{WALPath: walPath})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	for _, user := range []Record{
+		{"id": "u1", "email": "ada@example.com", "name": "Ada"},
+		{"id": "u2", "email": "grace@example.com", "name": "Grace"},
+	} {
+		if _, err := db.Create(ctx, "User", user); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+
+	if _, err := db.Create(ctx, "Post", Record{"id": "p1", "authorId": "u9", "title": "Orphan"}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected a post without an author to fail, got %v", err)
+	}
+	if _, err := db.Create(ctx, "Post", Record{"id": "p1", "authorId": "u1", "title": "First"}); err != nil {
+		t.Fatalf("create post: %v", err)
+	}
+	if _, err := db.Update(ctx, "Post", map[string]any{"id": "p1"}, Record{"authorId": "u9"}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected moving a post to a missing author to fail, got %v", err)
+	}
+	if _, _, err := db.Upsert(ctx, "Post", map[string]any{"id": "p2"}, Record{"id": "p2", "authorId": "u9", "title": "Orphan"}, nil); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected upserting a post without an author to fail, got %v", err)
+	}
+	if _, err := db.Delete(ctx, "User", map[string]any{"id": "u1"}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected deleting a referenced user to fail, got %v", err)
+	}
+	if _, err := db.DeleteMany(ctx, "User", Query{}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected deleting every user to fail, got %v", err)
+	}
+	if count, err := db.Count(ctx, "User", Query{}); err != nil || count != 2 {
+		t.Fatalf("expected a failed delete many to keep both users, got %d err=%v", count, err)
+	}
+
+	// Within a batch each operation sees the ones before it, so a user and
+	// their post can be created together and a post moved before its author
+	// is deleted.
+	if _, err := db.Batch(ctx, []BatchOperation{
+		{Type: BatchCreate, Model: "User", Record: Record{"id": "u3", "email": "linus@example.com", "name": "Linus"}},
+		{Type: BatchCreate, Model: "Post", Record: Record{"id": "p3", "authorId": "u3", "title": "Kernel"}},
+		{Type: BatchUpdate, Model: "Post", Where: map[string]any{"id": "p1"}, Record: Record{"authorId": "u2"}},
+		{Type: BatchDelete, Model: "User", Where: map[string]any{"id": "u1"}},
+	}); err != nil {
+		t.Fatalf("consistent batch: %v", err)
+	}
+	if _, err := db.Batch(ctx, []BatchOperation{
+		{Type: BatchCreate, Model: "Post", Record: Record{"id": "p4", "authorId": "u3", "title": "Kept?"}},
+		{Type: BatchDelete, Model: "User", Where: map[string]any{"id": "u3"}},
+	}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected a batch orphaning posts to fail, got %v", err)
+	}
+	if _, ok, err := db.FindUnique(ctx, "Post", map[string]any{"id": "p4"}, nil, nil); err != nil || ok {
+		t.Fatalf("failed batch leaked a post: found=%v err=%v", ok, err)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := tx.Create(ctx, "Post", Record{"id": "p5", "authorId": "u1", "title": "Deleted author"}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected a tx post without an author to fail, got %v", err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close db: %v", err)
+	}
+
+	reopened, err := Open(ctx, testSchema(), Options{WALPath: walPath})
+	if err != nil {
+		t.Fatalf("reopen db: %v", err)
+	}
+	post, ok, err := reopened.FindUnique(ctx, "Post", map[string]any{"id": "p1"}, nil, nil)
+	if err != nil || !ok || post["authorId"] != "u2" {
+		t.Fatalf("expected replayed post p1 by u2, got %+v ok=%v err=%v", post, ok, err)
+	}
+	if err := reopened.Close(); err != nil {
+		t.Fatalf("close reopened db: %v", err)
+	}
+
+	// A WAL written without the foreign key does not replay into a database
+	// that enforces it.
+	unchecked := testSchema()
+	unchecked.Models[1].Relations[0].ForeignKey = false
+	orphanWAL := filepath.Join(t.TempDir(), "orphan.wal")
+	loose, err := Open(ctx, unchecked, Options{WALPath: orphanWAL})
+	if err != nil {
+		t.Fatalf("open unchecked db: %v", err)
+	}
+	if _, err := loose.Create(ctx, "Post", Record{"id": "p1", "authorId": "u9", "title": "Orphan"}); err != nil {
+		t.Fatalf("create unchecked post: %v", err)
+	}
+	if err := loose.Close(); err != nil {
+		t.Fatalf("close unchecked db: %v", err)
+	}
+	if _, err := Open(ctx, testSchema(), Options{WALPath: orphanWAL}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected replaying an orphan post to fail, got %v", err)
+	}
+
+	invalid := testSchema()
+	invalid.Models[1].Relations[0].References = []string{"name"}
+	if err := invalid.Validate(); err == nil || !strings.Contains(err.Error(), "must reference the primary key or a unique index") {
+		t.Fatalf("expected a foreign key to a non-unique field to fail validation, got %v", err)
+	}
+}
+
+func TestForeignKeyUpgradeRepairsDataWrittenWithoutThem(t *testing.T) {
+	ctx := context.Background()
+	// Data written before foreign keys were enforced: a post by a user that
+	// never existed, and one whose user was deleted under it.
+	unchecked := testSchema()
+	unchecked.Models[1].Relations[0].ForeignKey = false
+	dataDir := t.TempDir()
+	loose, err := Open(ctx, unchecked, Options{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("open unchecked db: %v", err)
+	}
+	if _, err := loose.Batch(ctx, []BatchOperation{
+		{Type: BatchCreate, Model: "User", Record: Record{"id": "u1", "email": "ada@example.com", "name": "Ada"}},
+		{Type: BatchCreate, Model: "User", Record: Record{"id": "u2", "email": "grace@example.com", "name": "Grace"}},
+		{Type: BatchCreate, Model: "Post", Record: Record{"id": "p1", "authorId": "u9", "title": "Orphan"}},
+		{Type: BatchCreate, Model: "Post", Record: Record{"id": "p2", "authorId": "u1", "title": "Left behind"}},
+		{Type: BatchCreate, Model: "Post", Record: Record{"id": "p3", "authorId": "u2", "title": "Kept"}},
+		{Type: BatchDelete, Model: "User", Where: map[string]any{"id": "u1"}},
+	}); err != nil {
+		t.Fatalf("write unchecked data: %v", err)
+	}
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := loose.Snapshot(ctx, snapshotPath); err != nil {
+		t.Fatalf("snapshot unchecked data: %v", err)
+	}
+	if err := loose.Close(); err != nil {
+		t.Fatalf("close unchecked db: %v", err)
+	}
+	if _, err := Open(ctx, testSchema(), Options{DataDir: dataDir}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected the dangling posts to fail replay, got %v", err)
+	}
+	loaded, err := Open(ctx, testSchema(), Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer loaded.Close()
+	if err := loaded.LoadSnapshot(ctx, snapshotPath); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected the dangling posts to fail the snapshot load, got %v", err)
+	}
+
+	// The upgrade path: reopen without the foreign key, remove the dangling
+	// references, and checkpoint so replay starts past them.
+	repair, err := Open(ctx, unchecked, Options{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("reopen unchecked db: %v", err)
+	}
+	if _, err := repair.DeleteMany(ctx, "Post", Query{Filters: map[string]Filter{"authorId": {In: []any{"u1", "u9"}}}}); err != nil {
+		t.Fatalf("delete dangling posts: %v", err)
+	}
+	if err := repair.Checkpoint(ctx); err != nil {
+		t.Fatalf("checkpoint: %v", err)
+	}
+	if err := repair.Close(); err != nil {
+		t.Fatalf("close repaired db: %v", err)
+	}
+
+	strict, err := Open(ctx, testSchema(), Options{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("open repaired db with foreign keys: %v", err)
+	}
+	defer strict.Close()
+	if posts, err := strict.FindMany(ctx, "Post", Query{}); err != nil || len(posts) != 1 || posts[0]["id"] != "p3" {
+		t.Fatalf("expected only p3 to survive the repair, got %+v err=%v", posts, err)
+	}
+	// A relation without onDelete now restricts deletes.
+	if _, err := strict.Delete(ctx, "User", map[string]any{"id": "u2"}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected deleting a referenced user to be restricted, got %v", err)
+	}
+}
+
+func TestEnumFieldsAcceptOnlyTheirValues(t *testing.T) {
+	ctx := context.Background()
+	accountSchema := func(roles ...string) Schema {
+		return Schema{
+			Models: []Model{{
+				Name: "Account",
+				Fields: []Field{
+					{Name: "id", Kind: FieldString, Required: true},
+					{Name: "role", Kind: FieldEnum, Required: true, Enum: "Role", Values: roles},
+				},
+				PrimaryKey: []string{"id"},
+				Indexes:    []Index{{Name: "account_role_idx", Fields: []string{"role"}}},
+			}},
+			Enums: []Enum{{Name: "Role", Values: roles}},
+		}
+	}
+	schema := accountSchema("ADMIN", "USER")
+	db, err := Open(ctx, schema, Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Create(ctx, "Account", Record{"id": "a1", "role": "ADMIN"}); err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	if _, err := db.Create(ctx, "Account", Record{"id": "a2", "role": "OWNER"}); err == nil || !strings.Contains(err.Error(), "expected one of ADMIN, USER") {
+		t.Fatalf("expected a value outside the enum to fail, got %v", err)
+	}
+	if _, err := db.Update(ctx, "Account", map[string]any{"id": "a1"}, Record{"role": 1}); err == nil {
+		t.Fatal("expected a non-string enum value to fail")
+	}
+	records, err := db.FindMany(ctx, "Account", Query{Where: map[string]any{"role": "ADMIN"}})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected one admin, got %+v err=%v", records, err)
+	}
+	if _, err := db.FindMany(ctx, "Account", Query{Filters: map[string]Filter{"role": {Equals: "OWNER"}}}); err == nil {
+		t.Fatal("expected a filter outside the enum to fail")
+	}
+
+	hash, err := schema.Hash()
+	if err != nil {
+		t.Fatalf("schema hash: %v", err)
+	}
+	if changedHash, err := accountSchema("ADMIN", "USER", "OWNER").Hash(); err != nil || changedHash == hash {
+		t.Fatalf("expected the enum values to change the schema hash, got %q err=%v", changedHash, err)
+	}
+
+	roles := []string{"ADMIN", "USER"}
+	for _, invalid := range []struct {
+		enums []Enum
+		field Field
+		want  string
+	}{
+		{enums: []Enum{{Name: "Role", Values: roles}}, field: Field{Name: "role", Kind: FieldEnum, Enum: "Status", Values: roles}, want: "unknown enum"},
+		{enums: []Enum{{Name: "Role", Values: roles}}, field: Field{Name: "role", Kind: FieldEnum, Enum: "Role", Values: []string{"ADMIN"}}, want: "must carry the values"},
+		{enums: []Enum{{Name: "Role", Values: []string{"ADMIN", "ADMIN"}}}, field: Field{Name: "role", Kind: FieldString}, want: "defined more than once"},
+		{enums: []Enum{{Name: "Role"}}, field: Field{Name: "role", Kind: FieldString}, want: "at least one value"},
+	} {
+		invalidSchema := Schema{
+			Models: []Model{{Name: "Account", Fields: []Field{{Name: "id", Kind: FieldString}, invalid.field}, PrimaryKey: []string{"id"}}},
+			Enums:  invalid.enums,
+		}
+		if err := invalidSchema.Validate(); err == nil || !strings.Contains(err.Error(), invalid.want) {
+			t.Fatalf("expected %q validation error, got %v", invalid.want, err)
+		}
+	}
+}
+
+func TestDefaultsFillFieldsCreatesLeaveOut(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{{
+		Name: "Ticket",
+		Fields: []Field{
+			{Name: "id", Kind: FieldString, Required: true, Default: &Default{Func: DefaultUUID}},
+			{Name: "number", Kind: FieldInt64, Required: true, Default: &Default{Func: DefaultAutoincrement}},
+			{Name: "code", Kind: FieldString, Required: true, Default: &Default{Func: DefaultCUID}},
+			{Name: "status", Kind: FieldString, Required: true, Default: &Default{Value: "open"}},
+			{Name: "priority", Kind: FieldInt64, Required: true, Default: &Default{Value: "3"}},
+			{Name: "createdAt", Kind: FieldTime, Required: true, Default: &Default{Func: DefaultNow}},
+		},
+		PrimaryKey: []string{"id"},
+	}}}
+	walPath := filepath.Join(t.TempDir(), "zenith.wal")
+	db, err := Open(ctx, schema, Options{WALPath: walPath})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+
+	first, err := db.Create(ctx, "Ticket", Record{})
+	if err != nil {
+		t.Fatalf("create ticket: %v", err)
+	}
+	created := first.Record
+	if id, _ := created["id"].(string); len(id) != 36 || id[14] != '4' {
+		t.Fatalf("expected a version 4 uuid, got %q", created["id"])
+	}
+	if code, _ := created["code"].(string); len(code) != 25 || code[0] != 'c' {
+		t.Fatalf("expected a cuid, got %q", created["code"])
+	}
+	if created["number"] != int64(1) || created["status"] != "open" || created["priority"] != int64(3) {
+		t.Fatalf("unexpected defaults: %+v", created)
+	}
+	if createdAt, _ := created["createdAt"].(time.Time); createdAt.IsZero() {
+		t.Fatalf("expected createdAt to be stamped, got %+v", created["createdAt"])
+	}
+	if stored, ok, err := db.FindUnique(ctx, "Ticket", map[string]any{"id": created["id"]}, nil, nil); err != nil || !ok || stored["code"] != created["code"] {
+		t.Fatalf("expected the created record to be stored, got %+v ok=%v err=%v", stored, ok, err)
+	}
+
+	if _, err := db.Create(ctx, "Ticket", Record{"id": "t10", "number": 10, "status": "closed"}); err != nil {
+		t.Fatalf("create ticket with explicit values: %v", err)
+	}
+	next, err := db.Create(ctx, "Ticket", Record{"id": "t11"})
+	if err != nil || next.Record["number"] != int64(11) || next.Record["status"] != "open" {
+		t.Fatalf("expected the sequence to continue after an explicit value, got %+v err=%v", next.Record, err)
+	}
+	if _, err := db.Delete(ctx, "Ticket", map[string]any{"id": "t11"}); err != nil {
+		t.Fatalf("delete ticket: %v", err)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	staged, err := tx.Create(ctx, "Ticket", Record{})
+	if err != nil || staged.Record["number"] != int64(12) {
+		t.Fatalf("expected the transaction to draw the next value, got %+v err=%v", staged.Record, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	committed, ok, err := db.FindUnique(ctx, "Ticket", map[string]any{"id": staged.Record["id"]}, nil, nil)
+	if err != nil || !ok || committed["code"] != staged.Record["code"] || !committed["createdAt"].(time.Time).Equal(staged.Record["createdAt"].(time.Time)) {
+		t.Fatalf("expected commit to store the defaults the transaction saw, got %+v ok=%v err=%v", committed, ok, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close db: %v", err)
+	}
+
+	reopened, err := Open(ctx, schema, Options{WALPath: walPath})
+	if err != nil {
+		t.Fatalf("reopen db: %v", err)
+	}
+	defer reopened.Close()
+	replayed, ok, err := reopened.FindUnique(ctx, "Ticket", map[string]any{"id": created["id"]}, nil, nil)
+	if err != nil || !ok || replayed["code"] != created["code"] || replayed["number"] != int64(1) {
+		t.Fatalf("expected replay to restore the generated values, got %+v ok=%v err=%v", replayed, ok, err)
+	}
+	if _, err := reopened.Delete(ctx, "Ticket", map[string]any{"id": staged.Record["id"]}); err != nil {
+		t.Fatalf("delete ticket: %v", err)
+	}
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := reopened.Snapshot(ctx, snapshotPath); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	loaded, err := Open(ctx, schema, Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer loaded.Close()
+	if err := loaded.LoadSnapshot(ctx, snapshotPath); err != nil {
+		t.Fatalf("load snapshot: %v", err)
+	}
+	if after, err := loaded.Create(ctx, "Ticket", Record{}); err != nil || after.Record["number"] != int64(13) {
+		t.Fatalf("expected the snapshot to keep the sequence past deleted records, got %+v err=%v", after.Record, err)
+	}
+
+	for _, invalid := range []struct {
+		fields []Field
+		want   string
+	}{
+		{fields: []Field{{Name: "slug", Kind: FieldString, Default: &Default{Func: DefaultAutoincrement}}}, want: "cannot default to autoincrement()"},
+		{fields: []Field{{Name: "rank", Kind: FieldInt64, Default: &Default{Value: "high"}}}, want: `invalid int64 literal "high"`},
+		{fields: []Field{{Name: "slug", Kind: FieldString, Default: &Default{Func: "slugify"}}}, want: "unsupported default"},
+		{fields: []Field{{Name: "a", Kind: FieldInt64, Default: &Default{Func: DefaultAutoincrement}}, {Name: "b", Kind: FieldInt64, Default: &Default{Func: DefaultAutoincrement}}}, want: "only one field"},
+	} {
+		invalidSchema := Schema{Models: []Model{{Name: "Ticket", Fields: append([]Field{{Name: "id", Kind: FieldString}}, invalid.fields...), PrimaryKey: []string{"id"}}}}
+		if err := invalidSchema.Validate(); err == nil || !strings.Contains(err.Error(), invalid.want) {
+			t.Fatalf("expected %q validation error, got %v", invalid.want, err)
+		}
+	}
+}
+
+func TestCUIDDefaultsTakeTheTimeFromTheClock(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{{
+		Name: "Ticket",
+		Fields: []Field{
+			{Name: "id", Kind: FieldString, Required: true, Default: &Default{Func: DefaultCUID}},
+		},
+		PrimaryKey: []string{"id"},
+	}}}
+	now := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	db, err := Open(ctx, schema, Options{Clock: func() time.Time { return now }})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	created, err := db.Create(ctx, "Ticket", Record{})
+	if err != nil {
+		t.Fatalf("create ticket: %v", err)
+	}
+	if id, _ := created.Record["id"].(string); id[1:9] != base36(uint64(now.UnixMilli()), 8) {
+		t.Fatalf("expected the cuid to carry the clock's time, got %q", id)
+	}
+}
+
+func TestUpdatedAtStampsWritesFromTheClock(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{{
+		Name: "Note",
+		Fields: []Field{
+			{Name: "id", Kind: FieldString, Required: true},
+			{Name: "body", Kind: FieldString, Required: true},
+			{Name: "createdAt", Kind: FieldTime, Required: true, Default: &Default{Func: DefaultNow}},
+			{Name: "updatedAt", Kind: FieldTime, Required: true, UpdatedAt: true},
+		},
+		PrimaryKey: []string{"id"},
+	}}}
+	at := func(minute int) time.Time {
+		return time.Date(2026, 1, 2, 3, minute, 0, 0, time.UTC)
+	}
+	now := at(0)
+	clock := func() time.Time { return now }
+	walPath := filepath.Join(t.TempDir(), "zenith.wal")
+	db, err := Open(ctx, schema, Options{WALPath: walPath, Clock: clock})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+
+	created, err := db.Create(ctx, "Note", Record{"id": "n1", "body": "draft"})
+	if err != nil || !created.Record["createdAt"].(time.Time).Equal(at(0)) || !created.Record["updatedAt"].(time.Time).Equal(at(0)) {
+		t.Fatalf("expected create to stamp both times, got %+v err=%v", created.Record, err)
+	}
+	now = at(1)
+	updated, err := db.Update(ctx, "Note", map[string]any{"id": "n1"}, Record{"body": "final"})
+	if err != nil || !updated["createdAt"].(time.Time).Equal(at(0)) || !updated["updatedAt"].(time.Time).Equal(at(1)) {
+		t.Fatalf("expected update to stamp updatedAt only, got %+v err=%v", updated, err)
+	}
+	if _, err := db.Create(ctx, "Note", Record{"id": "n2", "body": "imported", "updatedAt": at(30)}); err != nil {
+		t.Fatalf("create note: %v", err)
+	}
+	if kept, _, err := db.FindUnique(ctx, "Note", map[string]any{"id": "n2"}, nil, nil); err != nil || !kept["updatedAt"].(time.Time).Equal(at(30)) {
+		t.Fatalf("expected an explicit updatedAt to be kept, got %+v err=%v", kept, err)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	now = at(2)
+	if _, err := tx.Update(ctx, "Note", map[string]any{"id": "n2"}, Record{"body": "reviewed"}); err != nil {
+		t.Fatalf("tx update: %v", err)
+	}
+	now = at(3)
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if committed, _, err := db.FindUnique(ctx, "Note", map[string]any{"id": "n2"}, nil, nil); err != nil || !committed["updatedAt"].(time.Time).Equal(at(2)) {
+		t.Fatalf("expected commit to keep the stamp the transaction saw, got %+v err=%v", committed, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close db: %v", err)
+	}
+
+	now = at(59)
+	reopened, err := Open(ctx, schema, Options{WALPath: walPath, Clock: clock})
+	if err != nil {
+		t.Fatalf("reopen db: %v", err)
+	}
+	defer reopened.Close()
+	for id, want := range map[string]time.Time{"n1": at(1), "n2": at(2)} {
+		replayed, ok, err := reopened.FindUnique(ctx, "Note", map[string]any{"id": id}, nil, nil)
+		if err != nil || !ok || !replayed["updatedAt"].(time.Time).Equal(want) {
+			t.Fatalf("expected replay to restore the %s stamp %v, got %+v ok=%v err=%v", id, want, replayed, ok, err)
+		}
+	}
+
+	invalid := Schema{Models: []Model{{Name: "Note", Fields: []Field{{Name: "id", Kind: FieldString}, {Name: "version", Kind: FieldInt64, UpdatedAt: true}}, PrimaryKey: []string{"id"}}}}
+	if err := invalid.Validate(); err == nil || !strings.Contains(err.Error(), "cannot be stamped with @updatedAt") {
+		t.Fatalf("expected @updatedAt on an int field to fail, got %v", err)
+	}
+}
+
+func TestTxCommitsUpdatedAtOfReferentialActions(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{
+		{
+			Name:       "User",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "email", Kind: FieldString, Required: true}},
+			PrimaryKey: []string{"id"},
+			Indexes:    []Index{{Name: "user_email", Fields: []string{"email"}, Unique: true}},
+		},
+		{
+			Name: "Profile",
+			Fields: []Field{
+				{Name: "id", Kind: FieldString, Required: true},
+				{Name: "userEmail", Kind: FieldString},
+				{Name: "updatedAt", Kind: FieldTime, Required: true, UpdatedAt: true},
+			},
+			PrimaryKey: []string{"id"},
+			Relations:  []Relation{{Name: "user", Model: "User", Fields: []string{"userEmail"}, References: []string{"email"}, ForeignKey: true, OnUpdate: ActionCascade}},
+		},
+	}}
+	at := func(minute int) time.Time {
+		return time.Date(2026, 1, 2, 3, minute, 0, 0, time.UTC)
+	}
+	now := at(0)
+	clock := func() time.Time { return now }
+	db, err := Open(ctx, schema, Options{Clock: clock})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Batch(ctx, []BatchOperation{
+		{Type: BatchCreate, Model: "User", Record: Record{"id": "u1", "email": "ada@example.com"}},
+		{Type: BatchCreate, Model: "Profile", Record: Record{"id": "pr1", "userEmail": "ada@example.com"}},
+	}); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	now = at(1)
+	if _, err := tx.Update(ctx, "User", map[string]any{"id": "u1"}, Record{"email": "lovelace@example.com"}); err != nil {
+		t.Fatalf("tx update: %v", err)
+	}
+	cascaded, ok, err := tx.FindUnique(ctx, "Profile", map[string]any{"id": "pr1"}, nil, nil)
+	if err != nil || !ok || !cascaded["updatedAt"].(time.Time).Equal(at(1)) {
+		t.Fatalf("expected the cascade to stamp the profile, got %+v ok=%v err=%v", cascaded, ok, err)
+	}
+	now = at(2)
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	committed, ok, err := db.FindUnique(ctx, "Profile", map[string]any{"id": "pr1"}, nil, nil)
+	if err != nil || !ok || committed["userEmail"] != "lovelace@example.com" || !committed["updatedAt"].(time.Time).Equal(at(1)) {
+		t.Fatalf("expected commit to keep the stamp the transaction saw, got %+v ok=%v err=%v", committed, ok, err)
+	}
+}
+
+func TestTxCommitsGeneratedValuesOfNestedWrites(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{
+		{
+			Name:       "User",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}},
+			PrimaryKey: []string{"id"},
+			Relations:  []Relation{{Name: "posts", Model: "Post", Fields: []string{"id"}, References: []string{"authorId"}, Many: true}},
+		},
+		{
+			Name: "Post",
+			Fields: []Field{
+				{Name: "id", Kind: FieldString, Required: true, Default: &Default{Func: DefaultUUID}},
+				{Name: "number", Kind: FieldInt64, Required: true, Default: &Default{Func: DefaultAutoincrement}},
+				{Name: "authorId", Kind: FieldString},
+				{Name: "title", Kind: FieldString},
+				{Name: "updatedAt", Kind: FieldTime, Required: true, UpdatedAt: true},
+			},
+			PrimaryKey: []string{"id"},
+			Indexes:    []Index{{Name: "post_author", Fields: []string{"authorId"}}},
+			Relations:  []Relation{{Name: "author", Model: "User", Fields: []string{"authorId"}, References: []string{"id"}, ForeignKey: true}},
+		},
+	}}
+	at := func(minute int) time.Time {
+		return time.Date(2026, 1, 2, 3, minute, 0, 0, time.UTC)
+	}
+	now := at(0)
+	clock := func() time.Time { return now }
+	walPath := filepath.Join(t.TempDir(), "zenith.wal")
+	db, err := Open(ctx, schema, Options{WALPath: walPath, Clock: clock})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := tx.Create(ctx, "User", Record{"id": "u1", "posts": NestedWrite{Create: []Record{{"title": "draft"}}}}); err != nil {
+		t.Fatalf("tx nested create: %v", err)
+	}
+	posts, err := tx.FindMany(ctx, "Post", Query{})
+	if err != nil || len(posts) != 1 {
+		t.Fatalf("expected the transaction to see the nested post, got %+v err=%v", posts, err)
+	}
+	staged := posts[0]
+	now = at(1)
+	if _, err := tx.Update(ctx, "Post", map[string]any{"id": staged["id"]}, Record{"title": "edited"}); err != nil {
+		t.Fatalf("tx update by the generated id: %v", err)
+	}
+	now = at(2)
+	if _, err := tx.Update(ctx, "User", map[string]any{"id": "u1"}, Record{"posts": NestedWrite{Update: []NestedUpdate{{Where: map[string]any{"id": staged["id"]}, Data: Record{"title": "final"}}}}}); err != nil {
+		t.Fatalf("tx nested update: %v", err)
+	}
+	now = at(3)
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close db: %v", err)
+	}
+
+	now = at(59)
+	reopened, err := Open(ctx, schema, Options{WALPath: walPath, Clock: clock})
+	if err != nil {
+		t.Fatalf("reopen db: %v", err)
+	}
+	defer reopened.Close()
+	committed, ok, err := reopened.FindUnique(ctx, "Post", map[string]any{"id": staged["id"]}, nil, nil)
+	if err != nil || !ok || committed["number"] != staged["number"] || committed["title"] != "final" || !committed["updatedAt"].(time.Time).Equal(at(2)) {
+		t.Fatalf("expected commit to store the values the transaction saw, got %+v ok=%v err=%v", committed, ok, err)
+	}
+}
+
+func TestJSONAndBytesFieldsRoundTripAndFilter(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{{
+		Name: "Asset",
+		Fields: []Field{
+			{Name: "id", Kind: FieldString, Required: true},
+			{Name: "meta", Kind: FieldJSON},
+			{Name: "digest", Kind: FieldBytes, Required: true},
+		},
+		PrimaryKey: []string{"id"},
+		Indexes:    []Index{{Name: "asset_digest", Fields: []string{"digest"}, Unique: true}},
+	}}}
+	meta := map[string]any{"size": int64(3), "tags": []any{"red", "big"}, "dims": map[string]any{"w": 1.5, "h": int64(2)}}
+
+	for _, format := range []WALFormat{WALFormatJSONL, WALFormatBinary} {
+		walPath := filepath.Join(t.TempDir(), "zenith.wal")
+		db, err := Open(ctx, schema, Options{WALPath: walPath, WALFormat: format})
+		if err != nil {
+			t.Fatalf("open db: %v", err)
+		}
+		created, err := db.Create(ctx, "Asset", Record{"id": "a1", "meta": json.RawMessage(`{"size": 3.0, "tags": ["red", "big"], "dims": {"w": 1.5, "h": 2}}`), "digest": []byte{0, 1, 2}})
+		if err != nil || !reflect.DeepEqual(created.Record["meta"], meta) {
+			t.Fatalf("expected raw JSON to normalize to %v, got %+v err=%v", meta, created.Record, err)
+		}
+		if _, err := db.Create(ctx, "Asset", Record{"id": "a2", "meta": []string{"plain"}, "digest": []byte{9}}); err != nil {
+			t.Fatalf("create asset: %v", err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatalf("close db: %v", err)
+		}
+
+		reopened, err := Open(ctx, schema, Options{WALPath: walPath, WALFormat: format})
+		if err != nil {
+			t.Fatalf("reopen db: %v", err)
+		}
+		replayed, ok, err := reopened.FindUnique(ctx, "Asset", map[string]any{"digest": []byte{0, 1, 2}}, nil, nil)
+		if err != nil || !ok || replayed["id"] != "a1" || !reflect.DeepEqual(replayed["meta"], meta) {
+			t.Fatalf("expected WAL format %d to replay a1 by its digest, got %+v ok=%v err=%v", format, replayed, ok, err)
+		}
+
+		snapshotPath := filepath.Join(t.TempDir(), "snapshot.json")
+		if err := reopened.Snapshot(ctx, snapshotPath); err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+		loaded, err := Open(ctx, schema, Options{})
+		if err != nil {
+			t.Fatalf("open db: %v", err)
+		}
+		if err := loaded.LoadSnapshot(ctx, snapshotPath); err != nil {
+			t.Fatalf("load snapshot: %v", err)
+		}
+		restored, ok, err := loaded.FindUnique(ctx, "Asset", map[string]any{"id": "a2"}, nil, nil)
+		if err != nil || !ok || !reflect.DeepEqual(restored["meta"], []any{"plain"}) || !bytes.Equal(restored["digest"].([]byte), []byte{9}) {
+			t.Fatalf("expected the snapshot to restore a2, got %+v ok=%v err=%v", restored, ok, err)
+		}
+		_ = reopened.Close()
+		_ = loaded.Close()
+	}
+
+	db, err := Open(ctx, schema, Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	for id, value := range map[string]any{"a1": meta, "a2": map[string]any{"size": int64(9), "tags": []any{"blue"}}, "a3": "untagged"} {
+		if _, err := db.Create(ctx, "Asset", Record{"id": id, "meta": value, "digest": []byte(id)}); err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+	for _, tc := range []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"equals at a path", Filter{Path: []string{"dims", "h"}, Equals: 2.0}, []string{"a1"}},
+		{"equals a whole value", Filter{Equals: "untagged"}, []string{"a3"}},
+		{"array contains one value", Filter{Path: []string{"tags"}, ArrayContains: "blue"}, []string{"a2"}},
+		{"array contains every value", Filter{Path: []string{"tags"}, ArrayContains: []any{"big", "red"}}, []string{"a1"}},
+		{"array index", Filter{Path: []string{"tags", "0"}, Equals: "red"}, []string{"a1"}},
+		{"range at a path", Filter{Path: []string{"size"}, GT: int64(5)}, []string{"a2"}},
+		{"range against a whole float", Filter{Path: []string{"dims", "w"}, LT: 2.0}, []string{"a1"}},
+		{"range against a fraction", Filter{Path: []string{"size"}, LTE: 3.5}, []string{"a1"}},
+		{"range skips a string", Filter{GTE: int64(0)}, nil},
+		{"range skips an object", Filter{Path: []string{"dims"}, GT: int64(0)}, nil},
+	} {
+		records, err := db.FindMany(ctx, "Asset", Query{Filters: map[string]Filter{"meta": tc.filter}, OrderBy: []OrderBy{{Field: "id"}}})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, record["id"].(string))
+		}
+		if !slices.Equal(ids, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, ids)
+		}
+	}
+
+	for id, score := range map[string]any{"s1": 2.5, "s2": int64(4), "s3": "x"} {
+		if _, err := db.Create(ctx, "Asset", Record{"id": id, "meta": map[string]any{"score": score}, "digest": []byte(id)}); err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+	for _, tc := range []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"greater than an int", Filter{Path: []string{"score"}, GT: 3}, []string{"s2"}},
+		{"less than a whole float", Filter{Path: []string{"score"}, LT: 3.0}, []string{"s1"}},
+		{"between a float and an int", Filter{Path: []string{"score"}, GTE: 2.5, LTE: 4}, []string{"s1", "s2"}},
+		{"string bound skips numbers", Filter{Path: []string{"score"}, GTE: "a"}, []string{"s3"}},
+	} {
+		records, err := db.FindMany(ctx, "Asset", Query{Filters: map[string]Filter{"meta": tc.filter}, OrderBy: []OrderBy{{Field: "id"}}})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, record["id"].(string))
+		}
+		if !slices.Equal(ids, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, ids)
+		}
+	}
+
+	if _, err := db.FindMany(ctx, "Asset", Query{Filters: map[string]Filter{"id": {Path: []string{"a"}, Equals: "x"}}}); err == nil || !strings.Contains(err.Error(), "need a json field") {
+		t.Fatalf("expected a path filter on a string field to fail, got %v", err)
+	}
+	if _, err := db.Create(ctx, "Asset", Record{"id": "a4", "meta": json.RawMessage(`{"open":`), "digest": []byte("a4")}); err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Fatalf("expected malformed JSON to fail, got %v", err)
+	}
+	for _, encoded := range []string{"hello", "AAEC"} {
+		if _, err := db.Create(ctx, "Asset", Record{"id": "a5", "digest": encoded}); err == nil || !strings.Contains(err.Error(), "expected []byte") {
+			t.Fatalf("expected the string %q for a bytes field to fail, got %v", encoded, err)
+		}
+	}
+	invalid := Schema{Models: []Model{{Name: "Blob", Fields: []Field{{Name: "id", Kind: FieldBytes}}, PrimaryKey: []string{"id"}}}}
+	if err := invalid.Validate(); err == nil || !strings.Contains(err.Error(), "cannot be of kind bytes") {
+		t.Fatalf("expected a bytes primary key to fail, got %v", err)
+	}
+}
+
+func TestScalarListFieldsFilterUpdateAndIndex(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{{
+		Name: "Article",
+		Fields: []Field{
+			{Name: "id", Kind: FieldString, Required: true},
+			{Name: "tags", Kind: FieldString, List: true},
+			{Name: "scores", Kind: FieldInt64, List: true},
+		},
+		PrimaryKey: []string{"id"},
+		Indexes:    []Index{{Name: "article_tags", Fields: []string{"tags"}}},
+	}}}
+	walPath := filepath.Join(t.TempDir(), "zenith.wal")
+	db, err := Open(ctx, schema, Options{WALPath: walPath})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	for id, tags := range map[string][]string{"a1": {"go", "db", "go"}, "a2": {"db"}, "a3": nil} {
+		if _, err := db.Create(ctx, "Article", Record{"id": id, "tags": tags, "scores": []int{1, 2}}); err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+	if _, err := db.Update(ctx, "Article", map[string]any{"id": "a2"}, Record{"tags": ListUpdate{Push: []any{"rust"}}}); err != nil {
+		t.Fatalf("push tags: %v", err)
+	}
+	if _, err := db.Update(ctx, "Article", map[string]any{"id": "a1"}, Record{"tags": ListUpdate{Set: []any{"go"}, Push: []any{"web"}}, "scores": ListUpdate{Set: []any{}}}); err != nil {
+		t.Fatalf("set tags: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close db: %v", err)
+	}
+
+	db, err = Open(ctx, schema, Options{WALPath: walPath})
+	if err != nil {
+		t.Fatalf("reopen db: %v", err)
+	}
+	defer db.Close()
+	replayed, ok, err := db.FindUnique(ctx, "Article", map[string]any{"id": "a1"}, nil, nil)
+	if err != nil || !ok || !reflect.DeepEqual(replayed["tags"], []any{"go", "web"}) || !reflect.DeepEqual(replayed["scores"], []any{}) {
+		t.Fatalf("expected the WAL to replay the resolved lists of a1, got %+v ok=%v err=%v", replayed, ok, err)
+	}
+
+	empty, notEmpty := true, false
+	for _, tc := range []struct {
+		name   string
+		field  string
+		filter Filter
+		want   []string
+	}{
+		{"has", "tags", Filter{Has: "db"}, []string{"a2"}},
+		{"has a pushed value", "tags", Filter{Has: "rust"}, []string{"a2"}},
+		{"has some", "tags", Filter{HasSome: []any{"web", "rust"}}, []string{"a1", "a2"}},
+		{"has every", "tags", Filter{HasEvery: []any{"db", "rust"}}, []string{"a2"}},
+		{"is empty", "tags", Filter{IsEmpty: &empty}, []string{"a3"}},
+		{"is not empty", "scores", Filter{IsEmpty: &notEmpty}, []string{"a2", "a3"}},
+		{"equals", "scores", Filter{Equals: []int64{1, 2}}, []string{"a2", "a3"}},
+	} {
+		records, err := db.FindMany(ctx, "Article", Query{Filters: map[string]Filter{tc.field: tc.filter}, OrderBy: []OrderBy{{Field: "id"}}})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, record["id"].(string))
+		}
+		if !slices.Equal(ids, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, ids)
+		}
+	}
+
+	plan, err := db.Explain(ctx, "Article", Query{Filters: map[string]Filter{"tags": {Has: "db"}}})
+	if err != nil || plan.Access != PlanIndex || !slices.Equal(plan.Indexes, []string{"article_tags"}) {
+		t.Fatalf("expected has to read the multi-valued index, got %+v err=%v", plan, err)
+	}
+	plan, err = db.Explain(ctx, "Article", Query{Filters: map[string]Filter{"tags": {HasSome: []any{"db", "go"}}}})
+	if err != nil || plan.Access != PlanFullScan {
+		t.Fatalf("expected has some to scan, got %+v err=%v", plan, err)
+	}
+
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := db.Snapshot(ctx, snapshotPath); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	loaded, err := Open(ctx, schema, Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer loaded.Close()
+	if err := loaded.LoadSnapshot(ctx, snapshotPath); err != nil {
+		t.Fatalf("load snapshot: %v", err)
+	}
+	restored, err := loaded.FindMany(ctx, "Article", Query{Filters: map[string]Filter{"tags": {Has: "go"}}})
+	if err != nil || len(restored) != 1 || !reflect.DeepEqual(restored[0]["scores"], []any{}) {
+		t.Fatalf("expected the snapshot to restore a1 under go, got %+v err=%v", restored, err)
+	}
+
+	if _, err := db.Create(ctx, "Article", Record{"id": "a4", "tags": []any{"go", nil}}); err == nil || !strings.Contains(err.Error(), "list element 1 is null") {
+		t.Fatalf("expected a null list element to fail, got %v", err)
+	}
+	if _, err := db.Create(ctx, "Article", Record{"id": "a4", "scores": []any{"one"}}); err == nil {
+		t.Fatal("expected a string in an int list to fail")
+	}
+	if _, err := db.FindMany(ctx, "Article", Query{Filters: map[string]Filter{"tags": {Contains: "g"}}}); err == nil || !strings.Contains(err.Error(), "not a list") {
+		t.Fatalf("expected contains on a list to fail, got %v", err)
+	}
+	if _, err := db.FindMany(ctx, "Article", Query{Filters: map[string]Filter{"id": {Has: "a1"}}}); err == nil || !strings.Contains(err.Error(), "need a list field") {
+		t.Fatalf("expected has on a string field to fail, got %v", err)
+	}
+	if _, err := db.Update(ctx, "Article", map[string]any{"id": "a1"}, Record{"id": ListUpdate{Push: []any{"x"}}}); err == nil || !strings.Contains(err.Error(), "is not a list") {
+		t.Fatalf("expected push to a string field to fail, got %v", err)
+	}
+	invalid := schema
+	invalid.Models = []Model{schema.Models[0]}
+	invalid.Models[0].Indexes = []Index{{Name: "article_tags", Fields: []string{"tags"}, Unique: true}}
+	if err := invalid.Validate(); err == nil || !strings.Contains(err.Error(), "non-unique hash index") {
+		t.Fatalf("expected a unique index over a list to fail, got %v", err)
+	}
+}
+
+func TestOptionalFieldsNullFiltersOrderingAndIndexes(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{{
+		Name: "Member",
+		Fields: []Field{
+			{Name: "id", Kind: FieldString, Required: true},
+			{Name: "handle", Kind: FieldString},
+			{Name: "city", Kind: FieldString},
+			{Name: "score", Kind: FieldInt64},
+		},
+		PrimaryKey: []string{"id"},
+		Indexes: []Index{
+			{Name: "member_handle", Fields: []string{"handle"}, Unique: true},
+			{Name: "member_city", Fields: []string{"city"}},
+			{Name: "member_score", Fields: []string{"score"}, Type: IndexOrdered},
+		},
+	}}}
+	db, err := Open(ctx, schema, Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	for _, record := range []Record{
+		{"id": "m1", "handle": "ann", "city": "Oslo", "score": 3},
+		{"id": "m2", "handle": nil, "score": nil},
+		{"id": "m3", "score": 1},
+		{"id": "m4", "handle": "bob", "city": "Oslo"},
+	} {
+		if _, err := db.Create(ctx, "Member", record); err != nil {
+			t.Fatalf("create %s: %v", record["id"], err)
+		}
+	}
+	if _, err := db.Create(ctx, "Member", Record{"id": "m5", "handle": "ann"}); err == nil {
+		t.Fatal("expected a duplicate handle to fail")
+	}
+	if _, err := db.Update(ctx, "Member", map[string]any{"id": "m4"}, Record{"handle": nil}); err != nil {
+		t.Fatalf("clear handle: %v", err)
+	}
+
+	ids := func(records []Record) []string {
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, record["id"].(string))
+		}
+		return ids
+	}
+	for _, tc := range []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"is null", Query{Filters: map[string]Filter{"handle": {IsNull: true}}, OrderBy: []OrderBy{{Field: "id"}}}, []string{"m2", "m3", "m4"}},
+		{"is not null", Query{Filters: map[string]Filter{"city": {IsNotNull: true}}, OrderBy: []OrderBy{{Field: "id"}}}, []string{"m1", "m4"}},
+		{"range skips null", Query{Filters: map[string]Filter{"score": {LT: int64(5)}}, OrderBy: []OrderBy{{Field: "id"}}}, []string{"m1", "m3"}},
+		{"not keeps null", Query{FilterExpr: &FilterExpr{Not: &FilterExpr{Field: "score", Filter: Filter{Equals: int64(3)}}}, OrderBy: []OrderBy{{Field: "id"}}}, []string{"m2", "m3", "m4"}},
+		{"nulls first ascending", Query{OrderBy: []OrderBy{{Field: "score"}, {Field: "id"}}}, []string{"m2", "m4", "m3", "m1"}},
+		{"nulls last descending", Query{OrderBy: []OrderBy{{Field: "score", Direction: SortDesc}, {Field: "id"}}}, []string{"m1", "m3", "m2", "m4"}},
+		{"nulls last ascending", Query{OrderBy: []OrderBy{{Field: "score", Nulls: NullsLast}, {Field: "id"}}}, []string{"m3", "m1", "m2", "m4"}},
+		{"nulls first descending", Query{OrderBy: []OrderBy{{Field: "score", Direction: SortDesc, Nulls: NullsFirst}, {Field: "id"}}}, []string{"m2", "m4", "m1", "m3"}},
+		{"index nulls last ascending", Query{OrderBy: []OrderBy{{Field: "score", Nulls: NullsLast}}, Limit: 3}, []string{"m3", "m1", "m2"}},
+		{"index nulls first descending", Query{OrderBy: []OrderBy{{Field: "score", Direction: SortDesc, Nulls: NullsFirst}}, Limit: 3}, []string{"m4", "m2", "m1"}},
+		{"index range nulls last", Query{Filters: map[string]Filter{"score": {GTE: int64(0)}}, OrderBy: []OrderBy{{Field: "score", Nulls: NullsLast}}}, []string{"m3", "m1"}},
+	} {
+		records, err := db.FindMany(ctx, "Member", tc.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := ids(records); !slices.Equal(got, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+
+	for _, nulls := range []NullsOrder{NullsFirst, NullsLast} {
+		plan, err := db.Explain(ctx, "Member", Query{OrderBy: []OrderBy{{Field: "score", Nulls: nulls}}, Limit: 2})
+		if err != nil || !plan.Ordered || !slices.Equal(plan.Indexes, []string{"member_score"}) {
+			t.Fatalf("expected nulls %s to read the score index in order, got %+v err=%v", nulls, plan, err)
+		}
+	}
+	if _, err := db.FindMany(ctx, "Member", Query{OrderBy: []OrderBy{{Field: "score", Nulls: "middle"}}}); err == nil || !strings.Contains(err.Error(), "unsupported nulls order") {
+		t.Fatalf("expected an unknown nulls order to fail, got %v", err)
+	}
+	groups, err := db.GroupBy(ctx, "Member", GroupByQuery{AggregateQuery: AggregateQuery{CountAll: true}, By: []string{"city"}, OrderBy: []GroupOrderBy{{Field: "city", Nulls: NullsLast}}})
+	if err != nil || len(groups) != 2 || groups[0].Key["city"] != "Oslo" || groups[1].Key["city"] != nil {
+		t.Fatalf("expected the null city group last, got %+v err=%v", groups, err)
+	}
+
+	plan, err := db.Explain(ctx, "Member", Query{Filters: map[string]Filter{"city": {IsNull: true}}})
+	if err != nil || plan.Access != PlanIndex || !slices.Equal(plan.Indexes, []string{"member_city"}) {
+		t.Fatalf("expected is null to read the city index, got %+v err=%v", plan, err)
+	}
+	records, err := db.FindMany(ctx, "Member", Query{Filters: map[string]Filter{"city": {IsNull: true}}, Index: "member_city"})
+	if err != nil || !slices.Equal(ids(records), []string{"m2", "m3"}) {
+		t.Fatalf("expected the city index to hold the missing and null cities, got %v err=%v", ids(records), err)
+	}
+	records, err = db.FindMany(ctx, "Member", Query{Filters: map[string]Filter{"score": {GTE: int64(0)}}, Index: "member_score"})
+	if err != nil || !slices.Equal(ids(records), []string{"m3", "m1"}) {
+		t.Fatalf("expected the ordered score range to skip nulls, got %v err=%v", ids(records), err)
+	}
+	if _, ok, err := db.FindUnique(ctx, "Member", map[string]any{"handle": nil}, nil, nil); err != nil || ok {
+		t.Fatalf("expected no record to be unique under a null handle, got ok=%v err=%v", ok, err)
+	}
+
+	required := schema
+	required.Models = []Model{schema.Models[0]}
+	required.Models[0].Fields = []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "name", Kind: FieldString, Required: true}}
+	required.Models[0].Indexes = nil
+	strict, err := Open(ctx, required, Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer strict.Close()
+	if _, err := strict.Create(ctx, "Member", Record{"id": "m1", "name": nil}); err == nil || !strings.Contains(err.Error(), `field "name" is required and cannot be null`) {
+		t.Fatalf("expected a null required field to fail, got %v", err)
+	}
+}
+
+func TestValidationRulesCheckWrites(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{{
+		Name: "Account",
+		Fields: []Field{
+			{Name: "id", Kind: FieldString, Required: true},
+			{Name: "email", Kind: FieldString, Required: true, Validations: []Validation{{Rule: RuleEmail}}},
+			{Name: "handle", Kind: FieldString, Validations: []Validation{{Rule: RuleMinLength, Limit: 3}, {Rule: RuleMaxLength, Limit: 8}, {Rule: RulePattern, Pattern: "^[a-z]+$"}}},
+			{Name: "age", Kind: FieldInt64, Validations: []Validation{{Rule: RuleMin, Limit: 13}, {Rule: RuleMax, Limit: 130}}},
+		},
+		PrimaryKey: []string{"id"},
+		Indexes:    []Index{{Name: "account_handle", Fields: []string{"handle"}, Unique: true}},
+	}}}
+	db, err := Open(ctx, schema, Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Create(ctx, "Account", Record{"id": "a1", "email": "ada@example.com", "handle": "ada", "age": 36}); err != nil {
+		t.Fatalf("create valid account: %v", err)
+	}
+	if _, err := db.Create(ctx, "Account", Record{"id": "a2", "email": "grace@example.com", "handle": nil}); err != nil {
+		t.Fatalf("expected null to satisfy every rule, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		write func() error
+		field string
+		rule  ValidationRule
+	}{
+		{"email", func() error {
+			_, err := db.Create(ctx, "Account", Record{"id": "a3", "email": "Ada <ada@example.com>"})
+			return err
+		}, "email", RuleEmail},
+		{"min length", func() error {
+			_, err := db.Create(ctx, "Account", Record{"id": "a3", "email": "x@example.com", "handle": "ab"})
+			return err
+		}, "handle", RuleMinLength},
+		{"pattern", func() error {
+			_, err := db.Create(ctx, "Account", Record{"id": "a3", "email": "x@example.com", "handle": "Ab_c"})
+			return err
+		}, "handle", RulePattern},
+		{"max on update", func() error {
+			_, err := db.Update(ctx, "Account", map[string]any{"id": "a1"}, Record{"age": 200})
+			return err
+		}, "age", RuleMax},
+		{"max length in a batch", func() error {
+			_, err := db.Batch(ctx, []BatchOperation{
+				{Type: BatchCreate, Model: "Account", Record: Record{"id": "a3", "email": "x@example.com"}},
+				{Type: BatchUpdate, Model: "Account", Where: map[string]any{"id": "a2"}, Record: Record{"handle": "gracehopper"}},
+			})
+			return err
+		}, "handle", RuleMaxLength},
+		{"min in update many", func() error {
+			_, err := db.UpdateMany(ctx, "Account", Query{}, Record{"age": 12})
+			return err
+		}, "age", RuleMin},
+	} {
+		var validation *ValidationError
+		if err := tc.write(); !errors.As(err, &validation) || validation.Model != "Account" || validation.Field != tc.field || validation.Rule != tc.rule {
+			t.Fatalf("%s: expected a %s validation error on %s, got %v", tc.name, tc.rule, tc.field, err)
+		}
+	}
+	if count, err := db.Count(ctx, "Account", Query{}); err != nil || count != 2 {
+		t.Fatalf("expected failed writes to leave two accounts, got %d err=%v", count, err)
+	}
+	if _, ok, err := db.FindUnique(ctx, "Account", map[string]any{"handle": "x"}, nil, nil); err != nil || ok {
+		t.Fatalf("expected lookups to skip validation rules, got ok=%v err=%v", ok, err)
+	}
+
+	if err := schema.ValidateValue("Account", "age", 12); err == nil || err.Error() != `model "Account" field "age" fails min: must be at least 13, got 12` {
+		t.Fatalf("expected ValidateValue to check min, got %v", err)
+	}
+	if err := schema.ValidateValue("Account", "handle", "bob"); err != nil {
+		t.Fatalf("expected a valid handle, got %v", err)
+	}
+	for _, tc := range []struct {
+		field Field
+		err   string
+	}{
+		{Field{Name: "age", Kind: FieldInt64, Validations: []Validation{{Rule: RuleEmail}}}, "of kind int64 cannot have the email rule"},
+		{Field{Name: "handle", Kind: FieldString, Validations: []Validation{{Rule: RulePattern, Pattern: "("}}}, "invalid pattern"},
+		{Field{Name: "handle", Kind: FieldString, Validations: []Validation{{Rule: RuleMaxLength, Limit: 2.5}}}, "whole number of characters"},
+		{Field{Name: "tags", Kind: FieldString, List: true, Validations: []Validation{{Rule: RuleEmail}}}, "cannot have validation rules"},
+	} {
+		invalid := Schema{Models: []Model{{Name: "Account", Fields: []Field{{Name: "id", Kind: FieldString, Required: true}, tc.field}, PrimaryKey: []string{"id"}}}}
+		if err := invalid.Validate(); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("expected %q, got %v", tc.err, err)
+		}
+	}
+}
+
+func TestReferentialActionsCascadeAndSetNull(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{
+		{
+			Name:       "User",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "email", Kind: FieldString, Required: true}},
+			PrimaryKey: []string{"id"},
+			Indexes:    []Index{{Name: "user_email", Fields: []string{"email"}, Unique: true}},
+		},
+		{
+			Name:       "Post",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "authorId", Kind: FieldString, Required: true}},
+			PrimaryKey: []string{"id"},
+			Indexes:    []Index{{Name: "post_author", Fields: []string{"authorId"}}},
+			Relations:  []Relation{{Name: "author", Model: "User", Fields: []string{"authorId"}, References: []string{"id"}, ForeignKey: true, OnDelete: ActionCascade}},
+		},
+		{
+			Name:       "Comment",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "postId", Kind: FieldString, Required: true}},
+			PrimaryKey: []string{"id"},
+			Relations:  []Relation{{Name: "post", Model: "Post", Fields: []string{"postId"}, References: []string{"id"}, ForeignKey: true, OnDelete: ActionCascade}},
+		},
+		{
+			Name:       "Like",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "postId", Kind: FieldString, Required: true}},
+			PrimaryKey: []string{"id"},
+			Relations:  []Relation{{Name: "post", Model: "Post", Fields: []string{"postId"}, References: []string{"id"}, ForeignKey: true}},
+		},
+		{
+			Name:       "Profile",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "userEmail", Kind: FieldString}},
+			PrimaryKey: []string{"id"},
+			Relations:  []Relation{{Name: "user", Model: "User", Fields: []string{"userEmail"}, References: []string{"email"}, ForeignKey: true, OnDelete: ActionSetNull, OnUpdate: ActionCascade}},
+		},
+	}}
+	walPath := filepath.Join(t.TempDir(), "zenith.wal")
+	db, err := Open(ctx, schema, Options{WALPath: walPath})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if _, err := db.Batch(ctx, []BatchOperation{
+		{Type: BatchCreate, Model: "User", Record: Record{"id": "u1", "email": "ada@example.com"}},
+		{Type: BatchCreate, Model: "User", Record: Record{"id": "u2", "email": "grace@example.com"}},
+		{Type: BatchCreate, Model: "Post", Record: Record{"id": "p1", "authorId": "u1"}},
+		{Type: BatchCreate, Model: "Post", Record: Record{"id": "p2", "authorId": "u1"}},
+		{Type: BatchCreate, Model: "Post", Record: Record{"id": "p3", "authorId": "u2"}},
+		{Type: BatchCreate, Model: "Comment", Record: Record{"id": "c1", "postId": "p1"}},
+		{Type: BatchCreate, Model: "Comment", Record: Record{"id": "c2", "postId": "p2"}},
+		{Type: BatchCreate, Model: "Like", Record: Record{"id": "l1", "postId": "p3"}},
+		{Type: BatchCreate, Model: "Profile", Record: Record{"id": "pr1", "userEmail": "ada@example.com"}},
+	}); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	count := func(db *DB, model string) int {
+		t.Helper()
+		count, err := db.Count(ctx, model, Query{})
+		if err != nil {
+			t.Fatalf("count %s: %v", model, err)
+		}
+		return count
+	}
+
+	if _, err := db.Update(ctx, "User", map[string]any{"id": "u1"}, Record{"email": "lovelace@example.com"}); err != nil {
+		t.Fatalf("update email: %v", err)
+	}
+	profile, _, err := db.FindUnique(ctx, "Profile", map[string]any{"id": "pr1"}, nil, nil)
+	if err != nil || profile["userEmail"] != "lovelace@example.com" {
+		t.Fatalf("expected the profile email to follow the update, got %+v err=%v", profile, err)
+	}
+
+	// Deleting u2 cascades to p3, which a like restricts, so nothing changes.
+	if _, err := db.Delete(ctx, "User", map[string]any{"id": "u2"}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected the cascade to stop at the restricted like, got %v", err)
+	}
+	if count(db, "User") != 2 || count(db, "Post") != 3 {
+		t.Fatal("a restricted cascade deleted records")
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := tx.Delete(ctx, "User", map[string]any{"id": "u2"}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected the tx cascade to stop at the restricted like, got %v", err)
+	}
+	if _, ok, err := tx.FindUnique(ctx, "Post", map[string]any{"id": "p3"}, nil, nil); err != nil || !ok {
+		t.Fatalf("a failed tx cascade staged a delete: found=%v err=%v", ok, err)
+	}
+	if _, err := tx.Delete(ctx, "User", map[string]any{"id": "u1"}); err != nil {
+		t.Fatalf("tx cascade: %v", err)
+	}
+	if comments, err := tx.FindMany(ctx, "Comment", Query{}); err != nil || len(comments) != 0 {
+		t.Fatalf("expected the tx to see cascaded comments gone, got %v err=%v", comments, err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+
+	if _, err := db.Delete(ctx, "User", map[string]any{"id": "u1"}); err != nil {
+		t.Fatalf("cascading delete: %v", err)
+	}
+	if count(db, "User") != 1 || count(db, "Post") != 1 || count(db, "Comment") != 0 {
+		t.Fatalf("expected u1, its posts and their comments deleted, got %d users %d posts %d comments", count(db, "User"), count(db, "Post"), count(db, "Comment"))
+	}
+	profile, _, err = db.FindUnique(ctx, "Profile", map[string]any{"id": "pr1"}, nil, nil)
+	if err != nil || profile["userEmail"] != nil {
+		t.Fatalf("expected the profile email cleared, got %+v err=%v", profile, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close db: %v", err)
+	}
+
+	// The delete and everything it cascaded to is one WAL entry.
+	raw, err := os.ReadFile(walPath)
+	if err != nil {
+		t.Fatalf("read wal: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[2], `"type":"batch"`) || strings.Count(lines[2], `"type":"delete"`) != 5 {
+		t.Fatalf("expected seed, update, and one delete batch, got:\n%s", raw)
+	}
+
+	reopened, err := Open(ctx, schema, Options{WALPath: walPath})
+	if err != nil {
+		t.Fatalf("reopen db: %v", err)
+	}
+	defer reopened.Close()
+	if count(reopened, "User") != 1 || count(reopened, "Post") != 1 || count(reopened, "Comment") != 0 || count(reopened, "Profile") != 1 {
+		t.Fatal("replay did not restore the cascaded state")
+	}
+	profile, _, err = reopened.FindUnique(ctx, "Profile", map[string]any{"id": "pr1"}, nil, nil)
+	if err != nil || profile["userEmail"] != nil {
+		t.Fatalf("expected the replayed profile email cleared, got %+v err=%v", profile, err)
+	}
+}
+
+func TestNestedWritesApplyAsOneBatch(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{
+		{
+			Name:       "User",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "email", Kind: FieldString, Required: true}},
+			PrimaryKey: []string{"id"},
+			Indexes:    []Index{{Name: "user_email", Fields: []string{"email"}, Unique: true}},
+			Relations: []Relation{
+				{Name: "posts", Model: "Post", Fields: []string{"id"}, References: []string{"authorId"}, Many: true},
+				{Name: "profile", Model: "Profile", Fields: []string{"id"}, References: []string{"userId"}},
+			},
+		},
+		{
+			Name:       "Post",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "authorId", Kind: FieldString}, {Name: "title", Kind: FieldString}},
+			PrimaryKey: []string{"id"},
+			Indexes:    []Index{{Name: "post_author", Fields: []string{"authorId"}}},
+			Relations:  []Relation{{Name: "author", Model: "User", Fields: []string{"authorId"}, References: []string{"id"}, ForeignKey: true}},
+		},
+		{
+			Name:       "Profile",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "userId", Kind: FieldString}, {Name: "bio", Kind: FieldString}},
+			PrimaryKey: []string{"id"},
+			Indexes:    []Index{{Name: "profile_user", Fields: []string{"userId"}, Unique: true}},
+			Relations:  []Relation{{Name: "user", Model: "User", Fields: []string{"userId"}, References: []string{"id"}, ForeignKey: true}},
+		},
+	}}
+	walPath := filepath.Join(t.TempDir(), "zenith.wal")
+	db, err := Open(ctx, schema, Options{WALPath: walPath})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	authors := func(db *DB) map[string]any {
+		t.Helper()
+		posts, err := db.FindMany(ctx, "Post", Query{})
+		if err != nil {
+			t.Fatalf("find posts: %v", err)
+		}
+		authors := make(map[string]any, len(posts))
+		for _, post := range posts {
+			authors[post["id"].(string)] = post["authorId"]
+		}
+		return authors
+	}
+
+	if _, err := db.Create(ctx, "User", Record{
+		"id":      "u1",
+		"email":   "ada@example.com",
+		"posts":   NestedWrite{Create: []Record{{"id": "p1"}, {"id": "p2"}}},
+		"profile": NestedWrite{Create: []Record{{"id": "pr1"}}},
+	}); err != nil {
+		t.Fatalf("create with nested writes: %v", err)
+	}
+	if _, err := db.Create(ctx, "Post", Record{
+		"id":     "p3",
+		"author": NestedWrite{ConnectOrCreate: []ConnectOrCreate{{Where: map[string]any{"email": "grace@example.com"}, Create: Record{"id": "u2", "email": "grace@example.com"}}}},
+	}); err != nil {
+		t.Fatalf("create with connectOrCreate: %v", err)
+	}
+	got := authors(db)
+	if got["p1"] != "u1" || got["p2"] != "u1" || got["p3"] != "u2" {
+		t.Fatalf("expected nested creates to connect their records, got %v", got)
+	}
+	profile, _, err := db.FindUnique(ctx, "Profile", map[string]any{"id": "pr1"}, nil, nil)
+	if err != nil || profile["userId"] != "u1" {
+		t.Fatalf("expected the nested profile connected to u1, got %+v err=%v", profile, err)
+	}
+
+	updated, err := db.Update(ctx, "User", map[string]any{"id": "u1"}, Record{
+		"email": "lovelace@example.com",
+		"posts": NestedWrite{
+			Create:     []Record{{"id": "p4"}},
+			Connect:    []map[string]any{{"id": "p3"}},
+			Disconnect: []map[string]any{{"id": "p1"}},
+			Update:     []NestedUpdate{{Where: map[string]any{"id": "p2"}, Data: Record{"title": "Notes"}}},
+		},
+		"profile": NestedWrite{Update: []NestedUpdate{{Data: Record{"bio": "Analyst"}}}},
+	})
+	if err != nil {
+		t.Fatalf("update with nested writes: %v", err)
+	}
+	if updated["email"] != "lovelace@example.com" {
+		t.Fatalf("expected the update to return the user, got %+v", updated)
+	}
+	got = authors(db)
+	if got["p1"] != nil || got["p3"] != "u1" || got["p4"] != "u1" {
+		t.Fatalf("expected p1 disconnected and p3, p4 connected, got %v", got)
+	}
+	post, _, err := db.FindUnique(ctx, "Post", map[string]any{"id": "p2"}, nil, nil)
+	if err != nil || post["title"] != "Notes" {
+		t.Fatalf("expected the nested update of p2, got %+v err=%v", post, err)
+	}
+	profile, _, err = db.FindUnique(ctx, "Profile", map[string]any{"id": "pr1"}, nil, nil)
+	if err != nil || profile["bio"] != "Analyst" {
+		t.Fatalf("expected the nested update of the profile, got %+v err=%v", profile, err)
+	}
+
+	if _, err := db.Update(ctx, "User", map[string]any{"id": "u1"}, Record{"posts": NestedWrite{Set: []map[string]any{{"id": "p1"}, {"id": "p2"}}}}); err != nil {
+		t.Fatalf("set posts: %v", err)
+	}
+	got = authors(db)
+	if got["p1"] != "u1" || got["p2"] != "u1" || got["p3"] != nil || got["p4"] != nil {
+		t.Fatalf("expected set to connect exactly p1 and p2, got %v", got)
+	}
+
+	// A nested write that fails undoes the whole tree.
+	if _, err := db.Update(ctx, "User", map[string]any{"id": "u1"}, Record{"posts": NestedWrite{
+		Create: []Record{{"id": "p5"}},
+		Delete: []map[string]any{{"id": "p3"}},
+	}}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected deleting an unconnected post to fail, got %v", err)
+	}
+	if _, err := db.Create(ctx, "User", Record{"id": "u3", "email": "hopper@example.com", "posts": NestedWrite{Connect: []map[string]any{{"id": "missing"}}}}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected connecting a missing post to fail, got %v", err)
+	}
+	if _, err := db.Create(ctx, "User", Record{"id": "u3", "email": "hopper@example.com", "posts": NestedWrite{Disconnect: []map[string]any{{"id": "p1"}}}}); err == nil {
+		t.Fatal("expected a disconnect on a record being created to fail")
+	}
+	if _, ok, _ := db.FindUnique(ctx, "Post", map[string]any{"id": "p5"}, nil, nil); ok {
+		t.Fatal("a failed nested write created p5")
+	}
+	if _, ok, _ := db.FindUnique(ctx, "User", map[string]any{"id": "u3"}, nil, nil); ok {
+		t.Fatal("a failed nested write created u3")
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := tx.Update(ctx, "Post", map[string]any{"id": "p2"}, Record{"author": NestedWrite{Connect: []map[string]any{{"email": "grace@example.com"}}}}); err != nil {
+		t.Fatalf("tx connect author: %v", err)
+	}
+	if _, err := tx.Update(ctx, "User", map[string]any{"id": "u1"}, Record{"posts": NestedWrite{Delete: []map[string]any{{"id": "p1"}}}}); err != nil {
+		t.Fatalf("tx delete post: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	got = authors(db)
+	if _, ok := got["p1"]; ok || got["p2"] != "u2" {
+		t.Fatalf("expected p1 deleted and p2 moved to u2, got %v", got)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close db: %v", err)
+	}
+
+	// Each write is one WAL entry holding every nested write.
+	raw, err := os.ReadFile(walPath)
+	if err != nil {
+		t.Fatalf("read wal: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != 5 || strings.Count(lines[0], `"type":"create"`) != 4 {
+		t.Fatalf("expected five WAL entries, the first holding four creates, got:\n%s", raw)
+	}
+
+	reopened, err := Open(ctx, schema, Options{WALPath: walPath})
+	if err != nil {
+		t.Fatalf("reopen db: %v", err)
+	}
+	defer reopened.Close()
+	replayed := authors(reopened)
+	if len(replayed) != 3 || replayed["p2"] != "u2" || replayed["p3"] != nil || replayed["p4"] != nil {
+		t.Fatalf("replay did not restore the nested writes, got %v", replayed)
+	}
+	profile, _, err = reopened.FindUnique(ctx, "Profile", map[string]any{"id": "pr1"}, nil, nil)
+	if err != nil || profile["userId"] != "u1" || profile["bio"] != "Analyst" {
+		t.Fatalf("expected the replayed profile, got %+v err=%v", profile, err)
+	}
+}
+
+func TestOnChangeReportsTheRecordsEachWriteChanged(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{
+		{
+			Name:       "User",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "email", Kind: FieldString, Required: true}},
+			PrimaryKey: []string{"id"},
+			Indexes:    []Index{{Name: "user_email", Fields: []string{"email"}, Unique: true}},
+		},
+		{
+			Name:       "Post",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "authorId", Kind: FieldString, Required: true}},
+			PrimaryKey: []string{"id"},
+			Relations:  []Relation{{Name: "author", Model: "User", Fields: []string{"authorId"}, References: []string{"id"}, ForeignKey: true, OnDelete: ActionCascade}},
+		},
+		{
+			Name:       "Profile",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "userEmail", Kind: FieldString}},
+			PrimaryKey: []string{"id"},
+			Relations:  []Relation{{Name: "user", Model: "User", Fields: []string{"userEmail"}, References: []string{"email"}, ForeignKey: true, OnDelete: ActionSetNull, OnUpdate: ActionCascade}},
+		},
+	}}
+	db, err := Open(ctx, schema, Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	var writes [][]string
+	describedField := map[string]string{"User": "email", "Post": "authorId", "Profile": "userEmail"}
+	db.OnChange(func(changes []Change) {
+		var described []string
+		for _, change := range changes {
+			describe := func(record Record) string {
+				if record == nil {
+					return "-"
+				}
+				return fmt.Sprintf("%v/%v", record["id"], record[describedField[change.Model]])
+			}
+			described = append(described, fmt.Sprintf("%s %s>%s", change.Model, describe(change.Before), describe(change.After)))
+		}
+		writes = append(writes, described)
 	})
+	expect := func(step string, want ...string) {
+		t.Helper()
+		if len(writes) != 1 || !slices.Equal(writes[0], want) {
+			t.Fatalf("%s: expected one write changing %q, got %q", step, want, writes)
+		}
+		writes = nil
+	}
+
+	if _, err := db.Batch(ctx, []BatchOperation{
+		{Type: BatchCreate, Model: "User", Record: Record{"id": "u1", "email": "ada@example.com"}},
+		{Type: BatchCreate, Model: "Post", Record: Record{"id": "p1", "authorId": "u1"}},
+		{Type: BatchCreate, Model: "Post", Record: Record{"id": "p2", "authorId": "u1"}},
+		{Type: BatchCreate, Model: "Profile", Record: Record{"id": "pr1", "userEmail": "ada@example.com"}},
+		{Type: BatchCreate, Model: "Profile", Record: Record{"id": "pr2", "userEmail": "ada@example.com"}},
+		{Type: BatchDelete, Model: "Profile", Where: map[string]any{"id": "pr2"}},
+	}); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	expect("batch",
+		"User ->u1/ada@example.com",
+		"Post ->p1/u1",
+		"Post ->p2/u1",
+		"Profile ->pr1/ada@example.com",
+	)
+
+	if _, err := db.Update(ctx, "User", map[string]any{"id": "u1"}, Record{"email": "lovelace@example.com"}); err != nil {
+		t.Fatalf("update user: %v", err)
+	}
+	expect("update",
+		"User u1/ada@example.com>u1/lovelace@example.com",
+		"Profile pr1/ada@example.com>pr1/lovelace@example.com",
+	)
+
+	if _, err := db.Delete(ctx, "User", map[string]any{"id": "u1"}); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	expect("delete",
+		"User u1/lovelace@example.com>-",
+		"Post p1/u1>-",
+		"Post p2/u1>-",
+		"Profile pr1/lovelace@example.com>pr1/<nil>",
+	)
+
+	tx, err := db.Begin(ctx)
 	if err != nil {
-		t.Fatalf("find with include: %v", err)
+		t.Fatalf("begin: %v", err)
 	}
-	if !ok {
-		t.Fatal("expected user")
+	if _, err := tx.Create(ctx, "User", Record{"id": "u2", "email": "grace@example.com"}); err != nil {
+		t.Fatalf("create in tx: %v", err)
 	}
+	if len(writes) != 0 {
+		t.Fatalf("expected no changes before the transaction commits, got %q", writes)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	expect("commit", "User ->u2/grace@example.com")
 
-	posts, ok := user["posts"].([]Record)
-	if !ok {
-		t.Fatalf("expected posts relation, got %T", user["posts"])
+	if _, err := db.Create(ctx, "Post", Record{"id": "p3", "authorId": "missing"}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected a failed create, got %v", err)
 	}
-	if len(posts) != 2 {
-		t.Fatalf("expected two posts, got %d", len(posts))
+	if len(writes) != 0 {
+		t.Fatalf("expected a failed write to report no changes, got %q", writes)
 	}
 }
 
-func TestFindManySupportsFiltersOrderAndPagination(t *testing.T) {
+func TestCompositeKeyRelationsIncludeFilterAndAct(t *testing.T) {
 	ctx := context.Background()
-	db := openTestDB(t)
-
-	_, err := db.Create(ctx, "User", Record{"id": "u1", "email": "ada@example.com", "name": "Ada"})
+	membershipKey := []string{"tenantId", "userId"}
+	schema := Schema{Models: []Model{
+		{
+			Name: "Membership",
+			Fields: []Field{
+				{Name: "id", Kind: FieldString, Required: true},
+				{Name: "tenantId", Kind: FieldString, Required: true},
+				{Name: "userId", Kind: FieldString, Required: true},
+				{Name: "role", Kind: FieldString, Required: true},
+			},
+			PrimaryKey: []string{"id"},
+			Indexes:    []Index{{Name: "membership_key", Fields: membershipKey, Unique: true}},
+			Relations:  []Relation{{Name: "grants", Model: "Grant", Fields: membershipKey, References: membershipKey, Many: true}},
+		},
+		{
+			Name: "Grant",
+			Fields: []Field{
+				{Name: "id", Kind: FieldString, Required: true},
+				{Name: "tenantId", Kind: FieldString, Required: true},
+				{Name: "userId", Kind: FieldString, Required: true},
+				{Name: "scope", Kind: FieldString, Required: true},
+			},
+			PrimaryKey: []string{"id"},
+			Indexes:    []Index{{Name: "grant_membership", Fields: membershipKey}},
+			Relations:  []Relation{{Name: "membership", Model: "Membership", Fields: membershipKey, References: membershipKey, ForeignKey: true, OnDelete: ActionCascade, OnUpdate: ActionCascade}},
+		},
+		{
+			Name: "Audit",
+			Fields: []Field{
+				{Name: "id", Kind: FieldString, Required: true},
+				{Name: "tenantId", Kind: FieldString},
+				{Name: "userId", Kind: FieldString},
+			},
+			PrimaryKey: []string{"id"},
+			Relations:  []Relation{{Name: "membership", Model: "Membership", Fields: membershipKey, References: membershipKey, ForeignKey: true, OnDelete: ActionSetNull, OnUpdate: ActionSetNull}},
+		},
+		{
+			Name: "Invoice",
+			Fields: []Field{
+				{Name: "id", Kind: FieldString, Required: true},
+				{Name: "tenantId", Kind: FieldString, Required: true},
+				{Name: "userId", Kind: FieldString, Required: true},
+			},
+			PrimaryKey: []string{"id"},
+			Relations:  []Relation{{Name: "membership", Model: "Membership", Fields: membershipKey, References: membershipKey, ForeignKey: true}},
+		},
+	}}
+	walPath := filepath.Join(t.TempDir(), "zenith.wal")
+	db, err := Open(ctx, schema, Options{WALPath: walPath})
 	if err != nil {
-		t.Fatalf("create user: %v", err)
+		t.Fatalf("open db: %v", err)
 	}
-	for _, post := range []Record{
-		{"id": "p1", "authorId": "u1", "title": "Alpha"},
-		{"id": "p2", "authorId": "u1", "title": "Beta"},
-		{"id": "p3", "authorId": "u1", "title": "Gamma"},
-	} {
-		if _, err := db.Create(ctx, "Post", post); err != nil {
-			t.Fatalf("create post: %v", err)
+	defer db.Close()
+	if _, err := db.Batch(ctx, []BatchOperation{
+		{Type: BatchCreate, Model: "Membership", Record: Record{"id": "m1", "tenantId": "t1", "userId": "u1", "role": "owner"}},
+		{Type: BatchCreate, Model: "Membership", Record: Record{"id": "m2", "tenantId": "t1", "userId": "u2", "role": "member"}},
+		{Type: BatchCreate, Model: "Membership", Record: Record{"id": "m3", "tenantId": "t2", "userId": "u1", "role": "member"}},
+		{Type: BatchCreate, Model: "Grant", Record: Record{"id": "g1", "tenantId": "t1", "userId": "u1", "scope": "admin"}},
+		{Type: BatchCreate, Model: "Grant", Record: Record{"id": "g2", "tenantId": "t1", "userId": "u1", "scope": "read"}},
+		{Type: BatchCreate, Model: "Grant", Record: Record{"id": "g3", "tenantId": "t2", "userId": "u1", "scope": "read"}},
+		{Type: BatchCreate, Model: "Audit", Record: Record{"id": "a1", "tenantId": "t1", "userId": "u1"}},
+		{Type: BatchCreate, Model: "Invoice", Record: Record{"id": "i1", "tenantId": "t1", "userId": "u2"}},
+	}); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	ids := func(records []Record, field string) []string {
+		t.Helper()
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, fmt.Sprint(record[field]))
 		}
+		slices.Sort(ids)
+		return ids
+	}
+	// Only the pair of key values together names a membership: t2/u2 does
+	// not exist although t2 and u2 each appear in one.
+	if _, err := db.Create(ctx, "Grant", Record{"id": "g9", "tenantId": "t2", "userId": "u2", "scope": "read"}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected a grant for a missing membership to fail, got %v", err)
 	}
 
-	posts, err := db.FindMany(ctx, "Post", Query{
-		Where: map[string]any{"authorId": "u1"},
-		Filters: map[string]Filter{
-			"title": {In: []any{"Alpha", "Gamma"}},
-		},
-		OrderBy: []OrderBy{{Field: "title", Direction: SortDesc}},
-		Skip:    1,
-		Limit:   1,
-	})
-	if err != nil {
-		t.Fatalf("find many: %v", err)
+	owner, ok, err := db.FindUnique(ctx, "Membership", map[string]any{"tenantId": "t1", "userId": "u1"}, map[string]Include{"grants": {}}, nil)
+	if err != nil || !ok || !slices.Equal(ids(owner["grants"].([]Record), "id"), []string{"g1", "g2"}) {
+		t.Fatalf("expected t1/u1 to include g1 and g2, got %+v ok=%v err=%v", owner, ok, err)
 	}
-	if len(posts) != 1 || posts[0]["title"] != "Alpha" {
-		t.Fatalf("unexpected ordered page: %+v", posts)
+	grant, ok, err := db.FindUnique(ctx, "Grant", map[string]any{"id": "g3"}, map[string]Include{"membership": {}}, nil)
+	if err != nil || !ok || grant["membership"].(Record)["tenantId"] != "t2" {
+		t.Fatalf("expected g3 to include the t2/u1 membership, got %+v ok=%v err=%v", grant, ok, err)
 	}
-	nextPosts, err := db.FindMany(ctx, "Post", Query{
-		Where:   map[string]any{"authorId": "u1"},
-		OrderBy: []OrderBy{{Field: "title", Direction: SortAsc}},
-		Cursor:  map[string]any{"id": "p1"},
-		Limit:   1,
-	})
+
+	memberships := func(filter RelationFilter) []string {
+		t.Helper()
+		records, err := db.FindMany(ctx, "Membership", Query{FilterExpr: &FilterExpr{Relation: "grants", RelationFilter: filter}})
+		if err != nil {
+			t.Fatalf("filter memberships by grants: %v", err)
+		}
+		keys := make([]string, 0, len(records))
+		for _, record := range records {
+			keys = append(keys, fmt.Sprintf("%s/%s", record["tenantId"], record["userId"]))
+		}
+		slices.Sort(keys)
+		return keys
+	}
+	read := &FilterExpr{Field: "scope", Filter: Filter{Equals: "read"}}
+	if got := memberships(RelationFilter{Some: read}); !slices.Equal(got, []string{"t1/u1", "t2/u1"}) {
+		t.Fatalf("expected the memberships with a read grant, got %v", got)
+	}
+	if got := memberships(RelationFilter{None: read}); !slices.Equal(got, []string{"t1/u2"}) {
+		t.Fatalf("expected the membership without a read grant, got %v", got)
+	}
+	if got := memberships(RelationFilter{Every: read}); !slices.Equal(got, []string{"t1/u2", "t2/u1"}) {
+		t.Fatalf("expected the memberships with only read grants, got %v", got)
+	}
+	grants, err := db.FindMany(ctx, "Grant", Query{FilterExpr: &FilterExpr{Relation: "membership", RelationFilter: RelationFilter{
+		Is: &FilterExpr{Field: "role", Filter: Filter{Equals: "member"}},
+	}}})
+	if err != nil || !slices.Equal(ids(grants, "id"), []string{"g3"}) {
+		t.Fatalf("expected only g3 to belong to a member, got %+v err=%v", grants, err)
+	}
+	grants, err = db.FindMany(ctx, "Grant", Query{FilterExpr: &FilterExpr{Relation: "membership", RelationFilter: RelationFilter{
+		IsNot: &FilterExpr{Field: "role", Filter: Filter{Equals: "member"}},
+	}}})
+	if err != nil || !slices.Equal(ids(grants, "id"), []string{"g1", "g2"}) {
+		t.Fatalf("expected g1 and g2 to belong to a non-member, got %+v err=%v", grants, err)
+	}
+
+	// Rekeying a membership cascades to its grants and clears its audits.
+	if _, err := db.Update(ctx, "Membership", map[string]any{"id": "m1"}, Record{"userId": "u3"}); err != nil {
+		t.Fatalf("rekey membership: %v", err)
+	}
+	grants, err = db.FindMany(ctx, "Grant", Query{Where: map[string]any{"tenantId": "t1", "userId": "u3"}})
+	if err != nil || !slices.Equal(ids(grants, "id"), []string{"g1", "g2"}) {
+		t.Fatalf("expected the rekey to move g1 and g2, got %+v err=%v", grants, err)
+	}
+	audit, _, err := db.FindUnique(ctx, "Audit", map[string]any{"id": "a1"}, nil, nil)
+	if err != nil || audit["tenantId"] != nil || audit["userId"] != nil {
+		t.Fatalf("expected the rekey to clear the audit key, got %+v err=%v", audit, err)
+	}
+
+	// A relation without onDelete restricts the delete; Cascade removes the
+	// grants of a deleted membership.
+	if _, err := db.Delete(ctx, "Membership", map[string]any{"id": "m2"}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("expected the invoice to restrict the delete, got %v", err)
+	}
+	if _, err := db.Delete(ctx, "Membership", map[string]any{"id": "m1"}); err != nil {
+		t.Fatalf("delete membership: %v", err)
+	}
+	grants, err = db.FindMany(ctx, "Grant", Query{})
+	if err != nil || !slices.Equal(ids(grants, "id"), []string{"g3"}) {
+		t.Fatalf("expected the delete to cascade to g1 and g2, got %+v err=%v", grants, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close db: %v", err)
+	}
+
+	reopened, err := Open(ctx, schema, Options{WALPath: walPath})
 	if err != nil {
-		t.Fatalf("find many cursor: %v", err)
+		t.Fatalf("reopen db: %v", err)
 	}
-	if len(nextPosts) != 1 || nextPosts[0]["title"] != "Beta" {
-		t.Fatalf("unexpected cursor page: %+v", nextPosts)
+	defer reopened.Close()
+	grants, err = reopened.FindMany(ctx, "Grant", Query{})
+	if err != nil || !slices.Equal(ids(grants, "id"), []string{"g3"}) {
+		t.Fatalf("expected replay to restore the cascades, got %+v err=%v", grants, err)
 	}
-	count, err := db.Count(ctx, "Post", Query{
-		Where: map[string]any{"authorId": "u1"},
-		Filters: map[string]Filter{
-			"title": {Contains: "a"},
+}
+
+func TestManyToManyRelationsTraverseTheJoinModel(t *testing.T) {
+	ctx := context.Background()
+	schema := Schema{Models: []Model{
+		{
+			Name:       "Post",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}},
+			PrimaryKey: []string{"id"},
+			Relations:  []Relation{{Name: "tags", Model: "Tag", Fields: []string{"id"}, References: []string{"id"}, Many: true, Through: "_PostToTag", ThroughFields: []string{"A"}, ThroughReferences: []string{"B"}}},
 		},
-	})
+		{
+			Name:       "Tag",
+			Fields:     []Field{{Name: "id", Kind: FieldString, Required: true}, {Name: "name", Kind: FieldString, Required: true}},
+			PrimaryKey: []string{"id"},
+			Indexes:    []Index{{Name: "tag_name", Fields: []string{"name"}, Unique: true}},
+			Relations:  []Relation{{Name: "posts", Model: "Post", Fields: []string{"id"}, References: []string{"id"}, Many: true, Through: "_PostToTag", ThroughFields: []string{"B"}, ThroughReferences: []string{"A"}}},
+		},
+		{
+			Name:       "_PostToTag",
+			Fields:     []Field{{Name: "A", Kind: FieldString, Required: true}, {Name: "B", Kind: FieldString, Required: true}},
+			PrimaryKey: []string{"A", "B"},
+			Indexes:    []Index{{Name: "_posttotag_a_idx", Fields: []string{"A"}}, {Name: "_posttotag_b_idx", Fields: []string{"B"}}},
+			Relations: []Relation{
+				{Name: "post", Model: "Post", Fields: []string{"A"}, References: []string{"id"}, ForeignKey: true, OnDelete: ActionCascade, OnUpdate: ActionCascade},
+				{Name: "tag", Model: "Tag", Fields: []string{"B"}, References: []string{"id"}, ForeignKey: true, OnDelete: ActionCascade, OnUpdate: ActionCascade},
+			},
+		},
+	}}
+	db, err := Open(ctx, schema, Options{})
 	if err != nil {
-		t.Fatalf("count: %v", err)
+		t.Fatalf("open db: %v", err)
 	}
-	if count != 3 {
-		t.Fatalf("expected count 3, got %d", count)
+	defer db.Close()
+	names := func(records any) []string {
+		t.Helper()
+		var names []string
+		for _, record := range records.([]Record) {
+			names = append(names, record["id"].(string))
+		}
+		slices.Sort(names)
+		return names
 	}
 
-	contains, err := db.FindMany(ctx, "Post", Query{
-		Filters: map[string]Filter{
-			"title": {Contains: "amm"},
-		},
-	})
+	if _, err := db.Create(ctx, "Tag", Record{"id": "t1", "name": "go"}); err != nil {
+		t.Fatalf("create tag: %v", err)
+	}
+	if _, err := db.Create(ctx, "Post", Record{"id": "p1", "tags": NestedWrite{
+		Create:          []Record{{"id": "t2", "name": "db"}},
+		Connect:         []map[string]any{{"name": "go"}},
+		ConnectOrCreate: []ConnectOrCreate{{Where: map[string]any{"name": "wal"}, Create: Record{"id": "t3", "name": "wal"}}},
+	}}); err != nil {
+		t.Fatalf("create post with tags: %v", err)
+	}
+	if _, err := db.Create(ctx, "Post", Record{"id": "p2", "tags": NestedWrite{Connect: []map[string]any{{"id": "t1"}, {"id": "t1"}}}}); err != nil {
+		t.Fatalf("create post connecting a tag twice: %v", err)
+	}
+
+	post, _, err := db.FindUnique(ctx, "Post", map[string]any{"id": "p1"}, map[string]Include{"tags": {}}, nil)
+	if err != nil || !slices.Equal(names(post["tags"]), []string{"t1", "t2", "t3"}) {
+		t.Fatalf("expected p1 to include three tags, got %+v err=%v", post, err)
+	}
+	tag, _, err := db.FindUnique(ctx, "Tag", map[string]any{"id": "t1"}, map[string]Include{"posts": {Limit: 1}}, nil)
+	if err != nil || len(tag["posts"].([]Record)) != 1 {
+		t.Fatalf("expected t1 to include one of its posts, got %+v err=%v", tag, err)
+	}
+	links, err := db.Count(ctx, "_PostToTag", Query{})
+	if err != nil || links != 4 {
+		t.Fatalf("expected four join rows, got %d err=%v", links, err)
+	}
+
+	tagged := func(filter RelationFilter) []string {
+		t.Helper()
+		posts, err := db.FindMany(ctx, "Post", Query{FilterExpr: &FilterExpr{Relation: "tags", RelationFilter: filter}})
+		if err != nil {
+			t.Fatalf("filter posts by tags: %v", err)
+		}
+		return names(posts)
+	}
+	dbTag := &FilterExpr{Field: "name", Filter: Filter{Equals: "db"}}
+	if got := tagged(RelationFilter{Some: dbTag}); !slices.Equal(got, []string{"p1"}) {
+		t.Fatalf("expected only p1 tagged db, got %v", got)
+	}
+	if got := tagged(RelationFilter{None: dbTag}); !slices.Equal(got, []string{"p2"}) {
+		t.Fatalf("expected only p2 without the db tag, got %v", got)
+	}
+	if got := tagged(RelationFilter{Every: &FilterExpr{Field: "name", Filter: Filter{Equals: "go"}}}); !slices.Equal(got, []string{"p2"}) {
+		t.Fatalf("expected only p2 tagged go alone, got %v", got)
+	}
+	// The filters read the join rows by the tag keys, through the index on B.
+	join, err := db.current.Load().tables.table("_PostToTag")
 	if err != nil {
-		t.Fatalf("find many contains: %v", err)
+		t.Fatalf("join table: %v", err)
 	}
-	if len(contains) != 1 || contains[0]["title"] != "Gamma" {
-		t.Fatalf("unexpected contains result: %+v", contains)
+	plan, err := join.plan(Query{FilterExpr: &FilterExpr{related: []relationMatch{{fields: []string{"B"}, keys: map[string]struct{}{encodeKey([]any{"t2"}): {}}}}}})
+	if err != nil || plan.describe("_PostToTag").Access != PlanIndex {
+		t.Fatalf("expected the join rows to be read through the B index, got %+v err=%v", plan.describe("_PostToTag"), err)
+	}
+
+	if _, err := db.Update(ctx, "Post", map[string]any{"id": "p1"}, Record{"tags": NestedWrite{
+		Set:    []map[string]any{{"id": "t1"}, {"id": "t2"}},
+		Update: []NestedUpdate{{Where: map[string]any{"id": "t2"}, Data: Record{"name": "storage"}}},
+	}}); err != nil {
+		t.Fatalf("set tags: %v", err)
+	}
+	if _, err := db.Update(ctx, "Post", map[string]any{"id": "p2"}, Record{"tags": NestedWrite{Update: []NestedUpdate{{Where: map[string]any{"id": "t2"}, Data: Record{"name": "x"}}}}}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected updating an unconnected tag to fail, got %v", err)
+	}
+	if _, err := db.Update(ctx, "Post", map[string]any{"id": "p1"}, Record{"tags": NestedWrite{Disconnect: []map[string]any{{"id": "t1"}}}}); err != nil {
+		t.Fatalf("disconnect tag: %v", err)
+	}
+	post, _, err = db.FindUnique(ctx, "Post", map[string]any{"id": "p1"}, map[string]Include{"tags": {}}, nil)
+	if err != nil || !slices.Equal(names(post["tags"]), []string{"t2"}) || post["tags"].([]Record)[0]["name"] != "storage" {
+		t.Fatalf("expected p1 tagged only with the renamed t2, got %+v err=%v", post, err)
+	}
+	if _, ok, _ := db.FindUnique(ctx, "Tag", map[string]any{"id": "t3"}, nil, nil); !ok {
+		t.Fatal("disconnecting t3 through set deleted the tag")
+	}
+
+	// Deleting either side removes the rows that join it.
+	if _, err := db.Delete(ctx, "Tag", map[string]any{"id": "t1"}); err != nil {
+		t.Fatalf("delete tag: %v", err)
+	}
+	links, err = db.Count(ctx, "_PostToTag", Query{})
+	if err != nil || links != 1 {
+		t.Fatalf("expected deleting t1 to leave one join row, got %d err=%v", links, err)
+	}
+	if _, err := db.Update(ctx, "Post", map[string]any{"id": "p1"}, Record{"tags": NestedWrite{Delete: []map[string]any{{"id": "t2"}}}}); err != nil {
+		t.Fatalf("delete connected tag: %v", err)
+	}
+	if _, ok, _ := db.FindUnique(ctx, "Tag", map[string]any{"id": "t2"}, nil, nil); ok {
+		t.Fatal("expected the nested delete to remove t2")
+	}
+	links, err = db.Count(ctx, "_PostToTag", Query{})
+	if err != nil || links != 0 {
+		t.Fatalf("expected no join rows left, got %d err=%v", links, err)
+	}
+}
+
+func TestFindManyLimitAppliesAfterWhere(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	for _, user := range []Record{
+		{"id": "u1", "email": "ada@example.com", "name": "Ada"},
+		{"id": "u2", "email": "grace@example.com", "name": "Grace"},
+		{"id": "u3", "email": "linus@example.com", "name": "Linus"},
+	} {
+		if _, err := db.Create(ctx, "User", user); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	for _, post := range []Record{
+		{"id": "p1", "authorId": "u1", "title": "Alpha"},
+		{"id": "p2", "authorId": "u1", "title": "Beta"},
+		{"id": "p3", "authorId": "u2", "title": "Beta"},
+	} {
+		if _, err := db.Create(ctx, "Post", post); err != nil {
+			t.Fatalf("create post: %v", err)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		users, err := db.FindMany(ctx, "User", Query{Where: map[string]any{"name": "Linus"}, Limit: 1})
+		if err != nil {
+			t.Fatalf("find many users: %v", err)
+		}
+		if len(users) != 1 || users[0]["id"] != "u3" {
+			t.Fatalf("expected the scan to keep going until a match, got %+v", users)
+		}
+	}
+	posts, err := db.FindMany(ctx, "Post", Query{Where: map[string]any{"authorId": "u1", "title": "Beta"}, Limit: 1})
+	if err != nil {
+		t.Fatalf("find many posts: %v", err)
+	}
+	if len(posts) != 1 || posts[0]["id"] != "p2" {
+		t.Fatalf("expected the index lookup to keep going until a match, got %+v", posts)
 	}
 }
 
@@ -153,7 +2712,7 @@ func TestWALReplayRestoresRecords(t *testing.T) {
 	ctx := context.Background()
 	walPath := filepath.Join(t.TempDir(), "zenith.wal")
 
-	db, err := Open(ctx, TestSchema(), Options{WALPath: walPath})
+	db, err := Open(ctx, testSchema(), Options{WALPath: walPath})
 	if err != nil {
 		t.Fatalf("open db: %v", err)
 	}
@@ -169,13 +2728,13 @@ func TestWALReplayRestoresRecords(t *testing.T) {
 		t.Fatalf("close db: %v", err)
 	}
 
-	reopened, err := Open(ctx, TestSchema(), Options{WALPath: walPath})
+	reopened, err := Open(ctx, testSchema(), Options{WALPath: walPath})
 	if err != nil {
 		t.Fatalf("reopen db: %v", err)
 	}
 	defer reopened.Close()
 
-	user, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil)
+	user, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil)
 	if err != nil {
 		t.Fatalf("find unique: %v", err)
 	}
@@ -190,7 +2749,7 @@ func TestWALReplayRestoresRecords(t *testing.T) {
 func TestUpsertCreatesUpdatesAndReplaysFromWAL(t *testing.T) {
 	ctx := context.Background()
 	walPath := filepath.Join(t.TempDir(), "zenith.wal")
-	db, err := Open(ctx, TestSchema(), Options{WALPath: walPath})
+	db, err := Open(ctx, testSchema(), Options{WALPath: walPath})
 	if err != nil {
 		t.Fatalf("open db: %v", err)
 	}
@@ -221,12 +2780,12 @@ func TestUpsertCreatesUpdatesAndReplaysFromWAL(t *testing.T) {
 		t.Fatalf("close db: %v", err)
 	}
 
-	reopened, err := Open(ctx, TestSchema(), Options{WALPath: walPath})
+	reopened, err := Open(ctx, testSchema(), Options{WALPath: walPath})
 	if err != nil {
 		t.Fatalf("reopen db: %v", err)
 	}
 	defer reopened.Close()
-	replayed, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil)
+	replayed, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil)
 	if err != nil {
 		t.Fatalf("find replayed upsert: %v", err)
 	}
@@ -238,7 +2797,7 @@ func TestUpsertCreatesUpdatesAndReplaysFromWAL(t *testing.T) {
 func TestBatchIsAtomicAndReplaysFromWAL(t *testing.T) {
 	ctx := context.Background()
 	walPath := filepath.Join(t.TempDir(), "zenith.wal")
-	db, err := Open(ctx, TestSchema(), Options{WALPath: walPath})
+	db, err := Open(ctx, testSchema(), Options{WALPath: walPath})
 	if err != nil {
 		t.Fatalf("open db: %v", err)
 	}
@@ -272,12 +2831,12 @@ func TestBatchIsAtomicAndReplaysFromWAL(t *testing.T) {
 		t.Fatalf("close db: %v", err)
 	}
 
-	reopened, err := Open(ctx, TestSchema(), Options{WALPath: walPath})
+	reopened, err := Open(ctx, testSchema(), Options{WALPath: walPath})
 	if err != nil {
 		t.Fatalf("reopen db: %v", err)
 	}
 	defer reopened.Close()
-	user, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil)
+	user, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil)
 	if err != nil {
 		t.Fatalf("find replayed user: %v", err)
 	}
@@ -293,10 +2852,252 @@ func TestBatchIsAtomicAndReplaysFromWAL(t *testing.T) {
 	}
 }
 
+func TestTransactionReadsOwnWritesAndCommitsOneBatch(t *testing.T) {
+	ctx := context.Background()
+	walPath := filepath.Join(t.TempDir(), "zenith.wal")
+	db, err := Open(ctx, testSchema(), Options{WALPath: walPath})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := tx.Create(ctx, "User", Record{"id": "u1", "email": "ada@example.com", "name": "Ada"}); err != nil {
+		t.Fatalf("tx create user: %v", err)
+	}
+	if _, err := tx.Create(ctx, "Post", Record{"id": "p1", "authorId": "u1", "title": "Draft"}); err != nil {
+		t.Fatalf("tx create post: %v", err)
+	}
+	if _, err := tx.Update(ctx, "Post", map[string]any{"id": "p1"}, Record{"title": "Published"}); err != nil {
+		t.Fatalf("tx update post: %v", err)
+	}
+	if _, created, err := tx.Upsert(ctx, "User", map[string]any{"email": "ada@example.com"}, Record{"id": "u9", "email": "ada@example.com", "name": "Nobody"}, Record{"name": "Ada Lovelace"}); err != nil || created {
+		t.Fatalf("tx upsert should update staged user: created=%v err=%v", created, err)
+	}
+
+	user, ok, err := tx.FindUnique(ctx, "User", map[string]any{"id": "u1"}, map[string]Include{"posts": {}}, nil)
+	if err != nil {
+		t.Fatalf("tx find user: %v", err)
+	}
+	posts, _ := user["posts"].([]Record)
+	if !ok || user["name"] != "Ada Lovelace" || len(posts) != 1 || posts[0]["title"] != "Published" {
+		t.Fatalf("transaction did not see its own writes: found=%v user=%+v", ok, user)
+	}
+	if _, ok, err := db.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil); err != nil || ok {
+		t.Fatalf("uncommitted user leaked: found=%v err=%v", ok, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if _, err := tx.Create(ctx, "User", Record{"id": "u2", "email": "grace@example.com", "name": "Grace"}); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("expected ErrTxDone after commit, got %v", err)
+	}
+	if db.sequence != 1 {
+		t.Fatalf("expected commit to write one WAL record, sequence=%d", db.sequence)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close db: %v", err)
+	}
+
+	reopened, err := Open(ctx, testSchema(), Options{WALPath: walPath})
+	if err != nil {
+		t.Fatalf("reopen db: %v", err)
+	}
+	defer reopened.Close()
+	post, ok, err := reopened.FindUnique(ctx, "Post", map[string]any{"id": "p1"}, nil, nil)
+	if err != nil || !ok || post["title"] != "Published" {
+		t.Fatalf("unexpected replayed post: found=%v post=%+v err=%v", ok, post, err)
+	}
+}
+
+func TestTransactionRollbackAndConflict(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	if _, err := db.Create(ctx, "User", Record{"id": "u1", "email": "ada@example.com", "name": "Ada"}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	rolledBack, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := rolledBack.Delete(ctx, "User", map[string]any{"id": "u1"}); err != nil {
+		t.Fatalf("tx delete: %v", err)
+	}
+	if err := rolledBack.Rollback(ctx); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if _, ok, err := db.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil); err != nil || !ok {
+		t.Fatalf("rollback should keep user: found=%v err=%v", ok, err)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, _, err := tx.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil); err != nil {
+		t.Fatalf("tx read: %v", err)
+	}
+	if _, err := tx.Update(ctx, "User", map[string]any{"id": "u1"}, Record{"name": "Stale"}); err != nil {
+		t.Fatalf("tx update: %v", err)
+	}
+	if _, err := db.Update(ctx, "User", map[string]any{"id": "u1"}, Record{"name": "Concurrent"}); err != nil {
+		t.Fatalf("concurrent update: %v", err)
+	}
+	if err := tx.Commit(ctx); !errors.Is(err, ErrTxConflict) {
+		t.Fatalf("expected ErrTxConflict, got %v", err)
+	}
+	user, _, err := db.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil)
+	if err != nil || user["name"] != "Concurrent" {
+		t.Fatalf("conflicting commit changed user: %+v err=%v", user, err)
+	}
+}
+
+func TestTransactionReadsPinnedSnapshotAndConflictsPerRecord(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	for _, record := range []Record{
+		{"id": "u1", "email": "ada@example.com", "name": "Ada"},
+		{"id": "u2", "email": "grace@example.com", "name": "Grace"},
+	} {
+		if _, err := db.Create(ctx, "User", record); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := db.Update(ctx, "User", map[string]any{"id": "u2"}, Record{"name": "Grace Hopper"}); err != nil {
+		t.Fatalf("concurrent update: %v", err)
+	}
+	if _, err := db.Create(ctx, "User", Record{"id": "u3", "email": "alan@example.com", "name": "Alan"}); err != nil {
+		t.Fatalf("concurrent create: %v", err)
+	}
+
+	grace, _, err := tx.FindUnique(ctx, "User", map[string]any{"id": "u2"}, nil, nil)
+	if err != nil || grace["name"] != "Grace" {
+		t.Fatalf("transaction should read its snapshot: %+v err=%v", grace, err)
+	}
+	count, err := db.Count(ctx, "User", Query{})
+	if err != nil || count != 3 {
+		t.Fatalf("db should read latest state: count=%d err=%v", count, err)
+	}
+
+	if _, err := tx.Update(ctx, "User", map[string]any{"id": "u1"}, Record{"name": "Ada Lovelace"}); err != nil {
+		t.Fatalf("tx update: %v", err)
+	}
+	if err := tx.Commit(ctx); !errors.Is(err, ErrTxConflict) {
+		t.Fatalf("reading a record changed after begin should conflict, got %v", err)
+	}
+
+	tx, err = db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := tx.Update(ctx, "User", map[string]any{"id": "u1"}, Record{"name": "Ada Lovelace"}); err != nil {
+		t.Fatalf("tx update: %v", err)
+	}
+	if _, err := db.Update(ctx, "User", map[string]any{"id": "u2"}, Record{"name": "Rear Admiral Hopper"}); err != nil {
+		t.Fatalf("concurrent update: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("writes to different records should not conflict: %v", err)
+	}
+	ada, _, err := db.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil)
+	if err != nil || ada["name"] != "Ada Lovelace" {
+		t.Fatalf("unexpected committed user: %+v err=%v", ada, err)
+	}
+}
+
+func TestReadersDoNotBlockOnWriters(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		last := 0
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			count, err := db.Count(ctx, "User", Query{})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if count < last {
+				errs <- fmt.Errorf("count went backwards from %d to %d", last, count)
+				return
+			}
+			last = count
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		id := fmt.Sprintf("u%d", i)
+		if _, err := db.Create(ctx, "User", Record{"id": id, "email": id + "@example.com", "name": id}); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	close(done)
+	if err := <-errs; err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+}
+
+func TestHAMTKeepsOlderVersions(t *testing.T) {
+	older := hamt[int]{edit: new(editToken)}
+	for i := 0; i < 2000; i++ {
+		older = older.set(fmt.Sprintf("k%d", i), i)
+	}
+	newer := older
+	newer.edit = new(editToken)
+	for i := 0; i < 2000; i += 2 {
+		newer = newer.delete(fmt.Sprintf("k%d", i))
+	}
+	newer = newer.set("k1", -1)
+
+	if older.len() != 2000 || newer.len() != 1000 {
+		t.Fatalf("unexpected sizes: older=%d newer=%d", older.len(), newer.len())
+	}
+	for i := 0; i < 2000; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if value, ok := older.get(key); !ok || value != i {
+			t.Fatalf("older version lost %s: %d %v", key, value, ok)
+		}
+		_, ok := newer.get(key)
+		if ok != (i%2 == 1) {
+			t.Fatalf("newer version has %s=%v", key, ok)
+		}
+	}
+	if value, _ := newer.get("k1"); value != -1 {
+		t.Fatalf("expected updated value, got %d", value)
+	}
+	visited := 0
+	newer.each(func(string, int) bool {
+		visited++
+		return true
+	})
+	if visited != 1000 {
+		t.Fatalf("expected to visit 1000 entries, got %d", visited)
+	}
+}
+
 func TestManyMutationsAreAtomicAndReplayFromWAL(t *testing.T) {
 	ctx := context.Background()
 	walPath := filepath.Join(t.TempDir(), "zenith.wal")
-	db, err := Open(ctx, TestSchema(), Options{WALPath: walPath})
+	db, err := Open(ctx, testSchema(), Options{WALPath: walPath})
 	if err != nil {
 		t.Fatalf("open db: %v", err)
 	}
@@ -320,7 +3121,7 @@ func TestManyMutationsAreAtomicAndReplayFromWAL(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected create many conflict")
 	}
-	partial, ok, err := db.FindUnique(ctx, "User", map[string]any{"id": "u4"}, nil)
+	partial, ok, err := db.FindUnique(ctx, "User", map[string]any{"id": "u4"}, nil, nil)
 	if err != nil {
 		t.Fatalf("find partial create many: %v", err)
 	}
@@ -352,19 +3153,19 @@ func TestManyMutationsAreAtomicAndReplayFromWAL(t *testing.T) {
 		t.Fatalf("close db: %v", err)
 	}
 
-	reopened, err := Open(ctx, TestSchema(), Options{WALPath: walPath})
+	reopened, err := Open(ctx, testSchema(), Options{WALPath: walPath})
 	if err != nil {
 		t.Fatalf("reopen db: %v", err)
 	}
 	defer reopened.Close()
-	user, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil)
+	user, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil)
 	if err != nil {
 		t.Fatalf("find replayed user: %v", err)
 	}
 	if !ok || user["name"] != "Human" {
 		t.Fatalf("unexpected replayed bulk update: found=%v user=%+v", ok, user)
 	}
-	deletedUser, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u3"}, nil)
+	deletedUser, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u3"}, nil, nil)
 	if err != nil {
 		t.Fatalf("find replayed deleted user: %v", err)
 	}
@@ -391,7 +3192,7 @@ func TestSnapshotRoundTrip(t *testing.T) {
 		t.Fatalf("load snapshot: %v", err)
 	}
 
-	user, ok, err := loaded.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil)
+	user, ok, err := loaded.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil)
 	if err != nil {
 		t.Fatalf("find loaded user: %v", err)
 	}
@@ -407,7 +3208,7 @@ func TestDataDirRecoveryReplaysWAL(t *testing.T) {
 	ctx := context.Background()
 	dataDir := filepath.Join(t.TempDir(), ".zenithdb")
 
-	db, err := Open(ctx, TestSchema(), Options{DataDir: dataDir})
+	db, err := Open(ctx, testSchema(), Options{DataDir: dataDir})
 	if err != nil {
 		t.Fatalf("open db: %v", err)
 	}
@@ -419,13 +3220,13 @@ func TestDataDirRecoveryReplaysWAL(t *testing.T) {
 		t.Fatalf("close db: %v", err)
 	}
 
-	reopened, err := Open(ctx, TestSchema(), Options{DataDir: dataDir})
+	reopened, err := Open(ctx, testSchema(), Options{DataDir: dataDir})
 	if err != nil {
 		t.Fatalf("reopen db: %v", err)
 	}
 	defer reopened.Close()
 
-	user, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil)
+	user, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil)
 	if err != nil {
 		t.Fatalf("find recovered user: %v", err)
 	}
@@ -441,7 +3242,7 @@ func TestDataDirRecoveryReplaysBinaryWAL(t *testing.T) {
 	ctx := context.Background()
 	dataDir := filepath.Join(t.TempDir(), ".zenithdb")
 
-	db, err := Open(ctx, TestSchema(), Options{DataDir: dataDir, WALFormat: WALFormatBinary})
+	db, err := Open(ctx, testSchema(), Options{DataDir: dataDir, WALFormat: WALFormatBinary})
 	if err != nil {
 		t.Fatalf("open db: %v", err)
 	}
@@ -453,13 +3254,13 @@ func TestDataDirRecoveryReplaysBinaryWAL(t *testing.T) {
 		t.Fatalf("close db: %v", err)
 	}
 
-	reopened, err := Open(ctx, TestSchema(), Options{DataDir: dataDir, WALFormat: WALFormatBinary})
+	reopened, err := Open(ctx, testSchema(), Options{DataDir: dataDir, WALFormat: WALFormatBinary})
 	if err != nil {
 		t.Fatalf("reopen db: %v", err)
 	}
 	defer reopened.Close()
 
-	user, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil)
+	user, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil)
 	if err != nil {
 		t.Fatalf("find recovered user: %v", err)
 	}
@@ -476,7 +3277,7 @@ func TestOpenURLUsesLocalDataDir(t *testing.T) {
 	dataDir := filepath.Join(t.TempDir(), ".zenithdb")
 	connectionURL := "zenith://local?dataDir=" + dataDir + "&sync=always"
 
-	db, err := OpenURL(ctx, TestSchema(), connectionURL)
+	db, err := OpenURL(ctx, testSchema(), connectionURL)
 	if err != nil {
 		t.Fatalf("open url: %v", err)
 	}
@@ -488,13 +3289,13 @@ func TestOpenURLUsesLocalDataDir(t *testing.T) {
 		t.Fatalf("close db: %v", err)
 	}
 
-	reopened, err := OpenURL(ctx, TestSchema(), connectionURL)
+	reopened, err := OpenURL(ctx, testSchema(), connectionURL)
 	if err != nil {
 		t.Fatalf("reopen url: %v", err)
 	}
 	defer reopened.Close()
 
-	_, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil)
+	_, ok, err := reopened.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil)
 	if err != nil {
 		t.Fatalf("find recovered user: %v", err)
 	}
@@ -507,7 +3308,7 @@ func TestCheckpointLoadsSnapshotAndSkipsOldWAL(t *testing.T) {
 	ctx := context.Background()
 	dataDir := filepath.Join(t.TempDir(), ".zenithdb")
 
-	db, err := Open(ctx, TestSchema(), Options{DataDir: dataDir})
+	db, err := Open(ctx, testSchema(), Options{DataDir: dataDir})
 	if err != nil {
 		t.Fatalf("open db: %v", err)
 	}
@@ -522,7 +3323,7 @@ func TestCheckpointLoadsSnapshotAndSkipsOldWAL(t *testing.T) {
 		t.Fatalf("close db: %v", err)
 	}
 
-	reopened, err := Open(ctx, TestSchema(), Options{DataDir: dataDir})
+	reopened, err := Open(ctx, testSchema(), Options{DataDir: dataDir})
 	if err != nil {
 		t.Fatalf("reopen db: %v", err)
 	}
@@ -540,7 +3341,7 @@ func TestCheckpointLoadsSnapshotAndSkipsOldWAL(t *testing.T) {
 func openTestDB(t *testing.T) *DB {
 	t.Helper()
 
-	db, err := Open(context.Background(), TestSchema(), Options{})
+	db, err := Open(context.Background(), testSchema(), Options{})
 	if err != nil {
 		t.Fatalf("open test db: %v", err)
 	}
@@ -550,8 +3351,8 @@ func openTestDB(t *testing.T) *DB {
 	return db
 }
 
-// TestSchema is shared by package tests and benchmark packages.
-func TestSchema() Schema {
+// testSchema is the User/Post schema shared by the package tests.
+func testSchema() Schema {
 	return Schema{
 		Models: []Model{
 			{
@@ -581,7 +3382,7 @@ func TestSchema() Schema {
 					{Name: "post_author", Fields: []string{"authorId"}},
 				},
 				Relations: []Relation{
-					{Name: "author", Model: "User", Fields: []string{"authorId"}, References: []string{"id"}},
+					{Name: "author", Model: "User", Fields: []string{"authorId"}, References: []string{"id"}, ForeignKey: true},
 				},
 			},
 		},
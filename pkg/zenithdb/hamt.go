@@ -0,0 +1,266 @@
+package zenithdb
+
+import (
+	"math/bits"
+	"slices"
+)
+
+// hamt is a persistent hash array mapped trie keyed by string. Updates return
+// a new trie that shares every untouched node with the previous one, so a
+// table version is just a set of roots: writers copy the path to each key
+// they change, and readers holding an older root keep a stable view without
+// locking. Versions nobody references any more are reclaimed by the garbage
+// collector.
+//
+// A trie carrying an edit token updates nodes stamped with the same token in
+// place: they were created by the write in progress and nobody else can see
+// them yet. This keeps a batch touching the same paths repeatedly from
+// copying them on every operation.
+type hamt[V any] struct {
+	root *hamtNode[V]
+	size int
+	edit *editToken
+}
+
+// editToken identifies one in-progress write. It has a non-zero size so every
+// token is a distinct pointer.
+type editToken struct {
+	_ byte
+}
+
+type hamtNode[V any] struct {
+	bitmap  uint32
+	entries []hamtEntry[V]
+	edit    *editToken
+}
+
+// hamtEntry is either a leaf holding key and value, or a pointer to a child
+// node covering the next hamtBits of the hash.
+type hamtEntry[V any] struct {
+	hash  uint64
+	key   string
+	value V
+	child *hamtNode[V]
+}
+
+const (
+	hamtBits = 5
+	hamtMask = 1<<hamtBits - 1
+	// hamtDepth is the shift at which every hash bit has been consumed. Nodes
+	// at that depth hold colliding keys in a plain list.
+	hamtDepth = 64
+)
+
+func hashKey(key string) uint64 {
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= 1099511628211
+	}
+	return hash
+}
+
+func (m hamt[V]) len() int {
+	return m.size
+}
+
+func (m hamt[V]) get(key string) (V, bool) {
+	var zero V
+	hash := hashKey(key)
+	node := m.root
+	for shift := uint(0); node != nil; shift += hamtBits {
+		if shift >= hamtDepth {
+			for i := range node.entries {
+				if node.entries[i].key == key {
+					return node.entries[i].value, true
+				}
+			}
+			return zero, false
+		}
+		bit := uint32(1) << ((hash >> shift) & hamtMask)
+		if node.bitmap&bit == 0 {
+			return zero, false
+		}
+		entry := &node.entries[bits.OnesCount32(node.bitmap&(bit-1))]
+		if entry.child != nil {
+			node = entry.child
+			continue
+		}
+		if entry.key == key {
+			return entry.value, true
+		}
+		return zero, false
+	}
+	return zero, false
+}
+
+func (m hamt[V]) set(key string, value V) hamt[V] {
+	root := m.root
+	if root == nil {
+		root = &hamtNode[V]{edit: m.edit}
+	}
+	next, added := root.set(m.edit, 0, hashKey(key), key, value)
+	m.root = next
+	if added {
+		m.size++
+	}
+	return m
+}
+
+func (m hamt[V]) delete(key string) hamt[V] {
+	if m.root == nil {
+		return m
+	}
+	next, removed := m.root.delete(m.edit, 0, hashKey(key), key)
+	if !removed {
+		return m
+	}
+	m.root = next
+	m.size--
+	return m
+}
+
+// each visits every entry until fn returns false. It reports whether the
+// iteration ran to completion.
+func (m hamt[V]) each(fn func(key string, value V) bool) bool {
+	if m.root == nil {
+		return true
+	}
+	return m.root.each(fn)
+}
+
+func (n *hamtNode[V]) set(edit *editToken, shift uint, hash uint64, key string, value V) (*hamtNode[V], bool) {
+	if shift >= hamtDepth {
+		for i := range n.entries {
+			if n.entries[i].key == key {
+				next := n.editable(edit, 0)
+				next.entries[i].value = value
+				return next, false
+			}
+		}
+		next := n.editable(edit, 1)
+		next.entries = append(next.entries, hamtEntry[V]{hash: hash, key: key, value: value})
+		return next, true
+	}
+
+	bit := uint32(1) << ((hash >> shift) & hamtMask)
+	index := bits.OnesCount32(n.bitmap & (bit - 1))
+	if n.bitmap&bit == 0 {
+		next := n.editable(edit, 1)
+		next.bitmap |= bit
+		next.entries = slices.Insert(next.entries, index, hamtEntry[V]{hash: hash, key: key, value: value})
+		return next, true
+	}
+
+	entry := n.entries[index]
+	switch {
+	case entry.child != nil:
+		child, added := entry.child.set(edit, shift+hamtBits, hash, key, value)
+		next := n.editable(edit, 0)
+		next.entries[index].child = child
+		return next, added
+	case entry.key == key:
+		next := n.editable(edit, 0)
+		next.entries[index].value = value
+		return next, false
+	default:
+		leaf := hamtEntry[V]{hash: hash, key: key, value: value}
+		next := n.editable(edit, 0)
+		next.entries[index] = hamtEntry[V]{child: newHamtPair(edit, shift+hamtBits, entry, leaf)}
+		return next, true
+	}
+}
+
+func newHamtPair[V any](edit *editToken, shift uint, left hamtEntry[V], right hamtEntry[V]) *hamtNode[V] {
+	if shift >= hamtDepth {
+		return &hamtNode[V]{entries: []hamtEntry[V]{left, right}, edit: edit}
+	}
+	leftBit := uint32(1) << ((left.hash >> shift) & hamtMask)
+	rightBit := uint32(1) << ((right.hash >> shift) & hamtMask)
+	if leftBit == rightBit {
+		child := newHamtPair(edit, shift+hamtBits, left, right)
+		return &hamtNode[V]{bitmap: leftBit, entries: []hamtEntry[V]{{child: child}}, edit: edit}
+	}
+	if leftBit > rightBit {
+		left, right = right, left
+	}
+	return &hamtNode[V]{bitmap: leftBit | rightBit, entries: []hamtEntry[V]{left, right}, edit: edit}
+}
+
+func (n *hamtNode[V]) delete(edit *editToken, shift uint, hash uint64, key string) (*hamtNode[V], bool) {
+	if shift >= hamtDepth {
+		for i := range n.entries {
+			if n.entries[i].key == key {
+				return n.without(edit, 0, i), true
+			}
+		}
+		return n, false
+	}
+
+	bit := uint32(1) << ((hash >> shift) & hamtMask)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	index := bits.OnesCount32(n.bitmap & (bit - 1))
+	entry := n.entries[index]
+	if entry.child == nil {
+		if entry.key != key {
+			return n, false
+		}
+		return n.without(edit, bit, index), true
+	}
+
+	child, removed := entry.child.delete(edit, shift+hamtBits, hash, key)
+	if !removed {
+		return n, false
+	}
+	if child == nil {
+		return n.without(edit, bit, index), true
+	}
+	next := n.editable(edit, 0)
+	if len(child.entries) == 1 && child.entries[0].child == nil {
+		// Pull a lone leaf up so the trie stays as shallow as an
+		// insert-only trie holding the same keys.
+		next.entries[index] = child.entries[0]
+	} else {
+		next.entries[index].child = child
+	}
+	return next, true
+}
+
+func (n *hamtNode[V]) without(edit *editToken, bit uint32, index int) *hamtNode[V] {
+	if len(n.entries) == 1 {
+		return nil
+	}
+	next := n.editable(edit, 0)
+	next.bitmap &^= bit
+	next.entries = slices.Delete(next.entries, index, index+1)
+	return next
+}
+
+// editable returns n itself when the current write created it, and otherwise
+// a copy owned by the write with room for extra more entries.
+func (n *hamtNode[V]) editable(edit *editToken, extra int) *hamtNode[V] {
+	if edit != nil && n.edit == edit {
+		return n
+	}
+	entries := make([]hamtEntry[V], len(n.entries), len(n.entries)+extra)
+	copy(entries, n.entries)
+	return &hamtNode[V]{bitmap: n.bitmap, entries: entries, edit: edit}
+}
+
+func (n *hamtNode[V]) each(fn func(key string, value V) bool) bool {
+	for i := range n.entries {
+		entry := &n.entries[i]
+		if entry.child != nil {
+			if !entry.child.each(fn) {
+				return false
+			}
+			continue
+		}
+		if !fn(entry.key, entry.value) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,85 +1,162 @@
 package zenithdb
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
+// secondaryIndex maps encoded index keys to primary keys. Hash indexes use
+// unique or multi, ordered indexes use ordered. All three are persistent, so
+// a forked index shares its entries with the version it was forked from until
+// either side changes them. An index over a List field is multi-valued: it
+// holds a record in the bucket of each distinct element of its list. A null or
+// missing field keys a hash index like any other value, except that a unique
+// index holds no key with a null in it, so any number of records may share
+// one, and an ordered index orders nulls first.
 type secondaryIndex struct {
 	definition Index
-	unique     map[string]string
-	multi      map[string]map[string]struct{}
+	list       bool
+	unique     hamt[string]
+	multi      hamt[hamt[struct{}]]
+	ordered    treap
+	// entries counts the primary keys held in multi buckets.
+	entries int
 }
 
-func newSecondaryIndex(definition Index) *secondaryIndex {
-	idx := &secondaryIndex{definition: definition}
-	if definition.Unique {
-		idx.unique = make(map[string]string)
-	} else {
-		idx.multi = make(map[string]map[string]struct{})
+// indexStats are the cardinality statistics the planner reads: how many
+// records an index holds and how many distinct keys they share.
+type indexStats struct {
+	entries int
+	keys    int
+}
+
+func (idx *secondaryIndex) stats() indexStats {
+	switch {
+	case idx.definition.Type == IndexOrdered:
+		return indexStats{entries: idx.ordered.len(), keys: idx.ordered.len()}
+	case idx.definition.Unique:
+		return indexStats{entries: idx.unique.len(), keys: idx.unique.len()}
+	default:
+		return indexStats{entries: idx.entries, keys: idx.multi.len()}
 	}
-	return idx
 }
 
-func (idx *secondaryIndex) add(record Record, primaryKey string) error {
-	if err := idx.canAdd(record, primaryKey); err != nil {
-		return err
+// estimate returns the average number of records sharing one key.
+func (stats indexStats) estimate() int {
+	if stats.keys == 0 {
+		return 0
 	}
+	return (stats.entries + stats.keys - 1) / stats.keys
+}
 
-	key, err := keyFromRecord(record, idx.definition.Fields)
-	if err != nil {
+func newSecondaryIndex(definition Index, list bool) *secondaryIndex {
+	return &secondaryIndex{definition: definition, list: list}
+}
+
+func (idx *secondaryIndex) fork(edit *editToken) *secondaryIndex {
+	forked := *idx
+	forked.unique.edit = edit
+	forked.multi.edit = edit
+	forked.ordered.edit = edit
+	return &forked
+}
+
+func (idx *secondaryIndex) add(record Record, primaryKey string) error {
+	if idx.definition.Type == IndexOrdered {
+		idx.ordered = idx.ordered.insert(orderedKey(record, idx.definition.Fields, primaryKey), primaryKey)
+		return nil
+	}
+	if err := idx.canAdd(record, primaryKey); err != nil {
 		return err
 	}
 
+	keys := idx.keys(record)
 	if idx.definition.Unique {
-		existing, ok := idx.unique[key]
-		if ok && existing != primaryKey {
-			return fmt.Errorf("unique index %q already contains key %q", idx.definition.Name, key)
+		for _, key := range keys {
+			idx.unique = idx.unique.set(key, primaryKey)
 		}
-		idx.unique[key] = primaryKey
 		return nil
 	}
 
-	bucket, ok := idx.multi[key]
-	if !ok {
-		bucket = make(map[string]struct{})
-		idx.multi[key] = bucket
+	for _, key := range keys {
+		bucket, _ := idx.multi.get(key)
+		bucket.edit = idx.multi.edit
+		size := bucket.len()
+		bucket = bucket.set(primaryKey, struct{}{})
+		idx.entries += bucket.len() - size
+		idx.multi = idx.multi.set(key, bucket)
 	}
-	bucket[primaryKey] = struct{}{}
 	return nil
 }
 
+// keys returns the encoded keys a hash index holds record under: one, none
+// for a unique index over a null, or one per distinct element of the list a
+// multi-valued index covers.
+func (idx *secondaryIndex) keys(record Record) []string {
+	if !idx.list {
+		values := make([]any, len(idx.definition.Fields))
+		for i, field := range idx.definition.Fields {
+			values[i] = record[field]
+			if values[i] == nil && idx.definition.Unique {
+				return nil
+			}
+		}
+		return []string{encodeKey(values)}
+	}
+	elements, _ := record[idx.definition.Fields[0]].([]any)
+	keys := make([]string, 0, len(elements))
+	seen := make(map[string]struct{}, len(elements))
+	for _, element := range elements {
+		key := encodeKey([]any{element})
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
 func (idx *secondaryIndex) canAdd(record Record, primaryKey string) error {
 	if !idx.definition.Unique {
 		return nil
 	}
 
-	key, err := keyFromRecord(record, idx.definition.Fields)
-	if err != nil {
-		return err
-	}
-	existing, ok := idx.unique[key]
-	if ok && existing != primaryKey {
-		return fmt.Errorf("unique index %q already contains key %q", idx.definition.Name, key)
+	for _, key := range idx.keys(record) {
+		existing, ok := idx.unique.get(key)
+		if ok && existing != primaryKey {
+			return fmt.Errorf("unique index %q already contains key %q", idx.definition.Name, key)
+		}
 	}
 	return nil
 }
 
 func (idx *secondaryIndex) remove(record Record, primaryKey string) error {
-	key, err := keyFromRecord(record, idx.definition.Fields)
-	if err != nil {
-		return err
+	if idx.definition.Type == IndexOrdered {
+		idx.ordered = idx.ordered.delete(orderedKey(record, idx.definition.Fields, primaryKey))
+		return nil
 	}
-
+	keys := idx.keys(record)
 	if idx.definition.Unique {
-		delete(idx.unique, key)
+		for _, key := range keys {
+			idx.unique = idx.unique.delete(key)
+		}
 		return nil
 	}
 
-	bucket, ok := idx.multi[key]
-	if !ok {
-		return nil
-	}
-	delete(bucket, primaryKey)
-	if len(bucket) == 0 {
-		delete(idx.multi, key)
+	for _, key := range keys {
+		bucket, ok := idx.multi.get(key)
+		if !ok {
+			continue
+		}
+		bucket.edit = idx.multi.edit
+		size := bucket.len()
+		bucket = bucket.delete(primaryKey)
+		idx.entries -= size - bucket.len()
+		if bucket.len() == 0 {
+			idx.multi = idx.multi.delete(key)
+		} else {
+			idx.multi = idx.multi.set(key, bucket)
+		}
 	}
 	return nil
 }
@@ -89,28 +166,36 @@ func (idx *secondaryIndex) lookup(values map[string]any, limit int) ([]string, e
 	if err != nil {
 		return nil, err
 	}
+	return idx.lookupKey(key, limit), nil
+}
 
+// lookupKey returns the primary keys a hash index holds under an encoded key.
+func (idx *secondaryIndex) lookupKey(key string, limit int) []string {
 	if idx.definition.Unique {
-		primaryKey, ok := idx.unique[key]
+		primaryKey, ok := idx.unique.get(key)
 		if !ok {
-			return nil, nil
+			return nil
 		}
-		return []string{primaryKey}, nil
+		return []string{primaryKey}
 	}
 
-	bucket, ok := idx.multi[key]
+	bucket, ok := idx.multi.get(key)
 	if !ok {
-		return nil, nil
+		return nil
 	}
 	if limit > 0 {
-		result := make([]string, 0, min(limit, len(bucket)))
-		for primaryKey := range bucket {
+		result := make([]string, 0, min(limit, bucket.len()))
+		bucket.each(func(primaryKey string, _ struct{}) bool {
 			result = append(result, primaryKey)
-			if len(result) >= limit {
-				break
-			}
-		}
-		return result, nil
-	}
-	return sortedIDs(bucket), nil
+			return len(result) < limit
+		})
+		return result
+	}
+	result := make([]string, 0, bucket.len())
+	bucket.each(func(primaryKey string, _ struct{}) bool {
+		result = append(result, primaryKey)
+		return true
+	})
+	sort.Strings(result)
+	return result
 }
@@ -0,0 +1,155 @@
+package zenithdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// normalizeJSON returns value as the JSON value a FieldJSON field stores:
+// nil, a bool, a string, an int64 or float64, a []any, or a map[string]any
+// holding the same. A json.RawMessage is parsed, and an empty one is null;
+// any other Go value is converted as json.Marshal encodes it. A number is
+// stored as an int64 when it is a whole number in range, so a value reads back
+// alike however it was written or decoded.
+func normalizeJSON(value any) (any, error) {
+	switch typed := value.(type) {
+	case nil, bool, string:
+		return typed, nil
+	case json.RawMessage:
+		if len(typed) == 0 {
+			return nil, nil
+		}
+		decoder := json.NewDecoder(bytes.NewReader(typed))
+		decoder.UseNumber()
+		var decoded any
+		if err := decoder.Decode(&decoded); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		if decoder.More() {
+			return nil, fmt.Errorf("invalid JSON: trailing data")
+		}
+		return normalizeJSON(decoded)
+	case json.Number:
+		if integer, err := typed.Int64(); err == nil {
+			return integer, nil
+		}
+		float, err := typed.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON number %q", typed)
+		}
+		return jsonNumber(float)
+	case int64:
+		return typed, nil
+	case int:
+		return int64(typed), nil
+	case float64:
+		return jsonNumber(typed)
+	case map[string]any:
+		normalized := make(map[string]any, len(typed))
+		for key, element := range typed {
+			next, err := normalizeJSON(element)
+			if err != nil {
+				return nil, err
+			}
+			normalized[key] = next
+		}
+		return normalized, nil
+	case []any:
+		normalized := make([]any, len(typed))
+		for i, element := range typed {
+			next, err := normalizeJSON(element)
+			if err != nil {
+				return nil, err
+			}
+			normalized[i] = next
+		}
+		return normalized, nil
+	default:
+		raw, err := json.Marshal(typed)
+		if err != nil {
+			return nil, fmt.Errorf("expected a JSON value: %w", err)
+		}
+		return normalizeJSON(json.RawMessage(raw))
+	}
+}
+
+func jsonNumber(value float64) (any, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("JSON number %v is not finite", value)
+	}
+	if value == math.Trunc(value) && value >= math.MinInt64 && value < math.MaxInt64 {
+		return int64(value), nil
+	}
+	return value, nil
+}
+
+// jsonAt returns the value under path in value, following object keys and
+// array indexes, and whether path leads to one.
+func jsonAt(value any, path []string) (any, bool) {
+	for _, step := range path {
+		switch typed := value.(type) {
+		case map[string]any:
+			next, ok := typed[step]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []any:
+			index, err := strconv.Atoi(step)
+			if err != nil || index < 0 || index >= len(typed) {
+				return nil, false
+			}
+			value = typed[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// jsonArrayContains reports whether value is an array holding target, or
+// every element of target when target is itself an array.
+func jsonArrayContains(value any, target any) bool {
+	array, ok := value.([]any)
+	if !ok {
+		return false
+	}
+	targets, ok := target.([]any)
+	if !ok {
+		targets = []any{target}
+	}
+	for _, want := range targets {
+		found := false
+		for _, element := range array {
+			if equalValues(element, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// equalValues reports whether two normalized values are equal, comparing
+// bytes and JSON arrays and objects by content.
+func equalValues(left any, right any) bool {
+	switch typed := left.(type) {
+	case []byte:
+		other, ok := right.([]byte)
+		return ok && bytes.Equal(typed, other)
+	case map[string]any, []any:
+		return reflect.DeepEqual(left, right)
+	}
+	switch right.(type) {
+	case []byte, map[string]any, []any:
+		return false
+	}
+	return left == right
+}
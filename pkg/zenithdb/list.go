@@ -0,0 +1,91 @@
+package zenithdb
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ListUpdate is the value of a List field in an update patch. Set replaces the
+// list unless it is nil, and Push then appends its values.
+type ListUpdate struct {
+	Set  []any
+	Push []any
+}
+
+// normalizeList returns value, a slice of any type, as the []any of
+// normalized elements a List field stores. Elements cannot be nil.
+func normalizeList(field Field, value any) (any, error) {
+	elements := reflect.ValueOf(value)
+	if elements.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("expected a list of %s", field.Kind)
+	}
+	element := elementField(field)
+	normalized := make([]any, elements.Len())
+	for i := range normalized {
+		item := elements.Index(i).Interface()
+		if item == nil {
+			return nil, fmt.Errorf("list element %d is null", i)
+		}
+		next, err := normalizeValue(element, item)
+		if err != nil {
+			return nil, fmt.Errorf("list element %d: %w", i, err)
+		}
+		normalized[i] = next
+	}
+	return normalized, nil
+}
+
+// elementField returns the field describing one element of a List field.
+func elementField(field Field) Field {
+	field.List = false
+	return field
+}
+
+// withListUpdates returns patch with each ListUpdate it holds applied to the
+// list current stores, so the patch sets whole lists. patch is returned as is
+// when it holds none.
+func (t *table) withListUpdates(current Record, patch Record) (Record, error) {
+	resolved := patch
+	copied := false
+	for name, value := range patch {
+		update, ok := value.(ListUpdate)
+		if !ok {
+			continue
+		}
+		if field, ok := findField(t.model, name); !ok || !field.List {
+			return nil, fmt.Errorf("model %q field %q is not a list", t.model.Name, name)
+		}
+		list := update.Set
+		if list == nil {
+			list, _ = current[name].([]any)
+		}
+		if !copied {
+			resolved = cloneRecord(patch)
+			copied = true
+		}
+		resolved[name] = append(append(make([]any, 0, len(list)+len(update.Push)), list...), update.Push...)
+	}
+	return resolved, nil
+}
+
+// listHasEvery reports whether value is a list holding every one of targets.
+func listHasEvery(value any, targets []any) bool {
+	list, _ := value.([]any)
+	for _, target := range targets {
+		if !containsFilterValue(list, target) {
+			return false
+		}
+	}
+	return true
+}
+
+// listHasSome reports whether value is a list holding any of targets.
+func listHasSome(value any, targets []any) bool {
+	list, _ := value.([]any)
+	for _, target := range targets {
+		if containsFilterValue(list, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,642 @@
+package zenithdb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// NestedWrite writes the records a relation connects to as part of the Create
+// or Update of a record, which holds it as the value of the relation's name.
+// The record and all of its nested writes apply as one atomic batch, and the
+// records a nested write creates or updates may hold nested writes of their
+// own.
+//
+// Create inserts records connected to the record, Connect connects the records
+// its unique lookups find, and ConnectOrCreate does one or the other.
+// Disconnect clears the foreign key that connects records, Set connects
+// exactly the records it lists unless it is nil, and Update and Delete change
+// connected records. A record being created only takes Create, Connect, and
+// ConnectOrCreate. On a to-one relation an empty lookup names the connected
+// record. On a many-to-many relation, connecting and disconnecting records
+// adds and removes the rows of its join model that link them.
+type NestedWrite struct {
+	Create          []Record
+	Connect         []map[string]any
+	ConnectOrCreate []ConnectOrCreate
+	Disconnect      []map[string]any
+	Set             []map[string]any
+	Update          []NestedUpdate
+	Delete          []map[string]any
+}
+
+// ConnectOrCreate connects the record Where finds, or creates Create when
+// there is none.
+type ConnectOrCreate struct {
+	Where  map[string]any
+	Create Record
+}
+
+// NestedUpdate patches the connected record Where finds with Data.
+type NestedUpdate struct {
+	Where map[string]any
+	Data  Record
+}
+
+// nestedWrite is a NestedWrite of a record through relation. owner reports
+// whether the record holds the foreign key: its related records are then
+// written before it, and otherwise after it.
+type nestedWrite struct {
+	NestedWrite
+	relation Relation
+	owner    bool
+}
+
+// splitNestedWrites separates the nested writes record holds from its fields.
+// record is returned as is when it holds none.
+func splitNestedWrites(tables *tableForks, model Model, record Record, creating bool) (Record, []nestedWrite, error) {
+	fields := record
+	var writes []nestedWrite
+	for _, relation := range model.Relations {
+		value, ok := record[relation.Name]
+		if !ok {
+			continue
+		}
+		write, ok := value.(NestedWrite)
+		if !ok {
+			return nil, nil, fmt.Errorf("model %q relation %q expects a nested write, got %T", model.Name, relation.Name, value)
+		}
+		owner, err := holdsForeignKey(tables, model, relation)
+		if err != nil {
+			return nil, nil, err
+		}
+		if creating && (len(write.Disconnect) > 0 || write.Set != nil || len(write.Update) > 0 || len(write.Delete) > 0) {
+			return nil, nil, fmt.Errorf("model %q relation %q can only create or connect the records of a record being created", model.Name, relation.Name)
+		}
+		if !relation.Many {
+			if write.Set != nil {
+				return nil, nil, fmt.Errorf("model %q relation %q connects one record and cannot be set", model.Name, relation.Name)
+			}
+			if len(write.Create)+len(write.Connect)+len(write.ConnectOrCreate) > 1 {
+				return nil, nil, fmt.Errorf("model %q relation %q connects one record", model.Name, relation.Name)
+			}
+		}
+		if len(writes) == 0 {
+			fields = cloneRecord(record)
+		}
+		delete(fields, relation.Name)
+		writes = append(writes, nestedWrite{NestedWrite: write, relation: relation, owner: owner})
+	}
+	return fields, writes, nil
+}
+
+// holdsForeignKey reports whether model holds the foreign key relation writes
+// through: its own, or that of the relation of the related model it mirrors.
+// The join model of a many-to-many relation holds the foreign keys to both
+// sides, so neither side owns it.
+func holdsForeignKey(tables *tableForks, model Model, relation Relation) (bool, error) {
+	if relation.ForeignKey {
+		return true, nil
+	}
+	if relation.Through != "" {
+		return false, nil
+	}
+	target, err := tables.lookup(relation.Model)
+	if err != nil {
+		return false, err
+	}
+	for _, back := range target.model.Relations {
+		if back.ForeignKey && back.Model == model.Name && sameFields(back.Fields, relation.References) && sameFields(back.References, relation.Fields) {
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("model %q relation %q holds no foreign key to write through", model.Name, relation.Name)
+}
+
+// applyOwnedWrites applies the nested writes whose related records must exist
+// before fields, the values a write is about to give a record, can point at
+// them: it creates or finds the records the owned relations connect and sets
+// their foreign key in fields, clears it on Disconnect, and applies Update to
+// the records current, the stored record or nil, connects to.
+func applyOwnedWrites(tables *tableForks, writes []nestedWrite, fields Record, current Record, sequence uint64) ([]operation, error) {
+	var operations []operation
+	for _, write := range writes {
+		if !write.owner {
+			continue
+		}
+		relation := write.relation
+		connect := func(target Record) {
+			for i, field := range relation.Fields {
+				fields[field] = target[relation.References[i]]
+			}
+		}
+		for _, record := range write.Create {
+			applied, result, err := applyBatchOperation(tables, BatchOperation{Type: BatchCreate, Model: relation.Model, Record: record}, sequence)
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, applied...)
+			connect(result.Record)
+		}
+		for _, where := range write.Connect {
+			target, err := findConnectable(tables, relation, where)
+			if err != nil {
+				return nil, err
+			}
+			connect(target)
+		}
+		for _, connectOrCreate := range write.ConnectOrCreate {
+			applied, target, err := applyConnectOrCreate(tables, relation, connectOrCreate, sequence)
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, applied...)
+			connect(target)
+		}
+
+		link, _ := relationValues(current, relation.Fields, relation.References)
+		for _, where := range write.Disconnect {
+			connected, err := findConnected(tables, relation, link, where)
+			if err != nil {
+				return nil, err
+			}
+			if len(connected) > 0 {
+				for _, field := range relation.Fields {
+					fields[field] = nil
+				}
+			}
+		}
+		for _, update := range write.Update {
+			applied, err := applyToConnected(tables, relation, link, update.Where, BatchOperation{Type: BatchUpdate, Model: relation.Model, Record: update.Data}, sequence)
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, applied...)
+		}
+	}
+	return operations, nil
+}
+
+// applyRelatedWrites applies the nested writes that follow the write of a
+// record: the deletes of the records its owned relations connected to before,
+// when the record was current, and every write through a relation whose
+// related records hold the foreign key to record, as the write left it.
+func applyRelatedWrites(tables *tableForks, writes []nestedWrite, record Record, current Record, sequence uint64) ([]operation, error) {
+	var operations []operation
+	for _, write := range writes {
+		relation := write.relation
+		if write.owner {
+			link, _ := relationValues(current, relation.Fields, relation.References)
+			for _, where := range write.Delete {
+				applied, err := applyToConnected(tables, relation, link, where, BatchOperation{Type: BatchDelete, Model: relation.Model}, sequence)
+				if err != nil {
+					return nil, err
+				}
+				operations = append(operations, applied...)
+			}
+			continue
+		}
+
+		if relation.Through != "" {
+			applied, err := applyThroughWrites(tables, write, record, sequence)
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, applied...)
+			continue
+		}
+
+		link, ok := relationValues(record, relation.Fields, relation.References)
+		if !ok {
+			return nil, fmt.Errorf("relation %q cannot connect %s records to a record without %v", relation.Name, relation.Model, relation.Fields)
+		}
+		connect := func(target Record) error {
+			where, err := primaryWhere(tables, relation.Model, target)
+			if err != nil {
+				return err
+			}
+			applied, _, err := applyBatchOperation(tables, BatchOperation{Type: BatchUpdate, Model: relation.Model, Where: where, Record: Record(link)}, sequence)
+			operations = append(operations, applied...)
+			return err
+		}
+		disconnect := func(target Record) error {
+			where, err := primaryWhere(tables, relation.Model, target)
+			if err != nil {
+				return err
+			}
+			cleared := make(Record, len(relation.References))
+			for _, field := range relation.References {
+				cleared[field] = nil
+			}
+			applied, _, err := applyBatchOperation(tables, BatchOperation{Type: BatchUpdate, Model: relation.Model, Where: where, Record: cleared}, sequence)
+			operations = append(operations, applied...)
+			return err
+		}
+
+		for _, created := range write.Create {
+			linked := cloneRecord(created)
+			for field, value := range link {
+				linked[field] = value
+			}
+			applied, _, err := applyBatchOperation(tables, BatchOperation{Type: BatchCreate, Model: relation.Model, Record: linked}, sequence)
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, applied...)
+		}
+		for _, where := range write.Connect {
+			target, err := findConnectable(tables, relation, where)
+			if err != nil {
+				return nil, err
+			}
+			if err := connect(target); err != nil {
+				return nil, err
+			}
+		}
+		for _, connectOrCreate := range write.ConnectOrCreate {
+			linked := cloneRecord(connectOrCreate.Create)
+			for field, value := range link {
+				linked[field] = value
+			}
+			applied, target, err := applyConnectOrCreate(tables, relation, ConnectOrCreate{Where: connectOrCreate.Where, Create: linked}, sequence)
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, applied...)
+			if len(applied) == 0 {
+				if err := connect(target); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if write.Set != nil {
+			targets := make([]Record, 0, len(write.Set))
+			keep := make(map[string]struct{}, len(write.Set))
+			for _, where := range write.Set {
+				target, err := findConnectable(tables, relation, where)
+				if err != nil {
+					return nil, err
+				}
+				key, err := primaryKeyOf(tables, relation.Model, target)
+				if err != nil {
+					return nil, err
+				}
+				keep[key] = struct{}{}
+				targets = append(targets, target)
+			}
+			connected, err := findLinked(tables, relation, link)
+			if err != nil {
+				return nil, err
+			}
+			for _, target := range connected {
+				key, err := primaryKeyOf(tables, relation.Model, target)
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := keep[key]; ok {
+					continue
+				}
+				if err := disconnect(target); err != nil {
+					return nil, err
+				}
+			}
+			for _, target := range targets {
+				if err := connect(target); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, where := range write.Disconnect {
+			connected, err := findConnected(tables, relation, link, where)
+			if err != nil {
+				return nil, err
+			}
+			for _, target := range connected {
+				if err := disconnect(target); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, update := range write.Update {
+			applied, err := applyToConnected(tables, relation, link, update.Where, BatchOperation{Type: BatchUpdate, Model: relation.Model, Record: update.Data}, sequence)
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, applied...)
+		}
+		for _, where := range write.Delete {
+			applied, err := applyToConnected(tables, relation, link, where, BatchOperation{Type: BatchDelete, Model: relation.Model}, sequence)
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, applied...)
+		}
+	}
+	return operations, nil
+}
+
+// applyThroughWrites applies the nested writes of a many-to-many relation of
+// record, after its write. Connecting and disconnecting records creates and
+// deletes the rows of the join model that link them to record; Update and
+// Delete change the connected records themselves, and Delete unlinks them
+// first.
+func applyThroughWrites(tables *tableForks, write nestedWrite, record Record, sequence uint64) ([]operation, error) {
+	relation := write.relation
+	link, ok := relationValues(record, relation.Fields, relation.ThroughFields)
+	if !ok {
+		return nil, fmt.Errorf("relation %q cannot connect %s records to a record without %v", relation.Name, relation.Model, relation.Fields)
+	}
+	var operations []operation
+	apply := func(operation BatchOperation) (BatchResult, error) {
+		applied, result, err := applyBatchOperation(tables, operation, sequence)
+		operations = append(operations, applied...)
+		return result, err
+	}
+	links := func(target Record) ([]Record, error) {
+		join, err := tables.lookup(relation.Through)
+		if err != nil {
+			return nil, err
+		}
+		where, ok := relationValues(target, relation.References, relation.ThroughReferences)
+		if !ok {
+			return nil, fmt.Errorf("relation %q cannot connect a %s record without %v", relation.Name, relation.Model, relation.References)
+		}
+		for field, value := range link {
+			where[field] = value
+		}
+		return join.findMany(Query{Where: where})
+	}
+	connect := func(target Record) error {
+		existing, err := links(target)
+		if err != nil || len(existing) > 0 {
+			return err
+		}
+		row, _ := relationValues(target, relation.References, relation.ThroughReferences)
+		for field, value := range link {
+			row[field] = value
+		}
+		_, err = apply(BatchOperation{Type: BatchCreate, Model: relation.Through, Record: Record(row)})
+		return err
+	}
+	disconnect := func(target Record) error {
+		existing, err := links(target)
+		if err != nil {
+			return err
+		}
+		for _, row := range existing {
+			where, err := primaryWhere(tables, relation.Through, row)
+			if err != nil {
+				return err
+			}
+			if _, err := apply(BatchOperation{Type: BatchDelete, Model: relation.Through, Where: where}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	connected := func(where map[string]any) (Record, error) {
+		if len(where) == 0 {
+			return nil, fmt.Errorf("relation %q needs a unique lookup of the connected %s record", relation.Name, relation.Model)
+		}
+		target, err := tables.lookup(relation.Model)
+		if err != nil {
+			return nil, err
+		}
+		found, ok, err := target.findUnique(where, nil)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			existing, err := links(found)
+			if err != nil || len(existing) > 0 {
+				return found, err
+			}
+		}
+		return nil, fmt.Errorf("%w: relation %q connects no %s record with %v", ErrNotFound, relation.Name, relation.Model, where)
+	}
+
+	for _, created := range write.Create {
+		result, err := apply(BatchOperation{Type: BatchCreate, Model: relation.Model, Record: created})
+		if err != nil {
+			return nil, err
+		}
+		if err := connect(result.Record); err != nil {
+			return nil, err
+		}
+	}
+	for _, where := range write.Connect {
+		target, err := findConnectable(tables, relation, where)
+		if err != nil {
+			return nil, err
+		}
+		if err := connect(target); err != nil {
+			return nil, err
+		}
+	}
+	for _, connectOrCreate := range write.ConnectOrCreate {
+		applied, target, err := applyConnectOrCreate(tables, relation, connectOrCreate, sequence)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, applied...)
+		if err := connect(target); err != nil {
+			return nil, err
+		}
+	}
+	if write.Set != nil {
+		targets := make([]Record, 0, len(write.Set))
+		keep := make(map[string]struct{}, len(write.Set))
+		for _, where := range write.Set {
+			target, err := findConnectable(tables, relation, where)
+			if err != nil {
+				return nil, err
+			}
+			key, err := primaryKeyOf(tables, relation.Model, target)
+			if err != nil {
+				return nil, err
+			}
+			keep[key] = struct{}{}
+			targets = append(targets, target)
+		}
+		join, err := tables.lookup(relation.Through)
+		if err != nil {
+			return nil, err
+		}
+		related, err := tables.lookup(relation.Model)
+		if err != nil {
+			return nil, err
+		}
+		current, err := throughRecords(join, related, relation, record)
+		if err != nil {
+			return nil, err
+		}
+		for _, target := range current {
+			key, err := primaryKeyOf(tables, relation.Model, target)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := keep[key]; ok {
+				continue
+			}
+			if err := disconnect(target); err != nil {
+				return nil, err
+			}
+		}
+		for _, target := range targets {
+			if err := connect(target); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, where := range write.Disconnect {
+		target, err := connected(where)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := disconnect(target); err != nil {
+			return nil, err
+		}
+	}
+	for _, update := range write.Update {
+		target, err := connected(update.Where)
+		if err != nil {
+			return nil, err
+		}
+		where, err := primaryWhere(tables, relation.Model, target)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := apply(BatchOperation{Type: BatchUpdate, Model: relation.Model, Where: where, Record: update.Data}); err != nil {
+			return nil, err
+		}
+	}
+	for _, where := range write.Delete {
+		target, err := connected(where)
+		if err != nil {
+			return nil, err
+		}
+		if err := disconnect(target); err != nil {
+			return nil, err
+		}
+		where, err := primaryWhere(tables, relation.Model, target)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := apply(BatchOperation{Type: BatchDelete, Model: relation.Model, Where: where}); err != nil {
+			return nil, err
+		}
+	}
+	return operations, nil
+}
+
+// applyConnectOrCreate finds the record connectOrCreate.Where selects through
+// relation, or creates it. It returns no operations when the record existed.
+func applyConnectOrCreate(tables *tableForks, relation Relation, connectOrCreate ConnectOrCreate, sequence uint64) ([]operation, Record, error) {
+	target, err := tables.lookup(relation.Model)
+	if err != nil {
+		return nil, nil, err
+	}
+	found, ok, err := target.findUnique(connectOrCreate.Where, nil)
+	if err != nil || ok {
+		return nil, found, err
+	}
+	applied, result, err := applyBatchOperation(tables, BatchOperation{Type: BatchCreate, Model: relation.Model, Record: connectOrCreate.Create}, sequence)
+	if err != nil {
+		return nil, nil, err
+	}
+	return applied, result.Record, nil
+}
+
+// applyToConnected applies operation to the record where selects among the
+// records link connects to through relation, addressing it by primary key.
+func applyToConnected(tables *tableForks, relation Relation, link map[string]any, where map[string]any, operation BatchOperation, sequence uint64) ([]operation, error) {
+	connected, err := findConnected(tables, relation, link, where)
+	if err != nil {
+		return nil, err
+	}
+	if len(connected) == 0 {
+		return nil, fmt.Errorf("%w: relation %q connects no %s record with %v", ErrNotFound, relation.Name, relation.Model, where)
+	}
+	operation.Where, err = primaryWhere(tables, relation.Model, connected[0])
+	if err != nil {
+		return nil, err
+	}
+	applied, _, err := applyBatchOperation(tables, operation, sequence)
+	return applied, err
+}
+
+// findConnectable returns the record of relation's model that where selects.
+func findConnectable(tables *tableForks, relation Relation, where map[string]any) (Record, error) {
+	target, err := tables.lookup(relation.Model)
+	if err != nil {
+		return nil, err
+	}
+	if len(where) == 0 {
+		return nil, fmt.Errorf("relation %q needs a unique lookup of the %s record to connect", relation.Name, relation.Model)
+	}
+	found, ok, err := target.findUnique(where, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: relation %q finds no %s record with %v to connect", ErrNotFound, relation.Name, relation.Model, where)
+	}
+	return found, nil
+}
+
+// findConnected returns the records of relation's model that hold the values
+// of link, nil when link is, narrowed to the one where selects unless it is
+// empty. Only a to-one relation may leave where empty.
+func findConnected(tables *tableForks, relation Relation, link map[string]any, where map[string]any) ([]Record, error) {
+	if len(where) == 0 {
+		if relation.Many {
+			return nil, fmt.Errorf("relation %q needs a unique lookup of the connected %s record", relation.Name, relation.Model)
+		}
+		return findLinked(tables, relation, link)
+	}
+	target, err := tables.lookup(relation.Model)
+	if err != nil {
+		return nil, err
+	}
+	found, ok, err := target.findUnique(where, nil)
+	if err != nil || !ok || link == nil {
+		return nil, err
+	}
+	for field, value := range link {
+		if compareValues(found[field], value) != 0 {
+			return nil, nil
+		}
+	}
+	return []Record{found}, nil
+}
+
+// findLinked returns every record of relation's model that holds the values
+// of link, none when link is nil.
+func findLinked(tables *tableForks, relation Relation, link map[string]any) ([]Record, error) {
+	if link == nil {
+		return nil, nil
+	}
+	target, err := tables.lookup(relation.Model)
+	if err != nil {
+		return nil, err
+	}
+	return target.findMany(Query{Where: link})
+}
+
+func primaryWhere(tables *tableForks, model string, record Record) (map[string]any, error) {
+	target, err := tables.lookup(model)
+	if err != nil {
+		return nil, err
+	}
+	return primaryWhereFromRecord(target.model, record)
+}
+
+func primaryKeyOf(tables *tableForks, model string, record Record) (string, error) {
+	target, err := tables.lookup(model)
+	if err != nil {
+		return "", err
+	}
+	return keyFromRecord(record, target.model.PrimaryKey)
+}
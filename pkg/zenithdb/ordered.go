@@ -0,0 +1,288 @@
+package zenithdb
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// treap is a persistent binary search tree ordered by key, balanced by a
+// priority derived from the key's hash. Like hamt it copies the path to every
+// changed node, shares the rest with older versions, and updates nodes stamped
+// with its own edit token in place. Every node tracks the size of its subtree,
+// so the planner can count the entries in a key range in logarithmic time.
+type treap struct {
+	root *treapNode
+	edit *editToken
+}
+
+type treapNode struct {
+	key        string
+	primaryKey string
+	priority   uint64
+	size       int
+	left       *treapNode
+	right      *treapNode
+	edit       *editToken
+}
+
+func (t treap) insert(key string, primaryKey string) treap {
+	t.root = t.root.insert(t.edit, key, primaryKey)
+	return t
+}
+
+func (t treap) delete(key string) treap {
+	t.root, _ = t.root.delete(t.edit, key)
+	return t
+}
+
+// ascend visits the entries with from <= key < to in key order until fn
+// returns false. An empty to means no upper bound.
+func (t treap) ascend(from string, to string, fn func(primaryKey string) bool) {
+	t.root.ascend(from, to, fn)
+}
+
+// descend visits the same entries as ascend in reverse key order.
+func (t treap) descend(from string, to string, fn func(primaryKey string) bool) {
+	t.root.descend(from, to, fn)
+}
+
+func (t treap) len() int {
+	return t.root.count()
+}
+
+// countRange returns how many entries ascend(from, to) would visit.
+func (t treap) countRange(from string, to string) int {
+	end := t.root.count()
+	if to != "" {
+		end = t.root.rank(to)
+	}
+	return max(end-t.root.rank(from), 0)
+}
+
+func (n *treapNode) count() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+// rank returns the number of keys lower than key.
+func (n *treapNode) rank(key string) int {
+	rank := 0
+	for n != nil {
+		if key <= n.key {
+			n = n.left
+			continue
+		}
+		rank += n.left.count() + 1
+		n = n.right
+	}
+	return rank
+}
+
+func (n *treapNode) resize() *treapNode {
+	n.size = n.left.count() + n.right.count() + 1
+	return n
+}
+
+func (n *treapNode) insert(edit *editToken, key string, primaryKey string) *treapNode {
+	if n == nil {
+		return &treapNode{key: key, primaryKey: primaryKey, priority: hashKey(key), size: 1, edit: edit}
+	}
+	next := n.editable(edit)
+	switch {
+	case key < n.key:
+		next.left = n.left.insert(edit, key, primaryKey)
+		if next.left.priority > next.priority {
+			return next.rotateRight()
+		}
+	case key > n.key:
+		next.right = n.right.insert(edit, key, primaryKey)
+		if next.right.priority > next.priority {
+			return next.rotateLeft()
+		}
+	default:
+		next.primaryKey = primaryKey
+	}
+	return next.resize()
+}
+
+func (n *treapNode) delete(edit *editToken, key string) (*treapNode, bool) {
+	if n == nil {
+		return nil, false
+	}
+	switch {
+	case key < n.key:
+		left, ok := n.left.delete(edit, key)
+		if !ok {
+			return n, false
+		}
+		next := n.editable(edit)
+		next.left = left
+		return next.resize(), true
+	case key > n.key:
+		right, ok := n.right.delete(edit, key)
+		if !ok {
+			return n, false
+		}
+		next := n.editable(edit)
+		next.right = right
+		return next.resize(), true
+	default:
+		return mergeTreap(edit, n.left, n.right), true
+	}
+}
+
+func mergeTreap(edit *editToken, left *treapNode, right *treapNode) *treapNode {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	if left.priority > right.priority {
+		next := left.editable(edit)
+		next.right = mergeTreap(edit, left.right, right)
+		return next.resize()
+	}
+	next := right.editable(edit)
+	next.left = mergeTreap(edit, left, right.left)
+	return next.resize()
+}
+
+// rotateRight and rotateLeft are only called on nodes owned by the current
+// write: n itself and the child just returned by insert.
+func (n *treapNode) rotateRight() *treapNode {
+	left := n.left
+	n.left = left.right
+	left.right = n.resize()
+	return left.resize()
+}
+
+func (n *treapNode) rotateLeft() *treapNode {
+	right := n.right
+	n.right = right.left
+	right.left = n.resize()
+	return right.resize()
+}
+
+func (n *treapNode) editable(edit *editToken) *treapNode {
+	if edit != nil && n.edit == edit {
+		return n
+	}
+	next := *n
+	next.edit = edit
+	return &next
+}
+
+func (n *treapNode) ascend(from string, to string, fn func(string) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.key >= from {
+		if !n.left.ascend(from, to, fn) {
+			return false
+		}
+	}
+	if to != "" && n.key >= to {
+		return false
+	}
+	if n.key >= from && !fn(n.primaryKey) {
+		return false
+	}
+	return n.right.ascend(from, to, fn)
+}
+
+func (n *treapNode) descend(from string, to string, fn func(string) bool) bool {
+	if n == nil {
+		return true
+	}
+	if to == "" || n.key < to {
+		if !n.right.descend(from, to, fn) {
+			return false
+		}
+		if n.key < from {
+			return false
+		}
+		if !fn(n.primaryKey) {
+			return false
+		}
+	}
+	return n.left.descend(from, to, fn)
+}
+
+// Ordered index keys concatenate one self-delimiting, order-preserving
+// encoding per indexed field followed by the primary key, so byte order equals
+// value order and every prefix of encoded fields selects a contiguous range.
+const (
+	orderedNull  byte = 0x01
+	orderedValue byte = 0x02
+)
+
+func orderedKey(record Record, fields []string, primaryKey string) string {
+	key := orderedPrefix(record, fields)
+	return string(append(key, primaryKey...))
+}
+
+func orderedPrefix(values map[string]any, fields []string) []byte {
+	var key []byte
+	for _, field := range fields {
+		key = appendOrdered(key, values[field])
+	}
+	return key
+}
+
+func appendOrdered(key []byte, value any) []byte {
+	switch typed := value.(type) {
+	case nil:
+		return append(key, orderedNull)
+	case []byte:
+		return appendOrdered(key, string(typed))
+	case string:
+		key = append(key, orderedValue)
+		for i := 0; i < len(typed); i++ {
+			if typed[i] == 0x00 {
+				key = append(key, 0x00, 0xff)
+				continue
+			}
+			key = append(key, typed[i])
+		}
+		return append(key, 0x00, 0x01)
+	case int64:
+		key = append(key, orderedValue)
+		return binary.BigEndian.AppendUint64(key, uint64(typed)^(1<<63))
+	case float64:
+		bits := math.Float64bits(typed)
+		if typed < 0 {
+			bits = ^bits
+		} else {
+			bits ^= 1 << 63
+		}
+		key = append(key, orderedValue)
+		return binary.BigEndian.AppendUint64(key, bits)
+	case bool:
+		if typed {
+			return append(key, orderedValue, 1)
+		}
+		return append(key, orderedValue, 0)
+	case time.Time:
+		key = append(key, orderedValue)
+		return binary.BigEndian.AppendUint64(key, uint64(typed.UnixNano())^(1<<63))
+	default:
+		return appendOrdered(key, encodeValue(value))
+	}
+}
+
+// prefixEnd returns the smallest key greater than every key starting with
+// prefix, or "" when there is none.
+func prefixEnd(prefix []byte) string {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,666 @@
+package zenithdb
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+)
+
+// PlanAccess names the path a query plan reads candidate records through.
+type PlanAccess string
+
+const (
+	PlanPrimaryKey        PlanAccess = "PrimaryKey"
+	PlanUniqueIndex       PlanAccess = "UniqueIndex"
+	PlanIndex             PlanAccess = "Index"
+	PlanOrderedIndex      PlanAccess = "OrderedIndex"
+	PlanIndexIntersection PlanAccess = "IndexIntersection"
+	PlanIndexUnion        PlanAccess = "IndexUnion"
+	PlanFullScan          PlanAccess = "FullScan"
+)
+
+// Plan describes how FindMany and Count execute a query.
+type Plan struct {
+	Model  string
+	Access PlanAccess
+	// Indexes names the indexes read, most selective first.
+	Indexes []string
+	// EstimatedRows is the number of candidate records the access path is
+	// expected to read before Filters, Cursor, Skip, and Limit apply.
+	EstimatedRows int
+	// Ordered reports that candidates arrive in OrderBy order, so the result
+	// needs no sort and Limit stops the read early.
+	Ordered bool
+}
+
+// Plan costs are measured in record reads. Collecting a primary key for an
+// index intersection and comparing two records while sorting are both cheaper
+// than reading a record.
+const (
+	intersectionCost = 0.25
+	comparisonCost   = 0.25
+)
+
+// accessPath is one way to narrow a query down to candidate records. A
+// primary key path reads keys; an index path looks up values, or each of keys
+// when a relation filter selected them.
+type accessPath struct {
+	access   PlanAccess
+	index    *secondaryIndex
+	keys     []string
+	values   map[string]any
+	scan     orderedScan
+	estimate int
+}
+
+// queryPlan is the cheapest combination of access paths found for a query.
+// Several paths mean their candidates are intersected, and union holds one
+// plan per branch of an Or whose candidates are merged. A plan with neither
+// is a full scan.
+type queryPlan struct {
+	paths    []accessPath
+	union    []queryPlan
+	estimate int
+	ordered  bool
+	cost     float64
+}
+
+// plan chooses how to read the candidates of a normalized query. Paths are
+// considered in a fixed order, primary key first, then indexes in declaration
+// order, then relation filters, and equal costs resolve to the earliest one,
+// so the same query and statistics always produce the same plan.
+func (t *table) plan(query Query) (queryPlan, error) {
+	total := t.rows.len()
+	query.Filters = requiredFilters(query)
+	values := equalities(query)
+
+	if query.Index != "" {
+		index, ok := t.indexes[query.Index]
+		if !ok {
+			return queryPlan{}, fmt.Errorf("model %q does not define index %q", t.model.Name, query.Index)
+		}
+		path, ok := t.indexPath(index, query, values)
+		if !ok && index.definition.Type != IndexOrdered {
+			if len(query.Where) == 0 {
+				return costPlan(query, queryPlan{estimate: total}, total), nil
+			}
+			return queryPlan{}, fmt.Errorf("index %q lookup requires fields %v", index.definition.Name, index.definition.Fields)
+		}
+		return costPlan(query, singlePlan(path), path.estimate), nil
+	}
+
+	var paths []accessPath
+	if containsAll(values, t.model.PrimaryKey) {
+		primaryKey, err := keyFromValues(values, t.model.PrimaryKey)
+		if err != nil {
+			return queryPlan{}, err
+		}
+		paths = append(paths, accessPath{access: PlanPrimaryKey, keys: []string{primaryKey}, estimate: 1})
+	}
+	for _, definition := range t.model.Indexes {
+		if path, ok := t.indexPath(t.indexes[definition.Name], query, values); ok {
+			paths = append(paths, path)
+		}
+	}
+	for _, match := range requiredRelations(query.FilterExpr) {
+		if path, ok := t.relationPath(match); ok {
+			paths = append(paths, path)
+		}
+	}
+
+	// The most selective path bounds how many records can match, which
+	// tells how far a limited read has to go before the page is full.
+	matches := total
+	for _, path := range paths {
+		matches = min(matches, path.estimate)
+	}
+	// A full scan only wins when it is strictly cheaper than every index.
+	best := costPlan(query, queryPlan{estimate: total}, matches)
+	for _, path := range paths {
+		candidate := costPlan(query, singlePlan(path), matches)
+		if candidate.cost < best.cost || len(best.paths) == 0 && candidate.cost == best.cost {
+			best = candidate
+		}
+	}
+	if candidate, ok := intersectPaths(query, paths, total, matches); ok && candidate.cost < best.cost {
+		best = candidate
+	}
+	if candidate, ok := t.unionPlan(query, total, matches); ok && candidate.cost < best.cost {
+		best = candidate
+	}
+	return best, nil
+}
+
+// indexPath returns the access path index offers for query and whether it
+// narrows the read at all. Hash indexes need every field pinned; ordered
+// indexes are useful when they pin a prefix, bound a range, or yield OrderBy
+// order.
+func (t *table) indexPath(index *secondaryIndex, query Query, values map[string]any) (accessPath, bool) {
+	definition := index.definition
+	if definition.Type == IndexOrdered {
+		scan, useful := planOrderedScan(index, query, values)
+		estimate := 0
+		if scan.to == "" || scan.from < scan.to {
+			estimate = index.ordered.countRange(scan.from, scan.to)
+		}
+		return accessPath{access: PlanOrderedIndex, index: index, scan: scan, estimate: estimate}, useful
+	}
+	if index.list {
+		return listPath(index, query.Filters[definition.Fields[0]])
+	}
+	if !containsAll(values, definition.Fields) {
+		return accessPath{}, false
+	}
+	if definition.Unique {
+		// A unique index holds no key with a null in it.
+		for _, field := range definition.Fields {
+			if values[field] == nil {
+				return accessPath{}, false
+			}
+		}
+		return accessPath{access: PlanUniqueIndex, index: index, values: values, estimate: 1}, true
+	}
+	return accessPath{access: PlanIndex, index: index, values: values, estimate: index.stats().estimate()}, true
+}
+
+// listPath reads the records holding one element of a list through a
+// multi-valued index: the one filter names in Has, or else the first one it
+// names in HasEvery.
+func listPath(index *secondaryIndex, filter Filter) (accessPath, bool) {
+	element := filter.Has
+	if element == nil && len(filter.HasEvery) > 0 {
+		element = filter.HasEvery[0]
+	}
+	if element == nil {
+		return accessPath{}, false
+	}
+	return accessPath{access: PlanIndex, index: index, keys: []string{encodeKey([]any{element})}, estimate: index.stats().estimate()}, true
+}
+
+// relationPath reads the records a resolved relation filter selects by their
+// relation keys, through the primary key or a hash index over exactly the
+// relation fields.
+func (t *table) relationPath(match relationMatch) (accessPath, bool) {
+	keys := make([]string, 0, len(match.keys))
+	for key := range match.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if slices.Equal(match.fields, t.model.PrimaryKey) {
+		return accessPath{access: PlanPrimaryKey, keys: keys, estimate: len(keys)}, true
+	}
+	for _, definition := range t.model.Indexes {
+		if definition.Type == IndexOrdered || !slices.Equal(definition.Fields, match.fields) {
+			continue
+		}
+		index := t.indexes[definition.Name]
+		if definition.Unique {
+			return accessPath{access: PlanUniqueIndex, index: index, keys: keys, estimate: len(keys)}, true
+		}
+		return accessPath{access: PlanIndex, index: index, keys: keys, estimate: len(keys) * index.stats().estimate()}, true
+	}
+	return accessPath{}, false
+}
+
+// unionPlan plans every branch of an Or in the filter tree on its own and
+// merges their candidates. It only applies when each branch narrows the read;
+// one branch needing a full scan makes the whole union one.
+func (t *table) unionPlan(query Query, total int, matches int) (queryPlan, bool) {
+	var best queryPlan
+	found := false
+	for _, branches := range disjunctions(query.FilterExpr) {
+		plan := queryPlan{}
+		estimate := 0
+		for i := range branches {
+			branch, err := t.plan(Query{Where: query.Where, Filters: query.Filters, FilterExpr: &branches[i]})
+			if err != nil || len(branch.paths) == 0 && len(branch.union) == 0 {
+				plan.union = nil
+				break
+			}
+			plan.union = append(plan.union, branch)
+			estimate += branch.estimate
+		}
+		if len(plan.union) == 0 {
+			continue
+		}
+		plan.estimate = min(total, estimate)
+		plan = costPlan(query, plan, matches)
+		for _, branch := range plan.union {
+			plan.cost += intersectionCost * float64(branch.estimate)
+		}
+		if !found || plan.cost < best.cost {
+			best, found = plan, true
+		}
+	}
+	return best, found
+}
+
+// disjunctions returns the Or lists of expr that every match has to satisfy
+// one branch of: its own and those of the nodes reachable through And.
+func disjunctions(expr *FilterExpr) [][]FilterExpr {
+	if expr == nil {
+		return nil
+	}
+	var result [][]FilterExpr
+	if len(expr.Or) > 0 {
+		result = append(result, expr.Or)
+	}
+	for i := range expr.And {
+		result = append(result, disjunctions(&expr.And[i])...)
+	}
+	return result
+}
+
+// requiredFilters returns Filters extended with the filter tree leaves every
+// match has to satisfy, those reachable through And alone, so index paths can
+// use them. A field keeps the first filter found for it.
+func requiredFilters(query Query) map[string]Filter {
+	filters := query.Filters
+	cloned := false
+	var walk func(expr *FilterExpr)
+	walk = func(expr *FilterExpr) {
+		if expr.Field != "" {
+			if _, ok := filters[expr.Field]; !ok {
+				if !cloned {
+					filters = make(map[string]Filter, len(query.Filters)+1)
+					for field, filter := range query.Filters {
+						filters[field] = filter
+					}
+					cloned = true
+				}
+				filters[expr.Field] = expr.Filter
+			}
+		}
+		for i := range expr.And {
+			walk(&expr.And[i])
+		}
+	}
+	if query.FilterExpr != nil {
+		walk(query.FilterExpr)
+	}
+	return filters
+}
+
+// requiredRelations returns the resolved relation filters every match has to
+// satisfy by having a selected key: Some and Is operators reachable through
+// And alone.
+func requiredRelations(expr *FilterExpr) []relationMatch {
+	if expr == nil {
+		return nil
+	}
+	var result []relationMatch
+	for _, match := range expr.related {
+		if !match.exclude {
+			result = append(result, match)
+		}
+	}
+	for i := range expr.And {
+		result = append(result, requiredRelations(&expr.And[i])...)
+	}
+	return result
+}
+
+func singlePlan(path accessPath) queryPlan {
+	return queryPlan{paths: []accessPath{path}, estimate: path.estimate, ordered: path.scan.ordered}
+}
+
+// intersectPaths adds index paths in order of selectivity while each one
+// lowers the cost, assuming the indexed fields are independent. Primary key
+// and unique paths only take part when a relation filter gave them several
+// keys; otherwise they read at most one record.
+func intersectPaths(query Query, paths []accessPath, total int, matches int) (queryPlan, bool) {
+	var candidates []accessPath
+	for _, path := range paths {
+		if path.access == PlanIndex || path.access == PlanOrderedIndex || len(path.keys) > 1 {
+			candidates = append(candidates, path)
+		}
+	}
+	if len(candidates) < 2 || total == 0 {
+		return queryPlan{}, false
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].estimate < candidates[j].estimate
+	})
+
+	plan := costPlan(query, singlePlan(candidates[0]), matches)
+	selectivity := float64(candidates[0].estimate) / float64(total)
+	for i, path := range candidates[1:] {
+		selectivity *= float64(path.estimate) / float64(total)
+		next := queryPlan{
+			paths:    candidates[:i+2],
+			estimate: int(math.Ceil(selectivity * float64(total))),
+		}
+		next = costPlan(query, next, matches)
+		if next.cost >= plan.cost {
+			break
+		}
+		plan = next
+	}
+	return plan, len(plan.paths) > 1
+}
+
+// costPlan estimates the record reads of plan, including the sort it needs
+// when candidates do not arrive in OrderBy order and the primary keys an
+// intersection collects.
+func costPlan(query Query, plan queryPlan, matches int) queryPlan {
+	reads := float64(plan.estimate)
+	streams := query.Limit > 0 && len(query.Cursor) == 0 && (plan.ordered || len(query.OrderBy) == 0 && query.Skip == 0)
+	if streams && matches > 0 {
+		reads *= min(1, float64(query.Skip+query.Limit)/float64(matches))
+	}
+	if len(plan.paths) > 1 {
+		for _, path := range plan.paths {
+			reads += intersectionCost * float64(path.estimate)
+		}
+	}
+	if !plan.ordered && len(query.OrderBy) > 0 && plan.estimate > 1 {
+		rows := float64(plan.estimate)
+		reads += comparisonCost * rows * math.Log2(rows)
+	}
+	plan.cost = reads
+	return plan
+}
+
+func (plan queryPlan) describe(model string) Plan {
+	described := Plan{Model: model, Access: PlanFullScan, EstimatedRows: plan.estimate, Ordered: plan.ordered}
+	switch {
+	case len(plan.union) > 0:
+		described.Access = PlanIndexUnion
+	case len(plan.paths) == 1:
+		described.Access = plan.paths[0].access
+	case len(plan.paths) > 1:
+		described.Access = PlanIndexIntersection
+	}
+	for _, path := range plan.paths {
+		if path.index != nil {
+			described.Indexes = append(described.Indexes, path.index.definition.Name)
+		}
+	}
+	for _, branch := range plan.union {
+		described.Indexes = append(described.Indexes, branch.describe(model).Indexes...)
+	}
+	return described
+}
+
+// candidates calls fn with every record the plan reads, in plan order, until
+// fn returns false. Records still have to be matched against the query.
+func (t *table) candidates(plan queryPlan, query Query, fn func(Record) bool) error {
+	if len(plan.paths) == 0 && len(plan.union) == 0 {
+		t.rows.each(func(_ string, current recordVersion) bool {
+			return fn(current.record)
+		})
+		return nil
+	}
+	return t.candidateKeys(plan, query, func(primaryKey string) bool {
+		current, ok := t.rows.get(primaryKey)
+		if !ok {
+			return true
+		}
+		return fn(current.record)
+	})
+}
+
+// candidateKeys calls fn with the primary keys an index plan selects. Keys
+// merged from an intersection or a union arrive in sorted order.
+func (t *table) candidateKeys(plan queryPlan, query Query, fn func(primaryKey string) bool) error {
+	if len(plan.paths) == 1 {
+		path := plan.paths[0]
+		limit := 0
+		if path.index != nil && canLimitDuringIDLookup(query) {
+			limit = lookupLimit(query, path.index.definition)
+		}
+		return path.each(limit, fn)
+	}
+
+	var matched map[string]struct{}
+	if len(plan.union) > 0 {
+		matched = make(map[string]struct{}, plan.estimate)
+		for _, branch := range plan.union {
+			err := t.candidateKeys(branch, Query{}, func(primaryKey string) bool {
+				matched[primaryKey] = struct{}{}
+				return true
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, path := range plan.paths {
+		next := make(map[string]struct{}, path.estimate)
+		err := path.each(0, func(primaryKey string) bool {
+			if _, ok := matched[primaryKey]; ok || matched == nil {
+				next[primaryKey] = struct{}{}
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		matched = next
+	}
+	primaryKeys := make([]string, 0, len(matched))
+	for primaryKey := range matched {
+		primaryKeys = append(primaryKeys, primaryKey)
+	}
+	sort.Strings(primaryKeys)
+	for _, primaryKey := range primaryKeys {
+		if !fn(primaryKey) {
+			break
+		}
+	}
+	return nil
+}
+
+// each calls fn with the primary keys the path selects until fn returns
+// false. A positive limit lets a hash lookup stop early.
+func (path accessPath) each(limit int, fn func(primaryKey string) bool) error {
+	switch path.access {
+	case PlanPrimaryKey:
+		for _, key := range path.keys {
+			if !fn(key) {
+				break
+			}
+		}
+		return nil
+	case PlanOrderedIndex:
+		path.scan.each(fn)
+		return nil
+	}
+	if path.keys != nil {
+		for _, key := range path.keys {
+			for _, id := range path.index.lookupKey(key, 0) {
+				if !fn(id) {
+					return nil
+				}
+			}
+		}
+		return nil
+	}
+	ids, err := path.index.lookup(path.values, limit)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if !fn(id) {
+			break
+		}
+	}
+	return nil
+}
+
+// equalities collects the fields query pins to a single value, through Where,
+// an Equals filter, or an IsNull filter, which pins null. An Equals under a
+// Path pins a value inside the field, not the field itself.
+func equalities(query Query) map[string]any {
+	values := query.Where
+	cloned := false
+	for field, filter := range query.Filters {
+		if filter.Equals == nil && !filter.IsNull || len(filter.Path) > 0 {
+			continue
+		}
+		if _, ok := query.Where[field]; ok {
+			continue
+		}
+		if !cloned {
+			values = make(map[string]any, len(query.Where)+len(query.Filters))
+			for key, value := range query.Where {
+				values[key] = value
+			}
+			cloned = true
+		}
+		values[field] = filter.Equals
+	}
+	return values
+}
+
+// orderedScan walks one ordered index over the encoded keys in [from, to).
+// When ordered is set, the walk yields records in the query's OrderBy order.
+type orderedScan struct {
+	index      *secondaryIndex
+	from       string
+	to         string
+	descending bool
+	ordered    bool
+	// flipNulls is set when OrderBy places the nulls of its first field
+	// opposite to key order, last ascending or first descending. The walk
+	// then visits the keys from values on, those of the values that are not
+	// null, apart from the null keys before them.
+	flipNulls bool
+	values    string
+}
+
+// planOrderedScan narrows index to the key range query selects. Leading index
+// fields pinned by values form a prefix, the next field may carry a range
+// filter, and the following ones may match OrderBy. It reports whether the
+// scan does any better than reading the whole index in key order.
+func planOrderedScan(index *secondaryIndex, query Query, values map[string]any) (orderedScan, bool) {
+	fields := index.definition.Fields
+	var prefix []byte
+	pinned := 0
+	for pinned < len(fields) {
+		value, ok := values[fields[pinned]]
+		if !ok {
+			break
+		}
+		prefix = appendOrdered(prefix, value)
+		pinned++
+	}
+
+	scan := orderedScan{index: index, from: string(prefix), to: prefixEnd(prefix)}
+	useful := pinned > 0
+	if pinned < len(fields) {
+		if filter, ok := query.Filters[fields[pinned]]; ok && scan.narrow(prefix, filter) {
+			useful = true
+		}
+	}
+	if len(query.OrderBy) > 0 && len(query.OrderBy) <= len(fields)-pinned {
+		descending := query.OrderBy[0].Direction == SortDesc
+		scan.ordered = true
+		flipNulls := false
+		for i, order := range query.OrderBy {
+			if order.Field != fields[pinned+i] || (order.Direction == SortDesc) != descending {
+				scan.ordered = false
+				break
+			}
+			// Key order puts nulls first; only the first ordered field can
+			// have its nulls moved, by walking them apart.
+			if nullsFirst(order.Direction, order.Nulls) == descending {
+				if i > 0 {
+					scan.ordered = false
+					break
+				}
+				flipNulls = true
+			}
+		}
+		if scan.ordered {
+			scan.descending = descending
+			scan.flipNulls = flipNulls
+			scan.values = string(append(append([]byte(nil), prefix...), orderedValue))
+			useful = true
+		}
+	}
+	return scan, useful
+}
+
+// narrow tightens the scan bounds with the range operators of filter, applied
+// to the index field following prefix. It reports whether any bound applied.
+func (scan *orderedScan) narrow(prefix []byte, filter Filter) bool {
+	if len(filter.Path) > 0 {
+		return false
+	}
+	narrowed := false
+	bound := func(value any) []byte {
+		return appendOrdered(append([]byte(nil), prefix...), value)
+	}
+	lower := func(from string) {
+		if from > scan.from {
+			scan.from = from
+		}
+		narrowed = true
+	}
+	upper := func(to string) {
+		if to != "" && (scan.to == "" || to < scan.to) {
+			scan.to = to
+		}
+		narrowed = true
+	}
+	if filter.GT != nil {
+		lower(prefixEnd(bound(filter.GT)))
+	}
+	if filter.GTE != nil {
+		lower(string(bound(filter.GTE)))
+	}
+	if filter.LT != nil {
+		upper(string(bound(filter.LT)))
+	}
+	if filter.LTE != nil {
+		upper(prefixEnd(bound(filter.LTE)))
+	}
+	// Nulls order first and satisfy no range, so a range or IsNotNull starts
+	// past them.
+	if narrowed || filter.IsNotNull {
+		lower(string(append(append([]byte(nil), prefix...), orderedValue)))
+	}
+	return narrowed
+}
+
+func (scan orderedScan) each(fn func(primaryKey string) bool) {
+	if !scan.flipNulls {
+		scan.walk(scan.from, scan.to, fn)
+		return
+	}
+	nullsTo := scan.values
+	if scan.to != "" && scan.to < nullsTo {
+		nullsTo = scan.to
+	}
+	valuesFrom := max(scan.from, scan.values)
+	more := true
+	visit := func(primaryKey string) bool {
+		more = fn(primaryKey)
+		return more
+	}
+	if scan.descending {
+		scan.walk(scan.from, nullsTo, visit)
+		if more {
+			scan.walk(valuesFrom, scan.to, fn)
+		}
+		return
+	}
+	scan.walk(valuesFrom, scan.to, visit)
+	if more {
+		scan.walk(scan.from, nullsTo, fn)
+	}
+}
+
+// walk visits the keys in [from, to) in the direction of the scan.
+func (scan orderedScan) walk(from string, to string, fn func(primaryKey string) bool) {
+	if to != "" && from >= to {
+		return
+	}
+	if scan.descending {
+		scan.index.ordered.descend(from, to, fn)
+		return
+	}
+	scan.index.ordered.ascend(from, to, fn)
+}
@@ -1,15 +1,23 @@
 package zenithdb
 
-// Query describes an indexed application query.
+// Query describes an indexed application query. Where, Filters, and
+// FilterExpr must all match; FilterExpr may also filter through relations.
+// Select names the fields and relations each record returns, every field when
+// empty; a selected relation expands as if Include named it.
 type Query struct {
-	Where   map[string]any
-	Filters map[string]Filter
-	Index   string
-	Limit   int
-	Skip    int
-	Cursor  map[string]any
-	OrderBy []OrderBy
-	Include map[string]Include
+	Where      map[string]any
+	Filters    map[string]Filter
+	FilterExpr *FilterExpr
+	Index      string
+	Limit      int
+	Skip       int
+	Cursor     map[string]any
+	OrderBy    []OrderBy
+	Include    map[string]Include
+	Select     []string
+
+	// counters count the relations OrderBy orders by.
+	counters map[string]relationCounter
 }
 
 type SortDirection string
@@ -19,31 +27,104 @@ const (
 	SortDesc SortDirection = "desc"
 )
 
+// NullsOrder places null values before or after every other value.
+type NullsOrder string
+
+const (
+	NullsFirst NullsOrder = "first"
+	NullsLast  NullsOrder = "last"
+)
+
+// OrderBy orders records by Field, or, when Count names a Many relation, by
+// the number of records the relation connects. Nulls places null values; left
+// empty, they order first ascending and last descending.
 type OrderBy struct {
 	Field     string
 	Direction SortDirection
+	Count     string
+	Nulls     NullsOrder
 }
 
-// Filter describes Prisma-like field operators.
+// Filter describes Prisma-like field operators. On a FieldJSON field, Path
+// selects the value under a sequence of object keys and array indexes that the
+// other operators match, and ArrayContains matches an array holding a value,
+// or every element of an array value. On a List field, Equals and In compare
+// whole lists, Has matches a list holding a value, HasSome one holding any of
+// its values, HasEvery one holding all of them, and IsEmpty one that is empty,
+// or not when false. A nil Equals filters nothing: IsNull matches a field
+// that is null or missing and IsNotNull one that holds a value. Null never
+// satisfies a range operator.
 type Filter struct {
-	Equals   any
-	In       []any
-	Contains string
-	GT       any
-	GTE      any
-	LT       any
-	LTE      any
+	Equals        any
+	In            []any
+	Contains      string
+	GT            any
+	GTE           any
+	LT            any
+	LTE           any
+	Path          []string
+	ArrayContains any
+	Has           any
+	HasSome       []any
+	HasEvery      []any
+	IsEmpty       *bool
+	IsNull        bool
+	IsNotNull     bool
+}
+
+// FilterExpr is a boolean filter tree. A node matches when its Field satisfies
+// Filter, the records its Relation connects to satisfy RelationFilter, every
+// And child matches, at least one Or child matches, and Not does not match;
+// the parts a node leaves empty are ignored.
+type FilterExpr struct {
+	Field          string
+	Filter         Filter
+	Relation       string
+	RelationFilter RelationFilter
+	And            []FilterExpr
+	Or             []FilterExpr
+	Not            *FilterExpr
+
+	// related is RelationFilter resolved against the related model.
+	related []relationMatch
+}
+
+// RelationFilter matches records by the records a relation connects them to.
+// Some, Every, and None apply to Many relations: at least one, all, or no
+// related record matches. Is and IsNot apply to to-one relations: the related
+// record exists and matches, or it does not. Every operator set must hold, and
+// an empty FilterExpr matches any related record.
+type RelationFilter struct {
+	Some  *FilterExpr
+	Every *FilterExpr
+	None  *FilterExpr
+	Is    *FilterExpr
+	IsNot *FilterExpr
 }
 
-// Include asks the engine to expand a named relation.
+// Include asks the engine to expand a named relation. Query reads the related
+// records the way FindMany reads a model, within the ones the relation
+// connects: Where, Filters, FilterExpr, OrderBy, Cursor, Skip, and Limit apply
+// to Many relations only, and Select and Include, which expands the relations
+// of each related record in turn, apply to any relation. Limit is shorthand
+// for Query.Limit.
 type Include struct {
 	Limit int
+	Query Query
 }
 
-// MutationResult describes the outcome of a write operation.
+// CountField names the include, or the selected name, that counts the records
+// the Many relations of each record connect. Its Query.Select names the
+// relations to count, every Many relation when empty, and the record holds the
+// counts as a Record of int64 under CountField.
+const CountField = "_count"
+
+// MutationResult describes the outcome of a write operation. Record is the
+// record the write stored, holding the defaults it filled.
 type MutationResult struct {
-	Model string
-	Key   string
+	Model  string
+	Key    string
+	Record Record
 }
 
 type BatchOperationType string
@@ -72,3 +153,14 @@ type ManyResult struct {
 	Model string
 	Count int
 }
+
+// Change is one record a committed write created, updated, or deleted,
+// whether by the write itself, its nested writes, or the referential actions
+// it triggered. Before is nil for a record the write created and After is nil
+// for one it deleted.
+type Change struct {
+	Model  string
+	Key    string
+	Before Record
+	After  Record
+}
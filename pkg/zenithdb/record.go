@@ -1,9 +1,11 @@
 package zenithdb
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"sort"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -20,6 +22,9 @@ func cloneRecord(record Record) Record {
 	return cloned
 }
 
+// normalizeRecord normalizes record, a whole record a write stores: it must
+// hold every required field, and its values must satisfy the validation rules
+// of their fields.
 func normalizeRecord(model Model, record Record) (Record, error) {
 	return normalizeValues(model, record, true)
 }
@@ -28,12 +33,12 @@ func normalizePartial(model Model, values map[string]any) (Record, error) {
 	return normalizeValues(model, values, false)
 }
 
-func normalizeValues(model Model, values map[string]any, requireRequired bool) (Record, error) {
+func normalizeValues(model Model, values map[string]any, stored bool) (Record, error) {
 	normalized := make(Record, len(values))
 	fields := make(map[string]Field, len(model.Fields))
 	for _, field := range model.Fields {
 		fields[field.Name] = field
-		if requireRequired && field.Required {
+		if stored && field.Required {
 			if _, ok := values[field.Name]; !ok {
 				return nil, fmt.Errorf("model %q requires field %q", model.Name, field.Name)
 			}
@@ -45,22 +50,33 @@ func normalizeValues(model Model, values map[string]any, requireRequired bool) (
 		if !ok {
 			return nil, fmt.Errorf("model %q does not define field %q", model.Name, key)
 		}
-		normalizedValue, err := normalizeValue(field.Kind, value)
+		if value == nil && field.Required {
+			return nil, fmt.Errorf("model %q field %q is required and cannot be null", model.Name, key)
+		}
+		normalizedValue, err := normalizeValue(field, value)
 		if err != nil {
 			return nil, fmt.Errorf("model %q field %q: %w", model.Name, key, err)
 		}
+		if stored {
+			if err := validateValue(model, field, normalizedValue); err != nil {
+				return nil, err
+			}
+		}
 		normalized[key] = normalizedValue
 	}
 
 	return normalized, nil
 }
 
-func normalizeValue(kind FieldKind, value any) (any, error) {
+func normalizeValue(field Field, value any) (any, error) {
 	if value == nil {
 		return nil, nil
 	}
+	if field.List {
+		return normalizeList(field, value)
+	}
 
-	switch kind {
+	switch field.Kind {
 	case FieldString:
 		if typed, ok := value.(string); ok {
 			return typed, nil
@@ -138,11 +154,62 @@ func normalizeValue(kind FieldKind, value any) (any, error) {
 		default:
 			return nil, fmt.Errorf("expected time.Time, int64, or RFC3339 string")
 		}
+	case FieldEnum:
+		typed, ok := value.(string)
+		if !ok || !slices.Contains(field.Values, typed) {
+			return nil, fmt.Errorf("expected one of %s", strings.Join(field.Values, ", "))
+		}
+		return typed, nil
+	case FieldJSON:
+		return normalizeJSON(value)
+	case FieldBytes:
+		switch typed := value.(type) {
+		case []byte:
+			if typed == nil {
+				return nil, nil
+			}
+			return bytes.Clone(typed), nil
+		default:
+			return nil, fmt.Errorf("expected []byte")
+		}
 	default:
-		return nil, fmt.Errorf("unsupported field kind %q", kind)
+		return nil, fmt.Errorf("unsupported field kind %q", field.Kind)
 	}
 }
 
+// decodeBytes replaces in values the base64 strings JSON encodes the Bytes
+// fields of model as, alone or in a list, with the bytes they hold. The WAL
+// and snapshots are JSON, so the records read back from them are decoded
+// before they are applied; writes take []byte only.
+func decodeBytes(model Model, values map[string]any) error {
+	for _, field := range model.Fields {
+		if field.Kind != FieldBytes {
+			continue
+		}
+		switch typed := values[field.Name].(type) {
+		case string:
+			decoded, err := base64.StdEncoding.DecodeString(typed)
+			if err != nil {
+				return fmt.Errorf("model %q field %q: invalid base64 bytes", model.Name, field.Name)
+			}
+			values[field.Name] = decoded
+		case []any:
+			for i, element := range typed {
+				encoded, ok := element.(string)
+				if !ok {
+					continue
+				}
+				decoded, err := base64.StdEncoding.DecodeString(encoded)
+				if err != nil {
+					return fmt.Errorf("model %q field %q: invalid base64 bytes", model.Name, field.Name)
+				}
+				typed[i] = decoded
+			}
+		}
+	}
+	return nil
+}
+
 func keyFromRecord(record Record, fields []string) (string, error) {
 	values := make([]any, len(fields))
 	for i, field := range fields {
@@ -191,16 +258,56 @@ func encodeValue(value any) string {
 		return "f:" + strconv.FormatFloat(typed, 'g', -1, 64)
 	case time.Time:
 		return "t:" + typed.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return "x:" + base64.StdEncoding.EncodeToString(typed)
+	case map[string]any, []any:
+		// json.Marshal sorts object keys, so equal values encode alike.
+		raw, _ := json.Marshal(typed)
+		return "j:" + string(raw)
 	default:
 		return fmt.Sprintf("%T:%v", value, value)
 	}
 }
 
-func sortedIDs(ids map[string]struct{}) []string {
-	result := make([]string, 0, len(ids))
-	for id := range ids {
-		result = append(result, id)
+// decodeKey reverses encodeKey for keys over string, integer, bool, float,
+// time, bytes, and JSON values.
+func decodeKey(key string) ([]any, error) {
+	var values []any
+	for rest := key; rest != ""; {
+		length, encoded, ok := strings.Cut(rest, ":")
+		size, err := strconv.Atoi(length)
+		if !ok || err != nil || size < 0 || len(encoded) <= size || encoded[size] != '|' {
+			return nil, fmt.Errorf("malformed key %q", key)
+		}
+		value, err := decodeValue(encoded[:size])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		rest = encoded[size+1:]
+	}
+	return values, nil
+}
+
+func decodeValue(encoded string) (any, error) {
+	kind, raw, _ := strings.Cut(encoded, ":")
+	switch kind {
+	case "s":
+		return raw, nil
+	case "i":
+		return strconv.ParseInt(raw, 10, 64)
+	case "b":
+		return strconv.ParseBool(raw)
+	case "f":
+		return strconv.ParseFloat(raw, 64)
+	case "t":
+		parsed, err := time.Parse(time.RFC3339Nano, raw)
+		return parsed.UTC(), err
+	case "x":
+		return base64.StdEncoding.DecodeString(raw)
+	case "j":
+		return normalizeJSON(json.RawMessage(raw))
+	default:
+		return nil, fmt.Errorf("cannot decode key value %q", encoded)
 	}
-	sort.Strings(result)
-	return result
 }
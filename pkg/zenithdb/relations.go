@@ -1,53 +1,278 @@
 package zenithdb
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
 
-func (db *DB) expandIncludesLocked(modelName string, record Record, includes map[string]Include) error {
-	table, err := db.table(modelName)
-	if err != nil {
-		return err
-	}
+// ErrForeignKey is returned when a write would leave a foreign key pointing
+// at a record that does not exist.
+var ErrForeignKey = errors.New("foreign key violation")
+
+// reference is a foreign key relation of model that points at a table.
+type reference struct {
+	model    string
+	relation Relation
+}
 
-	relations := make(map[string]Relation, len(table.model.Relations))
-	for _, relation := range table.model.Relations {
-		relations[relation.Name] = relation
+// checkReferences enforces the foreign keys around a write that turns the
+// record t stores under primaryKey into after: nil for a delete, and no
+// stored record for an insert. The foreign keys after sets must point at
+// records in tables, and the values the write takes away from the record must
+// not be referenced through a relation whose action restricts the write;
+// applyReferentialActions handles the others once the write is applied.
+func checkReferences(tables *tableForks, t *table, primaryKey string, after Record) error {
+	var before Record
+	if current, ok := t.rows.get(primaryKey); ok {
+		before = current.record
 	}
 
-	for name, include := range includes {
-		relation, ok := relations[name]
+	for _, relation := range t.model.Relations {
+		if !relation.ForeignKey || after == nil || before != nil && sameValues(before, after, relation.Fields) {
+			continue
+		}
+		where, ok := relationValues(after, relation.Fields, relation.References)
 		if !ok {
-			return fmt.Errorf("model %q does not define relation %q", modelName, name)
+			continue
 		}
-
-		relatedTable, err := db.table(relation.Model)
+		target, err := tables.lookup(relation.Model)
 		if err != nil {
 			return err
 		}
+		_, found, err := target.findUnique(where, relation.References)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%w: model %q relation %q references no %s record with %v", ErrForeignKey, t.model.Name, relation.Name, relation.Model, where)
+		}
+	}
 
-		where := make(map[string]any, len(relation.References))
-		for i, field := range relation.Fields {
-			value, ok := record[field]
-			if !ok {
-				return fmt.Errorf("model %q relation %q missing local field %q", modelName, name, field)
+	for _, reference := range t.referencedBy {
+		relation := reference.relation
+		if before == nil || after != nil && sameValues(before, after, relation.References) {
+			continue
+		}
+		if action := relation.action(after == nil); action == ActionCascade || action == ActionSetNull {
+			continue
+		}
+		where, ok := relationValues(before, relation.References, relation.Fields)
+		if !ok {
+			continue
+		}
+		source, err := tables.lookup(reference.model)
+		if err != nil {
+			return err
+		}
+		referencing, err := source.findMany(Query{Where: where, Limit: 2, Select: source.model.PrimaryKey})
+		if err != nil {
+			return err
+		}
+		for _, record := range referencing {
+			// A record that references itself goes away with the write.
+			if key, err := keyFromRecord(record, source.model.PrimaryKey); err == nil && reference.model == t.model.Name && key == primaryKey {
+				continue
 			}
-			where[relation.References[i]] = value
+			held, _ := relationValues(before, relation.References, relation.References)
+			return fmt.Errorf("%w: %s record with %v is still referenced by model %q relation %q", ErrForeignKey, t.model.Name, held, reference.model, relation.Name)
 		}
+	}
+	return nil
+}
 
-		if relation.Many {
-			records, err := relatedTable.findMany(Query{Where: where, Limit: include.Limit})
+// checkStoredReferences enforces the foreign keys of the records tables
+// already hold, as a snapshot loads them all at once rather than write by
+// write.
+func checkStoredReferences(tables tableSet) error {
+	for _, t := range tables {
+		for _, relation := range t.model.Relations {
+			if !relation.ForeignKey {
+				continue
+			}
+			target, err := tables.table(relation.Model)
 			if err != nil {
 				return err
 			}
-			record[name] = records
+			t.rows.each(func(_ string, version recordVersion) bool {
+				where, ok := relationValues(version.record, relation.Fields, relation.References)
+				if !ok {
+					return true
+				}
+				_, found, lookupErr := target.findUnique(where, relation.References)
+				if lookupErr == nil && !found {
+					lookupErr = fmt.Errorf("%w: model %q relation %q references no %s record with %v", ErrForeignKey, t.model.Name, relation.Name, relation.Model, where)
+				}
+				err = lookupErr
+				return err == nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyReferentialActions applies to tables the Cascade and SetNull actions
+// of the relations that referenced before, the record a write just turned
+// into after, nil for a delete. It returns the WAL operations of the writes it
+// made.
+func applyReferentialActions(tables *tableForks, t *table, before Record, after Record, sequence uint64) ([]operation, error) {
+	var operations []operation
+	for _, reference := range t.referencedBy {
+		relation := reference.relation
+		action := relation.action(after == nil)
+		if action != ActionCascade && action != ActionSetNull || after != nil && sameValues(before, after, relation.References) {
 			continue
 		}
+		where, ok := relationValues(before, relation.References, relation.Fields)
+		if !ok {
+			continue
+		}
+		source, err := tables.lookup(reference.model)
+		if err != nil {
+			return nil, err
+		}
+		referencing, err := source.findMany(Query{Where: where, Select: source.model.PrimaryKey})
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range referencing {
+			child := BatchOperation{Type: BatchUpdate, Model: reference.model, Where: map[string]any(record), Record: make(Record, len(relation.Fields))}
+			for i, field := range relation.Fields {
+				child.Record[field] = nil
+				if action == ActionCascade {
+					child.Record[field] = after[relation.References[i]]
+				}
+			}
+			if action == ActionCascade && after == nil {
+				child = BatchOperation{Type: BatchDelete, Model: reference.model, Where: map[string]any(record)}
+			}
+			childOperations, _, err := applyBatchOperation(tables, child, sequence)
+			if errors.Is(err, ErrNotFound) {
+				// An earlier cascade already deleted the record.
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, childOperations...)
+		}
+	}
+	return operations, nil
+}
+
+// action returns the referential action the relation takes when the record
+// it references is deleted, or otherwise updated.
+func (relation Relation) action(deleted bool) ReferentialAction {
+	action := relation.OnUpdate
+	if deleted {
+		action = relation.OnDelete
+	}
+	if action == "" {
+		return ActionRestrict
+	}
+	return action
+}
+
+// relationValues maps the values record holds in fields to the matching
+// names of to, reporting false when any of them is missing or null.
+func relationValues(record Record, fields []string, to []string) (map[string]any, bool) {
+	values := make(map[string]any, len(fields))
+	for i, field := range fields {
+		value, ok := record[field]
+		if !ok || value == nil {
+			return nil, false
+		}
+		values[to[i]] = value
+	}
+	return values, true
+}
 
-		related, ok, err := db.findUniqueLocked(relatedTable, where)
+// relationKey returns the key record holds over fields, reporting false when
+// any of them is missing or null, as a null key relates no record.
+func relationKey(record Record, fields []string) (string, bool) {
+	values := make([]any, len(fields))
+	for i, field := range fields {
+		if values[i] = record[field]; values[i] == nil {
+			return "", false
+		}
+	}
+	return encodeKey(values), true
+}
+
+func sameValues(left Record, right Record, fields []string) bool {
+	for _, field := range fields {
+		if compareValues(left[field], right[field]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (tables tableSet) expandIncludes(modelName string, record Record, includes map[string]Include) error {
+	table, err := tables.table(modelName)
+	if err != nil {
+		return err
+	}
+
+	for name, include := range includes {
+		if name == CountField {
+			counts, err := tables.countRelations(table.model, record, include.Query.Select)
+			if err != nil {
+				return err
+			}
+			record[name] = counts
+			continue
+		}
+		relation, ok := findRelation(table.model, name)
+		if !ok {
+			return fmt.Errorf("model %q does not define relation %q", modelName, name)
+		}
+		query, err := include.relatedQuery(relation)
 		if err != nil {
-			return err
+			return fmt.Errorf("model %q relation %q: %w", modelName, name, err)
 		}
-		if ok {
-			record[name] = related
+
+		if relation.Through != "" {
+			keys, err := tables.linkedKeys(relation, record)
+			if err != nil {
+				return err
+			}
+			query.FilterExpr = &FilterExpr{related: []relationMatch{{fields: relation.References, keys: keys}}}
+			if include.Query.FilterExpr != nil {
+				query.FilterExpr.And = []FilterExpr{*include.Query.FilterExpr}
+			}
+		} else {
+			where := make(map[string]any, len(query.Where)+len(relation.References))
+			for field, value := range query.Where {
+				where[field] = value
+			}
+			for i, field := range relation.Fields {
+				// A null or missing key, or a where that pins the key to
+				// another value, connects nothing.
+				value := record[field]
+				if held, ok := where[relation.References[i]]; value == nil || ok && compareValues(held, value) != 0 {
+					where = nil
+					break
+				}
+				where[relation.References[i]] = value
+			}
+			query.Where = where
+		}
+
+		var records []Record
+		if query.Where != nil || relation.Through != "" {
+			if records, err = tables.findRelated(relation.Model, query); err != nil {
+				return err
+			}
+		}
+
+		if relation.Many {
+			record[name] = records
+		} else if len(records) > 0 {
+			record[name] = records[0]
 		} else {
 			record[name] = nil
 		}
@@ -55,3 +280,373 @@ func (db *DB) expandIncludesLocked(modelName string, record Record, includes map
 
 	return nil
 }
+
+// countRelations returns the number of records each named Many relation of
+// model connects record to, every Many relation when names is empty.
+func (tables tableSet) countRelations(model Model, record Record, names []string) (Record, error) {
+	if len(names) == 0 {
+		for _, relation := range model.Relations {
+			if relation.Many {
+				names = append(names, relation.Name)
+			}
+		}
+	}
+	counts := make(Record, len(names))
+	for _, name := range names {
+		counter, err := tables.counter(model, name)
+		if err != nil {
+			return nil, err
+		}
+		count, err := counter.count(record)
+		if err != nil {
+			return nil, err
+		}
+		counts[name] = int64(count)
+	}
+	return counts, nil
+}
+
+// relationCounter counts the records a Many relation connects a record to:
+// the records of table whose fields hold the record's key, the related model
+// or, for a many-to-many relation, the join model. A hash index over fields
+// answers with the size of the key's bucket, without reading the records.
+type relationCounter struct {
+	relation Relation
+	table    *table
+	fields   []string
+	index    *secondaryIndex
+}
+
+// counter returns the relationCounter of the Many relation name of model.
+func (tables tableSet) counter(model Model, name string) (relationCounter, error) {
+	relation, ok := findRelation(model, name)
+	if !ok {
+		return relationCounter{}, fmt.Errorf("model %q does not define relation %q", model.Name, name)
+	}
+	if !relation.Many {
+		return relationCounter{}, fmt.Errorf("model %q relation %q is not a Many relation and has no count", model.Name, name)
+	}
+	target, fields := relation.Model, relation.References
+	if relation.Through != "" {
+		target, fields = relation.Through, relation.ThroughFields
+	}
+	t, err := tables.table(target)
+	if err != nil {
+		return relationCounter{}, err
+	}
+	counter := relationCounter{relation: relation, table: t, fields: fields}
+	for _, index := range t.indexes {
+		if index.definition.Type != IndexOrdered && slices.Equal(index.definition.Fields, fields) {
+			counter.index = index
+			break
+		}
+	}
+	return counter, nil
+}
+
+// count returns the number of records the relation connects record to.
+func (counter relationCounter) count(record Record) (int, error) {
+	where, ok := relationValues(record, counter.relation.Fields, counter.fields)
+	if !ok {
+		return 0, nil
+	}
+	if counter.index == nil {
+		return counter.table.count(Query{Where: where})
+	}
+	key, err := keyFromValues(where, counter.fields)
+	if err != nil {
+		return 0, err
+	}
+	if counter.index.definition.Unique {
+		if _, ok := counter.index.unique.get(key); ok {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	bucket, _ := counter.index.multi.get(key)
+	return bucket.len(), nil
+}
+
+// findRelated reads the records of model an include's query selects and
+// expands their own includes.
+func (tables tableSet) findRelated(model string, query Query) ([]Record, error) {
+	t, query, err := tables.prepareQuery(model, query)
+	if err != nil {
+		return nil, err
+	}
+	records, err := t.findMany(query)
+	if err != nil {
+		return nil, err
+	}
+	include := selectIncludes(t.model, query.Select, query.Include)
+	for _, record := range records {
+		if len(include) > 0 {
+			if err := tables.expandIncludes(model, record, include); err != nil {
+				return nil, err
+			}
+		}
+		trimRecord(record, query.Select, include)
+	}
+	return records, nil
+}
+
+// relatedQuery returns the query include reads the records of relation with,
+// rejecting the parts a to-one relation does not take.
+func (include Include) relatedQuery(relation Relation) (Query, error) {
+	query := include.Query
+	if query.Limit == 0 {
+		query.Limit = include.Limit
+	}
+	if !relation.Many && (len(query.Where) > 0 || len(query.Filters) > 0 || query.FilterExpr != nil || query.Index != "" || len(query.OrderBy) > 0 || len(query.Cursor) > 0 || query.Skip > 0 || query.Limit > 0) {
+		return Query{}, fmt.Errorf("a to-one relation only takes Select and Include")
+	}
+	return query, nil
+}
+
+// relationMatch is one relation filter operator resolved against the related
+// model: the keys, over the local relation fields, of the records it selects.
+// A record matches when its key is among them, or, when exclude is set, when
+// it is not.
+type relationMatch struct {
+	fields  []string
+	keys    map[string]struct{}
+	exclude bool
+}
+
+func (match relationMatch) matches(record Record) bool {
+	key, ok := relationKey(record, match.fields)
+	if !ok {
+		return match.exclude
+	}
+	_, ok = match.keys[key]
+	return ok != match.exclude
+}
+
+// prepareQuery returns the table model reads and query with its relation
+// filters and the relation counts it orders by resolved against tables, so the
+// table can plan, match, and sort without reaching into other models.
+func (tables tableSet) prepareQuery(model string, query Query) (*table, Query, error) {
+	table, err := tables.table(model)
+	if err != nil {
+		return nil, Query{}, err
+	}
+	query.FilterExpr, err = tables.resolveRelationFilters(table.model, query.FilterExpr)
+	if err != nil {
+		return nil, Query{}, err
+	}
+	for _, order := range query.OrderBy {
+		if order.Count == "" {
+			continue
+		}
+		counter, err := tables.counter(table.model, order.Count)
+		if err != nil {
+			return nil, Query{}, err
+		}
+		if query.counters == nil {
+			query.counters = make(map[string]relationCounter)
+		}
+		query.counters[order.Count] = counter
+	}
+	return table, query, nil
+}
+
+// resolveRelationFilters returns a copy of expr in which every relation filter
+// has read the related model, through that model's own plan, and kept the
+// relation keys of the records each operator selects. Every holds when no
+// related record fails the filter, so it keeps the records that do.
+func (tables tableSet) resolveRelationFilters(model Model, expr *FilterExpr) (*FilterExpr, error) {
+	if expr == nil {
+		return nil, nil
+	}
+	resolved := *expr
+	var err error
+	if resolved.And, err = tables.resolveRelationFilterList(model, expr.And); err != nil {
+		return nil, err
+	}
+	if resolved.Or, err = tables.resolveRelationFilterList(model, expr.Or); err != nil {
+		return nil, err
+	}
+	if resolved.Not, err = tables.resolveRelationFilters(model, expr.Not); err != nil {
+		return nil, err
+	}
+	if expr.Relation == "" {
+		return &resolved, nil
+	}
+
+	relation, ok := findRelation(model, expr.Relation)
+	if !ok {
+		return nil, fmt.Errorf("model %q does not define relation %q", model.Name, expr.Relation)
+	}
+	relatedTable, err := tables.table(relation.Model)
+	if err != nil {
+		return nil, err
+	}
+	filter := expr.RelationFilter
+	operators := []struct {
+		name    string
+		expr    *FilterExpr
+		many    bool
+		negate  bool
+		exclude bool
+	}{
+		{name: "Some", expr: filter.Some, many: true},
+		{name: "Every", expr: filter.Every, many: true, negate: true, exclude: true},
+		{name: "None", expr: filter.None, many: true, exclude: true},
+		{name: "Is", expr: filter.Is},
+		{name: "IsNot", expr: filter.IsNot, exclude: true},
+	}
+	resolved.Relation = ""
+	resolved.RelationFilter = RelationFilter{}
+	resolved.related = append([]relationMatch(nil), expr.related...)
+	for _, operator := range operators {
+		if operator.expr == nil {
+			continue
+		}
+		if operator.many != relation.Many {
+			return nil, fmt.Errorf("model %q relation %q does not support %s filters", model.Name, relation.Name, operator.name)
+		}
+		selected := operator.expr
+		if operator.negate {
+			selected = &FilterExpr{Not: selected}
+		}
+		keys, err := tables.relatedKeys(relatedTable, selected, relation.References)
+		if err == nil && relation.Through != "" {
+			keys, err = tables.throughKeys(relation, keys)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("model %q relation %q: %w", model.Name, relation.Name, err)
+		}
+		resolved.related = append(resolved.related, relationMatch{fields: relation.Fields, keys: keys, exclude: operator.exclude})
+	}
+	return &resolved, nil
+}
+
+func (tables tableSet) resolveRelationFilterList(model Model, exprs []FilterExpr) ([]FilterExpr, error) {
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+	resolved := make([]FilterExpr, 0, len(exprs))
+	for i := range exprs {
+		expr, err := tables.resolveRelationFilters(model, &exprs[i])
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, *expr)
+	}
+	return resolved, nil
+}
+
+// relatedKeys returns the keys, over fields, of the records in t matching
+// expr. Records missing one of the fields, or holding null in it, have no key
+// and are left out.
+func (tables tableSet) relatedKeys(t *table, expr *FilterExpr, fields []string) (map[string]struct{}, error) {
+	resolved, err := tables.resolveRelationFilters(t.model, expr)
+	if err != nil {
+		return nil, err
+	}
+	query, err := t.normalizeQuery(Query{FilterExpr: resolved})
+	if err != nil {
+		return nil, err
+	}
+	plan, err := t.plan(query)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]struct{})
+	err = t.candidates(plan, query, func(record Record) bool {
+		if !matchesQuery(record, query) {
+			return true
+		}
+		if key, ok := relationKey(record, fields); ok {
+			keys[key] = struct{}{}
+		}
+		return true
+	})
+	return keys, err
+}
+
+// throughKeys maps keys, over the references of a many-to-many relation, to
+// the keys, over its fields, of the records its join model connects them to.
+// The join records are read through the join model's own plan, by the keys
+// they hold in ThroughReferences.
+func (tables tableSet) throughKeys(relation Relation, keys map[string]struct{}) (map[string]struct{}, error) {
+	join, err := tables.table(relation.Through)
+	if err != nil {
+		return nil, err
+	}
+	query := Query{FilterExpr: &FilterExpr{related: []relationMatch{{fields: relation.ThroughReferences, keys: keys}}}}
+	plan, err := join.plan(query)
+	if err != nil {
+		return nil, err
+	}
+	joined := make(map[string]struct{})
+	err = join.candidates(plan, query, func(link Record) bool {
+		if !matchesQuery(link, query) {
+			return true
+		}
+		if key, ok := relationKey(link, relation.ThroughFields); ok {
+			joined[key] = struct{}{}
+		}
+		return true
+	})
+	return joined, err
+}
+
+// linkedKeys returns the keys, over the references of a many-to-many
+// relation, of the records its join model connects record to.
+func (tables tableSet) linkedKeys(relation Relation, record Record) (map[string]struct{}, error) {
+	join, err := tables.table(relation.Through)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]struct{})
+	where, ok := relationValues(record, relation.Fields, relation.ThroughFields)
+	if !ok {
+		return keys, nil
+	}
+	links, err := join.findMany(Query{Where: where, Select: relation.ThroughReferences})
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		if key, err := keyFromRecord(link, relation.ThroughReferences); err == nil {
+			keys[key] = struct{}{}
+		}
+	}
+	return keys, nil
+}
+
+// throughRecords returns the records of related that the rows of join
+// connect record to through relation.
+func throughRecords(join *table, related *table, relation Relation, record Record) ([]Record, error) {
+	where, ok := relationValues(record, relation.Fields, relation.ThroughFields)
+	if !ok {
+		return nil, nil
+	}
+	links, err := join.findMany(Query{Where: where})
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	for _, link := range links {
+		where, ok := relationValues(link, relation.ThroughReferences, relation.References)
+		if !ok {
+			continue
+		}
+		found, err := related.findMany(Query{Where: where})
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, found...)
+	}
+	return records, nil
+}
+
+func findRelation(model Model, name string) (Relation, bool) {
+	for _, relation := range model.Relations {
+		if relation.Name == name {
+			return relation, true
+		}
+	}
+	return Relation{}, false
+}
@@ -3,6 +3,7 @@ package remote
 import (
 	"context"
 	"errors"
+	"iter"
 	"runtime"
 	"sync/atomic"
 
@@ -25,12 +26,17 @@ type wireClient interface {
 	DeleteMany(context.Context, string, zenithdb.Query) (zenithdb.ManyResult, error)
 	Upsert(context.Context, string, map[string]any, zenithdb.Record, zenithdb.Record) (zenithdb.Record, bool, error)
 	Batch(context.Context, []zenithdb.BatchOperation) ([]zenithdb.BatchResult, error)
-	FindUnique(context.Context, string, map[string]any, map[string]zenithdb.Include) (zenithdb.Record, bool, error)
+	FindUnique(context.Context, string, map[string]any, map[string]zenithdb.Include, []string) (zenithdb.Record, bool, error)
 	FindMany(context.Context, string, zenithdb.Query) ([]zenithdb.Record, error)
+	Iterate(context.Context, string, zenithdb.Query) iter.Seq2[zenithdb.Record, error]
 	Count(context.Context, string, zenithdb.Query) (int, error)
+	Explain(context.Context, string, zenithdb.Query) (zenithdb.Plan, error)
+	Aggregate(context.Context, string, zenithdb.AggregateQuery) (zenithdb.AggregateResult, error)
+	GroupBy(context.Context, string, zenithdb.GroupByQuery) ([]zenithdb.Group, error)
 	Checkpoint(context.Context) error
 	PullSchema(context.Context) (string, error)
 	ValidateSchema(context.Context, string) error
+	Begin(context.Context) (*wire.Tx, error)
 }
 
 type OpenOptions struct {
@@ -136,14 +142,36 @@ func (c *Client) Batch(ctx context.Context, operations []zenithdb.BatchOperation
 	return c.pick().Batch(ctx, operations)
 }
 
-func (c *Client) FindUnique(ctx context.Context, model string, where map[string]any, include map[string]zenithdb.Include) (zenithdb.Record, bool, error) {
-	return c.pick().FindUnique(ctx, model, where, include)
+func (c *Client) FindUnique(ctx context.Context, model string, where map[string]any, include map[string]zenithdb.Include, selected []string) (zenithdb.Record, bool, error) {
+	return c.pick().FindUnique(ctx, model, where, include, selected)
 }
 
 func (c *Client) FindMany(ctx context.Context, model string, query zenithdb.Query) ([]zenithdb.Record, error) {
 	return c.pick().FindMany(ctx, model, query)
 }
 
+func (c *Client) Iterate(ctx context.Context, model string, query zenithdb.Query) iter.Seq2[zenithdb.Record, error] {
+	return c.pick().Iterate(ctx, model, query)
+}
+
 func (c *Client) Count(ctx context.Context, model string, query zenithdb.Query) (int, error) {
 	return c.pick().Count(ctx, model, query)
 }
+
+func (c *Client) Explain(ctx context.Context, model string, query zenithdb.Query) (zenithdb.Plan, error) {
+	return c.pick().Explain(ctx, model, query)
+}
+
+func (c *Client) Aggregate(ctx context.Context, model string, query zenithdb.AggregateQuery) (zenithdb.AggregateResult, error) {
+	return c.pick().Aggregate(ctx, model, query)
+}
+
+func (c *Client) GroupBy(ctx context.Context, model string, query zenithdb.GroupByQuery) ([]zenithdb.Group, error) {
+	return c.pick().GroupBy(ctx, model, query)
+}
+
+// Begin starts a transaction pinned to one pooled connection; every statement
+// of the transaction travels over that connection.
+func (c *Client) Begin(ctx context.Context) (*wire.Tx, error) {
+	return c.pick().Begin(ctx)
+}
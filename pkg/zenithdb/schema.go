@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"slices"
 )
 
 // FieldKind describes the storage-level type ZenithDB understands.
@@ -16,29 +17,121 @@ const (
 	FieldBool   FieldKind = "bool"
 	FieldFloat  FieldKind = "float"
 	FieldTime   FieldKind = "time"
+	FieldEnum   FieldKind = "enum"
+	// FieldJSON holds a JSON value: nested objects, arrays, numbers, strings,
+	// and bools.
+	FieldJSON FieldKind = "json"
+	// FieldBytes holds raw bytes.
+	FieldBytes FieldKind = "bytes"
 )
 
-// Field defines one model property.
+// Field defines one model property. A FieldEnum field names its Enum and
+// carries the enum's Values, the strings it accepts. A create that leaves out
+// a field with a Default stores the default instead. A FieldTime field marked
+// UpdatedAt is stamped with the time of every create and update that leaves
+// it out. A List field holds a list of values of its Kind. Writes check the
+// values of a field against its Validations.
 type Field struct {
-	Name     string
-	Kind     FieldKind
-	Required bool
+	Name        string
+	Kind        FieldKind
+	Required    bool
+	Enum        string       `json:",omitempty"`
+	Values      []string     `json:",omitempty"`
+	Default     *Default     `json:",omitempty"`
+	UpdatedAt   bool         `json:",omitempty"`
+	List        bool         `json:",omitempty"`
+	Validations []Validation `json:",omitempty"`
 }
 
+// DefaultFunc names a value the engine generates for a field a create leaves
+// out.
+type DefaultFunc string
+
+const (
+	// DefaultNow stamps a FieldTime field with the time of the write.
+	DefaultNow DefaultFunc = "now"
+	// DefaultUUID fills a FieldString field with a random version 4 UUID.
+	DefaultUUID DefaultFunc = "uuid"
+	// DefaultCUID fills a FieldString field with a collision-resistant ID
+	// that starts with the letter c.
+	DefaultCUID DefaultFunc = "cuid"
+	// DefaultAutoincrement fills a FieldInt64 field with the next value of
+	// its model's sequence, one more than the largest value the field has
+	// held.
+	DefaultAutoincrement DefaultFunc = "autoincrement"
+)
+
+// Default is the value of a field a create leaves out: the one Func generates,
+// or Value, a literal written as in a schema file, when Func is empty.
+type Default struct {
+	Func  DefaultFunc `json:",omitempty"`
+	Value string      `json:",omitempty"`
+}
+
+// Enum defines a named set of string values.
+type Enum struct {
+	Name   string
+	Values []string
+}
+
+// IndexType selects the structure backing an index.
+type IndexType string
+
+const (
+	// IndexHash serves equality lookups. It is the default.
+	IndexHash IndexType = "Hash"
+	// IndexOrdered keeps entries sorted by the indexed fields, so it also
+	// serves range filters and ordered reads.
+	IndexOrdered IndexType = "Ordered"
+)
+
 // Index defines a secondary lookup path.
 type Index struct {
 	Name   string
 	Fields []string
 	Unique bool
+	Type   IndexType `json:",omitempty"`
 }
 
-// Relation defines metadata for a Prisma-like relation.
+// ReferentialAction decides what happens to the records whose foreign key
+// points at a record that is deleted, or whose referenced fields change.
+type ReferentialAction string
+
+const (
+	// ActionRestrict rejects the write while any record references the old
+	// values. It is the default.
+	ActionRestrict ReferentialAction = "Restrict"
+	// ActionNoAction behaves like ActionRestrict.
+	ActionNoAction ReferentialAction = "NoAction"
+	// ActionCascade deletes the referencing records along with the record,
+	// or updates their foreign key to the new values.
+	ActionCascade ReferentialAction = "Cascade"
+	// ActionSetNull clears the foreign key of the referencing records.
+	ActionSetNull ReferentialAction = "SetNull"
+)
+
+// Relation defines metadata for a Prisma-like relation. ForeignKey marks the
+// side whose Fields hold a foreign key to the References of Model, the side a
+// schema gives @relation(fields: ..., references: ...); the engine keeps every
+// such key pointing at an existing record. OnDelete and OnUpdate, set on the
+// same side, apply when the referenced record is deleted or its referenced
+// fields are updated.
+//
+// Through names the join model of a many-to-many relation. Each of its records
+// connects the record whose Fields it holds in ThroughFields to the record of
+// Model whose References it holds in ThroughReferences.
 type Relation struct {
-	Name       string
-	Model      string
-	Fields     []string
-	References []string
-	Many       bool
+	Name              string
+	Model             string
+	Fields            []string
+	References        []string
+	Many              bool
+	ForeignKey        bool              `json:",omitempty"`
+	OnDelete          ReferentialAction `json:",omitempty"`
+	OnUpdate          ReferentialAction `json:",omitempty"`
+	Through           string            `json:",omitempty"`
+	ThroughFields     []string          `json:",omitempty"`
+	ThroughReferences []string          `json:",omitempty"`
 }
 
 // Model defines the schema for a logical collection.
@@ -53,6 +146,7 @@ type Model struct {
 // Schema is the complete database model definition.
 type Schema struct {
 	Models []Model
+	Enums  []Enum `json:",omitempty"`
 }
 
 // Validate checks model names, fields, indexes, primary keys, and relations.
@@ -74,7 +168,11 @@ func (s Schema) Hash() (string, error) {
 }
 
 func (s Schema) validate() error {
-	seenModels := make(map[string]struct{}, len(s.Models))
+	enums, err := s.validateEnums()
+	if err != nil {
+		return err
+	}
+	seenModels := make(map[string]Model, len(s.Models))
 	for _, model := range s.Models {
 		if model.Name == "" {
 			return fmt.Errorf("model name is required")
@@ -82,7 +180,10 @@ func (s Schema) validate() error {
 		if _, ok := seenModels[model.Name]; ok {
 			return fmt.Errorf("model %q is defined more than once", model.Name)
 		}
-		seenModels[model.Name] = struct{}{}
+		if _, ok := enums[model.Name]; ok {
+			return fmt.Errorf("model %q has the name of an enum", model.Name)
+		}
+		seenModels[model.Name] = model
 
 		if len(model.PrimaryKey) == 0 {
 			return fmt.Errorf("model %q must define a primary key", model.Name)
@@ -96,13 +197,40 @@ func (s Schema) validate() error {
 			if _, ok := fields[field.Name]; ok {
 				return fmt.Errorf("model %q field %q is defined more than once", model.Name, field.Name)
 			}
+			if err := validateEnumField(model, field, enums); err != nil {
+				return err
+			}
+			if err := validateDefault(model, field); err != nil {
+				return err
+			}
+			if err := validateRules(model, field); err != nil {
+				return err
+			}
+			if field.UpdatedAt && (field.Kind != FieldTime || field.List) {
+				return fmt.Errorf("model %q field %q of kind %s cannot be stamped with @updatedAt", model.Name, field.Name, field.Kind)
+			}
+			if field.List && (field.Kind == FieldJSON || field.Kind == FieldEnum) {
+				return fmt.Errorf("model %q field %q of kind %s cannot be a list", model.Name, field.Name, field.Kind)
+			}
+			if isAutoincrement(field) {
+				if name, ok := autoincrementField(model); ok && name != field.Name {
+					return fmt.Errorf("model %q can autoincrement only one field", model.Name)
+				}
+			}
 			fields[field.Name] = field
 		}
 
 		for _, name := range model.PrimaryKey {
-			if _, ok := fields[name]; !ok {
+			field, ok := fields[name]
+			if !ok {
 				return fmt.Errorf("model %q primary key references unknown field %q", model.Name, name)
 			}
+			if field.Kind == FieldJSON || field.Kind == FieldBytes {
+				return fmt.Errorf("model %q primary key field %q cannot be of kind %s", model.Name, name, field.Kind)
+			}
+			if field.List {
+				return fmt.Errorf("model %q primary key field %q cannot be a list", model.Name, name)
+			}
 		}
 
 		indexNames := make(map[string]struct{}, len(model.Indexes))
@@ -117,24 +245,208 @@ func (s Schema) validate() error {
 			if len(index.Fields) == 0 {
 				return fmt.Errorf("model %q index %q must include at least one field", model.Name, index.Name)
 			}
-			for _, field := range index.Fields {
-				if _, ok := fields[field]; !ok {
-					return fmt.Errorf("model %q index %q references unknown field %q", model.Name, index.Name, field)
+			for _, name := range index.Fields {
+				field, ok := fields[name]
+				if !ok {
+					return fmt.Errorf("model %q index %q references unknown field %q", model.Name, index.Name, name)
+				}
+				// An index over a list holds a record under each of its
+				// elements, so it cannot cover other fields or order them.
+				if field.List && (len(index.Fields) > 1 || index.Unique || index.Type == IndexOrdered) {
+					return fmt.Errorf("model %q index %q over list field %q must be a non-unique hash index on that field alone", model.Name, index.Name, name)
+				}
+			}
+			switch index.Type {
+			case "", IndexHash:
+			case IndexOrdered:
+				if index.Unique {
+					return fmt.Errorf("model %q index %q cannot be both unique and ordered", model.Name, index.Name)
 				}
+			default:
+				return fmt.Errorf("model %q index %q has unsupported type %q", model.Name, index.Name, index.Type)
 			}
 		}
 	}
 
 	for _, model := range s.Models {
 		for _, relation := range model.Relations {
-			if _, ok := seenModels[relation.Model]; !ok {
+			target, ok := seenModels[relation.Model]
+			if !ok {
 				return fmt.Errorf("model %q relation %q references unknown model %q", model.Name, relation.Name, relation.Model)
 			}
 			if len(relation.Fields) != len(relation.References) {
 				return fmt.Errorf("model %q relation %q must have the same number of fields and references", model.Name, relation.Name)
 			}
+			if relation.ForeignKey {
+				if err := validateForeignKey(model, relation, target); err != nil {
+					return err
+				}
+			} else if relation.OnDelete != "" || relation.OnUpdate != "" {
+				return fmt.Errorf("model %q relation %q sets referential actions without a foreign key", model.Name, relation.Name)
+			}
+			if relation.Through != "" {
+				join, ok := seenModels[relation.Through]
+				if !ok {
+					return fmt.Errorf("model %q relation %q joins through unknown model %q", model.Name, relation.Name, relation.Through)
+				}
+				if err := validateThrough(model, relation, target, join); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
 	return nil
 }
+
+// validateEnums checks the enums of the schema and returns them by name.
+func (s Schema) validateEnums() (map[string]Enum, error) {
+	enums := make(map[string]Enum, len(s.Enums))
+	for _, enum := range s.Enums {
+		if enum.Name == "" {
+			return nil, fmt.Errorf("enum name is required")
+		}
+		if _, ok := enums[enum.Name]; ok {
+			return nil, fmt.Errorf("enum %q is defined more than once", enum.Name)
+		}
+		if len(enum.Values) == 0 {
+			return nil, fmt.Errorf("enum %q must define at least one value", enum.Name)
+		}
+		for i, value := range enum.Values {
+			if value == "" {
+				return nil, fmt.Errorf("enum %q has an empty value", enum.Name)
+			}
+			if slices.Contains(enum.Values[:i], value) {
+				return nil, fmt.Errorf("enum %q value %q is defined more than once", enum.Name, value)
+			}
+		}
+		enums[enum.Name] = enum
+	}
+	return enums, nil
+}
+
+// validateEnumField checks that a FieldEnum field names an enum of the schema
+// and carries its values, and that no other field names one.
+func validateEnumField(model Model, field Field, enums map[string]Enum) error {
+	if field.Kind != FieldEnum {
+		if field.Enum != "" || len(field.Values) > 0 {
+			return fmt.Errorf("model %q field %q of kind %s cannot name an enum", model.Name, field.Name, field.Kind)
+		}
+		return nil
+	}
+	enum, ok := enums[field.Enum]
+	if !ok {
+		return fmt.Errorf("model %q field %q references unknown enum %q", model.Name, field.Name, field.Enum)
+	}
+	if !slices.Equal(field.Values, enum.Values) {
+		return fmt.Errorf("model %q field %q must carry the values of enum %q", model.Name, field.Name, field.Enum)
+	}
+	return nil
+}
+
+// validateDefault checks that the default of field, if any, generates or
+// holds a value of its kind.
+func validateDefault(model Model, field Field) error {
+	if field.Default == nil {
+		return nil
+	}
+	kinds := map[DefaultFunc]FieldKind{
+		DefaultNow:           FieldTime,
+		DefaultUUID:          FieldString,
+		DefaultCUID:          FieldString,
+		DefaultAutoincrement: FieldInt64,
+	}
+	switch function := field.Default.Func; {
+	case field.List:
+		return fmt.Errorf("model %q list field %q cannot have a default", model.Name, field.Name)
+	case function == "":
+		if _, err := literalValue(field, field.Default.Value); err != nil {
+			return fmt.Errorf("model %q field %q default: %w", model.Name, field.Name, err)
+		}
+	case field.Default.Value != "":
+		return fmt.Errorf("model %q field %q default cannot have both a function and a value", model.Name, field.Name)
+	case kinds[function] == "":
+		return fmt.Errorf("model %q field %q has unsupported default %q", model.Name, field.Name, function)
+	case kinds[function] != field.Kind:
+		return fmt.Errorf("model %q field %q of kind %s cannot default to %s()", model.Name, field.Name, field.Kind, function)
+	}
+	return nil
+}
+
+// validateForeignKey checks that the fields of a foreign key relation exist
+// and that its references identify at most one record of target.
+func validateForeignKey(model Model, relation Relation, target Model) error {
+	if relation.Many {
+		return fmt.Errorf("model %q relation %q cannot hold a foreign key to many records", model.Name, relation.Name)
+	}
+	if len(relation.Fields) == 0 {
+		return fmt.Errorf("model %q relation %q must name its foreign key fields", model.Name, relation.Name)
+	}
+	for _, action := range []ReferentialAction{relation.OnDelete, relation.OnUpdate} {
+		switch action {
+		case "", ActionRestrict, ActionNoAction, ActionCascade, ActionSetNull:
+		default:
+			return fmt.Errorf("model %q relation %q has unsupported referential action %q", model.Name, relation.Name, action)
+		}
+	}
+	for _, name := range relation.Fields {
+		field, ok := findField(model, name)
+		if !ok {
+			return fmt.Errorf("model %q relation %q references unknown field %q", model.Name, relation.Name, name)
+		}
+		if field.List {
+			return fmt.Errorf("model %q relation %q cannot hold its foreign key in list field %q", model.Name, relation.Name, name)
+		}
+		if field.Required && (relation.OnDelete == ActionSetNull || relation.OnUpdate == ActionSetNull) {
+			return fmt.Errorf("model %q relation %q cannot set required field %q to null", model.Name, relation.Name, name)
+		}
+	}
+	if sameFields(relation.References, target.PrimaryKey) {
+		return nil
+	}
+	for _, index := range target.Indexes {
+		if index.Unique && sameFields(relation.References, index.Fields) {
+			return nil
+		}
+	}
+	return fmt.Errorf("model %q relation %q must reference the primary key or a unique index of model %q", model.Name, relation.Name, target.Name)
+}
+
+// validateThrough checks that a many-to-many relation maps its fields and
+// references onto fields of its join model.
+func validateThrough(model Model, relation Relation, target Model, join Model) error {
+	if !relation.Many || relation.ForeignKey {
+		return fmt.Errorf("model %q relation %q must be a list without a foreign key to join through model %q", model.Name, relation.Name, join.Name)
+	}
+	if len(relation.Fields) == 0 || len(relation.ThroughFields) != len(relation.Fields) || len(relation.ThroughReferences) != len(relation.References) {
+		return fmt.Errorf("model %q relation %q must map its fields and references onto fields of model %q", model.Name, relation.Name, join.Name)
+	}
+	for _, side := range []struct {
+		model  Model
+		fields []string
+	}{
+		{model: model, fields: relation.Fields},
+		{model: target, fields: relation.References},
+		{model: join, fields: relation.ThroughFields},
+		{model: join, fields: relation.ThroughReferences},
+	} {
+		for _, name := range side.fields {
+			if _, ok := findField(side.model, name); !ok {
+				return fmt.Errorf("model %q relation %q references unknown field %q of model %q", model.Name, relation.Name, name, side.model.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func sameFields(left []string, right []string) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for _, field := range left {
+		if !slices.Contains(right, field) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package zenithdb
+
+import (
+	"fmt"
+	"slices"
+)
+
+// projection returns the fields a read copies out of each record, or nil for
+// every field. Besides the selected fields it copies the local fields of the
+// relations the read expands or counts and the OrderBy and Cursor fields the
+// read compares; trimRecord drops them once the read is done.
+func projection(model Model, query Query) ([]string, error) {
+	if len(query.Select) == 0 {
+		return nil, nil
+	}
+	fields := make([]string, 0, len(query.Select))
+	add := func(field string) {
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	for _, name := range query.Select {
+		if _, ok := findField(model, name); ok {
+			add(name)
+			continue
+		}
+		if _, ok := findRelation(model, name); !ok && name != CountField {
+			return nil, fmt.Errorf("model %q does not define field or relation %q", model.Name, name)
+		}
+	}
+	_, counted := query.Include[CountField]
+	counted = counted || slices.Contains(query.Select, CountField)
+	for _, relation := range model.Relations {
+		if _, ok := query.Include[relation.Name]; ok || slices.Contains(query.Select, relation.Name) || counted && relation.Many {
+			for _, field := range relation.Fields {
+				add(field)
+			}
+		}
+	}
+	for _, order := range query.OrderBy {
+		if order.Field != "" {
+			add(order.Field)
+		}
+	}
+	for field := range query.Cursor {
+		add(field)
+	}
+	return fields, nil
+}
+
+func projectRecord(record Record, fields []string) Record {
+	if fields == nil {
+		return cloneRecord(record)
+	}
+	projected := make(Record, len(fields))
+	for _, field := range fields {
+		if value, ok := record[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected
+}
+
+// selectIncludes returns the relations a read expands: those include names
+// and those selected names. A selected CountField counts every Many relation.
+func selectIncludes(model Model, selected []string, include map[string]Include) map[string]Include {
+	var includes map[string]Include
+	names := make([]string, 0, len(model.Relations)+1)
+	for _, relation := range model.Relations {
+		names = append(names, relation.Name)
+	}
+	for _, name := range append(names, CountField) {
+		if _, ok := include[name]; ok || !slices.Contains(selected, name) {
+			continue
+		}
+		if includes == nil {
+			includes = make(map[string]Include, len(include)+1)
+			for name, value := range include {
+				includes[name] = value
+			}
+		}
+		includes[name] = Include{}
+	}
+	if includes == nil {
+		return include
+	}
+	return includes
+}
+
+// trimRecord drops the fields a projection only copied for the read itself,
+// keeping the selected names and the included relations.
+func trimRecord(record Record, selected []string, include map[string]Include) {
+	if len(selected) == 0 {
+		return
+	}
+	for name := range record {
+		if _, ok := include[name]; !ok && !slices.Contains(selected, name) {
+			delete(record, name)
+		}
+	}
+}
+
+// covers reports whether a read of fields can be answered from the entries
+// of a hash index over indexFields: every field is an index field, whose
+// value the lookup pins, or a primary key field, which decodes from the
+// primary key the entry holds.
+func (t *table) covers(fields []string, indexFields []string) bool {
+	if fields == nil {
+		return false
+	}
+	for _, field := range fields {
+		if !slices.Contains(indexFields, field) && !slices.Contains(t.model.PrimaryKey, field) {
+			return false
+		}
+	}
+	return true
+}
+
+// coveredRecord builds the fields of the record stored under primaryKey from
+// the values an index lookup pinned and the primary key itself.
+func (t *table) coveredRecord(primaryKey string, values map[string]any, fields []string) (Record, error) {
+	keyValues, err := decodeKey(primaryKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyValues) != len(t.model.PrimaryKey) {
+		return nil, fmt.Errorf("model %q primary key %q does not match fields %v", t.model.Name, primaryKey, t.model.PrimaryKey)
+	}
+	record := make(Record, len(fields))
+	for _, field := range fields {
+		if i := slices.Index(t.model.PrimaryKey, field); i >= 0 {
+			record[field] = keyValues[i]
+		} else {
+			record[field] = values[field]
+		}
+	}
+	return record, nil
+}
+
+// coveringRead answers a query whose plan reads one hash index straight from
+// the index entries, without reading the records. It applies when Where pins
+// nothing but the index fields, nothing else filters, and the index covers
+// every field the read copies.
+func (t *table) coveringRead(plan queryPlan, query Query, fields []string) ([]Record, bool, error) {
+	if len(plan.paths) != 1 || len(query.Filters) > 0 || query.FilterExpr != nil {
+		return nil, false, nil
+	}
+	path := plan.paths[0]
+	if path.index == nil || path.values == nil || path.access == PlanOrderedIndex {
+		return nil, false, nil
+	}
+	definition := path.index.definition
+	for field := range query.Where {
+		if !slices.Contains(definition.Fields, field) {
+			return nil, false, nil
+		}
+	}
+	if !t.covers(fields, definition.Fields) {
+		return nil, false, nil
+	}
+
+	limit := 0
+	if canLimitDuringIDLookup(query) {
+		limit = lookupLimit(query, definition)
+	}
+	var records []Record
+	var decodeErr error
+	err := path.each(limit, func(primaryKey string) bool {
+		record, err := t.coveredRecord(primaryKey, path.values, fields)
+		if err != nil {
+			decodeErr = err
+			return false
+		}
+		records = append(records, record)
+		return true
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	return records, true, err
+}
@@ -8,32 +8,45 @@ import (
 	"path/filepath"
 )
 
+// snapshotFile is the image a snapshot writes. Autoincrement holds the last
+// value of the sequence of each model that has one, which records deleted
+// before the snapshot may have used beyond the values its records hold.
 type snapshotFile struct {
-	Version  int                 `json:"version"`
-	Sequence uint64              `json:"sequence"`
-	Models   map[string][]Record `json:"models"`
+	Version       int                 `json:"version"`
+	Sequence      uint64              `json:"sequence"`
+	Models        map[string][]Record `json:"models"`
+	Autoincrement map[string]int64    `json:"autoincrement,omitempty"`
 }
 
-// Snapshot writes a compact point-in-time image of the in-memory state.
+// Snapshot writes a compact point-in-time image of the in-memory state. It
+// reads the current published snapshot, so writers are never blocked.
 func (db *DB) Snapshot(ctx context.Context, path string) error {
 	if err := ctx.Err(); err != nil {
 		return err
 	}
+	return writeSnapshot(db.current.Load(), path)
+}
 
-	db.mu.RLock()
-	snapshot := snapshotFile{
+func writeSnapshot(current *snapshot, path string) error {
+	image := snapshotFile{
 		Version:  1,
-		Sequence: db.sequence,
-		Models:   make(map[string][]Record, len(db.tables)),
+		Sequence: current.sequence,
+		Models:   make(map[string][]Record, len(current.tables)),
 	}
-	for name, table := range db.tables {
-		records := make([]Record, 0, len(table.rows))
-		for _, record := range table.rows {
-			records = append(records, cloneRecord(record))
+	for name, table := range current.tables {
+		records := make([]Record, 0, table.rows.len())
+		table.rows.each(func(_ string, version recordVersion) bool {
+			records = append(records, version.record)
+			return true
+		})
+		image.Models[name] = records
+		if table.autoincrement > 0 {
+			if image.Autoincrement == nil {
+				image.Autoincrement = make(map[string]int64)
+			}
+			image.Autoincrement[name] = table.autoincrement
 		}
-		snapshot.Models[name] = records
 	}
-	db.mu.RUnlock()
 
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
@@ -47,7 +60,7 @@ func (db *DB) Snapshot(ctx context.Context, path string) error {
 
 	encoder := json.NewEncoder(temp)
 	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(snapshot); err != nil {
+	if err := encoder.Encode(image); err != nil {
 		_ = temp.Close()
 		_ = os.Remove(tempName)
 		return err
@@ -82,36 +95,52 @@ func (db *DB) loadSnapshot(ctx context.Context, path string) (uint64, error) {
 	}
 	defer file.Close()
 
-	var snapshot snapshotFile
+	var image snapshotFile
 	decoder := json.NewDecoder(file)
 	decoder.UseNumber()
-	if err := decoder.Decode(&snapshot); err != nil {
+	if err := decoder.Decode(&image); err != nil {
 		return 0, err
 	}
 
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	next := make(map[string]*table, len(db.schema.Models))
-	for _, model := range db.schema.Models {
-		next[model.Name] = newTable(model)
-	}
+	sequence := max(db.sequence, image.Sequence)
+	next := newTables(db.schema, db.clock)
 
-	for model, records := range snapshot.Models {
+	for model, records := range image.Models {
 		table, ok := next[model]
 		if !ok {
 			return 0, fmt.Errorf("snapshot contains unknown model %q", model)
 		}
 		for _, record := range records {
-			if _, err := table.insert(record); err != nil {
+			if err := decodeBytes(table.model, record); err != nil {
+				return 0, err
+			}
+			// The record was stored as it stands: defaults and the checks of
+			// a create already ran when it was written.
+			normalized, err := normalizeRecord(table.model, record)
+			if err != nil {
+				return 0, err
+			}
+			primaryKey, err := keyFromRecord(normalized, table.model.PrimaryKey)
+			if err != nil {
 				return 0, err
 			}
+			table.insertPrepared(normalized, primaryKey, sequence)
 		}
 	}
-
-	db.tables = next
-	if snapshot.Sequence > db.sequence {
-		db.sequence = snapshot.Sequence
+	if err := checkStoredReferences(next); err != nil {
+		return 0, err
 	}
-	return snapshot.Sequence, nil
+	for model, value := range image.Autoincrement {
+		table, ok := next[model]
+		if !ok {
+			return 0, fmt.Errorf("snapshot contains unknown model %q", model)
+		}
+		table.autoincrement = max(table.autoincrement, value)
+	}
+
+	db.publishLocked(sequence, next)
+	return image.Sequence, nil
 }
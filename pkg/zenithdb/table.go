@@ -1,53 +1,107 @@
 package zenithdb
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 	"time"
 )
 
 type table struct {
-	model   Model
-	rows    map[string]Record
-	indexes map[string]*secondaryIndex
+	model        Model
+	rows         hamt[recordVersion]
+	indexes      map[string]*secondaryIndex
+	referencedBy []reference
+	sequence     uint64
+	clock        func() time.Time
+	// autoincrement is the largest value the autoincrement field of the
+	// model has held, the last value of its sequence.
+	autoincrement int64
+	// written holds the primary keys written through a fork, which the
+	// write reports as its changes when it is published.
+	written map[string]struct{}
+}
+
+// recordVersion is one committed version of a record, tagged with the WAL
+// sequence that wrote it. Stored records are never modified in place: a write
+// replaces the version, so readers of older table versions keep theirs.
+type recordVersion struct {
+	sequence uint64
+	record   Record
+}
+
+// newTables returns an empty table for every model of schema, each knowing
+// the foreign keys other models hold into it and stamping times from clock.
+func newTables(schema Schema, clock func() time.Time) tableSet {
+	tables := make(tableSet, len(schema.Models))
+	for _, model := range schema.Models {
+		tables[model.Name] = newTable(model, clock)
+	}
+	for _, model := range schema.Models {
+		for _, relation := range model.Relations {
+			if relation.ForeignKey {
+				target := tables[relation.Model]
+				target.referencedBy = append(target.referencedBy, reference{model: model.Name, relation: relation})
+			}
+		}
+	}
+	return tables
 }
 
-func newTable(model Model) *table {
+func newTable(model Model, clock func() time.Time) *table {
 	indexes := make(map[string]*secondaryIndex, len(model.Indexes))
 	for _, index := range model.Indexes {
-		indexes[index.Name] = newSecondaryIndex(index)
+		field, _ := findField(model, index.Fields[0])
+		indexes[index.Name] = newSecondaryIndex(index, field.List)
 	}
 	return &table{
 		model:   model,
-		rows:    make(map[string]Record),
 		indexes: indexes,
+		clock:   clock,
 	}
 }
 
-func (t *table) clone() *table {
-	cloned := newTable(t.model)
-	for key, record := range t.rows {
-		next := cloneRecord(record)
-		cloned.rows[key] = next
-		for _, index := range cloned.indexes {
-			_ = index.add(next, key)
-		}
+// fork returns a table that can be written without affecting t. Rows and
+// indexes are persistent, so forking only copies the index headers; writes
+// through the fork copy the paths they change, at most once per edit token.
+func (t *table) fork(edit *editToken) *table {
+	indexes := make(map[string]*secondaryIndex, len(t.indexes))
+	for name, index := range t.indexes {
+		indexes[name] = index.fork(edit)
+	}
+	rows := t.rows
+	rows.edit = edit
+	return &table{
+		model:         t.model,
+		rows:          rows,
+		indexes:       indexes,
+		referencedBy:  t.referencedBy,
+		sequence:      t.sequence,
+		clock:         t.clock,
+		autoincrement: t.autoincrement,
+		written:       make(map[string]struct{}),
 	}
-	return cloned
 }
 
-func (t *table) insert(record Record) (string, error) {
-	normalized, primaryKey, err := t.prepareInsert(record)
-	if err != nil {
-		return "", err
+// version returns the sequence that wrote the current version of primaryKey,
+// or zero when the table does not contain it.
+func (t *table) version(primaryKey string) uint64 {
+	current, ok := t.rows.get(primaryKey)
+	if !ok {
+		return 0
 	}
-
-	t.insertPrepared(normalized, primaryKey)
-	return primaryKey, nil
+	return current.sequence
 }
 
+// prepareInsert fills the defaults of the fields record leaves out, then
+// validates it and returns the record to store with its primary key.
 func (t *table) prepareInsert(record Record) (Record, string, error) {
+	record, err := t.withDefaults(record)
+	if err != nil {
+		return nil, "", err
+	}
 	normalized, err := normalizeRecord(t.model, record)
 	if err != nil {
 		return nil, "", err
@@ -57,7 +111,7 @@ func (t *table) prepareInsert(record Record) (Record, string, error) {
 	if err != nil {
 		return nil, "", err
 	}
-	if _, ok := t.rows[primaryKey]; ok {
+	if _, ok := t.rows.get(primaryKey); ok {
 		return nil, "", fmt.Errorf("model %q already contains primary key %q", t.model.Name, primaryKey)
 	}
 
@@ -69,82 +123,100 @@ func (t *table) prepareInsert(record Record) (Record, string, error) {
 	return normalized, primaryKey, nil
 }
 
-func (t *table) insertPrepared(normalized Record, primaryKey string) {
+func (t *table) insertPrepared(normalized Record, primaryKey string, sequence uint64) {
 	for _, index := range t.indexes {
 		_ = index.add(normalized, primaryKey)
 	}
-	t.rows[primaryKey] = normalized
+	t.rows = t.rows.set(primaryKey, recordVersion{sequence: sequence, record: normalized})
+	t.sequence = sequence
+	t.wrote(primaryKey)
+	if name, ok := autoincrementField(t.model); ok {
+		if value, ok := normalized[name].(int64); ok {
+			t.autoincrement = max(t.autoincrement, value)
+		}
+	}
 }
 
-func (t *table) update(where map[string]any, patch Record) (string, Record, error) {
-	primaryKey, next, err := t.prepareUpdate(where, patch)
+func (t *table) update(where map[string]any, patch Record, sequence uint64) (string, Record, error) {
+	primaryKey, _, next, err := t.prepareUpdate(where, patch)
 	if err != nil {
 		return "", nil, err
 	}
 
-	t.updatePrepared(primaryKey, next)
+	t.updatePrepared(primaryKey, next, sequence)
 	return primaryKey, cloneRecord(next), nil
 }
 
-func (t *table) prepareUpdate(where map[string]any, patch Record) (string, Record, error) {
+// prepareUpdate stamps the @updatedAt fields patch leaves out with the time of
+// the write, resolves its list updates, and applies it to the record where
+// addresses. It returns the record's primary key, the resolved patch, which
+// the WAL records so that replay restores the same stamps and lists, and the
+// record to store.
+func (t *table) prepareUpdate(where map[string]any, patch Record) (string, Record, Record, error) {
 	primaryKey, err := t.primaryKeyFromWhere(where)
 	if err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
 
-	current, ok := t.rows[primaryKey]
+	current, ok := t.rows.get(primaryKey)
 	if !ok {
-		return "", nil, ErrNotFound
+		return "", nil, nil, ErrNotFound
 	}
 
-	next := cloneRecord(current)
+	patch, err = t.withListUpdates(current.record, t.withUpdatedAt(patch))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	next := cloneRecord(current.record)
 	normalizedPatch, err := normalizePartial(t.model, patch)
 	if err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
 	for key, value := range normalizedPatch {
 		next[key] = value
 	}
 	next, err = normalizeRecord(t.model, next)
 	if err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
 
 	nextPrimaryKey, err := keyFromRecord(next, t.model.PrimaryKey)
 	if err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
 	if nextPrimaryKey != primaryKey {
-		return "", nil, fmt.Errorf("primary key updates are not supported")
+		return "", nil, nil, fmt.Errorf("primary key updates are not supported")
 	}
 
 	for _, index := range t.indexes {
 		if err := index.canAdd(next, primaryKey); err != nil {
-			return "", nil, err
+			return "", nil, nil, err
 		}
 	}
 
-	return primaryKey, next, nil
+	return primaryKey, patch, next, nil
 }
 
-func (t *table) updatePrepared(primaryKey string, next Record) {
-	current := t.rows[primaryKey]
+func (t *table) updatePrepared(primaryKey string, next Record, sequence uint64) {
+	current, _ := t.rows.get(primaryKey)
 	for _, index := range t.indexes {
-		_ = index.remove(current, primaryKey)
+		_ = index.remove(current.record, primaryKey)
 	}
 	for _, index := range t.indexes {
 		_ = index.add(next, primaryKey)
 	}
-	t.rows[primaryKey] = next
+	t.rows = t.rows.set(primaryKey, recordVersion{sequence: sequence, record: next})
+	t.sequence = sequence
+	t.wrote(primaryKey)
 }
 
-func (t *table) delete(where map[string]any) (string, Record, error) {
+func (t *table) delete(where map[string]any, sequence uint64) (string, Record, error) {
 	primaryKey, current, err := t.prepareDelete(where)
 	if err != nil {
 		return "", nil, err
 	}
 
-	t.deletePrepared(primaryKey)
+	t.deletePrepared(primaryKey, sequence)
 	return primaryKey, cloneRecord(current), nil
 }
 
@@ -154,164 +226,247 @@ func (t *table) prepareDelete(where map[string]any) (string, Record, error) {
 		return "", nil, err
 	}
 
-	current, ok := t.rows[primaryKey]
+	current, ok := t.rows.get(primaryKey)
 	if !ok {
 		return "", nil, ErrNotFound
 	}
 
-	return primaryKey, current, nil
+	return primaryKey, current.record, nil
 }
 
-func (t *table) deletePrepared(primaryKey string) {
-	current := t.rows[primaryKey]
+func (t *table) deletePrepared(primaryKey string, sequence uint64) {
+	current, _ := t.rows.get(primaryKey)
 	for _, index := range t.indexes {
-		_ = index.remove(current, primaryKey)
+		_ = index.remove(current.record, primaryKey)
+	}
+	t.rows = t.rows.delete(primaryKey)
+	t.sequence = sequence
+	t.wrote(primaryKey)
+}
+
+// wrote notes that the write forking t changed primaryKey. Tables built
+// outside a write, as a snapshot load builds them, track nothing.
+func (t *table) wrote(primaryKey string) {
+	if t.written != nil {
+		t.written[primaryKey] = struct{}{}
 	}
-	delete(t.rows, primaryKey)
 }
 
-func (t *table) findByPrimaryKey(where map[string]any) (Record, bool, error) {
+func (t *table) findByPrimaryKey(where map[string]any, fields []string) (Record, bool, error) {
 	primaryKey, err := t.primaryKeyFromWhere(where)
 	if err != nil {
 		return nil, false, err
 	}
-	record, ok := t.rows[primaryKey]
+	current, ok := t.rows.get(primaryKey)
 	if !ok {
 		return nil, false, nil
 	}
-	return cloneRecord(record), true, nil
+	return projectRecord(current.record, fields), true, nil
 }
 
-func (t *table) findMany(query Query) ([]Record, error) {
-	normalizedWhere, err := normalizePartial(t.model, query.Where)
+// findUnique copies fields out of the record where selects, or every field
+// when fields is nil.
+func (t *table) findUnique(where map[string]any, fields []string) (Record, bool, error) {
+	normalizedWhere, err := normalizePartial(t.model, where)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	query.Where = normalizedWhere
-	normalizedFilters, err := normalizeFilters(t.model, query.Filters)
-	if err != nil {
-		return nil, err
+
+	if containsAll(normalizedWhere, t.model.PrimaryKey) {
+		return t.findByPrimaryKey(normalizedWhere, fields)
 	}
-	query.Filters = normalizedFilters
-	if err := validateOrderBy(t.model, query.OrderBy); err != nil {
-		return nil, err
+
+	for _, index := range t.indexes {
+		if !index.definition.Unique || !containsAll(normalizedWhere, index.definition.Fields) {
+			continue
+		}
+		ids, err := index.lookup(normalizedWhere, 1)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(ids) == 0 {
+			return nil, false, nil
+		}
+		if t.covers(fields, index.definition.Fields) {
+			record, err := t.coveredRecord(ids[0], normalizedWhere, fields)
+			return record, err == nil, err
+		}
+		current, ok := t.rows.get(ids[0])
+		if !ok {
+			return nil, false, nil
+		}
+		return projectRecord(current.record, fields), true, nil
 	}
-	normalizedCursor, err := normalizePartial(t.model, query.Cursor)
+
+	return nil, false, fmt.Errorf("model %q has no unique lookup for fields %v", t.model.Name, where)
+}
+
+func (t *table) findMany(query Query) ([]Record, error) {
+	var result []Record
+	err := t.iterate(query, func(record Record) bool {
+		result = append(result, record)
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
-	query.Cursor = normalizedCursor
+	return result, nil
+}
 
-	indexQuery := query
-	if !canLimitDuringIDLookup(query) {
-		indexQuery.Limit = 0
+// iterate calls fn with a copy of each record query selects, in query order,
+// until fn returns false. Records are read, matched, and copied one at a time
+// unless the query orders them in a way no ordered index yields: then the
+// matching records are sorted first, though each is still only copied when
+// fn receives it.
+func (t *table) iterate(query Query, fn func(Record) bool) error {
+	query, err := t.normalizeQuery(query)
+	if err != nil {
+		return err
 	}
-	ids, ok, err := t.idsFromIndex(indexQuery)
+	plan, err := t.plan(query)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	fields, err := projection(t.model, query)
+	if err != nil {
+		return err
 	}
 
-	if !ok {
-		ids = make([]string, 0, len(t.rows))
-		for id := range t.rows {
-			ids = append(ids, id)
-			if canLimitDuringIDLookup(query) && len(ids) >= query.Limit {
+	covered, isCovered, err := t.coveringRead(plan, query, fields)
+	if err != nil {
+		return err
+	}
+	if isCovered || !plan.ordered && len(query.OrderBy) > 0 {
+		records := covered
+		if !isCovered {
+			err := t.candidates(plan, query, func(record Record) bool {
+				if matchesQuery(record, query) {
+					records = append(records, record)
+				}
+				return true
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := sortRecords(records, query.OrderBy, query.counters); err != nil {
+			return err
+		}
+		records = applyCursor(records, query.Cursor)
+		for _, record := range paginateRecords(records, query.Skip, query.Limit) {
+			if !isCovered {
+				record = projectRecord(record, fields)
+			}
+			if !fn(record) {
 				break
 			}
 		}
+		return nil
 	}
 
-	result := make([]Record, 0, len(ids))
-	for _, id := range ids {
-		record, ok := t.rows[id]
-		if !ok {
-			continue
-		}
-		if !matchesWhere(record, query.Where) {
-			continue
+	// Candidates already arrive in OrderBy order, so cursor, skip, and limit
+	// apply while reading and the read stops as soon as the page is full.
+	afterCursor := len(query.Cursor) == 0
+	skipped := 0
+	returned := 0
+	return t.candidates(plan, query, func(record Record) bool {
+		if !matchesQuery(record, query) {
+			return true
 		}
-		if !matchesFilters(record, query.Filters) {
-			continue
+		if !afterCursor {
+			afterCursor = matchesWhere(record, query.Cursor)
+			return true
 		}
-		result = append(result, cloneRecord(record))
-		if canLimitDuringResultScan(query) && len(result) >= query.Limit {
-			break
+		if skipped < query.Skip {
+			skipped++
+			return true
 		}
-	}
-	sortRecords(result, query.OrderBy)
-	result = applyCursor(result, query.Cursor)
-	return paginateRecords(result, query.Skip, query.Limit), nil
+		returned++
+		return fn(projectRecord(record, fields)) && (query.Limit <= 0 || returned < query.Limit)
+	})
 }
 
 func (t *table) count(query Query) (int, error) {
-	normalizedWhere, err := normalizePartial(t.model, query.Where)
-	if err != nil {
-		return 0, err
+	query.Cursor = nil
+	query.Skip = 0
+	query.Limit = 0
+	count := 0
+	err := t.each(query, func(Record) {
+		count++
+	})
+	return count, err
+}
+
+// each calls fn with every record query selects. Records arrive in no
+// particular order unless the query pages them, and fn must not keep or
+// modify them.
+func (t *table) each(query Query, fn func(Record)) error {
+	if query.Limit > 0 || query.Skip > 0 || len(query.Cursor) > 0 {
+		return t.iterate(query, func(record Record) bool {
+			fn(record)
+			return true
+		})
 	}
-	query.Where = normalizedWhere
-	normalizedFilters, err := normalizeFilters(t.model, query.Filters)
+
+	query.OrderBy = nil
+	query, err := t.normalizeQuery(query)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	query.Filters = normalizedFilters
-
-	indexQuery := query
-	indexQuery.Limit = 0
-	ids, ok, err := t.idsFromIndex(indexQuery)
+	plan, err := t.plan(query)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	if !ok {
-		ids = make([]string, 0, len(t.rows))
-		for id := range t.rows {
-			ids = append(ids, id)
+	return t.candidates(plan, query, func(record Record) bool {
+		if matchesQuery(record, query) {
+			fn(record)
 		}
-	}
+		return true
+	})
+}
 
-	count := 0
-	for _, id := range ids {
-		record, ok := t.rows[id]
-		if !ok {
-			continue
-		}
-		if !matchesWhere(record, query.Where) || !matchesFilters(record, query.Filters) {
-			continue
-		}
-		count++
+func (t *table) explain(query Query) (Plan, error) {
+	query, err := t.normalizeQuery(query)
+	if err != nil {
+		return Plan{}, err
+	}
+	plan, err := t.plan(query)
+	if err != nil {
+		return Plan{}, err
 	}
-	return count, nil
+	return plan.describe(t.model.Name), nil
 }
 
-func (t *table) idsFromIndex(query Query) ([]string, bool, error) {
-	if len(query.Where) == 0 {
-		return nil, false, nil
+func (t *table) normalizeQuery(query Query) (Query, error) {
+	normalizedWhere, err := normalizePartial(t.model, query.Where)
+	if err != nil {
+		return Query{}, err
 	}
-
-	if query.Index != "" {
-		index, ok := t.indexes[query.Index]
-		if !ok {
-			return nil, false, fmt.Errorf("model %q does not define index %q", t.model.Name, query.Index)
-		}
-		ids, err := index.lookup(query.Where, query.Limit)
-		return ids, true, err
+	query.Where = normalizedWhere
+	normalizedFilters, err := normalizeFilters(t.model, query.Filters)
+	if err != nil {
+		return Query{}, err
 	}
-
-	if containsAll(query.Where, t.model.PrimaryKey) {
-		primaryKey, err := keyFromValues(query.Where, t.model.PrimaryKey)
-		if err != nil {
-			return nil, false, err
-		}
-		return []string{primaryKey}, true, nil
+	query.Filters = normalizedFilters
+	normalizedExpr, err := normalizeFilterExpr(t.model, query.FilterExpr)
+	if err != nil {
+		return Query{}, err
 	}
-
-	for _, index := range t.indexes {
-		if containsAll(query.Where, index.definition.Fields) {
-			ids, err := index.lookup(query.Where, query.Limit)
-			return ids, true, err
+	query.FilterExpr = normalizedExpr
+	if err := validateOrderBy(t.model, query.OrderBy); err != nil {
+		return Query{}, err
+	}
+	for _, order := range query.OrderBy {
+		if _, ok := query.counters[order.Count]; order.Count != "" && !ok {
+			return Query{}, fmt.Errorf("model %q cannot order by the count of relation %q here", t.model.Name, order.Count)
 		}
 	}
-
-	return nil, false, nil
+	normalizedCursor, err := normalizePartial(t.model, query.Cursor)
+	if err != nil {
+		return Query{}, err
+	}
+	query.Cursor = normalizedCursor
+	return query, nil
 }
 
 func (t *table) primaryKeyFromWhere(where map[string]any) (string, error) {
@@ -336,7 +491,7 @@ func containsAll(values map[string]any, fields []string) bool {
 
 func matchesWhere(record Record, where map[string]any) bool {
 	for key, expected := range where {
-		if record[key] != expected {
+		if !equalValues(record[key], expected) {
 			return false
 		}
 	}
@@ -344,11 +499,16 @@ func matchesWhere(record Record, where map[string]any) bool {
 }
 
 func canLimitDuringIDLookup(query Query) bool {
-	return query.Limit > 0 && query.Skip == 0 && len(query.Cursor) == 0 && len(query.OrderBy) == 0 && len(query.Filters) == 0
+	return query.Limit > 0 && query.Skip == 0 && len(query.Cursor) == 0 && len(query.OrderBy) == 0 && len(query.Filters) == 0 && query.FilterExpr == nil
 }
 
-func canLimitDuringResultScan(query Query) bool {
-	return query.Limit > 0 && query.Skip == 0 && len(query.Cursor) == 0 && len(query.OrderBy) == 0
+// lookupLimit only lets an index stop early when its fields cover the whole
+// Where clause; otherwise some of the returned ids may still be filtered out.
+func lookupLimit(query Query, index Index) int {
+	if len(index.Fields) != len(query.Where) {
+		return 0
+	}
+	return query.Limit
 }
 
 func normalizeFilters(model Model, filters map[string]Filter) (map[string]Filter, error) {
@@ -374,40 +534,118 @@ func normalizeFilters(model Model, filters map[string]Filter) (map[string]Filter
 	return normalized, nil
 }
 
+// normalizeFilterExpr returns a copy of expr with every leaf normalized like
+// Filters. Relation filters must already be resolved against their tables.
+func normalizeFilterExpr(model Model, expr *FilterExpr) (*FilterExpr, error) {
+	if expr == nil {
+		return nil, nil
+	}
+	if expr.Relation != "" {
+		return nil, fmt.Errorf("model %q relation filter %q was not resolved", model.Name, expr.Relation)
+	}
+	normalized := FilterExpr{Field: expr.Field, related: expr.related}
+	if expr.Field != "" {
+		filters, err := normalizeFilters(model, map[string]Filter{expr.Field: expr.Filter})
+		if err != nil {
+			return nil, err
+		}
+		normalized.Filter = filters[expr.Field]
+	}
+	var err error
+	if normalized.And, err = normalizeFilterExprs(model, expr.And); err != nil {
+		return nil, err
+	}
+	if normalized.Or, err = normalizeFilterExprs(model, expr.Or); err != nil {
+		return nil, err
+	}
+	if normalized.Not, err = normalizeFilterExpr(model, expr.Not); err != nil {
+		return nil, err
+	}
+	return &normalized, nil
+}
+
+func normalizeFilterExprs(model Model, exprs []FilterExpr) ([]FilterExpr, error) {
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+	normalized := make([]FilterExpr, 0, len(exprs))
+	for i := range exprs {
+		expr, err := normalizeFilterExpr(model, &exprs[i])
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, *expr)
+	}
+	return normalized, nil
+}
+
 func normalizeFilter(field Field, filter Filter) (Filter, error) {
 	var err error
+	if len(filter.Path) > 0 || filter.ArrayContains != nil {
+		if field.Kind != FieldJSON {
+			return Filter{}, fmt.Errorf("path and array contains filters need a json field, not %s", field.Kind)
+		}
+	}
+	if field.List {
+		if filter.Contains != "" || filter.GT != nil || filter.GTE != nil || filter.LT != nil || filter.LTE != nil {
+			return Filter{}, fmt.Errorf("contains and range filters need a field that is not a list")
+		}
+	} else if filter.Has != nil || len(filter.HasSome) > 0 || len(filter.HasEvery) > 0 || filter.IsEmpty != nil {
+		return Filter{}, fmt.Errorf("has and is empty filters need a list field")
+	}
+	element := elementField(field)
+	if filter.Has != nil {
+		filter.Has, err = normalizeValue(element, filter.Has)
+		if err != nil {
+			return Filter{}, err
+		}
+	}
+	for _, values := range [][]any{filter.HasSome, filter.HasEvery} {
+		for i, value := range values {
+			values[i], err = normalizeValue(element, value)
+			if err != nil {
+				return Filter{}, err
+			}
+		}
+	}
+	if filter.ArrayContains != nil {
+		filter.ArrayContains, err = normalizeJSON(filter.ArrayContains)
+		if err != nil {
+			return Filter{}, err
+		}
+	}
 	if filter.Equals != nil {
-		filter.Equals, err = normalizeValue(field.Kind, filter.Equals)
+		filter.Equals, err = normalizeValue(field, filter.Equals)
 		if err != nil {
 			return Filter{}, err
 		}
 	}
 	for i, value := range filter.In {
-		filter.In[i], err = normalizeValue(field.Kind, value)
+		filter.In[i], err = normalizeValue(field, value)
 		if err != nil {
 			return Filter{}, err
 		}
 	}
 	if filter.GT != nil {
-		filter.GT, err = normalizeValue(field.Kind, filter.GT)
+		filter.GT, err = normalizeValue(field, filter.GT)
 		if err != nil {
 			return Filter{}, err
 		}
 	}
 	if filter.GTE != nil {
-		filter.GTE, err = normalizeValue(field.Kind, filter.GTE)
+		filter.GTE, err = normalizeValue(field, filter.GTE)
 		if err != nil {
 			return Filter{}, err
 		}
 	}
 	if filter.LT != nil {
-		filter.LT, err = normalizeValue(field.Kind, filter.LT)
+		filter.LT, err = normalizeValue(field, filter.LT)
 		if err != nil {
 			return Filter{}, err
 		}
 	}
 	if filter.LTE != nil {
-		filter.LTE, err = normalizeValue(field.Kind, filter.LTE)
+		filter.LTE, err = normalizeValue(field, filter.LTE)
 		if err != nil {
 			return Filter{}, err
 		}
@@ -424,75 +662,229 @@ func validateOrderBy(model Model, orderBy []OrderBy) error {
 		fields[field.Name] = struct{}{}
 	}
 	for _, order := range orderBy {
-		if _, ok := fields[order.Field]; !ok {
+		if order.Count != "" {
+			if order.Field != "" {
+				return fmt.Errorf("model %q orders by both field %q and the count of relation %q", model.Name, order.Field, order.Count)
+			}
+		} else if _, ok := fields[order.Field]; !ok {
 			return fmt.Errorf("model %q does not define field %q", model.Name, order.Field)
 		}
-		if order.Direction != "" && order.Direction != SortAsc && order.Direction != SortDesc {
-			return fmt.Errorf("unsupported sort direction %q", order.Direction)
+		if err := validateSortOrder(order.Direction, order.Nulls); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+func validateSortOrder(direction SortDirection, nulls NullsOrder) error {
+	if direction != "" && direction != SortAsc && direction != SortDesc {
+		return fmt.Errorf("unsupported sort direction %q", direction)
+	}
+	if nulls != "" && nulls != NullsFirst && nulls != NullsLast {
+		return fmt.Errorf("unsupported nulls order %q", nulls)
+	}
+	return nil
+}
+
+func matchesQuery(record Record, query Query) bool {
+	return matchesWhere(record, query.Where) && matchesFilters(record, query.Filters) && matchesFilterExpr(record, query.FilterExpr)
+}
+
 func matchesFilters(record Record, filters map[string]Filter) bool {
 	for field, filter := range filters {
-		value := record[field]
-		if filter.Equals != nil && value != filter.Equals {
+		if !matchesFilter(record[field], filter) {
 			return false
 		}
-		if len(filter.In) > 0 && !containsFilterValue(filter.In, value) {
+	}
+	return true
+}
+
+func matchesFilterExpr(record Record, expr *FilterExpr) bool {
+	if expr == nil {
+		return true
+	}
+	if expr.Field != "" && !matchesFilter(record[expr.Field], expr.Filter) {
+		return false
+	}
+	for _, match := range expr.related {
+		if !match.matches(record) {
+			return false
+		}
+	}
+	for i := range expr.And {
+		if !matchesFilterExpr(record, &expr.And[i]) {
 			return false
 		}
-		if filter.Contains != "" {
-			typed, ok := value.(string)
-			if !ok || !strings.Contains(typed, filter.Contains) {
-				return false
+	}
+	if len(expr.Or) > 0 {
+		matched := false
+		for i := range expr.Or {
+			if matchesFilterExpr(record, &expr.Or[i]) {
+				matched = true
+				break
 			}
 		}
-		if filter.GT != nil && compareValues(value, filter.GT) <= 0 {
+		if !matched {
 			return false
 		}
-		if filter.GTE != nil && compareValues(value, filter.GTE) < 0 {
+	}
+	return expr.Not == nil || !matchesFilterExpr(record, expr.Not)
+}
+
+func matchesFilter(value any, filter Filter) bool {
+	if len(filter.Path) > 0 {
+		var ok bool
+		if value, ok = jsonAt(value, filter.Path); !ok {
 			return false
 		}
-		if filter.LT != nil && compareValues(value, filter.LT) >= 0 {
+	}
+	if filter.Equals != nil && !equalValues(value, filter.Equals) {
+		return false
+	}
+	if filter.IsNull && value != nil || filter.IsNotNull && value == nil {
+		return false
+	}
+	if filter.ArrayContains != nil && !jsonArrayContains(value, filter.ArrayContains) {
+		return false
+	}
+	if filter.Has != nil && !listHasEvery(value, []any{filter.Has}) {
+		return false
+	}
+	if len(filter.HasSome) > 0 && !listHasSome(value, filter.HasSome) {
+		return false
+	}
+	if len(filter.HasEvery) > 0 && !listHasEvery(value, filter.HasEvery) {
+		return false
+	}
+	if filter.IsEmpty != nil {
+		list, _ := value.([]any)
+		if (len(list) == 0) != *filter.IsEmpty {
 			return false
 		}
-		if filter.LTE != nil && compareValues(value, filter.LTE) > 0 {
+	}
+	if len(filter.In) > 0 && !containsFilterValue(filter.In, value) {
+		return false
+	}
+	if filter.Contains != "" {
+		typed, ok := value.(string)
+		if !ok || !strings.Contains(typed, filter.Contains) {
 			return false
 		}
 	}
+	if value == nil && (filter.GT != nil || filter.GTE != nil || filter.LT != nil || filter.LTE != nil) {
+		return false
+	}
+	if filter.GT != nil && !inRange(value, filter.GT, func(c int) bool { return c > 0 }) {
+		return false
+	}
+	if filter.GTE != nil && !inRange(value, filter.GTE, func(c int) bool { return c >= 0 }) {
+		return false
+	}
+	if filter.LT != nil && !inRange(value, filter.LT, func(c int) bool { return c < 0 }) {
+		return false
+	}
+	if filter.LTE != nil && !inRange(value, filter.LTE, func(c int) bool { return c <= 0 }) {
+		return false
+	}
 	return true
 }
 
+// inRange reports whether value compares to bound as accept wants. A value
+// that does not order against bound, as a JSON string does against a number,
+// is never in range.
+func inRange(value any, bound any, accept func(int) bool) bool {
+	comparison, ok := compareRange(value, bound)
+	return ok && accept(comparison)
+}
+
+// compareRange compares value with a range filter bound, and reports whether
+// the two order at all. A JSON number compares by value whether it is stored
+// as an int64 or a float64; any other pair must share an ordered type, so a
+// JSON object, array, or a string against a number never matches.
+func compareRange(value any, bound any) (int, bool) {
+	switch typedValue := value.(type) {
+	case int64:
+		switch typedBound := bound.(type) {
+		case int64:
+			return compareOrdered(typedValue, typedBound), true
+		case float64:
+			return compareOrdered(float64(typedValue), typedBound), true
+		}
+		return 0, false
+	case float64:
+		switch typedBound := bound.(type) {
+		case int64:
+			return compareOrdered(typedValue, float64(typedBound)), true
+		case float64:
+			return compareOrdered(typedValue, typedBound), true
+		}
+		return 0, false
+	case string, bool, time.Time, []byte:
+		if reflect.TypeOf(value) != reflect.TypeOf(bound) {
+			return 0, false
+		}
+		return compareValues(value, bound), true
+	default:
+		return 0, false
+	}
+}
+
 func containsFilterValue(values []any, target any) bool {
 	for _, value := range values {
-		if value == target {
+		if equalValues(value, target) {
 			return true
 		}
 	}
 	return false
 }
 
-func sortRecords(records []Record, orderBy []OrderBy) {
+// sortRecords orders records by orderBy, counting the relations a Count
+// order names with counters.
+func sortRecords(records []Record, orderBy []OrderBy, counters map[string]relationCounter) error {
 	if len(orderBy) == 0 || len(records) < 2 {
-		return
+		return nil
 	}
-	sort.SliceStable(records, func(i, j int) bool {
-		left := records[i]
-		right := records[j]
-		for _, order := range orderBy {
-			comparison := compareValues(left[order.Field], right[order.Field])
-			if comparison == 0 {
-				continue
+	// Each record is counted once rather than on every comparison.
+	counts := make([]map[string]any, len(records))
+	for _, order := range orderBy {
+		if order.Count == "" {
+			continue
+		}
+		for i, record := range records {
+			count, err := counters[order.Count].count(record)
+			if err != nil {
+				return err
+			}
+			if counts[i] == nil {
+				counts[i] = make(map[string]any)
 			}
-			if order.Direction == SortDesc {
-				return comparison > 0
+			counts[i][order.Count] = int64(count)
+		}
+	}
+	sorted := make([]int, len(records))
+	for i := range sorted {
+		sorted[i] = i
+	}
+	value := func(i int, order OrderBy) any {
+		if order.Count != "" {
+			return counts[i][order.Count]
+		}
+		return records[i][order.Field]
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		for _, order := range orderBy {
+			if comparison := compareOrder(value(sorted[i], order), value(sorted[j], order), order.Direction, order.Nulls); comparison != 0 {
+				return comparison < 0
 			}
-			return comparison < 0
 		}
 		return false
 	})
+	ordered := make([]Record, len(records))
+	for i, position := range sorted {
+		ordered[i] = records[position]
+	}
+	copy(records, ordered)
+	return nil
 }
 
 func paginateRecords(records []Record, skip int, limit int) []Record {
@@ -524,23 +916,68 @@ func applyCursor(records []Record, cursor map[string]any) []Record {
 	return nil
 }
 
+// compareOrder compares left and right as an ordering by direction does,
+// placing null as nulls says, and returns a negative number when left comes
+// first.
+func compareOrder(left any, right any, direction SortDirection, nulls NullsOrder) int {
+	if (left == nil) != (right == nil) {
+		if (left == nil) == nullsFirst(direction, nulls) {
+			return -1
+		}
+		return 1
+	}
+	comparison := compareValues(left, right)
+	if direction == SortDesc {
+		return -comparison
+	}
+	return comparison
+}
+
+// nullsFirst reports whether an ordering by direction places null values
+// first: as nulls says, or, when it is empty, as an ordered index does.
+func nullsFirst(direction SortDirection, nulls NullsOrder) bool {
+	if nulls == "" {
+		return direction != SortDesc
+	}
+	return nulls == NullsFirst
+}
+
+// compareValues orders two normalized values of one kind. Null, or a missing
+// value, orders before any other, as it does in an ordered index.
 func compareValues(left any, right any) int {
+	switch {
+	case left == nil && right == nil:
+		return 0
+	case left == nil:
+		return -1
+	case right == nil:
+		return 1
+	}
 	switch typedLeft := left.(type) {
 	case string:
 		typedRight, _ := right.(string)
 		return strings.Compare(typedLeft, typedRight)
 	case int64:
+		if typedRight, ok := right.(float64); ok {
+			return compareOrdered(float64(typedLeft), typedRight)
+		}
 		typedRight, _ := right.(int64)
 		return compareOrdered(typedLeft, typedRight)
 	case bool:
 		typedRight, _ := right.(bool)
 		return compareOrdered(boolRank(typedLeft), boolRank(typedRight))
 	case float64:
+		if typedRight, ok := right.(int64); ok {
+			return compareOrdered(typedLeft, float64(typedRight))
+		}
 		typedRight, _ := right.(float64)
 		return compareOrdered(typedLeft, typedRight)
 	case time.Time:
 		typedRight, _ := right.(time.Time)
 		return compareOrdered(typedLeft.UnixNano(), typedRight.UnixNano())
+	case []byte:
+		typedRight, _ := right.([]byte)
+		return bytes.Compare(typedLeft, typedRight)
 	default:
 		return strings.Compare(fmt.Sprint(left), fmt.Sprint(right))
 	}
@@ -0,0 +1,432 @@
+package zenithdb
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// ErrTxDone is returned when a transaction is used after Commit or Rollback.
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// ErrTxConflict is returned by Commit when another writer changed a record
+// the transaction read or wrote after the transaction began.
+var ErrTxConflict = errors.New("transaction conflicts with a concurrent write")
+
+// Tx is an interactive transaction. It reads from the snapshot published when
+// it began, writes are staged on private forks of the touched models so reads
+// inside the transaction observe them, and Commit publishes every staged write
+// as one atomic batch.
+type Tx struct {
+	mu         sync.Mutex
+	db         *DB
+	snapshot   *snapshot
+	forks      *tableForks
+	reads      map[string]map[string]uint64
+	scans      map[string]struct{}
+	operations []operation
+	done       bool
+}
+
+// Begin starts an interactive transaction. Transactions are optimistic: they
+// never block other writers and fail with ErrTxConflict on Commit instead.
+func (db *DB) Begin(ctx context.Context) (*Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	current := db.current.Load()
+	return &Tx{
+		db:       db,
+		snapshot: current,
+		forks:    newTableForks(current.tables),
+		reads:    make(map[string]map[string]uint64),
+		scans:    make(map[string]struct{}),
+	}, nil
+}
+
+// FindUnique returns one record by primary key or unique index, holding the
+// selected fields and relations when selected is not empty.
+func (tx *Tx) FindUnique(ctx context.Context, model string, where map[string]any, include map[string]Include, selected []string) (Record, bool, error) {
+	if err := tx.lock(ctx); err != nil {
+		return nil, false, err
+	}
+	defer tx.mu.Unlock()
+
+	tables := tx.viewLocked()
+	table, err := tables.table(model)
+	if err != nil {
+		return nil, false, err
+	}
+	fields, err := projection(table.model, Query{Include: include, Select: selected})
+	if err != nil {
+		return nil, false, err
+	}
+	// The primary key identifies the record the transaction read.
+	if fields != nil {
+		fields = append(fields, table.model.PrimaryKey...)
+	}
+
+	record, ok, err := table.findUnique(where, fields)
+	if err != nil {
+		return nil, false, err
+	}
+	tx.observeLocked(table, where, record, ok)
+	if !ok {
+		return nil, false, nil
+	}
+	include = selectIncludes(table.model, selected, include)
+	if len(include) > 0 {
+		tx.scanLocked(tables, table.model, include)
+		if err := tables.expandIncludes(model, record, include); err != nil {
+			return nil, false, err
+		}
+	}
+	trimRecord(record, selected, include)
+	return record, true, nil
+}
+
+// FindMany returns records matching query.
+func (tx *Tx) FindMany(ctx context.Context, model string, query Query) ([]Record, error) {
+	if err := tx.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer tx.mu.Unlock()
+
+	tables := tx.viewLocked()
+	table, resolved, err := tables.prepareQuery(model, query)
+	if err != nil {
+		return nil, err
+	}
+	include := selectIncludes(table.model, query.Select, query.Include)
+	tx.scans[table.model.Name] = struct{}{}
+	tx.scanLocked(tables, table.model, include)
+	tx.scanFiltersLocked(tables, table.model, query.FilterExpr)
+	for name := range resolved.counters {
+		tx.scanCountsLocked(table.model, []string{name})
+	}
+
+	records, err := table.findMany(resolved)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if len(include) > 0 {
+			if err := tables.expandIncludes(model, record, include); err != nil {
+				return nil, err
+			}
+		}
+		trimRecord(record, query.Select, include)
+	}
+	return records, nil
+}
+
+// Create stages the insertion of one record.
+func (tx *Tx) Create(ctx context.Context, model string, record Record) (MutationResult, error) {
+	if err := tx.lock(ctx); err != nil {
+		return MutationResult{}, err
+	}
+	defer tx.mu.Unlock()
+
+	result, err := tx.applyLocked(BatchOperation{Type: BatchCreate, Model: model, Record: record})
+	if err != nil {
+		return MutationResult{}, err
+	}
+	return MutationResult{Model: result.Model, Key: result.Key, Record: result.Record}, nil
+}
+
+// Update stages a patch of one record addressed by its primary key.
+func (tx *Tx) Update(ctx context.Context, model string, where map[string]any, patch Record) (Record, error) {
+	if err := tx.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer tx.mu.Unlock()
+
+	result, err := tx.applyLocked(BatchOperation{Type: BatchUpdate, Model: model, Where: where, Record: patch})
+	if err != nil {
+		return nil, err
+	}
+	return result.Record, nil
+}
+
+// Delete stages the removal of one record addressed by its primary key.
+func (tx *Tx) Delete(ctx context.Context, model string, where map[string]any) (Record, error) {
+	if err := tx.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer tx.mu.Unlock()
+
+	result, err := tx.applyLocked(BatchOperation{Type: BatchDelete, Model: model, Where: where})
+	if err != nil {
+		return nil, err
+	}
+	return result.Record, nil
+}
+
+// Upsert stages an update of the record selected by a unique lookup, or the
+// insertion of createRecord when no record matches.
+func (tx *Tx) Upsert(ctx context.Context, model string, where map[string]any, createRecord Record, updatePatch Record) (Record, bool, error) {
+	if err := tx.lock(ctx); err != nil {
+		return nil, false, err
+	}
+	defer tx.mu.Unlock()
+
+	table, err := tx.forks.table(model)
+	if err != nil {
+		return nil, false, err
+	}
+	found, ok, err := table.findUnique(where, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	tx.observeLocked(table, where, found, ok)
+	if !ok {
+		result, err := tx.applyLocked(BatchOperation{Type: BatchCreate, Model: model, Record: createRecord})
+		if err != nil {
+			return nil, false, err
+		}
+		return result.Record, true, nil
+	}
+
+	primaryWhere, err := primaryWhereFromRecord(table.model, found)
+	if err != nil {
+		return nil, false, err
+	}
+	result, err := tx.applyLocked(BatchOperation{Type: BatchUpdate, Model: model, Where: primaryWhere, Record: updatePatch})
+	if err != nil {
+		return nil, false, err
+	}
+	return result.Record, false, nil
+}
+
+// Commit validates that no concurrent write changed what the transaction
+// read or wrote and publishes the staged writes as one WAL batch. Read-only
+// transactions always commit: their snapshot was consistent.
+func (tx *Tx) Commit(ctx context.Context) error {
+	if err := tx.lock(ctx); err != nil {
+		return err
+	}
+	defer tx.mu.Unlock()
+	defer tx.release()
+
+	tx.done = true
+	if len(tx.operations) == 0 {
+		return nil
+	}
+
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+
+	if tx.conflictsLocked(tx.db.current.Load()) {
+		return ErrTxConflict
+	}
+	return tx.db.commitLocked(ctx, tx.operations)
+}
+
+// Rollback discards the staged writes.
+func (tx *Tx) Rollback(ctx context.Context) error {
+	if err := tx.lock(ctx); err != nil {
+		return err
+	}
+	defer tx.mu.Unlock()
+
+	tx.done = true
+	tx.release()
+	return nil
+}
+
+func (tx *Tx) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tx.mu.Lock()
+	if tx.done {
+		tx.mu.Unlock()
+		return ErrTxDone
+	}
+	return nil
+}
+
+func (tx *Tx) release() {
+	tx.snapshot = nil
+	tx.forks = nil
+	tx.reads = nil
+	tx.scans = nil
+	tx.operations = nil
+}
+
+// viewLocked returns the tables as seen by the transaction: its private fork
+// for every model it wrote to, and the pinned snapshot otherwise.
+func (tx *Tx) viewLocked() tableSet {
+	view := make(tableSet, len(tx.snapshot.tables))
+	for name, table := range tx.snapshot.tables {
+		view[name] = table
+	}
+	for name, table := range tx.forks.forked {
+		view[name] = table
+	}
+	return view
+}
+
+// observeLocked records which record a unique lookup resolved to. A miss
+// through a secondary index could be turned into a hit by any insert, so it
+// is recorded as a scan of the whole model instead.
+func (tx *Tx) observeLocked(table *table, where map[string]any, record Record, found bool) {
+	values := where
+	if found {
+		values = record
+	}
+	if !containsAll(values, table.model.PrimaryKey) {
+		tx.scans[table.model.Name] = struct{}{}
+		return
+	}
+	primaryKey, err := table.primaryKeyFromWhere(values)
+	if err != nil {
+		tx.scans[table.model.Name] = struct{}{}
+		return
+	}
+	tx.readLocked(table.model.Name, primaryKey)
+}
+
+// readLocked remembers the version of primaryKey in the pinned snapshot, or
+// zero when it did not exist there.
+func (tx *Tx) readLocked(model string, primaryKey string) {
+	keys, ok := tx.reads[model]
+	if !ok {
+		keys = make(map[string]uint64)
+		tx.reads[model] = keys
+	}
+	if _, ok := keys[primaryKey]; ok {
+		return
+	}
+	keys[primaryKey] = tx.snapshot.tables[model].version(primaryKey)
+}
+
+// scanLocked records the models the includes of a read of model expand as
+// scanned, following the includes and relation filters of their queries.
+func (tx *Tx) scanLocked(tables tableSet, model Model, include map[string]Include) {
+	if counted, ok := include[CountField]; ok {
+		tx.scanCountsLocked(model, counted.Query.Select)
+	}
+	for _, relation := range model.Relations {
+		nested, ok := include[relation.Name]
+		if !ok {
+			continue
+		}
+		tx.scans[relation.Model] = struct{}{}
+		if relation.Through != "" {
+			tx.scans[relation.Through] = struct{}{}
+		}
+		related, ok := tables[relation.Model]
+		if !ok {
+			continue
+		}
+		tx.scanFiltersLocked(tables, related.model, nested.Query.FilterExpr)
+		tx.scanLocked(tables, related.model, selectIncludes(related.model, nested.Query.Select, nested.Query.Include))
+	}
+}
+
+// scanCountsLocked records the models counting the named Many relations of
+// model reads as scanned, every Many relation when names is empty.
+func (tx *Tx) scanCountsLocked(model Model, names []string) {
+	for _, relation := range model.Relations {
+		if !relation.Many || len(names) > 0 && !slices.Contains(names, relation.Name) {
+			continue
+		}
+		tx.scans[relation.Model] = struct{}{}
+		if relation.Through != "" {
+			tx.scans[relation.Through] = struct{}{}
+		}
+	}
+}
+
+// scanFiltersLocked records the models the relation filters of expr read as
+// scanned: a write to any of them can change which records match.
+func (tx *Tx) scanFiltersLocked(tables tableSet, model Model, expr *FilterExpr) {
+	if expr == nil {
+		return
+	}
+	for i := range expr.And {
+		tx.scanFiltersLocked(tables, model, &expr.And[i])
+	}
+	for i := range expr.Or {
+		tx.scanFiltersLocked(tables, model, &expr.Or[i])
+	}
+	tx.scanFiltersLocked(tables, model, expr.Not)
+	relation, ok := findRelation(model, expr.Relation)
+	if !ok {
+		return
+	}
+	tx.scans[relation.Model] = struct{}{}
+	if relation.Through != "" {
+		tx.scans[relation.Through] = struct{}{}
+	}
+	related, ok := tables[relation.Model]
+	if !ok {
+		return
+	}
+	filter := expr.RelationFilter
+	for _, inner := range []*FilterExpr{filter.Some, filter.Every, filter.None, filter.Is, filter.IsNot} {
+		tx.scanFiltersLocked(tables, related.model, inner)
+	}
+}
+
+// conflictsLocked reports whether current, the latest published snapshot,
+// changed a record the transaction depends on since its own snapshot.
+func (tx *Tx) conflictsLocked(current *snapshot) bool {
+	for model := range tx.scans {
+		if current.tables[model].sequence > tx.snapshot.sequence {
+			return true
+		}
+	}
+	for model, keys := range tx.reads {
+		table := current.tables[model]
+		if table.sequence <= tx.snapshot.sequence {
+			continue
+		}
+		for primaryKey, sequence := range keys {
+			if table.version(primaryKey) != sequence {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyLocked stages batchOperation on the forks of the transaction. The WAL
+// operations it resolves to are what Commit applies again: they hold the
+// defaults and @updatedAt stamps the transaction has already observed, for
+// the records its nested writes and referential actions wrote as well.
+func (tx *Tx) applyLocked(batchOperation BatchOperation) (BatchResult, error) {
+	// Each operation writes to forks of its own, so one that fails part way,
+	// such as a cascade reaching a restricted relation, stages nothing.
+	forks := newTableForks(tx.viewLocked())
+	applied, result, err := applyBatchOperation(forks, batchOperation, tx.snapshot.sequence)
+	if err != nil {
+		return BatchResult{}, err
+	}
+	for name, table := range forks.forked {
+		tx.forks.forked[name] = table
+	}
+	for _, staged := range applied {
+		tx.writeLocked(forks.forked[staged.Model], staged)
+	}
+	tx.operations = append(tx.operations, applied...)
+	return result, nil
+}
+
+// writeLocked records the record a staged operation writes as read, so a
+// concurrent write to it fails Commit with ErrTxConflict.
+func (tx *Tx) writeLocked(table *table, staged operation) {
+	values := staged.Where
+	if staged.Type == opCreate {
+		values = staged.Record
+	}
+	primaryKey, err := table.primaryKeyFromWhere(values)
+	if err != nil {
+		tx.scans[table.model.Name] = struct{}{}
+		return
+	}
+	tx.readLocked(table.model.Name, primaryKey)
+}
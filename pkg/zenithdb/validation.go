@@ -0,0 +1,179 @@
+package zenithdb
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"slices"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidationRule names a check a Validation makes.
+type ValidationRule string
+
+const (
+	// RuleMinLength and RuleMaxLength bound the number of characters of a
+	// FieldString value by Limit.
+	RuleMinLength ValidationRule = "minLength"
+	RuleMaxLength ValidationRule = "maxLength"
+	// RuleMin and RuleMax bound a FieldInt64 or FieldFloat value by Limit.
+	RuleMin ValidationRule = "min"
+	RuleMax ValidationRule = "max"
+	// RulePattern requires a FieldString value to match the regular
+	// expression Pattern.
+	RulePattern ValidationRule = "pattern"
+	// RuleEmail requires a FieldString value to be a bare email address, as
+	// in ada@example.com.
+	RuleEmail ValidationRule = "email"
+)
+
+// Validation is a rule the values of a field must satisfy beyond its kind.
+// Null satisfies every rule.
+type Validation struct {
+	Rule    ValidationRule
+	Limit   float64 `json:",omitempty"`
+	Pattern string  `json:",omitempty"`
+}
+
+// ValidationError reports a value that breaks a validation rule of its field.
+type ValidationError struct {
+	Model  string
+	Field  string
+	Rule   ValidationRule
+	Reason string
+}
+
+func (err *ValidationError) Error() string {
+	return fmt.Sprintf("model %q field %q fails %s: %s", err.Model, err.Field, err.Rule, err.Reason)
+}
+
+// patterns caches the compiled expressions of RulePattern rules, which every
+// write checks.
+var patterns sync.Map
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if compiled, ok := patterns.Load(pattern); ok {
+		return compiled.(*regexp.Regexp), nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, compiled)
+	return compiled, nil
+}
+
+// ValidateValue checks value against the validation rules of field of model,
+// returning a *ValidationError for the first rule it breaks. value is
+// normalized first, so it may be any Go value a write accepts for the field.
+func (s Schema) ValidateValue(model string, field string, value any) error {
+	for _, candidate := range s.Models {
+		if candidate.Name != model {
+			continue
+		}
+		definition, ok := findField(candidate, field)
+		if !ok {
+			return fmt.Errorf("model %q does not define field %q", model, field)
+		}
+		normalized, err := normalizeValue(definition, value)
+		if err != nil {
+			return fmt.Errorf("model %q field %q: %w", model, field, err)
+		}
+		return validateValue(candidate, definition, normalized)
+	}
+	return fmt.Errorf("unknown model %q", model)
+}
+
+// validateValue checks value, a normalized value of field, against the
+// validation rules of field.
+func validateValue(model Model, field Field, value any) error {
+	if value == nil {
+		return nil
+	}
+	for _, validation := range field.Validations {
+		reason, err := validation.check(value)
+		if err != nil {
+			return fmt.Errorf("model %q field %q: %w", model.Name, field.Name, err)
+		}
+		if reason != "" {
+			return &ValidationError{Model: model.Name, Field: field.Name, Rule: validation.Rule, Reason: reason}
+		}
+	}
+	return nil
+}
+
+// check returns why value breaks the rule, or "" when it satisfies it.
+func (validation Validation) check(value any) (string, error) {
+	var number float64
+	switch typed := value.(type) {
+	case int64:
+		number = float64(typed)
+	case float64:
+		number = typed
+	}
+	text, _ := value.(string)
+	switch validation.Rule {
+	case RuleMinLength:
+		if length := utf8.RuneCountInString(text); float64(length) < validation.Limit {
+			return fmt.Sprintf("must be at least %v characters, got %d", validation.Limit, length), nil
+		}
+	case RuleMaxLength:
+		if length := utf8.RuneCountInString(text); float64(length) > validation.Limit {
+			return fmt.Sprintf("must be at most %v characters, got %d", validation.Limit, length), nil
+		}
+	case RuleMin:
+		if number < validation.Limit {
+			return fmt.Sprintf("must be at least %v, got %v", validation.Limit, value), nil
+		}
+	case RuleMax:
+		if number > validation.Limit {
+			return fmt.Sprintf("must be at most %v, got %v", validation.Limit, value), nil
+		}
+	case RulePattern:
+		pattern, err := compilePattern(validation.Pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid pattern: %w", err)
+		}
+		if !pattern.MatchString(text) {
+			return fmt.Sprintf("must match %q", validation.Pattern), nil
+		}
+	case RuleEmail:
+		if address, err := mail.ParseAddress(text); err != nil || address.Address != text {
+			return "must be an email address", nil
+		}
+	}
+	return "", nil
+}
+
+// validateRules checks that the validation rules of field apply to its kind.
+func validateRules(model Model, field Field) error {
+	if field.List && len(field.Validations) > 0 {
+		return fmt.Errorf("model %q list field %q cannot have validation rules", model.Name, field.Name)
+	}
+	for _, validation := range field.Validations {
+		var kinds []FieldKind
+		switch validation.Rule {
+		case RuleMinLength, RuleMaxLength:
+			kinds = []FieldKind{FieldString}
+			if validation.Limit < 0 || validation.Limit != float64(int(validation.Limit)) {
+				return fmt.Errorf("model %q field %q %s must be a whole number of characters", model.Name, field.Name, validation.Rule)
+			}
+		case RuleMin, RuleMax:
+			kinds = []FieldKind{FieldInt64, FieldFloat}
+		case RulePattern:
+			kinds = []FieldKind{FieldString}
+			if _, err := compilePattern(validation.Pattern); err != nil {
+				return fmt.Errorf("model %q field %q has an invalid pattern: %w", model.Name, field.Name, err)
+			}
+		case RuleEmail:
+			kinds = []FieldKind{FieldString}
+		default:
+			return fmt.Errorf("model %q field %q has unsupported validation rule %q", model.Name, field.Name, validation.Rule)
+		}
+		if !slices.Contains(kinds, field.Kind) {
+			return fmt.Errorf("model %q field %q of kind %s cannot have the %s rule", model.Name, field.Name, field.Kind, validation.Rule)
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"iter"
 	"net"
 	"sync"
 	"time"
@@ -69,10 +70,14 @@ func (c *Client) Close() error {
 }
 
 func (c *Client) Create(ctx context.Context, model string, record zenithdb.Record) (zenithdb.MutationResult, error) {
+	return c.create(ctx, 0, model, record)
+}
+
+func (c *Client) create(ctx context.Context, txID uint32, model string, record zenithdb.Record) (zenithdb.MutationResult, error) {
 	var request bytes.Buffer
 	writeString(&request, model)
 	writeRecord(&request, record)
-	response, err := c.roundTrip(ctx, opCreate, request.Bytes())
+	response, err := c.call(ctx, txID, opCreate, request.Bytes())
 	if err != nil {
 		return zenithdb.MutationResult{}, err
 	}
@@ -85,7 +90,11 @@ func (c *Client) Create(ctx context.Context, model string, record zenithdb.Recor
 	if err != nil {
 		return zenithdb.MutationResult{}, err
 	}
-	return zenithdb.MutationResult{Model: resultModel, Key: key}, nil
+	created, err := readRecord(reader)
+	if err != nil {
+		return zenithdb.MutationResult{}, err
+	}
+	return zenithdb.MutationResult{Model: resultModel, Key: key, Record: created}, nil
 }
 
 func (c *Client) CreateMany(ctx context.Context, model string, records []zenithdb.Record) ([]zenithdb.MutationResult, error) {
@@ -100,11 +109,15 @@ func (c *Client) CreateMany(ctx context.Context, model string, records []zenithd
 }
 
 func (c *Client) Update(ctx context.Context, model string, where map[string]any, patch zenithdb.Record) (zenithdb.Record, error) {
+	return c.update(ctx, 0, model, where, patch)
+}
+
+func (c *Client) update(ctx context.Context, txID uint32, model string, where map[string]any, patch zenithdb.Record) (zenithdb.Record, error) {
 	var request bytes.Buffer
 	writeString(&request, model)
 	writeStringMap(&request, where)
 	writeRecord(&request, patch)
-	response, err := c.roundTrip(ctx, opUpdate, request.Bytes())
+	response, err := c.call(ctx, txID, opUpdate, request.Bytes())
 	if err != nil {
 		return nil, err
 	}
@@ -124,10 +137,14 @@ func (c *Client) UpdateMany(ctx context.Context, model string, query zenithdb.Qu
 }
 
 func (c *Client) Delete(ctx context.Context, model string, where map[string]any) (zenithdb.Record, error) {
+	return c.delete(ctx, 0, model, where)
+}
+
+func (c *Client) delete(ctx context.Context, txID uint32, model string, where map[string]any) (zenithdb.Record, error) {
 	var request bytes.Buffer
 	writeString(&request, model)
 	writeStringMap(&request, where)
-	response, err := c.roundTrip(ctx, opDelete, request.Bytes())
+	response, err := c.call(ctx, txID, opDelete, request.Bytes())
 	if err != nil {
 		return nil, err
 	}
@@ -146,12 +163,16 @@ func (c *Client) DeleteMany(ctx context.Context, model string, query zenithdb.Qu
 }
 
 func (c *Client) Upsert(ctx context.Context, model string, where map[string]any, createRecord zenithdb.Record, updatePatch zenithdb.Record) (zenithdb.Record, bool, error) {
+	return c.upsert(ctx, 0, model, where, createRecord, updatePatch)
+}
+
+func (c *Client) upsert(ctx context.Context, txID uint32, model string, where map[string]any, createRecord zenithdb.Record, updatePatch zenithdb.Record) (zenithdb.Record, bool, error) {
 	var request bytes.Buffer
 	writeString(&request, model)
 	writeStringMap(&request, where)
 	writeRecord(&request, createRecord)
 	writeRecord(&request, updatePatch)
-	response, err := c.roundTrip(ctx, opUpsert, request.Bytes())
+	response, err := c.call(ctx, txID, opUpsert, request.Bytes())
 	if err != nil {
 		return nil, false, err
 	}
@@ -174,12 +195,17 @@ func (c *Client) Batch(ctx context.Context, operations []zenithdb.BatchOperation
 	return readBatchResults(bytes.NewReader(response))
 }
 
-func (c *Client) FindUnique(ctx context.Context, model string, where map[string]any, include map[string]zenithdb.Include) (zenithdb.Record, bool, error) {
+func (c *Client) FindUnique(ctx context.Context, model string, where map[string]any, include map[string]zenithdb.Include, selected []string) (zenithdb.Record, bool, error) {
+	return c.findUnique(ctx, 0, model, where, include, selected)
+}
+
+func (c *Client) findUnique(ctx context.Context, txID uint32, model string, where map[string]any, include map[string]zenithdb.Include, selected []string) (zenithdb.Record, bool, error) {
 	var request bytes.Buffer
 	writeString(&request, model)
 	writeStringMap(&request, where)
 	writeIncludeMap(&request, include)
-	response, err := c.roundTrip(ctx, opFindUnique, request.Bytes())
+	writeStrings(&request, selected)
+	response, err := c.call(ctx, txID, opFindUnique, request.Bytes())
 	if err != nil {
 		return nil, false, err
 	}
@@ -193,10 +219,14 @@ func (c *Client) FindUnique(ctx context.Context, model string, where map[string]
 }
 
 func (c *Client) FindMany(ctx context.Context, model string, query zenithdb.Query) ([]zenithdb.Record, error) {
+	return c.findMany(ctx, 0, model, query)
+}
+
+func (c *Client) findMany(ctx context.Context, txID uint32, model string, query zenithdb.Query) ([]zenithdb.Record, error) {
 	var request bytes.Buffer
 	writeString(&request, model)
 	writeQuery(&request, query)
-	response, err := c.roundTrip(ctx, opFindMany, request.Bytes())
+	response, err := c.call(ctx, txID, opFindMany, request.Bytes())
 	if err != nil {
 		return nil, err
 	}
@@ -215,6 +245,90 @@ func (c *Client) Count(ctx context.Context, model string, query zenithdb.Query)
 	return int(count), err
 }
 
+func (c *Client) Explain(ctx context.Context, model string, query zenithdb.Query) (zenithdb.Plan, error) {
+	var request bytes.Buffer
+	writeString(&request, model)
+	writeQuery(&request, query)
+	response, err := c.roundTrip(ctx, opExplain, request.Bytes())
+	if err != nil {
+		return zenithdb.Plan{}, err
+	}
+	return readPlan(bytes.NewReader(response))
+}
+
+func (c *Client) Aggregate(ctx context.Context, model string, query zenithdb.AggregateQuery) (zenithdb.AggregateResult, error) {
+	var request bytes.Buffer
+	writeString(&request, model)
+	writeAggregateQuery(&request, query)
+	response, err := c.roundTrip(ctx, opAggregate, request.Bytes())
+	if err != nil {
+		return zenithdb.AggregateResult{}, err
+	}
+	return readAggregateResult(bytes.NewReader(response))
+}
+
+func (c *Client) GroupBy(ctx context.Context, model string, query zenithdb.GroupByQuery) ([]zenithdb.Group, error) {
+	var request bytes.Buffer
+	writeString(&request, model)
+	writeGroupByQuery(&request, query)
+	response, err := c.roundTrip(ctx, opGroupBy, request.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return readGroups(bytes.NewReader(response))
+}
+
+// Iterate streams the records query selects. The server reads one batch at a
+// time and only when the previous batch has been consumed, so neither side
+// holds more than one batch of the result. Stopping early closes the stream.
+func (c *Client) Iterate(ctx context.Context, model string, query zenithdb.Query) iter.Seq2[zenithdb.Record, error] {
+	return func(yield func(zenithdb.Record, error) bool) {
+		var request bytes.Buffer
+		writeString(&request, model)
+		writeQuery(&request, query)
+		writeUint32(&request, iterateBatchRecords)
+		response, err := c.roundTrip(ctx, opIterate, request.Bytes())
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		reader := bytes.NewReader(response)
+		id, err := readUint32(reader)
+		for err == nil {
+			var records []zenithdb.Record
+			var done bool
+			records, done, err = readIterateBatch(reader)
+			if err != nil {
+				break
+			}
+			for _, record := range records {
+				if !yield(record, nil) {
+					if !done {
+						c.closeIterate(ctx, id)
+					}
+					return
+				}
+			}
+			if done {
+				return
+			}
+			var next bytes.Buffer
+			writeUint32(&next, id)
+			response, err = c.roundTrip(ctx, opIterateNext, next.Bytes())
+			reader = bytes.NewReader(response)
+		}
+		yield(nil, err)
+	}
+}
+
+// closeIterate tells the server to drop a stream the caller stopped reading,
+// even when ctx has ended.
+func (c *Client) closeIterate(ctx context.Context, id uint32) {
+	var request bytes.Buffer
+	writeUint32(&request, id)
+	_, _ = c.roundTrip(context.WithoutCancel(ctx), opIterateClose, request.Bytes())
+}
+
 func (c *Client) Checkpoint(ctx context.Context) error {
 	_, err := c.roundTrip(ctx, opCheckpoint, nil)
 	return err
@@ -258,6 +372,19 @@ func (c *Client) handshake(token string, schemaHash string) error {
 	return err
 }
 
+// call sends op on its own, or wrapped in an opTx frame when txID names an
+// open transaction.
+func (c *Client) call(ctx context.Context, txID uint32, op byte, payload []byte) ([]byte, error) {
+	if txID == 0 {
+		return c.roundTrip(ctx, op, payload)
+	}
+	var request bytes.Buffer
+	writeUint32(&request, txID)
+	_ = request.WriteByte(op)
+	_, _ = request.Write(payload)
+	return c.roundTrip(ctx, opTx, request.Bytes())
+}
+
 func (c *Client) roundTrip(ctx context.Context, op byte, payload []byte) ([]byte, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -3,10 +3,12 @@ package wire
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"reflect"
 	"time"
 
 	"github.com/bypepe77/ZenithDB/pkg/zenithdb"
@@ -14,7 +16,11 @@ import (
 
 const (
 	protocolMagic = "ZDBW1"
-	protocolVersion uint16 = 1
+	// protocolVersion changes whenever the encoding of a frame does, so a
+	// client and server built apart fail the handshake instead of misreading
+	// frames. Version 2 adds the transaction frames and encodes filter trees,
+	// selections, count and null ordering, and the record in a create response.
+	protocolVersion uint16 = 2
 	maxFramePayloadBytes = 64 << 20
 
 	opCreate byte = iota + 1
@@ -31,6 +37,24 @@ const (
 	opCheckpoint
 	opPullSchema
 	opValidateSchema
+	opBegin
+	opCommit
+	opRollback
+	opTx
+	opExplain
+	opAggregate
+	opGroupBy
+	opIterate
+	opIterateNext
+	opIterateClose
+)
+
+// An Iterate stream sends records in batches of at most iterateBatchRecords
+// records, or about iterateBatchBytes of encoded records, whichever comes
+// first. The server only reads a batch once the client asks for it.
+const (
+	iterateBatchRecords = 256
+	iterateBatchBytes   = 1 << 20
 )
 
 const (
@@ -42,6 +66,12 @@ const (
 	valueTime
 	valueRecord
 	valueRecordSlice
+	valueNestedWrite
+	valueBytes
+	valueJSON
+	valueMap
+	valueList
+	valueListUpdate
 )
 
 func writeFrame(w io.Writer, op byte, payload []byte) error {
@@ -77,10 +107,20 @@ func writeResponse(w io.Writer, payload []byte) error {
 	return writeFrame(w, 0, payload)
 }
 
+// writeErrorResponse writes err as a failed response: its message and, with
+// status 2, the fields of the *zenithdb.ValidationError it wraps. A reader that
+// knows only status 1 still reads the message.
 func writeErrorResponse(w io.Writer, err error) error {
 	var payload bytes.Buffer
 	writeString(&payload, err.Error())
-	return writeFrame(w, 1, payload.Bytes())
+	var validation *zenithdb.ValidationError
+	if !errors.As(err, &validation) {
+		return writeFrame(w, 1, payload.Bytes())
+	}
+	for _, value := range []string{validation.Model, validation.Field, string(validation.Rule), validation.Reason} {
+		writeString(&payload, value)
+	}
+	return writeFrame(w, 2, payload.Bytes())
 }
 
 func readResponse(r io.Reader) ([]byte, error) {
@@ -96,7 +136,31 @@ func readResponse(r io.Reader) ([]byte, error) {
 	if decodeErr != nil {
 		return nil, decodeErr
 	}
-	return nil, errors.New(message)
+	if status != 2 {
+		return nil, errors.New(message)
+	}
+	values := make([]string, 4)
+	for i := range values {
+		if values[i], decodeErr = readString(reader); decodeErr != nil {
+			return nil, decodeErr
+		}
+	}
+	return nil, &responseError{message: message, err: &zenithdb.ValidationError{Model: values[0], Field: values[1], Rule: zenithdb.ValidationRule(values[2]), Reason: values[3]}}
+}
+
+// responseError is an error a server responded with, carrying the structured
+// error it wraps so that errors.As finds it on the client.
+type responseError struct {
+	message string
+	err     error
+}
+
+func (err *responseError) Error() string {
+	return err.message
+}
+
+func (err *responseError) Unwrap() error {
+	return err.err
 }
 
 func writeString(w io.Writer, value string) {
@@ -266,6 +330,7 @@ func writeIncludeMap(w io.Writer, includes map[string]zenithdb.Include) {
 	for key, include := range includes {
 		writeString(w, key)
 		writeInt64(w, int64(include.Limit))
+		writeQuery(w, include.Query)
 	}
 }
 
@@ -284,7 +349,11 @@ func readIncludeMap(r *bytes.Reader) (map[string]zenithdb.Include, error) {
 		if err != nil {
 			return nil, err
 		}
-		includes[key] = zenithdb.Include{Limit: int(limit)}
+		query, err := readQuery(r)
+		if err != nil {
+			return nil, err
+		}
+		includes[key] = zenithdb.Include{Limit: int(limit), Query: query}
 	}
 	return includes, nil
 }
@@ -292,12 +361,14 @@ func readIncludeMap(r *bytes.Reader) (map[string]zenithdb.Include, error) {
 func writeQuery(w io.Writer, query zenithdb.Query) {
 	writeStringMap(w, query.Where)
 	writeFilterMap(w, query.Filters)
+	writeFilterExpr(w, query.FilterExpr)
 	writeString(w, query.Index)
 	writeInt64(w, int64(query.Limit))
 	writeInt64(w, int64(query.Skip))
 	writeStringMap(w, query.Cursor)
 	writeOrderBy(w, query.OrderBy)
 	writeIncludeMap(w, query.Include)
+	writeStrings(w, query.Select)
 }
 
 func readQuery(r *bytes.Reader) (zenithdb.Query, error) {
@@ -309,6 +380,10 @@ func readQuery(r *bytes.Reader) (zenithdb.Query, error) {
 	if err != nil {
 		return zenithdb.Query{}, err
 	}
+	filterExpr, err := readFilterExpr(r)
+	if err != nil {
+		return zenithdb.Query{}, err
+	}
 	index, err := readString(r)
 	if err != nil {
 		return zenithdb.Query{}, err
@@ -333,23 +408,18 @@ func readQuery(r *bytes.Reader) (zenithdb.Query, error) {
 	if err != nil {
 		return zenithdb.Query{}, err
 	}
-	return zenithdb.Query{Where: where, Filters: filters, Index: index, Limit: int(limit), Skip: int(skip), Cursor: cursor, OrderBy: orderBy, Include: include}, nil
+	selected, err := readStrings(r)
+	if err != nil {
+		return zenithdb.Query{}, err
+	}
+	return zenithdb.Query{Where: where, Filters: filters, FilterExpr: filterExpr, Index: index, Limit: int(limit), Skip: int(skip), Cursor: cursor, OrderBy: orderBy, Include: include, Select: selected}, nil
 }
 
 func writeFilterMap(w io.Writer, filters map[string]zenithdb.Filter) {
 	writeUint32(w, uint32(len(filters)))
 	for field, filter := range filters {
 		writeString(w, field)
-		writeValue(w, filter.Equals)
-		writeUint32(w, uint32(len(filter.In)))
-		for _, value := range filter.In {
-			writeValue(w, value)
-		}
-		writeString(w, filter.Contains)
-		writeValue(w, filter.GT)
-		writeValue(w, filter.GTE)
-		writeValue(w, filter.LT)
-		writeValue(w, filter.LTE)
+		writeFilter(w, filter)
 	}
 }
 
@@ -367,45 +437,215 @@ func readFilterMap(r *bytes.Reader) (map[string]zenithdb.Filter, error) {
 		if err != nil {
 			return nil, err
 		}
-		equals, err := readValue(r)
-		if err != nil {
-			return nil, err
-		}
-		inSize, err := readUint32(r)
+		filter, err := readFilter(r)
 		if err != nil {
 			return nil, err
 		}
-		in := make([]any, 0, inSize)
-		for j := uint32(0); j < inSize; j++ {
-			value, err := readValue(r)
-			if err != nil {
-				return nil, err
-			}
-			in = append(in, value)
-		}
-		contains, err := readString(r)
+		filters[field] = filter
+	}
+	return filters, nil
+}
+
+func writeFilter(w io.Writer, filter zenithdb.Filter) {
+	writeValue(w, filter.Equals)
+	writeUint32(w, uint32(len(filter.In)))
+	for _, value := range filter.In {
+		writeValue(w, value)
+	}
+	writeString(w, filter.Contains)
+	writeValue(w, filter.GT)
+	writeValue(w, filter.GTE)
+	writeValue(w, filter.LT)
+	writeValue(w, filter.LTE)
+	writeStrings(w, filter.Path)
+	writeValue(w, filter.ArrayContains)
+	writeValue(w, filter.Has)
+	writeValues(w, filter.HasSome)
+	writeValues(w, filter.HasEvery)
+	writeBool(w, filter.IsEmpty != nil)
+	if filter.IsEmpty != nil {
+		writeBool(w, *filter.IsEmpty)
+	}
+	writeBool(w, filter.IsNull)
+	writeBool(w, filter.IsNotNull)
+}
+
+func readFilter(r *bytes.Reader) (zenithdb.Filter, error) {
+	equals, err := readValue(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	inSize, err := readUint32(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	in := make([]any, 0, inSize)
+	for i := uint32(0); i < inSize; i++ {
+		value, err := readValue(r)
 		if err != nil {
-			return nil, err
+			return zenithdb.Filter{}, err
 		}
-		gt, err := readValue(r)
+		in = append(in, value)
+	}
+	contains, err := readString(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	gt, err := readValue(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	gte, err := readValue(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	lt, err := readValue(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	lte, err := readValue(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	path, err := readStrings(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	arrayContains, err := readValue(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	has, err := readValue(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	hasSome, err := readValues(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	hasEvery, err := readValues(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	var isEmpty *bool
+	hasIsEmpty, err := readBool(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	if hasIsEmpty {
+		value, err := readBool(r)
 		if err != nil {
-			return nil, err
+			return zenithdb.Filter{}, err
 		}
-		gte, err := readValue(r)
+		isEmpty = &value
+	}
+	isNull, err := readBool(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	isNotNull, err := readBool(r)
+	if err != nil {
+		return zenithdb.Filter{}, err
+	}
+	return zenithdb.Filter{Equals: equals, In: in, Contains: contains, GT: gt, GTE: gte, LT: lt, LTE: lte, Path: path, ArrayContains: arrayContains, Has: has, HasSome: hasSome, HasEvery: hasEvery, IsEmpty: isEmpty, IsNull: isNull, IsNotNull: isNotNull}, nil
+}
+
+// writeFilterExpr encodes a filter tree depth first. A leading bool tells
+// whether the node is present, so a nil tree costs one byte.
+func writeFilterExpr(w io.Writer, expr *zenithdb.FilterExpr) {
+	writeBool(w, expr != nil)
+	if expr == nil {
+		return
+	}
+	writeString(w, expr.Field)
+	writeFilter(w, expr.Filter)
+	writeString(w, expr.Relation)
+	writeRelationFilter(w, expr.RelationFilter)
+	writeFilterExprs(w, expr.And)
+	writeFilterExprs(w, expr.Or)
+	writeFilterExpr(w, expr.Not)
+}
+
+func writeFilterExprs(w io.Writer, exprs []zenithdb.FilterExpr) {
+	writeUint32(w, uint32(len(exprs)))
+	for i := range exprs {
+		writeFilterExpr(w, &exprs[i])
+	}
+}
+
+func readFilterExpr(r *bytes.Reader) (*zenithdb.FilterExpr, error) {
+	present, err := readBool(r)
+	if err != nil || !present {
+		return nil, err
+	}
+	field, err := readString(r)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := readFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	relation, err := readString(r)
+	if err != nil {
+		return nil, err
+	}
+	relationFilter, err := readRelationFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	and, err := readFilterExprs(r)
+	if err != nil {
+		return nil, err
+	}
+	or, err := readFilterExprs(r)
+	if err != nil {
+		return nil, err
+	}
+	not, err := readFilterExpr(r)
+	if err != nil {
+		return nil, err
+	}
+	return &zenithdb.FilterExpr{Field: field, Filter: filter, Relation: relation, RelationFilter: relationFilter, And: and, Or: or, Not: not}, nil
+}
+
+func writeRelationFilter(w io.Writer, filter zenithdb.RelationFilter) {
+	writeFilterExpr(w, filter.Some)
+	writeFilterExpr(w, filter.Every)
+	writeFilterExpr(w, filter.None)
+	writeFilterExpr(w, filter.Is)
+	writeFilterExpr(w, filter.IsNot)
+}
+
+func readRelationFilter(r *bytes.Reader) (zenithdb.RelationFilter, error) {
+	var filter zenithdb.RelationFilter
+	for _, target := range []**zenithdb.FilterExpr{&filter.Some, &filter.Every, &filter.None, &filter.Is, &filter.IsNot} {
+		expr, err := readFilterExpr(r)
 		if err != nil {
-			return nil, err
+			return zenithdb.RelationFilter{}, err
 		}
-		lt, err := readValue(r)
+		*target = expr
+	}
+	return filter, nil
+}
+
+func readFilterExprs(r *bytes.Reader) ([]zenithdb.FilterExpr, error) {
+	size, err := readUint32(r)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	exprs := make([]zenithdb.FilterExpr, 0, size)
+	for i := uint32(0); i < size; i++ {
+		expr, err := readFilterExpr(r)
 		if err != nil {
 			return nil, err
 		}
-		lte, err := readValue(r)
-		if err != nil {
-			return nil, err
+		if expr == nil {
+			return nil, fmt.Errorf("filter expression list contains an empty node")
 		}
-		filters[field] = zenithdb.Filter{Equals: equals, In: in, Contains: contains, GT: gt, GTE: gte, LT: lt, LTE: lte}
+		exprs = append(exprs, *expr)
 	}
-	return filters, nil
+	return exprs, nil
 }
 
 func writeOrderBy(w io.Writer, orderBy []zenithdb.OrderBy) {
@@ -413,6 +653,8 @@ func writeOrderBy(w io.Writer, orderBy []zenithdb.OrderBy) {
 	for _, order := range orderBy {
 		writeString(w, order.Field)
 		writeString(w, string(order.Direction))
+		writeString(w, order.Count)
+		writeString(w, string(order.Nulls))
 	}
 }
 
@@ -431,7 +673,15 @@ func readOrderBy(r *bytes.Reader) ([]zenithdb.OrderBy, error) {
 		if err != nil {
 			return nil, err
 		}
-		orderBy = append(orderBy, zenithdb.OrderBy{Field: field, Direction: zenithdb.SortDirection(direction)})
+		count, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		nulls, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		orderBy = append(orderBy, zenithdb.OrderBy{Field: field, Direction: zenithdb.SortDirection(direction), Count: count, Nulls: zenithdb.NullsOrder(nulls)})
 	}
 	return orderBy, nil
 }
@@ -517,6 +767,7 @@ func writeMutationResults(w io.Writer, results []zenithdb.MutationResult) {
 	for _, result := range results {
 		writeString(w, result.Model)
 		writeString(w, result.Key)
+		writeRecord(w, result.Record)
 	}
 }
 
@@ -535,7 +786,11 @@ func readMutationResults(r *bytes.Reader) ([]zenithdb.MutationResult, error) {
 		if err != nil {
 			return nil, err
 		}
-		results = append(results, zenithdb.MutationResult{Model: model, Key: key})
+		record, err := readRecord(r)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, zenithdb.MutationResult{Model: model, Key: key, Record: record})
 	}
 	return results, nil
 }
@@ -557,6 +812,260 @@ func readManyResult(r *bytes.Reader) (zenithdb.ManyResult, error) {
 	return zenithdb.ManyResult{Model: model, Count: int(count)}, nil
 }
 
+func writePlan(w io.Writer, plan zenithdb.Plan) {
+	writeString(w, plan.Model)
+	writeString(w, string(plan.Access))
+	writeUint32(w, uint32(len(plan.Indexes)))
+	for _, index := range plan.Indexes {
+		writeString(w, index)
+	}
+	writeInt64(w, int64(plan.EstimatedRows))
+	writeBool(w, plan.Ordered)
+}
+
+func readPlan(r *bytes.Reader) (zenithdb.Plan, error) {
+	model, err := readString(r)
+	if err != nil {
+		return zenithdb.Plan{}, err
+	}
+	access, err := readString(r)
+	if err != nil {
+		return zenithdb.Plan{}, err
+	}
+	size, err := readUint32(r)
+	if err != nil {
+		return zenithdb.Plan{}, err
+	}
+	indexes := make([]string, 0, size)
+	for i := uint32(0); i < size; i++ {
+		index, err := readString(r)
+		if err != nil {
+			return zenithdb.Plan{}, err
+		}
+		indexes = append(indexes, index)
+	}
+	estimatedRows, err := readInt64(r)
+	if err != nil {
+		return zenithdb.Plan{}, err
+	}
+	ordered, err := readBool(r)
+	if err != nil {
+		return zenithdb.Plan{}, err
+	}
+	return zenithdb.Plan{Model: model, Access: zenithdb.PlanAccess(access), Indexes: indexes, EstimatedRows: int(estimatedRows), Ordered: ordered}, nil
+}
+
+func writeStrings(w io.Writer, values []string) {
+	writeUint32(w, uint32(len(values)))
+	for _, value := range values {
+		writeString(w, value)
+	}
+}
+
+func readStrings(r *bytes.Reader) ([]string, error) {
+	size, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, size)
+	for i := uint32(0); i < size; i++ {
+		value, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func writeAggregateQuery(w io.Writer, query zenithdb.AggregateQuery) {
+	writeQuery(w, query.Query)
+	writeBool(w, query.CountAll)
+	for _, fields := range [][]string{query.Count, query.Sum, query.Avg, query.Min, query.Max} {
+		writeStrings(w, fields)
+	}
+}
+
+func readAggregateQuery(r *bytes.Reader) (zenithdb.AggregateQuery, error) {
+	query, err := readQuery(r)
+	if err != nil {
+		return zenithdb.AggregateQuery{}, err
+	}
+	countAll, err := readBool(r)
+	if err != nil {
+		return zenithdb.AggregateQuery{}, err
+	}
+	aggregate := zenithdb.AggregateQuery{Query: query, CountAll: countAll}
+	for _, fields := range []*[]string{&aggregate.Count, &aggregate.Sum, &aggregate.Avg, &aggregate.Min, &aggregate.Max} {
+		if *fields, err = readStrings(r); err != nil {
+			return zenithdb.AggregateQuery{}, err
+		}
+	}
+	return aggregate, nil
+}
+
+func writeAggregateResult(w io.Writer, result zenithdb.AggregateResult) {
+	writeInt64(w, int64(result.CountAll))
+	writeUint32(w, uint32(len(result.Count)))
+	for field, count := range result.Count {
+		writeString(w, field)
+		writeInt64(w, int64(count))
+	}
+	for _, values := range []map[string]any{result.Sum, result.Avg, result.Min, result.Max} {
+		writeStringMap(w, values)
+	}
+}
+
+func readAggregateResult(r *bytes.Reader) (zenithdb.AggregateResult, error) {
+	countAll, err := readInt64(r)
+	if err != nil {
+		return zenithdb.AggregateResult{}, err
+	}
+	size, err := readUint32(r)
+	if err != nil {
+		return zenithdb.AggregateResult{}, err
+	}
+	result := zenithdb.AggregateResult{CountAll: int(countAll), Count: make(map[string]int, size)}
+	for i := uint32(0); i < size; i++ {
+		field, err := readString(r)
+		if err != nil {
+			return zenithdb.AggregateResult{}, err
+		}
+		count, err := readInt64(r)
+		if err != nil {
+			return zenithdb.AggregateResult{}, err
+		}
+		result.Count[field] = int(count)
+	}
+	for _, values := range []*map[string]any{&result.Sum, &result.Avg, &result.Min, &result.Max} {
+		if *values, err = readStringMap(r); err != nil {
+			return zenithdb.AggregateResult{}, err
+		}
+	}
+	return result, nil
+}
+
+func writeGroupByQuery(w io.Writer, query zenithdb.GroupByQuery) {
+	writeAggregateQuery(w, query.AggregateQuery)
+	writeStrings(w, query.By)
+	writeUint32(w, uint32(len(query.Having)))
+	for _, having := range query.Having {
+		writeString(w, string(having.Aggregate))
+		writeString(w, having.Field)
+		writeFilter(w, having.Filter)
+	}
+	writeUint32(w, uint32(len(query.OrderBy)))
+	for _, order := range query.OrderBy {
+		writeString(w, string(order.Aggregate))
+		writeString(w, order.Field)
+		writeString(w, string(order.Direction))
+		writeString(w, string(order.Nulls))
+	}
+	writeInt64(w, int64(query.Skip))
+	writeInt64(w, int64(query.Limit))
+}
+
+func readGroupByQuery(r *bytes.Reader) (zenithdb.GroupByQuery, error) {
+	aggregate, err := readAggregateQuery(r)
+	if err != nil {
+		return zenithdb.GroupByQuery{}, err
+	}
+	by, err := readStrings(r)
+	if err != nil {
+		return zenithdb.GroupByQuery{}, err
+	}
+	query := zenithdb.GroupByQuery{AggregateQuery: aggregate, By: by}
+	size, err := readUint32(r)
+	if err != nil {
+		return zenithdb.GroupByQuery{}, err
+	}
+	for i := uint32(0); i < size; i++ {
+		function, err := readString(r)
+		if err != nil {
+			return zenithdb.GroupByQuery{}, err
+		}
+		field, err := readString(r)
+		if err != nil {
+			return zenithdb.GroupByQuery{}, err
+		}
+		filter, err := readFilter(r)
+		if err != nil {
+			return zenithdb.GroupByQuery{}, err
+		}
+		query.Having = append(query.Having, zenithdb.Having{Aggregate: zenithdb.AggregateFunc(function), Field: field, Filter: filter})
+	}
+	size, err = readUint32(r)
+	if err != nil {
+		return zenithdb.GroupByQuery{}, err
+	}
+	for i := uint32(0); i < size; i++ {
+		function, err := readString(r)
+		if err != nil {
+			return zenithdb.GroupByQuery{}, err
+		}
+		field, err := readString(r)
+		if err != nil {
+			return zenithdb.GroupByQuery{}, err
+		}
+		direction, err := readString(r)
+		if err != nil {
+			return zenithdb.GroupByQuery{}, err
+		}
+		nulls, err := readString(r)
+		if err != nil {
+			return zenithdb.GroupByQuery{}, err
+		}
+		query.OrderBy = append(query.OrderBy, zenithdb.GroupOrderBy{Aggregate: zenithdb.AggregateFunc(function), Field: field, Direction: zenithdb.SortDirection(direction), Nulls: zenithdb.NullsOrder(nulls)})
+	}
+	skip, err := readInt64(r)
+	if err != nil {
+		return zenithdb.GroupByQuery{}, err
+	}
+	limit, err := readInt64(r)
+	if err != nil {
+		return zenithdb.GroupByQuery{}, err
+	}
+	query.Skip, query.Limit = int(skip), int(limit)
+	return query, nil
+}
+
+func writeGroups(w io.Writer, groups []zenithdb.Group) {
+	writeUint32(w, uint32(len(groups)))
+	for _, group := range groups {
+		writeRecord(w, group.Key)
+		writeAggregateResult(w, group.AggregateResult)
+	}
+}
+
+func readGroups(r *bytes.Reader) ([]zenithdb.Group, error) {
+	size, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]zenithdb.Group, 0, size)
+	for i := uint32(0); i < size; i++ {
+		key, err := readRecord(r)
+		if err != nil {
+			return nil, err
+		}
+		result, err := readAggregateResult(r)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, zenithdb.Group{Key: key, AggregateResult: result})
+	}
+	return groups, nil
+}
+
+func readIterateBatch(r *bytes.Reader) ([]zenithdb.Record, bool, error) {
+	records, err := readRecordSlice(r)
+	if err != nil {
+		return nil, false, err
+	}
+	done, err := readBool(r)
+	return records, done, err
+}
+
 func writeValue(w io.Writer, value any) {
 	switch typed := value.(type) {
 	case nil:
@@ -585,12 +1094,71 @@ func writeValue(w io.Writer, value any) {
 	case []zenithdb.Record:
 		_, _ = w.Write([]byte{valueRecordSlice})
 		writeRecordSlice(w, typed)
+	case zenithdb.NestedWrite:
+		_, _ = w.Write([]byte{valueNestedWrite})
+		writeNestedWrite(w, typed)
+	case []byte:
+		_, _ = w.Write([]byte{valueBytes})
+		writeString(w, string(typed))
+	case json.RawMessage:
+		_, _ = w.Write([]byte{valueJSON})
+		writeString(w, string(typed))
+	case map[string]any:
+		_, _ = w.Write([]byte{valueMap})
+		writeUint32(w, uint32(len(typed)))
+		for key, element := range typed {
+			writeString(w, key)
+			writeValue(w, element)
+		}
+	case []any:
+		_, _ = w.Write([]byte{valueList})
+		writeValues(w, typed)
+	case zenithdb.ListUpdate:
+		_, _ = w.Write([]byte{valueListUpdate})
+		writeBool(w, typed.Set != nil)
+		writeValues(w, typed.Set)
+		writeValues(w, typed.Push)
 	default:
+		if list := reflect.ValueOf(typed); list.Kind() == reflect.Slice {
+			values := make([]any, list.Len())
+			for i := range values {
+				values[i] = list.Index(i).Interface()
+			}
+			writeValue(w, values)
+			return
+		}
 		_, _ = w.Write([]byte{valueString})
 		writeString(w, fmt.Sprint(typed))
 	}
 }
 
+// writeValues encodes a list of values preceded by its length.
+func writeValues(w io.Writer, values []any) {
+	writeUint32(w, uint32(len(values)))
+	for _, value := range values {
+		writeValue(w, value)
+	}
+}
+
+func readValues(r *bytes.Reader) ([]any, error) {
+	size, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	values := make([]any, 0, size)
+	for i := uint32(0); i < size; i++ {
+		value, err := readValue(r)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
 func readValue(r *bytes.Reader) (any, error) {
 	kind, err := r.ReadByte()
 	if err != nil {
@@ -617,7 +1185,152 @@ func readValue(r *bytes.Reader) (any, error) {
 		return readRecord(r)
 	case valueRecordSlice:
 		return readRecordSlice(r)
+	case valueNestedWrite:
+		return readNestedWrite(r)
+	case valueBytes:
+		raw, err := readString(r)
+		return []byte(raw), err
+	case valueJSON:
+		raw, err := readString(r)
+		return json.RawMessage(raw), err
+	case valueMap:
+		size, err := readUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string]any, size)
+		for i := uint32(0); i < size; i++ {
+			key, err := readString(r)
+			if err != nil {
+				return nil, err
+			}
+			if values[key], err = readValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case valueList:
+		values, err := readValues(r)
+		if values == nil && err == nil {
+			values = []any{}
+		}
+		return values, err
+	case valueListUpdate:
+		hasSet, err := readBool(r)
+		if err != nil {
+			return nil, err
+		}
+		var update zenithdb.ListUpdate
+		if update.Set, err = readValues(r); err != nil {
+			return nil, err
+		}
+		if hasSet && update.Set == nil {
+			update.Set = []any{}
+		}
+		if update.Push, err = readValues(r); err != nil {
+			return nil, err
+		}
+		return update, nil
 	default:
 		return nil, fmt.Errorf("unknown value kind %d", kind)
 	}
 }
+
+// writeNestedWrite encodes write. Set is preceded by whether it is present,
+// since a nil Set leaves a relation alone and an empty one disconnects it.
+func writeNestedWrite(w io.Writer, write zenithdb.NestedWrite) {
+	writeRecordSlice(w, write.Create)
+	writeWheres(w, write.Connect)
+	writeUint32(w, uint32(len(write.ConnectOrCreate)))
+	for _, connectOrCreate := range write.ConnectOrCreate {
+		writeStringMap(w, connectOrCreate.Where)
+		writeRecord(w, connectOrCreate.Create)
+	}
+	writeWheres(w, write.Disconnect)
+	writeBool(w, write.Set != nil)
+	writeWheres(w, write.Set)
+	writeUint32(w, uint32(len(write.Update)))
+	for _, update := range write.Update {
+		writeStringMap(w, update.Where)
+		writeRecord(w, update.Data)
+	}
+	writeWheres(w, write.Delete)
+}
+
+func readNestedWrite(r *bytes.Reader) (zenithdb.NestedWrite, error) {
+	var write zenithdb.NestedWrite
+	var err error
+	if write.Create, err = readRecordSlice(r); err != nil {
+		return write, err
+	}
+	if write.Connect, err = readWheres(r); err != nil {
+		return write, err
+	}
+	size, err := readUint32(r)
+	if err != nil {
+		return write, err
+	}
+	for i := uint32(0); i < size; i++ {
+		where, err := readStringMap(r)
+		if err != nil {
+			return write, err
+		}
+		create, err := readRecord(r)
+		if err != nil {
+			return write, err
+		}
+		write.ConnectOrCreate = append(write.ConnectOrCreate, zenithdb.ConnectOrCreate{Where: where, Create: create})
+	}
+	if write.Disconnect, err = readWheres(r); err != nil {
+		return write, err
+	}
+	hasSet, err := readBool(r)
+	if err != nil {
+		return write, err
+	}
+	if write.Set, err = readWheres(r); err != nil {
+		return write, err
+	}
+	if hasSet && write.Set == nil {
+		write.Set = []map[string]any{}
+	}
+	if size, err = readUint32(r); err != nil {
+		return write, err
+	}
+	for i := uint32(0); i < size; i++ {
+		where, err := readStringMap(r)
+		if err != nil {
+			return write, err
+		}
+		data, err := readRecord(r)
+		if err != nil {
+			return write, err
+		}
+		write.Update = append(write.Update, zenithdb.NestedUpdate{Where: where, Data: data})
+	}
+	write.Delete, err = readWheres(r)
+	return write, err
+}
+
+func writeWheres(w io.Writer, wheres []map[string]any) {
+	writeUint32(w, uint32(len(wheres)))
+	for _, where := range wheres {
+		writeStringMap(w, where)
+	}
+}
+
+func readWheres(r *bytes.Reader) ([]map[string]any, error) {
+	size, err := readUint32(r)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	wheres := make([]map[string]any, 0, size)
+	for i := uint32(0); i < size; i++ {
+		where, err := readStringMap(r)
+		if err != nil {
+			return nil, err
+		}
+		wheres = append(wheres, where)
+	}
+	return wheres, nil
+}
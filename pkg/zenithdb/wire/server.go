@@ -8,7 +8,9 @@ import (
 	"crypto/subtle"
 	"fmt"
 	"io"
+	"iter"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/bypepe77/ZenithDB/pkg/zenithdb"
@@ -19,6 +21,14 @@ type Options struct {
 	SchemaSource     string
 	SchemaHash       string
 	HandshakeTimeout time.Duration
+	// MaxStreams and MaxTransactions cap the Iterate streams and the
+	// transactions one connection may hold open at once. Opening one more
+	// fails until the connection finishes one.
+	MaxStreams      int
+	MaxTransactions int
+	// StreamIdleTimeout closes an Iterate stream the client has not asked for
+	// a batch of in that long.
+	StreamIdleTimeout time.Duration
 }
 
 type Server struct {
@@ -30,6 +40,15 @@ func NewServer(db *zenithdb.DB, options Options) *Server {
 	if options.HandshakeTimeout == 0 {
 		options.HandshakeTimeout = 5 * time.Second
 	}
+	if options.MaxStreams == 0 {
+		options.MaxStreams = 64
+	}
+	if options.MaxTransactions == 0 {
+		options.MaxTransactions = 64
+	}
+	if options.StreamIdleTimeout == 0 {
+		options.StreamIdleTimeout = time.Minute
+	}
 	return &Server{db: db, options: options}
 }
 
@@ -64,6 +83,9 @@ func (s *Server) handleConn(conn net.Conn) {
 		return
 	}
 
+	session := newSession(s.options)
+	defer session.rollbackAll()
+	defer session.closeStreams()
 	for {
 		op, payload, err := readFrame(reader)
 		if err != nil {
@@ -72,7 +94,7 @@ func (s *Server) handleConn(conn net.Conn) {
 			}
 			return
 		}
-		response, err := s.handleRequest(context.Background(), op, payload)
+		response, err := s.handleRequest(context.Background(), session, op, payload)
 		if err != nil {
 			_ = writeErrorResponse(writer, err)
 		} else {
@@ -97,7 +119,7 @@ func (s *Server) readHandshake(reader *bufio.Reader) error {
 		return err
 	}
 	if version != protocolVersion {
-		return fmt.Errorf("unsupported wire protocol version %d", version)
+		return fmt.Errorf("unsupported wire protocol version %d, server speaks version %d", version, protocolVersion)
 	}
 	token, err := readStringFromReader(reader)
 	if err != nil {
@@ -122,74 +144,107 @@ func secureEqual(expected string, actual string) bool {
 	return subtle.ConstantTimeCompare(expectedHash[:], actualHash[:]) == 1
 }
 
-func (s *Server) handleRequest(ctx context.Context, op byte, payload []byte) ([]byte, error) {
+func (s *Server) handleRequest(ctx context.Context, session *session, op byte, payload []byte) ([]byte, error) {
 	reader := bytes.NewReader(payload)
 	var response bytes.Buffer
 	switch op {
-	case opCreate:
-		model, record, err := readMutateCreate(reader)
+	case opCreate, opUpdate, opDelete, opUpsert, opFindUnique, opFindMany:
+		return execute(ctx, s.db, op, reader)
+	case opIterate:
+		model, err := readString(reader)
 		if err != nil {
 			return nil, err
 		}
-		result, err := s.db.Create(ctx, model, record)
+		query, err := readQuery(reader)
 		if err != nil {
 			return nil, err
 		}
-		writeString(&response, result.Model)
-		writeString(&response, result.Key)
-	case opCreateMany:
-		model, err := readString(reader)
+		batch, err := readUint32(reader)
 		if err != nil {
 			return nil, err
 		}
-		records, err := readRecordSlice(reader)
+		id, err := session.openStream(s.db.Iterate(ctx, model, query), batch)
 		if err != nil {
 			return nil, err
 		}
-		results, err := s.db.CreateMany(ctx, model, records)
+		writeUint32(&response, id)
+		if err := session.nextBatch(id, &response); err != nil {
+			return nil, err
+		}
+	case opIterateNext:
+		id, err := readUint32(reader)
 		if err != nil {
 			return nil, err
 		}
-		writeMutationResults(&response, results)
-	case opUpdate:
-		model, where, record, err := readMutateUpdate(reader)
+		if err := session.nextBatch(id, &response); err != nil {
+			return nil, err
+		}
+	case opIterateClose:
+		id, err := readUint32(reader)
 		if err != nil {
 			return nil, err
 		}
-		updated, err := s.db.Update(ctx, model, where, record)
+		session.closeStream(id)
+	case opBegin:
+		if err := session.canBegin(); err != nil {
+			return nil, err
+		}
+		tx, err := s.db.Begin(ctx)
 		if err != nil {
 			return nil, err
 		}
-		writeRecord(&response, updated)
-	case opUpdateMany:
-		model, err := readString(reader)
+		writeUint32(&response, session.begin(tx))
+	case opCommit, opRollback:
+		id, err := readUint32(reader)
 		if err != nil {
 			return nil, err
 		}
-		query, err := readQuery(reader)
+		tx, err := session.finish(id)
 		if err != nil {
 			return nil, err
 		}
-		patch, err := readRecord(reader)
+		if op == opCommit {
+			err = tx.Commit(ctx)
+		} else {
+			err = tx.Rollback(ctx)
+		}
 		if err != nil {
 			return nil, err
 		}
-		result, err := s.db.UpdateMany(ctx, model, query, patch)
+	case opTx:
+		id, err := readUint32(reader)
 		if err != nil {
 			return nil, err
 		}
-		writeManyResult(&response, result)
-	case opDelete:
-		model, where, err := readModelWhere(reader)
+		tx, err := session.tx(id)
 		if err != nil {
 			return nil, err
 		}
-		deleted, err := s.db.Delete(ctx, model, where)
+		innerOp, err := reader.ReadByte()
 		if err != nil {
 			return nil, err
 		}
-		writeRecord(&response, deleted)
-	case opDeleteMany:
+		switch innerOp {
+		case opCreate, opUpdate, opDelete, opUpsert, opFindUnique, opFindMany:
+			return execute(ctx, tx, innerOp, reader)
+		default:
+			return nil, fmt.Errorf("wire operation %d is not supported inside a transaction", innerOp)
+		}
+	case opCreateMany:
+		model, err := readString(reader)
+		if err != nil {
+			return nil, err
+		}
+		records, err := readRecordSlice(reader)
+		if err != nil {
+			return nil, err
+		}
+		results, err := s.db.CreateMany(ctx, model, records)
+		if err != nil {
+			return nil, err
+		}
+		writeMutationResults(&response, results)
+	case opUpdateMany:
 		model, err := readString(reader)
 		if err != nil {
 			return nil, err
@@ -198,22 +253,29 @@ func (s *Server) handleRequest(ctx context.Context, op byte, payload []byte) ([]
 		if err != nil {
 			return nil, err
 		}
-		result, err := s.db.DeleteMany(ctx, model, query)
+		patch, err := readRecord(reader)
+		if err != nil {
+			return nil, err
+		}
+		result, err := s.db.UpdateMany(ctx, model, query, patch)
 		if err != nil {
 			return nil, err
 		}
 		writeManyResult(&response, result)
-	case opUpsert:
-		model, where, createRecord, updatePatch, err := readUpsert(reader)
+	case opDeleteMany:
+		model, err := readString(reader)
+		if err != nil {
+			return nil, err
+		}
+		query, err := readQuery(reader)
 		if err != nil {
 			return nil, err
 		}
-		record, created, err := s.db.Upsert(ctx, model, where, createRecord, updatePatch)
+		result, err := s.db.DeleteMany(ctx, model, query)
 		if err != nil {
 			return nil, err
 		}
-		writeBool(&response, created)
-		writeRecord(&response, record)
+		writeManyResult(&response, result)
 	case opBatch:
 		operations, err := readBatchOperations(reader)
 		if err != nil {
@@ -224,20 +286,21 @@ func (s *Server) handleRequest(ctx context.Context, op byte, payload []byte) ([]
 			return nil, err
 		}
 		writeBatchResults(&response, results)
-	case opFindUnique:
-		model, where, include, err := readFindUnique(reader)
+	case opCount:
+		model, err := readString(reader)
 		if err != nil {
 			return nil, err
 		}
-		record, found, err := s.db.FindUnique(ctx, model, where, include)
+		query, err := readQuery(reader)
 		if err != nil {
 			return nil, err
 		}
-		writeBool(&response, found)
-		if found {
-			writeRecord(&response, record)
+		count, err := s.db.Count(ctx, model, query)
+		if err != nil {
+			return nil, err
 		}
-	case opFindMany:
+		writeInt64(&response, int64(count))
+	case opExplain:
 		model, err := readString(reader)
 		if err != nil {
 			return nil, err
@@ -246,25 +309,39 @@ func (s *Server) handleRequest(ctx context.Context, op byte, payload []byte) ([]
 		if err != nil {
 			return nil, err
 		}
-		records, err := s.db.FindMany(ctx, model, query)
+		plan, err := s.db.Explain(ctx, model, query)
 		if err != nil {
 			return nil, err
 		}
-		writeRecordSlice(&response, records)
-	case opCount:
+		writePlan(&response, plan)
+	case opAggregate:
 		model, err := readString(reader)
 		if err != nil {
 			return nil, err
 		}
-		query, err := readQuery(reader)
+		query, err := readAggregateQuery(reader)
 		if err != nil {
 			return nil, err
 		}
-		count, err := s.db.Count(ctx, model, query)
+		result, err := s.db.Aggregate(ctx, model, query)
 		if err != nil {
 			return nil, err
 		}
-		writeInt64(&response, int64(count))
+		writeAggregateResult(&response, result)
+	case opGroupBy:
+		model, err := readString(reader)
+		if err != nil {
+			return nil, err
+		}
+		query, err := readGroupByQuery(reader)
+		if err != nil {
+			return nil, err
+		}
+		groups, err := s.db.GroupBy(ctx, model, query)
+		if err != nil {
+			return nil, err
+		}
+		writeGroups(&response, groups)
 	case opCheckpoint:
 		if err := s.db.Checkpoint(ctx); err != nil {
 			return nil, err
@@ -285,6 +362,254 @@ func (s *Server) handleRequest(ctx context.Context, op byte, payload []byte) ([]
 	return response.Bytes(), nil
 }
 
+// executor is the part of the engine API shared by *zenithdb.DB and
+// *zenithdb.Tx, so single-record requests run the same way in and out of a
+// transaction.
+type executor interface {
+	Create(context.Context, string, zenithdb.Record) (zenithdb.MutationResult, error)
+	Update(context.Context, string, map[string]any, zenithdb.Record) (zenithdb.Record, error)
+	Delete(context.Context, string, map[string]any) (zenithdb.Record, error)
+	Upsert(context.Context, string, map[string]any, zenithdb.Record, zenithdb.Record) (zenithdb.Record, bool, error)
+	FindUnique(context.Context, string, map[string]any, map[string]zenithdb.Include, []string) (zenithdb.Record, bool, error)
+	FindMany(context.Context, string, zenithdb.Query) ([]zenithdb.Record, error)
+}
+
+func execute(ctx context.Context, db executor, op byte, reader *bytes.Reader) ([]byte, error) {
+	var response bytes.Buffer
+	switch op {
+	case opCreate:
+		model, record, err := readMutateCreate(reader)
+		if err != nil {
+			return nil, err
+		}
+		result, err := db.Create(ctx, model, record)
+		if err != nil {
+			return nil, err
+		}
+		writeString(&response, result.Model)
+		writeString(&response, result.Key)
+		writeRecord(&response, result.Record)
+	case opUpdate:
+		model, where, record, err := readMutateUpdate(reader)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := db.Update(ctx, model, where, record)
+		if err != nil {
+			return nil, err
+		}
+		writeRecord(&response, updated)
+	case opDelete:
+		model, where, err := readModelWhere(reader)
+		if err != nil {
+			return nil, err
+		}
+		deleted, err := db.Delete(ctx, model, where)
+		if err != nil {
+			return nil, err
+		}
+		writeRecord(&response, deleted)
+	case opUpsert:
+		model, where, createRecord, updatePatch, err := readUpsert(reader)
+		if err != nil {
+			return nil, err
+		}
+		record, created, err := db.Upsert(ctx, model, where, createRecord, updatePatch)
+		if err != nil {
+			return nil, err
+		}
+		writeBool(&response, created)
+		writeRecord(&response, record)
+	case opFindUnique:
+		model, where, include, selected, err := readFindUnique(reader)
+		if err != nil {
+			return nil, err
+		}
+		record, found, err := db.FindUnique(ctx, model, where, include, selected)
+		if err != nil {
+			return nil, err
+		}
+		writeBool(&response, found)
+		if found {
+			writeRecord(&response, record)
+		}
+	case opFindMany:
+		model, err := readString(reader)
+		if err != nil {
+			return nil, err
+		}
+		query, err := readQuery(reader)
+		if err != nil {
+			return nil, err
+		}
+		records, err := db.FindMany(ctx, model, query)
+		if err != nil {
+			return nil, err
+		}
+		writeRecordSlice(&response, records)
+	default:
+		return nil, fmt.Errorf("unknown wire operation %d", op)
+	}
+	return response.Bytes(), nil
+}
+
+// session tracks the transactions and streams opened on one connection.
+// Transactions left open when the connection drops are rolled back. Streams
+// also close once they sit idle, on a timer of their own, so mu guards them.
+type session struct {
+	options Options
+	txs     map[uint32]*zenithdb.Tx
+	mu      sync.Mutex
+	streams map[uint32]*stream
+	nextID  uint32
+}
+
+// stream is an Iterate a connection has open: the records still to send, the
+// most each batch may hold, when the client last read a batch, and the timer
+// that closes it once idle.
+type stream struct {
+	next  func() (zenithdb.Record, error, bool)
+	stop  func()
+	batch uint32
+	used  time.Time
+	idle  *time.Timer
+}
+
+func newSession(options Options) *session {
+	return &session{options: options, txs: make(map[uint32]*zenithdb.Tx), streams: make(map[uint32]*stream)}
+}
+
+func (s *session) openStream(records iter.Seq2[zenithdb.Record, error], batch uint32) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.streams) >= s.options.MaxStreams {
+		return 0, fmt.Errorf("connection already has %d open streams", len(s.streams))
+	}
+	next, stop := iter.Pull2(records)
+	s.nextID++
+	id := s.nextID
+	s.streams[id] = &stream{
+		next:  next,
+		stop:  stop,
+		batch: min(max(batch, 1), iterateBatchRecords),
+		used:  time.Now(),
+		idle:  time.AfterFunc(s.options.StreamIdleTimeout, func() { s.expireStream(id) }),
+	}
+	return id, nil
+}
+
+// expireStream closes stream id unless a batch was read from it while its
+// idle timer was firing.
+func (s *session) expireStream(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stream, ok := s.streams[id]; ok && time.Since(stream.used) >= s.options.StreamIdleTimeout {
+		s.closeStreamLocked(id)
+	}
+}
+
+// nextBatch writes the next batch of stream id, and closes the stream once
+// it is done or fails.
+func (s *session) nextBatch(id uint32, w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream, ok := s.streams[id]
+	if !ok {
+		return fmt.Errorf("unknown stream %d", id)
+	}
+	done, err := stream.writeBatch(w)
+	if done || err != nil {
+		s.closeStreamLocked(id)
+		return err
+	}
+	stream.used = time.Now()
+	stream.idle.Reset(s.options.StreamIdleTimeout)
+	return nil
+}
+
+func (s *session) closeStream(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeStreamLocked(id)
+}
+
+func (s *session) closeStreamLocked(id uint32) {
+	if stream, ok := s.streams[id]; ok {
+		stream.idle.Stop()
+		stream.stop()
+		delete(s.streams, id)
+	}
+}
+
+func (s *session) closeStreams() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.streams {
+		s.closeStreamLocked(id)
+	}
+}
+
+// writeBatch writes the records of the next batch followed by whether they
+// are the last ones.
+func (s *stream) writeBatch(w io.Writer) (bool, error) {
+	var records bytes.Buffer
+	count := uint32(0)
+	done := false
+	for count < s.batch && records.Len() < iterateBatchBytes {
+		record, err, ok := s.next()
+		if !ok {
+			done = true
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+		writeRecord(&records, record)
+		count++
+	}
+	writeUint32(w, count)
+	_, _ = w.Write(records.Bytes())
+	writeBool(w, done)
+	return done, nil
+}
+
+func (s *session) canBegin() error {
+	if len(s.txs) >= s.options.MaxTransactions {
+		return fmt.Errorf("connection already has %d open transactions", len(s.txs))
+	}
+	return nil
+}
+
+func (s *session) begin(tx *zenithdb.Tx) uint32 {
+	s.nextID++
+	s.txs[s.nextID] = tx
+	return s.nextID
+}
+
+func (s *session) tx(id uint32) (*zenithdb.Tx, error) {
+	tx, ok := s.txs[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown transaction %d", id)
+	}
+	return tx, nil
+}
+
+func (s *session) finish(id uint32) (*zenithdb.Tx, error) {
+	tx, err := s.tx(id)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.txs, id)
+	return tx, nil
+}
+
+func (s *session) rollbackAll() {
+	for id, tx := range s.txs {
+		_ = tx.Rollback(context.Background())
+		delete(s.txs, id)
+	}
+}
+
 func readMutateCreate(reader *bytes.Reader) (string, zenithdb.Record, error) {
 	model, err := readString(reader)
 	if err != nil {
@@ -333,11 +658,15 @@ func readModelWhere(reader *bytes.Reader) (string, map[string]any, error) {
 	return model, where, err
 }
 
-func readFindUnique(reader *bytes.Reader) (string, map[string]any, map[string]zenithdb.Include, error) {
+func readFindUnique(reader *bytes.Reader) (string, map[string]any, map[string]zenithdb.Include, []string, error) {
 	model, where, err := readModelWhere(reader)
 	if err != nil {
-		return "", nil, nil, err
+		return "", nil, nil, nil, err
 	}
 	include, err := readIncludeMap(reader)
-	return model, where, include, err
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+	selected, err := readStrings(reader)
+	return model, where, include, selected, err
 }
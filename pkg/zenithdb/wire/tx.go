@@ -0,0 +1,68 @@
+package wire
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/bypepe77/ZenithDB/pkg/zenithdb"
+)
+
+// Tx is a server-side interactive transaction bound to one connection.
+type Tx struct {
+	client *Client
+	id     uint32
+}
+
+// Begin starts an interactive transaction on the server.
+func (c *Client) Begin(ctx context.Context) (*Tx, error) {
+	response, err := c.roundTrip(ctx, opBegin, nil)
+	if err != nil {
+		return nil, err
+	}
+	id, err := readUint32(bytes.NewReader(response))
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{client: c, id: id}, nil
+}
+
+func (tx *Tx) Create(ctx context.Context, model string, record zenithdb.Record) (zenithdb.MutationResult, error) {
+	return tx.client.create(ctx, tx.id, model, record)
+}
+
+func (tx *Tx) Update(ctx context.Context, model string, where map[string]any, patch zenithdb.Record) (zenithdb.Record, error) {
+	return tx.client.update(ctx, tx.id, model, where, patch)
+}
+
+func (tx *Tx) Delete(ctx context.Context, model string, where map[string]any) (zenithdb.Record, error) {
+	return tx.client.delete(ctx, tx.id, model, where)
+}
+
+func (tx *Tx) Upsert(ctx context.Context, model string, where map[string]any, createRecord zenithdb.Record, updatePatch zenithdb.Record) (zenithdb.Record, bool, error) {
+	return tx.client.upsert(ctx, tx.id, model, where, createRecord, updatePatch)
+}
+
+func (tx *Tx) FindUnique(ctx context.Context, model string, where map[string]any, include map[string]zenithdb.Include, selected []string) (zenithdb.Record, bool, error) {
+	return tx.client.findUnique(ctx, tx.id, model, where, include, selected)
+}
+
+func (tx *Tx) FindMany(ctx context.Context, model string, query zenithdb.Query) ([]zenithdb.Record, error) {
+	return tx.client.findMany(ctx, tx.id, model, query)
+}
+
+// Commit publishes the transaction's writes atomically.
+func (tx *Tx) Commit(ctx context.Context) error {
+	return tx.finish(ctx, opCommit)
+}
+
+// Rollback discards the transaction's writes.
+func (tx *Tx) Rollback(ctx context.Context) error {
+	return tx.finish(ctx, opRollback)
+}
+
+func (tx *Tx) finish(ctx context.Context, op byte) error {
+	var request bytes.Buffer
+	writeUint32(&request, tx.id)
+	_, err := tx.client.roundTrip(ctx, op, request.Bytes())
+	return err
+}
@@ -1,11 +1,19 @@
 package wire_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
 	"net"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/bypepe77/ZenithDB/pkg/zenithdb"
 	"github.com/bypepe77/ZenithDB/pkg/zenithdb/remote"
@@ -38,7 +46,7 @@ func TestRemoteClientRoundTripOverWire(t *testing.T) {
 		t.Fatalf("remote create: %v", err)
 	}
 
-	record, ok, err := client.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil)
+	record, ok, err := client.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil)
 	if err != nil {
 		t.Fatalf("remote find unique: %v", err)
 	}
@@ -106,6 +114,39 @@ func TestRemoteClientRoundTripOverWire(t *testing.T) {
 	if len(nextPosts) != 1 || nextPosts[0]["title"] != "Beta" {
 		t.Fatalf("unexpected remote cursor page: %+v", nextPosts)
 	}
+	composed, err := client.Count(ctx, "Post", zenithdb.Query{FilterExpr: &zenithdb.FilterExpr{
+		Or: []zenithdb.FilterExpr{
+			{Field: "title", Filter: zenithdb.Filter{Equals: "Alpha"}},
+			{Field: "title", Filter: zenithdb.Filter{Equals: "Gamma"}},
+		},
+		Not: &zenithdb.FilterExpr{Field: "id", Filter: zenithdb.Filter{Equals: "p3"}},
+	}})
+	if err != nil {
+		t.Fatalf("remote count with filter expression: %v", err)
+	}
+	if composed != 1 {
+		t.Fatalf("expected 1 remote post matching the filter expression, got %d", composed)
+	}
+	byAda, err := client.Count(ctx, "Post", zenithdb.Query{FilterExpr: &zenithdb.FilterExpr{
+		Relation:       "author",
+		RelationFilter: zenithdb.RelationFilter{Is: &zenithdb.FilterExpr{Field: "email", Filter: zenithdb.Filter{Equals: "ada@example.com"}}},
+	}})
+	if err != nil {
+		t.Fatalf("remote count with relation filter: %v", err)
+	}
+	if byAda != 3 {
+		t.Fatalf("expected 3 remote posts by Ada, got %d", byAda)
+	}
+	withoutPosts, err := client.FindMany(ctx, "User", zenithdb.Query{FilterExpr: &zenithdb.FilterExpr{
+		Relation:       "posts",
+		RelationFilter: zenithdb.RelationFilter{None: &zenithdb.FilterExpr{}},
+	}})
+	if err != nil {
+		t.Fatalf("remote find with relation filter: %v", err)
+	}
+	if len(withoutPosts) != 1 || withoutPosts[0]["id"] != "u2" {
+		t.Fatalf("expected only u2 without posts, got %+v", withoutPosts)
+	}
 	count, err := client.Count(ctx, "Post", zenithdb.Query{Where: map[string]any{"authorId": "u1"}})
 	if err != nil {
 		t.Fatalf("remote count: %v", err)
@@ -113,6 +154,48 @@ func TestRemoteClientRoundTripOverWire(t *testing.T) {
 	if count != 3 {
 		t.Fatalf("expected remote count 3, got %d", count)
 	}
+	plan, err := client.Explain(ctx, "Post", zenithdb.Query{Where: map[string]any{"authorId": "u1"}})
+	if err != nil {
+		t.Fatalf("remote explain: %v", err)
+	}
+	if plan.Access != zenithdb.PlanIndex || len(plan.Indexes) != 1 || plan.Indexes[0] != "post_author" || plan.EstimatedRows == 0 {
+		t.Fatalf("unexpected remote plan: %+v", plan)
+	}
+	selected, ok, err := client.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, []string{"email"})
+	if err != nil || !ok || len(selected) != 1 || selected["email"] != "ada@example.com" {
+		t.Fatalf("expected remote select of email, got %+v ok=%v err=%v", selected, ok, err)
+	}
+	titles, err := client.FindMany(ctx, "Post", zenithdb.Query{Where: map[string]any{"authorId": "u1"}, Select: []string{"title"}})
+	if err != nil {
+		t.Fatalf("remote find many with select: %v", err)
+	}
+	if len(titles) != 3 || len(titles[0]) != 1 || titles[0]["title"] == nil {
+		t.Fatalf("expected remote titles only, got %+v", titles)
+	}
+	aggregate, err := client.Aggregate(ctx, "Post", zenithdb.AggregateQuery{
+		Query:    zenithdb.Query{Where: map[string]any{"authorId": "u1"}},
+		CountAll: true,
+		Count:    []string{"title"},
+	})
+	if err != nil {
+		t.Fatalf("remote aggregate: %v", err)
+	}
+	if aggregate.CountAll != 3 || aggregate.Count["title"] != 3 {
+		t.Fatalf("unexpected remote aggregate: %+v", aggregate)
+	}
+	groups, err := client.GroupBy(ctx, "Post", zenithdb.GroupByQuery{
+		AggregateQuery: zenithdb.AggregateQuery{CountAll: true},
+		By:             []string{"authorId"},
+		Having:         []zenithdb.Having{{Aggregate: zenithdb.AggregateCount, Filter: zenithdb.Filter{GTE: int64(2)}}},
+		OrderBy:        []zenithdb.GroupOrderBy{{Aggregate: zenithdb.AggregateCount, Direction: zenithdb.SortDesc}},
+		Limit:          1,
+	})
+	if err != nil {
+		t.Fatalf("remote group by: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Key["authorId"] != "u1" || groups[0].CountAll != 3 {
+		t.Fatalf("unexpected remote groups: %+v", groups)
+	}
 	bulkCreated, err := client.CreateMany(ctx, "Post", []zenithdb.Record{
 		{"id": "p6", "authorId": "u1", "title": "Bulk Alpha"},
 		{"id": "p7", "authorId": "u1", "title": "Bulk Beta"},
@@ -180,13 +263,66 @@ func TestRemoteClientRoundTripOverWire(t *testing.T) {
 	if len(partial) != 0 {
 		t.Fatalf("remote failed batch left partial post: %+v", partial)
 	}
+	if _, err := client.Create(ctx, "User", zenithdb.Record{
+		"id":    "u3",
+		"email": "hopper@example.com",
+		"name":  "Hopper",
+		"posts": zenithdb.NestedWrite{Create: []zenithdb.Record{{"id": "p9", "title": "Iota"}}, Connect: []map[string]any{{"id": "p4"}}},
+	}); err != nil {
+		t.Fatalf("remote create with nested writes: %v", err)
+	}
+	if _, err := client.Update(ctx, "User", map[string]any{"id": "u3"}, zenithdb.Record{"posts": zenithdb.NestedWrite{
+		ConnectOrCreate: []zenithdb.ConnectOrCreate{{Where: map[string]any{"id": "p10"}, Create: zenithdb.Record{"id": "p10", "title": "Kappa"}}},
+		Update:          []zenithdb.NestedUpdate{{Where: map[string]any{"id": "p9"}, Data: zenithdb.Record{"title": "Lambda"}}},
+	}}); err != nil {
+		t.Fatalf("remote update with nested writes: %v", err)
+	}
+	nested, err := client.FindMany(ctx, "Post", zenithdb.Query{Where: map[string]any{"authorId": "u3"}, OrderBy: []zenithdb.OrderBy{{Field: "title", Direction: zenithdb.SortAsc}}})
+	if err != nil {
+		t.Fatalf("remote find nested posts: %v", err)
+	}
+	if len(nested) != 3 || nested[0]["id"] != "p4" || nested[1]["id"] != "p10" || nested[2]["title"] != "Lambda" {
+		t.Fatalf("unexpected remote nested posts: %+v", nested)
+	}
+	withPosts, ok, err := client.FindUnique(ctx, "User", map[string]any{"id": "u3"}, map[string]zenithdb.Include{"posts": {Query: zenithdb.Query{
+		Filters: map[string]zenithdb.Filter{"title": {Contains: "a"}},
+		OrderBy: []zenithdb.OrderBy{{Field: "title", Direction: zenithdb.SortDesc}},
+		Limit:   2,
+		Select:  []string{"title"},
+		Include: map[string]zenithdb.Include{"author": {Query: zenithdb.Query{Select: []string{"name"}}}},
+	}}}, nil)
+	if err != nil || !ok {
+		t.Fatalf("remote find with nested include: ok=%v err=%v", ok, err)
+	}
+	included, _ := withPosts["posts"].([]zenithdb.Record)
+	if len(included) != 2 || included[0]["title"] != "Lambda" || included[1]["title"] != "Kappa" || len(included[0]) != 2 {
+		t.Fatalf("unexpected remote included posts: %+v", withPosts["posts"])
+	}
+	if author, _ := included[0]["author"].(zenithdb.Record); len(author) != 1 || author["name"] != "Hopper" {
+		t.Fatalf("unexpected remote nested author: %+v", included[0]["author"])
+	}
+	counted, err := client.FindMany(ctx, "User", zenithdb.Query{
+		OrderBy: []zenithdb.OrderBy{{Count: "posts", Direction: zenithdb.SortDesc}},
+		Select:  []string{"id", zenithdb.CountField},
+	})
+	if err != nil {
+		t.Fatalf("remote find users by post count: %v", err)
+	}
+	previous := int64(-1)
+	for _, user := range counted {
+		count, _ := user[zenithdb.CountField].(zenithdb.Record)["posts"].(int64)
+		if previous >= 0 && count > previous || user["id"] == "u3" && count != 3 {
+			t.Fatalf("unexpected remote users by post count: %+v", counted)
+		}
+		previous = count
+	}
 
 	var waitGroup sync.WaitGroup
 	for i := 0; i < 32; i++ {
 		waitGroup.Add(1)
 		go func() {
 			defer waitGroup.Done()
-			record, ok, err := client.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil)
+			record, ok, err := client.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil)
 			if err != nil {
 				t.Errorf("pooled find unique: %v", err)
 				return
@@ -199,6 +335,499 @@ func TestRemoteClientRoundTripOverWire(t *testing.T) {
 	waitGroup.Wait()
 }
 
+func TestRemoteIterateStreamsBatchesOverWire(t *testing.T) {
+	ctx := context.Background()
+	db, err := zenithdb.Open(ctx, testSchema(), zenithdb.Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	listener := startWireServer(t, db, wire.Options{})
+
+	client, err := remote.OpenWithOptions(ctx, remote.OpenOptions{ConnectionURL: "zenith://" + listener.Addr().String(), PoolSize: 1})
+	if err != nil {
+		t.Fatalf("open remote client: %v", err)
+	}
+	defer client.Close()
+
+	users := make([]zenithdb.Record, 0, 600)
+	for i := 0; i < 600; i++ {
+		users = append(users, zenithdb.Record{"id": fmt.Sprintf("u%03d", i), "email": fmt.Sprintf("user%03d@example.com", i), "name": "User"})
+	}
+	if _, err := client.CreateMany(ctx, "User", users); err != nil {
+		t.Fatalf("remote create many: %v", err)
+	}
+
+	// The stream spans several batches, and the connection it shares keeps
+	// serving other requests between them.
+	seen := 0
+	for record, err := range client.Iterate(ctx, "User", zenithdb.Query{OrderBy: []zenithdb.OrderBy{{Field: "id"}}, Select: []string{"id"}}) {
+		if err != nil {
+			t.Fatalf("remote iterate: %v", err)
+		}
+		if len(record) != 1 || record["id"] != fmt.Sprintf("u%03d", seen) {
+			t.Fatalf("unexpected record %d: %+v", seen, record)
+		}
+		seen++
+		if seen == 300 {
+			if count, err := client.Count(ctx, "User", zenithdb.Query{}); err != nil || count != 600 {
+				t.Fatalf("count during iterate: count=%d err=%v", count, err)
+			}
+		}
+	}
+	if seen != 600 {
+		t.Fatalf("expected 600 streamed users, got %d", seen)
+	}
+
+	seen = 0
+	for _, err := range client.Iterate(ctx, "User", zenithdb.Query{}) {
+		if err != nil {
+			t.Fatalf("remote iterate: %v", err)
+		}
+		if seen++; seen == 10 {
+			break
+		}
+	}
+	if _, ok, err := client.FindUnique(ctx, "User", map[string]any{"id": "u001"}, nil, nil); err != nil || !ok {
+		t.Fatalf("find after stopped iterate: found=%v err=%v", ok, err)
+	}
+
+	var iterateErr error
+	for _, err := range client.Iterate(ctx, "Missing", zenithdb.Query{}) {
+		iterateErr = err
+	}
+	if iterateErr == nil || !strings.Contains(iterateErr.Error(), "Missing") {
+		t.Fatalf("expected unknown model error, got %v", iterateErr)
+	}
+}
+
+func TestRemoteTransactionOverWire(t *testing.T) {
+	ctx := context.Background()
+	db, err := zenithdb.Open(ctx, testSchema(), zenithdb.Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	listener := startWireServer(t, db, wire.Options{})
+
+	client, err := remote.OpenWithOptions(ctx, remote.OpenOptions{ConnectionURL: "zenith://" + listener.Addr().String(), PoolSize: 2})
+	if err != nil {
+		t.Fatalf("open remote client: %v", err)
+	}
+	defer client.Close()
+
+	tx, err := client.Begin(ctx)
+	if err != nil {
+		t.Fatalf("remote begin: %v", err)
+	}
+	if _, err := tx.Create(ctx, "User", zenithdb.Record{"id": "u1", "email": "ada@example.com", "name": "Ada"}); err != nil {
+		t.Fatalf("remote tx create: %v", err)
+	}
+	if _, ok, err := tx.FindUnique(ctx, "User", map[string]any{"email": "ada@example.com"}, nil, nil); err != nil || !ok {
+		t.Fatalf("remote tx should see its own write: found=%v err=%v", ok, err)
+	}
+	if _, ok, err := client.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil); err != nil || ok {
+		t.Fatalf("uncommitted remote write leaked: found=%v err=%v", ok, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("remote commit: %v", err)
+	}
+	if _, ok, err := client.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil); err != nil || !ok {
+		t.Fatalf("committed remote write missing: found=%v err=%v", ok, err)
+	}
+	if err := tx.Rollback(ctx); err == nil || !strings.Contains(err.Error(), "unknown transaction") {
+		t.Fatalf("expected finished transaction error, got %v", err)
+	}
+
+	rolledBack, err := client.Begin(ctx)
+	if err != nil {
+		t.Fatalf("remote begin: %v", err)
+	}
+	if _, err := rolledBack.Delete(ctx, "User", map[string]any{"id": "u1"}); err != nil {
+		t.Fatalf("remote tx delete: %v", err)
+	}
+	if err := rolledBack.Rollback(ctx); err != nil {
+		t.Fatalf("remote rollback: %v", err)
+	}
+	if _, ok, err := client.FindUnique(ctx, "User", map[string]any{"id": "u1"}, nil, nil); err != nil || !ok {
+		t.Fatalf("rolled back delete removed user: found=%v err=%v", ok, err)
+	}
+}
+
+func TestWireCapsSessionStreamsAndTransactions(t *testing.T) {
+	ctx := context.Background()
+	db, err := zenithdb.Open(ctx, testSchema(), zenithdb.Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	listener := startWireServer(t, db, wire.Options{MaxStreams: 1, MaxTransactions: 1, StreamIdleTimeout: 50 * time.Millisecond})
+
+	client, err := remote.OpenWithOptions(ctx, remote.OpenOptions{ConnectionURL: "zenith://" + listener.Addr().String(), PoolSize: 1})
+	if err != nil {
+		t.Fatalf("open remote client: %v", err)
+	}
+	defer client.Close()
+
+	users := make([]zenithdb.Record, 0, 300)
+	for i := 0; i < 300; i++ {
+		users = append(users, zenithdb.Record{"id": fmt.Sprintf("u%03d", i), "email": fmt.Sprintf("user%03d@example.com", i), "name": "User"})
+	}
+	if _, err := client.CreateMany(ctx, "User", users); err != nil {
+		t.Fatalf("remote create many: %v", err)
+	}
+
+	// The first stream holds more than one batch, so it stays open.
+	next, stop := iter.Pull2(client.Iterate(ctx, "User", zenithdb.Query{}))
+	if _, err, ok := next(); !ok || err != nil {
+		t.Fatalf("first stream: ok=%v err=%v", ok, err)
+	}
+	for _, err := range client.Iterate(ctx, "User", zenithdb.Query{}) {
+		if err == nil || !strings.Contains(err.Error(), "already has 1 open streams") {
+			t.Fatalf("expected a second stream to hit the cap, got %v", err)
+		}
+		break
+	}
+	stop()
+
+	tx, err := client.Begin(ctx)
+	if err != nil {
+		t.Fatalf("remote begin: %v", err)
+	}
+	if _, err := client.Begin(ctx); err == nil || !strings.Contains(err.Error(), "already has 1 open transactions") {
+		t.Fatalf("expected a second transaction to hit the cap, got %v", err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("remote rollback: %v", err)
+	}
+	if tx, err = client.Begin(ctx); err != nil {
+		t.Fatalf("expected finishing a transaction to free its slot, got %v", err)
+	}
+	_ = tx.Rollback(ctx)
+
+	// A stream the client stops reading from expires and frees its slot.
+	next, stop = iter.Pull2(client.Iterate(ctx, "User", zenithdb.Query{}))
+	defer stop()
+	if _, err, ok := next(); !ok || err != nil {
+		t.Fatalf("idle stream: ok=%v err=%v", ok, err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	var expired error
+	for i := 1; i < len(users) && expired == nil; i++ {
+		_, expired, _ = next()
+	}
+	if expired == nil || !strings.Contains(expired.Error(), "unknown stream") {
+		t.Fatalf("expected the idle stream to expire, got %v", expired)
+	}
+	count := 0
+	for _, err := range client.Iterate(ctx, "User", zenithdb.Query{}) {
+		if err != nil {
+			t.Fatalf("expected a new stream after the expired one, got %v", err)
+		}
+		count++
+	}
+	if count != len(users) {
+		t.Fatalf("expected %d streamed users, got %d", len(users), count)
+	}
+}
+
+func TestRemoteEnumValuesOverWire(t *testing.T) {
+	ctx := context.Background()
+	roles := []string{"ADMIN", "USER"}
+	schema := zenithdb.Schema{
+		Models: []zenithdb.Model{{
+			Name: "Account",
+			Fields: []zenithdb.Field{
+				{Name: "id", Kind: zenithdb.FieldString, Required: true},
+				{Name: "role", Kind: zenithdb.FieldEnum, Required: true, Enum: "Role", Values: roles},
+			},
+			PrimaryKey: []string{"id"},
+		}},
+		Enums: []zenithdb.Enum{{Name: "Role", Values: roles}},
+	}
+	db, err := zenithdb.Open(ctx, schema, zenithdb.Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	schemaHash := mustSchemaHash(t, schema)
+	listener := startWireServer(t, db, wire.Options{SchemaHash: schemaHash})
+
+	client, err := remote.OpenWithOptions(ctx, remote.OpenOptions{ConnectionURL: "zenith://" + listener.Addr().String(), SchemaHash: schemaHash})
+	if err != nil {
+		t.Fatalf("open remote client: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Create(ctx, "Account", zenithdb.Record{"id": "a1", "role": "ADMIN"}); err != nil {
+		t.Fatalf("remote create: %v", err)
+	}
+	record, ok, err := client.FindUnique(ctx, "Account", map[string]any{"id": "a1"}, nil, nil)
+	if err != nil || !ok || record["role"] != "ADMIN" {
+		t.Fatalf("expected the enum value back as a string, got %+v ok=%v err=%v", record, ok, err)
+	}
+	if _, err := client.Create(ctx, "Account", zenithdb.Record{"id": "a2", "role": "OWNER"}); err == nil || !strings.Contains(err.Error(), "expected one of ADMIN, USER") {
+		t.Fatalf("expected the server to reject a value outside the enum, got %v", err)
+	}
+}
+
+func TestRemoteCreateReturnsDefaultsOverWire(t *testing.T) {
+	ctx := context.Background()
+	schema := zenithdb.Schema{Models: []zenithdb.Model{{
+		Name: "Ticket",
+		Fields: []zenithdb.Field{
+			{Name: "id", Kind: zenithdb.FieldInt64, Required: true, Default: &zenithdb.Default{Func: zenithdb.DefaultAutoincrement}},
+			{Name: "status", Kind: zenithdb.FieldString, Required: true, Default: &zenithdb.Default{Value: "open"}},
+			{Name: "createdAt", Kind: zenithdb.FieldTime, Required: true, Default: &zenithdb.Default{Func: zenithdb.DefaultNow}},
+		},
+		PrimaryKey: []string{"id"},
+	}}}
+	db, err := zenithdb.Open(ctx, schema, zenithdb.Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	schemaHash := mustSchemaHash(t, schema)
+	listener := startWireServer(t, db, wire.Options{SchemaHash: schemaHash})
+
+	client, err := remote.OpenWithOptions(ctx, remote.OpenOptions{ConnectionURL: "zenith://" + listener.Addr().String(), SchemaHash: schemaHash})
+	if err != nil {
+		t.Fatalf("open remote client: %v", err)
+	}
+	defer client.Close()
+
+	created, err := client.Create(ctx, "Ticket", zenithdb.Record{})
+	if err != nil {
+		t.Fatalf("remote create: %v", err)
+	}
+	if created.Record["id"] != int64(1) || created.Record["status"] != "open" {
+		t.Fatalf("expected the created record with its defaults, got %+v", created.Record)
+	}
+	if createdAt, ok := created.Record["createdAt"].(time.Time); !ok || createdAt.IsZero() {
+		t.Fatalf("expected createdAt to be stamped, got %+v", created.Record["createdAt"])
+	}
+	bulkCreated, err := client.CreateMany(ctx, "Ticket", []zenithdb.Record{{}, {"status": "closed"}})
+	if err != nil {
+		t.Fatalf("remote create many: %v", err)
+	}
+	if len(bulkCreated) != 2 || bulkCreated[0].Record["id"] != int64(2) || bulkCreated[1].Record["status"] != "closed" {
+		t.Fatalf("unexpected remote create many results: %+v", bulkCreated)
+	}
+
+	tx, err := client.Begin(ctx)
+	if err != nil {
+		t.Fatalf("remote begin: %v", err)
+	}
+	staged, err := tx.Create(ctx, "Ticket", zenithdb.Record{})
+	if err != nil || staged.Record["id"] != int64(4) {
+		t.Fatalf("expected the remote tx create to return its record, got %+v err=%v", staged.Record, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("remote commit: %v", err)
+	}
+	if _, ok, err := client.FindUnique(ctx, "Ticket", map[string]any{"id": 4}, nil, nil); err != nil || !ok {
+		t.Fatalf("expected the committed ticket, found=%v err=%v", ok, err)
+	}
+}
+
+func TestRemoteJSONAndBytesRoundTripOverWire(t *testing.T) {
+	ctx := context.Background()
+	schema := zenithdb.Schema{Models: []zenithdb.Model{{
+		Name: "Asset",
+		Fields: []zenithdb.Field{
+			{Name: "id", Kind: zenithdb.FieldString, Required: true},
+			{Name: "meta", Kind: zenithdb.FieldJSON},
+			{Name: "digest", Kind: zenithdb.FieldBytes, Required: true},
+		},
+		PrimaryKey: []string{"id"},
+	}}}
+	db, err := zenithdb.Open(ctx, schema, zenithdb.Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	schemaHash := mustSchemaHash(t, schema)
+	listener := startWireServer(t, db, wire.Options{SchemaHash: schemaHash})
+
+	client, err := remote.OpenWithOptions(ctx, remote.OpenOptions{ConnectionURL: "zenith://" + listener.Addr().String(), SchemaHash: schemaHash})
+	if err != nil {
+		t.Fatalf("open remote client: %v", err)
+	}
+	defer client.Close()
+
+	meta := map[string]any{"size": int64(3), "tags": []any{"red", 1.5, nil}}
+	if _, err := client.Create(ctx, "Asset", zenithdb.Record{"id": "a1", "meta": json.RawMessage(`{"size": 3, "tags": ["red", 1.5, null]}`), "digest": []byte{0, 1, 2}}); err != nil {
+		t.Fatalf("remote create: %v", err)
+	}
+	if _, err := client.Create(ctx, "Asset", zenithdb.Record{"id": "a2", "meta": map[string]any{"tags": []any{"blue"}}, "digest": []byte{9}}); err != nil {
+		t.Fatalf("remote create: %v", err)
+	}
+	found, ok, err := client.FindUnique(ctx, "Asset", map[string]any{"id": "a1"}, nil, nil)
+	if err != nil || !ok || !reflect.DeepEqual(found["meta"], meta) || !bytes.Equal(found["digest"].([]byte), []byte{0, 1, 2}) {
+		t.Fatalf("expected a1 with its JSON and bytes, got %+v ok=%v err=%v", found, ok, err)
+	}
+	records, err := client.FindMany(ctx, "Asset", zenithdb.Query{Filters: map[string]zenithdb.Filter{
+		"meta": {Path: []string{"tags"}, ArrayContains: []any{"red"}},
+	}})
+	if err != nil || len(records) != 1 || records[0]["id"] != "a1" {
+		t.Fatalf("expected the array contains filter to match a1 remotely, got %+v err=%v", records, err)
+	}
+	records, err = client.FindMany(ctx, "Asset", zenithdb.Query{Where: map[string]any{"digest": []byte{9}}})
+	if err != nil || len(records) != 1 || records[0]["id"] != "a2" {
+		t.Fatalf("expected a where on bytes to match a2 remotely, got %+v err=%v", records, err)
+	}
+}
+
+func TestRemoteScalarListsFilterAndPushOverWire(t *testing.T) {
+	ctx := context.Background()
+	schema := zenithdb.Schema{Models: []zenithdb.Model{{
+		Name: "Article",
+		Fields: []zenithdb.Field{
+			{Name: "id", Kind: zenithdb.FieldString, Required: true},
+			{Name: "tags", Kind: zenithdb.FieldString, List: true},
+		},
+		PrimaryKey: []string{"id"},
+		Indexes:    []zenithdb.Index{{Name: "article_tags", Fields: []string{"tags"}}},
+	}}}
+	db, err := zenithdb.Open(ctx, schema, zenithdb.Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	schemaHash := mustSchemaHash(t, schema)
+	listener := startWireServer(t, db, wire.Options{SchemaHash: schemaHash})
+
+	client, err := remote.OpenWithOptions(ctx, remote.OpenOptions{ConnectionURL: "zenith://" + listener.Addr().String(), SchemaHash: schemaHash})
+	if err != nil {
+		t.Fatalf("open remote client: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Create(ctx, "Article", zenithdb.Record{"id": "a1", "tags": []string{"go", "db"}}); err != nil {
+		t.Fatalf("remote create: %v", err)
+	}
+	if _, err := client.Create(ctx, "Article", zenithdb.Record{"id": "a2", "tags": []any{}}); err != nil {
+		t.Fatalf("remote create: %v", err)
+	}
+	updated, err := client.Update(ctx, "Article", map[string]any{"id": "a2"}, zenithdb.Record{"tags": zenithdb.ListUpdate{Set: []any{}, Push: []any{"rust"}}})
+	if err != nil || !reflect.DeepEqual(updated["tags"], []any{"rust"}) {
+		t.Fatalf("expected a remote push to a2, got %+v err=%v", updated, err)
+	}
+	empty := false
+	for _, tc := range []struct {
+		name   string
+		filter zenithdb.Filter
+		want   int
+	}{
+		{"has", zenithdb.Filter{Has: "rust"}, 1},
+		{"has some", zenithdb.Filter{HasSome: []any{"db", "rust"}}, 2},
+		{"has every", zenithdb.Filter{HasEvery: []any{"db", "go"}}, 1},
+		{"is empty", zenithdb.Filter{IsEmpty: &empty}, 2},
+	} {
+		records, err := client.FindMany(ctx, "Article", zenithdb.Query{Filters: map[string]zenithdb.Filter{"tags": tc.filter}})
+		if err != nil || len(records) != tc.want {
+			t.Fatalf("%s: expected %d records remotely, got %+v err=%v", tc.name, tc.want, records, err)
+		}
+	}
+}
+
+func TestRemoteNullFiltersOverWire(t *testing.T) {
+	ctx := context.Background()
+	schema := zenithdb.Schema{Models: []zenithdb.Model{{
+		Name: "Member",
+		Fields: []zenithdb.Field{
+			{Name: "id", Kind: zenithdb.FieldString, Required: true},
+			{Name: "city", Kind: zenithdb.FieldString},
+		},
+		PrimaryKey: []string{"id"},
+	}}}
+	db, err := zenithdb.Open(ctx, schema, zenithdb.Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	schemaHash := mustSchemaHash(t, schema)
+	listener := startWireServer(t, db, wire.Options{SchemaHash: schemaHash})
+
+	client, err := remote.OpenWithOptions(ctx, remote.OpenOptions{ConnectionURL: "zenith://" + listener.Addr().String(), SchemaHash: schemaHash})
+	if err != nil {
+		t.Fatalf("open remote client: %v", err)
+	}
+	defer client.Close()
+
+	for _, record := range []zenithdb.Record{{"id": "m1", "city": "Oslo"}, {"id": "m2", "city": nil}, {"id": "m3"}} {
+		if _, err := client.Create(ctx, "Member", record); err != nil {
+			t.Fatalf("remote create: %v", err)
+		}
+	}
+	for _, tc := range []struct {
+		name   string
+		filter zenithdb.Filter
+		want   int
+	}{
+		{"is null", zenithdb.Filter{IsNull: true}, 2},
+		{"is not null", zenithdb.Filter{IsNotNull: true}, 1},
+	} {
+		records, err := client.FindMany(ctx, "Member", zenithdb.Query{Filters: map[string]zenithdb.Filter{"city": tc.filter}})
+		if err != nil || len(records) != tc.want {
+			t.Fatalf("%s: expected %d records remotely, got %+v err=%v", tc.name, tc.want, records, err)
+		}
+	}
+
+	ordered, err := client.FindMany(ctx, "Member", zenithdb.Query{OrderBy: []zenithdb.OrderBy{{Field: "city", Nulls: zenithdb.NullsLast}, {Field: "id"}}})
+	if err != nil || len(ordered) != 3 || ordered[0]["id"] != "m1" || ordered[2]["id"] != "m3" {
+		t.Fatalf("expected nulls last to order m1 first remotely, got %+v err=%v", ordered, err)
+	}
+	groups, err := client.GroupBy(ctx, "Member", zenithdb.GroupByQuery{By: []string{"city"}, OrderBy: []zenithdb.GroupOrderBy{{Field: "city", Direction: zenithdb.SortDesc, Nulls: zenithdb.NullsFirst}}})
+	if err != nil || len(groups) != 2 || groups[0].Key["city"] != nil {
+		t.Fatalf("expected the null city group first remotely, got %+v err=%v", groups, err)
+	}
+}
+
+func TestRemoteValidationErrorsOverWire(t *testing.T) {
+	ctx := context.Background()
+	schema := zenithdb.Schema{Models: []zenithdb.Model{{
+		Name: "Account",
+		Fields: []zenithdb.Field{
+			{Name: "id", Kind: zenithdb.FieldString, Required: true},
+			{Name: "email", Kind: zenithdb.FieldString, Required: true, Validations: []zenithdb.Validation{{Rule: zenithdb.RuleEmail}}},
+		},
+		PrimaryKey: []string{"id"},
+	}}}
+	db, err := zenithdb.Open(ctx, schema, zenithdb.Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	schemaHash := mustSchemaHash(t, schema)
+	listener := startWireServer(t, db, wire.Options{SchemaHash: schemaHash})
+
+	client, err := remote.OpenWithOptions(ctx, remote.OpenOptions{ConnectionURL: "zenith://" + listener.Addr().String(), SchemaHash: schemaHash})
+	if err != nil {
+		t.Fatalf("open remote client: %v", err)
+	}
+	defer client.Close()
+
+	_, err = client.Create(ctx, "Account", zenithdb.Record{"id": "a1", "email": "not an email"})
+	var validation *zenithdb.ValidationError
+	if !errors.As(err, &validation) || validation.Model != "Account" || validation.Field != "email" || validation.Rule != zenithdb.RuleEmail {
+		t.Fatalf("expected a remote email validation error, got %v", err)
+	}
+	if err.Error() != `model "Account" field "email" fails email: must be an email address` {
+		t.Fatalf("unexpected remote error message %q", err.Error())
+	}
+	_, err = client.Batch(ctx, []zenithdb.BatchOperation{{Type: zenithdb.BatchCreate, Model: "Account", Record: zenithdb.Record{"id": "a1", "email": "ada"}}})
+	if !errors.As(err, &validation) || validation.Field != "email" {
+		t.Fatalf("expected a remote batch validation error, got %v", err)
+	}
+	if _, err := client.Create(ctx, "Account", zenithdb.Record{"id": "a1", "email": "ada@example.com"}); err != nil {
+		t.Fatalf("remote create: %v", err)
+	}
+	if _, err := client.Create(ctx, "Account", zenithdb.Record{"id": "a1", "email": "ada@example.com"}); err == nil || errors.As(err, &validation) {
+		t.Fatalf("expected a duplicate key to fail without a validation error, got %v", err)
+	}
+}
+
 func TestRemoteSchemaPullAndValidateOverWire(t *testing.T) {
 	ctx := context.Background()
 	schemaSource := `model User {
@@ -270,6 +899,36 @@ func TestWireRejectsSchemaHashMismatch(t *testing.T) {
 	}
 }
 
+func TestWireRejectsMismatchedProtocolVersion(t *testing.T) {
+	ctx := context.Background()
+	db, err := zenithdb.Open(ctx, testSchema(), zenithdb.Options{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	listener := startWireServer(t, db, wire.Options{})
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	// A version 1 handshake: the magic, the version, and empty token and
+	// schema hash strings.
+	handshake := append([]byte("ZDBW1"), 0, 1, 0, 0, 0, 0, 0, 0, 0, 0)
+	if _, err := conn.Write(handshake); err != nil {
+		t.Fatalf("write handshake: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read handshake response: %v", err)
+	}
+	if !bytes.Contains(response, []byte("unsupported wire protocol version 1")) {
+		t.Fatalf("expected the server to reject version 1, got %q", response)
+	}
+}
+
 func startWireServer(t *testing.T, db *zenithdb.DB, options wire.Options) net.Listener {
 	t.Helper()
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
@@ -300,6 +959,9 @@ func testSchema() zenithdb.Schema {
 				Indexes: []zenithdb.Index{
 					{Name: "user_email_unique", Fields: []string{"email"}, Unique: true},
 				},
+				Relations: []zenithdb.Relation{
+					{Name: "posts", Model: "Post", Fields: []string{"id"}, References: []string{"authorId"}, Many: true},
+				},
 			},
 			{
 				Name: "Post",
@@ -312,6 +974,9 @@ func testSchema() zenithdb.Schema {
 				Indexes: []zenithdb.Index{
 					{Name: "post_author", Fields: []string{"authorId"}},
 				},
+				Relations: []zenithdb.Relation{
+					{Name: "author", Model: "User", Fields: []string{"authorId"}, References: []string{"id"}, ForeignKey: true},
+				},
 			},
 		},
 	}
@@ -0,0 +1,2830 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	zenithdb "github.com/bypepe77/ZenithDB/pkg/zenithdb"
+	remote "github.com/bypepe77/ZenithDB/pkg/zenithdb/remote"
+	"iter"
+)
+
+var Schema = zenithdb.Schema{
+	Models: []zenithdb.Model{
+		{
+			Name: "Tenant",
+			Fields: []zenithdb.Field{
+				{Name: "id", Kind: zenithdb.FieldString, Required: true},
+				{Name: "name", Kind: zenithdb.FieldString, Required: true},
+			},
+			PrimaryKey: []string{"id"},
+			Indexes:    []zenithdb.Index{},
+			Relations: []zenithdb.Relation{
+				{Name: "memberships", Model: "Membership", Fields: []string{"id"}, References: []string{"tenantId"}, Many: true, ForeignKey: false},
+			},
+		},
+		{
+			Name: "Membership",
+			Fields: []zenithdb.Field{
+				{Name: "tenantId", Kind: zenithdb.FieldString, Required: true},
+				{Name: "userId", Kind: zenithdb.FieldString, Required: true},
+				{Name: "role", Kind: zenithdb.FieldString, Required: true},
+			},
+			PrimaryKey: []string{"tenantId", "userId"},
+			Indexes: []zenithdb.Index{
+				{Name: "membership_tenantid_idx", Fields: []string{"tenantId"}, Unique: false},
+			},
+			Relations: []zenithdb.Relation{
+				{Name: "tenant", Model: "Tenant", Fields: []string{"tenantId"}, References: []string{"id"}, Many: false, ForeignKey: true, OnDelete: zenithdb.ActionCascade},
+				{Name: "grants", Model: "Grant", Fields: []string{"tenantId", "userId"}, References: []string{"tenantId", "userId"}, Many: true, ForeignKey: false},
+			},
+		},
+		{
+			Name: "Grant",
+			Fields: []zenithdb.Field{
+				{Name: "id", Kind: zenithdb.FieldString, Required: true},
+				{Name: "tenantId", Kind: zenithdb.FieldString, Required: true},
+				{Name: "userId", Kind: zenithdb.FieldString, Required: true},
+				{Name: "scope", Kind: zenithdb.FieldString, Required: true},
+			},
+			PrimaryKey: []string{"id"},
+			Indexes: []zenithdb.Index{
+				{Name: "grant_tenantid_userid_idx", Fields: []string{"tenantId", "userId"}, Unique: false},
+			},
+			Relations: []zenithdb.Relation{
+				{Name: "membership", Model: "Membership", Fields: []string{"tenantId", "userId"}, References: []string{"tenantId", "userId"}, Many: false, ForeignKey: true, OnDelete: zenithdb.ActionCascade, OnUpdate: zenithdb.ActionCascade},
+			},
+		},
+	},
+}
+
+type engine interface {
+	Create(context.Context, string, zenithdb.Record) (zenithdb.MutationResult, error)
+	CreateMany(context.Context, string, []zenithdb.Record) ([]zenithdb.MutationResult, error)
+	Update(context.Context, string, map[string]any, zenithdb.Record) (zenithdb.Record, error)
+	UpdateMany(context.Context, string, zenithdb.Query, zenithdb.Record) (zenithdb.ManyResult, error)
+	Delete(context.Context, string, map[string]any) (zenithdb.Record, error)
+	DeleteMany(context.Context, string, zenithdb.Query) (zenithdb.ManyResult, error)
+	Upsert(context.Context, string, map[string]any, zenithdb.Record, zenithdb.Record) (zenithdb.Record, bool, error)
+	Batch(context.Context, []zenithdb.BatchOperation) ([]zenithdb.BatchResult, error)
+	FindUnique(context.Context, string, map[string]any, map[string]zenithdb.Include, []string) (zenithdb.Record, bool, error)
+	FindMany(context.Context, string, zenithdb.Query) ([]zenithdb.Record, error)
+	Iterate(context.Context, string, zenithdb.Query) iter.Seq2[zenithdb.Record, error]
+	Count(context.Context, string, zenithdb.Query) (int, error)
+	Aggregate(context.Context, string, zenithdb.AggregateQuery) (zenithdb.AggregateResult, error)
+	GroupBy(context.Context, string, zenithdb.GroupByQuery) ([]zenithdb.Group, error)
+	Close() error
+}
+
+type Client struct {
+	db              engine
+	remote          bool
+	tenantStore     *tenantStore
+	Tenant          TenantClient
+	membershipStore *membershipStore
+	Membership      MembershipClient
+	grantStore      *grantStore
+	Grant           GrantClient
+}
+
+func Open(ctx context.Context, options zenithdb.Options) (*Client, error) {
+	db, err := zenithdb.Open(ctx, Schema, options)
+	if err != nil {
+		return nil, err
+	}
+	return newClientFromEngine(ctx, db, true, false)
+}
+
+func OpenURL(ctx context.Context, connectionURL string) (*Client, error) {
+	options, err := zenithdb.ParseConnectionURL(connectionURL)
+	if err != nil {
+		return nil, err
+	}
+	if options.WireURL != "" {
+		schemaHash, err := Schema.Hash()
+		if err != nil {
+			return nil, err
+		}
+		db, err := remote.OpenWithOptions(ctx, remote.OpenOptions{ConnectionURL: connectionURL, SchemaHash: schemaHash})
+		if err != nil {
+			return nil, err
+		}
+		return newClientFromEngine(ctx, db, false, true)
+	}
+	return Open(ctx, zenithdb.Options{ConnectionURL: connectionURL})
+}
+
+func (c *Client) Close() error {
+	return c.db.Close()
+}
+
+func (c *Client) Batch(ctx context.Context, operations []zenithdb.BatchOperation) ([]zenithdb.BatchResult, error) {
+	return c.db.Batch(ctx, operations)
+}
+
+// recordValue returns the value of field, or the zero value when the record
+// does not hold it, as when a select left it out.
+func recordValue[T any](record zenithdb.Record, field string) T {
+	value, _ := record[field].(T)
+	return value
+}
+
+func newClientFromEngine(ctx context.Context, db engine, preload bool, remote bool) (*Client, error) {
+	client := &Client{db: db, remote: remote}
+	client.tenantStore = newTenantStore()
+	client.membershipStore = newMembershipStore()
+	client.grantStore = newGrantStore()
+	if preload {
+		if err := client.loadTenant(ctx); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		if err := client.loadMembership(ctx); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		if err := client.loadGrant(ctx); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		if local, ok := db.(*zenithdb.DB); ok {
+			local.OnChange(client.apply)
+		}
+	}
+	client.Tenant = TenantClient{client: client}
+	client.Membership = MembershipClient{client: client}
+	client.Grant = GrantClient{client: client}
+	return client, nil
+}
+
+func (c *Client) loadTenant(ctx context.Context) error {
+	records, err := c.db.FindMany(ctx, "Tenant", zenithdb.Query{})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		c.tenantStore.put(recordToTenant(record))
+	}
+	return nil
+}
+
+func (c *Client) loadMembership(ctx context.Context) error {
+	records, err := c.db.FindMany(ctx, "Membership", zenithdb.Query{})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		c.membershipStore.put(recordToMembership(record))
+	}
+	return nil
+}
+
+func (c *Client) loadGrant(ctx context.Context) error {
+	records, err := c.db.FindMany(ctx, "Grant", zenithdb.Query{})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		c.grantStore.put(recordToGrant(record))
+	}
+	return nil
+}
+
+// apply updates the stores with the changes of one committed write, which
+// include the records its nested writes and referential actions changed. It
+// removes every replaced record before storing the new versions, so a unique
+// value that moves between records stays indexed.
+func (c *Client) apply(changes []zenithdb.Change) {
+	for _, change := range changes {
+		if change.Before == nil {
+			continue
+		}
+		switch change.Model {
+		case "Tenant":
+			c.tenantStore.remove(recordToTenant(change.Before))
+		case "Membership":
+			c.membershipStore.remove(recordToMembership(change.Before))
+		case "Grant":
+			c.grantStore.remove(recordToGrant(change.Before))
+		}
+	}
+	for _, change := range changes {
+		if change.After == nil {
+			continue
+		}
+		switch change.Model {
+		case "Tenant":
+			c.tenantStore.put(recordToTenant(change.After))
+		case "Membership":
+			c.membershipStore.put(recordToMembership(change.After))
+		case "Grant":
+			c.grantStore.put(recordToGrant(change.After))
+		}
+	}
+}
+
+func (c *Client) includeTenant(record *Tenant, include *TenantInclude) {
+	if include == nil {
+		return
+	}
+	if include.Memberships {
+		record.Memberships = c.membershipStore.findManyByTenantID(record.ID, 0)
+	}
+}
+
+func (c *Client) includeMembership(record *Membership, include *MembershipInclude) {
+	if include == nil {
+		return
+	}
+	if include.Tenant {
+		related, ok := c.tenantStore.findByID(record.TenantID)
+		if ok {
+			record.Tenant = &related
+		}
+	}
+	if include.Grants {
+		record.Grants = c.grantStore.findManyByTenantIDUserID(GrantTenantIDUserIDKey{TenantID: record.TenantID, UserID: record.UserID}, 0)
+	}
+}
+
+func (c *Client) includeGrant(record *Grant, include *GrantInclude) {
+	if include == nil {
+		return
+	}
+	if include.Membership {
+		related, ok := c.membershipStore.findByTenantIDUserID(MembershipTenantIDUserIDKey{TenantID: record.TenantID, UserID: record.UserID})
+		if ok {
+			record.Membership = &related
+		}
+	}
+}
+
+type engineTx interface {
+	Create(context.Context, string, zenithdb.Record) (zenithdb.MutationResult, error)
+	Update(context.Context, string, map[string]any, zenithdb.Record) (zenithdb.Record, error)
+	Delete(context.Context, string, map[string]any) (zenithdb.Record, error)
+	Upsert(context.Context, string, map[string]any, zenithdb.Record, zenithdb.Record) (zenithdb.Record, bool, error)
+	FindUnique(context.Context, string, map[string]any, map[string]zenithdb.Include, []string) (zenithdb.Record, bool, error)
+	FindMany(context.Context, string, zenithdb.Query) ([]zenithdb.Record, error)
+	Commit(context.Context) error
+	Rollback(context.Context) error
+}
+
+// Tx exposes the model clients inside an interactive transaction.
+type Tx struct {
+	tx         engineTx
+	Tenant     TenantTxClient
+	Membership MembershipTxClient
+	Grant      GrantTxClient
+}
+
+func (c *Client) begin(ctx context.Context) (engineTx, error) {
+	switch db := c.db.(type) {
+	case *zenithdb.DB:
+		return db.Begin(ctx)
+	case *remote.Client:
+		return db.Begin(ctx)
+	default:
+		return nil, errors.New("engine does not support transactions")
+	}
+}
+
+// Transaction runs fn in an interactive transaction. The transaction commits
+// when fn returns nil and rolls back otherwise.
+func (c *Client) Transaction(ctx context.Context, fn func(tx *Tx) error) error {
+	engineTx, err := c.begin(ctx)
+	if err != nil {
+		return err
+	}
+	tx := &Tx{tx: engineTx}
+	tx.Tenant = TenantTxClient{tx: tx}
+	tx.Membership = MembershipTxClient{tx: tx}
+	tx.Grant = GrantTxClient{tx: tx}
+	if err := fn(tx); err != nil {
+		_ = engineTx.Rollback(ctx)
+		return err
+	}
+	return engineTx.Commit(ctx)
+}
+
+type Tenant struct {
+	ID            string               `json:"id"`
+	Name          string               `json:"name"`
+	Memberships   []Membership         `json:"memberships"`
+	RelationCount *TenantRelationCount `json:"_count"`
+}
+
+type TenantRelationCount struct {
+	Memberships int64 `json:"memberships"`
+}
+
+type TenantRelationCountSelect struct {
+	Memberships bool
+}
+
+func (input *TenantRelationCountSelect) fields() []string {
+	var fields []string
+	if input.Memberships {
+		fields = append(fields, "memberships")
+	}
+	return fields
+}
+
+type TenantCreateInput struct {
+	ID          string
+	Name        string
+	Memberships *MembershipCreateNestedManyInput
+}
+
+type TenantUpdateInput struct {
+	Name        *string
+	Memberships *MembershipUpdateNestedManyInput
+}
+
+func (input TenantCreateInput) record() zenithdb.Record {
+	record := zenithdb.Record{
+		"id":   input.ID,
+		"name": input.Name,
+	}
+	if input.Memberships != nil {
+		record["memberships"] = input.Memberships.write()
+	}
+	return record
+}
+
+// nested reports whether the input writes related records.
+func (input TenantCreateInput) nested() bool {
+	return input.Memberships != nil
+}
+
+// nested reports whether the input writes related records.
+func (input TenantUpdateInput) nested() bool {
+	return input.Memberships != nil
+}
+
+func (input TenantUpdateInput) record() zenithdb.Record {
+	record := zenithdb.Record{}
+	if input.Name != nil {
+		record["name"] = *input.Name
+	}
+	if input.Memberships != nil {
+		record["memberships"] = input.Memberships.write()
+	}
+	return record
+}
+
+// Validate checks the fields the input sets against their validation rules.
+func (input TenantCreateInput) Validate() error {
+	return nil
+}
+
+// Validate checks the fields the input sets against their validation rules.
+func (input TenantUpdateInput) Validate() error {
+	return nil
+}
+
+type TenantWhereUniqueInput struct {
+	ID string
+}
+
+func (input TenantWhereUniqueInput) where() map[string]any {
+	if input.ID != "" {
+		return map[string]any{"id": input.ID}
+	}
+	return nil
+}
+
+type TenantWhereInput struct {
+	ID          *string
+	Name        *string
+	Memberships *MembershipListRelationFilter
+	AND         []TenantWhereInput
+	OR          []TenantWhereInput
+	NOT         *TenantWhereInput
+}
+
+func (input TenantWhereInput) where() map[string]any {
+	where := make(map[string]any)
+	if input.ID != nil {
+		where["id"] = *input.ID
+	}
+	if input.Name != nil {
+		where["name"] = *input.Name
+	}
+	return where
+}
+
+func (input TenantWhereInput) filterExpr() *zenithdb.FilterExpr {
+	if len(input.AND) == 0 && len(input.OR) == 0 && input.NOT == nil && input.Memberships == nil {
+		return nil
+	}
+	expr := &zenithdb.FilterExpr{}
+	if input.Memberships != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Relation: "memberships", RelationFilter: input.Memberships.filter()})
+	}
+	for _, child := range input.AND {
+		expr.And = append(expr.And, child.expr())
+	}
+	for _, child := range input.OR {
+		expr.Or = append(expr.Or, child.expr())
+	}
+	if input.NOT != nil {
+		not := input.NOT.expr()
+		expr.Not = &not
+	}
+	return expr
+}
+
+func (input TenantWhereInput) expr() zenithdb.FilterExpr {
+	expr := zenithdb.FilterExpr{}
+	if input.ID != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "id", Filter: zenithdb.Filter{Equals: *input.ID}})
+	}
+	if input.Name != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "name", Filter: zenithdb.Filter{Equals: *input.Name}})
+	}
+	if nested := input.filterExpr(); nested != nil {
+		expr.And = append(expr.And, *nested)
+	}
+	return expr
+}
+
+func (input *TenantWhereInput) relationExpr() *zenithdb.FilterExpr {
+	if input == nil {
+		return nil
+	}
+	expr := input.expr()
+	return &expr
+}
+
+type TenantRelationFilter struct {
+	Is    *TenantWhereInput
+	IsNot *TenantWhereInput
+}
+
+func (input TenantRelationFilter) filter() zenithdb.RelationFilter {
+	return zenithdb.RelationFilter{Is: input.Is.relationExpr(), IsNot: input.IsNot.relationExpr()}
+}
+
+func (input TenantWhereInput) index() string {
+	return ""
+}
+
+type TenantInclude struct {
+	Memberships       bool
+	MembershipsArgs   *MembershipFindManyArgs
+	RelationCount     bool
+	RelationCountArgs *TenantRelationCountSelect
+}
+
+func (input *TenantInclude) include() map[string]zenithdb.Include {
+	if input == nil {
+		return nil
+	}
+	include := make(map[string]zenithdb.Include)
+	if input.MembershipsArgs != nil {
+		include["memberships"] = zenithdb.Include{Query: input.MembershipsArgs.query()}
+	} else if input.Memberships {
+		include["memberships"] = zenithdb.Include{}
+	}
+	if input.RelationCountArgs != nil {
+		include[zenithdb.CountField] = zenithdb.Include{Query: zenithdb.Query{Select: input.RelationCountArgs.fields()}}
+	} else if input.RelationCount {
+		include[zenithdb.CountField] = zenithdb.Include{}
+	}
+	return include
+}
+
+func (input *TenantInclude) narrowed() bool {
+	if input == nil {
+		return false
+	}
+	return input.MembershipsArgs != nil || input.RelationCount || input.RelationCountArgs != nil
+}
+
+type TenantIncludeArgs struct {
+	Select  *TenantSelect
+	Include *TenantInclude
+}
+
+func (input *TenantIncludeArgs) query() zenithdb.Query {
+	return zenithdb.Query{Include: input.Include.include(), Select: input.Select.fields()}
+}
+
+type TenantSelect struct {
+	ID          bool
+	Name        bool
+	Memberships bool
+}
+
+func (input *TenantSelect) fields() []string {
+	if input == nil {
+		return nil
+	}
+	var fields []string
+	if input.ID {
+		fields = append(fields, "id")
+	}
+	if input.Name {
+		fields = append(fields, "name")
+	}
+	if input.Memberships {
+		fields = append(fields, "memberships")
+	}
+	return fields
+}
+
+type TenantFindUniqueArgs struct {
+	Where   TenantWhereUniqueInput
+	Include *TenantInclude
+	Select  *TenantSelect
+}
+
+type TenantFindManyArgs struct {
+	Where   TenantWhereInput
+	Filters map[string]zenithdb.Filter
+	OrderBy []zenithdb.OrderBy
+	Cursor  TenantWhereUniqueInput
+	Include *TenantInclude
+	Select  *TenantSelect
+	Skip    int
+	Take    int
+}
+
+func (args TenantFindManyArgs) query() zenithdb.Query {
+	return zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Include: args.Include.include(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy, Select: args.Select.fields()}
+}
+
+type TenantAggregateArgs struct {
+	Where    TenantWhereInput
+	Filters  map[string]zenithdb.Filter
+	OrderBy  []zenithdb.OrderBy
+	Cursor   TenantWhereUniqueInput
+	Skip     int
+	Take     int
+	CountAll bool
+	Count    []string
+	Sum      []string
+	Avg      []string
+	Min      []string
+	Max      []string
+}
+
+type TenantGroupByArgs struct {
+	By       []string
+	Where    TenantWhereInput
+	Filters  map[string]zenithdb.Filter
+	CountAll bool
+	Count    []string
+	Sum      []string
+	Avg      []string
+	Min      []string
+	Max      []string
+	Having   []zenithdb.Having
+	OrderBy  []zenithdb.GroupOrderBy
+	Skip     int
+	Take     int
+}
+
+type TenantUpdateManyArgs struct {
+	Where   TenantWhereInput
+	Filters map[string]zenithdb.Filter
+	Data    TenantUpdateInput
+	Take    int
+}
+
+type TenantDeleteManyArgs struct {
+	Where   TenantWhereInput
+	Filters map[string]zenithdb.Filter
+	Take    int
+}
+
+type TenantUpdateArgs struct {
+	Where   TenantWhereUniqueInput
+	Data    TenantUpdateInput
+	Include *TenantInclude
+}
+
+type TenantUpsertArgs struct {
+	Where   TenantWhereUniqueInput
+	Create  TenantCreateInput
+	Update  TenantUpdateInput
+	Include *TenantInclude
+}
+
+type TenantDeleteArgs struct {
+	Where   TenantWhereUniqueInput
+	Include *TenantInclude
+}
+
+type TenantCreateOrConnectInput struct {
+	Where  TenantWhereUniqueInput
+	Create TenantCreateInput
+}
+
+func (input TenantCreateOrConnectInput) write() zenithdb.ConnectOrCreate {
+	return zenithdb.ConnectOrCreate{Where: input.Where.where(), Create: input.Create.record()}
+}
+
+type TenantCreateNestedOneInput struct {
+	Create          *TenantCreateInput
+	Connect         *TenantWhereUniqueInput
+	ConnectOrCreate *TenantCreateOrConnectInput
+}
+
+func (input *TenantCreateNestedOneInput) write() zenithdb.NestedWrite {
+	var write zenithdb.NestedWrite
+	if input.Create != nil {
+		write.Create = []zenithdb.Record{input.Create.record()}
+	}
+	if input.Connect != nil {
+		write.Connect = []map[string]any{input.Connect.where()}
+	}
+	if input.ConnectOrCreate != nil {
+		write.ConnectOrCreate = []zenithdb.ConnectOrCreate{input.ConnectOrCreate.write()}
+	}
+	return write
+}
+
+type TenantUpdateNestedOneInput struct {
+	Create          *TenantCreateInput
+	Connect         *TenantWhereUniqueInput
+	ConnectOrCreate *TenantCreateOrConnectInput
+	Disconnect      bool
+	Update          *TenantUpdateInput
+	Delete          bool
+}
+
+func (input *TenantUpdateNestedOneInput) write() zenithdb.NestedWrite {
+	write := (&TenantCreateNestedOneInput{Create: input.Create, Connect: input.Connect, ConnectOrCreate: input.ConnectOrCreate}).write()
+	if input.Disconnect {
+		write.Disconnect = []map[string]any{nil}
+	}
+	if input.Update != nil {
+		write.Update = []zenithdb.NestedUpdate{{Data: input.Update.record()}}
+	}
+	if input.Delete {
+		write.Delete = []map[string]any{nil}
+	}
+	return write
+}
+
+func recordToTenant(record zenithdb.Record) Tenant {
+	result := Tenant{
+		ID:   recordValue[string](record, "id"),
+		Name: recordValue[string](record, "name"),
+	}
+	if raw, ok := record["memberships"].([]zenithdb.Record); ok {
+		result.Memberships = make([]Membership, 0, len(raw))
+		for _, item := range raw {
+			converted := recordToMembership(item)
+			result.Memberships = append(result.Memberships, converted)
+		}
+	}
+	if raw, ok := record[zenithdb.CountField].(zenithdb.Record); ok {
+		result.RelationCount = &TenantRelationCount{
+			Memberships: recordValue[int64](raw, "memberships"),
+		}
+	}
+	return result
+}
+
+type tenantStore struct {
+	byID map[string]Tenant
+}
+
+func newTenantStore() *tenantStore {
+	return &tenantStore{
+		byID: make(map[string]Tenant),
+	}
+}
+
+func (s *tenantStore) put(record Tenant) {
+	s.byID[record.ID] = record
+}
+
+func (s *tenantStore) remove(record Tenant) {
+	delete(s.byID, record.ID)
+}
+
+func (s *tenantStore) replace(previous Tenant, next Tenant) {
+	s.remove(previous)
+	s.put(next)
+}
+
+func (s *tenantStore) findByID(value string) (Tenant, bool) {
+	record, ok := s.byID[value]
+	return record, ok
+}
+
+type TenantClient struct {
+	client *Client
+}
+
+func (c TenantClient) Create(ctx context.Context, input TenantCreateInput) (Tenant, error) {
+	created, err := c.client.db.Create(ctx, "Tenant", input.record())
+	if err != nil {
+		return Tenant{}, err
+	}
+	record := recordToTenant(created.Record)
+	if input.nested() {
+		stored, _, err := c.client.db.FindUnique(ctx, "Tenant", map[string]any{"id": record.ID}, nil, nil)
+		if err != nil {
+			return Tenant{}, err
+		}
+		return recordToTenant(stored), nil
+	}
+	return record, nil
+}
+
+func (c TenantClient) CreateMany(ctx context.Context, inputs []TenantCreateInput) ([]Tenant, error) {
+	records := make([]zenithdb.Record, 0, len(inputs))
+	for _, input := range inputs {
+		records = append(records, input.record())
+	}
+	created, err := c.client.db.CreateMany(ctx, "Tenant", records)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Tenant, 0, len(inputs))
+	for i, input := range inputs {
+		record := recordToTenant(created[i].Record)
+		if input.nested() {
+			stored, _, err := c.client.db.FindUnique(ctx, "Tenant", map[string]any{"id": record.ID}, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			record = recordToTenant(stored)
+		}
+		result = append(result, record)
+	}
+	return result, nil
+}
+
+func (c TenantClient) FindUnique(ctx context.Context, args TenantFindUniqueArgs) (Tenant, bool, error) {
+	if c.client.remote || args.Select != nil || args.Include.narrowed() {
+		where := args.Where.where()
+		if where == nil {
+			return Tenant{}, false, nil
+		}
+		record, ok, err := c.client.db.FindUnique(ctx, "Tenant", where, args.Include.include(), args.Select.fields())
+		if err != nil || !ok {
+			return Tenant{}, ok, err
+		}
+		return recordToTenant(record), true, nil
+	}
+	if args.Where.ID != "" {
+		record, ok := c.client.tenantStore.findByID(args.Where.ID)
+		if !ok {
+			return Tenant{}, false, nil
+		}
+		c.client.includeTenant(&record, args.Include)
+		return record, true, nil
+	}
+	return Tenant{}, false, nil
+}
+
+func (c TenantClient) FindMany(ctx context.Context, args TenantFindManyArgs) ([]Tenant, error) {
+	if c.client.remote || args.Select != nil || args.Include.narrowed() || len(args.Filters) > 0 || args.Where.filterExpr() != nil || len(args.OrderBy) > 0 || args.Skip > 0 || args.Cursor.where() != nil {
+		records, err := c.client.db.FindMany(ctx, "Tenant", args.query())
+		if err != nil {
+			return nil, err
+		}
+		result := make([]Tenant, 0, len(records))
+		for _, record := range records {
+			result = append(result, recordToTenant(record))
+		}
+		return result, nil
+	}
+	if args.Where.ID != nil {
+		record, ok := c.client.tenantStore.findByID(*args.Where.ID)
+		if !ok {
+			return nil, nil
+		}
+		c.client.includeTenant(&record, args.Include)
+		return []Tenant{record}, nil
+	}
+	records, err := c.client.db.FindMany(ctx, "Tenant", args.query())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Tenant, 0, len(records))
+	for _, record := range records {
+		converted := recordToTenant(record)
+		c.client.includeTenant(&converted, args.Include)
+		result = append(result, converted)
+	}
+	return result, nil
+}
+
+func (c TenantClient) Iterate(ctx context.Context, args TenantFindManyArgs) iter.Seq2[Tenant, error] {
+	return func(yield func(Tenant, error) bool) {
+		for record, err := range c.client.db.Iterate(ctx, "Tenant", args.query()) {
+			if err != nil {
+				yield(Tenant{}, err)
+				return
+			}
+			if !yield(recordToTenant(record), nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c TenantClient) Count(ctx context.Context, args TenantFindManyArgs) (int, error) {
+	return c.client.db.Count(ctx, "Tenant", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index()})
+}
+
+func (c TenantClient) Aggregate(ctx context.Context, args TenantAggregateArgs) (zenithdb.AggregateResult, error) {
+	return c.client.db.Aggregate(ctx, "Tenant", zenithdb.AggregateQuery{
+		Query:    zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy},
+		CountAll: args.CountAll,
+		Count:    args.Count,
+		Sum:      args.Sum,
+		Avg:      args.Avg,
+		Min:      args.Min,
+		Max:      args.Max,
+	})
+}
+
+func (c TenantClient) GroupBy(ctx context.Context, args TenantGroupByArgs) ([]zenithdb.Group, error) {
+	return c.client.db.GroupBy(ctx, "Tenant", zenithdb.GroupByQuery{
+		AggregateQuery: zenithdb.AggregateQuery{
+			Query:    zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index()},
+			CountAll: args.CountAll,
+			Count:    args.Count,
+			Sum:      args.Sum,
+			Avg:      args.Avg,
+			Min:      args.Min,
+			Max:      args.Max,
+		},
+		By:      args.By,
+		Having:  args.Having,
+		OrderBy: args.OrderBy,
+		Skip:    args.Skip,
+		Limit:   args.Take,
+	})
+}
+
+func (c TenantClient) UpdateMany(ctx context.Context, args TenantUpdateManyArgs) (zenithdb.ManyResult, error) {
+	return c.client.db.UpdateMany(ctx, "Tenant", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take}, args.Data.record())
+}
+
+func (c TenantClient) DeleteMany(ctx context.Context, args TenantDeleteManyArgs) (zenithdb.ManyResult, error) {
+	return c.client.db.DeleteMany(ctx, "Tenant", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take})
+}
+
+func (c TenantClient) Update(ctx context.Context, args TenantUpdateArgs) (Tenant, bool, error) {
+	if c.client.remote {
+		updatedRecord, err := c.client.db.Update(ctx, "Tenant", args.Where.where(), args.Data.record())
+		if err != nil {
+			return Tenant{}, false, err
+		}
+		if args.Include != nil {
+			record, ok, err := c.client.db.FindUnique(ctx, "Tenant", args.Where.where(), args.Include.include(), nil)
+			if err != nil || !ok {
+				return Tenant{}, ok, err
+			}
+			return recordToTenant(record), true, nil
+		}
+		return recordToTenant(updatedRecord), true, nil
+	}
+	if _, ok, err := c.FindUnique(ctx, TenantFindUniqueArgs{Where: args.Where}); err != nil || !ok {
+		return Tenant{}, ok, err
+	}
+	updatedRecord, err := c.client.db.Update(ctx, "Tenant", args.Where.where(), args.Data.record())
+	if err != nil {
+		return Tenant{}, false, err
+	}
+	updated := recordToTenant(updatedRecord)
+	if args.Include.narrowed() {
+		record, ok, err := c.client.db.FindUnique(ctx, "Tenant", map[string]any{"id": updated.ID}, args.Include.include(), nil)
+		if err != nil || !ok {
+			return Tenant{}, false, err
+		}
+		return recordToTenant(record), true, nil
+	}
+	c.client.includeTenant(&updated, args.Include)
+	return updated, true, nil
+}
+
+func (c TenantClient) Upsert(ctx context.Context, args TenantUpsertArgs) (Tenant, bool, error) {
+	if c.client.remote {
+		record, created, err := c.client.db.Upsert(ctx, "Tenant", args.Where.where(), args.Create.record(), args.Update.record())
+		if err != nil {
+			return Tenant{}, false, err
+		}
+		if args.Include != nil {
+			recordWithInclude, ok, err := c.client.db.FindUnique(ctx, "Tenant", args.Where.where(), args.Include.include(), nil)
+			if err == nil && ok {
+				record = recordWithInclude
+			}
+		}
+		return recordToTenant(record), created, nil
+	}
+	record, created, err := c.client.db.Upsert(ctx, "Tenant", args.Where.where(), args.Create.record(), args.Update.record())
+	if err != nil {
+		return Tenant{}, false, err
+	}
+	converted := recordToTenant(record)
+	if args.Include.narrowed() {
+		record, ok, err := c.client.db.FindUnique(ctx, "Tenant", map[string]any{"id": converted.ID}, args.Include.include(), nil)
+		if err != nil || !ok {
+			return Tenant{}, false, err
+		}
+		return recordToTenant(record), created, nil
+	}
+	c.client.includeTenant(&converted, args.Include)
+	return converted, created, nil
+}
+
+func (c TenantClient) Delete(ctx context.Context, args TenantDeleteArgs) (Tenant, bool, error) {
+	if c.client.remote {
+		previous, ok, err := c.FindUnique(ctx, TenantFindUniqueArgs{Where: args.Where, Include: args.Include})
+		if err != nil || !ok {
+			return Tenant{}, ok, err
+		}
+		_, err = c.client.db.Delete(ctx, "Tenant", args.Where.where())
+		if err != nil {
+			return Tenant{}, false, err
+		}
+		return previous, true, nil
+	}
+	lookup := TenantFindUniqueArgs{Where: args.Where}
+	if args.Include.narrowed() {
+		lookup.Include = args.Include
+	}
+	previous, ok, err := c.FindUnique(ctx, lookup)
+	if err != nil || !ok {
+		return Tenant{}, ok, err
+	}
+	_, err = c.client.db.Delete(ctx, "Tenant", args.Where.where())
+	if err != nil {
+		return Tenant{}, false, err
+	}
+	if lookup.Include == nil {
+		c.client.includeTenant(&previous, args.Include)
+	}
+	return previous, true, nil
+}
+
+func (c TenantClient) FindUniqueByID(ctx context.Context, value string) (Tenant, bool, error) {
+	if c.client.remote {
+		record, ok, err := c.client.db.FindUnique(ctx, "Tenant", map[string]any{"id": value}, nil, nil)
+		if err != nil || !ok {
+			return Tenant{}, ok, err
+		}
+		return recordToTenant(record), true, nil
+	}
+	record, ok := c.client.tenantStore.findByID(value)
+	return record, ok, nil
+}
+
+type TenantTxClient struct {
+	tx *Tx
+}
+
+func (c TenantTxClient) Create(ctx context.Context, input TenantCreateInput) (Tenant, error) {
+	created, err := c.tx.tx.Create(ctx, "Tenant", input.record())
+	if err != nil {
+		return Tenant{}, err
+	}
+	record := recordToTenant(created.Record)
+	if input.nested() {
+		stored, _, err := c.tx.tx.FindUnique(ctx, "Tenant", map[string]any{"id": record.ID}, nil, nil)
+		if err != nil {
+			return Tenant{}, err
+		}
+		return recordToTenant(stored), nil
+	}
+	return record, nil
+}
+
+func (c TenantTxClient) FindUnique(ctx context.Context, args TenantFindUniqueArgs) (Tenant, bool, error) {
+	where := args.Where.where()
+	if where == nil {
+		return Tenant{}, false, nil
+	}
+	record, ok, err := c.tx.tx.FindUnique(ctx, "Tenant", where, args.Include.include(), args.Select.fields())
+	if err != nil || !ok {
+		return Tenant{}, ok, err
+	}
+	return recordToTenant(record), true, nil
+}
+
+func (c TenantTxClient) FindMany(ctx context.Context, args TenantFindManyArgs) ([]Tenant, error) {
+	records, err := c.tx.tx.FindMany(ctx, "Tenant", args.query())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Tenant, 0, len(records))
+	for _, record := range records {
+		result = append(result, recordToTenant(record))
+	}
+	return result, nil
+}
+
+func (c TenantTxClient) Update(ctx context.Context, args TenantUpdateArgs) (Tenant, bool, error) {
+	if _, ok, err := c.FindUnique(ctx, TenantFindUniqueArgs{Where: args.Where}); err != nil || !ok {
+		return Tenant{}, ok, err
+	}
+	updatedRecord, err := c.tx.tx.Update(ctx, "Tenant", args.Where.where(), args.Data.record())
+	if err != nil {
+		return Tenant{}, false, err
+	}
+	if args.Include != nil {
+		return c.FindUnique(ctx, TenantFindUniqueArgs{Where: args.Where, Include: args.Include})
+	}
+	return recordToTenant(updatedRecord), true, nil
+}
+
+func (c TenantTxClient) Upsert(ctx context.Context, args TenantUpsertArgs) (Tenant, bool, error) {
+	record, created, err := c.tx.tx.Upsert(ctx, "Tenant", args.Where.where(), args.Create.record(), args.Update.record())
+	if err != nil {
+		return Tenant{}, false, err
+	}
+	converted := recordToTenant(record)
+	if args.Include != nil {
+		recordWithInclude, ok, err := c.FindUnique(ctx, TenantFindUniqueArgs{Where: args.Where, Include: args.Include})
+		if err == nil && ok {
+			converted = recordWithInclude
+		}
+	}
+	return converted, created, nil
+}
+
+func (c TenantTxClient) Delete(ctx context.Context, args TenantDeleteArgs) (Tenant, bool, error) {
+	previous, ok, err := c.FindUnique(ctx, TenantFindUniqueArgs{Where: args.Where, Include: args.Include})
+	if err != nil || !ok {
+		return Tenant{}, ok, err
+	}
+	_, err = c.tx.tx.Delete(ctx, "Tenant", args.Where.where())
+	if err != nil {
+		return Tenant{}, false, err
+	}
+	return previous, true, nil
+}
+
+type Membership struct {
+	TenantID      string                   `json:"tenantId"`
+	UserID        string                   `json:"userId"`
+	Role          string                   `json:"role"`
+	Tenant        *Tenant                  `json:"tenant"`
+	Grants        []Grant                  `json:"grants"`
+	RelationCount *MembershipRelationCount `json:"_count"`
+}
+
+type MembershipTenantIDUserIDKey struct {
+	TenantID string
+	UserID   string
+}
+
+type MembershipRelationCount struct {
+	Grants int64 `json:"grants"`
+}
+
+type MembershipRelationCountSelect struct {
+	Grants bool
+}
+
+func (input *MembershipRelationCountSelect) fields() []string {
+	var fields []string
+	if input.Grants {
+		fields = append(fields, "grants")
+	}
+	return fields
+}
+
+type MembershipCreateInput struct {
+	TenantID string
+	UserID   string
+	Role     string
+	Tenant   *TenantCreateNestedOneInput
+	Grants   *GrantCreateNestedManyInput
+}
+
+type MembershipUpdateInput struct {
+	Role   *string
+	Tenant *TenantUpdateNestedOneInput
+	Grants *GrantUpdateNestedManyInput
+}
+
+func (input MembershipCreateInput) record() zenithdb.Record {
+	record := zenithdb.Record{
+		"tenantId": input.TenantID,
+		"userId":   input.UserID,
+		"role":     input.Role,
+	}
+	if input.Tenant != nil {
+		record["tenant"] = input.Tenant.write()
+	}
+	if input.Grants != nil {
+		record["grants"] = input.Grants.write()
+	}
+	return record
+}
+
+// nested reports whether the input writes related records.
+func (input MembershipCreateInput) nested() bool {
+	return input.Tenant != nil || input.Grants != nil
+}
+
+// nested reports whether the input writes related records.
+func (input MembershipUpdateInput) nested() bool {
+	return input.Tenant != nil || input.Grants != nil
+}
+
+func (input MembershipUpdateInput) record() zenithdb.Record {
+	record := zenithdb.Record{}
+	if input.Role != nil {
+		record["role"] = *input.Role
+	}
+	if input.Tenant != nil {
+		record["tenant"] = input.Tenant.write()
+	}
+	if input.Grants != nil {
+		record["grants"] = input.Grants.write()
+	}
+	return record
+}
+
+// Validate checks the fields the input sets against their validation rules.
+func (input MembershipCreateInput) Validate() error {
+	return nil
+}
+
+// Validate checks the fields the input sets against their validation rules.
+func (input MembershipUpdateInput) Validate() error {
+	return nil
+}
+
+type MembershipWhereUniqueInput struct {
+	TenantIDUserID MembershipTenantIDUserIDKey
+}
+
+func (input MembershipWhereUniqueInput) where() map[string]any {
+	if input.TenantIDUserID != (MembershipTenantIDUserIDKey{}) {
+		return map[string]any{"tenantId": input.TenantIDUserID.TenantID, "userId": input.TenantIDUserID.UserID}
+	}
+	return nil
+}
+
+type MembershipWhereInput struct {
+	TenantID *string
+	UserID   *string
+	Role     *string
+	Tenant   *TenantRelationFilter
+	Grants   *GrantListRelationFilter
+	AND      []MembershipWhereInput
+	OR       []MembershipWhereInput
+	NOT      *MembershipWhereInput
+}
+
+func (input MembershipWhereInput) where() map[string]any {
+	where := make(map[string]any)
+	if input.TenantID != nil {
+		where["tenantId"] = *input.TenantID
+	}
+	if input.UserID != nil {
+		where["userId"] = *input.UserID
+	}
+	if input.Role != nil {
+		where["role"] = *input.Role
+	}
+	return where
+}
+
+func (input MembershipWhereInput) filterExpr() *zenithdb.FilterExpr {
+	if len(input.AND) == 0 && len(input.OR) == 0 && input.NOT == nil && input.Tenant == nil && input.Grants == nil {
+		return nil
+	}
+	expr := &zenithdb.FilterExpr{}
+	if input.Tenant != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Relation: "tenant", RelationFilter: input.Tenant.filter()})
+	}
+	if input.Grants != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Relation: "grants", RelationFilter: input.Grants.filter()})
+	}
+	for _, child := range input.AND {
+		expr.And = append(expr.And, child.expr())
+	}
+	for _, child := range input.OR {
+		expr.Or = append(expr.Or, child.expr())
+	}
+	if input.NOT != nil {
+		not := input.NOT.expr()
+		expr.Not = &not
+	}
+	return expr
+}
+
+func (input MembershipWhereInput) expr() zenithdb.FilterExpr {
+	expr := zenithdb.FilterExpr{}
+	if input.TenantID != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "tenantId", Filter: zenithdb.Filter{Equals: *input.TenantID}})
+	}
+	if input.UserID != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "userId", Filter: zenithdb.Filter{Equals: *input.UserID}})
+	}
+	if input.Role != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "role", Filter: zenithdb.Filter{Equals: *input.Role}})
+	}
+	if nested := input.filterExpr(); nested != nil {
+		expr.And = append(expr.And, *nested)
+	}
+	return expr
+}
+
+func (input *MembershipWhereInput) relationExpr() *zenithdb.FilterExpr {
+	if input == nil {
+		return nil
+	}
+	expr := input.expr()
+	return &expr
+}
+
+type MembershipListRelationFilter struct {
+	Some  *MembershipWhereInput
+	Every *MembershipWhereInput
+	None  *MembershipWhereInput
+}
+
+func (input MembershipListRelationFilter) filter() zenithdb.RelationFilter {
+	return zenithdb.RelationFilter{Some: input.Some.relationExpr(), Every: input.Every.relationExpr(), None: input.None.relationExpr()}
+}
+
+type MembershipRelationFilter struct {
+	Is    *MembershipWhereInput
+	IsNot *MembershipWhereInput
+}
+
+func (input MembershipRelationFilter) filter() zenithdb.RelationFilter {
+	return zenithdb.RelationFilter{Is: input.Is.relationExpr(), IsNot: input.IsNot.relationExpr()}
+}
+
+func (input MembershipWhereInput) index() string {
+	if input.TenantID != nil {
+		return "membership_tenantid_idx"
+	}
+	return ""
+}
+
+type MembershipInclude struct {
+	Tenant            bool
+	TenantArgs        *TenantIncludeArgs
+	Grants            bool
+	GrantsArgs        *GrantFindManyArgs
+	RelationCount     bool
+	RelationCountArgs *MembershipRelationCountSelect
+}
+
+func (input *MembershipInclude) include() map[string]zenithdb.Include {
+	if input == nil {
+		return nil
+	}
+	include := make(map[string]zenithdb.Include)
+	if input.TenantArgs != nil {
+		include["tenant"] = zenithdb.Include{Query: input.TenantArgs.query()}
+	} else if input.Tenant {
+		include["tenant"] = zenithdb.Include{}
+	}
+	if input.GrantsArgs != nil {
+		include["grants"] = zenithdb.Include{Query: input.GrantsArgs.query()}
+	} else if input.Grants {
+		include["grants"] = zenithdb.Include{}
+	}
+	if input.RelationCountArgs != nil {
+		include[zenithdb.CountField] = zenithdb.Include{Query: zenithdb.Query{Select: input.RelationCountArgs.fields()}}
+	} else if input.RelationCount {
+		include[zenithdb.CountField] = zenithdb.Include{}
+	}
+	return include
+}
+
+func (input *MembershipInclude) narrowed() bool {
+	if input == nil {
+		return false
+	}
+	return input.TenantArgs != nil || input.GrantsArgs != nil || input.RelationCount || input.RelationCountArgs != nil
+}
+
+type MembershipIncludeArgs struct {
+	Select  *MembershipSelect
+	Include *MembershipInclude
+}
+
+func (input *MembershipIncludeArgs) query() zenithdb.Query {
+	return zenithdb.Query{Include: input.Include.include(), Select: input.Select.fields()}
+}
+
+type MembershipSelect struct {
+	TenantID bool
+	UserID   bool
+	Role     bool
+	Tenant   bool
+	Grants   bool
+}
+
+func (input *MembershipSelect) fields() []string {
+	if input == nil {
+		return nil
+	}
+	var fields []string
+	if input.TenantID {
+		fields = append(fields, "tenantId")
+	}
+	if input.UserID {
+		fields = append(fields, "userId")
+	}
+	if input.Role {
+		fields = append(fields, "role")
+	}
+	if input.Tenant {
+		fields = append(fields, "tenant")
+	}
+	if input.Grants {
+		fields = append(fields, "grants")
+	}
+	return fields
+}
+
+type MembershipFindUniqueArgs struct {
+	Where   MembershipWhereUniqueInput
+	Include *MembershipInclude
+	Select  *MembershipSelect
+}
+
+type MembershipFindManyArgs struct {
+	Where   MembershipWhereInput
+	Filters map[string]zenithdb.Filter
+	OrderBy []zenithdb.OrderBy
+	Cursor  MembershipWhereUniqueInput
+	Include *MembershipInclude
+	Select  *MembershipSelect
+	Skip    int
+	Take    int
+}
+
+func (args MembershipFindManyArgs) query() zenithdb.Query {
+	return zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Include: args.Include.include(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy, Select: args.Select.fields()}
+}
+
+type MembershipAggregateArgs struct {
+	Where    MembershipWhereInput
+	Filters  map[string]zenithdb.Filter
+	OrderBy  []zenithdb.OrderBy
+	Cursor   MembershipWhereUniqueInput
+	Skip     int
+	Take     int
+	CountAll bool
+	Count    []string
+	Sum      []string
+	Avg      []string
+	Min      []string
+	Max      []string
+}
+
+type MembershipGroupByArgs struct {
+	By       []string
+	Where    MembershipWhereInput
+	Filters  map[string]zenithdb.Filter
+	CountAll bool
+	Count    []string
+	Sum      []string
+	Avg      []string
+	Min      []string
+	Max      []string
+	Having   []zenithdb.Having
+	OrderBy  []zenithdb.GroupOrderBy
+	Skip     int
+	Take     int
+}
+
+type MembershipUpdateManyArgs struct {
+	Where   MembershipWhereInput
+	Filters map[string]zenithdb.Filter
+	Data    MembershipUpdateInput
+	Take    int
+}
+
+type MembershipDeleteManyArgs struct {
+	Where   MembershipWhereInput
+	Filters map[string]zenithdb.Filter
+	Take    int
+}
+
+type MembershipUpdateArgs struct {
+	Where   MembershipWhereUniqueInput
+	Data    MembershipUpdateInput
+	Include *MembershipInclude
+}
+
+type MembershipUpsertArgs struct {
+	Where   MembershipWhereUniqueInput
+	Create  MembershipCreateInput
+	Update  MembershipUpdateInput
+	Include *MembershipInclude
+}
+
+type MembershipDeleteArgs struct {
+	Where   MembershipWhereUniqueInput
+	Include *MembershipInclude
+}
+
+type MembershipCreateOrConnectInput struct {
+	Where  MembershipWhereUniqueInput
+	Create MembershipCreateInput
+}
+
+func (input MembershipCreateOrConnectInput) write() zenithdb.ConnectOrCreate {
+	return zenithdb.ConnectOrCreate{Where: input.Where.where(), Create: input.Create.record()}
+}
+
+type MembershipUpdateWithWhereUniqueInput struct {
+	Where MembershipWhereUniqueInput
+	Data  MembershipUpdateInput
+}
+
+type MembershipCreateNestedManyInput struct {
+	Create          []MembershipCreateInput
+	Connect         []MembershipWhereUniqueInput
+	ConnectOrCreate []MembershipCreateOrConnectInput
+}
+
+func (input *MembershipCreateNestedManyInput) write() zenithdb.NestedWrite {
+	var write zenithdb.NestedWrite
+	for _, create := range input.Create {
+		write.Create = append(write.Create, create.record())
+	}
+	for _, where := range input.Connect {
+		write.Connect = append(write.Connect, where.where())
+	}
+	for _, connectOrCreate := range input.ConnectOrCreate {
+		write.ConnectOrCreate = append(write.ConnectOrCreate, connectOrCreate.write())
+	}
+	return write
+}
+
+// MembershipUpdateNestedManyInput writes the Membership records a relation connects to.
+// A non-nil Set, even an empty one, connects exactly the records it lists.
+type MembershipUpdateNestedManyInput struct {
+	Create          []MembershipCreateInput
+	Connect         []MembershipWhereUniqueInput
+	ConnectOrCreate []MembershipCreateOrConnectInput
+	Disconnect      []MembershipWhereUniqueInput
+	Set             []MembershipWhereUniqueInput
+	Update          []MembershipUpdateWithWhereUniqueInput
+	Delete          []MembershipWhereUniqueInput
+}
+
+func (input *MembershipUpdateNestedManyInput) write() zenithdb.NestedWrite {
+	write := (&MembershipCreateNestedManyInput{Create: input.Create, Connect: input.Connect, ConnectOrCreate: input.ConnectOrCreate}).write()
+	for _, where := range input.Disconnect {
+		write.Disconnect = append(write.Disconnect, where.where())
+	}
+	if input.Set != nil {
+		write.Set = make([]map[string]any, 0, len(input.Set))
+	}
+	for _, where := range input.Set {
+		write.Set = append(write.Set, where.where())
+	}
+	for _, update := range input.Update {
+		write.Update = append(write.Update, zenithdb.NestedUpdate{Where: update.Where.where(), Data: update.Data.record()})
+	}
+	for _, where := range input.Delete {
+		write.Delete = append(write.Delete, where.where())
+	}
+	return write
+}
+
+type MembershipCreateNestedOneInput struct {
+	Create          *MembershipCreateInput
+	Connect         *MembershipWhereUniqueInput
+	ConnectOrCreate *MembershipCreateOrConnectInput
+}
+
+func (input *MembershipCreateNestedOneInput) write() zenithdb.NestedWrite {
+	var write zenithdb.NestedWrite
+	if input.Create != nil {
+		write.Create = []zenithdb.Record{input.Create.record()}
+	}
+	if input.Connect != nil {
+		write.Connect = []map[string]any{input.Connect.where()}
+	}
+	if input.ConnectOrCreate != nil {
+		write.ConnectOrCreate = []zenithdb.ConnectOrCreate{input.ConnectOrCreate.write()}
+	}
+	return write
+}
+
+type MembershipUpdateNestedOneInput struct {
+	Create          *MembershipCreateInput
+	Connect         *MembershipWhereUniqueInput
+	ConnectOrCreate *MembershipCreateOrConnectInput
+	Disconnect      bool
+	Update          *MembershipUpdateInput
+	Delete          bool
+}
+
+func (input *MembershipUpdateNestedOneInput) write() zenithdb.NestedWrite {
+	write := (&MembershipCreateNestedOneInput{Create: input.Create, Connect: input.Connect, ConnectOrCreate: input.ConnectOrCreate}).write()
+	if input.Disconnect {
+		write.Disconnect = []map[string]any{nil}
+	}
+	if input.Update != nil {
+		write.Update = []zenithdb.NestedUpdate{{Data: input.Update.record()}}
+	}
+	if input.Delete {
+		write.Delete = []map[string]any{nil}
+	}
+	return write
+}
+
+func recordToMembership(record zenithdb.Record) Membership {
+	result := Membership{
+		TenantID: recordValue[string](record, "tenantId"),
+		UserID:   recordValue[string](record, "userId"),
+		Role:     recordValue[string](record, "role"),
+	}
+	if raw, ok := record["tenant"].(zenithdb.Record); ok {
+		converted := recordToTenant(raw)
+		result.Tenant = &converted
+	}
+	if raw, ok := record["grants"].([]zenithdb.Record); ok {
+		result.Grants = make([]Grant, 0, len(raw))
+		for _, item := range raw {
+			converted := recordToGrant(item)
+			result.Grants = append(result.Grants, converted)
+		}
+	}
+	if raw, ok := record[zenithdb.CountField].(zenithdb.Record); ok {
+		result.RelationCount = &MembershipRelationCount{
+			Grants: recordValue[int64](raw, "grants"),
+		}
+	}
+	return result
+}
+
+type membershipStore struct {
+	byTenantIDUserID map[MembershipTenantIDUserIDKey]Membership
+	byTenantID       map[string][]MembershipTenantIDUserIDKey
+}
+
+func newMembershipStore() *membershipStore {
+	return &membershipStore{
+		byTenantIDUserID: make(map[MembershipTenantIDUserIDKey]Membership),
+		byTenantID:       make(map[string][]MembershipTenantIDUserIDKey),
+	}
+}
+
+func (s *membershipStore) put(record Membership) {
+	s.byTenantIDUserID[MembershipTenantIDUserIDKey{TenantID: record.TenantID, UserID: record.UserID}] = record
+	s.byTenantID[record.TenantID] = append(s.byTenantID[record.TenantID], MembershipTenantIDUserIDKey{TenantID: record.TenantID, UserID: record.UserID})
+}
+
+func (s *membershipStore) remove(record Membership) {
+	delete(s.byTenantIDUserID, MembershipTenantIDUserIDKey{TenantID: record.TenantID, UserID: record.UserID})
+	ids := s.byTenantID[record.TenantID]
+	for i, id := range ids {
+		if id == (MembershipTenantIDUserIDKey{TenantID: record.TenantID, UserID: record.UserID}) {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(s.byTenantID, record.TenantID)
+	} else {
+		s.byTenantID[record.TenantID] = ids
+	}
+}
+
+func (s *membershipStore) replace(previous Membership, next Membership) {
+	s.remove(previous)
+	s.put(next)
+}
+
+func (s *membershipStore) findByTenantIDUserID(value MembershipTenantIDUserIDKey) (Membership, bool) {
+	record, ok := s.byTenantIDUserID[value]
+	return record, ok
+}
+
+func (s *membershipStore) findManyByTenantID(value string, limit int) []Membership {
+	ids := s.byTenantID[value]
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+	result := make([]Membership, 0, len(ids))
+	for _, id := range ids {
+		if record, ok := s.findByTenantIDUserID(id); ok {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+type MembershipClient struct {
+	client *Client
+}
+
+func (c MembershipClient) Create(ctx context.Context, input MembershipCreateInput) (Membership, error) {
+	created, err := c.client.db.Create(ctx, "Membership", input.record())
+	if err != nil {
+		return Membership{}, err
+	}
+	record := recordToMembership(created.Record)
+	if input.nested() {
+		stored, _, err := c.client.db.FindUnique(ctx, "Membership", map[string]any{"tenantId": record.TenantID, "userId": record.UserID}, nil, nil)
+		if err != nil {
+			return Membership{}, err
+		}
+		return recordToMembership(stored), nil
+	}
+	return record, nil
+}
+
+func (c MembershipClient) CreateMany(ctx context.Context, inputs []MembershipCreateInput) ([]Membership, error) {
+	records := make([]zenithdb.Record, 0, len(inputs))
+	for _, input := range inputs {
+		records = append(records, input.record())
+	}
+	created, err := c.client.db.CreateMany(ctx, "Membership", records)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Membership, 0, len(inputs))
+	for i, input := range inputs {
+		record := recordToMembership(created[i].Record)
+		if input.nested() {
+			stored, _, err := c.client.db.FindUnique(ctx, "Membership", map[string]any{"tenantId": record.TenantID, "userId": record.UserID}, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			record = recordToMembership(stored)
+		}
+		result = append(result, record)
+	}
+	return result, nil
+}
+
+func (c MembershipClient) FindUnique(ctx context.Context, args MembershipFindUniqueArgs) (Membership, bool, error) {
+	if c.client.remote || args.Select != nil || args.Include.narrowed() {
+		where := args.Where.where()
+		if where == nil {
+			return Membership{}, false, nil
+		}
+		record, ok, err := c.client.db.FindUnique(ctx, "Membership", where, args.Include.include(), args.Select.fields())
+		if err != nil || !ok {
+			return Membership{}, ok, err
+		}
+		return recordToMembership(record), true, nil
+	}
+	if args.Where.TenantIDUserID != (MembershipTenantIDUserIDKey{}) {
+		record, ok := c.client.membershipStore.findByTenantIDUserID(args.Where.TenantIDUserID)
+		if !ok {
+			return Membership{}, false, nil
+		}
+		c.client.includeMembership(&record, args.Include)
+		return record, true, nil
+	}
+	return Membership{}, false, nil
+}
+
+func (c MembershipClient) FindMany(ctx context.Context, args MembershipFindManyArgs) ([]Membership, error) {
+	if c.client.remote || args.Select != nil || args.Include.narrowed() || len(args.Filters) > 0 || args.Where.filterExpr() != nil || len(args.OrderBy) > 0 || args.Skip > 0 || args.Cursor.where() != nil {
+		records, err := c.client.db.FindMany(ctx, "Membership", args.query())
+		if err != nil {
+			return nil, err
+		}
+		result := make([]Membership, 0, len(records))
+		for _, record := range records {
+			result = append(result, recordToMembership(record))
+		}
+		return result, nil
+	}
+	if args.Where.TenantID != nil && args.Where.UserID != nil {
+		record, ok := c.client.membershipStore.findByTenantIDUserID(MembershipTenantIDUserIDKey{TenantID: *args.Where.TenantID, UserID: *args.Where.UserID})
+		if !ok {
+			return nil, nil
+		}
+		c.client.includeMembership(&record, args.Include)
+		return []Membership{record}, nil
+	}
+	if args.Where.TenantID != nil {
+		result := c.client.membershipStore.findManyByTenantID(*args.Where.TenantID, args.Take)
+		for i := range result {
+			c.client.includeMembership(&result[i], args.Include)
+		}
+		return result, nil
+	}
+	records, err := c.client.db.FindMany(ctx, "Membership", args.query())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Membership, 0, len(records))
+	for _, record := range records {
+		converted := recordToMembership(record)
+		c.client.includeMembership(&converted, args.Include)
+		result = append(result, converted)
+	}
+	return result, nil
+}
+
+func (c MembershipClient) Iterate(ctx context.Context, args MembershipFindManyArgs) iter.Seq2[Membership, error] {
+	return func(yield func(Membership, error) bool) {
+		for record, err := range c.client.db.Iterate(ctx, "Membership", args.query()) {
+			if err != nil {
+				yield(Membership{}, err)
+				return
+			}
+			if !yield(recordToMembership(record), nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c MembershipClient) Count(ctx context.Context, args MembershipFindManyArgs) (int, error) {
+	return c.client.db.Count(ctx, "Membership", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index()})
+}
+
+func (c MembershipClient) Aggregate(ctx context.Context, args MembershipAggregateArgs) (zenithdb.AggregateResult, error) {
+	return c.client.db.Aggregate(ctx, "Membership", zenithdb.AggregateQuery{
+		Query:    zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy},
+		CountAll: args.CountAll,
+		Count:    args.Count,
+		Sum:      args.Sum,
+		Avg:      args.Avg,
+		Min:      args.Min,
+		Max:      args.Max,
+	})
+}
+
+func (c MembershipClient) GroupBy(ctx context.Context, args MembershipGroupByArgs) ([]zenithdb.Group, error) {
+	return c.client.db.GroupBy(ctx, "Membership", zenithdb.GroupByQuery{
+		AggregateQuery: zenithdb.AggregateQuery{
+			Query:    zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index()},
+			CountAll: args.CountAll,
+			Count:    args.Count,
+			Sum:      args.Sum,
+			Avg:      args.Avg,
+			Min:      args.Min,
+			Max:      args.Max,
+		},
+		By:      args.By,
+		Having:  args.Having,
+		OrderBy: args.OrderBy,
+		Skip:    args.Skip,
+		Limit:   args.Take,
+	})
+}
+
+func (c MembershipClient) UpdateMany(ctx context.Context, args MembershipUpdateManyArgs) (zenithdb.ManyResult, error) {
+	return c.client.db.UpdateMany(ctx, "Membership", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take}, args.Data.record())
+}
+
+func (c MembershipClient) DeleteMany(ctx context.Context, args MembershipDeleteManyArgs) (zenithdb.ManyResult, error) {
+	return c.client.db.DeleteMany(ctx, "Membership", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take})
+}
+
+func (c MembershipClient) Update(ctx context.Context, args MembershipUpdateArgs) (Membership, bool, error) {
+	if c.client.remote {
+		updatedRecord, err := c.client.db.Update(ctx, "Membership", args.Where.where(), args.Data.record())
+		if err != nil {
+			return Membership{}, false, err
+		}
+		if args.Include != nil {
+			record, ok, err := c.client.db.FindUnique(ctx, "Membership", args.Where.where(), args.Include.include(), nil)
+			if err != nil || !ok {
+				return Membership{}, ok, err
+			}
+			return recordToMembership(record), true, nil
+		}
+		return recordToMembership(updatedRecord), true, nil
+	}
+	if _, ok, err := c.FindUnique(ctx, MembershipFindUniqueArgs{Where: args.Where}); err != nil || !ok {
+		return Membership{}, ok, err
+	}
+	updatedRecord, err := c.client.db.Update(ctx, "Membership", args.Where.where(), args.Data.record())
+	if err != nil {
+		return Membership{}, false, err
+	}
+	updated := recordToMembership(updatedRecord)
+	if args.Include.narrowed() {
+		record, ok, err := c.client.db.FindUnique(ctx, "Membership", map[string]any{"tenantId": updated.TenantID, "userId": updated.UserID}, args.Include.include(), nil)
+		if err != nil || !ok {
+			return Membership{}, false, err
+		}
+		return recordToMembership(record), true, nil
+	}
+	c.client.includeMembership(&updated, args.Include)
+	return updated, true, nil
+}
+
+func (c MembershipClient) Upsert(ctx context.Context, args MembershipUpsertArgs) (Membership, bool, error) {
+	if c.client.remote {
+		record, created, err := c.client.db.Upsert(ctx, "Membership", args.Where.where(), args.Create.record(), args.Update.record())
+		if err != nil {
+			return Membership{}, false, err
+		}
+		if args.Include != nil {
+			recordWithInclude, ok, err := c.client.db.FindUnique(ctx, "Membership", args.Where.where(), args.Include.include(), nil)
+			if err == nil && ok {
+				record = recordWithInclude
+			}
+		}
+		return recordToMembership(record), created, nil
+	}
+	record, created, err := c.client.db.Upsert(ctx, "Membership", args.Where.where(), args.Create.record(), args.Update.record())
+	if err != nil {
+		return Membership{}, false, err
+	}
+	converted := recordToMembership(record)
+	if args.Include.narrowed() {
+		record, ok, err := c.client.db.FindUnique(ctx, "Membership", map[string]any{"tenantId": converted.TenantID, "userId": converted.UserID}, args.Include.include(), nil)
+		if err != nil || !ok {
+			return Membership{}, false, err
+		}
+		return recordToMembership(record), created, nil
+	}
+	c.client.includeMembership(&converted, args.Include)
+	return converted, created, nil
+}
+
+func (c MembershipClient) Delete(ctx context.Context, args MembershipDeleteArgs) (Membership, bool, error) {
+	if c.client.remote {
+		previous, ok, err := c.FindUnique(ctx, MembershipFindUniqueArgs{Where: args.Where, Include: args.Include})
+		if err != nil || !ok {
+			return Membership{}, ok, err
+		}
+		_, err = c.client.db.Delete(ctx, "Membership", args.Where.where())
+		if err != nil {
+			return Membership{}, false, err
+		}
+		return previous, true, nil
+	}
+	lookup := MembershipFindUniqueArgs{Where: args.Where}
+	if args.Include.narrowed() {
+		lookup.Include = args.Include
+	}
+	previous, ok, err := c.FindUnique(ctx, lookup)
+	if err != nil || !ok {
+		return Membership{}, ok, err
+	}
+	_, err = c.client.db.Delete(ctx, "Membership", args.Where.where())
+	if err != nil {
+		return Membership{}, false, err
+	}
+	if lookup.Include == nil {
+		c.client.includeMembership(&previous, args.Include)
+	}
+	return previous, true, nil
+}
+
+func (c MembershipClient) FindUniqueByTenantIDUserID(ctx context.Context, tenantID string, userID string) (Membership, bool, error) {
+	if c.client.remote {
+		record, ok, err := c.client.db.FindUnique(ctx, "Membership", map[string]any{"tenantId": tenantID, "userId": userID}, nil, nil)
+		if err != nil || !ok {
+			return Membership{}, ok, err
+		}
+		return recordToMembership(record), true, nil
+	}
+	record, ok := c.client.membershipStore.findByTenantIDUserID(MembershipTenantIDUserIDKey{TenantID: tenantID, UserID: userID})
+	return record, ok, nil
+}
+
+func (c MembershipClient) FindManyByTenantID(ctx context.Context, value string, limit int) ([]Membership, error) {
+	if c.client.remote {
+		records, err := c.client.db.FindMany(ctx, "Membership", zenithdb.Query{Where: map[string]any{"tenantId": value}, Index: "membership_tenantid_idx", Limit: limit})
+		if err != nil {
+			return nil, err
+		}
+		result := make([]Membership, 0, len(records))
+		for _, record := range records {
+			result = append(result, recordToMembership(record))
+		}
+		return result, nil
+	}
+	return c.client.membershipStore.findManyByTenantID(value, limit), nil
+}
+
+type MembershipTxClient struct {
+	tx *Tx
+}
+
+func (c MembershipTxClient) Create(ctx context.Context, input MembershipCreateInput) (Membership, error) {
+	created, err := c.tx.tx.Create(ctx, "Membership", input.record())
+	if err != nil {
+		return Membership{}, err
+	}
+	record := recordToMembership(created.Record)
+	if input.nested() {
+		stored, _, err := c.tx.tx.FindUnique(ctx, "Membership", map[string]any{"tenantId": record.TenantID, "userId": record.UserID}, nil, nil)
+		if err != nil {
+			return Membership{}, err
+		}
+		return recordToMembership(stored), nil
+	}
+	return record, nil
+}
+
+func (c MembershipTxClient) FindUnique(ctx context.Context, args MembershipFindUniqueArgs) (Membership, bool, error) {
+	where := args.Where.where()
+	if where == nil {
+		return Membership{}, false, nil
+	}
+	record, ok, err := c.tx.tx.FindUnique(ctx, "Membership", where, args.Include.include(), args.Select.fields())
+	if err != nil || !ok {
+		return Membership{}, ok, err
+	}
+	return recordToMembership(record), true, nil
+}
+
+func (c MembershipTxClient) FindMany(ctx context.Context, args MembershipFindManyArgs) ([]Membership, error) {
+	records, err := c.tx.tx.FindMany(ctx, "Membership", args.query())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Membership, 0, len(records))
+	for _, record := range records {
+		result = append(result, recordToMembership(record))
+	}
+	return result, nil
+}
+
+func (c MembershipTxClient) Update(ctx context.Context, args MembershipUpdateArgs) (Membership, bool, error) {
+	if _, ok, err := c.FindUnique(ctx, MembershipFindUniqueArgs{Where: args.Where}); err != nil || !ok {
+		return Membership{}, ok, err
+	}
+	updatedRecord, err := c.tx.tx.Update(ctx, "Membership", args.Where.where(), args.Data.record())
+	if err != nil {
+		return Membership{}, false, err
+	}
+	if args.Include != nil {
+		return c.FindUnique(ctx, MembershipFindUniqueArgs{Where: args.Where, Include: args.Include})
+	}
+	return recordToMembership(updatedRecord), true, nil
+}
+
+func (c MembershipTxClient) Upsert(ctx context.Context, args MembershipUpsertArgs) (Membership, bool, error) {
+	record, created, err := c.tx.tx.Upsert(ctx, "Membership", args.Where.where(), args.Create.record(), args.Update.record())
+	if err != nil {
+		return Membership{}, false, err
+	}
+	converted := recordToMembership(record)
+	if args.Include != nil {
+		recordWithInclude, ok, err := c.FindUnique(ctx, MembershipFindUniqueArgs{Where: args.Where, Include: args.Include})
+		if err == nil && ok {
+			converted = recordWithInclude
+		}
+	}
+	return converted, created, nil
+}
+
+func (c MembershipTxClient) Delete(ctx context.Context, args MembershipDeleteArgs) (Membership, bool, error) {
+	previous, ok, err := c.FindUnique(ctx, MembershipFindUniqueArgs{Where: args.Where, Include: args.Include})
+	if err != nil || !ok {
+		return Membership{}, ok, err
+	}
+	_, err = c.tx.tx.Delete(ctx, "Membership", args.Where.where())
+	if err != nil {
+		return Membership{}, false, err
+	}
+	return previous, true, nil
+}
+
+type Grant struct {
+	ID         string      `json:"id"`
+	TenantID   string      `json:"tenantId"`
+	UserID     string      `json:"userId"`
+	Scope      string      `json:"scope"`
+	Membership *Membership `json:"membership"`
+}
+
+type GrantTenantIDUserIDKey struct {
+	TenantID string
+	UserID   string
+}
+
+type GrantCreateInput struct {
+	ID         string
+	TenantID   string
+	UserID     string
+	Scope      string
+	Membership *MembershipCreateNestedOneInput
+}
+
+type GrantUpdateInput struct {
+	TenantID   *string
+	UserID     *string
+	Scope      *string
+	Membership *MembershipUpdateNestedOneInput
+}
+
+func (input GrantCreateInput) record() zenithdb.Record {
+	record := zenithdb.Record{
+		"id":       input.ID,
+		"tenantId": input.TenantID,
+		"userId":   input.UserID,
+		"scope":    input.Scope,
+	}
+	if input.Membership != nil {
+		record["membership"] = input.Membership.write()
+	}
+	return record
+}
+
+// nested reports whether the input writes related records.
+func (input GrantCreateInput) nested() bool {
+	return input.Membership != nil
+}
+
+// nested reports whether the input writes related records.
+func (input GrantUpdateInput) nested() bool {
+	return input.Membership != nil
+}
+
+func (input GrantUpdateInput) record() zenithdb.Record {
+	record := zenithdb.Record{}
+	if input.TenantID != nil {
+		record["tenantId"] = *input.TenantID
+	}
+	if input.UserID != nil {
+		record["userId"] = *input.UserID
+	}
+	if input.Scope != nil {
+		record["scope"] = *input.Scope
+	}
+	if input.Membership != nil {
+		record["membership"] = input.Membership.write()
+	}
+	return record
+}
+
+// Validate checks the fields the input sets against their validation rules.
+func (input GrantCreateInput) Validate() error {
+	return nil
+}
+
+// Validate checks the fields the input sets against their validation rules.
+func (input GrantUpdateInput) Validate() error {
+	return nil
+}
+
+type GrantWhereUniqueInput struct {
+	ID string
+}
+
+func (input GrantWhereUniqueInput) where() map[string]any {
+	if input.ID != "" {
+		return map[string]any{"id": input.ID}
+	}
+	return nil
+}
+
+type GrantWhereInput struct {
+	ID         *string
+	TenantID   *string
+	UserID     *string
+	Scope      *string
+	Membership *MembershipRelationFilter
+	AND        []GrantWhereInput
+	OR         []GrantWhereInput
+	NOT        *GrantWhereInput
+}
+
+func (input GrantWhereInput) where() map[string]any {
+	where := make(map[string]any)
+	if input.ID != nil {
+		where["id"] = *input.ID
+	}
+	if input.TenantID != nil {
+		where["tenantId"] = *input.TenantID
+	}
+	if input.UserID != nil {
+		where["userId"] = *input.UserID
+	}
+	if input.Scope != nil {
+		where["scope"] = *input.Scope
+	}
+	return where
+}
+
+func (input GrantWhereInput) filterExpr() *zenithdb.FilterExpr {
+	if len(input.AND) == 0 && len(input.OR) == 0 && input.NOT == nil && input.Membership == nil {
+		return nil
+	}
+	expr := &zenithdb.FilterExpr{}
+	if input.Membership != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Relation: "membership", RelationFilter: input.Membership.filter()})
+	}
+	for _, child := range input.AND {
+		expr.And = append(expr.And, child.expr())
+	}
+	for _, child := range input.OR {
+		expr.Or = append(expr.Or, child.expr())
+	}
+	if input.NOT != nil {
+		not := input.NOT.expr()
+		expr.Not = &not
+	}
+	return expr
+}
+
+func (input GrantWhereInput) expr() zenithdb.FilterExpr {
+	expr := zenithdb.FilterExpr{}
+	if input.ID != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "id", Filter: zenithdb.Filter{Equals: *input.ID}})
+	}
+	if input.TenantID != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "tenantId", Filter: zenithdb.Filter{Equals: *input.TenantID}})
+	}
+	if input.UserID != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "userId", Filter: zenithdb.Filter{Equals: *input.UserID}})
+	}
+	if input.Scope != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "scope", Filter: zenithdb.Filter{Equals: *input.Scope}})
+	}
+	if nested := input.filterExpr(); nested != nil {
+		expr.And = append(expr.And, *nested)
+	}
+	return expr
+}
+
+func (input *GrantWhereInput) relationExpr() *zenithdb.FilterExpr {
+	if input == nil {
+		return nil
+	}
+	expr := input.expr()
+	return &expr
+}
+
+type GrantListRelationFilter struct {
+	Some  *GrantWhereInput
+	Every *GrantWhereInput
+	None  *GrantWhereInput
+}
+
+func (input GrantListRelationFilter) filter() zenithdb.RelationFilter {
+	return zenithdb.RelationFilter{Some: input.Some.relationExpr(), Every: input.Every.relationExpr(), None: input.None.relationExpr()}
+}
+
+func (input GrantWhereInput) index() string {
+	if input.TenantID != nil && input.UserID != nil {
+		return "grant_tenantid_userid_idx"
+	}
+	return ""
+}
+
+type GrantInclude struct {
+	Membership     bool
+	MembershipArgs *MembershipIncludeArgs
+}
+
+func (input *GrantInclude) include() map[string]zenithdb.Include {
+	if input == nil {
+		return nil
+	}
+	include := make(map[string]zenithdb.Include)
+	if input.MembershipArgs != nil {
+		include["membership"] = zenithdb.Include{Query: input.MembershipArgs.query()}
+	} else if input.Membership {
+		include["membership"] = zenithdb.Include{}
+	}
+	return include
+}
+
+func (input *GrantInclude) narrowed() bool {
+	if input == nil {
+		return false
+	}
+	return input.MembershipArgs != nil
+}
+
+type GrantIncludeArgs struct {
+	Select  *GrantSelect
+	Include *GrantInclude
+}
+
+func (input *GrantIncludeArgs) query() zenithdb.Query {
+	return zenithdb.Query{Include: input.Include.include(), Select: input.Select.fields()}
+}
+
+type GrantSelect struct {
+	ID         bool
+	TenantID   bool
+	UserID     bool
+	Scope      bool
+	Membership bool
+}
+
+func (input *GrantSelect) fields() []string {
+	if input == nil {
+		return nil
+	}
+	var fields []string
+	if input.ID {
+		fields = append(fields, "id")
+	}
+	if input.TenantID {
+		fields = append(fields, "tenantId")
+	}
+	if input.UserID {
+		fields = append(fields, "userId")
+	}
+	if input.Scope {
+		fields = append(fields, "scope")
+	}
+	if input.Membership {
+		fields = append(fields, "membership")
+	}
+	return fields
+}
+
+type GrantFindUniqueArgs struct {
+	Where   GrantWhereUniqueInput
+	Include *GrantInclude
+	Select  *GrantSelect
+}
+
+type GrantFindManyArgs struct {
+	Where   GrantWhereInput
+	Filters map[string]zenithdb.Filter
+	OrderBy []zenithdb.OrderBy
+	Cursor  GrantWhereUniqueInput
+	Include *GrantInclude
+	Select  *GrantSelect
+	Skip    int
+	Take    int
+}
+
+func (args GrantFindManyArgs) query() zenithdb.Query {
+	return zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Include: args.Include.include(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy, Select: args.Select.fields()}
+}
+
+type GrantAggregateArgs struct {
+	Where    GrantWhereInput
+	Filters  map[string]zenithdb.Filter
+	OrderBy  []zenithdb.OrderBy
+	Cursor   GrantWhereUniqueInput
+	Skip     int
+	Take     int
+	CountAll bool
+	Count    []string
+	Sum      []string
+	Avg      []string
+	Min      []string
+	Max      []string
+}
+
+type GrantGroupByArgs struct {
+	By       []string
+	Where    GrantWhereInput
+	Filters  map[string]zenithdb.Filter
+	CountAll bool
+	Count    []string
+	Sum      []string
+	Avg      []string
+	Min      []string
+	Max      []string
+	Having   []zenithdb.Having
+	OrderBy  []zenithdb.GroupOrderBy
+	Skip     int
+	Take     int
+}
+
+type GrantUpdateManyArgs struct {
+	Where   GrantWhereInput
+	Filters map[string]zenithdb.Filter
+	Data    GrantUpdateInput
+	Take    int
+}
+
+type GrantDeleteManyArgs struct {
+	Where   GrantWhereInput
+	Filters map[string]zenithdb.Filter
+	Take    int
+}
+
+type GrantUpdateArgs struct {
+	Where   GrantWhereUniqueInput
+	Data    GrantUpdateInput
+	Include *GrantInclude
+}
+
+type GrantUpsertArgs struct {
+	Where   GrantWhereUniqueInput
+	Create  GrantCreateInput
+	Update  GrantUpdateInput
+	Include *GrantInclude
+}
+
+type GrantDeleteArgs struct {
+	Where   GrantWhereUniqueInput
+	Include *GrantInclude
+}
+
+type GrantCreateOrConnectInput struct {
+	Where  GrantWhereUniqueInput
+	Create GrantCreateInput
+}
+
+func (input GrantCreateOrConnectInput) write() zenithdb.ConnectOrCreate {
+	return zenithdb.ConnectOrCreate{Where: input.Where.where(), Create: input.Create.record()}
+}
+
+type GrantUpdateWithWhereUniqueInput struct {
+	Where GrantWhereUniqueInput
+	Data  GrantUpdateInput
+}
+
+type GrantCreateNestedManyInput struct {
+	Create          []GrantCreateInput
+	Connect         []GrantWhereUniqueInput
+	ConnectOrCreate []GrantCreateOrConnectInput
+}
+
+func (input *GrantCreateNestedManyInput) write() zenithdb.NestedWrite {
+	var write zenithdb.NestedWrite
+	for _, create := range input.Create {
+		write.Create = append(write.Create, create.record())
+	}
+	for _, where := range input.Connect {
+		write.Connect = append(write.Connect, where.where())
+	}
+	for _, connectOrCreate := range input.ConnectOrCreate {
+		write.ConnectOrCreate = append(write.ConnectOrCreate, connectOrCreate.write())
+	}
+	return write
+}
+
+// GrantUpdateNestedManyInput writes the Grant records a relation connects to.
+// A non-nil Set, even an empty one, connects exactly the records it lists.
+type GrantUpdateNestedManyInput struct {
+	Create          []GrantCreateInput
+	Connect         []GrantWhereUniqueInput
+	ConnectOrCreate []GrantCreateOrConnectInput
+	Disconnect      []GrantWhereUniqueInput
+	Set             []GrantWhereUniqueInput
+	Update          []GrantUpdateWithWhereUniqueInput
+	Delete          []GrantWhereUniqueInput
+}
+
+func (input *GrantUpdateNestedManyInput) write() zenithdb.NestedWrite {
+	write := (&GrantCreateNestedManyInput{Create: input.Create, Connect: input.Connect, ConnectOrCreate: input.ConnectOrCreate}).write()
+	for _, where := range input.Disconnect {
+		write.Disconnect = append(write.Disconnect, where.where())
+	}
+	if input.Set != nil {
+		write.Set = make([]map[string]any, 0, len(input.Set))
+	}
+	for _, where := range input.Set {
+		write.Set = append(write.Set, where.where())
+	}
+	for _, update := range input.Update {
+		write.Update = append(write.Update, zenithdb.NestedUpdate{Where: update.Where.where(), Data: update.Data.record()})
+	}
+	for _, where := range input.Delete {
+		write.Delete = append(write.Delete, where.where())
+	}
+	return write
+}
+
+func recordToGrant(record zenithdb.Record) Grant {
+	result := Grant{
+		ID:       recordValue[string](record, "id"),
+		TenantID: recordValue[string](record, "tenantId"),
+		UserID:   recordValue[string](record, "userId"),
+		Scope:    recordValue[string](record, "scope"),
+	}
+	if raw, ok := record["membership"].(zenithdb.Record); ok {
+		converted := recordToMembership(raw)
+		result.Membership = &converted
+	}
+	return result
+}
+
+type grantStore struct {
+	byID             map[string]Grant
+	byTenantIDUserID map[GrantTenantIDUserIDKey][]string
+}
+
+func newGrantStore() *grantStore {
+	return &grantStore{
+		byID:             make(map[string]Grant),
+		byTenantIDUserID: make(map[GrantTenantIDUserIDKey][]string),
+	}
+}
+
+func (s *grantStore) put(record Grant) {
+	s.byID[record.ID] = record
+	s.byTenantIDUserID[GrantTenantIDUserIDKey{TenantID: record.TenantID, UserID: record.UserID}] = append(s.byTenantIDUserID[GrantTenantIDUserIDKey{TenantID: record.TenantID, UserID: record.UserID}], record.ID)
+}
+
+func (s *grantStore) remove(record Grant) {
+	delete(s.byID, record.ID)
+	ids := s.byTenantIDUserID[GrantTenantIDUserIDKey{TenantID: record.TenantID, UserID: record.UserID}]
+	for i, id := range ids {
+		if id == record.ID {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(s.byTenantIDUserID, GrantTenantIDUserIDKey{TenantID: record.TenantID, UserID: record.UserID})
+	} else {
+		s.byTenantIDUserID[GrantTenantIDUserIDKey{TenantID: record.TenantID, UserID: record.UserID}] = ids
+	}
+}
+
+func (s *grantStore) replace(previous Grant, next Grant) {
+	s.remove(previous)
+	s.put(next)
+}
+
+func (s *grantStore) findByID(value string) (Grant, bool) {
+	record, ok := s.byID[value]
+	return record, ok
+}
+
+func (s *grantStore) findManyByTenantIDUserID(value GrantTenantIDUserIDKey, limit int) []Grant {
+	ids := s.byTenantIDUserID[value]
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+	result := make([]Grant, 0, len(ids))
+	for _, id := range ids {
+		if record, ok := s.findByID(id); ok {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+type GrantClient struct {
+	client *Client
+}
+
+func (c GrantClient) Create(ctx context.Context, input GrantCreateInput) (Grant, error) {
+	created, err := c.client.db.Create(ctx, "Grant", input.record())
+	if err != nil {
+		return Grant{}, err
+	}
+	record := recordToGrant(created.Record)
+	if input.nested() {
+		stored, _, err := c.client.db.FindUnique(ctx, "Grant", map[string]any{"id": record.ID}, nil, nil)
+		if err != nil {
+			return Grant{}, err
+		}
+		return recordToGrant(stored), nil
+	}
+	return record, nil
+}
+
+func (c GrantClient) CreateMany(ctx context.Context, inputs []GrantCreateInput) ([]Grant, error) {
+	records := make([]zenithdb.Record, 0, len(inputs))
+	for _, input := range inputs {
+		records = append(records, input.record())
+	}
+	created, err := c.client.db.CreateMany(ctx, "Grant", records)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Grant, 0, len(inputs))
+	for i, input := range inputs {
+		record := recordToGrant(created[i].Record)
+		if input.nested() {
+			stored, _, err := c.client.db.FindUnique(ctx, "Grant", map[string]any{"id": record.ID}, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			record = recordToGrant(stored)
+		}
+		result = append(result, record)
+	}
+	return result, nil
+}
+
+func (c GrantClient) FindUnique(ctx context.Context, args GrantFindUniqueArgs) (Grant, bool, error) {
+	if c.client.remote || args.Select != nil || args.Include.narrowed() {
+		where := args.Where.where()
+		if where == nil {
+			return Grant{}, false, nil
+		}
+		record, ok, err := c.client.db.FindUnique(ctx, "Grant", where, args.Include.include(), args.Select.fields())
+		if err != nil || !ok {
+			return Grant{}, ok, err
+		}
+		return recordToGrant(record), true, nil
+	}
+	if args.Where.ID != "" {
+		record, ok := c.client.grantStore.findByID(args.Where.ID)
+		if !ok {
+			return Grant{}, false, nil
+		}
+		c.client.includeGrant(&record, args.Include)
+		return record, true, nil
+	}
+	return Grant{}, false, nil
+}
+
+func (c GrantClient) FindMany(ctx context.Context, args GrantFindManyArgs) ([]Grant, error) {
+	if c.client.remote || args.Select != nil || args.Include.narrowed() || len(args.Filters) > 0 || args.Where.filterExpr() != nil || len(args.OrderBy) > 0 || args.Skip > 0 || args.Cursor.where() != nil {
+		records, err := c.client.db.FindMany(ctx, "Grant", args.query())
+		if err != nil {
+			return nil, err
+		}
+		result := make([]Grant, 0, len(records))
+		for _, record := range records {
+			result = append(result, recordToGrant(record))
+		}
+		return result, nil
+	}
+	if args.Where.ID != nil {
+		record, ok := c.client.grantStore.findByID(*args.Where.ID)
+		if !ok {
+			return nil, nil
+		}
+		c.client.includeGrant(&record, args.Include)
+		return []Grant{record}, nil
+	}
+	if args.Where.TenantID != nil && args.Where.UserID != nil {
+		result := c.client.grantStore.findManyByTenantIDUserID(GrantTenantIDUserIDKey{TenantID: *args.Where.TenantID, UserID: *args.Where.UserID}, args.Take)
+		for i := range result {
+			c.client.includeGrant(&result[i], args.Include)
+		}
+		return result, nil
+	}
+	records, err := c.client.db.FindMany(ctx, "Grant", args.query())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Grant, 0, len(records))
+	for _, record := range records {
+		converted := recordToGrant(record)
+		c.client.includeGrant(&converted, args.Include)
+		result = append(result, converted)
+	}
+	return result, nil
+}
+
+func (c GrantClient) Iterate(ctx context.Context, args GrantFindManyArgs) iter.Seq2[Grant, error] {
+	return func(yield func(Grant, error) bool) {
+		for record, err := range c.client.db.Iterate(ctx, "Grant", args.query()) {
+			if err != nil {
+				yield(Grant{}, err)
+				return
+			}
+			if !yield(recordToGrant(record), nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c GrantClient) Count(ctx context.Context, args GrantFindManyArgs) (int, error) {
+	return c.client.db.Count(ctx, "Grant", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index()})
+}
+
+func (c GrantClient) Aggregate(ctx context.Context, args GrantAggregateArgs) (zenithdb.AggregateResult, error) {
+	return c.client.db.Aggregate(ctx, "Grant", zenithdb.AggregateQuery{
+		Query:    zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy},
+		CountAll: args.CountAll,
+		Count:    args.Count,
+		Sum:      args.Sum,
+		Avg:      args.Avg,
+		Min:      args.Min,
+		Max:      args.Max,
+	})
+}
+
+func (c GrantClient) GroupBy(ctx context.Context, args GrantGroupByArgs) ([]zenithdb.Group, error) {
+	return c.client.db.GroupBy(ctx, "Grant", zenithdb.GroupByQuery{
+		AggregateQuery: zenithdb.AggregateQuery{
+			Query:    zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index()},
+			CountAll: args.CountAll,
+			Count:    args.Count,
+			Sum:      args.Sum,
+			Avg:      args.Avg,
+			Min:      args.Min,
+			Max:      args.Max,
+		},
+		By:      args.By,
+		Having:  args.Having,
+		OrderBy: args.OrderBy,
+		Skip:    args.Skip,
+		Limit:   args.Take,
+	})
+}
+
+func (c GrantClient) UpdateMany(ctx context.Context, args GrantUpdateManyArgs) (zenithdb.ManyResult, error) {
+	return c.client.db.UpdateMany(ctx, "Grant", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take}, args.Data.record())
+}
+
+func (c GrantClient) DeleteMany(ctx context.Context, args GrantDeleteManyArgs) (zenithdb.ManyResult, error) {
+	return c.client.db.DeleteMany(ctx, "Grant", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take})
+}
+
+func (c GrantClient) Update(ctx context.Context, args GrantUpdateArgs) (Grant, bool, error) {
+	if c.client.remote {
+		updatedRecord, err := c.client.db.Update(ctx, "Grant", args.Where.where(), args.Data.record())
+		if err != nil {
+			return Grant{}, false, err
+		}
+		if args.Include != nil {
+			record, ok, err := c.client.db.FindUnique(ctx, "Grant", args.Where.where(), args.Include.include(), nil)
+			if err != nil || !ok {
+				return Grant{}, ok, err
+			}
+			return recordToGrant(record), true, nil
+		}
+		return recordToGrant(updatedRecord), true, nil
+	}
+	if _, ok, err := c.FindUnique(ctx, GrantFindUniqueArgs{Where: args.Where}); err != nil || !ok {
+		return Grant{}, ok, err
+	}
+	updatedRecord, err := c.client.db.Update(ctx, "Grant", args.Where.where(), args.Data.record())
+	if err != nil {
+		return Grant{}, false, err
+	}
+	updated := recordToGrant(updatedRecord)
+	if args.Include.narrowed() {
+		record, ok, err := c.client.db.FindUnique(ctx, "Grant", map[string]any{"id": updated.ID}, args.Include.include(), nil)
+		if err != nil || !ok {
+			return Grant{}, false, err
+		}
+		return recordToGrant(record), true, nil
+	}
+	c.client.includeGrant(&updated, args.Include)
+	return updated, true, nil
+}
+
+func (c GrantClient) Upsert(ctx context.Context, args GrantUpsertArgs) (Grant, bool, error) {
+	if c.client.remote {
+		record, created, err := c.client.db.Upsert(ctx, "Grant", args.Where.where(), args.Create.record(), args.Update.record())
+		if err != nil {
+			return Grant{}, false, err
+		}
+		if args.Include != nil {
+			recordWithInclude, ok, err := c.client.db.FindUnique(ctx, "Grant", args.Where.where(), args.Include.include(), nil)
+			if err == nil && ok {
+				record = recordWithInclude
+			}
+		}
+		return recordToGrant(record), created, nil
+	}
+	record, created, err := c.client.db.Upsert(ctx, "Grant", args.Where.where(), args.Create.record(), args.Update.record())
+	if err != nil {
+		return Grant{}, false, err
+	}
+	converted := recordToGrant(record)
+	if args.Include.narrowed() {
+		record, ok, err := c.client.db.FindUnique(ctx, "Grant", map[string]any{"id": converted.ID}, args.Include.include(), nil)
+		if err != nil || !ok {
+			return Grant{}, false, err
+		}
+		return recordToGrant(record), created, nil
+	}
+	c.client.includeGrant(&converted, args.Include)
+	return converted, created, nil
+}
+
+func (c GrantClient) Delete(ctx context.Context, args GrantDeleteArgs) (Grant, bool, error) {
+	if c.client.remote {
+		previous, ok, err := c.FindUnique(ctx, GrantFindUniqueArgs{Where: args.Where, Include: args.Include})
+		if err != nil || !ok {
+			return Grant{}, ok, err
+		}
+		_, err = c.client.db.Delete(ctx, "Grant", args.Where.where())
+		if err != nil {
+			return Grant{}, false, err
+		}
+		return previous, true, nil
+	}
+	lookup := GrantFindUniqueArgs{Where: args.Where}
+	if args.Include.narrowed() {
+		lookup.Include = args.Include
+	}
+	previous, ok, err := c.FindUnique(ctx, lookup)
+	if err != nil || !ok {
+		return Grant{}, ok, err
+	}
+	_, err = c.client.db.Delete(ctx, "Grant", args.Where.where())
+	if err != nil {
+		return Grant{}, false, err
+	}
+	if lookup.Include == nil {
+		c.client.includeGrant(&previous, args.Include)
+	}
+	return previous, true, nil
+}
+
+func (c GrantClient) FindUniqueByID(ctx context.Context, value string) (Grant, bool, error) {
+	if c.client.remote {
+		record, ok, err := c.client.db.FindUnique(ctx, "Grant", map[string]any{"id": value}, nil, nil)
+		if err != nil || !ok {
+			return Grant{}, ok, err
+		}
+		return recordToGrant(record), true, nil
+	}
+	record, ok := c.client.grantStore.findByID(value)
+	return record, ok, nil
+}
+
+func (c GrantClient) FindManyByTenantIDUserID(ctx context.Context, tenantID string, userID string, limit int) ([]Grant, error) {
+	if c.client.remote {
+		records, err := c.client.db.FindMany(ctx, "Grant", zenithdb.Query{Where: map[string]any{"tenantId": tenantID, "userId": userID}, Index: "grant_tenantid_userid_idx", Limit: limit})
+		if err != nil {
+			return nil, err
+		}
+		result := make([]Grant, 0, len(records))
+		for _, record := range records {
+			result = append(result, recordToGrant(record))
+		}
+		return result, nil
+	}
+	return c.client.grantStore.findManyByTenantIDUserID(GrantTenantIDUserIDKey{TenantID: tenantID, UserID: userID}, limit), nil
+}
+
+type GrantTxClient struct {
+	tx *Tx
+}
+
+func (c GrantTxClient) Create(ctx context.Context, input GrantCreateInput) (Grant, error) {
+	created, err := c.tx.tx.Create(ctx, "Grant", input.record())
+	if err != nil {
+		return Grant{}, err
+	}
+	record := recordToGrant(created.Record)
+	if input.nested() {
+		stored, _, err := c.tx.tx.FindUnique(ctx, "Grant", map[string]any{"id": record.ID}, nil, nil)
+		if err != nil {
+			return Grant{}, err
+		}
+		return recordToGrant(stored), nil
+	}
+	return record, nil
+}
+
+func (c GrantTxClient) FindUnique(ctx context.Context, args GrantFindUniqueArgs) (Grant, bool, error) {
+	where := args.Where.where()
+	if where == nil {
+		return Grant{}, false, nil
+	}
+	record, ok, err := c.tx.tx.FindUnique(ctx, "Grant", where, args.Include.include(), args.Select.fields())
+	if err != nil || !ok {
+		return Grant{}, ok, err
+	}
+	return recordToGrant(record), true, nil
+}
+
+func (c GrantTxClient) FindMany(ctx context.Context, args GrantFindManyArgs) ([]Grant, error) {
+	records, err := c.tx.tx.FindMany(ctx, "Grant", args.query())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Grant, 0, len(records))
+	for _, record := range records {
+		result = append(result, recordToGrant(record))
+	}
+	return result, nil
+}
+
+func (c GrantTxClient) Update(ctx context.Context, args GrantUpdateArgs) (Grant, bool, error) {
+	if _, ok, err := c.FindUnique(ctx, GrantFindUniqueArgs{Where: args.Where}); err != nil || !ok {
+		return Grant{}, ok, err
+	}
+	updatedRecord, err := c.tx.tx.Update(ctx, "Grant", args.Where.where(), args.Data.record())
+	if err != nil {
+		return Grant{}, false, err
+	}
+	if args.Include != nil {
+		return c.FindUnique(ctx, GrantFindUniqueArgs{Where: args.Where, Include: args.Include})
+	}
+	return recordToGrant(updatedRecord), true, nil
+}
+
+func (c GrantTxClient) Upsert(ctx context.Context, args GrantUpsertArgs) (Grant, bool, error) {
+	record, created, err := c.tx.tx.Upsert(ctx, "Grant", args.Where.where(), args.Create.record(), args.Update.record())
+	if err != nil {
+		return Grant{}, false, err
+	}
+	converted := recordToGrant(record)
+	if args.Include != nil {
+		recordWithInclude, ok, err := c.FindUnique(ctx, GrantFindUniqueArgs{Where: args.Where, Include: args.Include})
+		if err == nil && ok {
+			converted = recordWithInclude
+		}
+	}
+	return converted, created, nil
+}
+
+func (c GrantTxClient) Delete(ctx context.Context, args GrantDeleteArgs) (Grant, bool, error) {
+	previous, ok, err := c.FindUnique(ctx, GrantFindUniqueArgs{Where: args.Where, Include: args.Include})
+	if err != nil || !ok {
+		return Grant{}, ok, err
+	}
+	_, err = c.tx.tx.Delete(ctx, "Grant", args.Where.where())
+	if err != nil {
+		return Grant{}, false, err
+	}
+	return previous, true, nil
+}
@@ -2,7 +2,10 @@ package zenith
 
 import (
 	"context"
+	"errors"
 	zenithdb "github.com/bypepe77/ZenithDB/pkg/zenithdb"
+	remote "github.com/bypepe77/ZenithDB/pkg/zenithdb/remote"
+	"iter"
 )
 
 var Schema = zenithdb.Schema{
@@ -19,7 +22,7 @@ var Schema = zenithdb.Schema{
 				{Name: "user_email_uniq", Fields: []string{"email"}, Unique: true},
 			},
 			Relations: []zenithdb.Relation{
-				{Name: "posts", Model: "Post", Fields: []string{"id"}, References: []string{"authorId"}, Many: true},
+				{Name: "posts", Model: "Post", Fields: []string{"id"}, References: []string{"authorId"}, Many: true, ForeignKey: false},
 			},
 		},
 		{
@@ -34,16 +37,37 @@ var Schema = zenithdb.Schema{
 				{Name: "post_authorid_idx", Fields: []string{"authorId"}, Unique: false},
 			},
 			Relations: []zenithdb.Relation{
-				{Name: "author", Model: "User", Fields: []string{"authorId"}, References: []string{"id"}, Many: false},
+				{Name: "author", Model: "User", Fields: []string{"authorId"}, References: []string{"id"}, Many: false, ForeignKey: true},
 			},
 		},
 	},
 }
 
+type engine interface {
+	Create(context.Context, string, zenithdb.Record) (zenithdb.MutationResult, error)
+	CreateMany(context.Context, string, []zenithdb.Record) ([]zenithdb.MutationResult, error)
+	Update(context.Context, string, map[string]any, zenithdb.Record) (zenithdb.Record, error)
+	UpdateMany(context.Context, string, zenithdb.Query, zenithdb.Record) (zenithdb.ManyResult, error)
+	Delete(context.Context, string, map[string]any) (zenithdb.Record, error)
+	DeleteMany(context.Context, string, zenithdb.Query) (zenithdb.ManyResult, error)
+	Upsert(context.Context, string, map[string]any, zenithdb.Record, zenithdb.Record) (zenithdb.Record, bool, error)
+	Batch(context.Context, []zenithdb.BatchOperation) ([]zenithdb.BatchResult, error)
+	FindUnique(context.Context, string, map[string]any, map[string]zenithdb.Include, []string) (zenithdb.Record, bool, error)
+	FindMany(context.Context, string, zenithdb.Query) ([]zenithdb.Record, error)
+	Iterate(context.Context, string, zenithdb.Query) iter.Seq2[zenithdb.Record, error]
+	Count(context.Context, string, zenithdb.Query) (int, error)
+	Aggregate(context.Context, string, zenithdb.AggregateQuery) (zenithdb.AggregateResult, error)
+	GroupBy(context.Context, string, zenithdb.GroupByQuery) ([]zenithdb.Group, error)
+	Close() error
+}
+
 type Client struct {
-	db   *zenithdb.DB
-	User UserClient
-	Post PostClient
+	db        engine
+	remote    bool
+	userStore *userStore
+	User      UserClient
+	postStore *postStore
+	Post      PostClient
 }
 
 func Open(ctx context.Context, options zenithdb.Options) (*Client, error) {
@@ -51,128 +75,1817 @@ func Open(ctx context.Context, options zenithdb.Options) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	client := &Client{db: db}
-	client.User = UserClient{db: db}
-	client.Post = PostClient{db: db}
-	return client, nil
+	return newClientFromEngine(ctx, db, true, false)
+}
+
+func OpenURL(ctx context.Context, connectionURL string) (*Client, error) {
+	options, err := zenithdb.ParseConnectionURL(connectionURL)
+	if err != nil {
+		return nil, err
+	}
+	if options.WireURL != "" {
+		schemaHash, err := Schema.Hash()
+		if err != nil {
+			return nil, err
+		}
+		db, err := remote.OpenWithOptions(ctx, remote.OpenOptions{ConnectionURL: connectionURL, SchemaHash: schemaHash})
+		if err != nil {
+			return nil, err
+		}
+		return newClientFromEngine(ctx, db, false, true)
+	}
+	return Open(ctx, zenithdb.Options{ConnectionURL: connectionURL})
 }
 
 func (c *Client) Close() error {
 	return c.db.Close()
 }
 
+func (c *Client) Batch(ctx context.Context, operations []zenithdb.BatchOperation) ([]zenithdb.BatchResult, error) {
+	return c.db.Batch(ctx, operations)
+}
+
+// recordValue returns the value of field, or the zero value when the record
+// does not hold it, as when a select left it out.
+func recordValue[T any](record zenithdb.Record, field string) T {
+	value, _ := record[field].(T)
+	return value
+}
+
+func newClientFromEngine(ctx context.Context, db engine, preload bool, remote bool) (*Client, error) {
+	client := &Client{db: db, remote: remote}
+	client.userStore = newUserStore()
+	client.postStore = newPostStore()
+	if preload {
+		if err := client.loadUser(ctx); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		if err := client.loadPost(ctx); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		if local, ok := db.(*zenithdb.DB); ok {
+			local.OnChange(client.apply)
+		}
+	}
+	client.User = UserClient{client: client}
+	client.Post = PostClient{client: client}
+	return client, nil
+}
+
+func (c *Client) loadUser(ctx context.Context) error {
+	records, err := c.db.FindMany(ctx, "User", zenithdb.Query{})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		c.userStore.put(recordToUser(record))
+	}
+	return nil
+}
+
+func (c *Client) loadPost(ctx context.Context) error {
+	records, err := c.db.FindMany(ctx, "Post", zenithdb.Query{})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		c.postStore.put(recordToPost(record))
+	}
+	return nil
+}
+
+// apply updates the stores with the changes of one committed write, which
+// include the records its nested writes and referential actions changed. It
+// removes every replaced record before storing the new versions, so a unique
+// value that moves between records stays indexed.
+func (c *Client) apply(changes []zenithdb.Change) {
+	for _, change := range changes {
+		if change.Before == nil {
+			continue
+		}
+		switch change.Model {
+		case "User":
+			c.userStore.remove(recordToUser(change.Before))
+		case "Post":
+			c.postStore.remove(recordToPost(change.Before))
+		}
+	}
+	for _, change := range changes {
+		if change.After == nil {
+			continue
+		}
+		switch change.Model {
+		case "User":
+			c.userStore.put(recordToUser(change.After))
+		case "Post":
+			c.postStore.put(recordToPost(change.After))
+		}
+	}
+}
+
+func (c *Client) includeUser(record *User, include *UserInclude) {
+	if include == nil {
+		return
+	}
+	if include.Posts {
+		record.Posts = c.postStore.findManyByAuthorID(record.ID, 0)
+	}
+}
+
+func (c *Client) includePost(record *Post, include *PostInclude) {
+	if include == nil {
+		return
+	}
+	if include.Author {
+		related, ok := c.userStore.findByID(record.AuthorID)
+		if ok {
+			record.Author = &related
+		}
+	}
+}
+
+type engineTx interface {
+	Create(context.Context, string, zenithdb.Record) (zenithdb.MutationResult, error)
+	Update(context.Context, string, map[string]any, zenithdb.Record) (zenithdb.Record, error)
+	Delete(context.Context, string, map[string]any) (zenithdb.Record, error)
+	Upsert(context.Context, string, map[string]any, zenithdb.Record, zenithdb.Record) (zenithdb.Record, bool, error)
+	FindUnique(context.Context, string, map[string]any, map[string]zenithdb.Include, []string) (zenithdb.Record, bool, error)
+	FindMany(context.Context, string, zenithdb.Query) ([]zenithdb.Record, error)
+	Commit(context.Context) error
+	Rollback(context.Context) error
+}
+
+// Tx exposes the model clients inside an interactive transaction.
+type Tx struct {
+	tx   engineTx
+	User UserTxClient
+	Post PostTxClient
+}
+
+func (c *Client) begin(ctx context.Context) (engineTx, error) {
+	switch db := c.db.(type) {
+	case *zenithdb.DB:
+		return db.Begin(ctx)
+	case *remote.Client:
+		return db.Begin(ctx)
+	default:
+		return nil, errors.New("engine does not support transactions")
+	}
+}
+
+// Transaction runs fn in an interactive transaction. The transaction commits
+// when fn returns nil and rolls back otherwise.
+func (c *Client) Transaction(ctx context.Context, fn func(tx *Tx) error) error {
+	engineTx, err := c.begin(ctx)
+	if err != nil {
+		return err
+	}
+	tx := &Tx{tx: engineTx}
+	tx.User = UserTxClient{tx: tx}
+	tx.Post = PostTxClient{tx: tx}
+	if err := fn(tx); err != nil {
+		_ = engineTx.Rollback(ctx)
+		return err
+	}
+	return engineTx.Commit(ctx)
+}
+
 type User struct {
-	ID    string `json:"id"`
-	Email string `json:"email"`
-	Name  string `json:"name"`
+	ID            string             `json:"id"`
+	Email         string             `json:"email"`
+	Name          string             `json:"name"`
+	Posts         []Post             `json:"posts"`
+	RelationCount *UserRelationCount `json:"_count"`
+}
+
+type UserRelationCount struct {
+	Posts int64 `json:"posts"`
+}
+
+type UserRelationCountSelect struct {
+	Posts bool
+}
+
+func (input *UserRelationCountSelect) fields() []string {
+	var fields []string
+	if input.Posts {
+		fields = append(fields, "posts")
+	}
+	return fields
 }
 
 type UserCreateInput struct {
 	ID    string
 	Email string
 	Name  string
+	Posts *PostCreateNestedManyInput
+}
+
+type UserUpdateInput struct {
+	Email *string
+	Name  *string
+	Posts *PostUpdateNestedManyInput
 }
 
 func (input UserCreateInput) record() zenithdb.Record {
-	return zenithdb.Record{
+	record := zenithdb.Record{
 		"id":    input.ID,
 		"email": input.Email,
 		"name":  input.Name,
 	}
+	if input.Posts != nil {
+		record["posts"] = input.Posts.write()
+	}
+	return record
 }
 
-func recordToUser(record zenithdb.Record) User {
-	return User{
-		ID:    record["id"].(string),
-		Email: record["email"].(string),
-		Name:  record["name"].(string),
+// nested reports whether the input writes related records.
+func (input UserCreateInput) nested() bool {
+	return input.Posts != nil
+}
+
+// nested reports whether the input writes related records.
+func (input UserUpdateInput) nested() bool {
+	return input.Posts != nil
+}
+
+func (input UserUpdateInput) record() zenithdb.Record {
+	record := zenithdb.Record{}
+	if input.Email != nil {
+		record["email"] = *input.Email
 	}
+	if input.Name != nil {
+		record["name"] = *input.Name
+	}
+	if input.Posts != nil {
+		record["posts"] = input.Posts.write()
+	}
+	return record
 }
 
-type UserClient struct {
-	db *zenithdb.DB
+// Validate checks the fields the input sets against their validation rules.
+func (input UserCreateInput) Validate() error {
+	return nil
 }
 
-func (c UserClient) Create(ctx context.Context, input UserCreateInput) (User, error) {
-	_, err := c.db.Create(ctx, "User", input.record())
-	if err != nil {
-		return User{}, err
+// Validate checks the fields the input sets against their validation rules.
+func (input UserUpdateInput) Validate() error {
+	return nil
+}
+
+type UserWhereUniqueInput struct {
+	ID    string
+	Email string
+}
+
+func (input UserWhereUniqueInput) where() map[string]any {
+	if input.ID != "" {
+		return map[string]any{"id": input.ID}
 	}
-	return recordToUser(input.record()), nil
+	if input.Email != "" {
+		return map[string]any{"email": input.Email}
+	}
+	return nil
 }
 
-func (c UserClient) FindUniqueByID(ctx context.Context, value string) (User, bool, error) {
-	record, ok, err := c.db.FindUnique(ctx, "User", map[string]any{"id": value}, nil)
-	if err != nil || !ok {
-		return User{}, ok, err
+type UserWhereInput struct {
+	ID    *string
+	Email *string
+	Name  *string
+	Posts *PostListRelationFilter
+	AND   []UserWhereInput
+	OR    []UserWhereInput
+	NOT   *UserWhereInput
+}
+
+func (input UserWhereInput) where() map[string]any {
+	where := make(map[string]any)
+	if input.ID != nil {
+		where["id"] = *input.ID
 	}
-	return recordToUser(record), true, nil
+	if input.Email != nil {
+		where["email"] = *input.Email
+	}
+	if input.Name != nil {
+		where["name"] = *input.Name
+	}
+	return where
 }
 
-func (c UserClient) FindUniqueByEmail(ctx context.Context, value string) (User, bool, error) {
-	record, ok, err := c.db.FindUnique(ctx, "User", map[string]any{"email": value}, nil)
-	if err != nil || !ok {
-		return User{}, ok, err
+func (input UserWhereInput) filterExpr() *zenithdb.FilterExpr {
+	if len(input.AND) == 0 && len(input.OR) == 0 && input.NOT == nil && input.Posts == nil {
+		return nil
 	}
-	return recordToUser(record), true, nil
+	expr := &zenithdb.FilterExpr{}
+	if input.Posts != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Relation: "posts", RelationFilter: input.Posts.filter()})
+	}
+	for _, child := range input.AND {
+		expr.And = append(expr.And, child.expr())
+	}
+	for _, child := range input.OR {
+		expr.Or = append(expr.Or, child.expr())
+	}
+	if input.NOT != nil {
+		not := input.NOT.expr()
+		expr.Not = &not
+	}
+	return expr
 }
 
-type Post struct {
-	ID       string `json:"id"`
-	AuthorID string `json:"authorId"`
-	Title    string `json:"title"`
+func (input UserWhereInput) expr() zenithdb.FilterExpr {
+	expr := zenithdb.FilterExpr{}
+	if input.ID != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "id", Filter: zenithdb.Filter{Equals: *input.ID}})
+	}
+	if input.Email != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "email", Filter: zenithdb.Filter{Equals: *input.Email}})
+	}
+	if input.Name != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "name", Filter: zenithdb.Filter{Equals: *input.Name}})
+	}
+	if nested := input.filterExpr(); nested != nil {
+		expr.And = append(expr.And, *nested)
+	}
+	return expr
 }
 
-type PostCreateInput struct {
-	ID       string
-	AuthorID string
-	Title    string
+func (input *UserWhereInput) relationExpr() *zenithdb.FilterExpr {
+	if input == nil {
+		return nil
+	}
+	expr := input.expr()
+	return &expr
 }
 
-func (input PostCreateInput) record() zenithdb.Record {
-	return zenithdb.Record{
-		"id":       input.ID,
-		"authorId": input.AuthorID,
-		"title":    input.Title,
+type UserRelationFilter struct {
+	Is    *UserWhereInput
+	IsNot *UserWhereInput
+}
+
+func (input UserRelationFilter) filter() zenithdb.RelationFilter {
+	return zenithdb.RelationFilter{Is: input.Is.relationExpr(), IsNot: input.IsNot.relationExpr()}
+}
+
+func (input UserWhereInput) index() string {
+	if input.Email != nil {
+		return "user_email_uniq"
 	}
+	return ""
 }
 
-func recordToPost(record zenithdb.Record) Post {
-	return Post{
-		ID:       record["id"].(string),
-		AuthorID: record["authorId"].(string),
-		Title:    record["title"].(string),
+type UserInclude struct {
+	Posts             bool
+	PostsArgs         *PostFindManyArgs
+	RelationCount     bool
+	RelationCountArgs *UserRelationCountSelect
+}
+
+func (input *UserInclude) include() map[string]zenithdb.Include {
+	if input == nil {
+		return nil
+	}
+	include := make(map[string]zenithdb.Include)
+	if input.PostsArgs != nil {
+		include["posts"] = zenithdb.Include{Query: input.PostsArgs.query()}
+	} else if input.Posts {
+		include["posts"] = zenithdb.Include{}
 	}
+	if input.RelationCountArgs != nil {
+		include[zenithdb.CountField] = zenithdb.Include{Query: zenithdb.Query{Select: input.RelationCountArgs.fields()}}
+	} else if input.RelationCount {
+		include[zenithdb.CountField] = zenithdb.Include{}
+	}
+	return include
 }
 
-type PostClient struct {
-	db *zenithdb.DB
+func (input *UserInclude) narrowed() bool {
+	if input == nil {
+		return false
+	}
+	return input.PostsArgs != nil || input.RelationCount || input.RelationCountArgs != nil
 }
 
-func (c PostClient) Create(ctx context.Context, input PostCreateInput) (Post, error) {
-	_, err := c.db.Create(ctx, "Post", input.record())
+type UserIncludeArgs struct {
+	Select  *UserSelect
+	Include *UserInclude
+}
+
+func (input *UserIncludeArgs) query() zenithdb.Query {
+	return zenithdb.Query{Include: input.Include.include(), Select: input.Select.fields()}
+}
+
+type UserSelect struct {
+	ID    bool
+	Email bool
+	Name  bool
+	Posts bool
+}
+
+func (input *UserSelect) fields() []string {
+	if input == nil {
+		return nil
+	}
+	var fields []string
+	if input.ID {
+		fields = append(fields, "id")
+	}
+	if input.Email {
+		fields = append(fields, "email")
+	}
+	if input.Name {
+		fields = append(fields, "name")
+	}
+	if input.Posts {
+		fields = append(fields, "posts")
+	}
+	return fields
+}
+
+type UserFindUniqueArgs struct {
+	Where   UserWhereUniqueInput
+	Include *UserInclude
+	Select  *UserSelect
+}
+
+type UserFindManyArgs struct {
+	Where   UserWhereInput
+	Filters map[string]zenithdb.Filter
+	OrderBy []zenithdb.OrderBy
+	Cursor  UserWhereUniqueInput
+	Include *UserInclude
+	Select  *UserSelect
+	Skip    int
+	Take    int
+}
+
+func (args UserFindManyArgs) query() zenithdb.Query {
+	return zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Include: args.Include.include(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy, Select: args.Select.fields()}
+}
+
+type UserAggregateArgs struct {
+	Where    UserWhereInput
+	Filters  map[string]zenithdb.Filter
+	OrderBy  []zenithdb.OrderBy
+	Cursor   UserWhereUniqueInput
+	Skip     int
+	Take     int
+	CountAll bool
+	Count    []string
+	Sum      []string
+	Avg      []string
+	Min      []string
+	Max      []string
+}
+
+type UserGroupByArgs struct {
+	By       []string
+	Where    UserWhereInput
+	Filters  map[string]zenithdb.Filter
+	CountAll bool
+	Count    []string
+	Sum      []string
+	Avg      []string
+	Min      []string
+	Max      []string
+	Having   []zenithdb.Having
+	OrderBy  []zenithdb.GroupOrderBy
+	Skip     int
+	Take     int
+}
+
+type UserUpdateManyArgs struct {
+	Where   UserWhereInput
+	Filters map[string]zenithdb.Filter
+	Data    UserUpdateInput
+	Take    int
+}
+
+type UserDeleteManyArgs struct {
+	Where   UserWhereInput
+	Filters map[string]zenithdb.Filter
+	Take    int
+}
+
+type UserUpdateArgs struct {
+	Where   UserWhereUniqueInput
+	Data    UserUpdateInput
+	Include *UserInclude
+}
+
+type UserUpsertArgs struct {
+	Where   UserWhereUniqueInput
+	Create  UserCreateInput
+	Update  UserUpdateInput
+	Include *UserInclude
+}
+
+type UserDeleteArgs struct {
+	Where   UserWhereUniqueInput
+	Include *UserInclude
+}
+
+type UserCreateOrConnectInput struct {
+	Where  UserWhereUniqueInput
+	Create UserCreateInput
+}
+
+func (input UserCreateOrConnectInput) write() zenithdb.ConnectOrCreate {
+	return zenithdb.ConnectOrCreate{Where: input.Where.where(), Create: input.Create.record()}
+}
+
+type UserCreateNestedOneInput struct {
+	Create          *UserCreateInput
+	Connect         *UserWhereUniqueInput
+	ConnectOrCreate *UserCreateOrConnectInput
+}
+
+func (input *UserCreateNestedOneInput) write() zenithdb.NestedWrite {
+	var write zenithdb.NestedWrite
+	if input.Create != nil {
+		write.Create = []zenithdb.Record{input.Create.record()}
+	}
+	if input.Connect != nil {
+		write.Connect = []map[string]any{input.Connect.where()}
+	}
+	if input.ConnectOrCreate != nil {
+		write.ConnectOrCreate = []zenithdb.ConnectOrCreate{input.ConnectOrCreate.write()}
+	}
+	return write
+}
+
+type UserUpdateNestedOneInput struct {
+	Create          *UserCreateInput
+	Connect         *UserWhereUniqueInput
+	ConnectOrCreate *UserCreateOrConnectInput
+	Disconnect      bool
+	Update          *UserUpdateInput
+	Delete          bool
+}
+
+func (input *UserUpdateNestedOneInput) write() zenithdb.NestedWrite {
+	write := (&UserCreateNestedOneInput{Create: input.Create, Connect: input.Connect, ConnectOrCreate: input.ConnectOrCreate}).write()
+	if input.Disconnect {
+		write.Disconnect = []map[string]any{nil}
+	}
+	if input.Update != nil {
+		write.Update = []zenithdb.NestedUpdate{{Data: input.Update.record()}}
+	}
+	if input.Delete {
+		write.Delete = []map[string]any{nil}
+	}
+	return write
+}
+
+func recordToUser(record zenithdb.Record) User {
+	result := User{
+		ID:    recordValue[string](record, "id"),
+		Email: recordValue[string](record, "email"),
+		Name:  recordValue[string](record, "name"),
+	}
+	if raw, ok := record["posts"].([]zenithdb.Record); ok {
+		result.Posts = make([]Post, 0, len(raw))
+		for _, item := range raw {
+			converted := recordToPost(item)
+			result.Posts = append(result.Posts, converted)
+		}
+	}
+	if raw, ok := record[zenithdb.CountField].(zenithdb.Record); ok {
+		result.RelationCount = &UserRelationCount{
+			Posts: recordValue[int64](raw, "posts"),
+		}
+	}
+	return result
+}
+
+type userStore struct {
+	byID    map[string]User
+	byEmail map[string]string
+}
+
+func newUserStore() *userStore {
+	return &userStore{
+		byID:    make(map[string]User),
+		byEmail: make(map[string]string),
+	}
+}
+
+func (s *userStore) put(record User) {
+	s.byID[record.ID] = record
+	s.byEmail[record.Email] = record.ID
+}
+
+func (s *userStore) remove(record User) {
+	delete(s.byID, record.ID)
+	delete(s.byEmail, record.Email)
+}
+
+func (s *userStore) replace(previous User, next User) {
+	s.remove(previous)
+	s.put(next)
+}
+
+func (s *userStore) findByID(value string) (User, bool) {
+	record, ok := s.byID[value]
+	return record, ok
+}
+
+func (s *userStore) findByEmail(value string) (User, bool) {
+	primaryKey, ok := s.byEmail[value]
+	if !ok {
+		return User{}, false
+	}
+	return s.findByID(primaryKey)
+}
+
+type UserClient struct {
+	client *Client
+}
+
+func (c UserClient) Create(ctx context.Context, input UserCreateInput) (User, error) {
+	created, err := c.client.db.Create(ctx, "User", input.record())
 	if err != nil {
-		return Post{}, err
+		return User{}, err
+	}
+	record := recordToUser(created.Record)
+	if input.nested() {
+		stored, _, err := c.client.db.FindUnique(ctx, "User", map[string]any{"id": record.ID}, nil, nil)
+		if err != nil {
+			return User{}, err
+		}
+		return recordToUser(stored), nil
 	}
-	return recordToPost(input.record()), nil
+	return record, nil
 }
 
-func (c PostClient) FindUniqueByID(ctx context.Context, value string) (Post, bool, error) {
-	record, ok, err := c.db.FindUnique(ctx, "Post", map[string]any{"id": value}, nil)
-	if err != nil || !ok {
-		return Post{}, ok, err
+func (c UserClient) CreateMany(ctx context.Context, inputs []UserCreateInput) ([]User, error) {
+	records := make([]zenithdb.Record, 0, len(inputs))
+	for _, input := range inputs {
+		records = append(records, input.record())
 	}
-	return recordToPost(record), true, nil
+	created, err := c.client.db.CreateMany(ctx, "User", records)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]User, 0, len(inputs))
+	for i, input := range inputs {
+		record := recordToUser(created[i].Record)
+		if input.nested() {
+			stored, _, err := c.client.db.FindUnique(ctx, "User", map[string]any{"id": record.ID}, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			record = recordToUser(stored)
+		}
+		result = append(result, record)
+	}
+	return result, nil
 }
 
-func (c PostClient) FindManyByAuthorID(ctx context.Context, value string, limit int) ([]Post, error) {
-	records, err := c.db.FindMany(ctx, "Post", zenithdb.Query{Where: map[string]any{"authorId": value}, Index: "post_authorid_idx", Limit: limit})
+func (c UserClient) FindUnique(ctx context.Context, args UserFindUniqueArgs) (User, bool, error) {
+	if c.client.remote || args.Select != nil || args.Include.narrowed() {
+		where := args.Where.where()
+		if where == nil {
+			return User{}, false, nil
+		}
+		record, ok, err := c.client.db.FindUnique(ctx, "User", where, args.Include.include(), args.Select.fields())
+		if err != nil || !ok {
+			return User{}, ok, err
+		}
+		return recordToUser(record), true, nil
+	}
+	if args.Where.ID != "" {
+		record, ok := c.client.userStore.findByID(args.Where.ID)
+		if !ok {
+			return User{}, false, nil
+		}
+		c.client.includeUser(&record, args.Include)
+		return record, true, nil
+	}
+	if args.Where.Email != "" {
+		record, ok := c.client.userStore.findByEmail(args.Where.Email)
+		if !ok {
+			return User{}, false, nil
+		}
+		c.client.includeUser(&record, args.Include)
+		return record, true, nil
+	}
+	return User{}, false, nil
+}
+
+func (c UserClient) FindMany(ctx context.Context, args UserFindManyArgs) ([]User, error) {
+	if c.client.remote || args.Select != nil || args.Include.narrowed() || len(args.Filters) > 0 || args.Where.filterExpr() != nil || len(args.OrderBy) > 0 || args.Skip > 0 || args.Cursor.where() != nil {
+		records, err := c.client.db.FindMany(ctx, "User", args.query())
+		if err != nil {
+			return nil, err
+		}
+		result := make([]User, 0, len(records))
+		for _, record := range records {
+			result = append(result, recordToUser(record))
+		}
+		return result, nil
+	}
+	if args.Where.ID != nil {
+		record, ok := c.client.userStore.findByID(*args.Where.ID)
+		if !ok {
+			return nil, nil
+		}
+		c.client.includeUser(&record, args.Include)
+		return []User{record}, nil
+	}
+	if args.Where.Email != nil {
+		record, ok := c.client.userStore.findByEmail(*args.Where.Email)
+		if !ok {
+			return nil, nil
+		}
+		c.client.includeUser(&record, args.Include)
+		return []User{record}, nil
+	}
+	records, err := c.client.db.FindMany(ctx, "User", args.query())
 	if err != nil {
 		return nil, err
 	}
-	result := make([]Post, 0, len(records))
+	result := make([]User, 0, len(records))
 	for _, record := range records {
-		result = append(result, recordToPost(record))
+		converted := recordToUser(record)
+		c.client.includeUser(&converted, args.Include)
+		result = append(result, converted)
 	}
 	return result, nil
 }
+
+func (c UserClient) Iterate(ctx context.Context, args UserFindManyArgs) iter.Seq2[User, error] {
+	return func(yield func(User, error) bool) {
+		for record, err := range c.client.db.Iterate(ctx, "User", args.query()) {
+			if err != nil {
+				yield(User{}, err)
+				return
+			}
+			if !yield(recordToUser(record), nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c UserClient) Count(ctx context.Context, args UserFindManyArgs) (int, error) {
+	return c.client.db.Count(ctx, "User", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index()})
+}
+
+func (c UserClient) Aggregate(ctx context.Context, args UserAggregateArgs) (zenithdb.AggregateResult, error) {
+	return c.client.db.Aggregate(ctx, "User", zenithdb.AggregateQuery{
+		Query:    zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy},
+		CountAll: args.CountAll,
+		Count:    args.Count,
+		Sum:      args.Sum,
+		Avg:      args.Avg,
+		Min:      args.Min,
+		Max:      args.Max,
+	})
+}
+
+func (c UserClient) GroupBy(ctx context.Context, args UserGroupByArgs) ([]zenithdb.Group, error) {
+	return c.client.db.GroupBy(ctx, "User", zenithdb.GroupByQuery{
+		AggregateQuery: zenithdb.AggregateQuery{
+			Query:    zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index()},
+			CountAll: args.CountAll,
+			Count:    args.Count,
+			Sum:      args.Sum,
+			Avg:      args.Avg,
+			Min:      args.Min,
+			Max:      args.Max,
+		},
+		By:      args.By,
+		Having:  args.Having,
+		OrderBy: args.OrderBy,
+		Skip:    args.Skip,
+		Limit:   args.Take,
+	})
+}
+
+func (c UserClient) UpdateMany(ctx context.Context, args UserUpdateManyArgs) (zenithdb.ManyResult, error) {
+	return c.client.db.UpdateMany(ctx, "User", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take}, args.Data.record())
+}
+
+func (c UserClient) DeleteMany(ctx context.Context, args UserDeleteManyArgs) (zenithdb.ManyResult, error) {
+	return c.client.db.DeleteMany(ctx, "User", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take})
+}
+
+func (c UserClient) Update(ctx context.Context, args UserUpdateArgs) (User, bool, error) {
+	if c.client.remote {
+		updatedRecord, err := c.client.db.Update(ctx, "User", args.Where.where(), args.Data.record())
+		if err != nil {
+			return User{}, false, err
+		}
+		if args.Include != nil {
+			record, ok, err := c.client.db.FindUnique(ctx, "User", args.Where.where(), args.Include.include(), nil)
+			if err != nil || !ok {
+				return User{}, ok, err
+			}
+			return recordToUser(record), true, nil
+		}
+		return recordToUser(updatedRecord), true, nil
+	}
+	if _, ok, err := c.FindUnique(ctx, UserFindUniqueArgs{Where: args.Where}); err != nil || !ok {
+		return User{}, ok, err
+	}
+	updatedRecord, err := c.client.db.Update(ctx, "User", args.Where.where(), args.Data.record())
+	if err != nil {
+		return User{}, false, err
+	}
+	updated := recordToUser(updatedRecord)
+	if args.Include.narrowed() {
+		record, ok, err := c.client.db.FindUnique(ctx, "User", map[string]any{"id": updated.ID}, args.Include.include(), nil)
+		if err != nil || !ok {
+			return User{}, false, err
+		}
+		return recordToUser(record), true, nil
+	}
+	c.client.includeUser(&updated, args.Include)
+	return updated, true, nil
+}
+
+func (c UserClient) Upsert(ctx context.Context, args UserUpsertArgs) (User, bool, error) {
+	if c.client.remote {
+		record, created, err := c.client.db.Upsert(ctx, "User", args.Where.where(), args.Create.record(), args.Update.record())
+		if err != nil {
+			return User{}, false, err
+		}
+		if args.Include != nil {
+			recordWithInclude, ok, err := c.client.db.FindUnique(ctx, "User", args.Where.where(), args.Include.include(), nil)
+			if err == nil && ok {
+				record = recordWithInclude
+			}
+		}
+		return recordToUser(record), created, nil
+	}
+	record, created, err := c.client.db.Upsert(ctx, "User", args.Where.where(), args.Create.record(), args.Update.record())
+	if err != nil {
+		return User{}, false, err
+	}
+	converted := recordToUser(record)
+	if args.Include.narrowed() {
+		record, ok, err := c.client.db.FindUnique(ctx, "User", map[string]any{"id": converted.ID}, args.Include.include(), nil)
+		if err != nil || !ok {
+			return User{}, false, err
+		}
+		return recordToUser(record), created, nil
+	}
+	c.client.includeUser(&converted, args.Include)
+	return converted, created, nil
+}
+
+func (c UserClient) Delete(ctx context.Context, args UserDeleteArgs) (User, bool, error) {
+	if c.client.remote {
+		previous, ok, err := c.FindUnique(ctx, UserFindUniqueArgs{Where: args.Where, Include: args.Include})
+		if err != nil || !ok {
+			return User{}, ok, err
+		}
+		_, err = c.client.db.Delete(ctx, "User", args.Where.where())
+		if err != nil {
+			return User{}, false, err
+		}
+		return previous, true, nil
+	}
+	lookup := UserFindUniqueArgs{Where: args.Where}
+	if args.Include.narrowed() {
+		lookup.Include = args.Include
+	}
+	previous, ok, err := c.FindUnique(ctx, lookup)
+	if err != nil || !ok {
+		return User{}, ok, err
+	}
+	_, err = c.client.db.Delete(ctx, "User", args.Where.where())
+	if err != nil {
+		return User{}, false, err
+	}
+	if lookup.Include == nil {
+		c.client.includeUser(&previous, args.Include)
+	}
+	return previous, true, nil
+}
+
+func (c UserClient) FindUniqueByID(ctx context.Context, value string) (User, bool, error) {
+	if c.client.remote {
+		record, ok, err := c.client.db.FindUnique(ctx, "User", map[string]any{"id": value}, nil, nil)
+		if err != nil || !ok {
+			return User{}, ok, err
+		}
+		return recordToUser(record), true, nil
+	}
+	record, ok := c.client.userStore.findByID(value)
+	return record, ok, nil
+}
+
+func (c UserClient) FindUniqueByEmail(ctx context.Context, value string) (User, bool, error) {
+	if c.client.remote {
+		record, ok, err := c.client.db.FindUnique(ctx, "User", map[string]any{"email": value}, nil, nil)
+		if err != nil || !ok {
+			return User{}, ok, err
+		}
+		return recordToUser(record), true, nil
+	}
+	record, ok := c.client.userStore.findByEmail(value)
+	return record, ok, nil
+}
+
+type UserTxClient struct {
+	tx *Tx
+}
+
+func (c UserTxClient) Create(ctx context.Context, input UserCreateInput) (User, error) {
+	created, err := c.tx.tx.Create(ctx, "User", input.record())
+	if err != nil {
+		return User{}, err
+	}
+	record := recordToUser(created.Record)
+	if input.nested() {
+		stored, _, err := c.tx.tx.FindUnique(ctx, "User", map[string]any{"id": record.ID}, nil, nil)
+		if err != nil {
+			return User{}, err
+		}
+		return recordToUser(stored), nil
+	}
+	return record, nil
+}
+
+func (c UserTxClient) FindUnique(ctx context.Context, args UserFindUniqueArgs) (User, bool, error) {
+	where := args.Where.where()
+	if where == nil {
+		return User{}, false, nil
+	}
+	record, ok, err := c.tx.tx.FindUnique(ctx, "User", where, args.Include.include(), args.Select.fields())
+	if err != nil || !ok {
+		return User{}, ok, err
+	}
+	return recordToUser(record), true, nil
+}
+
+func (c UserTxClient) FindMany(ctx context.Context, args UserFindManyArgs) ([]User, error) {
+	records, err := c.tx.tx.FindMany(ctx, "User", args.query())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]User, 0, len(records))
+	for _, record := range records {
+		result = append(result, recordToUser(record))
+	}
+	return result, nil
+}
+
+func (c UserTxClient) Update(ctx context.Context, args UserUpdateArgs) (User, bool, error) {
+	if _, ok, err := c.FindUnique(ctx, UserFindUniqueArgs{Where: args.Where}); err != nil || !ok {
+		return User{}, ok, err
+	}
+	updatedRecord, err := c.tx.tx.Update(ctx, "User", args.Where.where(), args.Data.record())
+	if err != nil {
+		return User{}, false, err
+	}
+	if args.Include != nil {
+		return c.FindUnique(ctx, UserFindUniqueArgs{Where: args.Where, Include: args.Include})
+	}
+	return recordToUser(updatedRecord), true, nil
+}
+
+func (c UserTxClient) Upsert(ctx context.Context, args UserUpsertArgs) (User, bool, error) {
+	record, created, err := c.tx.tx.Upsert(ctx, "User", args.Where.where(), args.Create.record(), args.Update.record())
+	if err != nil {
+		return User{}, false, err
+	}
+	converted := recordToUser(record)
+	if args.Include != nil {
+		recordWithInclude, ok, err := c.FindUnique(ctx, UserFindUniqueArgs{Where: args.Where, Include: args.Include})
+		if err == nil && ok {
+			converted = recordWithInclude
+		}
+	}
+	return converted, created, nil
+}
+
+func (c UserTxClient) Delete(ctx context.Context, args UserDeleteArgs) (User, bool, error) {
+	previous, ok, err := c.FindUnique(ctx, UserFindUniqueArgs{Where: args.Where, Include: args.Include})
+	if err != nil || !ok {
+		return User{}, ok, err
+	}
+	_, err = c.tx.tx.Delete(ctx, "User", args.Where.where())
+	if err != nil {
+		return User{}, false, err
+	}
+	return previous, true, nil
+}
+
+type Post struct {
+	ID       string `json:"id"`
+	AuthorID string `json:"authorId"`
+	Title    string `json:"title"`
+	Author   *User  `json:"author"`
+}
+
+type PostCreateInput struct {
+	ID       string
+	AuthorID string
+	Title    string
+	Author   *UserCreateNestedOneInput
+}
+
+type PostUpdateInput struct {
+	AuthorID *string
+	Title    *string
+	Author   *UserUpdateNestedOneInput
+}
+
+func (input PostCreateInput) record() zenithdb.Record {
+	record := zenithdb.Record{
+		"id":       input.ID,
+		"authorId": input.AuthorID,
+		"title":    input.Title,
+	}
+	if input.Author != nil {
+		record["author"] = input.Author.write()
+	}
+	return record
+}
+
+// nested reports whether the input writes related records.
+func (input PostCreateInput) nested() bool {
+	return input.Author != nil
+}
+
+// nested reports whether the input writes related records.
+func (input PostUpdateInput) nested() bool {
+	return input.Author != nil
+}
+
+func (input PostUpdateInput) record() zenithdb.Record {
+	record := zenithdb.Record{}
+	if input.AuthorID != nil {
+		record["authorId"] = *input.AuthorID
+	}
+	if input.Title != nil {
+		record["title"] = *input.Title
+	}
+	if input.Author != nil {
+		record["author"] = input.Author.write()
+	}
+	return record
+}
+
+// Validate checks the fields the input sets against their validation rules.
+func (input PostCreateInput) Validate() error {
+	return nil
+}
+
+// Validate checks the fields the input sets against their validation rules.
+func (input PostUpdateInput) Validate() error {
+	return nil
+}
+
+type PostWhereUniqueInput struct {
+	ID string
+}
+
+func (input PostWhereUniqueInput) where() map[string]any {
+	if input.ID != "" {
+		return map[string]any{"id": input.ID}
+	}
+	return nil
+}
+
+type PostWhereInput struct {
+	ID       *string
+	AuthorID *string
+	Title    *string
+	Author   *UserRelationFilter
+	AND      []PostWhereInput
+	OR       []PostWhereInput
+	NOT      *PostWhereInput
+}
+
+func (input PostWhereInput) where() map[string]any {
+	where := make(map[string]any)
+	if input.ID != nil {
+		where["id"] = *input.ID
+	}
+	if input.AuthorID != nil {
+		where["authorId"] = *input.AuthorID
+	}
+	if input.Title != nil {
+		where["title"] = *input.Title
+	}
+	return where
+}
+
+func (input PostWhereInput) filterExpr() *zenithdb.FilterExpr {
+	if len(input.AND) == 0 && len(input.OR) == 0 && input.NOT == nil && input.Author == nil {
+		return nil
+	}
+	expr := &zenithdb.FilterExpr{}
+	if input.Author != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Relation: "author", RelationFilter: input.Author.filter()})
+	}
+	for _, child := range input.AND {
+		expr.And = append(expr.And, child.expr())
+	}
+	for _, child := range input.OR {
+		expr.Or = append(expr.Or, child.expr())
+	}
+	if input.NOT != nil {
+		not := input.NOT.expr()
+		expr.Not = &not
+	}
+	return expr
+}
+
+func (input PostWhereInput) expr() zenithdb.FilterExpr {
+	expr := zenithdb.FilterExpr{}
+	if input.ID != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "id", Filter: zenithdb.Filter{Equals: *input.ID}})
+	}
+	if input.AuthorID != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "authorId", Filter: zenithdb.Filter{Equals: *input.AuthorID}})
+	}
+	if input.Title != nil {
+		expr.And = append(expr.And, zenithdb.FilterExpr{Field: "title", Filter: zenithdb.Filter{Equals: *input.Title}})
+	}
+	if nested := input.filterExpr(); nested != nil {
+		expr.And = append(expr.And, *nested)
+	}
+	return expr
+}
+
+func (input *PostWhereInput) relationExpr() *zenithdb.FilterExpr {
+	if input == nil {
+		return nil
+	}
+	expr := input.expr()
+	return &expr
+}
+
+type PostListRelationFilter struct {
+	Some  *PostWhereInput
+	Every *PostWhereInput
+	None  *PostWhereInput
+}
+
+func (input PostListRelationFilter) filter() zenithdb.RelationFilter {
+	return zenithdb.RelationFilter{Some: input.Some.relationExpr(), Every: input.Every.relationExpr(), None: input.None.relationExpr()}
+}
+
+func (input PostWhereInput) index() string {
+	if input.AuthorID != nil {
+		return "post_authorid_idx"
+	}
+	return ""
+}
+
+type PostInclude struct {
+	Author     bool
+	AuthorArgs *UserIncludeArgs
+}
+
+func (input *PostInclude) include() map[string]zenithdb.Include {
+	if input == nil {
+		return nil
+	}
+	include := make(map[string]zenithdb.Include)
+	if input.AuthorArgs != nil {
+		include["author"] = zenithdb.Include{Query: input.AuthorArgs.query()}
+	} else if input.Author {
+		include["author"] = zenithdb.Include{}
+	}
+	return include
+}
+
+func (input *PostInclude) narrowed() bool {
+	if input == nil {
+		return false
+	}
+	return input.AuthorArgs != nil
+}
+
+type PostIncludeArgs struct {
+	Select  *PostSelect
+	Include *PostInclude
+}
+
+func (input *PostIncludeArgs) query() zenithdb.Query {
+	return zenithdb.Query{Include: input.Include.include(), Select: input.Select.fields()}
+}
+
+type PostSelect struct {
+	ID       bool
+	AuthorID bool
+	Title    bool
+	Author   bool
+}
+
+func (input *PostSelect) fields() []string {
+	if input == nil {
+		return nil
+	}
+	var fields []string
+	if input.ID {
+		fields = append(fields, "id")
+	}
+	if input.AuthorID {
+		fields = append(fields, "authorId")
+	}
+	if input.Title {
+		fields = append(fields, "title")
+	}
+	if input.Author {
+		fields = append(fields, "author")
+	}
+	return fields
+}
+
+type PostFindUniqueArgs struct {
+	Where   PostWhereUniqueInput
+	Include *PostInclude
+	Select  *PostSelect
+}
+
+type PostFindManyArgs struct {
+	Where   PostWhereInput
+	Filters map[string]zenithdb.Filter
+	OrderBy []zenithdb.OrderBy
+	Cursor  PostWhereUniqueInput
+	Include *PostInclude
+	Select  *PostSelect
+	Skip    int
+	Take    int
+}
+
+func (args PostFindManyArgs) query() zenithdb.Query {
+	return zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Include: args.Include.include(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy, Select: args.Select.fields()}
+}
+
+type PostAggregateArgs struct {
+	Where    PostWhereInput
+	Filters  map[string]zenithdb.Filter
+	OrderBy  []zenithdb.OrderBy
+	Cursor   PostWhereUniqueInput
+	Skip     int
+	Take     int
+	CountAll bool
+	Count    []string
+	Sum      []string
+	Avg      []string
+	Min      []string
+	Max      []string
+}
+
+type PostGroupByArgs struct {
+	By       []string
+	Where    PostWhereInput
+	Filters  map[string]zenithdb.Filter
+	CountAll bool
+	Count    []string
+	Sum      []string
+	Avg      []string
+	Min      []string
+	Max      []string
+	Having   []zenithdb.Having
+	OrderBy  []zenithdb.GroupOrderBy
+	Skip     int
+	Take     int
+}
+
+type PostUpdateManyArgs struct {
+	Where   PostWhereInput
+	Filters map[string]zenithdb.Filter
+	Data    PostUpdateInput
+	Take    int
+}
+
+type PostDeleteManyArgs struct {
+	Where   PostWhereInput
+	Filters map[string]zenithdb.Filter
+	Take    int
+}
+
+type PostUpdateArgs struct {
+	Where   PostWhereUniqueInput
+	Data    PostUpdateInput
+	Include *PostInclude
+}
+
+type PostUpsertArgs struct {
+	Where   PostWhereUniqueInput
+	Create  PostCreateInput
+	Update  PostUpdateInput
+	Include *PostInclude
+}
+
+type PostDeleteArgs struct {
+	Where   PostWhereUniqueInput
+	Include *PostInclude
+}
+
+type PostCreateOrConnectInput struct {
+	Where  PostWhereUniqueInput
+	Create PostCreateInput
+}
+
+func (input PostCreateOrConnectInput) write() zenithdb.ConnectOrCreate {
+	return zenithdb.ConnectOrCreate{Where: input.Where.where(), Create: input.Create.record()}
+}
+
+type PostUpdateWithWhereUniqueInput struct {
+	Where PostWhereUniqueInput
+	Data  PostUpdateInput
+}
+
+type PostCreateNestedManyInput struct {
+	Create          []PostCreateInput
+	Connect         []PostWhereUniqueInput
+	ConnectOrCreate []PostCreateOrConnectInput
+}
+
+func (input *PostCreateNestedManyInput) write() zenithdb.NestedWrite {
+	var write zenithdb.NestedWrite
+	for _, create := range input.Create {
+		write.Create = append(write.Create, create.record())
+	}
+	for _, where := range input.Connect {
+		write.Connect = append(write.Connect, where.where())
+	}
+	for _, connectOrCreate := range input.ConnectOrCreate {
+		write.ConnectOrCreate = append(write.ConnectOrCreate, connectOrCreate.write())
+	}
+	return write
+}
+
+// PostUpdateNestedManyInput writes the Post records a relation connects to.
+// A non-nil Set, even an empty one, connects exactly the records it lists.
+type PostUpdateNestedManyInput struct {
+	Create          []PostCreateInput
+	Connect         []PostWhereUniqueInput
+	ConnectOrCreate []PostCreateOrConnectInput
+	Disconnect      []PostWhereUniqueInput
+	Set             []PostWhereUniqueInput
+	Update          []PostUpdateWithWhereUniqueInput
+	Delete          []PostWhereUniqueInput
+}
+
+func (input *PostUpdateNestedManyInput) write() zenithdb.NestedWrite {
+	write := (&PostCreateNestedManyInput{Create: input.Create, Connect: input.Connect, ConnectOrCreate: input.ConnectOrCreate}).write()
+	for _, where := range input.Disconnect {
+		write.Disconnect = append(write.Disconnect, where.where())
+	}
+	if input.Set != nil {
+		write.Set = make([]map[string]any, 0, len(input.Set))
+	}
+	for _, where := range input.Set {
+		write.Set = append(write.Set, where.where())
+	}
+	for _, update := range input.Update {
+		write.Update = append(write.Update, zenithdb.NestedUpdate{Where: update.Where.where(), Data: update.Data.record()})
+	}
+	for _, where := range input.Delete {
+		write.Delete = append(write.Delete, where.where())
+	}
+	return write
+}
+
+func recordToPost(record zenithdb.Record) Post {
+	result := Post{
+		ID:       recordValue[string](record, "id"),
+		AuthorID: recordValue[string](record, "authorId"),
+		Title:    recordValue[string](record, "title"),
+	}
+	if raw, ok := record["author"].(zenithdb.Record); ok {
+		converted := recordToUser(raw)
+		result.Author = &converted
+	}
+	return result
+}
+
+type postStore struct {
+	byID       map[string]Post
+	byAuthorID map[string][]string
+}
+
+func newPostStore() *postStore {
+	return &postStore{
+		byID:       make(map[string]Post),
+		byAuthorID: make(map[string][]string),
+	}
+}
+
+func (s *postStore) put(record Post) {
+	s.byID[record.ID] = record
+	s.byAuthorID[record.AuthorID] = append(s.byAuthorID[record.AuthorID], record.ID)
+}
+
+func (s *postStore) remove(record Post) {
+	delete(s.byID, record.ID)
+	ids := s.byAuthorID[record.AuthorID]
+	for i, id := range ids {
+		if id == record.ID {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(s.byAuthorID, record.AuthorID)
+	} else {
+		s.byAuthorID[record.AuthorID] = ids
+	}
+}
+
+func (s *postStore) replace(previous Post, next Post) {
+	s.remove(previous)
+	s.put(next)
+}
+
+func (s *postStore) findByID(value string) (Post, bool) {
+	record, ok := s.byID[value]
+	return record, ok
+}
+
+func (s *postStore) findManyByAuthorID(value string, limit int) []Post {
+	ids := s.byAuthorID[value]
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+	result := make([]Post, 0, len(ids))
+	for _, id := range ids {
+		if record, ok := s.findByID(id); ok {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+type PostClient struct {
+	client *Client
+}
+
+func (c PostClient) Create(ctx context.Context, input PostCreateInput) (Post, error) {
+	created, err := c.client.db.Create(ctx, "Post", input.record())
+	if err != nil {
+		return Post{}, err
+	}
+	record := recordToPost(created.Record)
+	if input.nested() {
+		stored, _, err := c.client.db.FindUnique(ctx, "Post", map[string]any{"id": record.ID}, nil, nil)
+		if err != nil {
+			return Post{}, err
+		}
+		return recordToPost(stored), nil
+	}
+	return record, nil
+}
+
+func (c PostClient) CreateMany(ctx context.Context, inputs []PostCreateInput) ([]Post, error) {
+	records := make([]zenithdb.Record, 0, len(inputs))
+	for _, input := range inputs {
+		records = append(records, input.record())
+	}
+	created, err := c.client.db.CreateMany(ctx, "Post", records)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Post, 0, len(inputs))
+	for i, input := range inputs {
+		record := recordToPost(created[i].Record)
+		if input.nested() {
+			stored, _, err := c.client.db.FindUnique(ctx, "Post", map[string]any{"id": record.ID}, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			record = recordToPost(stored)
+		}
+		result = append(result, record)
+	}
+	return result, nil
+}
+
+func (c PostClient) FindUnique(ctx context.Context, args PostFindUniqueArgs) (Post, bool, error) {
+	if c.client.remote || args.Select != nil || args.Include.narrowed() {
+		where := args.Where.where()
+		if where == nil {
+			return Post{}, false, nil
+		}
+		record, ok, err := c.client.db.FindUnique(ctx, "Post", where, args.Include.include(), args.Select.fields())
+		if err != nil || !ok {
+			return Post{}, ok, err
+		}
+		return recordToPost(record), true, nil
+	}
+	if args.Where.ID != "" {
+		record, ok := c.client.postStore.findByID(args.Where.ID)
+		if !ok {
+			return Post{}, false, nil
+		}
+		c.client.includePost(&record, args.Include)
+		return record, true, nil
+	}
+	return Post{}, false, nil
+}
+
+func (c PostClient) FindMany(ctx context.Context, args PostFindManyArgs) ([]Post, error) {
+	if c.client.remote || args.Select != nil || args.Include.narrowed() || len(args.Filters) > 0 || args.Where.filterExpr() != nil || len(args.OrderBy) > 0 || args.Skip > 0 || args.Cursor.where() != nil {
+		records, err := c.client.db.FindMany(ctx, "Post", args.query())
+		if err != nil {
+			return nil, err
+		}
+		result := make([]Post, 0, len(records))
+		for _, record := range records {
+			result = append(result, recordToPost(record))
+		}
+		return result, nil
+	}
+	if args.Where.ID != nil {
+		record, ok := c.client.postStore.findByID(*args.Where.ID)
+		if !ok {
+			return nil, nil
+		}
+		c.client.includePost(&record, args.Include)
+		return []Post{record}, nil
+	}
+	if args.Where.AuthorID != nil {
+		result := c.client.postStore.findManyByAuthorID(*args.Where.AuthorID, args.Take)
+		for i := range result {
+			c.client.includePost(&result[i], args.Include)
+		}
+		return result, nil
+	}
+	records, err := c.client.db.FindMany(ctx, "Post", args.query())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Post, 0, len(records))
+	for _, record := range records {
+		converted := recordToPost(record)
+		c.client.includePost(&converted, args.Include)
+		result = append(result, converted)
+	}
+	return result, nil
+}
+
+func (c PostClient) Iterate(ctx context.Context, args PostFindManyArgs) iter.Seq2[Post, error] {
+	return func(yield func(Post, error) bool) {
+		for record, err := range c.client.db.Iterate(ctx, "Post", args.query()) {
+			if err != nil {
+				yield(Post{}, err)
+				return
+			}
+			if !yield(recordToPost(record), nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c PostClient) Count(ctx context.Context, args PostFindManyArgs) (int, error) {
+	return c.client.db.Count(ctx, "Post", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index()})
+}
+
+func (c PostClient) Aggregate(ctx context.Context, args PostAggregateArgs) (zenithdb.AggregateResult, error) {
+	return c.client.db.Aggregate(ctx, "Post", zenithdb.AggregateQuery{
+		Query:    zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take, Skip: args.Skip, Cursor: args.Cursor.where(), OrderBy: args.OrderBy},
+		CountAll: args.CountAll,
+		Count:    args.Count,
+		Sum:      args.Sum,
+		Avg:      args.Avg,
+		Min:      args.Min,
+		Max:      args.Max,
+	})
+}
+
+func (c PostClient) GroupBy(ctx context.Context, args PostGroupByArgs) ([]zenithdb.Group, error) {
+	return c.client.db.GroupBy(ctx, "Post", zenithdb.GroupByQuery{
+		AggregateQuery: zenithdb.AggregateQuery{
+			Query:    zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index()},
+			CountAll: args.CountAll,
+			Count:    args.Count,
+			Sum:      args.Sum,
+			Avg:      args.Avg,
+			Min:      args.Min,
+			Max:      args.Max,
+		},
+		By:      args.By,
+		Having:  args.Having,
+		OrderBy: args.OrderBy,
+		Skip:    args.Skip,
+		Limit:   args.Take,
+	})
+}
+
+func (c PostClient) UpdateMany(ctx context.Context, args PostUpdateManyArgs) (zenithdb.ManyResult, error) {
+	return c.client.db.UpdateMany(ctx, "Post", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take}, args.Data.record())
+}
+
+func (c PostClient) DeleteMany(ctx context.Context, args PostDeleteManyArgs) (zenithdb.ManyResult, error) {
+	return c.client.db.DeleteMany(ctx, "Post", zenithdb.Query{Where: args.Where.where(), Filters: args.Filters, FilterExpr: args.Where.filterExpr(), Index: args.Where.index(), Limit: args.Take})
+}
+
+func (c PostClient) Update(ctx context.Context, args PostUpdateArgs) (Post, bool, error) {
+	if c.client.remote {
+		updatedRecord, err := c.client.db.Update(ctx, "Post", args.Where.where(), args.Data.record())
+		if err != nil {
+			return Post{}, false, err
+		}
+		if args.Include != nil {
+			record, ok, err := c.client.db.FindUnique(ctx, "Post", args.Where.where(), args.Include.include(), nil)
+			if err != nil || !ok {
+				return Post{}, ok, err
+			}
+			return recordToPost(record), true, nil
+		}
+		return recordToPost(updatedRecord), true, nil
+	}
+	if _, ok, err := c.FindUnique(ctx, PostFindUniqueArgs{Where: args.Where}); err != nil || !ok {
+		return Post{}, ok, err
+	}
+	updatedRecord, err := c.client.db.Update(ctx, "Post", args.Where.where(), args.Data.record())
+	if err != nil {
+		return Post{}, false, err
+	}
+	updated := recordToPost(updatedRecord)
+	if args.Include.narrowed() {
+		record, ok, err := c.client.db.FindUnique(ctx, "Post", map[string]any{"id": updated.ID}, args.Include.include(), nil)
+		if err != nil || !ok {
+			return Post{}, false, err
+		}
+		return recordToPost(record), true, nil
+	}
+	c.client.includePost(&updated, args.Include)
+	return updated, true, nil
+}
+
+func (c PostClient) Upsert(ctx context.Context, args PostUpsertArgs) (Post, bool, error) {
+	if c.client.remote {
+		record, created, err := c.client.db.Upsert(ctx, "Post", args.Where.where(), args.Create.record(), args.Update.record())
+		if err != nil {
+			return Post{}, false, err
+		}
+		if args.Include != nil {
+			recordWithInclude, ok, err := c.client.db.FindUnique(ctx, "Post", args.Where.where(), args.Include.include(), nil)
+			if err == nil && ok {
+				record = recordWithInclude
+			}
+		}
+		return recordToPost(record), created, nil
+	}
+	record, created, err := c.client.db.Upsert(ctx, "Post", args.Where.where(), args.Create.record(), args.Update.record())
+	if err != nil {
+		return Post{}, false, err
+	}
+	converted := recordToPost(record)
+	if args.Include.narrowed() {
+		record, ok, err := c.client.db.FindUnique(ctx, "Post", map[string]any{"id": converted.ID}, args.Include.include(), nil)
+		if err != nil || !ok {
+			return Post{}, false, err
+		}
+		return recordToPost(record), created, nil
+	}
+	c.client.includePost(&converted, args.Include)
+	return converted, created, nil
+}
+
+func (c PostClient) Delete(ctx context.Context, args PostDeleteArgs) (Post, bool, error) {
+	if c.client.remote {
+		previous, ok, err := c.FindUnique(ctx, PostFindUniqueArgs{Where: args.Where, Include: args.Include})
+		if err != nil || !ok {
+			return Post{}, ok, err
+		}
+		_, err = c.client.db.Delete(ctx, "Post", args.Where.where())
+		if err != nil {
+			return Post{}, false, err
+		}
+		return previous, true, nil
+	}
+	lookup := PostFindUniqueArgs{Where: args.Where}
+	if args.Include.narrowed() {
+		lookup.Include = args.Include
+	}
+	previous, ok, err := c.FindUnique(ctx, lookup)
+	if err != nil || !ok {
+		return Post{}, ok, err
+	}
+	_, err = c.client.db.Delete(ctx, "Post", args.Where.where())
+	if err != nil {
+		return Post{}, false, err
+	}
+	if lookup.Include == nil {
+		c.client.includePost(&previous, args.Include)
+	}
+	return previous, true, nil
+}
+
+func (c PostClient) FindUniqueByID(ctx context.Context, value string) (Post, bool, error) {
+	if c.client.remote {
+		record, ok, err := c.client.db.FindUnique(ctx, "Post", map[string]any{"id": value}, nil, nil)
+		if err != nil || !ok {
+			return Post{}, ok, err
+		}
+		return recordToPost(record), true, nil
+	}
+	record, ok := c.client.postStore.findByID(value)
+	return record, ok, nil
+}
+
+func (c PostClient) FindManyByAuthorID(ctx context.Context, value string, limit int) ([]Post, error) {
+	if c.client.remote {
+		records, err := c.client.db.FindMany(ctx, "Post", zenithdb.Query{Where: map[string]any{"authorId": value}, Index: "post_authorid_idx", Limit: limit})
+		if err != nil {
+			return nil, err
+		}
+		result := make([]Post, 0, len(records))
+		for _, record := range records {
+			result = append(result, recordToPost(record))
+		}
+		return result, nil
+	}
+	return c.client.postStore.findManyByAuthorID(value, limit), nil
+}
+
+type PostTxClient struct {
+	tx *Tx
+}
+
+func (c PostTxClient) Create(ctx context.Context, input PostCreateInput) (Post, error) {
+	created, err := c.tx.tx.Create(ctx, "Post", input.record())
+	if err != nil {
+		return Post{}, err
+	}
+	record := recordToPost(created.Record)
+	if input.nested() {
+		stored, _, err := c.tx.tx.FindUnique(ctx, "Post", map[string]any{"id": record.ID}, nil, nil)
+		if err != nil {
+			return Post{}, err
+		}
+		return recordToPost(stored), nil
+	}
+	return record, nil
+}
+
+func (c PostTxClient) FindUnique(ctx context.Context, args PostFindUniqueArgs) (Post, bool, error) {
+	where := args.Where.where()
+	if where == nil {
+		return Post{}, false, nil
+	}
+	record, ok, err := c.tx.tx.FindUnique(ctx, "Post", where, args.Include.include(), args.Select.fields())
+	if err != nil || !ok {
+		return Post{}, ok, err
+	}
+	return recordToPost(record), true, nil
+}
+
+func (c PostTxClient) FindMany(ctx context.Context, args PostFindManyArgs) ([]Post, error) {
+	records, err := c.tx.tx.FindMany(ctx, "Post", args.query())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Post, 0, len(records))
+	for _, record := range records {
+		result = append(result, recordToPost(record))
+	}
+	return result, nil
+}
+
+func (c PostTxClient) Update(ctx context.Context, args PostUpdateArgs) (Post, bool, error) {
+	if _, ok, err := c.FindUnique(ctx, PostFindUniqueArgs{Where: args.Where}); err != nil || !ok {
+		return Post{}, ok, err
+	}
+	updatedRecord, err := c.tx.tx.Update(ctx, "Post", args.Where.where(), args.Data.record())
+	if err != nil {
+		return Post{}, false, err
+	}
+	if args.Include != nil {
+		return c.FindUnique(ctx, PostFindUniqueArgs{Where: args.Where, Include: args.Include})
+	}
+	return recordToPost(updatedRecord), true, nil
+}
+
+func (c PostTxClient) Upsert(ctx context.Context, args PostUpsertArgs) (Post, bool, error) {
+	record, created, err := c.tx.tx.Upsert(ctx, "Post", args.Where.where(), args.Create.record(), args.Update.record())
+	if err != nil {
+		return Post{}, false, err
+	}
+	converted := recordToPost(record)
+	if args.Include != nil {
+		recordWithInclude, ok, err := c.FindUnique(ctx, PostFindUniqueArgs{Where: args.Where, Include: args.Include})
+		if err == nil && ok {
+			converted = recordWithInclude
+		}
+	}
+	return converted, created, nil
+}
+
+func (c PostTxClient) Delete(ctx context.Context, args PostDeleteArgs) (Post, bool, error) {
+	previous, ok, err := c.FindUnique(ctx, PostFindUniqueArgs{Where: args.Where, Include: args.Include})
+	if err != nil || !ok {
+		return Post{}, ok, err
+	}
+	_, err = c.tx.tx.Delete(ctx, "Post", args.Where.where())
+	if err != nil {
+		return Post{}, false, err
+	}
+	return previous, true, nil
+}